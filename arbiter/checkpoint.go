@@ -27,12 +27,17 @@ const (
 	StatusNormal int = 0
 	// StatusRunning means server running or quit abnormally, part of data may or may not been synced to downstream
 	StatusRunning int = 1
+
+	// UnknownOffset means the kafka offset of the checkpoint is unknown,
+	// the consumption is resumed by seeking the ts.
+	UnknownOffset int64 = -1
 )
 
-// Checkpoint is able to save and load checkpoints
+// Checkpoint is able to save and load checkpoints,
+// offset is the kafka offset of the binlog whose commit ts is ts.
 type Checkpoint interface {
-	Save(ts int64, status int) error
-	Load() (ts int64, status int, err error)
+	Save(ts int64, offset int64, status int) error
+	Load() (ts int64, offset int64, status int, err error)
 }
 
 type dbCheckpoint struct {
@@ -66,41 +71,58 @@ func (c *dbCheckpoint) createSchemaIfNeed() error {
 	}
 
 	sql = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
-		topic_name VARCHAR(255) PRIMARY KEY, ts BIGINT NOT NULL, status INT NOT NULL)`,
-		pkgsql.QuoteSchema(c.database, c.table))
+		topic_name VARCHAR(255) PRIMARY KEY, ts BIGINT NOT NULL, status INT NOT NULL, kafka_offset BIGINT NOT NULL DEFAULT %d)`,
+		pkgsql.QuoteSchema(c.database, c.table), UnknownOffset)
 	_, err = c.db.Exec(sql)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	return nil
+	return errors.Trace(c.addOffsetColumnIfNeed())
+}
+
+// addOffsetColumnIfNeed adds the offset column to the table created by the old version
+func (c *dbCheckpoint) addOffsetColumnIfNeed() error {
+	var count int
+	sql := "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = ? AND table_name = ? AND column_name = 'kafka_offset'"
+	if err := c.db.QueryRow(sql, c.database, c.table).Scan(&count); err != nil {
+		return errors.Trace(err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	sql = fmt.Sprintf("ALTER TABLE %s ADD COLUMN kafka_offset BIGINT NOT NULL DEFAULT %d",
+		pkgsql.QuoteSchema(c.database, c.table), UnknownOffset)
+	_, err := c.db.Exec(sql)
+	return errors.Trace(err)
 }
 
-// Save saves the ts and status
-func (c *dbCheckpoint) Save(ts int64, status int) error {
-	sql := fmt.Sprintf("REPLACE INTO %s(topic_name, ts, status) VALUES(?,?,?)",
+// Save saves the ts, offset and status
+func (c *dbCheckpoint) Save(ts int64, offset int64, status int) error {
+	sql := fmt.Sprintf("REPLACE INTO %s(topic_name, ts, status, kafka_offset) VALUES(?,?,?,?)",
 		pkgsql.QuoteSchema(c.database, c.table))
-	_, err := c.db.Exec(sql, c.topicName, ts, status)
+	_, err := c.db.Exec(sql, c.topicName, ts, status, offset)
 	if err != nil {
-		return errors.Annotatef(err, "exec fail: '%s', args: %s %d, %d", sql, c.topicName, ts, status)
+		return errors.Annotatef(err, "exec fail: '%s', args: %s %d, %d, %d", sql, c.topicName, ts, status, offset)
 	}
 
 	return nil
 }
 
-// Load return ts and status, if no record in checkpoint, return err = errors.NotFoundf
-func (c *dbCheckpoint) Load() (ts int64, status int, err error) {
-	sql := fmt.Sprintf("SELECT ts, status FROM %s WHERE topic_name = ?",
+// Load return ts, offset and status, if no record in checkpoint, return err = errors.NotFoundf
+func (c *dbCheckpoint) Load() (ts int64, offset int64, status int, err error) {
+	sql := fmt.Sprintf("SELECT ts, status, kafka_offset FROM %s WHERE topic_name = ?",
 		pkgsql.QuoteSchema(c.database, c.table))
 
 	row := c.db.QueryRow(sql, c.topicName)
 
-	err = row.Scan(&ts, &status)
+	err = row.Scan(&ts, &status, &offset)
 	if err != nil {
 		if errors.Cause(err) == gosql.ErrNoRows {
-			return 0, 0, errors.NotFoundf("no checkpoint for: %s", c.topicName)
+			return 0, UnknownOffset, 0, errors.NotFoundf("no checkpoint for: %s", c.topicName)
 		}
-		return 0, 0, errors.Trace(err)
+		return 0, UnknownOffset, 0, errors.Trace(err)
 	}
 
 	return
@@ -34,6 +34,8 @@ var _ = check.Suite(&CheckpointSuite{})
 func setNewExpect(mock sqlmock.Sqlmock) {
 	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("CREATE TABLE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM information_schema.columns").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 }
 
 func (cs *CheckpointSuite) TestNewCheckpoint(c *check.C) {
@@ -60,27 +62,47 @@ func (cs *CheckpointSuite) TestSaveAndLoad(c *check.C) {
 	mock.ExpectQuery(sql).WithArgs(cp.topicName).
 		WillReturnError(errors.NotFoundf("no checkpoint for: %s", cp.topicName))
 
-	_, _, err = cp.Load()
+	_, _, _, err = cp.Load()
 	c.Log(err)
 	c.Assert(errors.IsNotFound(err), check.IsTrue)
 
 	var saveTS int64 = 10
+	var saveOffset int64 = 100
 	saveStatus := 1
 	mock.ExpectExec("REPLACE INTO").
-		WithArgs(cp.topicName, saveTS, saveStatus).
+		WithArgs(cp.topicName, saveTS, saveStatus, saveOffset).
 		WillReturnResult(sqlmock.NewResult(0, 1))
-	err = cp.Save(saveTS, saveStatus)
+	err = cp.Save(saveTS, saveOffset, saveStatus)
 	c.Assert(err, check.IsNil)
 
-	rows := sqlmock.NewRows([]string{"ts", "status"}).
-		AddRow(saveTS, saveStatus)
-	mock.ExpectQuery("SELECT ts, status FROM").WillReturnRows(rows)
-	ts, status, err := cp.Load()
+	rows := sqlmock.NewRows([]string{"ts", "status", "kafka_offset"}).
+		AddRow(saveTS, saveStatus, saveOffset)
+	mock.ExpectQuery("SELECT ts, status, kafka_offset FROM").WillReturnRows(rows)
+	ts, offset, status, err := cp.Load()
 	c.Assert(err, check.IsNil)
 	c.Assert(ts, check.Equals, saveTS)
+	c.Assert(offset, check.Equals, saveOffset)
 	c.Assert(status, check.Equals, saveStatus)
 }
 
+func (cs *CheckpointSuite) TestAddOffsetColumn(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	// the table created by the old version has no offset column
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM information_schema.columns").
+		WithArgs("tidb_binlog", "arbiter_checkpoint").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("ALTER TABLE `tidb_binlog`.`arbiter_checkpoint` ADD COLUMN kafka_offset BIGINT NOT NULL DEFAULT -1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = createDbCheckpoint(db)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
 func createDbCheckpoint(db *gosql.DB) (*dbCheckpoint, error) {
 	cp, err := NewCheckpoint(db, "topic_name")
 	return cp.(*dbCheckpoint), err
@@ -75,6 +75,9 @@ type DownConfig struct {
 	Port     int    `toml:"port" json:"port"`
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
+	// read the password from the file or the environment variable instead, the file takes precedence
+	PasswordFile string `toml:"password-file" json:"password-file"`
+	PasswordEnv  string `toml:"password-env" json:"password-env"`
 
 	WorkerCount int  `toml:"worker-count" json:"worker-count"`
 	BatchSize   int  `toml:"batch-size" json:"batch-size"`
@@ -111,7 +114,7 @@ func NewConfig() *Config {
 }
 
 func (cfg *Config) String() string {
-	data, err := json.MarshalIndent(cfg, "\t", "\t")
+	data, err := json.MarshalIndent(cfg.Redacted(), "\t", "\t")
 	if err != nil {
 		log.Error("marshal Config failed", zap.Error(err))
 	}
@@ -119,6 +122,14 @@ func (cfg *Config) String() string {
 	return string(data)
 }
 
+// Redacted returns a copy of cfg with the password of downstream masked to log it,
+// the one read from password-file or password-env is resolved into the config
+func (cfg *Config) Redacted() *Config {
+	redacted := *cfg
+	redacted.Down.Password = util.RedactPassword(cfg.Down.Password)
+	return &redacted
+}
+
 // Parse parses all config from command-line flags, environment vars or the configuration file
 func (cfg *Config) Parse(args []string) error {
 	// parse first to get config file
@@ -191,6 +202,11 @@ func (cfg *Config) adjustConfig() error {
 	if len(cfg.Down.User) == 0 {
 		cfg.Down.User = "root"
 	}
+	password, err := util.ResolvePassword(cfg.Down.Password, cfg.Down.PasswordFile, cfg.Down.PasswordEnv)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Down.Password = password
 
 	return nil
 }
@@ -17,6 +17,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"runtime"
 	"strings"
@@ -42,6 +43,18 @@ func (t *TestConfigSuite) TestAdjustConfig(c *check.C) {
 	c.Assert(config.Down.Host, check.Equals, "localhost")
 	c.Assert(config.Down.Port, check.Equals, 3306)
 	c.Assert(config.Down.User, check.Equals, "root")
+
+	c.Assert(os.Setenv("TEST_ARBITER_PASSWORD", "from-env"), check.IsNil)
+	defer os.Unsetenv("TEST_ARBITER_PASSWORD")
+	config.Down.Password = "inline"
+	config.Down.PasswordEnv = "TEST_ARBITER_PASSWORD"
+	c.Assert(config.adjustConfig(), check.IsNil)
+	c.Assert(config.Down.Password, check.Equals, "from-env")
+
+	// the password isn't logged
+	c.Assert(config.Redacted().Down.Password, check.Equals, "******")
+	c.Assert(config.String(), check.Not(check.Matches), "(?s).*from-env.*")
+	c.Assert(config.Down.Password, check.Equals, "from-env")
 }
 
 func (t *TestConfigSuite) TestParseConfig(c *check.C) {
@@ -27,7 +27,6 @@ import (
 	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
-	"github.com/pingcap/tidb/store/tikv/oracle"
 	"go.uber.org/zap"
 )
 
@@ -53,6 +52,8 @@ type Server struct {
 
 	// all txn commitTS <= finishTS has loaded to downstream
 	finishTS int64
+	// the kafka offset of the binlog of finishTS
+	finishOffset int64
 
 	metrics *util.MetricClient
 
@@ -90,6 +91,7 @@ func NewServer(cfg *Config) (srv *Server, err error) {
 	}
 
 	srv.finishTS = up.InitialCommitTS
+	srv.finishOffset = UnknownOffset
 
 	status, err := srv.loadStatus()
 	if err != nil {
@@ -104,6 +106,11 @@ func NewServer(cfg *Config) (srv *Server, err error) {
 		SaramaBufferSize:  up.SaramaBufferSize,
 		MessageBufferSize: up.MessageBufferSize,
 	}
+	// resume from the next message of the checkpoint instead of seeking the ts if the offset is known
+	if srv.finishOffset != UnknownOffset {
+		readerCfg.CommitTS = 0
+		readerCfg.Offset = srv.finishOffset + 1
+	}
 
 	log.Info("use kafka binlog reader", zap.Reflect("cfg", readerCfg))
 
@@ -194,7 +201,7 @@ func (s *Server) Run() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		syncErr = syncBinlogs(syncCtx, s.kafkaReader.Messages(), s.load)
+		syncErr = syncBinlogs(syncCtx, s.kafkaReader.Messages(), s.load, s.finishTS)
 		if syncErr != nil {
 			s.Close()
 		}
@@ -226,17 +233,20 @@ func (s *Server) Run() error {
 
 func (s *Server) updateFinishTS(msg *reader.Message) {
 	s.finishTS = msg.Binlog.CommitTs
+	s.finishOffset = msg.Offset
 
-	ms := time.Now().UnixNano()/1000000 - oracle.ExtractPhysical(uint64(s.finishTS))
+	physical, _ := util.ExtractPhysicalLogical(s.finishTS)
+	ms := time.Now().UnixNano()/1000000 - physical
 	txnLatencySecondsHistogram.Observe(float64(ms) / 1000.0)
 }
 
 func (s *Server) saveFinishTS(status int) error {
-	err := s.checkpoint.Save(s.finishTS, status)
+	err := s.checkpoint.Save(s.finishTS, s.finishOffset, status)
 	if err != nil {
 		return err
 	}
-	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(s.finishTS))))
+	physical, _ := util.ExtractPhysicalLogical(s.finishTS)
+	checkpointTSOGauge.Set(float64(physical))
 	return nil
 }
 
@@ -270,7 +280,7 @@ L:
 }
 
 func (s *Server) loadStatus() (int, error) {
-	ts, status, err := s.checkpoint.Load()
+	ts, offset, status, err := s.checkpoint.Load()
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return 0, errors.Trace(err)
@@ -278,19 +288,26 @@ func (s *Server) loadStatus() (int, error) {
 		log.Info("no checkpoint found")
 		err = nil
 	} else {
-		log.Info("load checkpoint", zap.Int64("ts", ts), zap.Int("status", status))
+		log.Info("load checkpoint", zap.Int64("ts", ts), zap.Int64("offset", offset), zap.Int("status", status))
 		s.finishTS = ts
+		s.finishOffset = offset
 	}
 	return status, errors.Trace(err)
 }
 
-func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.Loader) (err error) {
+// syncBinlogs sends the binlogs to loader, the binlogs whose commit ts <= receivedTs are skipped
+func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.Loader, receivedTs int64) (err error) {
 	dest := ld.Input()
 	defer ld.Close()
-	var receivedTs int64
 	for msg := range source {
 		log.Debug("recv msg from kafka reader", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
 
+		// the txn markers share the commit ts of the txn, so they're dropped before the binlog of the txn is deduplicated
+		if !loader.IsSlaveBinlogData(msg.Binlog) {
+			log.Debug("skip binlog without data", zap.Int32("type", int32(msg.Binlog.Type)), zap.Int64("ts", msg.Binlog.CommitTs))
+			continue
+		}
+
 		if msg.Binlog.CommitTs <= receivedTs {
 			log.Info("skip repeated binlog", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
 			continue
@@ -23,6 +23,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
 	pb "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
@@ -124,8 +125,7 @@ func (s *testNewServerSuite) TestStopIfCannotCreateCheckpoint(c *C) {
 }
 
 func (s *testNewServerSuite) TestStopIfCannotLoadStatus(c *C) {
-	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
-	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	setNewExpect(s.dbMock)
 	s.dbMock.ExpectQuery("SELECT ts, status.*").
 		WithArgs("test_topic").
 		WillReturnError(errors.New("Failed load"))
@@ -141,8 +141,7 @@ func (s *testNewServerSuite) TestStopIfCannotLoadStatus(c *C) {
 }
 
 func (s *testNewServerSuite) TestStopIfCannotCreateReader(c *C) {
-	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
-	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	setNewExpect(s.dbMock)
 	s.dbMock.ExpectQuery("SELECT ts, status.*").
 		WithArgs("test_topic").
 		WillReturnError(errors.NotFoundf(""))
@@ -161,8 +160,7 @@ func (s *testNewServerSuite) TestStopIfCannotCreateReader(c *C) {
 }
 
 func (s *testNewServerSuite) TestStopIfCannotCreateLoader(c *C) {
-	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
-	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	setNewExpect(s.dbMock)
 	s.dbMock.ExpectQuery("SELECT ts, status.*").
 		WithArgs("test_topic").
 		WillReturnError(errors.New("not found"))
@@ -181,9 +179,8 @@ func (s *testNewServerSuite) TestStopIfCannotCreateLoader(c *C) {
 }
 
 func (s *testNewServerSuite) TestSetSafeMode(c *C) {
-	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
-	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
-	rows := sqlmock.NewRows([]string{"ts", "status"}).AddRow(42, StatusRunning)
+	setNewExpect(s.dbMock)
+	rows := sqlmock.NewRows([]string{"ts", "status", "kafka_offset"}).AddRow(42, StatusRunning, UnknownOffset)
 	s.dbMock.ExpectQuery("SELECT ts, status.*").
 		WithArgs("test_topic").
 		WillReturnRows(rows)
@@ -211,9 +208,43 @@ func (s *testNewServerSuite) TestSetSafeMode(c *C) {
 	c.Assert(ld.safe, IsFalse)
 }
 
+func (s *testNewServerSuite) TestResumeFromCheckpointOffset(c *C) {
+	var readerCfg *reader.Config
+	newReader = func(cfg *reader.Config) (r *reader.Reader, err error) {
+		readerCfg = cfg
+		return &reader.Reader{}, nil
+	}
+	cfg := Config{
+		ListenAddr: "localhost:8080",
+		Up: UpConfig{
+			Topic: "test_topic",
+		},
+	}
+
+	// the consumer restarts after the binlog of ts 42 at offset 100 is loaded
+	setNewExpect(s.dbMock)
+	rows := sqlmock.NewRows([]string{"ts", "status", "kafka_offset"}).AddRow(42, StatusNormal, 100)
+	s.dbMock.ExpectQuery("SELECT ts, status.*").WithArgs("test_topic").WillReturnRows(rows)
+	srv, err := NewServer(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(srv.finishTS, Equals, int64(42))
+	c.Assert(srv.finishOffset, Equals, int64(100))
+	c.Assert(readerCfg.Offset, Equals, int64(101))
+	c.Assert(readerCfg.CommitTS, Equals, int64(0))
+
+	// seek by the ts if the offset isn't saved
+	setNewExpect(s.dbMock)
+	rows = sqlmock.NewRows([]string{"ts", "status", "kafka_offset"}).AddRow(42, StatusNormal, UnknownOffset)
+	s.dbMock.ExpectQuery("SELECT ts, status.*").WithArgs("test_topic").WillReturnRows(rows)
+	_, err = NewServer(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(readerCfg.Offset, Equals, int64(0))
+	c.Assert(readerCfg.CommitTS, Equals, int64(42))
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+}
+
 func (s *testNewServerSuite) TestCreateMetricCli(c *C) {
-	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
-	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	setNewExpect(s.dbMock)
 	s.dbMock.ExpectQuery("SELECT ts, status.*").
 		WithArgs("test_topic").
 		WillReturnError(errors.New("not found"))
@@ -243,10 +274,12 @@ func (s *updateFinishTSSuite) TestShouldSetFinishTS(c *C) {
 		Binlog: &pb.Binlog{
 			CommitTs: 1024,
 		},
+		Offset: 7,
 	}
 	c.Assert(server.finishTS, Equals, int64(0))
 	server.updateFinishTS(&msg)
 	c.Assert(server.finishTS, Equals, int64(1024))
+	c.Assert(server.finishOffset, Equals, int64(7))
 }
 
 type trackTSSuite struct{}
@@ -256,11 +289,13 @@ var _ = Suite(&trackTSSuite{})
 type dummyCp struct {
 	Checkpoint
 	timestamps []int64
+	offsets    []int64
 	status     []int
 }
 
-func (cp *dummyCp) Save(ts int64, status int) error {
+func (cp *dummyCp) Save(ts int64, offset int64, status int) error {
 	cp.timestamps = append(cp.timestamps, ts)
+	cp.offsets = append(cp.offsets, offset)
 	cp.status = append(cp.status, status)
 	return nil
 }
@@ -282,12 +317,14 @@ func (s *trackTSSuite) TestShouldUpdateFinishTS(c *C) {
 	}()
 
 	for i := 0; i < 42; i++ {
-		successes <- &loader.Txn{Metadata: &reader.Message{Binlog: &pb.Binlog{CommitTs: int64(i)}}}
+		successes <- &loader.Txn{Metadata: &reader.Message{Binlog: &pb.Binlog{CommitTs: int64(i)}, Offset: int64(i + 100)}}
 	}
 	close(successes)
 
 	wg.Wait()
 	c.Assert(server.finishTS, Equals, int64(41))
+	c.Assert(server.finishOffset, Equals, int64(141))
+	c.Assert(cp.offsets[len(cp.offsets)-1], Equals, int64(141))
 }
 
 func (s *trackTSSuite) TestShouldSaveFinishTS(c *C) {
@@ -337,12 +374,13 @@ var _ = Suite(&loadStatusSuite{})
 type configurableCp struct {
 	Checkpoint
 	ts     int64
+	offset int64
 	status int
 	err    error
 }
 
-func (c *configurableCp) Load() (ts int64, status int, err error) {
-	return c.ts, c.status, c.err
+func (c *configurableCp) Load() (ts int64, offset int64, status int, err error) {
+	return c.ts, c.offset, c.status, c.err
 }
 
 func (s *loadStatusSuite) TestShouldIgnoreNotFound(c *C) {
@@ -415,7 +453,7 @@ func (s *syncBinlogsSuite) TestShouldSendBinlogToLoader(c *C) {
 	}()
 	ld := dummyLoader{input: dest}
 
-	err := syncBinlogs(context.Background(), source, &ld)
+	err := syncBinlogs(context.Background(), source, &ld, 0)
 	c.Assert(err, IsNil)
 
 	c.Assert(len(dest), Equals, len(expectMsgs))
@@ -427,6 +465,44 @@ func (s *syncBinlogsSuite) TestShouldSendBinlogToLoader(c *C) {
 	c.Assert(ld.closed, IsTrue)
 }
 
+func (s *syncBinlogsSuite) TestShouldDropTxnMarkers(c *C) {
+	// drainer writes the markers with the commit ts of the txn before and after it with txn-markers enabled
+	begin, commit := translator.SlaveTxnMarkers(2)
+	ddl := s.createMsg("test42", "operations", "alter table operations drop column seq", 2)
+	ddl.Binlog.Type = pb.BinlogType_DDL
+	source := make(chan *reader.Message, 4)
+	source <- &reader.Message{Binlog: begin}
+	source <- ddl
+	source <- &reader.Message{Binlog: commit}
+	source <- &reader.Message{Binlog: translator.SlaveResolvedTS(2)}
+	close(source)
+	dest := make(chan *loader.Txn, 4)
+	ld := dummyLoader{input: dest}
+
+	err := syncBinlogs(context.Background(), source, &ld, 1)
+	c.Assert(err, IsNil)
+	c.Assert(len(dest), Equals, 1)
+	txn := <-dest
+	c.Assert(txn.Metadata.(*reader.Message), Equals, ddl)
+	c.Assert(txn.DDL.SQL, Equals, "alter table operations drop column seq")
+}
+
+func (s *syncBinlogsSuite) TestShouldSkipLoadedBinlogs(c *C) {
+	source := make(chan *reader.Message, 2)
+	source <- s.createMsg("test42", "users", "alter table users add column gender smallint", 1)
+	source <- s.createMsg("test42", "operations", "alter table operations drop column seq", 2)
+	close(source)
+	dest := make(chan *loader.Txn, 2)
+	ld := dummyLoader{input: dest}
+
+	// the binlog of ts 1 is loaded before restarting
+	err := syncBinlogs(context.Background(), source, &ld, 1)
+	c.Assert(err, IsNil)
+	c.Assert(len(dest), Equals, 1)
+	txn := <-dest
+	c.Assert(txn.Metadata.(*reader.Message).Binlog.CommitTs, Equals, int64(2))
+}
+
 func (s *syncBinlogsSuite) TestShouldQuitWhenSomeErrorOccurs(c *C) {
 	readerMsgs := make(chan *reader.Message, 1024)
 	dummyLoaderImpl := &dummyLoader{
@@ -454,7 +530,7 @@ func (s *syncBinlogsSuite) TestShouldQuitWhenSomeErrorOccurs(c *C) {
 	}()
 	errCh := make(chan error)
 	go func() {
-		errCh <- syncBinlogs(ctx, readerMsgs, dummyLoaderImpl)
+		errCh <- syncBinlogs(ctx, readerMsgs, dummyLoaderImpl, 0)
 	}()
 
 	cancel()
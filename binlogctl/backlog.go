@@ -0,0 +1,137 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+)
+
+var backlogRequestTimeout = 30 * time.Second
+
+// pumpBacklog is the backlog estimated by a pump, it's the JSON returned by the backlog API of pump
+type pumpBacklog struct {
+	Binlogs int64 `json:"binlogs"`
+	Txns    int64 `json:"txns"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// EstimateReplicationBacklog estimates the txns and the bytes to replay after startTS up to endTS by querying
+// the pumps not offline, endTS 0 means up to the max commit ts of every pump. If startTS is 0, it's the commit ts
+// of the mysql/tidb checkpoint read from the downstream of checkpointDSN, like `root:password@tcp(127.0.0.1:3306)/`.
+// The estimate of every pump and the total are written to w.
+func EstimateReplicationBacklog(urls string, checkpointDSN string, startTS, endTS int64, w io.Writer) error {
+	if startTS == 0 {
+		var err error
+		if startTS, err = readCheckpointTS(checkpointDSN); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if endTS > 0 && endTS < startTS {
+		return errors.Errorf("invalid TSO range, end ts %d is less than start ts %d", endTS, startTS)
+	}
+
+	registry, err := createRegistryFuc(urls)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pumps, err := registry.Nodes(context.Background(), node.NodePrefix[node.PumpNode])
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sort.Slice(pumps, func(i, j int) bool { return pumps[i].NodeID < pumps[j].NodeID })
+
+	var total pumpBacklog
+	for _, pump := range pumps {
+		if pump.State == node.Offline {
+			continue
+		}
+		backlog, err := queryPumpBacklog(pump, startTS, endTS)
+		if err != nil {
+			return errors.Annotatef(err, "estimate the backlog of pump %s failed", pump.NodeID)
+		}
+		if _, err = fmt.Fprintf(w, "pump %s: %s\n", pump.NodeID, backlog); err != nil {
+			return errors.Trace(err)
+		}
+		total.Binlogs += backlog.Binlogs
+		total.Txns += backlog.Txns
+		total.Bytes += backlog.Bytes
+	}
+
+	_, err = fmt.Fprintf(w, "total after ts %d: %s\n", startTS, &total)
+	return errors.Trace(err)
+}
+
+// readCheckpointTS reads the commit ts of the checkpoint saved in the downstream of dsn,
+// the checkpoints of multiple clusters are ambiguous.
+func readCheckpointTS(dsn string) (int64, error) {
+	if len(dsn) == 0 {
+		return 0, errors.New("either the start ts or the checkpoint is required to estimate the backlog")
+	}
+
+	read, closeDB, err := newCheckpointReader(dsn)
+	if err != nil {
+		return 0, errors.Annotate(err, "open checkpoint failed")
+	}
+	defer closeDB()
+
+	positions, err := read()
+	if err != nil {
+		return 0, errors.Annotate(err, "read checkpoint failed")
+	}
+	if len(positions) != 1 {
+		return 0, errors.Errorf("found the checkpoints of %d clusters, specify the start ts instead", len(positions))
+	}
+	for _, ts := range positions {
+		return ts, nil
+	}
+	return 0, nil
+}
+
+func queryPumpBacklog(pump *node.Status, startTS, endTS int64) (*pumpBacklog, error) {
+	client := http.Client{Timeout: backlogRequestTimeout}
+	url := fmt.Sprintf("http://%s/backlog/%d/%d", pump.Addr, startTS, endTS)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("request %s failed with status %d: %s", url, resp.StatusCode, body)
+	}
+
+	backlog := new(pumpBacklog)
+	if err = json.Unmarshal(body, backlog); err != nil {
+		return nil, errors.Annotatef(err, "invalid backlog returned by %s: %s", url, body)
+	}
+	return backlog, nil
+}
+
+func (b *pumpBacklog) String() string {
+	return fmt.Sprintf("about %d txns in %d binlogs, %d bytes", b.Txns, b.Binlogs, b.Bytes)
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+)
+
+type backlogSuite struct{}
+
+var _ = Suite(&backlogSuite{})
+
+func (s *backlogSuite) SetUpTest(c *C) {
+	newEtcdClientFromCfgFunc = newFakeEtcdClientFromCfg
+	createRegistryFuc = createMockRegistry
+	_, err := createMockRegistry("127.0.0.1:2379")
+	c.Assert(err, IsNil)
+}
+
+// setBacklogPumpState registers the pump under the prefix of pumps, which is listed by the estimate
+func setBacklogPumpState(c *C, nodeID, addr, state string) {
+	nodePrefix := path.Join(node.DefaultRootPath, node.NodePrefix[node.PumpNode])
+	ns := &node.Status{NodeID: nodeID, Addr: addr, State: state, IsAlive: state == node.Online}
+	c.Assert(fakeRegistry.UpdateNode(context.Background(), nodePrefix, ns), IsNil)
+}
+
+func (s *backlogSuite) TearDownTest(c *C) {
+	// the other tests list the nodes registered by registerPumpForTest under the root path
+	etcdClient := etcd.NewClient(testEtcdCluster.RandClient(), node.DefaultRootPath)
+	c.Assert(etcdClient.Delete(context.Background(), node.NodePrefix[node.PumpNode], true), IsNil)
+	newEtcdClientFromCfgFunc = etcd.NewClientFromCfg
+	createRegistryFuc = createRegistry
+}
+
+// createBacklogPumpServer mocks a pump returning the backlog of the binlogs of txns, which are
+// (startTS, commitTS, bytes of the P-binlog) of the txns committed in order
+func createBacklogPumpServer(c *C, txns [][3]int64) (*httptest.Server, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var startTS, endTS int64
+		if _, err := fmt.Sscanf(r.URL.Path, "/backlog/%d/%d", &startTS, &endTS); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var binlogs, bytes int64
+		for _, txn := range txns {
+			for i, ts := range txn[:2] {
+				if ts <= startTS || (endTS > 0 && ts > endTS) {
+					continue
+				}
+				binlogs++
+				// the C-binlog carries no rows
+				bytes += 32
+				if i == 0 {
+					bytes += txn[2]
+				}
+			}
+		}
+		fmt.Fprintf(w, `{"binlogs": %d, "txns": %d, "bytes": %d}`, binlogs, (binlogs+1)/2, bytes)
+	}))
+	return server, strings.TrimPrefix(server.URL, "http://")
+}
+
+func (s *backlogSuite) TestEstimateBacklog(c *C) {
+	serverA, addrA := createBacklogPumpServer(c, [][3]int64{{1, 2, 1000}, {3, 5, 2000}, {6, 7, 3000}})
+	defer serverA.Close()
+	serverB, addrB := createBacklogPumpServer(c, [][3]int64{{4, 8, 500}})
+	defer serverB.Close()
+	setBacklogPumpState(c, "backlog-a", addrA, node.Online)
+	setBacklogPumpState(c, "backlog-b", addrB, node.Online)
+
+	var buf bytes.Buffer
+	c.Assert(EstimateReplicationBacklog("127.0.0.1:2379", "", 2, 0, &buf), IsNil)
+	c.Assert(buf.String(), Equals, "pump backlog-a: about 2 txns in 4 binlogs, 5128 bytes\n"+
+		"pump backlog-b: about 1 txns in 2 binlogs, 564 bytes\n"+
+		"total after ts 2: about 3 txns in 6 binlogs, 5692 bytes\n")
+
+	buf.Reset()
+	c.Assert(EstimateReplicationBacklog("127.0.0.1:2379", "", 2, 5, &buf), IsNil)
+	c.Assert(buf.String(), Matches, "(?s).*total after ts 2: about 2 txns in 3 binlogs, 2596 bytes\n")
+
+	c.Assert(EstimateReplicationBacklog("127.0.0.1:2379", "", 5, 2, &buf), ErrorMatches,
+		"invalid TSO range, end ts 2 is less than start ts 5")
+
+	// the offline pumps are skipped, and the failure of the others fails the estimate
+	serverB.Close()
+	c.Assert(EstimateReplicationBacklog("127.0.0.1:2379", "", 2, 0, &buf), ErrorMatches,
+		"estimate the backlog of pump backlog-b failed.*")
+	setBacklogPumpState(c, "backlog-b", addrB, node.Offline)
+	buf.Reset()
+	c.Assert(EstimateReplicationBacklog("127.0.0.1:2379", "", 2, 0, &buf), IsNil)
+	c.Assert(buf.String(), Matches, "(?s).*total after ts 2: about 2 txns in 4 binlogs, 5128 bytes\n")
+}
+
+func (s *backlogSuite) TestEstimateBacklogFromCheckpoint(c *C) {
+	server, addr := createBacklogPumpServer(c, [][3]int64{{1, 2, 1000}, {3, 5, 2000}})
+	defer server.Close()
+	setBacklogPumpState(c, "backlog-cp", addr, node.Online)
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	origOpen := openCheckpointDB
+	defer func() { openCheckpointDB = origOpen }()
+	openCheckpointDB = func(dsn string) (*sql.DB, error) {
+		return db, nil
+	}
+
+	query := regexp.QuoteMeta("SELECT clusterID, checkPoint FROM `tidb_binlog`.`checkpoint`")
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"clusterID", "checkPoint"}).AddRow(1, `{"commitTS": 2}`))
+	mock.ExpectClose()
+	var buf bytes.Buffer
+	c.Assert(EstimateReplicationBacklog("127.0.0.1:2379", "root:@tcp(127.0.0.1:3306)/", 0, 0, &buf), IsNil)
+	c.Assert(buf.String(), Equals, "pump backlog-cp: about 1 txns in 2 binlogs, 2064 bytes\n"+
+		"total after ts 2: about 1 txns in 2 binlogs, 2064 bytes\n")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the checkpoint DB is closed after reading
+	db, mock, err = sqlmock.New()
+	c.Assert(err, IsNil)
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"clusterID", "checkPoint"}).
+		AddRow(1, `{"commitTS": 2}`).AddRow(2, `{"commitTS": 3}`))
+	mock.ExpectClose()
+	err = EstimateReplicationBacklog("127.0.0.1:2379", "root:@tcp(127.0.0.1:3306)/", 0, 0, &buf)
+	c.Assert(err, ErrorMatches, "found the checkpoints of 2 clusters, specify the start ts instead")
+
+	err = EstimateReplicationBacklog("127.0.0.1:2379", "", 0, 0, &buf)
+	c.Assert(err, ErrorMatches, "either the start ts or the checkpoint is required to estimate the backlog")
+}
@@ -0,0 +1,258 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+)
+
+const (
+	defaultCheckpointSchema = "tidb_binlog"
+	checkpointTable         = "checkpoint"
+)
+
+var (
+	openCheckpointDB = func(dsn string) (*sql.DB, error) {
+		return sql.Open("mysql", dsn)
+	}
+	sleepFunc = time.Sleep
+)
+
+// checkpointPositions are the commit ts of the checkpoints keyed by the cluster ID
+type checkpointPositions map[uint64]int64
+
+type checkpointReader func() (checkpointPositions, error)
+
+// checkpointComparison compares the checkpoints of one cluster saved by the two drainers
+type checkpointComparison struct {
+	clusterID uint64
+	tsA       int64
+	tsB       int64
+	// both the checkpoints advanced while watching
+	splitBrain bool
+}
+
+// checkpointReport is the result of comparing the checkpoints of two drainers
+type checkpointReport struct {
+	comparisons []*checkpointComparison
+	// the clusters of which the checkpoint is only saved by one drainer
+	onlyA []uint64
+	onlyB []uint64
+}
+
+// CompareDrainerCheckpoints compares the mysql/tidb checkpoints of two drainers in active/standby mode,
+// the checkpoints are read from the downstream of dsnA and dsnB, like `root:password@tcp(127.0.0.1:3306)/`,
+// the database of the DSN is the schema of the checkpoint table, tidb_binlog by default.
+// If watch is positive, the checkpoints are read again after watch, and it's a split-brain if both of them advanced,
+// because only the active drainer should advance its checkpoint.
+// The report is written to w, and an error is returned if the checkpoints are inconsistent or split-brain is detected.
+func CompareDrainerCheckpoints(dsnA, dsnB string, watch time.Duration, w io.Writer) error {
+	readA, closeA, err := newCheckpointReader(dsnA)
+	if err != nil {
+		return errors.Annotate(err, "open checkpoint-a failed")
+	}
+	defer closeA()
+	readB, closeB, err := newCheckpointReader(dsnB)
+	if err != nil {
+		return errors.Annotate(err, "open checkpoint-b failed")
+	}
+	defer closeB()
+
+	report, err := compareCheckpoints(readA, readB, watch)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = report.writeTo(w); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(report.check())
+}
+
+func newCheckpointReader(dsn string) (checkpointReader, func(), error) {
+	db, schema, err := openCheckpointSchema(dsn)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	query := fmt.Sprintf("SELECT clusterID, checkPoint FROM `%s`.`%s`", schema, checkpointTable)
+	read := func() (checkpointPositions, error) {
+		return readCheckpoints(db, query)
+	}
+	return read, func() { db.Close() }, nil
+}
+
+// openCheckpointSchema opens the downstream of dsn and returns the schema of the checkpoint table,
+// it's the database of the DSN, tidb_binlog by default.
+func openCheckpointSchema(dsn string) (*sql.DB, string, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, "", errors.Annotatef(err, "invalid DSN %s", dsn)
+	}
+	schema := cfg.DBName
+	if len(schema) == 0 {
+		schema = defaultCheckpointSchema
+	}
+	// the schema may not exist yet, it's selected by the query instead
+	cfg.DBName = ""
+
+	db, err := openCheckpointDB(cfg.FormatDSN())
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	return db, schema, nil
+}
+
+func readCheckpoints(db *sql.DB, query string) (checkpointPositions, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "query failed, sql: %s", query)
+	}
+	defer rows.Close()
+
+	positions := make(checkpointPositions)
+	for rows.Next() {
+		var clusterID uint64
+		var str string
+		if err = rows.Scan(&clusterID, &str); err != nil {
+			return nil, errors.Trace(err)
+		}
+		var cp struct {
+			CommitTS int64 `json:"commitTS"`
+		}
+		if err = json.Unmarshal([]byte(str), &cp); err != nil {
+			return nil, errors.Annotatef(err, "invalid checkpoint of cluster %d: %s", clusterID, str)
+		}
+		positions[clusterID] = cp.CommitTS
+	}
+	return positions, errors.Trace(rows.Err())
+}
+
+func compareCheckpoints(readA, readB checkpointReader, watch time.Duration) (*checkpointReport, error) {
+	read := func() (checkpointPositions, checkpointPositions, error) {
+		a, err := readA()
+		if err != nil {
+			return nil, nil, errors.Annotate(err, "read checkpoint-a failed")
+		}
+		b, err := readB()
+		if err != nil {
+			return nil, nil, errors.Annotate(err, "read checkpoint-b failed")
+		}
+		return a, b, nil
+	}
+
+	a, b, err := read()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	prevA, prevB := a, b
+	if watch > 0 {
+		sleepFunc(watch)
+		if a, b, err = read(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	report := new(checkpointReport)
+	for clusterID, tsA := range a {
+		tsB, ok := b[clusterID]
+		if !ok {
+			report.onlyA = append(report.onlyA, clusterID)
+			continue
+		}
+		cmp := &checkpointComparison{clusterID: clusterID, tsA: tsA, tsB: tsB}
+		if watch > 0 {
+			// the checkpoint may be saved for the first time while watching
+			advancedA := tsA > prevA[clusterID]
+			advancedB := tsB > prevB[clusterID]
+			cmp.splitBrain = advancedA && advancedB
+		}
+		report.comparisons = append(report.comparisons, cmp)
+	}
+	for clusterID := range b {
+		if _, ok := a[clusterID]; !ok {
+			report.onlyB = append(report.onlyB, clusterID)
+		}
+	}
+
+	sort.Slice(report.comparisons, func(i, j int) bool {
+		return report.comparisons[i].clusterID < report.comparisons[j].clusterID
+	})
+	sort.Slice(report.onlyA, func(i, j int) bool { return report.onlyA[i] < report.onlyA[j] })
+	sort.Slice(report.onlyB, func(i, j int) bool { return report.onlyB[i] < report.onlyB[j] })
+	return report, nil
+}
+
+func (cmp *checkpointComparison) String() string {
+	var state string
+	physicalA, _ := util.ExtractPhysicalLogical(cmp.tsA)
+	physicalB, _ := util.ExtractPhysicalLogical(cmp.tsB)
+	lag := time.Duration(physicalA-physicalB) * time.Millisecond
+	switch {
+	case cmp.tsA > cmp.tsB:
+		state = fmt.Sprintf("checkpoint-a is ahead by %s", lag)
+	case cmp.tsA < cmp.tsB:
+		state = fmt.Sprintf("checkpoint-b is ahead by %s", -lag)
+	default:
+		state = "at the same position"
+	}
+	if cmp.splitBrain {
+		state += ", SPLIT-BRAIN: both advanced"
+	}
+	return fmt.Sprintf("cluster %d: checkpoint-a %d, checkpoint-b %d, %s", cmp.clusterID, cmp.tsA, cmp.tsB, state)
+}
+
+func (r *checkpointReport) writeTo(w io.Writer) error {
+	for _, cmp := range r.comparisons {
+		if _, err := fmt.Fprintln(w, cmp.String()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, clusterID := range r.onlyA {
+		if _, err := fmt.Fprintf(w, "cluster %d: only saved by checkpoint-a\n", clusterID); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, clusterID := range r.onlyB {
+		if _, err := fmt.Fprintf(w, "cluster %d: only saved by checkpoint-b\n", clusterID); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// check returns an error if the checkpoints are inconsistent or split-brain is detected
+func (r *checkpointReport) check() error {
+	var splitBrains []uint64
+	for _, cmp := range r.comparisons {
+		if cmp.splitBrain {
+			splitBrains = append(splitBrains, cmp.clusterID)
+		}
+	}
+	if len(splitBrains) > 0 {
+		return errors.Errorf("split-brain detected, both checkpoints of clusters %v advanced", splitBrains)
+	}
+	if len(r.onlyA) > 0 || len(r.onlyB) > 0 {
+		return errors.Errorf("inconsistent cluster IDs, clusters %v are only saved by checkpoint-a, clusters %v are only saved by checkpoint-b", r.onlyA, r.onlyB)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"bytes"
+	"database/sql"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type checkpointSuite struct{}
+
+var _ = Suite(&checkpointSuite{})
+
+func (s *checkpointSuite) SetUpTest(c *C) {
+	sleepFunc = func(time.Duration) {}
+}
+
+func (s *checkpointSuite) TearDownTest(c *C) {
+	sleepFunc = time.Sleep
+}
+
+// seqReader returns the positions in order on every read
+func seqReader(seq ...checkpointPositions) checkpointReader {
+	return func() (checkpointPositions, error) {
+		positions := seq[0]
+		if len(seq) > 1 {
+			seq = seq[1:]
+		}
+		return positions, nil
+	}
+}
+
+func tso(physical int64) int64 {
+	return physical << 18
+}
+
+func (s *checkpointSuite) TestActiveStandby(c *C) {
+	// only the active drainer advances its checkpoint
+	readA := seqReader(checkpointPositions{1: tso(1000)}, checkpointPositions{1: tso(3000)})
+	readB := seqReader(checkpointPositions{1: tso(500)})
+	report, err := compareCheckpoints(readA, readB, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(report.check(), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(report.writeTo(&buf), IsNil)
+	c.Assert(buf.String(), Equals, "cluster 1: checkpoint-a 786432000, checkpoint-b 131072000, checkpoint-a is ahead by 2.5s\n")
+}
+
+func (s *checkpointSuite) TestSplitBrain(c *C) {
+	readA := seqReader(
+		checkpointPositions{1: tso(1000), 2: tso(1000)},
+		checkpointPositions{1: tso(2000), 2: tso(2000)},
+	)
+	readB := seqReader(
+		checkpointPositions{1: tso(1500), 2: tso(1000)},
+		checkpointPositions{1: tso(2500), 2: tso(1000)},
+	)
+	report, err := compareCheckpoints(readA, readB, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(report.check(), ErrorMatches, `split-brain detected, both checkpoints of clusters \[1\] advanced`)
+
+	var buf bytes.Buffer
+	c.Assert(report.writeTo(&buf), IsNil)
+	c.Assert(buf.String(), Equals, "cluster 1: checkpoint-a 524288000, checkpoint-b 655360000, checkpoint-b is ahead by 500ms, SPLIT-BRAIN: both advanced\n"+
+		"cluster 2: checkpoint-a 524288000, checkpoint-b 262144000, checkpoint-a is ahead by 1s\n")
+
+	// split-brain isn't detected without watching
+	readA = seqReader(checkpointPositions{1: tso(1000)}, checkpointPositions{1: tso(2000)})
+	readB = seqReader(checkpointPositions{1: tso(1000)}, checkpointPositions{1: tso(2000)})
+	report, err = compareCheckpoints(readA, readB, 0)
+	c.Assert(err, IsNil)
+	c.Assert(report.check(), IsNil)
+	c.Assert(report.comparisons[0].String(), Equals, "cluster 1: checkpoint-a 262144000, checkpoint-b 262144000, at the same position")
+}
+
+func (s *checkpointSuite) TestInconsistentClusterIDs(c *C) {
+	readA := seqReader(checkpointPositions{1: tso(1000), 2: tso(1000)})
+	readB := seqReader(checkpointPositions{1: tso(1000), 3: tso(1000)})
+	report, err := compareCheckpoints(readA, readB, 0)
+	c.Assert(err, IsNil)
+	c.Assert(report.check(), ErrorMatches, `inconsistent cluster IDs, clusters \[2\] are only saved by checkpoint-a, clusters \[3\] are only saved by checkpoint-b`)
+
+	var buf bytes.Buffer
+	c.Assert(report.writeTo(&buf), IsNil)
+	c.Assert(buf.String(), Matches, "(?s).*cluster 2: only saved by checkpoint-a\ncluster 3: only saved by checkpoint-b\n")
+}
+
+func (s *checkpointSuite) TestCompareDrainerCheckpoints(c *C) {
+	dbA, mockA, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	dbB, mockB, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	origOpen := openCheckpointDB
+	defer func() { openCheckpointDB = origOpen }()
+	var dsns []string
+	openCheckpointDB = func(dsn string) (*sql.DB, error) {
+		dsns = append(dsns, dsn)
+		if len(dsns) == 1 {
+			return dbA, nil
+		}
+		return dbB, nil
+	}
+
+	mockA.ExpectQuery(regexp.QuoteMeta("SELECT clusterID, checkPoint FROM `tidb_binlog`.`checkpoint`")).
+		WillReturnRows(sqlmock.NewRows([]string{"clusterID", "checkPoint"}).AddRow(1, `{"commitTS": 100}`))
+	mockA.ExpectClose()
+	mockB.ExpectQuery(regexp.QuoteMeta("SELECT clusterID, checkPoint FROM `standby`.`checkpoint`")).
+		WillReturnRows(sqlmock.NewRows([]string{"clusterID", "checkPoint"}).AddRow(2, `{"commitTS": 100}`))
+	mockB.ExpectClose()
+
+	var buf bytes.Buffer
+	err = CompareDrainerCheckpoints("root:@tcp(127.0.0.1:3306)/", "root:@tcp(127.0.0.1:3307)/standby", 0, &buf)
+	c.Assert(err, ErrorMatches, "inconsistent cluster IDs.*")
+	c.Assert(dsns, DeepEquals, []string{"root@tcp(127.0.0.1:3306)/", "root@tcp(127.0.0.1:3307)/"})
+	c.Assert(buf.String(), Equals, "cluster 1: only saved by checkpoint-a\ncluster 2: only saved by checkpoint-b\n")
+	c.Assert(mockA.ExpectationsWereMet(), IsNil)
+	c.Assert(mockB.ExpectationsWereMet(), IsNil)
+
+	err = CompareDrainerCheckpoints("invalid", "root:@tcp(127.0.0.1:3307)/", 0, &buf)
+	c.Assert(err, ErrorMatches, "open checkpoint-a failed.*invalid DSN invalid.*")
+}
@@ -18,6 +18,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
@@ -29,6 +30,9 @@ import (
 const (
 	defaultEtcdURLs = "http://127.0.0.1:2379"
 	defaultDataDir  = "binlog_position"
+
+	// the layout of the wall-clock time of -since
+	sinceLayout = "2006-01-02 15:04:05"
 )
 
 const (
@@ -58,6 +62,21 @@ const (
 
 	// OfflineDrainer is comamnd used for offlien drainer.
 	OfflineDrainer = "offline-drainer"
+
+	// DumpFile is command used for dump the binlogs in pump's log file.
+	DumpFile = "dump-file"
+
+	// TimeToTSO is command used for print the TSO of the wall-clock time specified by -since.
+	TimeToTSO = "time-to-tso"
+
+	// CompareCheckpoints is command used for comparing the checkpoints of two drainers to detect split-brain
+	CompareCheckpoints = "compare-checkpoints"
+
+	// EstimateBacklog is command used for estimating the txns and the bytes to replay from a checkpoint
+	EstimateBacklog = "estimate-backlog"
+
+	// RebuildCheckpoint is command used for rebuilding the lost checkpoint of drainer from the marker table
+	RebuildCheckpoint = "rebuild-checkpoint"
 )
 
 // Config holds the configuration of drainer
@@ -74,8 +93,20 @@ type Config struct {
 	SSLKey           string `toml:"ssl-key" json:"ssl-key"`
 	State            string `toml:"state" json:"state"`
 	ShowOfflineNodes bool   `toml:"state" json:"show-offline-nodes"`
-	tls              *tls.Config
-	printVersion     bool
+	File             string `toml:"file" json:"file"`
+	JSON             bool   `toml:"json" json:"json"`
+	Since            string `toml:"since" json:"since"`
+	// the TSO of Since, 0 if Since is empty
+	SinceTSO     int64         `toml:"-" json:"-"`
+	CheckpointA  string        `toml:"checkpoint-a" json:"checkpoint-a"`
+	CheckpointB  string        `toml:"checkpoint-b" json:"checkpoint-b"`
+	Watch        time.Duration `toml:"watch" json:"watch"`
+	Checkpoint   string        `toml:"checkpoint" json:"checkpoint"`
+	StartTS      int64         `toml:"start-ts" json:"start-ts"`
+	EndTS        int64         `toml:"end-ts" json:"end-ts"`
+	MarkerTable  string        `toml:"marker-table" json:"marker-table"`
+	tls          *tls.Config
+	printVersion bool
 }
 
 // NewConfig returns an instance of configuration
@@ -83,7 +114,7 @@ func NewConfig() *Config {
 	cfg := &Config{}
 	cfg.FlagSet = flag.NewFlagSet("binlogctl", flag.ContinueOnError)
 
-	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"offline-pump\", \"offline-drainer\"")
+	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"offline-pump\", \"offline-drainer\", \"dump-file\", \"time-to-tso\", \"compare-checkpoints\", \"estimate-backlog\", \"rebuild-checkpoint\"")
 	cfg.FlagSet.StringVar(&cfg.NodeID, "node-id", "", "id of node, use to update some node with operation update-pump, update-drainer, pause-pump, pause-drainer, offline-pump and offline-drainer")
 	cfg.FlagSet.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "meta directory path")
 	cfg.FlagSet.StringVar(&cfg.EtcdURLs, "pd-urls", defaultEtcdURLs, "a comma separated list of PD endpoints")
@@ -93,6 +124,16 @@ func NewConfig() *Config {
 	cfg.FlagSet.StringVar(&cfg.TimeZone, "time-zone", "", "set time zone if you want save time info in savepoint file, for example `Asia/Shanghai` for CST time, `Local` for local time")
 	cfg.FlagSet.StringVar(&cfg.State, "state", "", "set node's state, can set to online, pausing, paused, closing or offline.")
 	cfg.FlagSet.BoolVar(&cfg.ShowOfflineNodes, "show-offline-nodes", false, "include offline nodes when querying pumps/drainers")
+	cfg.FlagSet.StringVar(&cfg.File, "file", "", "path of pump's binlog file, use to dump the binlogs with operation dump-file")
+	cfg.FlagSet.BoolVar(&cfg.JSON, "json", false, "print the binlogs in JSON format with operation dump-file")
+	cfg.FlagSet.StringVar(&cfg.Since, "since", "", "wall-clock time like `2019-04-28 09:30:00` in the time zone of -time-zone (local time by default), or in RFC3339 format. the binlogs started before it are skipped with operation dump-file, generate_meta saves its TSO instead of the current TSO, and time-to-tso prints its TSO")
+	cfg.FlagSet.StringVar(&cfg.CheckpointA, "checkpoint-a", "", "DSN like `root:password@tcp(127.0.0.1:3306)/` of the downstream saving the mysql/tidb checkpoint of one drainer, use to compare the checkpoints with operation compare-checkpoints, the database of the DSN is the schema of the checkpoint table, tidb_binlog by default")
+	cfg.FlagSet.StringVar(&cfg.CheckpointB, "checkpoint-b", "", "DSN of the downstream saving the mysql/tidb checkpoint of the other drainer, use with operation compare-checkpoints")
+	cfg.FlagSet.DurationVar(&cfg.Watch, "watch", 10*time.Second, "read the checkpoints again after it with operation compare-checkpoints, it's a split-brain if both checkpoints advanced. 0 means reading them only once without detecting split-brain")
+	cfg.FlagSet.StringVar(&cfg.Checkpoint, "checkpoint", "", "DSN of the downstream saving the mysql/tidb checkpoint of the drainer to resume, use with operation estimate-backlog, the commit ts of the checkpoint is the start of the backlog if -start-ts is 0, and with operation rebuild-checkpoint")
+	cfg.FlagSet.Int64Var(&cfg.StartTS, "start-ts", 0, "the commit ts to replay from with operation estimate-backlog, like the checkpoint of the drainer")
+	cfg.FlagSet.Int64Var(&cfg.EndTS, "end-ts", 0, "the commit ts to replay up to with operation estimate-backlog, 0 means up to the max commit ts of the pumps")
+	cfg.FlagSet.StringVar(&cfg.MarkerTable, "marker-table", "", "the marker table in the checkpoint schema maintained by drainer with `marker-table`, use with operation rebuild-checkpoint to rebuild the lost checkpoint from it")
 	cfg.FlagSet.BoolVar(&cfg.printVersion, "V", false, "prints version and exit")
 
 	return cfg
@@ -144,5 +185,56 @@ func (cfg *Config) validate() error {
 	if err != nil {
 		return errors.Errorf("parse EtcdURLs error: %s, %v", cfg.EtcdURLs, err)
 	}
+
+	if len(cfg.Since) > 0 {
+		cfg.SinceTSO, err = ParseTimeToTSO(cfg.Since, cfg.TimeZone)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	} else if cfg.Command == TimeToTSO {
+		return errors.Errorf("-since is required by cmd %s", TimeToTSO)
+	}
+
+	if cfg.Command == CompareCheckpoints {
+		if len(cfg.CheckpointA) == 0 || len(cfg.CheckpointB) == 0 {
+			return errors.Errorf("-checkpoint-a and -checkpoint-b are required by cmd %s", CompareCheckpoints)
+		}
+		if cfg.Watch < 0 {
+			return errors.Errorf("invalid watch %s, must not be negative", cfg.Watch)
+		}
+	}
+
+	if cfg.Command == EstimateBacklog {
+		if cfg.StartTS < 0 || cfg.EndTS < 0 {
+			return errors.Errorf("invalid start ts %d or end ts %d, must not be negative", cfg.StartTS, cfg.EndTS)
+		}
+		if cfg.StartTS == 0 && len(cfg.Checkpoint) == 0 {
+			return errors.Errorf("-start-ts or -checkpoint is required by cmd %s", EstimateBacklog)
+		}
+	}
+
+	if cfg.Command == RebuildCheckpoint && (len(cfg.Checkpoint) == 0 || len(cfg.MarkerTable) == 0) {
+		return errors.Errorf("-checkpoint and -marker-table are required by cmd %s", RebuildCheckpoint)
+	}
 	return nil
 }
+
+// ParseTimeToTSO parses the wall-clock time in the time zone, or in RFC3339 format,
+// and returns the smallest TSO allocated at or after it. The local time zone is used if timeZone is empty.
+func ParseTimeToTSO(value string, timeZone string) (int64, error) {
+	location := time.Local
+	if len(timeZone) > 0 {
+		var err error
+		if location, err = time.LoadLocation(timeZone); err != nil {
+			return 0, errors.Annotatef(err, "load time zone %s", timeZone)
+		}
+	}
+
+	t, err := time.ParseInLocation(sinceLayout, value, location)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return 0, errors.Errorf("invalid time %s, must be like `%s` or in RFC3339 format", value, sinceLayout)
+		}
+	}
+	return util.TimeToTSO(t), nil
+}
@@ -33,4 +33,60 @@ func (s *configSuite) TestConfig(c *C) {
 	c.Assert(config.Command, Equals, QueryPumps)
 	c.Assert(config.NodeID, Equals, "nodeID")
 	c.Assert(config.EtcdURLs, Equals, "127.0.0.1:2379")
+	c.Assert(config.SinceTSO, Equals, int64(0))
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=time-to-tso"})
+	c.Assert(err, ErrorMatches, ".*-since is required by cmd time-to-tso.*")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=time-to-tso", "-since=2019-04-26 15:10:38", "-time-zone=Asia/Shanghai"})
+	c.Assert(err, IsNil)
+	c.Assert(config.SinceTSO, Equals, int64(1556262638000<<18))
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=compare-checkpoints", "-checkpoint-a=root@tcp(127.0.0.1:3306)/"})
+	c.Assert(err, ErrorMatches, ".*-checkpoint-a and -checkpoint-b are required by cmd compare-checkpoints.*")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=compare-checkpoints", "-checkpoint-a=root@tcp(127.0.0.1:3306)/", "-checkpoint-b=root@tcp(127.0.0.1:3307)/", "-watch=-1s"})
+	c.Assert(err, ErrorMatches, ".*invalid watch -1s, must not be negative.*")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=estimate-backlog", "-end-ts=100"})
+	c.Assert(err, ErrorMatches, ".*-start-ts or -checkpoint is required by cmd estimate-backlog.*")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=estimate-backlog", "-start-ts=-1"})
+	c.Assert(err, ErrorMatches, ".*invalid start ts -1 or end ts 0, must not be negative.*")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=estimate-backlog", "-checkpoint=root@tcp(127.0.0.1:3306)/"})
+	c.Assert(err, IsNil)
+	c.Assert(config.Checkpoint, Equals, "root@tcp(127.0.0.1:3306)/")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=rebuild-checkpoint", "-checkpoint=root@tcp(127.0.0.1:3306)/"})
+	c.Assert(err, ErrorMatches, ".*-checkpoint and -marker-table are required by cmd rebuild-checkpoint.*")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-cmd=rebuild-checkpoint", "-checkpoint=root@tcp(127.0.0.1:3306)/", "-marker-table=marker"})
+	c.Assert(err, IsNil)
+	c.Assert(config.MarkerTable, Equals, "marker")
+}
+
+func (s *configSuite) TestParseTimeToTSO(c *C) {
+	ts, err := ParseTimeToTSO("2019-04-26 07:10:38", "UTC")
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, int64(1556262638000<<18))
+
+	// the time zone of RFC3339 format takes precedence
+	ts, err = ParseTimeToTSO("2019-04-26T15:10:38.846+08:00", "UTC")
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, int64(407964913197645824))
+
+	_, err = ParseTimeToTSO("2019-04-26", "UTC")
+	c.Assert(err, ErrorMatches, "invalid time 2019-04-26.*")
+	_, err = ParseTimeToTSO("2019-04-26 07:10:38", "Mars/Base")
+	c.Assert(err, ErrorMatches, "load time zone Mars/Base.*")
 }
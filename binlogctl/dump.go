@@ -0,0 +1,165 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/tidb-binlog/pump/storage"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+// binlogEntry is the decoded summary of a binlog in pump's log file
+type binlogEntry struct {
+	StartTS       int64             `json:"start-ts"`
+	CommitTS      int64             `json:"commit-ts"`
+	Type          string            `json:"type"`
+	SchemaVersion int64             `json:"schema-version,omitempty"`
+	DDLJobID      int64             `json:"ddl-job-id,omitempty"`
+	DDLQuery      string            `json:"ddl-query,omitempty"`
+	Schema        string            `json:"schema,omitempty"`
+	Table         string            `json:"table,omitempty"`
+	Mutations     []mutationSummary `json:"mutations,omitempty"`
+}
+
+// mutationSummary counts the row changes of a table in a binlog,
+// pump's binlog only records the table id, the table name is unknown without the schema.
+type mutationSummary struct {
+	TableID  int64 `json:"table-id"`
+	Inserted int   `json:"inserted"`
+	Updated  int   `json:"updated"`
+	Deleted  int   `json:"deleted"`
+}
+
+// DumpBinlogFile decodes the binlogs in pump's log file and writes them to w,
+// one line per binlog in JSON format if asJSON is true.
+// The binlogs started before sinceTS are skipped, so the commit binlog is kept with its prewrite binlog.
+func DumpBinlogFile(path string, asJSON bool, sinceTS int64, w io.Writer) error {
+	return storage.ReadLogFile(path, func(binlog *pb.Binlog) error {
+		if binlog.StartTs < sinceTS {
+			return nil
+		}
+
+		entry, err := newBinlogEntry(binlog)
+		if err != nil {
+			return errors.Annotatef(err, "decode binlog start ts %d", binlog.StartTs)
+		}
+
+		if asJSON {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			_, err = fmt.Fprintf(w, "%s\n", data)
+			return errors.Trace(err)
+		}
+
+		_, err = io.WriteString(w, entry.String())
+		return errors.Trace(err)
+	})
+}
+
+func newBinlogEntry(binlog *pb.Binlog) (*binlogEntry, error) {
+	entry := &binlogEntry{
+		StartTS:  binlog.StartTs,
+		CommitTS: binlog.CommitTs,
+		Type:     binlog.Tp.String(),
+	}
+
+	if len(binlog.DdlQuery) > 0 {
+		entry.DDLJobID = binlog.DdlJobId
+		entry.DDLQuery = string(binlog.DdlQuery)
+		// it's only used to display, so ignore the DDL that can't be parsed
+		entry.Schema, entry.Table = parseDDLTable(entry.DDLQuery)
+		return entry, nil
+	}
+
+	if len(binlog.PrewriteValue) == 0 {
+		return entry, nil
+	}
+
+	value := new(pb.PrewriteValue)
+	err := value.Unmarshal(binlog.PrewriteValue)
+	if err != nil {
+		return nil, errors.Annotate(err, "unmarshal prewrite value failed")
+	}
+
+	entry.SchemaVersion = value.SchemaVersion
+	for _, mut := range value.Mutations {
+		entry.Mutations = append(entry.Mutations, mutationSummary{
+			TableID:  mut.TableId,
+			Inserted: len(mut.InsertedRows),
+			Updated:  len(mut.UpdatedRows),
+			Deleted:  len(mut.DeletedIds) + len(mut.DeletedPks) + len(mut.DeletedRows),
+		})
+	}
+
+	return entry, nil
+}
+
+// String returns the readable text of the entry
+func (e *binlogEntry) String() string {
+	s := fmt.Sprintf("start-ts: %d, commit-ts: %d, type: %s", e.StartTS, e.CommitTS, e.Type)
+	if len(e.DDLQuery) > 0 {
+		s += fmt.Sprintf(", ddl-job-id: %d, schema: %s, table: %s\n  query: %s\n", e.DDLJobID, e.Schema, e.Table, e.DDLQuery)
+		return s
+	}
+
+	if e.SchemaVersion > 0 {
+		s += fmt.Sprintf(", schema-version: %d", e.SchemaVersion)
+	}
+	s += "\n"
+	for _, mut := range e.Mutations {
+		s += fmt.Sprintf("  table-id: %d, inserted: %d, updated: %d, deleted: %d\n", mut.TableID, mut.Inserted, mut.Updated, mut.Deleted)
+	}
+	return s
+}
+
+func parseDDLTable(sql string) (schema string, table string) {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return "", ""
+	}
+
+	var name *ast.TableName
+	switch v := stmt.(type) {
+	case *ast.CreateDatabaseStmt:
+		return v.Name, ""
+	case *ast.DropDatabaseStmt:
+		return v.Name, ""
+	case *ast.CreateTableStmt:
+		name = v.Table
+	case *ast.DropTableStmt:
+		name = v.Tables[0]
+	case *ast.AlterTableStmt:
+		name = v.Table
+	case *ast.RenameTableStmt:
+		name = v.OldTable
+	case *ast.TruncateTableStmt:
+		name = v.Table
+	case *ast.CreateIndexStmt:
+		name = v.Table
+	case *ast.DropIndexStmt:
+		name = v.Table
+	default:
+		return "", ""
+	}
+
+	return name.Schema.O, name.Name.O
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path"
+	"strings"
+
+	. "github.com/pingcap/check"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type dumpSuite struct{}
+
+var _ = Suite(&dumpSuite{})
+
+// writeLogFile writes binlogs in the record format of pump's log file
+func writeLogFile(c *C, name string, binlogs []*pb.Binlog) {
+	f, err := os.Create(name)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	for _, binlog := range binlogs {
+		payload, err := binlog.Marshal()
+		c.Assert(err, IsNil)
+
+		header := make([]byte, 16)
+		binary.LittleEndian.PutUint32(header, 0x823a56e8)
+		binary.LittleEndian.PutUint64(header[4:], uint64(len(payload)))
+		binary.LittleEndian.PutUint32(header[12:], crc32.Checksum(payload, crc32.MakeTable(crc32.Castagnoli)))
+		_, err = f.Write(append(header, payload...))
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *dumpSuite) TestDumpBinlogFile(c *C) {
+	value := &pb.PrewriteValue{
+		SchemaVersion: 10,
+		Mutations: []pb.TableMutation{
+			{
+				TableId:      45,
+				InsertedRows: [][]byte{{1}, {2}},
+				UpdatedRows:  [][]byte{{3}},
+			},
+			{
+				TableId:     46,
+				DeletedRows: [][]byte{{4}},
+			},
+		},
+	}
+	prewriteValue, err := value.Marshal()
+	c.Assert(err, IsNil)
+
+	name := path.Join(c.MkDir(), "binlog-0")
+	writeLogFile(c, name, []*pb.Binlog{
+		{Tp: pb.BinlogType_Prewrite, StartTs: 100, DdlJobId: 3, DdlQuery: []byte("create table test.t1(id int)")},
+		{Tp: pb.BinlogType_Commit, StartTs: 100, CommitTs: 101},
+		{Tp: pb.BinlogType_Prewrite, StartTs: 102, PrewriteValue: prewriteValue},
+		{Tp: pb.BinlogType_Rollback, StartTs: 102, CommitTs: 103},
+	})
+
+	var buf bytes.Buffer
+	err = DumpBinlogFile(name, false, 0, &buf)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, strings.Join([]string{
+		"start-ts: 100, commit-ts: 0, type: Prewrite, ddl-job-id: 3, schema: test, table: t1",
+		"  query: create table test.t1(id int)",
+		"start-ts: 100, commit-ts: 101, type: Commit",
+		"start-ts: 102, commit-ts: 0, type: Prewrite, schema-version: 10",
+		"  table-id: 45, inserted: 2, updated: 1, deleted: 0",
+		"  table-id: 46, inserted: 0, updated: 0, deleted: 1",
+		"start-ts: 102, commit-ts: 103, type: Rollback",
+		"",
+	}, "\n"))
+
+	buf.Reset()
+	err = DumpBinlogFile(name, true, 0, &buf)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, strings.Join([]string{
+		`{"start-ts":100,"commit-ts":0,"type":"Prewrite","ddl-job-id":3,"ddl-query":"create table test.t1(id int)","schema":"test","table":"t1"}`,
+		`{"start-ts":100,"commit-ts":101,"type":"Commit"}`,
+		`{"start-ts":102,"commit-ts":0,"type":"Prewrite","schema-version":10,"mutations":[{"table-id":45,"inserted":2,"updated":1,"deleted":0},{"table-id":46,"inserted":0,"updated":0,"deleted":1}]}`,
+		`{"start-ts":102,"commit-ts":103,"type":"Rollback"}`,
+		"",
+	}, "\n"))
+}
+
+func (s *dumpSuite) TestDumpSince(c *C) {
+	name := path.Join(c.MkDir(), "binlog-0")
+	writeLogFile(c, name, []*pb.Binlog{
+		{Tp: pb.BinlogType_Prewrite, StartTs: 100},
+		{Tp: pb.BinlogType_Prewrite, StartTs: 102},
+		{Tp: pb.BinlogType_Commit, StartTs: 100, CommitTs: 103},
+		{Tp: pb.BinlogType_Commit, StartTs: 102, CommitTs: 104},
+	})
+
+	// the commit binlog is skipped with its prewrite binlog even if it's committed after since
+	var buf bytes.Buffer
+	err := DumpBinlogFile(name, false, 101, &buf)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, strings.Join([]string{
+		"start-ts: 102, commit-ts: 0, type: Prewrite",
+		"start-ts: 102, commit-ts: 104, type: Commit",
+		"",
+	}, "\n"))
+}
+
+func (s *dumpSuite) TestDumpCorruptFile(c *C) {
+	name := path.Join(c.MkDir(), "binlog-0")
+	writeLogFile(c, name, []*pb.Binlog{{Tp: pb.BinlogType_Commit, StartTs: 100, CommitTs: 101}})
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("corrupted"))
+	c.Assert(err, IsNil)
+	f.Close()
+
+	var buf bytes.Buffer
+	err = DumpBinlogFile(name, false, 0, &buf)
+	c.Assert(err, ErrorMatches, ".*read record at offset.*")
+	c.Assert(buf.String(), Equals, "start-ts: 100, commit-ts: 101, type: Commit\n")
+
+	err = DumpBinlogFile(path.Join(c.MkDir(), "not-exist"), false, 0, &buf)
+	c.Assert(err, NotNil)
+}
@@ -32,22 +32,26 @@ import (
 
 var newPDClientFunc = pd.NewClient
 
-// GenerateMetaInfo generates Meta from pd
+// GenerateMetaInfo generates Meta from pd, or from the time of -since if it's specified
 func GenerateMetaInfo(cfg *Config) error {
 	if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
 		return errors.Trace(err)
 	}
 
-	// get newest ts from pd
-	commitTS, err := GetTSO(cfg)
-	if err != nil {
-		log.Error("get tso failed", zap.Error(err))
-		return errors.Trace(err)
+	commitTS := cfg.SinceTSO
+	if commitTS == 0 {
+		// get newest ts from pd
+		var err error
+		commitTS, err = GetTSO(cfg)
+		if err != nil {
+			log.Error("get tso failed", zap.Error(err))
+			return errors.Trace(err)
+		}
 	}
 
 	// generate meta file
 	metaFileName := path.Join(cfg.DataDir, "savepoint")
-	err = saveMeta(metaFileName, commitTS, cfg.TimeZone)
+	err := saveMeta(metaFileName, commitTS, cfg.TimeZone)
 	return errors.Trace(err)
 }
 
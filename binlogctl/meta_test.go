@@ -88,4 +88,12 @@ func (s *metaSuite) TestGenerateMetaInfo(c *C) {
 	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
 	c.Assert(lines, HasLen, 1)
 	c.Assert(lines[0], Equals, "commitTS = 32244168")
+
+	// the TSO of since is saved instead of the TSO from pd
+	cfg.SinceTSO = 1556262638000 << 18
+	err = GenerateMetaInfo(cfg)
+	c.Assert(err, IsNil)
+	b, err = ioutil.ReadFile(path.Join(dir, "savepoint"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.TrimSpace(string(b)), Equals, "commitTS = 407964912975872000")
 }
@@ -0,0 +1,150 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+)
+
+// RebuildCheckpointFromMarker rebuilds the mysql/tidb checkpoint lost in the downstream of checkpointDSN, like
+// `root:password@tcp(127.0.0.1:3306)/`, from markerTable in the same schema, which is maintained by drainer with
+// `marker-table` and updated to the commit ts of the checkpoint in the same transaction saving it.
+// Every cluster of the marker table gets a fresh checkpoint row at the commit ts of its marker, the existing
+// checkpoints are never overwritten. Nothing is written if a marker is ahead of the max commit ts of the pumps
+// not offline, because drainer can't resume from a position the binlog available never reaches.
+func RebuildCheckpointFromMarker(urls string, checkpointDSN string, markerTable string, w io.Writer) error {
+	db, schema, err := openCheckpointSchema(checkpointDSN)
+	if err != nil {
+		return errors.Annotate(err, "open checkpoint failed")
+	}
+	defer db.Close()
+
+	markers, err := readMarkers(db, fmt.Sprintf("SELECT clusterID, commitTS FROM `%s`.`%s`", schema, markerTable))
+	if err != nil {
+		return errors.Annotate(err, "read marker table failed")
+	}
+	if len(markers) == 0 {
+		return errors.Errorf("no marker found in `%s`.`%s`", schema, markerTable)
+	}
+	clusterIDs := make([]uint64, 0, len(markers))
+	for clusterID := range markers {
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	sort.Slice(clusterIDs, func(i, j int) bool { return clusterIDs[i] < clusterIDs[j] })
+
+	maxCommitTS, err := pumpsMaxCommitTS(urls)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, clusterID := range clusterIDs {
+		if ts := markers[clusterID]; ts > maxCommitTS {
+			return errors.Errorf("the marker %d of cluster %d is ahead of the binlog available in pumps up to %d, "+
+				"drainer can't resume from it, make sure the marker table belongs to the upstream of the pumps", ts, clusterID, maxCommitTS)
+		}
+	}
+
+	sqls := []string{
+		fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS `%s`", schema),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s`(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT)", schema, checkpointTable),
+	}
+	for _, sql := range sqls {
+		if _, err = db.Exec(sql); err != nil {
+			return errors.Annotatef(err, "exec failed, sql: %s", sql)
+		}
+	}
+	existing, err := readCheckpoints(db, fmt.Sprintf("SELECT clusterID, checkPoint FROM `%s`.`%s`", schema, checkpointTable))
+	if err != nil {
+		return errors.Annotate(err, "read checkpoint failed")
+	}
+
+	// it fails instead of overwriting the checkpoint saved after reading the existing ones
+	insertSQL := fmt.Sprintf("INSERT INTO `%s`.`%s` VALUES(?, ?)", schema, checkpointTable)
+	for _, clusterID := range clusterIDs {
+		if ts, ok := existing[clusterID]; ok {
+			if _, err = fmt.Fprintf(w, "cluster %d: the checkpoint exists at %d, skip it\n", clusterID, ts); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+
+		ts := markers[clusterID]
+		cp, err := json.Marshal(map[string]int64{"commitTS": ts})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if _, err = db.Exec(insertSQL, clusterID, string(cp)); err != nil {
+			return errors.Annotatef(err, "write the checkpoint of cluster %d failed, sql: %s", clusterID, insertSQL)
+		}
+		if _, err = fmt.Fprintf(w, "cluster %d: rebuild the checkpoint at %d from the marker\n", clusterID, ts); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// readMarkers reads the commit ts of the marker rows keyed by the cluster ID
+func readMarkers(db *sql.DB, query string) (checkpointPositions, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "query failed, sql: %s", query)
+	}
+	defer rows.Close()
+
+	markers := make(checkpointPositions)
+	for rows.Next() {
+		var clusterID uint64
+		var ts int64
+		if err = rows.Scan(&clusterID, &ts); err != nil {
+			return nil, errors.Trace(err)
+		}
+		markers[clusterID] = ts
+	}
+	return markers, errors.Trace(rows.Err())
+}
+
+// pumpsMaxCommitTS returns the max commit ts of the binlogs available in the pumps not offline
+func pumpsMaxCommitTS(urls string) (int64, error) {
+	registry, err := createRegistryFuc(urls)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	pumps, err := registry.Nodes(context.Background(), node.NodePrefix[node.PumpNode])
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	var maxCommitTS int64
+	var found bool
+	for _, pump := range pumps {
+		if pump.State == node.Offline {
+			continue
+		}
+		found = true
+		if pump.MaxCommitTS > maxCommitTS {
+			maxCommitTS = pump.MaxCommitTS
+		}
+	}
+	if !found {
+		return 0, errors.New("no pump found to check the binlog available")
+	}
+	return maxCommitTS, nil
+}
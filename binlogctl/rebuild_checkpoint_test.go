@@ -0,0 +1,135 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+)
+
+type rebuildCheckpointSuite struct{}
+
+var _ = Suite(&rebuildCheckpointSuite{})
+
+func (s *rebuildCheckpointSuite) SetUpTest(c *C) {
+	newEtcdClientFromCfgFunc = newFakeEtcdClientFromCfg
+	createRegistryFuc = createMockRegistry
+	_, err := createMockRegistry("127.0.0.1:2379")
+	c.Assert(err, IsNil)
+}
+
+func (s *rebuildCheckpointSuite) TearDownTest(c *C) {
+	etcdClient := etcd.NewClient(testEtcdCluster.RandClient(), node.DefaultRootPath)
+	c.Assert(etcdClient.Delete(context.Background(), node.NodePrefix[node.PumpNode], true), IsNil)
+	newEtcdClientFromCfgFunc = etcd.NewClientFromCfg
+	createRegistryFuc = createRegistry
+}
+
+func setPumpMaxCommitTS(c *C, nodeID, state string, maxCommitTS int64) {
+	nodePrefix := path.Join(node.DefaultRootPath, node.NodePrefix[node.PumpNode])
+	ns := &node.Status{NodeID: nodeID, Addr: nodeID + ":8250", State: state, IsAlive: state == node.Online, MaxCommitTS: maxCommitTS}
+	c.Assert(fakeRegistry.UpdateNode(context.Background(), nodePrefix, ns), IsNil)
+}
+
+func mockCheckpointDB(c *C) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	origOpen := openCheckpointDB
+	openCheckpointDB = func(dsn string) (*sql.DB, error) {
+		openCheckpointDB = origOpen
+		return db, nil
+	}
+	return mock
+}
+
+var (
+	selectMarkerSQL     = regexp.QuoteMeta("SELECT clusterID, commitTS FROM `tidb_binlog`.`marker`")
+	selectCheckpointSQL = regexp.QuoteMeta("SELECT clusterID, checkPoint FROM `tidb_binlog`.`checkpoint`")
+	insertCheckpointSQL = regexp.QuoteMeta("INSERT INTO `tidb_binlog`.`checkpoint` VALUES(?, ?)")
+)
+
+func (s *rebuildCheckpointSuite) TestRebuildFromMarker(c *C) {
+	setPumpMaxCommitTS(c, "rebuild-a", node.Online, 300)
+	setPumpMaxCommitTS(c, "rebuild-b", node.Paused, 500)
+	// the offline pump doesn't serve the binlog anymore
+	setPumpMaxCommitTS(c, "rebuild-c", node.Offline, 900)
+
+	mock := mockCheckpointDB(c)
+	mock.ExpectQuery(selectMarkerSQL).WillReturnRows(sqlmock.NewRows([]string{"clusterID", "commitTS"}).AddRow(2, 500).AddRow(1, 200))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE SCHEMA IF NOT EXISTS `tidb_binlog`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `tidb_binlog`.`checkpoint`(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// the checkpoint of cluster 1 is lost, the one of cluster 2 is kept as it's
+	mock.ExpectQuery(selectCheckpointSQL).WillReturnRows(sqlmock.NewRows([]string{"clusterID", "checkPoint"}).AddRow(2, `{"commitTS": 400}`))
+	mock.ExpectExec(insertCheckpointSQL).WithArgs(1, `{"commitTS":200}`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectClose()
+
+	var buf bytes.Buffer
+	c.Assert(RebuildCheckpointFromMarker("127.0.0.1:2379", "root:@tcp(127.0.0.1:3306)/", "marker", &buf), IsNil)
+	c.Assert(buf.String(), Equals, "cluster 1: rebuild the checkpoint at 200 from the marker\n"+
+		"cluster 2: the checkpoint exists at 400, skip it\n")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the checkpoint rebuilt is read as the one saved by drainer
+	mock = mockCheckpointDB(c)
+	mock.ExpectQuery(selectCheckpointSQL).WillReturnRows(sqlmock.NewRows([]string{"clusterID", "checkPoint"}).AddRow(1, `{"commitTS":200}`))
+	mock.ExpectClose()
+	ts, err := readCheckpointTS("root:@tcp(127.0.0.1:3306)/")
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, int64(200))
+}
+
+func (s *rebuildCheckpointSuite) TestMarkerAheadOfBinlog(c *C) {
+	setPumpMaxCommitTS(c, "rebuild-a", node.Online, 300)
+	setPumpMaxCommitTS(c, "rebuild-b", node.Offline, 900)
+
+	// nothing is written if any marker is ahead of the binlog available
+	mock := mockCheckpointDB(c)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT clusterID, commitTS FROM `db`.`marker`")).
+		WillReturnRows(sqlmock.NewRows([]string{"clusterID", "commitTS"}).AddRow(1, 200).AddRow(2, 600))
+	mock.ExpectClose()
+	var buf bytes.Buffer
+	err := RebuildCheckpointFromMarker("127.0.0.1:2379", "root:@tcp(127.0.0.1:3306)/db", "marker", &buf)
+	c.Assert(err, ErrorMatches, "the marker 600 of cluster 2 is ahead of the binlog available in pumps up to 300.*")
+	c.Assert(buf.Len(), Equals, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *rebuildCheckpointSuite) TestRebuildErrors(c *C) {
+	mock := mockCheckpointDB(c)
+	mock.ExpectQuery(selectMarkerSQL).WillReturnRows(sqlmock.NewRows([]string{"clusterID", "commitTS"}))
+	mock.ExpectClose()
+	err := RebuildCheckpointFromMarker("127.0.0.1:2379", "root:@tcp(127.0.0.1:3306)/", "marker", &bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "no marker found in `tidb_binlog`.`marker`")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the binlog available is unknown without pumps
+	mock = mockCheckpointDB(c)
+	mock.ExpectQuery(selectMarkerSQL).WillReturnRows(sqlmock.NewRows([]string{"clusterID", "commitTS"}).AddRow(1, 200))
+	mock.ExpectClose()
+	err = RebuildCheckpointFromMarker("127.0.0.1:2379", "root:@tcp(127.0.0.1:3306)/", "marker", &bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "no pump found to check the binlog available")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	err = RebuildCheckpointFromMarker("127.0.0.1:2379", "invalid", "marker", &bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "open checkpoint failed.*invalid DSN invalid.*")
+}
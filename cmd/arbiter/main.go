@@ -47,7 +47,7 @@ func main() {
 		sarama.Logger = stdlog.New(ioutil.Discard, "[Sarama] ", stdlog.LstdFlags)
 	}
 
-	log.Info("start arbiter...", zap.Reflect("config", cfg))
+	log.Info("start arbiter...", zap.Reflect("config", cfg.Redacted()))
 	version.PrintVersionInfo("Arbiter")
 
 	go startHTTPServer(cfg.ListenAddr)
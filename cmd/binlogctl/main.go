@@ -15,6 +15,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 
 	"github.com/pingcap/errors"
@@ -60,6 +61,16 @@ func main() {
 		err = ctl.ApplyAction(cfg.EtcdURLs, node.PumpNode, cfg.NodeID, close)
 	case ctl.OfflineDrainer:
 		err = ctl.ApplyAction(cfg.EtcdURLs, node.DrainerNode, cfg.NodeID, close)
+	case ctl.DumpFile:
+		err = ctl.DumpBinlogFile(cfg.File, cfg.JSON, cfg.SinceTSO, os.Stdout)
+	case ctl.TimeToTSO:
+		_, err = fmt.Printf("%d\n", cfg.SinceTSO)
+	case ctl.CompareCheckpoints:
+		err = ctl.CompareDrainerCheckpoints(cfg.CheckpointA, cfg.CheckpointB, cfg.Watch, os.Stdout)
+	case ctl.EstimateBacklog:
+		err = ctl.EstimateReplicationBacklog(cfg.EtcdURLs, cfg.Checkpoint, cfg.StartTS, cfg.EndTS, os.Stdout)
+	case ctl.RebuildCheckpoint:
+		err = ctl.RebuildCheckpointFromMarker(cfg.EtcdURLs, cfg.Checkpoint, cfg.MarkerTable, os.Stdout)
 	default:
 		err = errors.NotSupportedf("cmd %s", cfg.Command)
 	}
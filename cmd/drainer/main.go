@@ -43,7 +43,7 @@ func main() {
 		log.Fatal("Failed to initialize log", zap.Error(err))
 	}
 	version.PrintVersionInfo("Drainer")
-	log.Info("start drainer...", zap.Reflect("config", cfg))
+	log.Info("start drainer...", zap.Reflect("config", cfg.Redacted()))
 
 	bs, err := drainer.NewServer(cfg)
 	if err != nil {
@@ -24,18 +24,34 @@ var (
 	ErrCheckPointClosed = errors.New("CheckPoint already closed")
 )
 
+// The keys of the TsMap saved with the checkpoint, which maps the consistent TSs of the primary (upstream)
+// and the secondary (downstream) cluster, so the snapshots of both at them can be compared.
+// The secondary TS is derived from the downstream, e.g. it's the TSO of TiDB downstream after applying
+// the txns up to the primary TS. The master and slave keys are kept for the tools reading them.
+const (
+	PrimaryTSKey   = "primary-ts"
+	SecondaryTSKey = "secondary-ts"
+
+	masterTSKey = "master-ts"
+	slaveTSKey  = "slave-ts"
+)
+
 // CheckPoint is the binlog sync pos meta.
 // When syncer restarts, we should reload meta info to guarantee continuous transmission.
 type CheckPoint interface {
 	// Load loads checkpoint information.
 	Load() error
 
-	// Save saves checkpoint information.
+	// Save saves checkpoint information, the commit ts in upstream and the secondary ts in downstream,
+	// the TsMap is only updated if the secondary ts is positive.
 	Save(int64, int64) error
 
 	// Pos gets position information.
 	TS() int64
 
+	// SecondaryTS returns the saved secondary ts consistent with the primary ts, 0 if it's not saved.
+	SecondaryTS() int64
+
 	// Close closes the CheckPoint and release resources, after closed other methods should not be called again.
 	Close() error
 }
@@ -51,6 +67,8 @@ func NewCheckPoint(cfg *Config) (CheckPoint, error) {
 		cp, err = newMysql(cfg)
 	case "file":
 		cp, err = NewFile(cfg)
+	case "sqlite":
+		cp, err = NewSQLite(cfg)
 	default:
 		err = errors.Errorf("unsupported checkpoint type %s", cfg.CheckpointType)
 	}
@@ -58,7 +76,32 @@ func NewCheckPoint(cfg *Config) (CheckPoint, error) {
 		return nil, errors.Annotatef(err, "initialize %s type checkpoint with config %+v", cfg.CheckpointType, cfg)
 	}
 
+	if len(cfg.RewindAction) > 0 {
+		monotonic, err := newMonotonic(cp, cfg)
+		if err != nil {
+			cp.Close()
+			return nil, errors.Trace(err)
+		}
+		cp = monotonic
+	}
+
 	log.Info("initialize checkpoint", zap.String("type", cfg.CheckpointType), zap.Int64("checkpoint", cp.TS()), zap.Reflect("cfg", cfg))
 
 	return cp, nil
 }
+
+// updateTsMap maps the primary ts to the secondary ts in tsMap
+func updateTsMap(tsMap map[string]int64, primaryTS, secondaryTS int64) {
+	tsMap[PrimaryTSKey] = primaryTS
+	tsMap[SecondaryTSKey] = secondaryTS
+	tsMap[masterTSKey] = primaryTS
+	tsMap[slaveTSKey] = secondaryTS
+}
+
+// secondaryTS returns the secondary ts in tsMap, the slave ts is used for the checkpoints saved by old versions
+func secondaryTS(tsMap map[string]int64) int64 {
+	if ts, ok := tsMap[SecondaryTSKey]; ok {
+		return ts
+	}
+	return tsMap[slaveTSKey]
+}
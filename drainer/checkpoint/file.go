@@ -14,13 +14,19 @@
 package checkpoint
 
 import (
+	"bufio"
 	"bytes"
+	"io/ioutil"
 	"os"
+	"regexp"
+	"strconv"
 	"sync"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
 	"github.com/siddontang/go/ioutil2"
+	"go.uber.org/zap"
 )
 
 // FileCheckPoint is local CheckPoint struct.
@@ -40,7 +46,11 @@ func NewFile(cfg *Config) (CheckPoint, error) {
 		initialCommitTS: cfg.InitialCommitTS,
 		name:            cfg.CheckPointFile,
 	}
-	err := pb.Load()
+	err := pb.Compact()
+	if err != nil {
+		return pb, errors.Trace(err)
+	}
+	err = pb.Load()
 	if err != nil {
 		return pb, errors.Trace(err)
 	}
@@ -91,6 +101,68 @@ func (sp *FileCheckPoint) Save(ts, slaveTS int64) error {
 
 	sp.CommitTS = ts
 
+	return errors.Trace(sp.saveToFile())
+}
+
+var commitTSEntryRegexp = regexp.MustCompile(`^\s*commitTS\s*=\s*(-?\d+)\s*$`)
+
+// Compact rewrites the checkpoint file so that it only contains the newest
+// checkpoint entry, historical entries appended to the file are dropped.
+// It does nothing if the file doesn't exist or contains no entry.
+func (sp *FileCheckPoint) Compact() error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	data, err := ioutil.ReadFile(sp.name)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+
+	var (
+		latest  string
+		entries int
+		lines   int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		lines++
+		if m := commitTSEntryRegexp.FindStringSubmatch(scanner.Text()); m != nil {
+			latest = m[1]
+			entries++
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return errors.Annotatef(err, "read file %s failed", sp.name)
+	}
+
+	// nothing to compact
+	if entries == 0 || lines == 1 {
+		return nil
+	}
+
+	ts, err := strconv.ParseInt(latest, 10, 64)
+	if err != nil {
+		return errors.Annotatef(err, "parse commitTS %s failed", latest)
+	}
+
+	log.Info("compact checkpoint file", zap.String("file", sp.name),
+		zap.Int("entries", entries), zap.Int64("commitTS", ts))
+
+	sp.CommitTS = ts
+	return errors.Trace(sp.saveToFile())
+}
+
+func (sp *FileCheckPoint) saveToFile() error {
 	var buf bytes.Buffer
 	e := toml.NewEncoder(&buf)
 	err := e.Encode(sp)
@@ -114,6 +186,11 @@ func (sp *FileCheckPoint) TS() int64 {
 	return sp.CommitTS
 }
 
+// SecondaryTS implements CheckPoint.SecondaryTS interface, the secondary ts isn't saved to the file
+func (sp *FileCheckPoint) SecondaryTS() int64 {
+	return 0
+}
+
 // Close implements CheckPoint.Close interface
 func (sp *FileCheckPoint) Close() error {
 	sp.Lock()
@@ -14,7 +14,9 @@
 package checkpoint
 
 import (
+	"io/ioutil"
 	"os"
+	"path"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
@@ -67,3 +69,39 @@ func (t *testCheckPointSuite) TestFile(c *C) {
 	c.Assert(errors.Cause(meta.Save(0, 0)), Equals, ErrCheckPointClosed)
 	c.Assert(errors.Cause(meta.Close()), Equals, ErrCheckPointClosed)
 }
+
+func (t *testCheckPointSuite) TestCompactFile(c *C) {
+	fileName := path.Join(c.MkDir(), "savepoint")
+	history := "commitTS = 100\ncommitTS = 200\n\ncommitTS = 300\n"
+	err := ioutil.WriteFile(fileName, []byte(history), 0644)
+	c.Assert(err, IsNil)
+
+	// compact on startup
+	cfg := new(Config)
+	cfg.CheckPointFile = fileName
+	meta, err := NewFile(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(meta.TS(), Equals, int64(300))
+
+	data, err := ioutil.ReadFile(fileName)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "commitTS = 300\n")
+
+	// compact on demand
+	err = ioutil.WriteFile(fileName, []byte(string(data)+"commitTS = 400\n"), 0644)
+	c.Assert(err, IsNil)
+	fcp := meta.(*FileCheckPoint)
+	err = fcp.Compact()
+	c.Assert(err, IsNil)
+	c.Assert(fcp.TS(), Equals, int64(400))
+	data, err = ioutil.ReadFile(fileName)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "commitTS = 400\n")
+
+	// a compacted file is left untouched
+	err = fcp.Compact()
+	c.Assert(err, IsNil)
+	err = fcp.Load()
+	c.Assert(err, IsNil)
+	c.Assert(fcp.TS(), Equals, int64(400))
+}
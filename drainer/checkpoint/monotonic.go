@@ -0,0 +1,97 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"bytes"
+	"os"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/siddontang/go/ioutil2"
+	"go.uber.org/zap"
+)
+
+const (
+	// RewindActionWarn logs a warning if the checkpoint loaded on startup is lower than the high-water mark
+	RewindActionWarn = "warn"
+	// RewindActionRefuse fails to start if the checkpoint loaded on startup is lower than the high-water mark
+	RewindActionRefuse = "refuse"
+)
+
+// MonotonicCheckPoint records the highest commit ts saved by the checkpoint to a separate file, the high-water mark,
+// and checks the checkpoint loaded on startup isn't lower than it. So the checkpoint rewound accidentally, e.g. by
+// restoring a backup of the checkpoint table, is caught instead of replaying the txns synced already.
+type MonotonicCheckPoint struct {
+	CheckPoint
+
+	mu       sync.Mutex
+	markFile string
+
+	HighWaterMark int64 `toml:"highWaterMark" json:"highWaterMark"`
+}
+
+// newMonotonic checks the loaded checkpoint of cp against the high-water mark in cfg.HighWaterMarkFile
+// by cfg.RewindAction, the mark is missing if the file doesn't exist, and it's created by the first save.
+func newMonotonic(cp CheckPoint, cfg *Config) (*MonotonicCheckPoint, error) {
+	switch cfg.RewindAction {
+	case RewindActionWarn, RewindActionRefuse:
+	default:
+		return nil, errors.Errorf("invalid rewind-action %s, must be %s or %s", cfg.RewindAction, RewindActionWarn, RewindActionRefuse)
+	}
+
+	m := &MonotonicCheckPoint{CheckPoint: cp, markFile: cfg.HighWaterMarkFile}
+	if _, err := toml.DecodeFile(m.markFile, m); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, errors.Annotatef(err, "read the high-water mark file %s failed", m.markFile)
+	}
+
+	ts := cp.TS()
+	if ts >= m.HighWaterMark {
+		return m, nil
+	}
+	if cfg.RewindAction == RewindActionRefuse {
+		return nil, errors.Errorf("the checkpoint %d is lower than the high-water mark %d saved before, it may be rewound by restoring a backup, "+
+			"remove the high-water mark file %s if it's rewound on purpose", ts, m.HighWaterMark, m.markFile)
+	}
+	log.Warn("the checkpoint is lower than the high-water mark saved before, it may be rewound by restoring a backup, the txns after it are synced again",
+		zap.Int64("checkpoint", ts), zap.Int64("high-water mark", m.HighWaterMark), zap.String("file", m.markFile))
+	return m, nil
+}
+
+// Save implements CheckPoint.Save interface, the high-water mark is raised after the checkpoint is saved
+func (m *MonotonicCheckPoint) Save(ts, secondaryTS int64) error {
+	if err := m.CheckPoint.Save(ts, secondaryTS); err != nil {
+		return errors.Trace(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ts <= m.HighWaterMark {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]int64{"highWaterMark": ts}); err != nil {
+		return errors.Annotate(err, "encode the high-water mark failed")
+	}
+	// the checkpoint is saved already, the stale mark only checks the rewind less strictly
+	if err := ioutil2.WriteFileAtomic(m.markFile, buf.Bytes(), 0644); err != nil {
+		log.Warn("write the high-water mark file failed", zap.String("file", m.markFile), zap.Int64("ts", ts), zap.Error(err))
+		return nil
+	}
+	m.HighWaterMark = ts
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/siddontang/go/ioutil2"
+)
+
+func (t *testCheckPointSuite) TestRewoundCheckPoint(c *C) {
+	dir := c.MkDir()
+	cfg := &Config{
+		CheckpointType:    "file",
+		CheckPointFile:    filepath.Join(dir, "savepoint"),
+		RewindAction:      RewindActionRefuse,
+		HighWaterMarkFile: filepath.Join(dir, "checkpoint_high_water_mark"),
+	}
+
+	// the mark is missing before the first save
+	cp, err := NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(100, 0), IsNil)
+	backup, err := ioutil.ReadFile(cfg.CheckPointFile)
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(200, 0), IsNil)
+	c.Assert(cp.(*MonotonicCheckPoint).HighWaterMark, Equals, int64(200))
+	c.Assert(cp.Close(), IsNil)
+
+	cp, err = NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(200))
+	c.Assert(cp.(*MonotonicCheckPoint).HighWaterMark, Equals, int64(200))
+	c.Assert(cp.Close(), IsNil)
+
+	// restore the backup of the checkpoint at 100
+	c.Assert(ioutil2.WriteFileAtomic(cfg.CheckPointFile, backup, 0644), IsNil)
+	_, err = NewCheckPoint(cfg)
+	c.Assert(err, ErrorMatches, "the checkpoint 100 is lower than the high-water mark 200 saved before, .*"+
+		"remove the high-water mark file .*checkpoint_high_water_mark if it's rewound on purpose")
+
+	// it starts from the rewound checkpoint with a warning, and the mark isn't lowered by the saves below it
+	cfg.RewindAction = RewindActionWarn
+	cp, err = NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(100))
+	c.Assert(cp.(*MonotonicCheckPoint).HighWaterMark, Equals, int64(200))
+	c.Assert(cp.Save(150, 0), IsNil)
+	c.Assert(cp.(*MonotonicCheckPoint).HighWaterMark, Equals, int64(200))
+	c.Assert(cp.Save(250, 0), IsNil)
+	c.Assert(cp.(*MonotonicCheckPoint).HighWaterMark, Equals, int64(250))
+	c.Assert(cp.Close(), IsNil)
+
+	cfg.RewindAction = "ignore"
+	_, err = NewCheckPoint(cfg)
+	c.Assert(err, ErrorMatches, "invalid rewind-action ignore, must be warn or refuse")
+}
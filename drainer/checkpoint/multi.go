@@ -0,0 +1,123 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// MultiMysqlCheckPoint manages the checkpoints of multiple upstream clusters in one table,
+// the checkpoint of every cluster is saved in its own row keyed by the cluster ID,
+// and they share one connection pool of the database.
+type MultiMysqlCheckPoint struct {
+	mu     sync.Mutex
+	closed bool
+
+	db  *sql.DB
+	cfg Config
+	cps map[uint64]*MysqlCheckPoint
+}
+
+// NewMultiMysql creates the checkpoint table configured in cfg, cfg.ClusterID and cfg.InitialCommitTS are ignored.
+func NewMultiMysql(cfg *Config) (*MultiMysqlCheckPoint, error) {
+	setDefaultConfig(cfg)
+
+	tlsName, err := registerTLSConfig(cfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	db, err := openDB(cfg.Db, tlsName)
+	if err != nil {
+		return nil, errors.Annotate(err, "open db failed")
+	}
+
+	m := &MultiMysqlCheckPoint{
+		db:  db,
+		cfg: *cfg,
+		cps: make(map[uint64]*MysqlCheckPoint),
+	}
+	if err = createCheckPointTable(m.newCheckPoint(0, 0)); err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+
+	return m, nil
+}
+
+// Get returns the checkpoint of the cluster, it's loaded when it's got for the first time,
+// initialCommitTS is used if the checkpoint of the cluster isn't saved yet.
+// The checkpoint is closed by Close of MultiMysqlCheckPoint.
+func (m *MultiMysqlCheckPoint) Get(clusterID uint64, initialCommitTS int64) (CheckPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, errors.Trace(ErrCheckPointClosed)
+	}
+
+	if sp, ok := m.cps[clusterID]; ok {
+		return sp, nil
+	}
+
+	sp := m.newCheckPoint(clusterID, initialCommitTS)
+	if err := sp.Load(); err != nil {
+		return nil, errors.Annotatef(err, "load checkpoint of cluster %d failed", clusterID)
+	}
+	m.cps[clusterID] = sp
+	return sp, nil
+}
+
+// Close closes the checkpoints of all clusters and the database
+func (m *MultiMysqlCheckPoint) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	for _, sp := range m.cps {
+		// the checkpoint may be closed by the user already
+		_ = sp.Close()
+	}
+
+	err := m.db.Close()
+	if err == nil {
+		m.closed = true
+	}
+	return errors.Trace(err)
+}
+
+func (m *MultiMysqlCheckPoint) newCheckPoint(clusterID uint64, initialCommitTS int64) *MysqlCheckPoint {
+	return &MysqlCheckPoint{
+		db:              m.db,
+		sharedDB:        true,
+		clusterID:       clusterID,
+		initialCommitTS: initialCommitTS,
+		schema:          m.cfg.Schema,
+		table:           m.cfg.Table,
+		quote:           m.cfg.IdentifierQuote,
+		tableOptions:    m.cfg.TableOptions,
+		verifySave:      m.cfg.VerifySave,
+		markerTable:     m.cfg.MarkerTable,
+		recreateTable:   m.cfg.RecreateMissingTable,
+		readHint:        m.cfg.ReadHint,
+		readPrimary:     m.cfg.ReadPrimary,
+		TsMap:           make(map[string]int64),
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"database/sql"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+type multiSuite struct{}
+
+var _ = Suite(&multiSuite{})
+
+func (s *multiSuite) TestIndependentClusters(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	origOpen := sqlOpenDB
+	defer func() { sqlOpenDB = origOpen }()
+	sqlOpenDB = func(proto, host string, port int, username, password, tlsName string, initSQL []string) (*sql.DB, error) {
+		return db, nil
+	}
+
+	mock.ExpectExec("create schema if not exists `tidb_binlog`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists `tidb_binlog`.`checkpoint`.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	multi, err := NewMultiMysql(&Config{})
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery(regexp.QuoteMeta("select checkPoint from `tidb_binlog`.`checkpoint` where clusterID = 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}))
+	cp1, err := multi.Get(1, 100)
+	c.Assert(err, IsNil)
+	c.Assert(cp1.TS(), Equals, int64(100))
+
+	mock.ExpectQuery(regexp.QuoteMeta("select checkPoint from `tidb_binlog`.`checkpoint` where clusterID = 2")).
+		WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}).AddRow(`{"commitTS": 500}`))
+	cp2, err := multi.Get(2, 200)
+	c.Assert(err, IsNil)
+	c.Assert(cp2.TS(), Equals, int64(500))
+
+	// the loaded checkpoint is reused
+	again, err := multi.Get(1, 0)
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, cp1)
+
+	// saving the checkpoint of one cluster only writes its own row
+	mock.ExpectExec(regexp.QuoteMeta("replace into `tidb_binlog`.`checkpoint` values(1, ")).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(cp1.Save(1000, 0), IsNil)
+	c.Assert(cp1.TS(), Equals, int64(1000))
+	c.Assert(cp2.TS(), Equals, int64(500))
+
+	// closing the checkpoint of one cluster doesn't close the shared db
+	c.Assert(cp2.Close(), IsNil)
+	c.Assert(cp2.Save(600, 0), ErrorMatches, ".*CheckPoint already closed.*")
+	mock.ExpectExec(regexp.QuoteMeta("replace into `tidb_binlog`.`checkpoint` values(1, ")).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(cp1.Save(2000, 0), IsNil)
+
+	mock.ExpectClose()
+	c.Assert(multi.Close(), IsNil)
+	c.Assert(cp1.Save(3000, 0), ErrorMatches, ".*CheckPoint already closed.*")
+	_, err = multi.Get(3, 0)
+	c.Assert(err, ErrorMatches, ".*CheckPoint already closed.*")
+	c.Assert(multi.Close(), ErrorMatches, ".*CheckPoint already closed.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -16,12 +16,16 @@ package checkpoint
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pingcap/errors"
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/log"
 	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
 )
 
 // MysqlCheckPoint is a local savepoint struct for mysql
@@ -34,17 +38,53 @@ type MysqlCheckPoint struct {
 	db     *sql.DB
 	schema string
 	table  string
+	quote  pkgsql.IdentifierQuote
+	// the options of the checkpoint table
+	tableOptions pkgsql.TableOptions
+	// read the checkpoint back after it's saved
+	verifySave bool
+	// the marker table updated in the same transaction saving the checkpoint, see Config.MarkerTable
+	markerTable string
+	// recreate the checkpoint tables if they're dropped while saving the checkpoint
+	recreateTable bool
+	// the comment put before the checkpoint query, e.g. to route it to the primary by proxies, see Config.ReadHint
+	readHint string
+	// read the checkpoint by a locking read in a transaction, see Config.ReadPrimary
+	readPrimary bool
+	// the checkpoint is saved after the replicas execute the GTIDs executed by db
+	replicas       []*replica
+	replicaTimeout time.Duration
+	// the db is shared with the checkpoints of other clusters, it's closed by MultiMysqlCheckPoint
+	sharedDB bool
+	// db is reopened by reopenDB before it's used if it's idle for idleTimeout,
+	// because the idle connections may be dropped silently by proxies
+	idleTimeout time.Duration
+	reopenDB    func() (*sql.DB, error)
+	lastActive  time.Time
 
 	CommitTS int64            `toml:"commitTS" json:"commitTS"`
 	TsMap    map[string]int64 `toml:"ts-map" json:"ts-map"`
 }
 
-var sqlOpenDB = pkgsql.OpenDB
+var sqlOpenDB = pkgsql.OpenDBWithInitSQL
+
+// nowFunc is only changed in unit test to fake the clock
+var nowFunc = time.Now
+
+type replica struct {
+	addr string
+	db   *sql.DB
+}
 
 func newMysql(cfg *Config) (CheckPoint, error) {
 	setDefaultConfig(cfg)
 
-	db, err := sqlOpenDB("mysql", cfg.Db.Host, cfg.Db.Port, cfg.Db.User, cfg.Db.Password)
+	tlsName, err := registerTLSConfig(cfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	db, err := openDB(cfg.Db, tlsName)
 	if err != nil {
 		return nil, errors.Annotate(err, "open db failed")
 	}
@@ -55,23 +95,60 @@ func newMysql(cfg *Config) (CheckPoint, error) {
 		initialCommitTS: cfg.InitialCommitTS,
 		schema:          cfg.Schema,
 		table:           cfg.Table,
-		TsMap:           make(map[string]int64),
+		quote:           cfg.IdentifierQuote,
+		tableOptions:    cfg.TableOptions,
+		verifySave:      cfg.VerifySave,
+		markerTable:     cfg.MarkerTable,
+		recreateTable:   cfg.RecreateMissingTable,
+		readHint:        cfg.ReadHint,
+		readPrimary:     cfg.ReadPrimary,
+		idleTimeout:     cfg.IdleTimeout,
+		reopenDB: func() (*sql.DB, error) {
+			return openDB(cfg.Db, tlsName)
+		},
+		lastActive: nowFunc(),
+		TsMap:      make(map[string]int64),
 	}
 
-	sql := genCreateSchema(sp)
-	if _, err = db.Exec(sql); err != nil {
-		return nil, errors.Annotatef(err, "exec failed, sql: %s", sql)
+	if err = createCheckPointTable(sp); err != nil {
+		return nil, errors.Trace(err)
 	}
 
-	sql = genCreateTable(sp)
-	if _, err = db.Exec(sql); err != nil {
-		return nil, errors.Annotatef(err, "exec failed, sql: %s", sql)
+	sp.replicaTimeout = cfg.WaitReplicaTimeout
+	for _, replicaCfg := range cfg.WaitReplicas {
+		replicaDB, err := openDB(replicaCfg, "")
+		if err != nil {
+			sp.closeReplicas()
+			return nil, errors.Annotate(err, "open replica db failed")
+		}
+		addr := fmt.Sprintf("%s:%d", replicaCfg.Host, replicaCfg.Port)
+		sp.replicas = append(sp.replicas, &replica{addr: addr, db: replicaDB})
 	}
 
 	err = sp.Load()
 	return sp, errors.Trace(err)
 }
 
+func createCheckPointTable(sp *MysqlCheckPoint) error {
+	sql := genCreateSchema(sp)
+	if _, err := sp.db.Exec(sql); err != nil {
+		return errors.Annotatef(err, "exec failed, sql: %s", sql)
+	}
+
+	sql = genCreateTable(sp)
+	if _, err := sp.db.Exec(sql); err != nil {
+		return errors.Annotatef(err, "exec failed, sql: %s", sql)
+	}
+
+	if len(sp.markerTable) > 0 {
+		sql = genCreateMarkerTable(sp)
+		if _, err := sp.db.Exec(sql); err != nil {
+			return errors.Annotatef(err, "exec failed, sql: %s", sql)
+		}
+	}
+	return nil
+}
+
 // Load implements CheckPoint.Load interface
 func (sp *MysqlCheckPoint) Load() error {
 	sp.Lock()
@@ -81,15 +158,18 @@ func (sp *MysqlCheckPoint) Load() error {
 		return errors.Trace(ErrCheckPointClosed)
 	}
 
+	if err := sp.reopenIdleDB(); err != nil {
+		return errors.Trace(err)
+	}
+
 	defer func() {
 		if sp.CommitTS == 0 {
 			sp.CommitTS = sp.initialCommitTS
 		}
 	}()
 
-	var str string
 	selectSQL := genSelectSQL(sp)
-	err := sp.db.QueryRow(selectSQL).Scan(&str)
+	str, err := sp.read(selectSQL)
 	switch {
 	case err == sql.ErrNoRows:
 		sp.CommitTS = sp.initialCommitTS
@@ -114,11 +194,18 @@ func (sp *MysqlCheckPoint) Save(ts, slaveTS int64) error {
 		return errors.Trace(ErrCheckPointClosed)
 	}
 
+	if err := sp.reopenIdleDB(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := sp.waitReplicas(); err != nil {
+		return errors.Trace(err)
+	}
+
 	sp.CommitTS = ts
 
 	if slaveTS > 0 {
-		sp.TsMap["master-ts"] = ts
-		sp.TsMap["slave-ts"] = slaveTS
+		updateTsMap(sp.TsMap, ts, slaveTS)
 	}
 
 	b, err := json.Marshal(sp)
@@ -127,14 +214,168 @@ func (sp *MysqlCheckPoint) Save(ts, slaveTS int64) error {
 	}
 
 	sql := genReplaceSQL(sp, string(b))
-	_, err = sp.db.Exec(sql)
+	err = sp.exec(sql, ts)
+	if err != nil && isTableMissing(err) {
+		err = sp.recreateMissingTable(err, sql, ts)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if sp.verifySave {
+		return errors.Trace(sp.verify(ts))
+	}
+	return nil
+}
+
+// exec executes the checkpoint SQL, and updates the marker row to ts with it if the marker table is maintained
+func (sp *MysqlCheckPoint) exec(checkpointSQL string, ts int64) error {
+	if len(sp.markerTable) > 0 {
+		return errors.Trace(sp.saveWithMarker(checkpointSQL, ts))
+	}
+	_, err := sp.db.Exec(checkpointSQL)
+	return errors.Annotatef(err, "query sql failed: %s", checkpointSQL)
+}
+
+// recreateMissingTable recreates the checkpoint schema and tables dropped while drainer is running, and saves
+// the checkpoint again, if it's enabled. Otherwise, it fails with the way to recover from it.
+func (sp *MysqlCheckPoint) recreateMissingTable(saveErr error, checkpointSQL string, ts int64) error {
+	table := sp.quote.Schema(sp.schema, sp.table)
+	if !sp.recreateTable {
+		return errors.Annotatef(saveErr, "the checkpoint table %s is dropped while drainer is running, enable recreate-missing-table "+
+			"to recreate it, or restart drainer with initial-commit-ts %d to recreate it and continue from the checkpoint", table, ts)
+	}
+
+	log.Warn("the checkpoint table is dropped while drainer is running, recreate it",
+		zap.String("table", table), zap.Int64("checkpoint", ts), zap.Error(saveErr))
+	if err := createCheckPointTable(sp); err != nil {
+		return errors.Annotatef(err, "recreate the checkpoint table %s failed", table)
+	}
+	return errors.Trace(sp.exec(checkpointSQL, ts))
+}
+
+// saveWithMarker executes the checkpoint SQL and updates the marker row to ts in one transaction,
+// so the marker row always reflects the saved checkpoint.
+func (sp *MysqlCheckPoint) saveWithMarker(checkpointSQL string, ts int64) error {
+	tx, err := sp.db.Begin()
+	if err != nil {
+		return errors.Annotate(err, "begin the transaction saving checkpoint failed")
+	}
+
+	for _, sql := range []string{checkpointSQL, genReplaceMarkerSQL(sp, ts)} {
+		if _, err = tx.Exec(sql); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Warn("rollback the transaction saving checkpoint failed", zap.Error(rbErr))
+			}
+			return errors.Annotatef(err, "query sql failed: %s", sql)
+		}
+	}
+	return errors.Annotate(tx.Commit(), "commit the transaction saving checkpoint failed")
+}
+
+// reopenIdleDB reopens db if it's idle for idleTimeout, so the first use after idle doesn't fail
+// on the connection dropped by proxies, it must be called with sp locked before using db.
+func (sp *MysqlCheckPoint) reopenIdleDB() error {
+	now := nowFunc()
+	idle := now.Sub(sp.lastActive)
+	sp.lastActive = now
+	if sp.idleTimeout <= 0 || sp.sharedDB || idle < sp.idleTimeout {
+		return nil
+	}
+
+	log.Info("reopen the idle checkpoint db", zap.Duration("idle", idle), zap.Duration("idle-timeout", sp.idleTimeout))
+	db, err := sp.reopenDB()
 	if err != nil {
-		return errors.Annotatef(err, "query sql failed: %s", sql)
+		// try again next time
+		sp.lastActive = now.Add(-idle)
+		return errors.Annotate(err, "reopen idle checkpoint db failed")
+	}
+	if err = sp.db.Close(); err != nil {
+		log.Warn("close idle checkpoint db failed", zap.Error(err))
+	}
+	sp.db = db
+	return nil
+}
+
+// waitReplicas waits until the replicas execute all the GTIDs executed by db, so the data before
+// the checkpoint isn't lost if a replica is promoted after the checkpoint is saved.
+func (sp *MysqlCheckPoint) waitReplicas() error {
+	if len(sp.replicas) == 0 {
+		return nil
+	}
+
+	var gtidSet string
+	if err := sp.db.QueryRow("SELECT @@GLOBAL.gtid_executed").Scan(&gtidSet); err != nil {
+		return errors.Annotate(err, "query gtid_executed failed")
 	}
 
+	for _, r := range sp.replicas {
+		var timeout int
+		err := r.db.QueryRow("SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?)", gtidSet, sp.replicaTimeout.Seconds()).Scan(&timeout)
+		if err != nil {
+			return errors.Annotatef(err, "wait for replica %s failed", r.addr)
+		}
+		if timeout != 0 {
+			return errors.Errorf("wait for replica %s to execute gtid set %s timeout after %s", r.addr, gtidSet, sp.replicaTimeout)
+		}
+	}
 	return nil
 }
 
+func (sp *MysqlCheckPoint) closeReplicas() {
+	for _, r := range sp.replicas {
+		if err := r.db.Close(); err != nil {
+			log.Warn("close replica db failed", zap.String("addr", r.addr), zap.Error(err))
+		}
+	}
+	sp.replicas = nil
+}
+
+// verify reads the checkpoint back, and returns error if it's not ts,
+// which means the write is lost silently, e.g. by a proxy in front of the database.
+func (sp *MysqlCheckPoint) verify(ts int64) error {
+	selectSQL := genSelectSQL(sp)
+	str, err := sp.read(selectSQL)
+	switch {
+	case err == sql.ErrNoRows:
+		return errors.Errorf("verify checkpoint failed, the saved checkpoint %d is not found", ts)
+	case err != nil:
+		return errors.Annotatef(err, "QueryRow failed, sql: %s", selectSQL)
+	}
+
+	var saved struct {
+		CommitTS int64 `json:"commitTS"`
+	}
+	if err = json.Unmarshal([]byte(str), &saved); err != nil {
+		return errors.Trace(err)
+	}
+	if saved.CommitTS != ts {
+		return errors.Errorf("verify checkpoint failed, saved %d but read %d", ts, saved.CommitTS)
+	}
+	return nil
+}
+
+// read reads the checkpoint by selectSQL, it's read in a transaction if readPrimary is set, so the locking
+// read is routed to the primary by the read/write splitting proxies, and reads the latest checkpoint saved.
+func (sp *MysqlCheckPoint) read(selectSQL string) (str string, err error) {
+	if !sp.readPrimary {
+		err = sp.db.QueryRow(selectSQL).Scan(&str)
+		return
+	}
+
+	tx, err := sp.db.Begin()
+	if err != nil {
+		return "", errors.Annotate(err, "begin the transaction reading checkpoint failed")
+	}
+	if err = tx.QueryRow(selectSQL).Scan(&str); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Warn("rollback the transaction reading checkpoint failed", zap.Error(rbErr))
+		}
+		return "", err
+	}
+	return str, errors.Annotate(tx.Commit(), "commit the transaction reading checkpoint failed")
+}
+
 // TS implements CheckPoint.TS interface
 func (sp *MysqlCheckPoint) TS() int64 {
 	sp.RLock()
@@ -143,6 +384,14 @@ func (sp *MysqlCheckPoint) TS() int64 {
 	return sp.CommitTS
 }
 
+// SecondaryTS implements CheckPoint.SecondaryTS interface
+func (sp *MysqlCheckPoint) SecondaryTS() int64 {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return secondaryTS(sp.TsMap)
+}
+
 // Close implements CheckPoint.Close interface
 func (sp *MysqlCheckPoint) Close() error {
 	sp.Lock()
@@ -152,6 +401,12 @@ func (sp *MysqlCheckPoint) Close() error {
 		return errors.Trace(ErrCheckPointClosed)
 	}
 
+	sp.closeReplicas()
+	if sp.sharedDB {
+		sp.closed = true
+		return nil
+	}
+
 	err := sp.db.Close()
 	if err == nil {
 		sp.closed = true
@@ -15,11 +15,17 @@ package checkpoint
 
 import (
 	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 )
 
 func TestClient(t *testing.T) {
@@ -47,7 +53,7 @@ var _ = Suite(&saveSuite{})
 func (s *saveSuite) TestShouldSaveCheckpoint(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
-	mock.ExpectExec("replace into db.tbl.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 0))
 	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl"}
 	err = cp.Save(1111, 0)
 	c.Assert(err, IsNil)
@@ -67,6 +73,178 @@ func (s *saveSuite) TestShouldUpdateTsMap(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(cp.TsMap["master-ts"], Equals, int64(65536))
 	c.Assert(cp.TsMap["slave-ts"], Equals, int64(3333))
+	c.Assert(cp.TsMap[PrimaryTSKey], Equals, int64(65536))
+	c.Assert(cp.SecondaryTS(), Equals, int64(3333))
+
+	// the secondary ts is kept if it's not derived
+	mock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
+	c.Assert(cp.Save(70000, 0), IsNil)
+	c.Assert(cp.SecondaryTS(), Equals, int64(3333))
+}
+
+func (s *saveSuite) TestSecondaryTSUnset(c *C) {
+	cp := MysqlCheckPoint{TsMap: make(map[string]int64)}
+	c.Assert(cp.SecondaryTS(), Equals, int64(0))
+}
+
+func (s *saveSuite) TestVerifySave(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl", verifySave: true}
+
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("select checkPoint from `db`.`tbl`.*").
+		WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}).AddRow(`{"commitTS": 1111}`))
+	c.Assert(cp.Save(1111, 0), IsNil)
+
+	// the write is accepted but lost, the stale checkpoint is read back
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("select checkPoint from `db`.`tbl`.*").
+		WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}).AddRow(`{"commitTS": 1111}`))
+	err = cp.Save(2222, 0)
+	c.Assert(err, ErrorMatches, "verify checkpoint failed, saved 2222 but read 1111")
+
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("select checkPoint from `db`.`tbl`.*").WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}))
+	err = cp.Save(3333, 0)
+	c.Assert(err, ErrorMatches, ".*the saved checkpoint 3333 is not found.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *saveSuite) TestSaveWithMarker(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl", markerTable: "marker", clusterID: 42, TsMap: make(map[string]int64)}
+
+	// the marker row is updated to the commit ts of every saved checkpoint in the same transaction
+	for _, ts := range []int64{1111, 2222, 3333} {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("replace into `db`.`tbl` values(42, '{\"commitTS\":%d", ts))).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("replace into `db`.`marker` values(42, %d)", ts))).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		c.Assert(cp.Save(ts, 0), IsNil)
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+		c.Assert(cp.TS(), Equals, ts)
+	}
+
+	// neither is saved if the marker row fails to be updated
+	mock.ExpectBegin()
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("replace into `db`.`marker`.*").WillReturnError(errors.New("marker table dropped"))
+	mock.ExpectRollback()
+	c.Assert(cp.Save(4444, 0), ErrorMatches, ".*replace into `db`.`marker` values\\(42, 4444\\).*marker table dropped")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	c.Assert(genCreateMarkerTable(&cp), Equals,
+		"create table if not exists `db`.`marker`(clusterID bigint unsigned primary key, commitTS bigint not null)")
+}
+
+func (s *saveSuite) TestMissingTable(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl", markerTable: "marker", clusterID: 42, TsMap: make(map[string]int64)}
+	dropped := &mysql.MySQLError{Number: 1146, Message: "Table 'db.tbl' doesn't exist"}
+
+	// fail with the way to recover by default
+	mock.ExpectBegin()
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnError(dropped)
+	mock.ExpectRollback()
+	c.Assert(cp.Save(1111, 0), ErrorMatches, "the checkpoint table `db`.`tbl` is dropped while drainer is running, "+
+		"enable recreate-missing-table to recreate it, or restart drainer with initial-commit-ts 1111 .*doesn't exist")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the other errors are returned as they're
+	mock.ExpectBegin()
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnError(errors.New("connection refused"))
+	mock.ExpectRollback()
+	c.Assert(cp.Save(1111, 0), ErrorMatches, "query sql failed.*connection refused")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the schema and tables are recreated, and the checkpoint is saved again
+	cp.recreateTable = true
+	mock.ExpectBegin()
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("replace into `db`.`marker`.*").WillReturnError(&mysql.MySQLError{Number: 1049, Message: "Unknown database 'db'"})
+	mock.ExpectRollback()
+	mock.ExpectExec(regexp.QuoteMeta("create schema if not exists `db`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("create table if not exists `db`.`tbl`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("create table if not exists `db`.`marker`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("replace into `db`.`marker` values(42, 2222)")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(cp.Save(2222, 0), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// fail if it can't be recreated, e.g. without the privileges
+	cp.markerTable = ""
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnError(dropped)
+	mock.ExpectExec("create schema if not exists `db`").
+		WillReturnError(&mysql.MySQLError{Number: 1044, Message: "Access denied for user 'drainer'@'%' to database 'db'"})
+	c.Assert(cp.Save(3333, 0), ErrorMatches, "recreate the checkpoint table `db`.`tbl` failed.*Access denied.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *saveSuite) TestWaitReplicas(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	replicaDB, replicaMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	cp := MysqlCheckPoint{
+		db:             db,
+		schema:         "db",
+		table:          "tbl",
+		replicas:       []*replica{{addr: "replica:3306", db: replicaDB}},
+		replicaTimeout: 5 * time.Second,
+		TsMap:          make(map[string]int64),
+	}
+
+	// the checkpoint is saved after the replica executes the gtid set
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT @@GLOBAL.gtid_executed")).
+		WillReturnRows(sqlmock.NewRows([]string{"gtid"}).AddRow("uuid:1-10"))
+	replicaMock.ExpectQuery(regexp.QuoteMeta("SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?)")).WithArgs("uuid:1-10", 5.0).
+		WillReturnRows(sqlmock.NewRows([]string{"timeout"}).AddRow(0))
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(cp.Save(1111, 0), IsNil)
+	c.Assert(cp.TS(), Equals, int64(1111))
+
+	// the checkpoint doesn't advance if the replica doesn't catch up in time
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT @@GLOBAL.gtid_executed")).
+		WillReturnRows(sqlmock.NewRows([]string{"gtid"}).AddRow("uuid:1-20"))
+	replicaMock.ExpectQuery(regexp.QuoteMeta("SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?)")).WithArgs("uuid:1-20", 5.0).
+		WillReturnRows(sqlmock.NewRows([]string{"timeout"}).AddRow(1))
+	err = cp.Save(2222, 0)
+	c.Assert(err, ErrorMatches, "wait for replica replica:3306 to execute gtid set uuid:1-20 timeout after 5s")
+	c.Assert(cp.TS(), Equals, int64(1111))
+
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(replicaMock.ExpectationsWereMet(), IsNil)
+
+	// the replicas are closed with the checkpoint
+	mock.ExpectClose()
+	replicaMock.ExpectClose()
+	c.Assert(cp.Close(), IsNil)
+	c.Assert(replicaMock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *saveSuite) TestDoubleQuote(c *C) {
+	cp := &MysqlCheckPoint{schema: "tidb_binlog", table: "check\"point", clusterID: 42, quote: pkgsql.DoubleQuote}
+	c.Assert(genCreateSchema(cp), Equals, `create schema if not exists "tidb_binlog"`)
+	c.Assert(genCreateTable(cp), Equals,
+		`create table if not exists "tidb_binlog"."check""point"(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT)`)
+	c.Assert(genReplaceSQL(cp, "{}"), Equals, `replace into "tidb_binlog"."check""point" values(42, '{}')`)
+	c.Assert(genSelectSQL(cp), Equals, `select checkPoint from "tidb_binlog"."check""point" where clusterID = 42`)
+
+	cp.quote = pkgsql.BacktickQuote
+	c.Assert(genSelectSQL(cp), Equals, "select checkPoint from `tidb_binlog`.`check\"point` where clusterID = 42")
+}
+
+func (s *saveSuite) TestTableOptions(c *C) {
+	cp := &MysqlCheckPoint{schema: "tidb_binlog", table: "checkpoint", tableOptions: pkgsql.TableOptions{Charset: "utf8mb4", Collation: "utf8mb4_bin"}}
+	c.Assert(genCreateTable(cp), Equals,
+		"create table if not exists `tidb_binlog`.`checkpoint`(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin")
 }
 
 type loadSuite struct{}
@@ -84,13 +262,57 @@ func (s *loadSuite) TestShouldLoadFromDB(c *C) {
 	}
 	rows := sqlmock.NewRows([]string{"checkPoint"}).
 		AddRow(`{"commitTS": 1024, "ts-map": {"master-ts": 2000, "slave-ts": 1999}}`)
-	mock.ExpectQuery("select checkPoint from db.tbl.*").WillReturnRows(rows)
+	mock.ExpectQuery("select checkPoint from `db`.`tbl`.*").WillReturnRows(rows)
 
 	err = cp.Load()
 	c.Assert(err, IsNil)
 	c.Assert(cp.CommitTS, Equals, int64(1024))
 	c.Assert(cp.TsMap["master-ts"], Equals, int64(2000))
 	c.Assert(cp.TsMap["slave-ts"], Equals, int64(1999))
+	// the checkpoint saved by old versions has only the slave ts
+	c.Assert(cp.SecondaryTS(), Equals, int64(1999))
+}
+
+func (s *loadSuite) TestReadPrimary(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	cp := MysqlCheckPoint{
+		db:          db,
+		schema:      "db",
+		table:       "tbl",
+		clusterID:   1,
+		readHint:    "/* maxscale route to master */",
+		readPrimary: true,
+		verifySave:  true,
+		TsMap:       make(map[string]int64),
+	}
+	selectSQL := "/* maxscale route to master */ select checkPoint from `db`.`tbl` where clusterID = 1 for update"
+	c.Assert(genSelectSQL(&cp), Equals, selectSQL)
+
+	// it's read by a locking read in a transaction
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectSQL)).WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}).AddRow(`{"commitTS": 1024}`))
+	mock.ExpectCommit()
+	c.Assert(cp.Load(), IsNil)
+	c.Assert(cp.CommitTS, Equals, int64(1024))
+
+	// so is the checkpoint read back after saved
+	mock.ExpectExec("replace into `db`.`tbl`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectSQL)).WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}).AddRow(`{"commitTS": 2048}`))
+	mock.ExpectCommit()
+	c.Assert(cp.Save(2048, 0), IsNil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectSQL)).WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}))
+	mock.ExpectRollback()
+	cp.initialCommitTS = 42
+	c.Assert(cp.Load(), IsNil)
+	c.Assert(cp.CommitTS, Equals, int64(42))
+
+	mock.ExpectBegin().WillReturnError(errors.New("begin"))
+	c.Assert(cp.Load(), ErrorMatches, ".*begin the transaction reading checkpoint failed.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
 
 func (s *loadSuite) TestShouldUseInitialCommitTs(c *C) {
@@ -114,10 +336,29 @@ type newMysqlSuite struct{}
 
 var _ = Suite(&newMysqlSuite{})
 
+func (s *newMysqlSuite) TestOpenDBWithPasswordFromEnv(c *C) {
+	c.Assert(os.Setenv("TEST_CHECKPOINT_PASSWORD", "from-env"), IsNil)
+	defer os.Unsetenv("TEST_CHECKPOINT_PASSWORD")
+
+	origOpen := sqlOpenDB
+	defer func() { sqlOpenDB = origOpen }()
+	var passwords []string
+	sqlOpenDB = func(proto, host string, port int, username, password, tlsName string, initSQL []string) (*sql.DB, error) {
+		passwords = append(passwords, password)
+		return nil, errors.New("no db")
+	}
+
+	_, err := newMysql(&Config{Db: &DBConfig{Password: "inline", PasswordEnv: "TEST_CHECKPOINT_PASSWORD"}})
+	c.Assert(err, ErrorMatches, ".*no db.*")
+	_, err = NewMultiMysql(&Config{Db: &DBConfig{Password: "inline", PasswordEnv: "TEST_CHECKPOINT_PASSWORD_NOT_SET"}})
+	c.Assert(err, ErrorMatches, ".*no db.*")
+	c.Assert(passwords, DeepEquals, []string{"from-env", "inline"})
+}
+
 func (s *newMysqlSuite) TestCannotOpenDB(c *C) {
 	origOpen := sqlOpenDB
 	defer func() { sqlOpenDB = origOpen }()
-	sqlOpenDB = func(proto, host string, port int, username, password string) (*sql.DB, error) {
+	sqlOpenDB = func(proto, host string, port int, username, password, tlsName string, initSQL []string) (*sql.DB, error) {
 		return nil, errors.New("no db")
 	}
 
@@ -132,7 +373,7 @@ func (s *newMysqlSuite) TestCreationErrors(c *C) {
 
 	origOpen := sqlOpenDB
 	defer func() { sqlOpenDB = origOpen }()
-	sqlOpenDB = func(proto, host string, port int, username, password string) (*sql.DB, error) {
+	sqlOpenDB = func(proto, host string, port int, username, password, tlsName string, initSQL []string) (*sql.DB, error) {
 		return db, nil
 	}
 
@@ -147,4 +388,67 @@ func (s *newMysqlSuite) TestCreationErrors(c *C) {
 	_, err = newMysql(&Config{})
 	c.Assert(err, NotNil)
 	c.Assert(err, ErrorMatches, ".*fail table.*")
+
+	mock.ExpectExec("create schema.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists `tidb_binlog`.`checkpoint`.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists `tidb_binlog`.`marker`.*").WillReturnError(errors.New("fail marker table"))
+	_, err = newMysql(&Config{MarkerTable: "marker"})
+	c.Assert(err, ErrorMatches, ".*fail marker table.*")
+}
+
+func (s *newMysqlSuite) TestReopenIdleDB(c *C) {
+	db1, mock1, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	db2, mock2, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	origOpen := sqlOpenDB
+	defer func() { sqlOpenDB = origOpen }()
+	dbs := []*sql.DB{db1, db2}
+	var opened int
+	sqlOpenDB = func(proto, host string, port int, username, password, tlsName string, initSQL []string) (*sql.DB, error) {
+		if opened >= len(dbs) {
+			return nil, errors.New("no more db")
+		}
+		opened++
+		return dbs[opened-1], nil
+	}
+
+	now := time.Unix(1000, 0)
+	origNow := nowFunc
+	defer func() { nowFunc = origNow }()
+	nowFunc = func() time.Time { return now }
+
+	mock1.ExpectExec("create schema.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock1.ExpectExec("create table.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock1.ExpectQuery("select checkPoint.*").WillReturnRows(sqlmock.NewRows([]string{"checkPoint"}))
+	cp, err := newMysql(&Config{IdleTimeout: time.Minute})
+	c.Assert(err, IsNil)
+
+	// not idle for long enough
+	now = now.Add(59 * time.Second)
+	mock1.ExpectExec("replace into.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(cp.Save(100, 0), IsNil)
+	c.Assert(opened, Equals, 1)
+
+	// the idle db is closed and the checkpoint is saved by the reopened one
+	now = now.Add(time.Minute)
+	mock1.ExpectClose()
+	mock2.ExpectExec("replace into.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(cp.Save(200, 0), IsNil)
+	c.Assert(opened, Equals, 2)
+	c.Assert(mock1.ExpectationsWereMet(), IsNil)
+
+	// it fails if the db can't be reopened, and tries again next time
+	now = now.Add(time.Hour)
+	err = cp.Save(300, 0)
+	c.Assert(err, ErrorMatches, "reopen idle checkpoint db failed.*no more db")
+	db3, mock3, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	dbs = append(dbs, db3)
+	mock2.ExpectClose()
+	mock3.ExpectExec("replace into.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(cp.Save(300, 0), IsNil)
+	c.Assert(mock2.ExpectationsWereMet(), IsNil)
+	c.Assert(mock3.ExpectationsWereMet(), IsNil)
 }
@@ -0,0 +1,167 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package checkpoint
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+
+	// sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pingcap/errors"
+)
+
+// SQLiteSupported is true if sqlite checkpoint is supported, the SQLite driver requires cgo
+const SQLiteSupported = true
+
+const (
+	createSQLiteTableSQL = "CREATE TABLE IF NOT EXISTS checkpoint(clusterID INTEGER PRIMARY KEY, checkPoint TEXT NOT NULL)"
+	selectSQLiteSQL      = "SELECT checkPoint FROM checkpoint WHERE clusterID = ?"
+	replaceSQLiteSQL     = "REPLACE INTO checkpoint(clusterID, checkPoint) VALUES(?, ?)"
+)
+
+// SQLiteCheckPoint is a CheckPoint saved in a local SQLite file, for the deployments without a MySQL server.
+// The checkpoint of every cluster is saved in its own row in the same JSON as MysqlCheckPoint.
+type SQLiteCheckPoint struct {
+	sync.RWMutex
+	closed          bool
+	clusterID       uint64
+	initialCommitTS int64
+
+	db *sql.DB
+
+	CommitTS int64            `toml:"commitTS" json:"commitTS"`
+	TsMap    map[string]int64 `toml:"ts-map" json:"ts-map"`
+}
+
+// NewSQLite creates the checkpoint table in the SQLite file cfg.SQLiteFile if it doesn't exist and loads the checkpoint
+func NewSQLite(cfg *Config) (CheckPoint, error) {
+	if len(cfg.SQLiteFile) == 0 {
+		return nil, errors.New("the file of sqlite checkpoint is empty")
+	}
+
+	db, err := sql.Open("sqlite3", cfg.SQLiteFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "open sqlite file %s failed", cfg.SQLiteFile)
+	}
+	// writing to SQLite is serialized anyway, one connection avoids the "database is locked" errors
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec(createSQLiteTableSQL); err != nil {
+		db.Close()
+		return nil, errors.Annotatef(err, "exec failed, sql: %s", createSQLiteTableSQL)
+	}
+
+	sp := &SQLiteCheckPoint{
+		db:              db,
+		clusterID:       cfg.ClusterID,
+		initialCommitTS: cfg.InitialCommitTS,
+		TsMap:           make(map[string]int64),
+	}
+	if err = sp.Load(); err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	return sp, nil
+}
+
+// Load implements CheckPoint.Load interface
+func (sp *SQLiteCheckPoint) Load() error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	defer func() {
+		if sp.CommitTS == 0 {
+			sp.CommitTS = sp.initialCommitTS
+		}
+	}()
+
+	var str string
+	err := sp.db.QueryRow(selectSQLiteSQL, sp.clusterID).Scan(&str)
+	switch {
+	case err == sql.ErrNoRows:
+		sp.CommitTS = sp.initialCommitTS
+		return nil
+	case err != nil:
+		return errors.Annotatef(err, "QueryRow failed, sql: %s", selectSQLiteSQL)
+	}
+
+	return errors.Trace(json.Unmarshal([]byte(str), sp))
+}
+
+// Save implements CheckPoint.Save interface
+func (sp *SQLiteCheckPoint) Save(ts, slaveTS int64) error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	sp.CommitTS = ts
+
+	if slaveTS > 0 {
+		updateTsMap(sp.TsMap, ts, slaveTS)
+	}
+
+	b, err := json.Marshal(sp)
+	if err != nil {
+		return errors.Annotate(err, "json marshal failed")
+	}
+
+	if _, err = sp.db.Exec(replaceSQLiteSQL, sp.clusterID, string(b)); err != nil {
+		return errors.Annotatef(err, "query sql failed: %s", replaceSQLiteSQL)
+	}
+	return nil
+}
+
+// TS implements CheckPoint.TS interface
+func (sp *SQLiteCheckPoint) TS() int64 {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return sp.CommitTS
+}
+
+// SecondaryTS implements CheckPoint.SecondaryTS interface
+func (sp *SQLiteCheckPoint) SecondaryTS() int64 {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return secondaryTS(sp.TsMap)
+}
+
+// Close implements CheckPoint.Close interface
+func (sp *SQLiteCheckPoint) Close() error {
+	sp.Lock()
+	defer sp.Unlock()
+
+	if sp.closed {
+		return errors.Trace(ErrCheckPointClosed)
+	}
+
+	err := sp.db.Close()
+	if err == nil {
+		sp.closed = true
+	}
+	return errors.Trace(err)
+}
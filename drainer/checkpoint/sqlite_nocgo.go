@@ -0,0 +1,29 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cgo
+// +build !cgo
+
+package checkpoint
+
+import (
+	"github.com/pingcap/errors"
+)
+
+// SQLiteSupported is true if sqlite checkpoint is supported, the SQLite driver requires cgo
+const SQLiteSupported = false
+
+// NewSQLite returns an error because the drainer is built without cgo
+func NewSQLite(cfg *Config) (CheckPoint, error) {
+	return nil, errors.New("sqlite checkpoint is not supported, drainer is built without cgo")
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package checkpoint
+
+import (
+	"path"
+	"sync"
+
+	. "github.com/pingcap/check"
+)
+
+type sqliteSuite struct{}
+
+var _ = Suite(&sqliteSuite{})
+
+func (s *sqliteSuite) TestCheckPoint(c *C) {
+	cfg := &Config{CheckpointType: "sqlite", SQLiteFile: path.Join(c.MkDir(), "checkpoint.db"), ClusterID: 1, InitialCommitTS: 123}
+	cp, err := NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	// the initial commit ts is used if the checkpoint isn't saved yet
+	c.Assert(cp.TS(), Equals, int64(123))
+	c.Assert(cp.SecondaryTS(), Equals, int64(0))
+
+	c.Assert(cp.Save(1000, 0), IsNil)
+	c.Assert(cp.TS(), Equals, int64(1000))
+	c.Assert(cp.Save(2000, 10), IsNil)
+	c.Assert(cp.Load(), IsNil)
+	c.Assert(cp.TS(), Equals, int64(2000))
+	c.Assert(cp.(*SQLiteCheckPoint).TsMap, DeepEquals, map[string]int64{
+		"master-ts": 2000, "slave-ts": 10, PrimaryTSKey: 2000, SecondaryTSKey: 10})
+
+	c.Assert(cp.Close(), IsNil)
+	c.Assert(cp.Save(3000, 0), ErrorMatches, ".*CheckPoint already closed.*")
+	c.Assert(cp.Load(), ErrorMatches, ".*CheckPoint already closed.*")
+	c.Assert(cp.Close(), ErrorMatches, ".*CheckPoint already closed.*")
+
+	// the checkpoint is loaded from the file again
+	cp, err = NewSQLite(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(2000))
+	c.Assert(cp.SecondaryTS(), Equals, int64(10))
+	c.Assert(cp.(*SQLiteCheckPoint).TsMap, DeepEquals, map[string]int64{
+		"master-ts": 2000, "slave-ts": 10, PrimaryTSKey: 2000, SecondaryTSKey: 10})
+
+	// the checkpoints of other clusters are independent
+	other, err := NewSQLite(&Config{SQLiteFile: cfg.SQLiteFile, ClusterID: 2})
+	c.Assert(err, IsNil)
+	c.Assert(other.TS(), Equals, int64(0))
+	c.Assert(other.Save(500, 0), IsNil)
+	c.Assert(cp.Load(), IsNil)
+	c.Assert(cp.TS(), Equals, int64(2000))
+
+	c.Assert(other.Close(), IsNil)
+	c.Assert(cp.Close(), IsNil)
+}
+
+func (s *sqliteSuite) TestConcurrentSave(c *C) {
+	cfg := &Config{SQLiteFile: path.Join(c.MkDir(), "checkpoint.db"), ClusterID: 1}
+	cp, err := NewSQLite(cfg)
+	c.Assert(err, IsNil)
+	defer cp.Close()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(ts int64) {
+			defer wg.Done()
+			for j := int64(0); j < 10; j++ {
+				c.Check(cp.Save(ts*100+j, 0), IsNil)
+				_ = cp.TS()
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	// the saved one is the last one saved
+	ts := cp.TS()
+	c.Assert(cp.Load(), IsNil)
+	c.Assert(cp.TS(), Equals, ts)
+}
+
+func (s *sqliteSuite) TestEmptyFile(c *C) {
+	_, err := NewSQLite(&Config{})
+	c.Assert(err, ErrorMatches, "the file of sqlite checkpoint is empty")
+
+	// the directory of the file doesn't exist
+	_, err = NewSQLite(&Config{SQLiteFile: path.Join(c.MkDir(), "not_exist", "checkpoint.db")})
+	c.Assert(err, ErrorMatches, ".*exec failed.*")
+}
@@ -14,10 +14,29 @@
 package checkpoint
 
 import (
+	"crypto/tls"
+	"database/sql"
 	"fmt"
+	"time"
 
-	// mysql driver
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/security"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+)
+
+const (
+	// DefaultSchema is the schema of the mysql checkpoint if Config.Schema is empty
+	DefaultSchema = "tidb_binlog"
+	// DefaultTable is the table of the mysql checkpoint if Config.Table is empty
+	DefaultTable = "checkpoint"
+
+	defaultWaitReplicaTimeout = 10 * time.Second
+
+	// the name of the TLS config registered to the mysql driver for the checkpoint database
+	tlsConfigName = "tidb-binlog-checkpoint"
 )
 
 // DBConfig is the DB configuration.
@@ -26,6 +45,11 @@ type DBConfig struct {
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
 	Port     int    `toml:"port" json:"port"`
+	// read the password from the file or the environment variable instead, the file takes precedence
+	PasswordFile string `toml:"password-file" json:"password-file"`
+	PasswordEnv  string `toml:"password-env" json:"password-env"`
+	// the statements executed in order on every new connection
+	InitSQL []string `toml:"init-sql" json:"init-sql"`
 }
 
 // Config is the savepoint configuration
@@ -35,10 +59,45 @@ type Config struct {
 	Db     *DBConfig
 	Schema string
 	Table  string
+	// the quote of schema and table name in the SQLs of mysql checkpoint
+	IdentifierQuote pkgsql.IdentifierQuote
+	// the default charset and collation of the checkpoint table created by mysql checkpoint
+	TableOptions pkgsql.TableOptions
+	// read the checkpoint back after it's saved to mysql, and fail if it's not the saved one
+	VerifySave bool
+	// the table in Schema whose row of the cluster is updated to the commit ts of the checkpoint
+	// in the same transaction saving the mysql checkpoint, it's not maintained if it's empty
+	MarkerTable string
+	// the mysql checkpoint recreates Schema and the tables dropped while drainer is running on saving,
+	// instead of failing
+	RecreateMissingTable bool
+	// the comment put before the query reading the mysql checkpoint, e.g. `/* maxscale route to master */`
+	// to route it to the primary by the proxy in front of Db with read replicas, nothing is put if it's empty
+	ReadHint string
+	// read the mysql checkpoint by `SELECT ... FOR UPDATE` in a transaction, which is executed by the primary
+	// behind the read/write splitting proxies and always reads the latest checkpoint saved
+	ReadPrimary bool
+	// the mysql checkpoint is saved after the replicas of Db execute the GTIDs executed by Db,
+	// it waits for at most WaitReplicaTimeout for every replica
+	WaitReplicas       []*DBConfig
+	WaitReplicaTimeout time.Duration
+	// the mysql checkpoint reopens Db before using it if it's idle for IdleTimeout, 0 means never
+	IdleTimeout time.Duration
+	// the paths of the CA, client certificate and key to connect to Db with TLS,
+	// they're independent of the TLS config of upstream, the connections aren't encrypted if SSLCA is empty
+	SSLCA   string
+	SSLCert string
+	SSLKey  string
 
 	ClusterID       uint64
 	InitialCommitTS int64
 	CheckPointFile  string `toml:"dir" json:"dir"`
+	// the path of the SQLite file of sqlite checkpoint
+	SQLiteFile string
+	// the checkpoint loaded on startup is checked against the highest commit ts saved before, which is recorded
+	// in HighWaterMarkFile, by RewindActionWarn or RewindActionRefuse, it's not checked if RewindAction is empty
+	RewindAction      string
+	HighWaterMarkFile string
 }
 
 func setDefaultConfig(cfg *Config) {
@@ -55,25 +114,82 @@ func setDefaultConfig(cfg *Config) {
 		cfg.Db.User = "root"
 	}
 	if cfg.Schema == "" {
-		cfg.Schema = "tidb_binlog"
+		cfg.Schema = DefaultSchema
 	}
 	if cfg.Table == "" {
-		cfg.Table = "checkpoint"
+		cfg.Table = DefaultTable
+	}
+	if cfg.WaitReplicaTimeout == 0 {
+		cfg.WaitReplicaTimeout = defaultWaitReplicaTimeout
+	}
+}
+
+// tlsConfig builds the TLS config of the connections to Db, it returns nil if TLS isn't configured
+func (cfg *Config) tlsConfig() (*tls.Config, error) {
+	securityCfg := security.Config{SSLCA: cfg.SSLCA, SSLCert: cfg.SSLCert, SSLKey: cfg.SSLKey}
+	tlsCfg, err := securityCfg.ToTLSConfig()
+	if err != nil {
+		return nil, errors.Annotate(err, "build TLS config of checkpoint failed")
+	}
+	return tlsCfg, nil
+}
+
+// registerTLSConfig registers the TLS config of cfg to the mysql driver and returns the name of it,
+// it returns an empty name if TLS isn't configured.
+func registerTLSConfig(cfg *Config) (string, error) {
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil || tlsCfg == nil {
+		return "", errors.Trace(err)
+	}
+	if err = mysql.RegisterTLSConfig(tlsConfigName, tlsCfg); err != nil {
+		return "", errors.Trace(err)
 	}
+	return tlsConfigName, nil
+}
+
+func openDB(cfg *DBConfig, tlsName string) (*sql.DB, error) {
+	password, err := util.ResolvePassword(cfg.Password, cfg.PasswordFile, cfg.PasswordEnv)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return sqlOpenDB("mysql", cfg.Host, cfg.Port, cfg.User, password, tlsName, cfg.InitSQL)
+}
+
+// isTableMissing returns whether err is caused by the table or the database not existing
+func isTableMissing(err error) bool {
+	code, ok := pkgsql.GetSQLErrCode(err)
+	return ok && (code == tmysql.ErrNoSuchTable || code == tmysql.ErrBadDB)
 }
 
 func genCreateSchema(sp *MysqlCheckPoint) string {
-	return fmt.Sprintf("create schema if not exists %s", sp.schema)
+	return fmt.Sprintf("create schema if not exists %s", sp.quote.Name(sp.schema))
 }
 
 func genCreateTable(sp *MysqlCheckPoint) string {
-	return fmt.Sprintf("create table if not exists %s.%s(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT)", sp.schema, sp.table)
+	return fmt.Sprintf("create table if not exists %s(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT)%s",
+		sp.quote.Schema(sp.schema, sp.table), sp.tableOptions.SQL())
 }
 
 func genReplaceSQL(sp *MysqlCheckPoint, str string) string {
-	return fmt.Sprintf("replace into %s.%s values(%d, '%s')", sp.schema, sp.table, sp.clusterID, str)
+	return fmt.Sprintf("replace into %s values(%d, '%s')", sp.quote.Schema(sp.schema, sp.table), sp.clusterID, str)
+}
+
+func genCreateMarkerTable(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("create table if not exists %s(clusterID bigint unsigned primary key, commitTS bigint not null)%s",
+		sp.quote.Schema(sp.schema, sp.markerTable), sp.tableOptions.SQL())
+}
+
+func genReplaceMarkerSQL(sp *MysqlCheckPoint, ts int64) string {
+	return fmt.Sprintf("replace into %s values(%d, %d)", sp.quote.Schema(sp.schema, sp.markerTable), sp.clusterID, ts)
 }
 
 func genSelectSQL(sp *MysqlCheckPoint) string {
-	return fmt.Sprintf("select checkPoint from %s.%s where clusterID = %d", sp.schema, sp.table, sp.clusterID)
+	sql := fmt.Sprintf("select checkPoint from %s where clusterID = %d", sp.quote.Schema(sp.schema, sp.table), sp.clusterID)
+	if len(sp.readHint) > 0 {
+		sql = sp.readHint + " " + sql
+	}
+	if sp.readPrimary {
+		sql += " for update"
+	}
+	return sql
 }
@@ -39,6 +39,18 @@ import (
 
 const (
 	getDDLJobRetryTime = 10
+
+	// the pump is considered unreachable if it hasn't updated its status for so long
+	pumpStatusStaleDuration = time.Minute
+)
+
+const (
+	// BinlogGapWait keeps pulling binlogs from the offline pump with a gap until it's back
+	BinlogGapWait = "wait"
+	// BinlogGapError quits drainer when a gap is detected
+	BinlogGapError = "error"
+	// BinlogGapSkip removes the offline pump with a gap and alerts
+	BinlogGapSkip = "skip"
 )
 
 type notifyResult struct {
@@ -56,6 +68,7 @@ type Collector struct {
 	syncer    *Syncer
 	latestTS  int64
 	cp        checkpoint.CheckPoint
+	gapPolicy string
 
 	syncedCheckTime int
 
@@ -114,6 +127,7 @@ func NewCollector(cfg *Config, clusterID uint64, s *Syncer, cpt checkpoint.Check
 		tiStore:         tiStore,
 		notifyChan:      make(chan *notifyResult),
 		syncedCheckTime: cfg.SyncedCheckTime,
+		gapPolicy:       cfg.BinlogGapPolicy,
 		merger:          NewMerger(cpt.TS(), heapStrategy),
 		errCh:           make(chan error, 10),
 	}
@@ -173,7 +187,8 @@ func (c *Collector) updateCollectStatus(synced bool) {
 
 	for nodeID, pump := range c.pumps {
 		status.PumpPos[nodeID] = pump.latestTS
-		pumpPositionGauge.WithLabelValues(nodeID).Set(float64(oracle.ExtractPhysical(uint64(pump.latestTS))))
+		physical, _ := util.ExtractPhysicalLogical(pump.latestTS)
+		pumpPositionGauge.WithLabelValues(nodeID).Set(float64(physical))
 	}
 
 	c.mu.Lock()
@@ -197,21 +212,105 @@ func (c *Collector) updateStatus(ctx context.Context) error {
 func (c *Collector) updatePumpStatus(ctx context.Context) error {
 	nodes, err := c.reg.Nodes(ctx, "pumps")
 	if err != nil {
+		pumpCheckpointGapStaleGauge.Set(1)
 		return errors.Trace(err)
 	}
 
 	// query lastest ts from pd
 	c.latestTS, err = util.QueryLatestTsFromPD(c.tiStore)
 	if err != nil {
+		pumpCheckpointGapStaleGauge.Set(1)
 		return errors.Trace(err)
 	}
 
+	gap, stale := pumpCheckpointGap(nodes, c.cp.TS(), c.latestTS)
+	pumpCheckpointGapGauge.Set(float64(gap))
+	if stale {
+		pumpCheckpointGapStaleGauge.Set(1)
+	} else {
+		pumpCheckpointGapStaleGauge.Set(0)
+	}
+
 	for _, n := range nodes {
 		c.handlePumpStatusUpdate(ctx, n)
 	}
 	return nil
 }
 
+// pumpCheckpointGap returns the gap between the max commit ts of pumps and the checkpoint ts,
+// stale is true if some pump haven't updated its status since a while before currentTS,
+// the gap is computed by the last known max commit ts of such pumps.
+func pumpCheckpointGap(nodes []*node.Status, checkpointTS int64, currentTS int64) (gap int64, stale bool) {
+	var latestPumpTS int64
+	for _, n := range nodes {
+		if n.State == node.Offline {
+			continue
+		}
+
+		if pumpStatusStale(n, currentTS) {
+			log.Warn("pump status is stale, it may be unreachable", zap.String("id", n.NodeID), zap.Int64("update ts", n.UpdateTS))
+			stale = true
+		}
+
+		if n.MaxCommitTS > latestPumpTS {
+			latestPumpTS = n.MaxCommitTS
+		}
+	}
+
+	if latestPumpTS > checkpointTS {
+		gap = latestPumpTS - checkpointTS
+	}
+	return
+}
+
+// pumpStatusStale returns true if the pump haven't updated its status since a while before currentTS.
+func pumpStatusStale(n *node.Status, currentTS int64) bool {
+	elapsed := oracle.ExtractPhysical(uint64(currentTS)) - oracle.ExtractPhysical(uint64(n.UpdateTS))
+	return elapsed > pumpStatusStaleDuration.Nanoseconds()/int64(time.Millisecond)
+}
+
+// binlogGap returns the range (from, to] of the binlogs not received from the offline pump.
+// a pump going offline by itself waits for drainer to consume all its binlogs, so there's a gap only if it's
+// set offline while its status is stale, e.g. by binlogctl, and it reported binlogs newer than the received ones.
+func (c *Collector) binlogGap(p *Pump, n *node.Status) (from int64, to int64, ok bool) {
+	if n.MaxCommitTS <= p.latestTS || !pumpStatusStale(n, c.latestTS) {
+		return 0, 0, false
+	}
+	return p.latestTS, n.MaxCommitTS, true
+}
+
+// handleBinlogGap handles the gap of the offline pump by the policy, it returns false if the pump shouldn't be removed.
+func (c *Collector) handleBinlogGap(ctx context.Context, p *Pump, n *node.Status) bool {
+	from, to, ok := c.binlogGap(p, n)
+	if !ok {
+		return true
+	}
+
+	policy := c.gapPolicy
+	if policy == "" {
+		policy = BinlogGapSkip
+	}
+	if p.gapTS != to {
+		p.gapTS = to
+		binlogGapCounter.WithLabelValues(n.NodeID, policy).Add(1)
+	} else if policy == BinlogGapWait {
+		return false
+	}
+
+	fields := []zap.Field{zap.String("nodeID", n.NodeID), zap.Int64("from", from), zap.Int64("to", to)}
+	switch policy {
+	case BinlogGapWait:
+		log.Warn("pump is offline with binlogs not received, wait for it to be back", fields...)
+		return false
+	case BinlogGapError:
+		c.reportErr(ctx, errors.Errorf("binlogs in (%d, %d] of pump %s are not received, it's offline without sending them", from, to, n.NodeID))
+		return false
+	default:
+		log.Warn("pump is offline with binlogs not received, skip them", fields...)
+		return true
+	}
+}
+
 // Notify notifies to detcet pumps
 func (c *Collector) Notify() error {
 	nr := &notifyResult{}
@@ -245,6 +344,7 @@ func (c *Collector) HTTPStatus() *HTTPStatus {
 		status.Synced = true
 	}
 	status.LastTS = c.syncer.GetLatestCommitTS()
+	status.DownstreamBreaker = c.syncer.GetBreakerState()
 
 	return status
 }
@@ -326,7 +426,10 @@ func (c *Collector) handlePumpStatusUpdate(ctx context.Context, n *node.Status)
 			// pump is closing, and need wait all the binlog is send to drainer, so do nothing here.
 		case node.Offline:
 			// before pump change status to offline, it needs to check all the binlog save in this pump had already been consumed in drainer.
-			// so when the pump is offline, we can remove this pump directly.
+			// so when the pump is offline, we can remove this pump directly unless it's set offline with a gap.
+			if !c.handleBinlogGap(ctx, p, n) {
+				return
+			}
 			c.merger.RemoveSource(n.NodeID)
 			c.pumps[n.NodeID].Close()
 			delete(c.pumps, n.NodeID)
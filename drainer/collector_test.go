@@ -26,6 +26,7 @@ import (
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	pb "github.com/pingcap/tipb/go-binlog"
 )
 
@@ -494,6 +495,7 @@ func (s *updateStatusSuite) TestUpdateBothPumpAndCollectorStatus(c *C) {
 		reg:        r,
 		pumps:      map[string]*Pump{},
 		tiStore:    dummyStore{},
+		cp:         dummyCheckpoint{commitTS: 1},
 	}
 	err = col.updateStatus(ctx)
 	c.Assert(err, IsNil)
@@ -502,3 +504,118 @@ func (s *updateStatusSuite) TestUpdateBothPumpAndCollectorStatus(c *C) {
 	c.Assert(col.mu.status.Synced, IsFalse)
 	c.Assert(col.mu.status.PumpPos["test"], Equals, latestTS)
 }
+
+type pumpCheckpointGapSuite struct{}
+
+var _ = Suite(&pumpCheckpointGapSuite{})
+
+func (s *pumpCheckpointGapSuite) TestPumpCheckpointGap(c *C) {
+	now := oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)
+	staleTS := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-2*pumpStatusStaleDuration)), 0)
+	nodes := []*node.Status{
+		{NodeID: "pump1", State: node.Online, MaxCommitTS: 1000, UpdateTS: int64(now)},
+		{NodeID: "pump2", State: node.Online, MaxCommitTS: 1500, UpdateTS: int64(now)},
+		// offline pump is ignored even if it's stale
+		{NodeID: "pump3", State: node.Offline, MaxCommitTS: 3000, UpdateTS: int64(staleTS)},
+	}
+
+	gap, stale := pumpCheckpointGap(nodes, 900, int64(now))
+	c.Assert(gap, Equals, int64(600))
+	c.Assert(stale, IsFalse)
+
+	// checkpoint is ahead of the pumps
+	gap, stale = pumpCheckpointGap(nodes, 2000, int64(now))
+	c.Assert(gap, Equals, int64(0))
+	c.Assert(stale, IsFalse)
+
+	// the unreachable pump keeps the last known ts, but the gap is marked stale
+	nodes = append(nodes, &node.Status{NodeID: "pump4", State: node.Paused, MaxCommitTS: 2500, UpdateTS: int64(staleTS)})
+	gap, stale = pumpCheckpointGap(nodes, 900, int64(now))
+	c.Assert(gap, Equals, int64(1600))
+	c.Assert(stale, IsTrue)
+
+	gap, stale = pumpCheckpointGap(nil, 900, int64(now))
+	c.Assert(gap, Equals, int64(0))
+	c.Assert(stale, IsFalse)
+}
+
+type binlogGapSuite struct{}
+
+var _ = Suite(&binlogGapSuite{})
+
+func (s *binlogGapSuite) newCollector(policy string) *Collector {
+	return &Collector{
+		pumps: map[string]*Pump{
+			"node": {nodeID: "node", latestTS: 1000, logger: log.L()},
+		},
+		merger: &Merger{
+			sources: map[string]MergeSource{
+				"node": {ID: "node"},
+			},
+		},
+		latestTS:  int64(oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)),
+		gapPolicy: policy,
+		errCh:     make(chan error, 10),
+	}
+}
+
+func (s *binlogGapSuite) staleOffline(maxCommitTS int64) *node.Status {
+	staleTS := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-2*pumpStatusStaleDuration)), 0)
+	return &node.Status{NodeID: "node", State: node.Offline, MaxCommitTS: maxCommitTS, UpdateTS: int64(staleTS)}
+}
+
+func (s *binlogGapSuite) TestNoGap(c *C) {
+	col := s.newCollector(BinlogGapError)
+	// the pump goes offline by itself with its status updated
+	n := &node.Status{NodeID: "node", State: node.Offline, MaxCommitTS: 2000, UpdateTS: col.latestTS}
+	_, _, ok := col.binlogGap(col.pumps["node"], n)
+	c.Assert(ok, IsFalse)
+
+	// all the binlogs reported are received
+	n = s.staleOffline(1000)
+	_, _, ok = col.binlogGap(col.pumps["node"], n)
+	c.Assert(ok, IsFalse)
+
+	col.handlePumpStatusUpdate(context.Background(), n)
+	c.Assert(col.pumps, Not(HasKey), "node")
+	c.Assert(col.errCh, HasLen, 0)
+}
+
+func (s *binlogGapSuite) TestWait(c *C) {
+	col := s.newCollector(BinlogGapWait)
+	n := s.staleOffline(2000)
+	from, to, ok := col.binlogGap(col.pumps["node"], n)
+	c.Assert(ok, IsTrue)
+	c.Assert(from, Equals, int64(1000))
+	c.Assert(to, Equals, int64(2000))
+
+	col.handlePumpStatusUpdate(context.Background(), n)
+	col.handlePumpStatusUpdate(context.Background(), n)
+	c.Assert(col.pumps, HasKey, "node")
+	c.Assert(col.merger.sources, HasKey, "node")
+	c.Assert(col.pumps["node"].gapTS, Equals, int64(2000))
+
+	// the pump is removed after the binlogs are received
+	col.pumps["node"].latestTS = 2000
+	col.handlePumpStatusUpdate(context.Background(), n)
+	c.Assert(col.pumps, Not(HasKey), "node")
+	c.Assert(col.merger.sources, Not(HasKey), "node")
+}
+
+func (s *binlogGapSuite) TestError(c *C) {
+	col := s.newCollector(BinlogGapError)
+	col.handlePumpStatusUpdate(context.Background(), s.staleOffline(2000))
+	c.Assert(col.pumps, HasKey, "node")
+	c.Assert(col.errCh, HasLen, 1)
+	c.Assert(<-col.errCh, ErrorMatches, `binlogs in \(1000, 2000\] of pump node are not received.*`)
+}
+
+func (s *binlogGapSuite) TestSkip(c *C) {
+	for _, policy := range []string{BinlogGapSkip, ""} {
+		col := s.newCollector(policy)
+		col.handlePumpStatusUpdate(context.Background(), s.staleOffline(2000))
+		c.Assert(col.pumps, Not(HasKey), "node")
+		c.Assert(col.merger.sources, Not(HasKey), "node")
+		c.Assert(col.errCh, HasLen, 0)
+	}
+}
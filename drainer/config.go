@@ -21,6 +21,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -30,10 +31,13 @@ import (
 	"github.com/pingcap/parser/mysql"
 	"go.uber.org/zap"
 
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/pingcap/tidb-binlog/pkg/security"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pkg/version"
 	"github.com/pingcap/tidb-binlog/pkg/zk"
@@ -48,6 +52,13 @@ const (
 	defaultSyncedCheckTime = 5 // 5 minute
 	defaultKafkaAddrs      = "127.0.0.1:9092"
 	defaultKafkaVersion    = "0.8.2.0"
+	// seconds to pause executing against downstream when the circuit breaker is open
+	defaultCircuitBreakerCoolDown = 10
+	defaultDeadLetterFile         = "dead_letter.log"
+	// the max attempts to load the history DDL jobs to bootstrap the schema
+	defaultSchemaBootstrapMaxAttempts = 5
+	// the history DDL jobs are replayed sequentially by default
+	defaultSchemaReplayWorkers = 1
 )
 
 var (
@@ -73,6 +84,70 @@ type SyncerConfig struct {
 	EnableDispatch    bool               `toml:"enable-dispatch" json:"enable-dispatch"`
 	SafeMode          bool               `toml:"safe-mode" json:"safe-mode"`
 	EnableCausality   bool               `toml:"enable-detect" json:"enable-detect"`
+	LoopbackControl   bool               `toml:"loopback-control" json:"loopback-control"`
+	ChannelID         int64              `toml:"channel-id" json:"channel-id"`
+	ColumnProjections []ColumnProjection `toml:"column-projection" json:"column-projection"`
+	// the max count of transactions sent to downstream but not applied yet, 0 means no limit
+	MaxInflightTxns int `toml:"max-inflight-txns" json:"max-inflight-txns"`
+	// save the checkpoint after every so many txns are applied, or every checkpoint-save-interval seconds,
+	// whichever comes first, the txns count is not used if it's 0, the interval is 3 seconds by default
+	CheckpointSaveTxns     int `toml:"checkpoint-save-txns" json:"checkpoint-save-txns"`
+	CheckpointSaveInterval int `toml:"checkpoint-save-interval" json:"checkpoint-save-interval"`
+	// the binlog with the prewrite value larger than this size in bytes is handled by OversizeBinlogAction, 0 means no limit
+	MaxBinlogSize int64 `toml:"max-binlog-size" json:"max-binlog-size"`
+	// "log" or "skip", the oversize binlog is synced after it's logged by default
+	OversizeBinlogAction string `toml:"oversize-binlog-action" json:"oversize-binlog-action"`
+	// "skip" or "error", renaming a table between the one replicated and the one filtered out is skipped by default
+	RenameAcrossFilter string `toml:"rename-across-filter" json:"rename-across-filter"`
+	// "replicate" or "skip" the DDLs of the global temporary tables, they're skipped for mysql and replicated for the others by default
+	GlobalTemporaryTable string `toml:"global-temporary-table" json:"global-temporary-table"`
+	// only sync the DDLs to downstream to bootstrap the schema, the DMLs are skipped
+	SchemaOnly bool `toml:"schema-only" json:"schema-only"`
+	// start with the DDL hold on, the DDLs and the DMLs depending on them are held until released by the http api
+	HoldDDL bool `toml:"hold-ddl" json:"hold-ddl"`
+	// the max attempts to load the history DDL jobs from TiKV to bootstrap the schema on startup,
+	// the backoff between attempts doubles from 1 second, 5 by default
+	SchemaBootstrapMaxAttempts int `toml:"schema-bootstrap-max-attempts" json:"schema-bootstrap-max-attempts"`
+	// the max goroutines replaying the history DDL jobs to bootstrap the schema on startup, the jobs of the
+	// independent schemas are replayed concurrently, and the ones of a schema keep the order, 1 by default
+	SchemaReplayWorkers int `toml:"schema-replay-workers" json:"schema-replay-workers"`
+	// alert if the lag of the txns applied to downstream exceeds max-lag seconds for max-lag-duration seconds,
+	// it's not checked if max-lag is 0. MaxLagAction is "alert" by default, or "halt" to stop the syncer too
+	MaxLag         int    `toml:"max-lag" json:"max-lag"`
+	MaxLagDuration int    `toml:"max-lag-duration" json:"max-lag-duration"`
+	MaxLagAction   string `toml:"max-lag-action" json:"max-lag-action"`
+	// the variables of which the `SET` statements in the DDL stream are replicated, the others are skipped,
+	// the user-defined variables are prefixed with "@"
+	ReplicateSetVariables []string `toml:"replicate-set-variables" json:"replicate-set-variables"`
+	// match the schema and table names of the filters and the column projections case-sensitively,
+	// they're matched case-insensitively by default
+	CaseSensitive bool `toml:"case-sensitive" json:"case-sensitive"`
+}
+
+// ColumnProjection selects the columns of a table written to downstream.
+type ColumnProjection struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	// Columns are the upstream columns to keep, in downstream order
+	Columns []string `toml:"columns" json:"columns"`
+	// Rename maps an upstream column to a downstream column with different name
+	Rename map[string]string `toml:"rename" json:"rename"`
+}
+
+func (c *SyncerConfig) loaderColumnProjections() []loader.ColumnProjection {
+	projs := make([]loader.ColumnProjection, 0, len(c.ColumnProjections))
+	for _, p := range c.ColumnProjections {
+		proj := loader.ColumnProjection{Database: p.Schema, Table: p.Table}
+		for _, col := range p.Columns {
+			down := col
+			if name, ok := p.Rename[col]; ok {
+				down = name
+			}
+			proj.Columns = append(proj.Columns, loader.ColumnMapping{Upstream: col, Downstream: down})
+		}
+		projs = append(projs, proj)
+	}
+	return projs
 }
 
 // Config holds the configuration of drainer
@@ -87,10 +162,13 @@ type Config struct {
 	EtcdURLs        string          `toml:"pd-urls" json:"pd-urls"`
 	LogFile         string          `toml:"log-file" json:"log-file"`
 	InitialCommitTS int64           `toml:"initial-commit-ts" json:"initial-commit-ts"`
+	StartFromNow    bool            `toml:"-" json:"start-from-now"`
 	SyncerCfg       *SyncerConfig   `toml:"syncer" json:"sycner"`
 	Security        security.Config `toml:"security" json:"security"`
 	SyncedCheckTime int             `toml:"synced-check-time" json:"synced-check-time"`
 	Compressor      string          `toml:"compressor" json:"compressor"`
+	PumpKeepAlive   int             `toml:"pump-tcp-keepalive" json:"pump-tcp-keepalive"`
+	BinlogGapPolicy string          `toml:"binlog-gap-policy" json:"binlog-gap-policy"`
 	EtcdTimeout     time.Duration
 	MetricsAddr     string
 	MetricsInterval int
@@ -124,7 +202,10 @@ func NewConfig() *Config {
 	fs.IntVar(&cfg.MetricsInterval, "metrics-interval", 15, "prometheus client push interval in second, set \"0\" to disable prometheus push")
 	fs.StringVar(&cfg.LogFile, "log-file", "", "log file path")
 	fs.Int64Var(&cfg.InitialCommitTS, "initial-commit-ts", -1, "if drainer donesn't have checkpoint, use initial commitTS to initial checkpoint, will get a latest timestamp from pd if setting to be -1")
+	fs.BoolVar(&cfg.StartFromNow, "start-from-now", false, "start from the current timestamp got from pd and save it to the checkpoint, the binlogs before it are skipped even if there's a checkpoint. it's meant for one start, so it's not read from the config file")
 	fs.StringVar(&cfg.Compressor, "compressor", "", "use the specified compressor to compress payload between pump and drainer, only 'gzip' is supported now (default \"\", ie. compression disabled.)")
+	fs.IntVar(&cfg.PumpKeepAlive, "pump-tcp-keepalive", 0, "seconds between the TCP keepalive probes on the connections pulling binlogs from pumps, the default of Go is used if it's 0")
+	fs.StringVar(&cfg.BinlogGapPolicy, "binlog-gap-policy", BinlogGapSkip, "how to handle the binlogs not received from a pump set offline without sending them, \"wait\" for the pump, \"error\" to quit or \"skip\" them with an alert")
 	fs.IntVar(&cfg.SyncerCfg.TxnBatch, "txn-batch", 20, "number of binlog events in a transaction batch")
 	fs.StringVar(&cfg.SyncerCfg.IgnoreSchemas, "ignore-schemas", "INFORMATION_SCHEMA,PERFORMANCE_SCHEMA,mysql", "disable sync those schemas")
 	fs.IntVar(&cfg.SyncerCfg.WorkerCount, "c", 16, "parallel worker count")
@@ -140,7 +221,7 @@ func NewConfig() *Config {
 }
 
 func (cfg *Config) String() string {
-	data, err := json.MarshalIndent(cfg, "\t", "\t")
+	data, err := json.MarshalIndent(cfg.Redacted(), "\t", "\t")
 	if err != nil {
 		log.Error("marshal json failed", zap.Error(err))
 	}
@@ -148,6 +229,28 @@ func (cfg *Config) String() string {
 	return string(data)
 }
 
+// Redacted returns a copy of cfg with the passwords masked to log it,
+// the ones read from password-file or password-env are resolved into the config
+func (cfg *Config) Redacted() *Config {
+	redacted := *cfg
+	if cfg.SyncerCfg == nil || cfg.SyncerCfg.To == nil {
+		return &redacted
+	}
+
+	syncerCfg := *cfg.SyncerCfg
+	to := *cfg.SyncerCfg.To
+	to.Password = util.RedactPassword(to.Password)
+	to.Checkpoint.Password = util.RedactPassword(to.Checkpoint.Password)
+	to.Checkpoint.WaitReplicas = nil
+	for _, replica := range cfg.SyncerCfg.To.Checkpoint.WaitReplicas {
+		replica.Password = util.RedactPassword(replica.Password)
+		to.Checkpoint.WaitReplicas = append(to.Checkpoint.WaitReplicas, replica)
+	}
+	syncerCfg.To = &to
+	redacted.SyncerCfg = &syncerCfg
+	return &redacted
+}
+
 // Parse parses all config from command-line flags, environment vars or the configuration file
 func (cfg *Config) Parse(args []string) error {
 	// parse first to get config file
@@ -213,6 +316,9 @@ func (c *SyncerConfig) adjustWorkCount() {
 }
 
 func (c *SyncerConfig) adjustDoDBAndTable() {
+	if c.CaseSensitive {
+		return
+	}
 	for i := 0; i < len(c.DoTables); i++ {
 		c.DoTables[i].Table = strings.ToLower(c.DoTables[i].Table)
 		c.DoTables[i].Schema = strings.ToLower(c.DoTables[i].Schema)
@@ -260,6 +366,33 @@ func (cfg *Config) validateFilter() error {
 		}
 	}
 
+	for _, p := range cfg.SyncerCfg.ColumnProjections {
+		if len(p.Schema) == 0 {
+			return errors.New("empty schema name in `column-projection` config")
+		}
+
+		if len(p.Table) == 0 {
+			return errors.New("empty table name in `column-projection` config")
+		}
+
+		if len(p.Columns) == 0 {
+			return errors.Errorf("no columns in `column-projection` config of table `%s`.`%s`", p.Schema, p.Table)
+		}
+
+		for up := range p.Rename {
+			found := false
+			for _, col := range p.Columns {
+				if col == up {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errors.Errorf("renamed column %s is not in `columns` of `column-projection` config of table `%s`.`%s`", up, p.Schema, p.Table)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -291,9 +424,601 @@ func (cfg *Config) validate() error {
 		}
 	}
 
+	if cfg.PumpKeepAlive < 0 {
+		return errors.Errorf("invalid pump-tcp-keepalive %d, must not be negative", cfg.PumpKeepAlive)
+	}
+
+	if cfg.StartFromNow && cfg.InitialCommitTS > 0 {
+		return errors.Errorf("start-from-now can't be used with initial-commit-ts %d", cfg.InitialCommitTS)
+	}
+
+	switch cfg.BinlogGapPolicy {
+	case "", BinlogGapWait, BinlogGapError, BinlogGapSkip:
+	default:
+		return errors.Errorf("unknown binlog-gap-policy %s, it should be %s, %s or %s",
+			cfg.BinlogGapPolicy, BinlogGapWait, BinlogGapError, BinlogGapSkip)
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.DeadLetter.Enable &&
+		cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("dead letter is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.QuarantineUndecodableRows &&
+		cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("quarantine-undecodable-rows is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.TxnMarkers &&
+		cfg.SyncerCfg.DestDBType != "file" && cfg.SyncerCfg.DestDBType != "kafka" {
+		return errors.Errorf("txn-markers is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.RowSequences {
+		if cfg.SyncerCfg.DestDBType != "file" && cfg.SyncerCfg.DestDBType != "kafka" {
+			return errors.Errorf("row-sequences is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+		}
+		if cfg.SyncerCfg.DestDBType == "file" && cfg.SyncerCfg.To.FileFormat != dsync.FileFormatJSONLGzip {
+			return errors.Errorf("row-sequences is only supported by db-type file with file-format %s", dsync.FileFormatJSONLGzip)
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.SnapshotMergeWindow != 0 {
+		if cfg.SyncerCfg.DestDBType != "file" && cfg.SyncerCfg.DestDBType != "kafka" {
+			return errors.Errorf("snapshot-merge-window is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+		}
+		if cfg.SyncerCfg.DestDBType == "file" && cfg.SyncerCfg.To.FileFormat != dsync.FileFormatJSONLGzip {
+			return errors.Errorf("snapshot-merge-window is only supported by db-type file with file-format %s", dsync.FileFormatJSONLGzip)
+		}
+		if cfg.SyncerCfg.To.SnapshotMergeWindow < 0 {
+			return errors.Errorf("invalid snapshot-merge-window %d, must not be negative", cfg.SyncerCfg.To.SnapshotMergeWindow)
+		}
+	}
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.SnapshotMergeMaxTxns < 0 {
+		return errors.Errorf("invalid snapshot-merge-max-txns %d, must not be negative", cfg.SyncerCfg.To.SnapshotMergeMaxTxns)
+	}
+
+	if cfg.SyncerCfg.To != nil && len(cfg.SyncerCfg.To.FileFormat) > 0 {
+		if cfg.SyncerCfg.DestDBType != "file" {
+			return errors.Errorf("file-format is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+		}
+		switch cfg.SyncerCfg.To.FileFormat {
+		case dsync.FileFormatPB, dsync.FileFormatJSONLGzip:
+		default:
+			return errors.Errorf("invalid file-format %s, must be %s or %s", cfg.SyncerCfg.To.FileFormat, dsync.FileFormatPB, dsync.FileFormatJSONLGzip)
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil && len(cfg.SyncerCfg.To.KafkaTimestamp) > 0 {
+		if cfg.SyncerCfg.DestDBType != "kafka" {
+			return errors.Errorf("kafka-timestamp is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+		}
+		switch cfg.SyncerCfg.To.KafkaTimestamp {
+		case dsync.KafkaTimestampCommitTS, dsync.KafkaTimestampProduceTime:
+		default:
+			return errors.Errorf("invalid kafka-timestamp %s, must be %s or %s", cfg.SyncerCfg.To.KafkaTimestamp,
+				dsync.KafkaTimestampCommitTS, dsync.KafkaTimestampProduceTime)
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.KafkaResolvedTSInterval != 0 {
+		if cfg.SyncerCfg.DestDBType != "kafka" {
+			return errors.Errorf("kafka-resolved-ts-interval is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+		}
+		if cfg.SyncerCfg.To.KafkaResolvedTSInterval < 0 {
+			return errors.Errorf("invalid kafka-resolved-ts-interval %d, must not be negative", cfg.SyncerCfg.To.KafkaResolvedTSInterval)
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil && len(cfg.SyncerCfg.To.DDLTopicName) > 0 {
+		if cfg.SyncerCfg.DestDBType != "kafka" {
+			return errors.Errorf("ddl-topic-name is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+		}
+		if cfg.SyncerCfg.To.DDLTopicName == cfg.SyncerCfg.To.TopicName {
+			return errors.Errorf("ddl-topic-name %s is the same as topic-name", cfg.SyncerCfg.To.DDLTopicName)
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.KafkaKeyNamespace {
+		if cfg.SyncerCfg.DestDBType != "kafka" {
+			return errors.Errorf("kafka-key-namespace is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+		}
+		if len(cfg.SyncerCfg.To.DDLTopicName) == 0 {
+			return errors.New("kafka-key-namespace requires ddl-topic-name, only the messages of the DDL topic are keyed")
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil && cfg.SyncerCfg.To.Checkpoint.Type == "sqlite" && !checkpoint.SQLiteSupported {
+		return errors.New("checkpoint type sqlite is not supported, drainer is built without cgo")
+	}
+
+	if cfg.SyncerCfg.To != nil {
+		if err := cfg.validateIdentifierQuote(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateTiDBRowID(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.SyncerCfg.To.TableOptions().Validate(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateTableConcurrencies(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validatePreSplits(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateTableSessions(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateBeforeImages(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateColumnOrders(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateLockedTablePolicy(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateNumericOverflow(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateSecondaryTS(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateThrottle(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateBulkInsert(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateCommitGroup(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateStatsTable(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateInitSQL(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateTTLMode(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateMultiValuedIndex(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateColumnPosition(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateIsolationLevel(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := cfg.validateZeroAutoIncrement(); err != nil {
+			return errors.Trace(err)
+		}
+		if cfg.SyncerCfg.To.LogSampleInterval < 0 {
+			return errors.Errorf("invalid log-sample-interval %d, must not be negative", cfg.SyncerCfg.To.LogSampleInterval)
+		}
+		if cfg.SyncerCfg.To.RetryMaxBackoff < 0 {
+			return errors.Errorf("invalid retry-max-backoff %d, must not be negative", cfg.SyncerCfg.To.RetryMaxBackoff)
+		}
+		if cfg.SyncerCfg.To.RetryTimeBudget < 0 {
+			return errors.Errorf("invalid retry-time-budget %d, must not be negative", cfg.SyncerCfg.To.RetryTimeBudget)
+		}
+		if cfg.SyncerCfg.To.TCPKeepAlive < 0 {
+			return errors.Errorf("invalid tcp-keepalive %d, must not be negative", cfg.SyncerCfg.To.TCPKeepAlive)
+		}
+	}
+
+	if cfg.SyncerCfg.MaxInflightTxns < 0 {
+		return errors.Errorf("invalid max-inflight-txns %d, must not be negative", cfg.SyncerCfg.MaxInflightTxns)
+	}
+
+	if cfg.SyncerCfg.SchemaBootstrapMaxAttempts < 0 {
+		return errors.Errorf("invalid schema-bootstrap-max-attempts %d, must not be negative", cfg.SyncerCfg.SchemaBootstrapMaxAttempts)
+	}
+
+	if cfg.SyncerCfg.SchemaReplayWorkers < 0 {
+		return errors.Errorf("invalid schema-replay-workers %d, must not be negative", cfg.SyncerCfg.SchemaReplayWorkers)
+	}
+
+	if cfg.SyncerCfg.MaxLag < 0 {
+		return errors.Errorf("invalid max-lag %d, must not be negative", cfg.SyncerCfg.MaxLag)
+	}
+	if cfg.SyncerCfg.MaxLagDuration < 0 {
+		return errors.Errorf("invalid max-lag-duration %d, must not be negative", cfg.SyncerCfg.MaxLagDuration)
+	}
+	switch cfg.SyncerCfg.MaxLagAction {
+	case "", MaxLagAlert, MaxLagHalt:
+	default:
+		return errors.Errorf("unknown max-lag-action %s, it should be %s or %s",
+			cfg.SyncerCfg.MaxLagAction, MaxLagAlert, MaxLagHalt)
+	}
+
+	if cfg.SyncerCfg.CheckpointSaveTxns < 0 {
+		return errors.Errorf("invalid checkpoint-save-txns %d, must not be negative", cfg.SyncerCfg.CheckpointSaveTxns)
+	}
+	if cfg.SyncerCfg.CheckpointSaveInterval < 0 {
+		return errors.Errorf("invalid checkpoint-save-interval %d, must not be negative", cfg.SyncerCfg.CheckpointSaveInterval)
+	}
+
+	if cfg.SyncerCfg.MaxBinlogSize < 0 {
+		return errors.Errorf("invalid max-binlog-size %d, must not be negative", cfg.SyncerCfg.MaxBinlogSize)
+	}
+	switch cfg.SyncerCfg.OversizeBinlogAction {
+	case "", OversizeBinlogLog, OversizeBinlogSkip:
+	default:
+		return errors.Errorf("unknown oversize-binlog-action %s, it should be %s or %s",
+			cfg.SyncerCfg.OversizeBinlogAction, OversizeBinlogLog, OversizeBinlogSkip)
+	}
+	switch cfg.SyncerCfg.RenameAcrossFilter {
+	case "", RenameAcrossFilterSkip, RenameAcrossFilterError:
+	default:
+		return errors.Errorf("unknown rename-across-filter %s, it should be %s or %s",
+			cfg.SyncerCfg.RenameAcrossFilter, RenameAcrossFilterSkip, RenameAcrossFilterError)
+	}
+	switch cfg.SyncerCfg.GlobalTemporaryTable {
+	case "", GlobalTemporaryTableReplicate, GlobalTemporaryTableSkip:
+	default:
+		return errors.Errorf("unknown global-temporary-table %s, it should be %s or %s",
+			cfg.SyncerCfg.GlobalTemporaryTable, GlobalTemporaryTableReplicate, GlobalTemporaryTableSkip)
+	}
+
 	return cfg.validateFilter()
 }
 
+// validateIdentifierQuote checks the identifier quote is only set when there are SQLs
+// generated for the downstream or the checkpoint, so that the quote is used consistently.
+func (cfg *Config) validateIdentifierQuote() error {
+	to := cfg.SyncerCfg.To
+	quote, err := pkgsql.ParseIdentifierQuote(to.IdentifierQuote)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if quote == pkgsql.BacktickQuote {
+		return nil
+	}
+
+	isSQLType := func(tp string) bool { return tp == "mysql" || tp == "tidb" }
+	if isSQLType(cfg.SyncerCfg.DestDBType) || isSQLType(to.Checkpoint.Type) {
+		return nil
+	}
+	return errors.Errorf("identifier-quote %s is not supported by db-type %s with checkpoint type %s",
+		to.IdentifierQuote, cfg.SyncerCfg.DestDBType, to.Checkpoint.Type)
+}
+
+// validateTableConcurrencies checks the table patterns and the concurrencies of `table-concurrency`
+func (cfg *Config) validateTableConcurrencies() error {
+	for _, tc := range cfg.SyncerCfg.To.TableConcurrencies {
+		if len(tc.Schema) == 0 {
+			return errors.New("empty schema name in `table-concurrency` config")
+		}
+		if len(tc.Table) == 0 {
+			return errors.New("empty table name in `table-concurrency` config")
+		}
+		if tc.Concurrency <= 0 {
+			return errors.Errorf("invalid concurrency %d in `table-concurrency` config of table %s.%s, must be positive", tc.Concurrency, tc.Schema, tc.Table)
+		}
+		for _, pattern := range []string{tc.Schema, tc.Table} {
+			if _, err := filter.CompilePattern(pattern); err != nil {
+				return errors.Annotatef(err, "invalid pattern %s in `table-concurrency` config", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePreSplits checks `pre-split` is only configured for tidb, and the table patterns of it
+func (cfg *Config) validatePreSplits() error {
+	if len(cfg.SyncerCfg.To.PreSplits) == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("`pre-split` config is only supported by db-type tidb, but got %s", cfg.SyncerCfg.DestDBType)
+	}
+	for _, ps := range cfg.SyncerCfg.To.PreSplits {
+		if len(ps.Schema) == 0 || len(ps.Table) == 0 {
+			return errors.New("empty schema or table name in `pre-split` config")
+		}
+		if len(ps.Points) == 0 && (ps.Regions <= 1 || ps.Lower >= ps.Upper) {
+			return errors.Errorf("invalid `pre-split` config of table %s.%s, either points or lower < upper and regions > 1 are required", ps.Schema, ps.Table)
+		}
+		for _, pattern := range []string{ps.Schema, ps.Table} {
+			if _, err := filter.CompilePattern(pattern); err != nil {
+				return errors.Annotatef(err, "invalid pattern %s in `pre-split` config", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTableSessions checks `table-session` is only configured for mysql and tidb, and the table patterns,
+// time zones and sql modes of it
+func (cfg *Config) validateTableSessions() error {
+	if len(cfg.SyncerCfg.To.TableSessions) == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("`table-session` config is only supported by db-type mysql and tidb, but got %s", cfg.SyncerCfg.DestDBType)
+	}
+	for _, ts := range cfg.SyncerCfg.To.TableSessions {
+		if len(ts.Schema) == 0 || len(ts.Table) == 0 {
+			return errors.New("empty schema or table name in `table-session` config")
+		}
+		if len(ts.TimeZone) == 0 && ts.SQLMode == nil {
+			return errors.Errorf("invalid `table-session` config of table %s.%s, either time-zone or sql-mode is required", ts.Schema, ts.Table)
+		}
+		if len(ts.TimeZone) > 0 {
+			if _, err := time.LoadLocation(ts.TimeZone); err != nil {
+				return errors.Annotatef(err, "invalid time-zone %s in `table-session` config of table %s.%s", ts.TimeZone, ts.Schema, ts.Table)
+			}
+		}
+		if ts.SQLMode != nil {
+			if _, err := mysql.GetSQLMode(*ts.SQLMode); err != nil {
+				return errors.Annotatef(err, "invalid sql-mode %s in `table-session` config of table %s.%s", *ts.SQLMode, ts.Schema, ts.Table)
+			}
+		}
+		for _, pattern := range []string{ts.Schema, ts.Table} {
+			if _, err := filter.CompilePattern(pattern); err != nil {
+				return errors.Annotatef(err, "invalid pattern %s in `table-session` config", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// validateBeforeImages checks `before-image` is only configured for kafka, and the table patterns of it
+func (cfg *Config) validateBeforeImages() error {
+	if len(cfg.SyncerCfg.To.BeforeImages) == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "kafka" {
+		return errors.Errorf("`before-image` config is only supported by db-type kafka, but got %s", cfg.SyncerCfg.DestDBType)
+	}
+	for _, bi := range cfg.SyncerCfg.To.BeforeImages {
+		if len(bi.Schema) == 0 || len(bi.Table) == 0 {
+			return errors.New("empty schema or table name in `before-image` config")
+		}
+		for _, pattern := range []string{bi.Schema, bi.Table} {
+			if _, err := filter.CompilePattern(pattern); err != nil {
+				return errors.Annotatef(err, "invalid pattern %s in `before-image` config", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// validateColumnOrders checks `column-order` is only configured for the JSON-Lines files, and the table patterns of it
+func (cfg *Config) validateColumnOrders() error {
+	if len(cfg.SyncerCfg.To.ColumnOrders) == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "file" || cfg.SyncerCfg.To.FileFormat != dsync.FileFormatJSONLGzip {
+		return errors.Errorf("`column-order` config is only supported by db-type file with file-format %s", dsync.FileFormatJSONLGzip)
+	}
+	for _, co := range cfg.SyncerCfg.To.ColumnOrders {
+		if len(co.Schema) == 0 || len(co.Table) == 0 {
+			return errors.New("empty schema or table name in `column-order` config")
+		}
+		for _, pattern := range []string{co.Schema, co.Table} {
+			if _, err := filter.CompilePattern(pattern); err != nil {
+				return errors.Annotatef(err, "invalid pattern %s in `column-order` config", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) validateLockedTablePolicy() error {
+	switch cfg.SyncerCfg.To.LockedTablePolicy {
+	case "", loader.LockedTableRetry, loader.LockedTableWait, loader.LockedTableFail:
+		return nil
+	default:
+		return errors.Errorf("invalid locked-table-policy %s, must be %s, %s or %s", cfg.SyncerCfg.To.LockedTablePolicy,
+			loader.LockedTableRetry, loader.LockedTableWait, loader.LockedTableFail)
+	}
+}
+
+func (cfg *Config) validateNumericOverflow() error {
+	switch cfg.SyncerCfg.To.NumericOverflow {
+	case "", loader.NumericOverflowError, loader.NumericOverflowClamp, loader.NumericOverflowNull:
+		return nil
+	default:
+		return errors.Errorf("invalid numeric-overflow %s, must be %s, %s or %s", cfg.SyncerCfg.To.NumericOverflow,
+			loader.NumericOverflowError, loader.NumericOverflowClamp, loader.NumericOverflowNull)
+	}
+}
+
+// validateSecondaryTS checks the TSO of downstream is only saved as the secondary ts for tidb
+func (cfg *Config) validateSecondaryTS() error {
+	switch cfg.SyncerCfg.To.SecondaryTS {
+	case "", dsync.SecondaryTSNone:
+		return nil
+	case dsync.SecondaryTSDownstreamTSO:
+		if cfg.SyncerCfg.DestDBType == "tidb" {
+			return nil
+		}
+		return errors.Errorf("secondary-ts %s is not supported by db-type %s", dsync.SecondaryTSDownstreamTSO, cfg.SyncerCfg.DestDBType)
+	default:
+		return errors.Errorf("invalid secondary-ts %s, must be %s or %s", cfg.SyncerCfg.To.SecondaryTS, dsync.SecondaryTSDownstreamTSO, dsync.SecondaryTSNone)
+	}
+}
+
+func (cfg *Config) validateThrottle() error {
+	to := cfg.SyncerCfg.To
+	if to.ThrottleProbeInterval < 0 {
+		return errors.Errorf("invalid throttle-probe-interval %d, must not be negative", to.ThrottleProbeInterval)
+	}
+	if to.ThrottleMaxDelay < 0 {
+		return errors.Errorf("invalid throttle-max-delay %d, must not be negative", to.ThrottleMaxDelay)
+	}
+	if len(to.ThrottleThresholds) == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("throttle-thresholds is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+	for name := range to.ThrottleThresholds {
+		if len(name) == 0 {
+			return errors.New("empty status variable name in throttle-thresholds")
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) validateBulkInsert() error {
+	to := cfg.SyncerCfg.To
+	if to.BulkInsertRows < 0 {
+		return errors.Errorf("invalid bulk-insert-rows %d, must not be negative", to.BulkInsertRows)
+	}
+	if to.BulkInsertRows == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("bulk-insert-rows is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+	if to.BulkInsertBatchSize <= 0 {
+		return errors.Errorf("invalid bulk-insert-batch-size %d, must be positive if bulk-insert-rows is set", to.BulkInsertBatchSize)
+	}
+	if limit := loader.MaxBulkInsertRows(cfg.SyncerCfg.TxnBatch, cfg.SyncerCfg.WorkerCount); to.BulkInsertRows > limit {
+		return errors.Errorf("invalid bulk-insert-rows %d, must not be larger than %d, the DMLs applied together are at most txn-batch * worker-count * 3", to.BulkInsertRows, limit)
+	}
+	return nil
+}
+
+func (cfg *Config) validateCommitGroup() error {
+	to := cfg.SyncerCfg.To
+	if to.CommitGroupTxns < 0 {
+		return errors.Errorf("invalid commit-group-txns %d, must not be negative", to.CommitGroupTxns)
+	}
+	if to.CommitGroupWindow < 0 {
+		return errors.Errorf("invalid commit-group-window %d, must not be negative", to.CommitGroupWindow)
+	}
+	if to.CommitGroupTxns == 0 && to.CommitGroupWindow == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("commit-group-txns and commit-group-window are not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+	if to.RelaxedOrder {
+		return errors.New("commit-group-txns and commit-group-window can't be used with relaxed-order")
+	}
+	return nil
+}
+
+func (cfg *Config) validateStatsTable() error {
+	to := cfg.SyncerCfg.To
+	if to.StatsTableInterval < 0 {
+		return errors.Errorf("invalid stats-table-interval %d, must not be negative", to.StatsTableInterval)
+	}
+	if len(to.StatsTable) == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("stats-table is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+	return nil
+}
+
+func (cfg *Config) validateInitSQL() error {
+	to := cfg.SyncerCfg.To
+	if err := pkgsql.CheckInitSQL(to.Checkpoint.InitSQL); err != nil {
+		return errors.Annotate(err, "invalid init-sql of checkpoint")
+	}
+	if len(to.InitSQL) == 0 {
+		return nil
+	}
+	if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("init-sql is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	}
+	return errors.Annotate(pkgsql.CheckInitSQL(to.InitSQL), "invalid init-sql")
+}
+
+func (cfg *Config) validateTTLMode() error {
+	switch cfg.SyncerCfg.To.TTLMode {
+	case "", dsync.TTLModeKeep:
+		return nil
+	case dsync.TTLModeDisableJob:
+		if cfg.SyncerCfg.DestDBType == "mysql" || cfg.SyncerCfg.DestDBType == "tidb" {
+			return nil
+		}
+		return errors.Errorf("ttl-mode %s is not supported by db-type %s", dsync.TTLModeDisableJob, cfg.SyncerCfg.DestDBType)
+	default:
+		return errors.Errorf("invalid ttl-mode %s, must be %s or %s", cfg.SyncerCfg.To.TTLMode, dsync.TTLModeKeep, dsync.TTLModeDisableJob)
+	}
+}
+
+func (cfg *Config) validateMultiValuedIndex() error {
+	switch cfg.SyncerCfg.To.MultiValuedIndex {
+	case "", dsync.MultiValuedIndexKeep:
+		return nil
+	case dsync.MultiValuedIndexSkip:
+		if cfg.SyncerCfg.DestDBType == "mysql" || cfg.SyncerCfg.DestDBType == "tidb" {
+			return nil
+		}
+		return errors.Errorf("multi-valued-index %s is not supported by db-type %s", dsync.MultiValuedIndexSkip, cfg.SyncerCfg.DestDBType)
+	default:
+		return errors.Errorf("invalid multi-valued-index %s, must be %s or %s", cfg.SyncerCfg.To.MultiValuedIndex, dsync.MultiValuedIndexKeep, dsync.MultiValuedIndexSkip)
+	}
+}
+
+func (cfg *Config) validateColumnPosition() error {
+	switch cfg.SyncerCfg.To.ColumnPosition {
+	case "", dsync.ColumnPositionKeep:
+		return nil
+	case dsync.ColumnPositionIgnore:
+		if cfg.SyncerCfg.DestDBType == "mysql" || cfg.SyncerCfg.DestDBType == "tidb" {
+			return nil
+		}
+		return errors.Errorf("column-position %s is not supported by db-type %s", dsync.ColumnPositionIgnore, cfg.SyncerCfg.DestDBType)
+	default:
+		return errors.Errorf("invalid column-position %s, must be %s or %s", cfg.SyncerCfg.To.ColumnPosition, dsync.ColumnPositionKeep, dsync.ColumnPositionIgnore)
+	}
+}
+
+func (cfg *Config) validateIsolationLevel() error {
+	switch cfg.SyncerCfg.To.IsolationLevel {
+	case "":
+		return nil
+	case dsync.IsolationLevelReadCommitted, dsync.IsolationLevelRepeatableRead:
+		if cfg.SyncerCfg.DestDBType == "mysql" || cfg.SyncerCfg.DestDBType == "tidb" {
+			return nil
+		}
+		return errors.Errorf("isolation-level is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	default:
+		return errors.Errorf("invalid isolation-level %s, must be %s or %s", cfg.SyncerCfg.To.IsolationLevel, dsync.IsolationLevelReadCommitted, dsync.IsolationLevelRepeatableRead)
+	}
+}
+
+func (cfg *Config) validateZeroAutoIncrement() error {
+	switch cfg.SyncerCfg.To.ZeroAutoIncrement {
+	case "":
+		return nil
+	case dsync.ZeroAutoIncrementKeep, dsync.ZeroAutoIncrementGenerate:
+		if cfg.SyncerCfg.DestDBType == "mysql" || cfg.SyncerCfg.DestDBType == "tidb" {
+			return nil
+		}
+		return errors.Errorf("zero-auto-increment is not supported by db-type %s", cfg.SyncerCfg.DestDBType)
+	default:
+		return errors.Errorf("invalid zero-auto-increment %s, must be %s or %s", cfg.SyncerCfg.To.ZeroAutoIncrement, dsync.ZeroAutoIncrementKeep, dsync.ZeroAutoIncrementGenerate)
+	}
+}
+
+// validateTiDBRowID checks the _tidb_rowid is only included when syncing to mysql or tidb
+func (cfg *Config) validateTiDBRowID() error {
+	switch cfg.SyncerCfg.To.TiDBRowID {
+	case "", dsync.TiDBRowIDExclude:
+		return nil
+	case dsync.TiDBRowIDInclude:
+		if cfg.SyncerCfg.DestDBType == "mysql" || cfg.SyncerCfg.DestDBType == "tidb" {
+			return nil
+		}
+		return errors.Errorf("tidb-rowid %s is not supported by db-type %s", dsync.TiDBRowIDInclude, cfg.SyncerCfg.DestDBType)
+	default:
+		return errors.Errorf("invalid tidb-rowid %s, must be %s or %s", cfg.SyncerCfg.To.TiDBRowID, dsync.TiDBRowIDExclude, dsync.TiDBRowIDInclude)
+	}
+}
+
 func (cfg *Config) adjustConfig() error {
 	// adjust configuration
 	util.AdjustString(&cfg.ListenAddr, util.DefaultListenAddr(8249))
@@ -302,11 +1027,14 @@ func (cfg *Config) adjustConfig() error {
 	cfg.AdvertiseAddr = "http://" + cfg.AdvertiseAddr // add 'http:' scheme to facilitate parsing
 	util.AdjustString(&cfg.DataDir, defaultDataDir)
 	util.AdjustInt(&cfg.DetectInterval, defaultDetectInterval)
+	util.AdjustInt(&cfg.SyncerCfg.SchemaBootstrapMaxAttempts, defaultSchemaBootstrapMaxAttempts)
+	util.AdjustInt(&cfg.SyncerCfg.SchemaReplayWorkers, defaultSchemaReplayWorkers)
 
 	// add default syncer.to configuration if need
 	if cfg.SyncerCfg.To == nil {
 		cfg.SyncerCfg.To = new(dsync.DBConfig)
 	}
+	cfg.SyncerCfg.To.CaseSensitive = cfg.SyncerCfg.CaseSensitive
 
 	if cfg.SyncerCfg.DestDBType == "pb" {
 		// pb is an alias of file, use file instead
@@ -374,9 +1102,23 @@ func (cfg *Config) adjustConfig() error {
 			}
 			cfg.SyncerCfg.To.User = user
 		}
+		password, err := util.ResolvePassword(cfg.SyncerCfg.To.Password, cfg.SyncerCfg.To.PasswordFile, cfg.SyncerCfg.To.PasswordEnv)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		cfg.SyncerCfg.To.Password = password
 		if len(cfg.SyncerCfg.To.Password) == 0 {
 			cfg.SyncerCfg.To.Password = os.Getenv("MYSQL_PSWD")
 		}
+		if cfg.SyncerCfg.To.CircuitBreakerThreshold > 0 && cfg.SyncerCfg.To.CircuitBreakerCoolDown <= 0 {
+			cfg.SyncerCfg.To.CircuitBreakerCoolDown = defaultCircuitBreakerCoolDown
+		}
+		if deadLetter := &cfg.SyncerCfg.To.DeadLetter; deadLetter.Enable {
+			util.AdjustString(&deadLetter.Type, dsync.DeadLetterFile)
+			if deadLetter.Type == dsync.DeadLetterFile {
+				util.AdjustString(&deadLetter.Path, path.Join(cfg.DataDir, defaultDeadLetterFile))
+			}
+		}
 	}
 
 	cfg.SyncerCfg.adjustWorkCount()
@@ -23,8 +23,10 @@ import (
 	"github.com/BurntSushi/toml"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	pkgzk "github.com/pingcap/tidb-binlog/pkg/zk"
 	"github.com/samuel/go-zookeeper/zk"
@@ -98,6 +100,33 @@ func (t *testDrainerSuite) TestValidateFilter(c *C) {
 	cfg = NewConfig()
 	cfg.SyncerCfg.IgnoreTables = emptyTable
 	c.Assert(cfg.validateFilter(), NotNil)
+
+	cfg = NewConfig()
+	cfg.SyncerCfg.ColumnProjections = []ColumnProjection{{Schema: "s", Table: "t"}}
+	c.Assert(cfg.validateFilter(), ErrorMatches, ".*no columns.*")
+
+	cfg = NewConfig()
+	cfg.SyncerCfg.ColumnProjections = []ColumnProjection{{Schema: "s", Table: "t", Columns: []string{"id"}, Rename: map[string]string{"name": "n"}}}
+	c.Assert(cfg.validateFilter(), ErrorMatches, ".*renamed column name.*")
+}
+
+func (t *testDrainerSuite) TestLoaderColumnProjections(c *C) {
+	cfg := &SyncerConfig{
+		ColumnProjections: []ColumnProjection{{
+			Schema:  "test",
+			Table:   "user",
+			Columns: []string{"id", "email"},
+			Rename:  map[string]string{"email": "mail"},
+		}},
+	}
+	c.Assert(cfg.loaderColumnProjections(), DeepEquals, []loader.ColumnProjection{{
+		Database: "test",
+		Table:    "user",
+		Columns: []loader.ColumnMapping{
+			{Upstream: "id", Downstream: "id"},
+			{Upstream: "email", Downstream: "mail"},
+		},
+	}})
 }
 
 func (t *testDrainerSuite) TestValidate(c *C) {
@@ -131,6 +160,443 @@ func (t *testDrainerSuite) TestValidate(c *C) {
 	cfg.Compressor = "gzip"
 	err = cfg.validate()
 	c.Assert(err, IsNil)
+
+	cfg.PumpKeepAlive = -1
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid pump-tcp-keepalive -1, must not be negative.*")
+	cfg.PumpKeepAlive = 30
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.StartFromNow = true
+	cfg.InitialCommitTS = 408888888888888888
+	c.Assert(cfg.validate(), ErrorMatches, ".*start-from-now can't be used with initial-commit-ts 408888888888888888.*")
+	cfg.InitialCommitTS = -1
+	c.Assert(cfg.validate(), IsNil)
+	cfg.StartFromNow = false
+
+	cfg.BinlogGapPolicy = "ignore"
+	c.Assert(cfg.validate(), ErrorMatches, ".*unknown binlog-gap-policy ignore.*")
+	cfg.BinlogGapPolicy = BinlogGapWait
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.MaxInflightTxns = -1
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid max-inflight-txns.*")
+	cfg.SyncerCfg.MaxInflightTxns = 0
+
+	cfg.SyncerCfg.MaxBinlogSize = -1
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid max-binlog-size.*")
+	cfg.SyncerCfg.MaxBinlogSize = 1024
+	cfg.SyncerCfg.OversizeBinlogAction = "chunk"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*unknown oversize-binlog-action chunk.*")
+	cfg.SyncerCfg.OversizeBinlogAction = OversizeBinlogSkip
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.RenameAcrossFilter = "keep"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*unknown rename-across-filter keep.*")
+	cfg.SyncerCfg.RenameAcrossFilter = RenameAcrossFilterError
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.GlobalTemporaryTable = "drop"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*unknown global-temporary-table drop.*")
+	cfg.SyncerCfg.GlobalTemporaryTable = GlobalTemporaryTableSkip
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.CheckpointSaveTxns = -1
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid checkpoint-save-txns.*")
+	cfg.SyncerCfg.CheckpointSaveTxns = 1000
+	cfg.SyncerCfg.CheckpointSaveInterval = -1
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid checkpoint-save-interval.*")
+	cfg.SyncerCfg.CheckpointSaveInterval = 5
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.SchemaBootstrapMaxAttempts = -1
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid schema-bootstrap-max-attempts.*")
+	cfg.SyncerCfg.SchemaBootstrapMaxAttempts = 3
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.SchemaReplayWorkers = -1
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid schema-replay-workers -1, must not be negative.*")
+	cfg.SyncerCfg.SchemaReplayWorkers = 8
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.MaxLag = -1
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid max-lag -1, must not be negative.*")
+	cfg.SyncerCfg.MaxLag = 60
+	cfg.SyncerCfg.MaxLagDuration = -1
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid max-lag-duration -1, must not be negative.*")
+	cfg.SyncerCfg.MaxLagDuration = 0
+	cfg.SyncerCfg.MaxLagAction = "stop"
+	c.Assert(cfg.validate(), ErrorMatches, ".*unknown max-lag-action stop.*")
+	cfg.SyncerCfg.MaxLagAction = MaxLagHalt
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.DestDBType = "kafka"
+	cfg.SyncerCfg.To = &dsync.DBConfig{DeadLetter: dsync.DeadLetterConfig{Enable: true}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*dead letter is not supported by db-type kafka.*")
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{QuarantineUndecodableRows: true}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*quarantine-undecodable-rows is not supported by db-type kafka.*")
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{TxnMarkers: true}
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+	cfg.SyncerCfg.DestDBType = "tidb"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*txn-markers is not supported by db-type tidb.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{Checkpoint: dsync.CheckpointConfig{Type: "sqlite"}}
+	if checkpoint.SQLiteSupported {
+		c.Assert(cfg.validate(), IsNil)
+	} else {
+		c.Assert(cfg.validate(), ErrorMatches, ".*checkpoint type sqlite is not supported, drainer is built without cgo.*")
+	}
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{RowSequences: true}
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "mysql"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*row-sequences is not supported by db-type mysql.*")
+	cfg.SyncerCfg.DestDBType = "file"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*row-sequences is only supported by db-type file with file-format jsonl.gz.*")
+	cfg.SyncerCfg.To.FileFormat = dsync.FileFormatJSONLGzip
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{SnapshotMergeWindow: 10, SnapshotMergeMaxTxns: 100}
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "tidb"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*snapshot-merge-window is not supported by db-type tidb.*")
+	cfg.SyncerCfg.DestDBType = "file"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*snapshot-merge-window is only supported by db-type file with file-format jsonl.gz.*")
+	cfg.SyncerCfg.To.FileFormat = dsync.FileFormatJSONLGzip
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.To.SnapshotMergeWindow = -1
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid snapshot-merge-window -1, must not be negative.*")
+	cfg.SyncerCfg.To.SnapshotMergeWindow = 10
+	cfg.SyncerCfg.To.SnapshotMergeMaxTxns = -1
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid snapshot-merge-max-txns -1, must not be negative.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{TopicName: "data", DDLTopicName: "data"}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*ddl-topic-name data is the same as topic-name.*")
+	cfg.SyncerCfg.To.DDLTopicName = "schema"
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "mysql"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*ddl-topic-name is not supported by db-type mysql.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{TopicName: "data", KafkaKeyNamespace: true}
+	c.Assert(cfg.validate(), ErrorMatches, ".*kafka-key-namespace requires ddl-topic-name.*")
+	cfg.SyncerCfg.To.DDLTopicName = "schema"
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.To.DDLTopicName = ""
+	cfg.SyncerCfg.DestDBType = "file"
+	c.Assert(cfg.validate(), ErrorMatches, ".*kafka-key-namespace is not supported by db-type file.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{KafkaTimestamp: "log-append-time"}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid kafka-timestamp log-append-time, must be commit-ts or produce-time.*")
+	cfg.SyncerCfg.To.KafkaTimestamp = dsync.KafkaTimestampProduceTime
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "file"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*kafka-timestamp is not supported by db-type file.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{KafkaResolvedTSInterval: -1}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid kafka-resolved-ts-interval -1, must not be negative.*")
+	cfg.SyncerCfg.To.KafkaResolvedTSInterval = 1000
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "file"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*kafka-resolved-ts-interval is not supported by db-type file.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{FileFormat: dsync.FileFormatJSONLGzip}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*file-format is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = "file"
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.To.FileFormat = "json"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid file-format json, must be pb or jsonl.gz.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{TableCharset: "utf8mb4", TableCollation: "utf8mb4 bin"}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid collation utf8mb4 bin.*")
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{TableConcurrencies: []dsync.TableConcurrency{{Schema: "test", Concurrency: 1}}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*empty table name in `table-concurrency` config.*")
+	cfg.SyncerCfg.To.TableConcurrencies = []dsync.TableConcurrency{{Schema: "test", Table: "hot"}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid concurrency 0 in `table-concurrency` config of table test.hot.*")
+	cfg.SyncerCfg.To.TableConcurrencies = []dsync.TableConcurrency{{Schema: "test", Table: "~hot(", Concurrency: 1}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid pattern ~hot\\( in `table-concurrency` config.*")
+	cfg.SyncerCfg.To.TableConcurrencies = []dsync.TableConcurrency{{Schema: "test", Table: "~^hot_", Concurrency: 1}}
+	c.Assert(cfg.validate(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.LoaderTableConcurrencies(), DeepEquals, []loader.TableConcurrency{{Database: "test", Table: "~^hot_", Concurrency: 1}})
+
+	origDestDBType := cfg.SyncerCfg.DestDBType
+	mode := "ALLOW_INVALID_DATES"
+	cfg.SyncerCfg.To = &dsync.DBConfig{TableSessions: []dsync.TableSession{{Schema: "legacy", Table: "t", TimeZone: "UTC"}}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*`table-session` config is only supported by db-type mysql and tidb, but got kafka.*")
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To.TableSessions = []dsync.TableSession{{Schema: "legacy", Table: "t"}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid `table-session` config of table legacy.t, either time-zone or sql-mode is required.*")
+	cfg.SyncerCfg.To.TableSessions = []dsync.TableSession{{Schema: "legacy", Table: "t", TimeZone: "Mars/Olympus_Mons"}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid time-zone Mars/Olympus_Mons in `table-session` config of table legacy.t.*")
+	invalidMode := "NO_SUCH_MODE"
+	cfg.SyncerCfg.To.TableSessions = []dsync.TableSession{{Schema: "legacy", Table: "t", SQLMode: &invalidMode}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid sql-mode NO_SUCH_MODE in `table-session` config of table legacy.t.*")
+	cfg.SyncerCfg.To.TableSessions = []dsync.TableSession{{Schema: "legacy", Table: "~^log_", TimeZone: "UTC", SQLMode: &mode}}
+	c.Assert(cfg.validate(), IsNil)
+	// the 0 of AUTO_INCREMENT columns is still kept under the sql_mode of the table
+	keepMode := "ALLOW_INVALID_DATES,NO_AUTO_VALUE_ON_ZERO"
+	c.Assert(cfg.SyncerCfg.To.LoaderTableSessions(), DeepEquals, []loader.TableSession{{Database: "legacy", Table: "~^log_", TimeZone: "UTC", SQLMode: &keepMode}})
+	c.Assert(mode, Equals, "ALLOW_INVALID_DATES")
+	emptyMode := ""
+	cfg.SyncerCfg.To.TableSessions = []dsync.TableSession{{Schema: "legacy", Table: "t", SQLMode: &emptyMode}, {Schema: "legacy", Table: "u", SQLMode: &keepMode}, {Schema: "legacy", Table: "v", TimeZone: "UTC"}}
+	noAutoValueOnZero := "NO_AUTO_VALUE_ON_ZERO"
+	c.Assert(cfg.SyncerCfg.To.LoaderTableSessions(), DeepEquals, []loader.TableSession{{Database: "legacy", Table: "t", SQLMode: &noAutoValueOnZero},
+		{Database: "legacy", Table: "u", SQLMode: &keepMode}, {Database: "legacy", Table: "v", TimeZone: "UTC"}})
+	cfg.SyncerCfg.To.ZeroAutoIncrement = dsync.ZeroAutoIncrementGenerate
+	cfg.SyncerCfg.To.TableSessions = []dsync.TableSession{{Schema: "legacy", Table: "~^log_", TimeZone: "UTC", SQLMode: &mode}}
+	c.Assert(cfg.SyncerCfg.To.LoaderTableSessions(), DeepEquals, []loader.TableSession{{Database: "legacy", Table: "~^log_", TimeZone: "UTC", SQLMode: &mode}})
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{PreSplits: []dsync.TablePreSplit{{Schema: "test", Table: "t", Points: []int64{100}}}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*`pre-split` config is only supported by db-type tidb, but got mysql.*")
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To.PreSplits = []dsync.TablePreSplit{{Schema: "test", Table: "t", Lower: 100, Upper: 100, Regions: 4}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid `pre-split` config of table test.t.*")
+	cfg.SyncerCfg.To.PreSplits = []dsync.TablePreSplit{{Schema: "test", Table: "~^order_", Upper: 1000, Regions: 4}}
+	c.Assert(cfg.validate(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.LoaderPreSplits(), DeepEquals, []loader.TablePreSplit{{Database: "test", Table: "~^order_", Upper: 1000, Regions: 4}})
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{BeforeImages: []dsync.TableBeforeImage{{Schema: "test", Table: "t"}}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*`before-image` config is only supported by db-type kafka, but got mysql.*")
+	cfg.SyncerCfg.DestDBType = "kafka"
+	cfg.SyncerCfg.To.BeforeImages = []dsync.TableBeforeImage{{Schema: "test", Table: "~("}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid pattern ~\\( in `before-image` config.*")
+	cfg.SyncerCfg.To.BeforeImages = []dsync.TableBeforeImage{{Schema: "test", Table: "~^log_"}}
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.DestDBType = "file"
+	cfg.SyncerCfg.To = &dsync.DBConfig{ColumnOrders: []dsync.TableColumnOrder{{Schema: "test", Table: "t", Columns: []string{"id"}}}}
+	c.Assert(cfg.validate(), ErrorMatches, ".*`column-order` config is only supported by db-type file with file-format jsonl.gz.*")
+	cfg.SyncerCfg.To.FileFormat = dsync.FileFormatJSONLGzip
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.To.ColumnOrders = []dsync.TableColumnOrder{{Schema: "~(", Table: "t"}}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid pattern ~\\( in `column-order` config.*")
+	cfg.SyncerCfg.To.ColumnOrders = []dsync.TableColumnOrder{{Table: "t"}}
+	c.Assert(cfg.validate(), ErrorMatches, ".*empty schema or table name in `column-order` config.*")
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{LockedTablePolicy: "skip"}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid locked-table-policy skip, must be retry, wait or fail.*")
+	cfg.SyncerCfg.To.LockedTablePolicy = loader.LockedTableWait
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{NumericOverflow: "round"}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid numeric-overflow round, must be error, clamp or null.*")
+	cfg.SyncerCfg.To.NumericOverflow = loader.NumericOverflowClamp
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{LogSampleInterval: -1}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid log-sample-interval -1, must not be negative.*")
+	cfg.SyncerCfg.To.LogSampleInterval = 60
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{RetryMaxBackoff: -1}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid retry-max-backoff -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{RetryTimeBudget: -1}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid retry-time-budget -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{RetryMaxBackoff: 30, RetryTimeBudget: 600}
+	c.Assert(cfg.validate(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.LoaderRetryPolicy(), DeepEquals, loader.RetryPolicy{MaxBackoff: 30 * time.Second, Budget: 10 * time.Minute})
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{TCPKeepAlive: -1}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid tcp-keepalive -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{TCPKeepAlive: 30}
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{ThrottleProbeInterval: -1}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid throttle-probe-interval -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{ThrottleMaxDelay: -1}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid throttle-max-delay -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{ThrottleThresholds: map[string]float64{"": 64}}
+	cfg.SyncerCfg.DestDBType = "mysql"
+	c.Assert(cfg.validate(), ErrorMatches, ".*empty status variable name in throttle-thresholds.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{ThrottleThresholds: map[string]float64{"Threads_running": 64}, ThrottleMaxDelay: 500}
+	c.Assert(cfg.validate(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.LoaderThrottlePolicy(), DeepEquals, loader.ThrottlePolicy{
+		Thresholds: map[string]float64{"Threads_running": 64}, MaxDelay: 500 * time.Millisecond})
+	cfg.SyncerCfg.DestDBType = "kafka"
+	c.Assert(cfg.validate(), ErrorMatches, ".*throttle-thresholds is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{BulkInsertRows: -1}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid bulk-insert-rows -1, must not be negative.*")
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{BulkInsertRows: 1000}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid bulk-insert-batch-size 0, must be positive if bulk-insert-rows is set.*")
+	// the DMLs applied together are at most txn-batch * worker-count * 3, so a burst of 1000 rows is never seen
+	cfg.SyncerCfg.To = &dsync.DBConfig{BulkInsertRows: 1000, BulkInsertBatchSize: 200}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid bulk-insert-rows 1000, must not be larger than 960.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{BulkInsertRows: 960, BulkInsertBatchSize: 200}
+	c.Assert(cfg.validate(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.LoaderBulkInsertPolicy(), DeepEquals, loader.BulkInsertPolicy{MinRows: 960, BatchSize: 200})
+	cfg.SyncerCfg.DestDBType = "file"
+	c.Assert(cfg.validate(), ErrorMatches, ".*bulk-insert-rows is not supported by db-type file.*")
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{CommitGroupTxns: -1}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid commit-group-txns -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{CommitGroupWindow: -1}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid commit-group-window -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{CommitGroupTxns: 10, RelaxedOrder: true}
+	c.Assert(cfg.validate(), ErrorMatches, ".*can't be used with relaxed-order.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{CommitGroupTxns: 10, CommitGroupWindow: 50}
+	c.Assert(cfg.validate(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.LoaderCommitGroupPolicy(), DeepEquals, loader.CommitGroupPolicy{MaxTxns: 10, Window: 50 * time.Millisecond})
+	cfg.SyncerCfg.DestDBType = "kafka"
+	c.Assert(cfg.validate(), ErrorMatches, ".*commit-group-txns and commit-group-window are not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{StatsTable: "_drainer_stats", StatsTableInterval: -1}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid stats-table-interval -1, must not be negative.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{StatsTable: "_drainer_stats", StatsTableInterval: 30}
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "file"
+	c.Assert(cfg.validate(), ErrorMatches, ".*stats-table is not supported by db-type file.*")
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{InitSQL: []string{"SET SESSION tidb_txn_mode = 'optimistic'", " "}}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid init-sql: the init sql #1 is empty.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{Checkpoint: dsync.CheckpointConfig{InitSQL: []string{""}}}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid init-sql of checkpoint: the init sql #0 is empty.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{InitSQL: []string{"SET SESSION tidb_txn_mode = 'optimistic'"}}
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "kafka"
+	c.Assert(cfg.validate(), ErrorMatches, ".*init-sql is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{TTLMode: "strip"}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid ttl-mode strip, must be keep or disable-job.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{TTLMode: dsync.TTLModeDisableJob}
+	c.Assert(cfg.validate(), ErrorMatches, ".*ttl-mode disable-job is not supported by db-type kafka.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{MultiValuedIndex: "drop"}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid multi-valued-index drop, must be keep or skip.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{MultiValuedIndex: dsync.MultiValuedIndexSkip}
+	c.Assert(cfg.validate(), ErrorMatches, ".*multi-valued-index skip is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = "tidb"
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{ColumnPosition: "append"}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid column-position append, must be keep or ignore.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{ColumnPosition: dsync.ColumnPositionIgnore}
+	c.Assert(cfg.validate(), ErrorMatches, ".*column-position ignore is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = "mysql"
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{IsolationLevel: "serializable"}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid isolation-level serializable, must be read-committed or repeatable-read.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{IsolationLevel: dsync.IsolationLevelReadCommitted}
+	c.Assert(cfg.validate(), ErrorMatches, ".*isolation-level is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = "mysql"
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{ZeroAutoIncrement: "null"}
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid zero-auto-increment null, must be keep or generate.*")
+	cfg.SyncerCfg.To = &dsync.DBConfig{ZeroAutoIncrement: dsync.ZeroAutoIncrementGenerate}
+	c.Assert(cfg.validate(), ErrorMatches, ".*zero-auto-increment is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = "tidb"
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = origDestDBType
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{IdentifierQuote: "single-quote"}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*unknown identifier quote single-quote.*")
+
+	// there's no SQL generated for kafka and its file checkpoint
+	cfg.SyncerCfg.To.IdentifierQuote = "double-quote"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*identifier-quote double-quote is not supported by db-type kafka.*")
+
+	cfg.SyncerCfg.To.Checkpoint.Type = "mysql"
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To.Checkpoint.Type = ""
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.SyncerCfg.To.TiDBRowID = "unknown"
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid tidb-rowid unknown.*")
+	cfg.SyncerCfg.To.TiDBRowID = dsync.TiDBRowIDInclude
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.DestDBType = "kafka"
+	cfg.SyncerCfg.To.Checkpoint.Type = "mysql"
+	c.Assert(cfg.validate(), ErrorMatches, ".*tidb-rowid include is not supported by db-type kafka.*")
+	cfg.SyncerCfg.To.TiDBRowID = ""
+
+	cfg.SyncerCfg.To.SecondaryTS = "commit-ts"
+	c.Assert(cfg.validate(), ErrorMatches, ".*invalid secondary-ts commit-ts, must be downstream-tso or none.*")
+	cfg.SyncerCfg.To.SecondaryTS = dsync.SecondaryTSDownstreamTSO
+	c.Assert(cfg.validate(), ErrorMatches, ".*secondary-ts downstream-tso is not supported by db-type kafka.*")
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To.Checkpoint.Type = ""
+	c.Assert(cfg.validate(), IsNil)
+	cfg.SyncerCfg.To.SecondaryTS = dsync.SecondaryTSNone
+	c.Assert(cfg.validate(), IsNil)
 }
 
 func (t *testDrainerSuite) TestAdjustConfig(c *C) {
@@ -158,6 +624,65 @@ func (t *testDrainerSuite) TestAdjustConfig(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(cfg.ListenAddr, Equals, "http://0.0.0.0:8257")
 	c.Assert(cfg.AdvertiseAddr, Equals, "http://192.168.15.12:8257")
+
+	cfg = NewConfig()
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{CircuitBreakerThreshold: 3}
+	err = cfg.adjustConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.CircuitBreakerCoolDown, Equals, defaultCircuitBreakerCoolDown)
+
+	cfg = NewConfig()
+	cfg.DataDir = "/tmp/drainer"
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{DeadLetter: dsync.DeadLetterConfig{Enable: true}}
+	err = cfg.adjustConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.DeadLetter.Type, Equals, dsync.DeadLetterFile)
+	c.Assert(cfg.SyncerCfg.To.DeadLetter.Path, Equals, "/tmp/drainer/dead_letter.log")
+
+	passwordFile := path.Join(c.MkDir(), "password")
+	c.Assert(ioutil.WriteFile(passwordFile, []byte("from-file\n"), 0600), IsNil)
+	cfg = NewConfig()
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{Password: "inline", PasswordFile: passwordFile}
+	err = cfg.adjustConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.Password, Equals, "from-file")
+
+	// the passwords aren't logged
+	cfg.SyncerCfg.To.Checkpoint = dsync.CheckpointConfig{Password: "checkpoint-secret", WaitReplicas: []dsync.CheckpointReplica{{Host: "replica", Password: "replica-secret"}}}
+	redacted := cfg.Redacted()
+	c.Assert(redacted.SyncerCfg.To.Password, Equals, "******")
+	c.Assert(redacted.SyncerCfg.To.Checkpoint.Password, Equals, "******")
+	c.Assert(redacted.SyncerCfg.To.Checkpoint.WaitReplicas, DeepEquals, []dsync.CheckpointReplica{{Host: "replica", Password: "******"}})
+	c.Assert(cfg.String(), Not(Matches), "(?s).*(from-file|-secret).*")
+	c.Assert(cfg.SyncerCfg.To.Password, Equals, "from-file")
+	c.Assert(cfg.SyncerCfg.To.Checkpoint.WaitReplicas[0].Password, Equals, "replica-secret")
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{Password: "inline", PasswordEnv: "TEST_DRAINER_PASSWORD_NOT_SET"}
+	err = cfg.adjustConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.Password, Equals, "inline")
+
+	cfg = NewConfig()
+	cfg.SyncerCfg.DoDBs = []string{"DB1"}
+	cfg.SyncerCfg.DoTables = []filter.TableName{{Schema: "DB1", Table: "T1"}}
+	err = cfg.adjustConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.DoDBs, DeepEquals, []string{"db1"})
+	c.Assert(cfg.SyncerCfg.DoTables, DeepEquals, []filter.TableName{{Schema: "db1", Table: "t1"}})
+	c.Assert(cfg.SyncerCfg.To.CaseSensitive, IsFalse)
+
+	cfg = NewConfig()
+	cfg.SyncerCfg.CaseSensitive = true
+	cfg.SyncerCfg.DoDBs = []string{"DB1"}
+	cfg.SyncerCfg.DoTables = []filter.TableName{{Schema: "DB1", Table: "T1"}}
+	err = cfg.adjustConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.DoDBs, DeepEquals, []string{"DB1"})
+	c.Assert(cfg.SyncerCfg.DoTables, DeepEquals, []filter.TableName{{Schema: "DB1", Table: "T1"}})
+	c.Assert(cfg.SyncerCfg.To.CaseSensitive, IsTrue)
 }
 
 func (t *testDrainerSuite) TestConfigParsingFileWithInvalidOptions(c *C) {
@@ -191,6 +716,12 @@ func (t *testDrainerSuite) TestConfigParsingFileWithInvalidOptions(c *C) {
 	cfg := NewConfig()
 	err = cfg.Parse(args)
 	c.Assert(err, ErrorMatches, ".*contained unknown configuration options: unrecognized-option-test.*")
+
+	// start-from-now is only set by the command line flag
+	c.Assert(ioutil.WriteFile(configFilename, []byte("start-from-now = true\n"), 0644), IsNil)
+	cfg = NewConfig()
+	err = cfg.Parse(args)
+	c.Assert(err, ErrorMatches, ".*contained unknown configuration options: start-from-now.*")
 }
 
 var _ = Suite(&testKafkaSuite{})
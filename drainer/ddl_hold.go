@@ -0,0 +1,134 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"sync"
+
+	"github.com/pingcap/errors"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+)
+
+// ddlHold holds the DDLs while applying them to downstream is on hold, e.g. during a DML-only maintenance
+// window of downstream, and the DMLs of the other tables keep being applied.
+// The DMLs of a table changed by a held DDL are held after it, as they depend on the new schema, and so are
+// the DMLs of the tables written by a held txn, so every table is still applied in commit order.
+// The held items are released in commit order after the hold is turned off.
+type ddlHold struct {
+	mu      sync.Mutex
+	holding bool
+	// the held items in commit order
+	items []*dsync.Item
+	// the tables of the held items, the table name is empty for the DDLs of a schema, which hold all of its tables
+	tables map[TableName]struct{}
+
+	// notified after the hold is turned off, the held items are released by the run loop of syncer
+	released chan struct{}
+}
+
+func newDDLHold(holding bool) *ddlHold {
+	return &ddlHold{
+		holding:  holding,
+		tables:   make(map[TableName]struct{}),
+		released: make(chan struct{}, 1),
+	}
+}
+
+// hold turns on the hold, the DDLs reached later are held until release
+func (h *ddlHold) hold() {
+	h.mu.Lock()
+	h.holding = true
+	h.mu.Unlock()
+}
+
+// release turns off the hold, and returns the count of the held items to be released
+func (h *ddlHold) release() (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.holding {
+		return 0, errors.New("DDL is not on hold")
+	}
+	h.holding = false
+
+	select {
+	case h.released <- struct{}{}:
+	default:
+	}
+	return len(h.items), nil
+}
+
+// status returns whether the hold is on and the commit ts of the held items
+func (h *ddlHold) status() (holding bool, commitTS []int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	commitTS = make([]int64, 0, len(h.items))
+	for _, item := range h.items {
+		commitTS = append(commitTS, item.Binlog.GetCommitTs())
+	}
+	return h.holding, commitTS
+}
+
+// holdDDL holds the DDL item if the hold is on or there're held items not released yet
+func (h *ddlHold) holdDDL(item *dsync.Item) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.holding && len(h.items) == 0 {
+		return false
+	}
+
+	h.items = append(h.items, item)
+	h.tables[TableName{Schema: item.Schema, Table: item.Table}] = struct{}{}
+	return true
+}
+
+// holdDML holds the DML item writing tables if any of them is held
+func (h *ddlHold) holdDML(item *dsync.Item, tables []TableName) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.items) == 0 || !h.isHeld(tables) {
+		return false
+	}
+
+	h.items = append(h.items, item)
+	for _, table := range tables {
+		h.tables[table] = struct{}{}
+	}
+	return true
+}
+
+func (h *ddlHold) isHeld(tables []TableName) bool {
+	for _, table := range tables {
+		if _, ok := h.tables[table]; ok {
+			return true
+		}
+		if _, ok := h.tables[TableName{Schema: table.Schema}]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// take returns the held items in commit order and forgets them, it returns nil if the hold is turned on again
+func (h *ddlHold) take() []*dsync.Item {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holding {
+		return nil
+	}
+
+	items := h.items
+	h.items = nil
+	h.tables = make(map[TableName]struct{})
+	return items
+}
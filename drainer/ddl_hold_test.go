@@ -0,0 +1,78 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/check"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type ddlHoldSuite struct{}
+
+var _ = check.Suite(&ddlHoldSuite{})
+
+func heldItem(commitTS int64, schema string, table string) *dsync.Item {
+	return &dsync.Item{Binlog: &pb.Binlog{CommitTs: commitTS}, Schema: schema, Table: table}
+}
+
+func (s *ddlHoldSuite) TestHoldAndRelease(c *check.C) {
+	h := newDDLHold(false)
+	a := []TableName{{Schema: "test", Table: "a"}}
+	c.Assert(h.holdDDL(heldItem(1, "test", "a")), check.IsFalse)
+	c.Assert(h.holdDML(heldItem(2, "", ""), a), check.IsFalse)
+	_, err := h.release()
+	c.Assert(err, check.ErrorMatches, "DDL is not on hold")
+
+	h.hold()
+	c.Assert(h.holdDDL(heldItem(3, "test", "a")), check.IsTrue)
+	c.Assert(h.holdDML(heldItem(4, "", ""), a), check.IsTrue)
+	// the txn writing a held table holds the other tables it writes
+	c.Assert(h.holdDML(heldItem(5, "", ""), []TableName{{Schema: "test", Table: "b"}, {Schema: "test", Table: "a"}}), check.IsTrue)
+	c.Assert(h.holdDML(heldItem(6, "", ""), []TableName{{Schema: "test", Table: "b"}}), check.IsTrue)
+	c.Assert(h.holdDML(heldItem(7, "", ""), []TableName{{Schema: "test", Table: "c"}}), check.IsFalse)
+
+	count, err := h.release()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 4)
+	// the hold keeps the order until the held items are taken
+	c.Assert(h.holdDDL(heldItem(8, "test", "c")), check.IsTrue)
+	holding, held := h.status()
+	c.Assert(holding, check.IsFalse)
+	c.Assert(held, check.DeepEquals, []int64{3, 4, 5, 6, 8})
+
+	var taken []int64
+	for _, item := range h.take() {
+		taken = append(taken, item.Binlog.CommitTs)
+	}
+	c.Assert(taken, check.DeepEquals, []int64{3, 4, 5, 6, 8})
+	c.Assert(h.holdDDL(heldItem(9, "test", "c")), check.IsFalse)
+	c.Assert(h.holdDML(heldItem(10, "", ""), a), check.IsFalse)
+}
+
+func (s *ddlHoldSuite) TestHoldSchema(c *check.C) {
+	h := newDDLHold(true)
+	// the DDL of a schema holds all of its tables
+	c.Assert(h.holdDDL(heldItem(1, "test", "")), check.IsTrue)
+	c.Assert(h.holdDML(heldItem(2, "", ""), []TableName{{Schema: "test", Table: "a"}}), check.IsTrue)
+	c.Assert(h.holdDML(heldItem(3, "", ""), []TableName{{Schema: "other", Table: "a"}}), check.IsFalse)
+
+	// the items are not taken if it's on hold again before they're released
+	_, err := h.release()
+	c.Assert(err, check.IsNil)
+	h.hold()
+	c.Assert(h.take(), check.IsNil)
+	_, held := h.status()
+	c.Assert(held, check.DeepEquals, []int64{1, 2})
+}
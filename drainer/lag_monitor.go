@@ -0,0 +1,100 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxLagAlert logs an alert and sets the metric `binlog_drainer_max_lag_exceeded` if the lag exceeds max-lag
+	MaxLagAlert = "alert"
+	// MaxLagHalt alerts like MaxLagAlert and halts the syncer
+	MaxLagHalt = "halt"
+)
+
+// lagCheckInterval is the interval to check the lag of the applied txns
+var lagCheckInterval = time.Second
+
+// lagMonitor checks the lag between now and the commit ts of the txns applied to downstream,
+// it alerts once the lag exceeds max-lag for max-lag-duration, and alerts again after the lag recovers.
+type lagMonitor struct {
+	maxLag   time.Duration
+	duration time.Duration
+	halt     bool
+
+	// the time the lag exceeds maxLag since, it's zero if the lag is under maxLag
+	since   time.Time
+	alerted bool
+}
+
+// newLagMonitor returns nil if max-lag is not set
+func newLagMonitor(cfg *SyncerConfig) *lagMonitor {
+	if cfg.MaxLag <= 0 {
+		return nil
+	}
+	return &lagMonitor{
+		maxLag:   time.Duration(cfg.MaxLag) * time.Second,
+		duration: time.Duration(cfg.MaxLagDuration) * time.Second,
+		halt:     cfg.MaxLagAction == MaxLagHalt,
+	}
+}
+
+// check checks the lag of the txns applied until ts at now, an error is returned if the lag
+// exceeds max-lag for max-lag-duration and the syncer should halt. Nothing is checked if ts is 0.
+func (m *lagMonitor) check(now time.Time, ts int64) error {
+	if ts <= 0 {
+		return nil
+	}
+
+	lag := now.Sub(oracle.GetTimeFromTS(uint64(ts)))
+	if lag <= m.maxLag {
+		if m.alerted {
+			log.Info("the lag of drainer recovers", zap.Duration("lag", lag), zap.Duration("max-lag", m.maxLag), zap.Int64("applied ts", ts))
+			maxLagExceededGauge.Set(0)
+		}
+		m.since = time.Time{}
+		m.alerted = false
+		return nil
+	}
+
+	if m.since.IsZero() {
+		m.since = now
+	}
+	if now.Sub(m.since) < m.duration {
+		return nil
+	}
+
+	if !m.alerted {
+		m.alerted = true
+		maxLagExceededGauge.Set(1)
+		log.Error("the lag of drainer exceeds max-lag",
+			zap.Duration("lag", lag),
+			zap.Duration("max-lag", m.maxLag),
+			zap.Duration("max-lag-duration", m.duration),
+			zap.Duration("exceeded for", now.Sub(m.since)),
+			zap.Int64("applied ts", ts),
+			zap.Bool("halt", m.halt))
+	}
+	if m.halt {
+		return errors.Errorf("the lag %s exceeds max-lag %s for %s, the applied ts is %d, halt the syncer",
+			lag, m.maxLag, now.Sub(m.since), ts)
+	}
+	return nil
+}
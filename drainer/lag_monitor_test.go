@@ -0,0 +1,91 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type lagMonitorSuite struct{}
+
+var _ = Suite(&lagMonitorSuite{})
+
+func maxLagExceeded(c *C) float64 {
+	var m dto.Metric
+	c.Assert(maxLagExceededGauge.Write(&m), IsNil)
+	return m.GetGauge().GetValue()
+}
+
+func (s *lagMonitorSuite) TestNewLagMonitor(c *C) {
+	c.Assert(newLagMonitor(&SyncerConfig{}), IsNil)
+
+	m := newLagMonitor(&SyncerConfig{MaxLag: 10, MaxLagDuration: 30, MaxLagAction: MaxLagHalt})
+	c.Assert(m.maxLag, Equals, 10*time.Second)
+	c.Assert(m.duration, Equals, 30*time.Second)
+	c.Assert(m.halt, IsTrue)
+	c.Assert(newLagMonitor(&SyncerConfig{MaxLag: 10}).halt, IsFalse)
+}
+
+func (s *lagMonitorSuite) TestCheck(c *C) {
+	committed := time.Now().Truncate(time.Millisecond)
+	ts := int64(oracle.ComposeTS(oracle.GetPhysical(committed), 0))
+	at := func(d time.Duration) time.Time { return committed.Add(d) }
+
+	for _, halt := range []bool{false, true} {
+		maxLagExceededGauge.Set(0)
+		m := newLagMonitor(&SyncerConfig{MaxLag: 10, MaxLagDuration: 30})
+		m.halt = halt
+
+		// under max-lag
+		c.Assert(m.check(at(10*time.Second), ts), IsNil)
+		c.Assert(m.since.IsZero(), IsTrue)
+		// exceeds max-lag, but not for max-lag-duration yet
+		c.Assert(m.check(at(11*time.Second), ts), IsNil)
+		c.Assert(m.check(at(40*time.Second), ts), IsNil)
+		c.Assert(m.alerted, IsFalse)
+		c.Assert(maxLagExceeded(c), Equals, 0.0)
+
+		err := m.check(at(41*time.Second), ts)
+		c.Assert(m.alerted, IsTrue)
+		c.Assert(maxLagExceeded(c), Equals, 1.0)
+		if halt {
+			c.Assert(err, ErrorMatches, "the lag 41s exceeds max-lag 10s for 30s.*halt the syncer")
+		} else {
+			c.Assert(err, IsNil)
+			c.Assert(m.check(at(50*time.Second), ts), IsNil)
+		}
+
+		// the lag recovers after the txns are applied
+		applied := int64(oracle.ComposeTS(oracle.GetPhysical(at(50*time.Second)), 0))
+		c.Assert(m.check(at(55*time.Second), applied), IsNil)
+		c.Assert(m.alerted, IsFalse)
+		c.Assert(m.since.IsZero(), IsTrue)
+		c.Assert(maxLagExceeded(c), Equals, 0.0)
+
+		// the duration restarts when it exceeds again
+		c.Assert(m.check(at(61*time.Second), applied), IsNil)
+		c.Assert(m.check(at(90*time.Second), applied), IsNil)
+		c.Assert(maxLagExceeded(c), Equals, 0.0)
+	}
+}
+
+func (s *lagMonitorSuite) TestCheckNothingApplied(c *C) {
+	m := newLagMonitor(&SyncerConfig{MaxLag: 1, MaxLagAction: MaxLagHalt})
+	c.Assert(m.check(time.Now(), 0), IsNil)
+	c.Assert(m.since.IsZero(), IsTrue)
+}
@@ -67,6 +67,86 @@ var (
 			Help:      "save checkpoint tso of drainer.",
 		})
 
+	pumpCheckpointGapGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "pump_checkpoint_tso_gap",
+			Help:      "gap between the latest tso of pumps and the checkpoint tso of drainer.",
+		})
+
+	pumpCheckpointGapStaleGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "pump_checkpoint_tso_gap_stale",
+			Help:      "1 if pump_checkpoint_tso_gap may be inaccurate because some pumps are unreachable, otherwise 0.",
+		})
+
+	downstreamBreakerStateGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "downstream_circuit_breaker_state",
+			Help:      "State of the circuit breaker of downstream, 0: closed, 1: open, 2: half-open.",
+		})
+
+	preparedStmtGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "prepared_stmt_count",
+			Help:      "Count of the prepared statements cached in downstream, it's also the max count of every downstream connection.",
+		})
+
+	deadLetterCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "dead_letter_count",
+			Help:      "Total count of the events failing permanently and written to the dead letter.",
+		})
+
+	quarantinedRowCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "quarantined_row_count",
+			Help:      "Total count of the rows failing to be decoded and skipped.",
+		})
+
+	oversizeBinlogCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "oversize_binlog_count",
+			Help:      "Total count of the binlogs larger than max-binlog-size by the action handling them.",
+		}, []string{"action"})
+
+	skippedTemporaryTableCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "skipped_temporary_table_count",
+			Help:      "Total count of the DDLs and the row mutations of the temporary tables skipped by the kind of table.",
+		}, []string{"kind", "type"})
+
+	binlogGapCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "binlog_gap_count",
+			Help:      "Total count of the gaps of binlogs not received from the offline pumps by the policy handling them.",
+		}, []string{"nodeID", "policy"})
+
+	waitDurationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "wait_seconds_total",
+			Help:      "Total seconds the syncer spends waiting for new binlogs from upstream or blocked on adding them to downstream, by the side.",
+		}, []string{"side"})
+
 	checkpointDelayHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
@@ -76,6 +156,15 @@ var (
 			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 22),
 		})
 
+	checkpointSaveIntervalHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "checkpoint_save_interval_seconds",
+			Help:      "Bucketed histogram of the interval (s) between the saves of checkpoint.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+		})
+
 	executeHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
@@ -112,6 +201,14 @@ var (
 			Buckets:   prometheus.ExponentialBuckets(16, 2, 25),
 		}, []string{"nodeID"})
 
+	maxLagExceededGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "max_lag_exceeded",
+			Help:      "1 if the lag of the applied txns exceeds max-lag for max-lag-duration, or 0",
+		})
+
 	queueSizeGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: "binlog",
@@ -130,13 +227,25 @@ func init() {
 	registry.MustRegister(ddlJobsCounter)
 	registry.MustRegister(errorCount)
 	registry.MustRegister(checkpointTSOGauge)
+	registry.MustRegister(pumpCheckpointGapGauge)
+	registry.MustRegister(pumpCheckpointGapStaleGauge)
+	registry.MustRegister(downstreamBreakerStateGauge)
+	registry.MustRegister(preparedStmtGauge)
+	registry.MustRegister(deadLetterCounter)
+	registry.MustRegister(quarantinedRowCounter)
+	registry.MustRegister(oversizeBinlogCounter)
+	registry.MustRegister(skippedTemporaryTableCounter)
+	registry.MustRegister(binlogGapCounter)
+	registry.MustRegister(waitDurationCounter)
 	registry.MustRegister(checkpointDelayHistogram)
+	registry.MustRegister(checkpointSaveIntervalHistogram)
 	registry.MustRegister(eventCounter)
 	registry.MustRegister(executeHistogram)
 	registry.MustRegister(binlogReachDurationHistogram)
 	registry.MustRegister(readBinlogSizeHistogram)
 	registry.MustRegister(queryHistogramVec)
 	registry.MustRegister(queueSizeGauge)
+	registry.MustRegister(maxLagExceededGauge)
 
 	// for pb using it
 	bf.InitMetircs(registry)
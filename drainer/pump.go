@@ -14,6 +14,7 @@
 package drainer
 
 import (
+	"net"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -23,7 +24,6 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pump"
-	"github.com/pingcap/tidb/store/tikv/oracle"
 	pb "github.com/pingcap/tipb/go-binlog"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
@@ -43,6 +43,8 @@ type Pump struct {
 	clusterID uint64
 	// the latest binlog ts that pump had handled
 	latestTS int64
+	// the max commit ts of the last gap detected when the pump is offline
+	gapTS int64
 
 	isClosed int32
 
@@ -171,7 +173,8 @@ func (p *Pump) PullBinlog(pctx context.Context, last int64) chan MergeItem {
 				return
 			}
 
-			millisecond := time.Now().UnixNano()/1000000 - oracle.ExtractPhysical(uint64(binlog.CommitTs))
+			physical, _ := util.ExtractPhysicalLogical(binlog.CommitTs)
+			millisecond := time.Now().UnixNano()/1000000 - physical
 			binlogReachDurationHistogram.WithLabelValues(p.nodeID).Observe(float64(millisecond) / 1000.0)
 
 			item := newBinlogItem(binlog, p.nodeID)
@@ -204,7 +207,15 @@ func (p *Pump) createPullBinlogsClient(ctx context.Context, last int64) error {
 		callOpts = append(callOpts, grpc.UseCompressor(compressor))
 	}
 
-	conn, err := grpc.Dial(p.addr, grpc.WithInsecure(), grpc.WithDefaultCallOptions(callOpts...))
+	dialOpts := []grpc.DialOption{grpc.WithInsecure(), grpc.WithDefaultCallOptions(callOpts...)}
+	if keepAlive, ok := getPumpKeepAlive(ctx); ok {
+		dialer := util.NewKeepAliveDialer(keepAlive)
+		dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}))
+	}
+
+	conn, err := grpc.Dial(p.addr, dialOpts...)
 	if err != nil {
 		p.logger.Error("pump create grpc dial failed", zap.Error(err))
 		p.pullCli = nil
@@ -249,3 +260,11 @@ func getCompressorName(ctx context.Context) (string, bool) {
 	}
 	return "", false
 }
+
+// getPumpKeepAlive returns the period of the TCP keepalive probes on the connections to pumps if it's set
+func getPumpKeepAlive(ctx context.Context) (time.Duration, bool) {
+	if period, ok := ctx.Value(drainerKeyType("pump-tcp-keepalive")).(time.Duration); ok && period > 0 {
+		return period, true
+	}
+	return 0, false
+}
@@ -46,6 +46,21 @@ func (s *pumpSuite) TestGetCompressorName(c *C) {
 	c.Assert(cp, Equals, "gzip")
 }
 
+func (s *pumpSuite) TestGetPumpKeepAlive(c *C) {
+	ctx := context.Background()
+	_, ok := getPumpKeepAlive(ctx)
+	c.Assert(ok, IsFalse)
+
+	ctx = context.WithValue(ctx, drainerKeyType("pump-tcp-keepalive"), time.Duration(0))
+	_, ok = getPumpKeepAlive(ctx)
+	c.Assert(ok, IsFalse)
+
+	ctx = context.WithValue(ctx, drainerKeyType("pump-tcp-keepalive"), 30*time.Second)
+	period, ok := getPumpKeepAlive(ctx)
+	c.Assert(ok, IsTrue)
+	c.Assert(period, Equals, 30*time.Second)
+}
+
 type mockPumpPullBinlogsClient struct {
 	grpc.ClientStream
 	binlogBytesChan chan []byte
@@ -0,0 +1,64 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"time"
+)
+
+// defaultCheckpointSaveInterval is used if checkpoint-save-interval isn't set
+const defaultCheckpointSaveInterval = 3 * time.Second
+
+// savePolicy decides when to save the checkpoint of the applied transactions, the save is due
+// after every `txns` transactions are applied if txns > 0, or `interval` passes since the last save,
+// whichever comes first.
+type savePolicy struct {
+	txns     int
+	interval time.Duration
+
+	// the count of transactions applied since the last save
+	applied  int
+	lastSave time.Time
+}
+
+func newSavePolicy(txns int, interval time.Duration) *savePolicy {
+	if interval <= 0 {
+		interval = defaultCheckpointSaveInterval
+	}
+	return &savePolicy{
+		txns:     txns,
+		interval: interval,
+		lastSave: time.Now(),
+	}
+}
+
+// apply records a transaction applied to downstream
+func (p *savePolicy) apply() {
+	p.applied++
+}
+
+// due returns whether the checkpoint should be saved at now
+func (p *savePolicy) due(now time.Time) bool {
+	if p.txns > 0 && p.applied >= p.txns {
+		return true
+	}
+	return now.Sub(p.lastSave) >= p.interval
+}
+
+// saved records the checkpoint is saved at now
+func (p *savePolicy) saved(now time.Time) {
+	checkpointSaveIntervalHistogram.Observe(now.Sub(p.lastSave).Seconds())
+	p.applied = 0
+	p.lastSave = now
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type savePolicySuite struct{}
+
+var _ = check.Suite(&savePolicySuite{})
+
+func (s *savePolicySuite) TestDefaultInterval(c *check.C) {
+	p := newSavePolicy(0, 0)
+	c.Assert(p.interval, check.Equals, defaultCheckpointSaveInterval)
+
+	now := p.lastSave
+	for i := 0; i < 1000; i++ {
+		p.apply()
+	}
+	// no count limit
+	c.Assert(p.due(now), check.IsFalse)
+	c.Assert(p.due(now.Add(defaultCheckpointSaveInterval)), check.IsTrue)
+}
+
+func (s *savePolicySuite) TestTxnsOrInterval(c *check.C) {
+	p := newSavePolicy(3, time.Minute)
+	now := p.lastSave
+
+	// due after every 3 txns
+	p.apply()
+	p.apply()
+	c.Assert(p.due(now), check.IsFalse)
+	p.apply()
+	c.Assert(p.due(now), check.IsTrue)
+	p.saved(now)
+	c.Assert(p.due(now), check.IsFalse)
+
+	// or after the interval passes, whichever comes first
+	p.apply()
+	c.Assert(p.due(now.Add(30*time.Second)), check.IsFalse)
+	c.Assert(p.due(now.Add(time.Minute)), check.IsTrue)
+	p.saved(now.Add(time.Minute))
+	c.Assert(p.applied, check.Equals, 0)
+	c.Assert(p.due(now.Add(time.Minute+time.Second)), check.IsFalse)
+}
@@ -15,18 +15,36 @@ package drainer
 
 import (
 	"encoding/json"
+	"sort"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	"go.uber.org/zap"
 )
 
 const implicitColName = "_tidb_rowid"
 const implicitColID = -1
 
+// the max count of table info versions kept for every table to decode the rows of old schema version
+const maxTableHistory = 16
+
+// The sequence DDL job types of TiDB, they are not defined by the parser we depend on yet.
+// TiDB stores a sequence as a table, ALTER SEQUENCE(35) carries the new table info,
+// so it's handled like other DDLs that replace the table info.
+const (
+	actionCreateSequence model.ActionType = 34
+	actionDropSequence   model.ActionType = 36
+)
+
+// actionRenameTables is the job type of TiDB renaming multiple tables by one `RENAME TABLE` statement,
+// it's not defined by the parser we depend on yet, and neither are the table infos it carries in binlog info,
+// so the renamed tables are taken from the tracked ones with the names in the job args.
+const actionRenameTables model.ActionType = 55
+
 // Schema stores the source TiDB all schema infomations
 // schema infomations could be changed by drainer init and ddls appear
 type Schema struct {
@@ -43,22 +61,63 @@ type Schema struct {
 
 	hasImplicitCol bool
 
+	// the max goroutines replaying the history DDL jobs of independent schemas concurrently on startup
+	replayWorkers int
+
 	jobs                []*model.Job
 	version2SchemaTable map[int64]TableName
-	currentVersion      int64
+	// the tables renamed by the `RENAME TABLE` DDL of the schema version
+	version2Renames map[int64][]tableRename
+	// the kinds of the temporary tables by table id, and the kind of the temporary table changed by the DDL of the schema version
+	tempTables        map[int64]string
+	version2TempTable map[int64]string
+	currentVersion    int64
+
+	// the table infos since the schema versions of DDL, in the order of version
+	tableHistory map[int64][]tableVersion
+}
+
+// the kinds of the temporary tables
+const (
+	localTemporaryTable  = "local"
+	globalTemporaryTable = "global"
+)
+
+// tableRename is a table renamed from From to To, which may be in different schemas
+type tableRename struct {
+	From TableName
+	To   TableName
+}
+
+// tableVersion is the table info since the schema version, info is nil if the table is dropped
+type tableVersion struct {
+	version int64
+	info    *model.TableInfo
 }
 
 // TableName stores the table and schema name
 type TableName = filter.TableName
 
+// TrackedTable is a table tracked in the schema, Version is the schema version of the last DDL changing it
+type TrackedTable struct {
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	ID      int64  `json:"id"`
+	Version int64  `json:"version"`
+}
+
 // NewSchema returns the Schema object
 func NewSchema(jobs []*model.Job, hasImplicitCol bool) (*Schema, error) {
 	s := &Schema{
 		hasImplicitCol:      hasImplicitCol,
 		version2SchemaTable: make(map[int64]TableName),
+		version2Renames:     make(map[int64][]tableRename),
+		tempTables:          make(map[int64]string),
+		version2TempTable:   make(map[int64]string),
 		truncateTableID:     make(map[int64]struct{}),
 		tblsDroppingCol:     make(map[int64]bool),
 		jobs:                jobs,
+		tableHistory:        make(map[int64][]tableVersion),
 	}
 
 	s.tableIDToName = make(map[int64]TableName)
@@ -89,6 +148,35 @@ func (s *Schema) SchemaMetaVersion() int64 {
 	return s.schemaMetaVersion
 }
 
+// CurrentVersion returns the schema version of the last DDL job handled
+func (s *Schema) CurrentVersion() int64 {
+	return s.currentVersion
+}
+
+// TrackedTables returns the tables tracked currently in the order of schema and table name
+func (s *Schema) TrackedTables() []TrackedTable {
+	tables := make([]TrackedTable, 0, len(s.tables))
+	for id := range s.tables {
+		name, ok := s.tableIDToName[id]
+		if !ok {
+			continue
+		}
+		table := TrackedTable{Schema: name.Schema, Table: name.Table, ID: id}
+		if history := s.tableHistory[id]; len(history) > 0 {
+			table.Version = history[len(history)-1].version
+		}
+		tables = append(tables, table)
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Schema != tables[j].Schema {
+			return tables[i].Schema < tables[j].Schema
+		}
+		return tables[i].Table < tables[j].Table
+	})
+	return tables
+}
+
 // SchemaAndTableName returns the tableName by table id
 func (s *Schema) SchemaAndTableName(id int64) (string, string, bool) {
 	tn, ok := s.tableIDToName[id]
@@ -124,6 +212,29 @@ func (s *Schema) TableByID(id int64) (val *model.TableInfo, ok bool) {
 	return
 }
 
+// TableByIDAndVersion returns the TableInfo by table id at the schema version,
+// it's the current one if the table isn't changed since the version by the DDLs handled,
+// or the versions before are not kept.
+func (s *Schema) TableByIDAndVersion(id int64, version int64) (*model.TableInfo, bool) {
+	history := s.tableHistory[id]
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].version <= version {
+			return history[i].info, history[i].info != nil
+		}
+	}
+
+	return s.TableByID(id)
+}
+
+// recordTable keeps the current table info of id since the schema version
+func (s *Schema) recordTable(id int64, version int64) {
+	history := append(s.tableHistory[id], tableVersion{version: version, info: s.tables[id]})
+	if len(history) > maxTableHistory {
+		history = history[len(history)-maxTableHistory:]
+	}
+	s.tableHistory[id] = history
+}
+
 // DropSchema deletes the given DBInfo
 func (s *Schema) DropSchema(id int64) (string, error) {
 	schema, ok := s.schemas[id]
@@ -180,6 +291,7 @@ func (s *Schema) CreateTable(schema *model.DBInfo, table *model.TableInfo) error
 		return errors.AlreadyExistsf("table %s.%s", schema.Name, table.Name)
 	}
 
+	orderColumns(table)
 	if s.hasImplicitCol && !table.PKIsHandle {
 		addImplicitColumn(table)
 	}
@@ -199,6 +311,7 @@ func (s *Schema) ReplaceTable(table *model.TableInfo) error {
 		return errors.NotFoundf("table %s(%d)", table.Name, table.ID)
 	}
 
+	orderColumns(table)
 	if s.hasImplicitCol && !table.PKIsHandle {
 		addImplicitColumn(table)
 	}
@@ -231,6 +344,14 @@ func (s *Schema) addJob(job *model.Job) {
 }
 
 func (s *Schema) handlePreviousDDLJobIfNeed(version int64) error {
+	if s.canReplayConcurrently() {
+		return errors.Trace(s.replayJobsConcurrently(version))
+	}
+	return errors.Trace(s.replayPreviousDDLJobs(version))
+}
+
+// replayPreviousDDLJobs handles the jobs with the schema version <= version in order
+func (s *Schema) replayPreviousDDLJobs(version int64) error {
 	var i int
 	for i = 0; i < len(s.jobs); i++ {
 		job := s.jobs[i]
@@ -279,6 +400,7 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 	if sql == "" {
 		return "", "", "", errors.Errorf("[ddl job sql miss]%+v", job)
 	}
+	tempKind := s.temporaryTableKindOfDDL(job)
 
 	switch job.Type {
 	case model.ActionCreateSchema:
@@ -321,6 +443,7 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 		if !ok {
 			return "", "", "", errors.NotFoundf("table(%d) or it's schema", job.TableID)
 		}
+		from := s.tableIDToName[job.TableID]
 		// first drop the table
 		_, err := s.DropTable(job.TableID)
 		if err != nil {
@@ -338,12 +461,26 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 			return "", "", "", errors.Trace(err)
 		}
 
+		s.recordTable(table.ID, job.BinlogInfo.SchemaVersion)
 		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: table.Name.O}
+		s.version2Renames[job.BinlogInfo.SchemaVersion] = []tableRename{{From: from, To: TableName{Schema: schema.Name.O, Table: table.Name.O}}}
 		s.currentVersion = job.BinlogInfo.SchemaVersion
 		schemaName = schema.Name.O
 		tableName = table.Name.O
 
-	case model.ActionCreateTable, model.ActionCreateView, model.ActionRecoverTable:
+	case actionRenameTables:
+		renames, err := s.renameTables(job)
+		if err != nil {
+			return "", "", "", errors.Trace(err)
+		}
+
+		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = renames[0].To
+		s.version2Renames[job.BinlogInfo.SchemaVersion] = renames
+		s.currentVersion = job.BinlogInfo.SchemaVersion
+		schemaName = renames[0].To.Schema
+		tableName = renames[0].To.Table
+
+	case model.ActionCreateTable, model.ActionCreateView, model.ActionRecoverTable, actionCreateSequence:
 		table := job.BinlogInfo.TableInfo
 		if table == nil {
 			return "", "", "", errors.NotFoundf("table %d", job.TableID)
@@ -359,12 +496,13 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 			return "", "", "", errors.Trace(err)
 		}
 
+		s.recordTable(table.ID, job.BinlogInfo.SchemaVersion)
 		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: table.Name.O}
 		s.currentVersion = job.BinlogInfo.SchemaVersion
 		schemaName = schema.Name.O
 		tableName = table.Name.O
 
-	case model.ActionDropTable, model.ActionDropView:
+	case model.ActionDropTable, model.ActionDropView, actionDropSequence:
 		schema, ok := s.SchemaByID(job.SchemaID)
 		if !ok {
 			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
@@ -375,6 +513,7 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 			return "", "", "", errors.Trace(err)
 		}
 
+		s.recordTable(job.TableID, job.BinlogInfo.SchemaVersion)
 		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: tableName}
 		s.currentVersion = job.BinlogInfo.SchemaVersion
 		schemaName = schema.Name.O
@@ -401,6 +540,8 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 			return "", "", "", errors.Trace(err)
 		}
 
+		s.recordTable(job.TableID, job.BinlogInfo.SchemaVersion)
+		s.recordTable(table.ID, job.BinlogInfo.SchemaVersion)
 		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: table.Name.O}
 		s.currentVersion = job.BinlogInfo.SchemaVersion
 		schemaName = schema.Name.O
@@ -427,6 +568,7 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 			return "", "", "", errors.Trace(err)
 		}
 
+		s.recordTable(tbInfo.ID, job.BinlogInfo.SchemaVersion)
 		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: tbInfo.Name.O}
 		s.currentVersion = job.BinlogInfo.SchemaVersion
 		schemaName = schema.Name.O
@@ -438,9 +580,52 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 		}
 	}
 
+	if tempKind != "" {
+		s.trackTemporaryTable(job, tempKind)
+	}
+
 	return
 }
 
+// temporaryTableKindOfDDL returns the kind of the temporary table created or changed by the DDL job,
+// it's empty if the table isn't a temporary one
+func (s *Schema) temporaryTableKindOfDDL(job *model.Job) string {
+	switch {
+	case util.IsLocalTemporaryTableDDL(job.Query):
+		return localTemporaryTable
+	case util.IsGlobalTemporaryTableDDL(job.Query):
+		return globalTemporaryTable
+	}
+	return s.tempTables[job.TableID]
+}
+
+// trackTemporaryTable records the temporary table created, dropped or truncated by the DDL job
+func (s *Schema) trackTemporaryTable(job *model.Job, kind string) {
+	s.version2TempTable[job.BinlogInfo.SchemaVersion] = kind
+	switch job.Type {
+	case model.ActionCreateTable:
+		s.tempTables[job.BinlogInfo.TableInfo.ID] = kind
+	case model.ActionDropTable:
+		delete(s.tempTables, job.TableID)
+	case model.ActionTruncateTable:
+		delete(s.tempTables, job.TableID)
+		s.tempTables[job.BinlogInfo.TableInfo.ID] = kind
+	}
+}
+
+// TemporaryTableKind returns the kind of the temporary table, ok is false if it's not a temporary table
+func (s *Schema) TemporaryTableKind(id int64) (kind string, ok bool) {
+	kind, ok = s.tempTables[id]
+	return
+}
+
+// getTemporaryTableAndDelete returns the kind of the temporary table changed by the DDL of the schema version
+func (s *Schema) getTemporaryTableAndDelete(version int64) (string, bool) {
+	kind, ok := s.version2TempTable[version]
+	delete(s.version2TempTable, version)
+	return kind, ok
+}
+
 // IsDroppingColumn returns true if the table is in the middle of dropping a column
 func (s *Schema) IsDroppingColumn(id int64) bool {
 	return s.tblsDroppingCol[id]
@@ -452,6 +637,59 @@ func (s *Schema) IsTruncateTableID(id int64) bool {
 	return ok
 }
 
+// renameTables moves the tables renamed by the job of actionRenameTables to the new schemas with the new names
+func (s *Schema) renameTables(job *model.Job) ([]tableRename, error) {
+	var (
+		oldSchemaIDs   []int64
+		newSchemaIDs   []int64
+		tableNames     []*model.CIStr
+		tableIDs       []int64
+		oldSchemaNames []*model.CIStr
+	)
+	if err := job.DecodeArgs(&oldSchemaIDs, &newSchemaIDs, &tableNames, &tableIDs, &oldSchemaNames); err != nil {
+		return nil, errors.Annotatef(err, "decode the args of rename tables job %d", job.ID)
+	}
+	if len(tableIDs) == 0 || len(newSchemaIDs) != len(tableIDs) || len(tableNames) != len(tableIDs) {
+		return nil, errors.Errorf("invalid args of rename tables job %d, %d table IDs with %d schemas and %d names",
+			job.ID, len(tableIDs), len(newSchemaIDs), len(tableNames))
+	}
+
+	renames := make([]tableRename, 0, len(tableIDs))
+	for i, id := range tableIDs {
+		table, ok := s.TableByID(id)
+		if !ok {
+			return nil, errors.NotFoundf("table %d", id)
+		}
+		from, ok := s.tableIDToName[id]
+		if !ok {
+			return nil, errors.NotFoundf("table(%d) or it's schema", id)
+		}
+		schema, ok := s.SchemaByID(newSchemaIDs[i])
+		if !ok {
+			return nil, errors.NotFoundf("schema %d", newSchemaIDs[i])
+		}
+
+		if _, err := s.DropTable(id); err != nil {
+			return nil, errors.Trace(err)
+		}
+		renamed := table.Clone()
+		renamed.Name = *tableNames[i]
+		if err := s.CreateTable(schema, renamed); err != nil {
+			return nil, errors.Trace(err)
+		}
+		s.recordTable(id, job.BinlogInfo.SchemaVersion)
+		renames = append(renames, tableRename{From: from, To: TableName{Schema: schema.Name.O, Table: renamed.Name.O}})
+	}
+	return renames, nil
+}
+
+// getRenamesAndDelete returns the tables renamed by the `RENAME TABLE` DDL of the schema version
+func (s *Schema) getRenamesAndDelete(version int64) ([]tableRename, bool) {
+	renames, ok := s.version2Renames[version]
+	delete(s.version2Renames, version)
+	return renames, ok
+}
+
 func (s *Schema) getSchemaTableAndDelete(version int64) (string, string, error) {
 	schemaTable, ok := s.version2SchemaTable[version]
 	if !ok {
@@ -462,10 +700,20 @@ func (s *Schema) getSchemaTableAndDelete(version int64) (string, string, error)
 	return schemaTable.Schema, schemaTable.Table, nil
 }
 
+// orderColumns orders the columns of the table by their offsets. TiDB keeps the column added by `FIRST` or
+// `AFTER col` at the end until it becomes public, and moves it to its position then, the columns are ordered
+// anyway, so the DMLs are encoded in the column order of the table whatever the table info of the job is.
+func orderColumns(table *model.TableInfo) {
+	sort.SliceStable(table.Columns, func(i, j int) bool {
+		return table.Columns[i].Offset < table.Columns[j].Offset
+	})
+}
+
 func addImplicitColumn(table *model.TableInfo) {
 	newColumn := &model.ColumnInfo{
-		ID:   implicitColID,
-		Name: model.NewCIStr(implicitColName),
+		ID:    implicitColID,
+		Name:  model.NewCIStr(implicitColName),
+		State: model.StatePublic,
 	}
 	newColumn.Tp = mysql.TypeInt24
 	table.Columns = append(table.Columns, newColumn)
@@ -0,0 +1,238 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"go.uber.org/zap"
+)
+
+// replayJobGroup replays the jobs of a group into the schema of it, it's a variable to be hooked in tests
+var replayJobGroup = func(s *Schema, version int64) error {
+	return s.replayPreviousDDLJobs(version)
+}
+
+// canReplayConcurrently returns whether the jobs before version can be replayed concurrently,
+// it's only done for the initial replay of the history DDL jobs, when nothing is replayed yet.
+func (s *Schema) canReplayConcurrently() bool {
+	return s.replayWorkers > 1 && s.currentVersion == 0 && len(s.schemas) == 0 && len(s.tables) == 0
+}
+
+// replayJobsConcurrently replays the jobs with the schema version <= version by up to replayWorkers goroutines.
+// The jobs are split into the groups of the schemas depending on each other, and every group is replayed
+// in order into a separate Schema, which are merged into s at last. A group is a set of the schemas
+// sharing the same name, like the one dropped and the one created later, or the tables renamed between them.
+func (s *Schema) replayJobsConcurrently(version int64) error {
+	var i int
+	for i < len(s.jobs) && s.jobs[i].BinlogInfo.SchemaVersion <= version {
+		i++
+	}
+	jobs, rest := s.jobs[:i], s.jobs[i:]
+
+	groups := groupJobsBySchema(jobs)
+	if len(groups) <= 1 {
+		return errors.Trace(s.replayPreviousDDLJobs(version))
+	}
+
+	workers := s.replayWorkers
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	log.Info("replay the history DDL jobs concurrently",
+		zap.Int("jobs", len(jobs)), zap.Int("groups", len(groups)), zap.Int("workers", workers))
+	start := time.Now()
+
+	subs := make([]*Schema, len(groups))
+	errs := make([]error, len(groups))
+	groupCh := make(chan int, len(groups))
+	for idx := range groups {
+		sub, err := NewSchema(groups[idx], s.hasImplicitCol)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		subs[idx] = sub
+		groupCh <- idx
+	}
+	close(groupCh)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range groupCh {
+				errs[idx] = replayJobGroup(subs[idx], version)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, sub := range subs {
+		s.merge(sub)
+	}
+	s.jobs = rest
+
+	log.Info("replay the history DDL jobs concurrently success",
+		zap.Int64("currentVersion", s.currentVersion), zap.Duration("take", time.Since(start)))
+	return nil
+}
+
+// merge merges the schema replayed from an independent group of jobs into s
+func (s *Schema) merge(sub *Schema) {
+	for id, name := range sub.tableIDToName {
+		s.tableIDToName[id] = name
+	}
+	for name, id := range sub.schemaNameToID {
+		s.schemaNameToID[name] = id
+	}
+	for id, db := range sub.schemas {
+		s.schemas[id] = db
+	}
+	for id, table := range sub.tables {
+		s.tables[id] = table
+	}
+	for id := range sub.truncateTableID {
+		s.truncateTableID[id] = struct{}{}
+	}
+	for id, dropping := range sub.tblsDroppingCol {
+		s.tblsDroppingCol[id] = dropping
+	}
+	for version, name := range sub.version2SchemaTable {
+		s.version2SchemaTable[version] = name
+	}
+	for version, renames := range sub.version2Renames {
+		s.version2Renames[version] = renames
+	}
+	for id, kind := range sub.tempTables {
+		s.tempTables[id] = kind
+	}
+	for version, kind := range sub.version2TempTable {
+		s.version2TempTable[version] = kind
+	}
+	for id, history := range sub.tableHistory {
+		s.tableHistory[id] = history
+	}
+	if sub.currentVersion > s.currentVersion {
+		s.currentVersion = sub.currentVersion
+	}
+}
+
+// groupJobsBySchema splits the jobs sorted by schema version into the groups of the schemas depending
+// on each other, the jobs of a group keep the order. The jobs skipped by handlePreviousDDLJobIfNeed for
+// the schema versions not larger than the ones handled before are dropped, so they're still skipped
+// though the groups are replayed separately.
+func groupJobsBySchema(jobs []*model.Job) [][]*model.Job {
+	var (
+		groups      = newJobGroups()
+		tableSchema = make(map[int64]int64)
+		keys        = make([]string, 0, len(jobs))
+		kept        = make([]*model.Job, 0, len(jobs))
+		current     int64
+	)
+	for _, job := range jobs {
+		if job.BinlogInfo.SchemaVersion <= current {
+			continue
+		}
+		if !skipJob(job) && !(job.SchemaState == model.StateDeleteOnly && job.Type == model.ActionDropColumn) {
+			current = job.BinlogInfo.SchemaVersion
+		}
+
+		key := schemaIDKey(job.SchemaID)
+		switch job.Type {
+		case model.ActionCreateSchema, model.ActionModifySchemaCharsetAndCollate:
+			if db := job.BinlogInfo.DBInfo; db != nil {
+				key = schemaIDKey(db.ID)
+				groups.union(key, "name:"+db.Name.O)
+			}
+		case model.ActionRenameTable:
+			// the table may be renamed from another schema
+			if old, ok := tableSchema[job.TableID]; ok {
+				groups.union(key, schemaIDKey(old))
+			}
+		case actionRenameTables:
+			// so may the tables renamed together, all of their schemas are replayed in order
+			var oldSchemaIDs, newSchemaIDs []int64
+			if err := json.Unmarshal(job.RawArgs, &[]interface{}{&oldSchemaIDs, &newSchemaIDs}); err == nil {
+				for _, id := range append(oldSchemaIDs, newSchemaIDs...) {
+					groups.union(key, schemaIDKey(id))
+				}
+			}
+		}
+		if table := job.BinlogInfo.TableInfo; table != nil {
+			tableSchema[table.ID] = job.SchemaID
+		}
+		keys = append(keys, key)
+		kept = append(kept, job)
+	}
+
+	var result [][]*model.Job
+	groupIdx := make(map[string]int)
+	for i, job := range kept {
+		root := groups.find(keys[i])
+		idx, ok := groupIdx[root]
+		if !ok {
+			idx = len(result)
+			groupIdx[root] = idx
+			result = append(result, nil)
+		}
+		result[idx] = append(result[idx], job)
+	}
+	return result
+}
+
+func schemaIDKey(id int64) string {
+	return fmt.Sprintf("id:%d", id)
+}
+
+// jobGroups is the union-find set of the keys of the schemas
+type jobGroups struct {
+	parent map[string]string
+}
+
+func newJobGroups() *jobGroups {
+	return &jobGroups{parent: make(map[string]string)}
+}
+
+func (g *jobGroups) find(key string) string {
+	parent, ok := g.parent[key]
+	if !ok {
+		g.parent[key] = key
+		return key
+	}
+	if parent == key {
+		return key
+	}
+	root := g.find(parent)
+	g.parent[key] = root
+	return root
+}
+
+func (g *jobGroups) union(a, b string) {
+	ra, rb := g.find(a), g.find(b)
+	if ra != rb {
+		g.parent[rb] = ra
+	}
+}
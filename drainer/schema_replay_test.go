@@ -0,0 +1,224 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+)
+
+type schemaReplaySuite struct{}
+
+var _ = Suite(&schemaReplaySuite{})
+
+// multiSchemaJobs creates the DDL history of schemas db0...db(n-1), every one of them creates tables
+// t1 and t2, adds a column to t1, truncates t2 and drops t1. Then db0 is dropped and created again,
+// and a table is renamed from db1 to db2, so db1 and db2 depend on each other.
+// The schema versions of the schemas interleave like they're changed concurrently in upstream.
+func multiSchemaJobs(n int) []*model.Job {
+	var (
+		jobs    []*model.Job
+		version int64
+	)
+	add := func(job *model.Job) {
+		version++
+		job.ID = version
+		job.State = model.JobStateDone
+		job.BinlogInfo.SchemaVersion = version
+		jobs = append(jobs, job)
+	}
+	dbID := func(i int) int64 { return int64(i+1) * 100 }
+	tableID := func(i int, t int64) int64 { return dbID(i) + t }
+	newDB := func(id int64, name string) *model.Job {
+		return &model.Job{
+			SchemaID:   id,
+			Type:       model.ActionCreateSchema,
+			BinlogInfo: &model.HistoryInfo{DBInfo: &model.DBInfo{ID: id, Name: model.NewCIStr(name), State: model.StatePublic}},
+			Query:      "create database " + name,
+		}
+	}
+	newTableJob := func(i int, tp model.ActionType, id int64, tableInfo *model.TableInfo, query string) *model.Job {
+		return &model.Job{
+			SchemaID:   dbID(i),
+			TableID:    id,
+			Type:       tp,
+			BinlogInfo: &model.HistoryInfo{TableInfo: tableInfo},
+			Query:      query,
+		}
+	}
+	table := func(id int64, name string) *model.TableInfo {
+		return &model.TableInfo{ID: id, Name: model.NewCIStr(name), PKIsHandle: true}
+	}
+
+	for i := 0; i < n; i++ {
+		add(newDB(dbID(i), fmt.Sprintf("db%d", i)))
+	}
+	for i := 0; i < n; i++ {
+		add(newTableJob(i, model.ActionCreateTable, tableID(i, 1), table(tableID(i, 1), "t1"), "create table t1(id int)"))
+	}
+	for i := 0; i < n; i++ {
+		add(newTableJob(i, model.ActionCreateTable, tableID(i, 2), table(tableID(i, 2), "t2"), "create table t2(id int)"))
+	}
+	for i := 0; i < n; i++ {
+		add(newTableJob(i, model.ActionAddColumn, tableID(i, 1), table(tableID(i, 1), "t1"), "alter table t1 add column a int"))
+	}
+	for i := 0; i < n; i++ {
+		add(newTableJob(i, model.ActionTruncateTable, tableID(i, 2), table(tableID(i, 3), "t2"), "truncate table t2"))
+	}
+	for i := 0; i < n; i++ {
+		add(newTableJob(i, model.ActionDropTable, tableID(i, 1), nil, "drop table t1"))
+	}
+
+	// the cancelled job and the one of the version handled already are skipped
+	add(&model.Job{SchemaID: dbID(0), Type: model.ActionCreateTable, BinlogInfo: &model.HistoryInfo{}, Query: "create table t9(id int)"})
+	jobs[len(jobs)-1].State = model.JobStateCancelled
+	dup := newTableJob(n-1, model.ActionDropTable, tableID(n-1, 1), nil, "drop table t1")
+	dup.ID, dup.State, dup.BinlogInfo.SchemaVersion = version-1, model.JobStateDone, version-1
+	jobs = append(jobs, dup)
+
+	add(&model.Job{SchemaID: dbID(0), Type: model.ActionDropSchema, BinlogInfo: &model.HistoryInfo{}, Query: "drop database db0"})
+	add(newDB(dbID(n), "db0"))
+	add(&model.Job{SchemaID: dbID(n), TableID: tableID(n, 1), Type: model.ActionCreateTable,
+		BinlogInfo: &model.HistoryInfo{TableInfo: table(tableID(n, 1), "t1")}, Query: "create table t1(id int)"})
+	add(newTableJob(2, model.ActionRenameTable, tableID(1, 3), table(tableID(1, 3), "t3"), "rename table db1.t2 to db2.t3"))
+	return jobs
+}
+
+func (t *schemaReplaySuite) TestGroupJobsBySchema(c *C) {
+	groups := groupJobsBySchema(multiSchemaJobs(4))
+	c.Assert(groups, HasLen, 3)
+
+	names := func(jobs []*model.Job) []int64 {
+		ids := make(map[int64]struct{})
+		var schemaIDs []int64
+		for _, job := range jobs {
+			if _, ok := ids[job.SchemaID]; !ok {
+				ids[job.SchemaID] = struct{}{}
+				schemaIDs = append(schemaIDs, job.SchemaID)
+			}
+		}
+		return schemaIDs
+	}
+	// db0 and the db0 created again, db1 and db2 renaming tables, and db3
+	c.Assert(names(groups[0]), DeepEquals, []int64{100, 500})
+	c.Assert(names(groups[1]), DeepEquals, []int64{200, 300})
+	c.Assert(names(groups[2]), DeepEquals, []int64{400})
+	for _, group := range groups {
+		for i := 1; i < len(group); i++ {
+			c.Assert(group[i-1].BinlogInfo.SchemaVersion < group[i].BinlogInfo.SchemaVersion, IsTrue)
+		}
+	}
+	c.Assert(len(groups[0])+len(groups[1])+len(groups[2]), Equals, len(multiSchemaJobs(4))-1)
+
+	// the schemas of the tables renamed together depend on each other
+	jobs := multiSchemaJobs(4)
+	jobs = append(jobs, &model.Job{ID: 100, State: model.JobStateDone, SchemaID: 400, TableID: 402, Type: actionRenameTables,
+		RawArgs:    []byte(`[[400,300],[500,300],[{"O":"t2","L":"t2"},{"O":"t4","L":"t4"}],[403,302],[]]`),
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 100}, Query: "rename table db3.t2 to db0.t2, db2.t2 to db2.t4"})
+	groups = groupJobsBySchema(jobs)
+	c.Assert(groups, HasLen, 1)
+	c.Assert(names(groups[0]), DeepEquals, []int64{100, 200, 300, 400, 500})
+}
+
+func (t *schemaReplaySuite) TestReplayConcurrently(c *C) {
+	replay := func(workers int, version int64) *Schema {
+		schema, err := NewSchema(multiSchemaJobs(8), false)
+		c.Assert(err, IsNil)
+		schema.replayWorkers = workers
+		c.Assert(schema.handlePreviousDDLJobIfNeed(version), IsNil)
+		return schema
+	}
+
+	for _, version := range []int64{20, 1000} {
+		expected := replay(1, version)
+		for _, workers := range []int{2, 4, 16} {
+			schema := replay(workers, version)
+			c.Assert(schema.CurrentVersion(), Equals, expected.CurrentVersion())
+			c.Assert(schema.TrackedTables(), DeepEquals, expected.TrackedTables())
+			c.Assert(schema.schemaNameToID, DeepEquals, expected.schemaNameToID)
+			c.Assert(schema.tableIDToName, DeepEquals, expected.tableIDToName)
+			c.Assert(schema.truncateTableID, DeepEquals, expected.truncateTableID)
+			c.Assert(schema.version2SchemaTable, DeepEquals, expected.version2SchemaTable)
+			c.Assert(schema.version2Renames, DeepEquals, expected.version2Renames)
+			c.Assert(schema.tableHistory, DeepEquals, expected.tableHistory)
+			c.Assert(schema.jobs, HasLen, len(expected.jobs))
+		}
+	}
+
+	schema := replay(4, 1000)
+	c.Assert(schema.CurrentVersion(), Equals, int64(53))
+	c.Assert(schema.schemaNameToID["db0"], Equals, int64(900))
+	_, ok := schema.TableByID(103)
+	c.Assert(ok, IsFalse)
+	tracked := schema.TrackedTables()
+	c.Assert(tracked, HasLen, 8)
+	c.Assert(tracked[0], DeepEquals, TrackedTable{Schema: "db0", Table: "t1", ID: 901, Version: 52})
+	c.Assert(tracked[2], DeepEquals, TrackedTable{Schema: "db2", Table: "t3", ID: 203, Version: 53})
+
+	// the jobs after are replayed sequentially
+	schema = replay(4, 20)
+	c.Assert(schema.CurrentVersion(), Equals, int64(20))
+	c.Assert(schema.handlePreviousDDLJobIfNeed(1000), IsNil)
+	c.Assert(schema.TrackedTables(), DeepEquals, tracked)
+}
+
+func (t *schemaReplaySuite) TestReplayGroupsInParallel(c *C) {
+	origReplayJobGroup := replayJobGroup
+	defer func() {
+		replayJobGroup = origReplayJobGroup
+	}()
+
+	// every group waits for all of them to start, so it's only done if they're replayed in parallel,
+	// and it takes about the time of one group instead of the sum of all
+	const groups = 3
+	var (
+		mu      sync.Mutex
+		started int
+		all     = make(chan struct{})
+	)
+	replayJobGroup = func(s *Schema, version int64) error {
+		mu.Lock()
+		started++
+		if started == groups {
+			close(all)
+		}
+		mu.Unlock()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+			c.Error("the groups are not replayed in parallel")
+		}
+		return origReplayJobGroup(s, version)
+	}
+
+	schema, err := NewSchema(multiSchemaJobs(4), false)
+	c.Assert(err, IsNil)
+	schema.replayWorkers = groups
+	c.Assert(schema.handlePreviousDDLJobIfNeed(1000), IsNil)
+	c.Assert(started, Equals, groups)
+	c.Assert(schema.TrackedTables(), HasLen, 4)
+
+	// the failure of a group fails the replay
+	replayJobGroup = origReplayJobGroup
+	jobs := multiSchemaJobs(4)
+	jobs[0].Query = ""
+	schema, err = NewSchema(jobs, false)
+	c.Assert(err, IsNil)
+	schema.replayWorkers = groups
+	c.Assert(schema.handlePreviousDDLJobIfNeed(1000), ErrorMatches, "(?s).*ddl job sql miss.*")
+}
@@ -14,13 +14,20 @@
 package drainer
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
 	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	pb "github.com/pingcap/tipb/go-binlog"
 )
 
 type schemaSuite struct{}
@@ -385,6 +392,232 @@ func (t *schemaSuite) TestHandleDDL(c *C) {
 	}
 }
 
+func (t *schemaSuite) TestHandleSequenceDDL(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	dbInfo := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	job := &model.Job{
+		ID:         1,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		Type:       model.ActionCreateSchema,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, DBInfo: dbInfo},
+		Query:      "create database test",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "")
+
+	// TiDB stores the sequence as a table
+	seqInfo := &model.TableInfo{ID: 2, Name: model.NewCIStr("seq"), State: model.StatePublic}
+	job = &model.Job{
+		ID:         2,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       actionCreateSequence,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2, TableInfo: seqInfo},
+		Query:      "create sequence seq start with 3",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "seq")
+	_, ok := schema.TableByID(seqInfo.ID)
+	c.Assert(ok, IsTrue)
+
+	job = &model.Job{
+		ID:         3,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionType(35), // ALTER SEQUENCE
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 3, TableInfo: seqInfo},
+		Query:      "alter sequence seq restart",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "seq")
+
+	job = &model.Job{
+		ID:         4,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       actionDropSequence,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 4},
+		Query:      "drop sequence seq",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "seq")
+	_, ok = schema.TableByID(seqInfo.ID)
+	c.Assert(ok, IsFalse)
+}
+
+func (t *schemaSuite) TestRenameTablesAcrossSchemas(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	for i, name := range []string{"a", "b"} {
+		job := &model.Job{
+			ID:         int64(i + 1),
+			State:      model.JobStateDone,
+			SchemaID:   int64(i + 1),
+			Type:       model.ActionCreateSchema,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: int64(i + 1), DBInfo: &model.DBInfo{ID: int64(i + 1), Name: model.NewCIStr(name)}},
+			Query:      "create database " + name,
+		}
+		testDoDDLAndCheck(c, schema, job, false, job.Query, name, "")
+	}
+	for i, name := range []string{"t1", "t2"} {
+		job := &model.Job{
+			ID:         int64(i + 3),
+			State:      model.JobStateDone,
+			SchemaID:   1,
+			TableID:    int64(i + 10),
+			Type:       model.ActionCreateTable,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: int64(i + 3), TableInfo: &model.TableInfo{ID: int64(i + 10), Name: model.NewCIStr(name)}},
+			Query:      "create table " + name + " (id int)",
+		}
+		testDoDDLAndCheck(c, schema, job, false, job.Query, "a", name)
+	}
+
+	// the table is renamed to another schema
+	job := &model.Job{
+		ID:         5,
+		State:      model.JobStateDone,
+		SchemaID:   2,
+		TableID:    10,
+		Type:       model.ActionRenameTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 5, TableInfo: &model.TableInfo{ID: 10, Name: model.NewCIStr("r1")}},
+		Query:      "rename table a.t1 to b.r1",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "b", "r1")
+	c.Assert(schema.tableIDToName[10], Equals, TableName{Schema: "b", Table: "r1"})
+	renames, ok := schema.getRenamesAndDelete(5)
+	c.Assert(ok, IsTrue)
+	c.Assert(renames, DeepEquals, []tableRename{{From: TableName{Schema: "a", Table: "t1"}, To: TableName{Schema: "b", Table: "r1"}}})
+	_, ok = schema.getRenamesAndDelete(5)
+	c.Assert(ok, IsFalse)
+
+	// the tables are swapped back and renamed together, the binlog info carries no table info of them
+	args, err := json.Marshal([]interface{}{
+		[]int64{2, 1},
+		[]int64{1, 2},
+		[]*model.CIStr{{O: "t1", L: "t1"}, {O: "x2", L: "x2"}},
+		[]int64{10, 11},
+		[]*model.CIStr{{O: "b", L: "b"}, {O: "a", L: "a"}},
+	})
+	c.Assert(err, IsNil)
+	job = &model.Job{
+		ID:         6,
+		State:      model.JobStateDone,
+		SchemaID:   2,
+		TableID:    10,
+		Type:       actionRenameTables,
+		RawArgs:    args,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 6},
+		Query:      "rename table b.r1 to a.t1, a.t2 to b.x2",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "a", "t1")
+	renames, ok = schema.getRenamesAndDelete(6)
+	c.Assert(ok, IsTrue)
+	c.Assert(renames, DeepEquals, []tableRename{
+		{From: TableName{Schema: "b", Table: "r1"}, To: TableName{Schema: "a", Table: "t1"}},
+		{From: TableName{Schema: "a", Table: "t2"}, To: TableName{Schema: "b", Table: "x2"}},
+	})
+	c.Assert(schema.tableIDToName[10], Equals, TableName{Schema: "a", Table: "t1"})
+	c.Assert(schema.tableIDToName[11], Equals, TableName{Schema: "b", Table: "x2"})
+	table, ok := schema.TableByID(11)
+	c.Assert(ok, IsTrue)
+	c.Assert(table.Name.O, Equals, "x2")
+	db, ok := schema.SchemaByTableID(11)
+	c.Assert(ok, IsTrue)
+	c.Assert(db.Name.O, Equals, "b")
+	c.Assert(schema.TrackedTables(), HasLen, 2)
+
+	// the table renamed must be tracked
+	job.ID, job.BinlogInfo.SchemaVersion, job.RawArgs = 7, 7, []byte(`[[1],[2],[{"O":"y","L":"y"}],[12],[{"O":"a","L":"a"}]]`)
+	_, _, _, err = schema.handleDDL(job)
+	c.Assert(err, ErrorMatches, "table 12 not found")
+}
+
+func (t *schemaSuite) TestTemporaryTables(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	job := &model.Job{
+		ID:         1,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		Type:       model.ActionCreateSchema,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, DBInfo: &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}},
+		Query:      "create database test",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "")
+	_, ok := schema.getTemporaryTableAndDelete(1)
+	c.Assert(ok, IsFalse)
+
+	queries := map[string]string{
+		"t":    "create table t (id int)",
+		"tmp":  "create temporary table tmp (id int)",
+		"gtmp": "create global temporary table gtmp (id int) on commit delete rows",
+	}
+	for i, name := range []string{"t", "tmp", "gtmp"} {
+		job := &model.Job{
+			ID:         int64(i + 2),
+			State:      model.JobStateDone,
+			SchemaID:   1,
+			TableID:    int64(i + 10),
+			Type:       model.ActionCreateTable,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: int64(i + 2), TableInfo: &model.TableInfo{ID: int64(i + 10), Name: model.NewCIStr(name)}},
+			Query:      queries[name],
+		}
+		testDoDDLAndCheck(c, schema, job, false, job.Query, "test", name)
+	}
+	_, ok = schema.TemporaryTableKind(10)
+	c.Assert(ok, IsFalse)
+	_, ok = schema.getTemporaryTableAndDelete(2)
+	c.Assert(ok, IsFalse)
+	for id, expected := range map[int64]string{11: localTemporaryTable, 12: globalTemporaryTable} {
+		kind, ok := schema.TemporaryTableKind(id)
+		c.Assert(ok, IsTrue)
+		c.Assert(kind, Equals, expected)
+		kind, ok = schema.getTemporaryTableAndDelete(id - 8)
+		c.Assert(ok, IsTrue)
+		c.Assert(kind, Equals, expected)
+	}
+
+	// the global temporary table keeps the kind after truncated, with a new table id
+	job = &model.Job{
+		ID:         5,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    12,
+		Type:       model.ActionTruncateTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 5, TableInfo: &model.TableInfo{ID: 13, Name: model.NewCIStr("gtmp")}},
+		Query:      "truncate table gtmp",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "gtmp")
+	_, ok = schema.TemporaryTableKind(12)
+	c.Assert(ok, IsFalse)
+	kind, ok := schema.TemporaryTableKind(13)
+	c.Assert(ok, IsTrue)
+	c.Assert(kind, Equals, globalTemporaryTable)
+	kind, ok = schema.getTemporaryTableAndDelete(5)
+	c.Assert(ok, IsTrue)
+	c.Assert(kind, Equals, globalTemporaryTable)
+
+	job = &model.Job{
+		ID:         6,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    13,
+		Type:       model.ActionDropTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 6},
+		Query:      "drop table gtmp",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "gtmp")
+	_, ok = schema.TemporaryTableKind(13)
+	c.Assert(ok, IsFalse)
+	kind, ok = schema.getTemporaryTableAndDelete(6)
+	c.Assert(ok, IsTrue)
+	c.Assert(kind, Equals, globalTemporaryTable)
+}
+
 func (t *schemaSuite) TestAddImplicitColumn(c *C) {
 	tbl := model.TableInfo{}
 
@@ -392,6 +625,8 @@ func (t *schemaSuite) TestAddImplicitColumn(c *C) {
 
 	c.Assert(tbl.Columns, HasLen, 1)
 	c.Assert(tbl.Columns[0].ID, Equals, int64(implicitColID))
+	// it's written to downstream like other columns
+	c.Assert(tbl.Columns[0].State, Equals, model.StatePublic)
 	c.Assert(tbl.Indices, HasLen, 1)
 	c.Assert(tbl.Indices[0].Primary, IsTrue)
 }
@@ -405,3 +640,353 @@ func testDoDDLAndCheck(c *C, schema *Schema, job *model.Job, isErr bool, sql str
 	c.Assert(schemaName, Equals, expectedSchema)
 	c.Assert(tableName, Equals, expectedTable)
 }
+
+func (t *schemaSuite) TestTableByIDAndVersion(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	dbInfo := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	job := &model.Job{
+		ID:         1,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		Type:       model.ActionCreateSchema,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, DBInfo: dbInfo},
+		Query:      "create database test",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "")
+
+	longType := *types.NewFieldType(mysql.TypeLonglong)
+	idCol := &model.ColumnInfo{ID: 1, Name: model.NewCIStr("id"), FieldType: longType, State: model.StatePublic}
+	aCol := &model.ColumnInfo{ID: 2, Name: model.NewCIStr("a"), FieldType: longType, State: model.StatePublic}
+	bCol := &model.ColumnInfo{ID: 3, Name: model.NewCIStr("b"), FieldType: longType, State: model.StatePublic}
+	tblV2 := &model.TableInfo{ID: 2, Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{idCol, aCol}}
+	job = &model.Job{
+		ID:         2,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionCreateTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2, TableInfo: tblV2},
+		Query:      "create table t(id bigint, a bigint)",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+
+	tblV3 := &model.TableInfo{ID: 2, Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{idCol, aCol, bCol}}
+	job = &model.Job{
+		ID:         3,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionAddColumn,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 3, TableInfo: tblV3},
+		Query:      "alter table t add column b bigint",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+
+	info, ok := schema.TableByIDAndVersion(2, 2)
+	c.Assert(ok, IsTrue)
+	c.Assert(info, Equals, tblV2)
+	// the table isn't changed by the DDLs after version 3
+	info, ok = schema.TableByIDAndVersion(2, 10)
+	c.Assert(ok, IsTrue)
+	c.Assert(info, Equals, tblV3)
+	// no DDL of the table is handled before version 2, use the current one
+	info, ok = schema.TableByIDAndVersion(2, 1)
+	c.Assert(ok, IsTrue)
+	c.Assert(info, Equals, tblV3)
+
+	// the rows written before the column is added are decoded with the old table info
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	oldRow, err := tablecodec.EncodeRow(sc, types.MakeDatums(int64(1), int64(10)), []int64{1, 2}, nil, nil)
+	c.Assert(err, IsNil)
+	newRow, err := tablecodec.EncodeRow(sc, types.MakeDatums(int64(1), int64(11)), []int64{1, 2}, nil, nil)
+	c.Assert(err, IsNil)
+	pv := &pb.PrewriteValue{
+		SchemaVersion: 2,
+		Mutations: []pb.TableMutation{{
+			TableId:     2,
+			UpdatedRows: [][]byte{append(oldRow, newRow...)},
+			Sequence:    []pb.MutationType{pb.MutationType_Update},
+		}},
+	}
+	binlog := &pb.Binlog{StartTs: 4, CommitTs: 5}
+	txn, err := translator.TiBinlogToTxn(schema, "", "", binlog, pv, time.Local)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs, HasLen, 1)
+	c.Assert(txn.DMLs[0].OldValues, DeepEquals, map[string]interface{}{"id": int64(1), "a": int64(10)})
+	c.Assert(txn.DMLs[0].Values, DeepEquals, map[string]interface{}{"id": int64(1), "a": int64(11)})
+
+	// the row doesn't match the columns of the current table info
+	pv.SchemaVersion = 3
+	_, err = translator.TiBinlogToTxn(schema, "", "", binlog, pv, time.Local)
+	c.Assert(err, ErrorMatches, ".*row data is corrupted.*")
+
+	job = &model.Job{
+		ID:         4,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionDropTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 4},
+		Query:      "drop table t",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+	_, ok = schema.TableByIDAndVersion(2, 4)
+	c.Assert(ok, IsFalse)
+	info, ok = schema.TableByIDAndVersion(2, 3)
+	c.Assert(ok, IsTrue)
+	c.Assert(info, Equals, tblV3)
+}
+
+func (t *schemaSuite) TestModifyColumnType(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	dbInfo := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	job := &model.Job{
+		ID:         1,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		Type:       model.ActionCreateSchema,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, DBInfo: dbInfo},
+		Query:      "create database test",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "")
+
+	idCol := &model.ColumnInfo{ID: 1, Name: model.NewCIStr("id"), FieldType: *types.NewFieldType(mysql.TypeLonglong), State: model.StatePublic}
+	aCol := &model.ColumnInfo{ID: 2, Name: model.NewCIStr("a"), FieldType: *types.NewFieldType(mysql.TypeLong), State: model.StatePublic}
+	tbl := &model.TableInfo{ID: 2, Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{idCol, aCol}}
+	job = &model.Job{
+		ID:         2,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionCreateTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2, TableInfo: tbl},
+		Query:      "create table t(id bigint, a int)",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+
+	// change the type of column a to varchar
+	varcharType := types.NewFieldType(mysql.TypeVarchar)
+	varcharType.Flen = 20
+	modifiedCol := &model.ColumnInfo{ID: 2, Name: model.NewCIStr("a"), FieldType: *varcharType, State: model.StatePublic}
+	modified := &model.TableInfo{ID: 2, Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{idCol, modifiedCol}}
+	job = &model.Job{
+		ID:         3,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionModifyColumn,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 3, TableInfo: modified},
+		Query:      "alter table t modify column a varchar(20)",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+
+	info, ok := schema.TableByID(2)
+	c.Assert(ok, IsTrue)
+	c.Assert(info.Columns[1].Tp, Equals, mysql.TypeVarchar)
+
+	// the DML after the DDL is decoded with the new column type
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(1))
+	c.Assert(err, IsNil)
+	row, err := tablecodec.EncodeRow(sc, types.MakeDatums(int64(1), "abc"), []int64{1, 2}, nil, nil)
+	c.Assert(err, IsNil)
+	pv := &pb.PrewriteValue{
+		SchemaVersion: 3,
+		Mutations: []pb.TableMutation{{
+			TableId:      2,
+			InsertedRows: [][]byte{append(handle, row...)},
+			Sequence:     []pb.MutationType{pb.MutationType_Insert},
+		}},
+	}
+	txn, err := translator.TiBinlogToTxn(schema, "", "", &pb.Binlog{StartTs: 4, CommitTs: 5}, pv, time.Local)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs, HasLen, 1)
+	c.Assert(txn.DMLs[0].Values, DeepEquals, map[string]interface{}{"id": int64(1), "a": []byte("abc")})
+
+	// the DML before the DDL is still decoded with the old column type
+	row, err = tablecodec.EncodeRow(sc, types.MakeDatums(int64(1), int64(10)), []int64{1, 2}, nil, nil)
+	c.Assert(err, IsNil)
+	pv.SchemaVersion = 2
+	pv.Mutations[0].InsertedRows = [][]byte{append(handle, row...)}
+	txn, err = translator.TiBinlogToTxn(schema, "", "", &pb.Binlog{StartTs: 2, CommitTs: 3}, pv, time.Local)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs[0].Values, DeepEquals, map[string]interface{}{"id": int64(1), "a": int64(10)})
+}
+
+func (t *schemaSuite) TestTableHistoryLimit(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	tbl := &model.TableInfo{ID: 1}
+	schema.tables[tbl.ID] = tbl
+	for version := int64(1); version <= maxTableHistory+4; version++ {
+		schema.recordTable(tbl.ID, version)
+	}
+	history := schema.tableHistory[tbl.ID]
+	c.Assert(history, HasLen, maxTableHistory)
+	c.Assert(history[0].version, Equals, int64(5))
+}
+
+// trackedTablesJobs creates database test and tables t1, t2, t3, then adds a column to t1 and drops t3
+func trackedTablesJobs() []*model.Job {
+	dbInfo := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	jobs := []*model.Job{{
+		ID:         1,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		Type:       model.ActionCreateSchema,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, DBInfo: dbInfo},
+		Query:      "create database test",
+	}}
+	for i, name := range []string{"t1", "t2", "t3"} {
+		id := int64(i + 2)
+		jobs = append(jobs, &model.Job{
+			ID:         id,
+			State:      model.JobStateDone,
+			SchemaID:   1,
+			TableID:    id,
+			Type:       model.ActionCreateTable,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: id, TableInfo: &model.TableInfo{ID: id, Name: model.NewCIStr(name)}},
+			Query:      "create table " + name + "(id int)",
+		})
+	}
+	return append(jobs, &model.Job{
+		ID:         5,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionAddColumn,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 5, TableInfo: &model.TableInfo{ID: 2, Name: model.NewCIStr("t1")}},
+		Query:      "alter table t1 add column a int",
+	}, &model.Job{
+		ID:         6,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    4,
+		Type:       model.ActionDropTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 6},
+		Query:      "drop table t3",
+	})
+}
+
+func (t *schemaSuite) TestTrackedTables(c *C) {
+	schema, err := NewSchema(trackedTablesJobs(), false)
+	c.Assert(err, IsNil)
+	c.Assert(schema.TrackedTables(), HasLen, 0)
+
+	c.Assert(schema.handlePreviousDDLJobIfNeed(4), IsNil)
+	c.Assert(schema.CurrentVersion(), Equals, int64(4))
+	c.Assert(schema.TrackedTables(), DeepEquals, []TrackedTable{
+		{Schema: "test", Table: "t1", ID: 2, Version: 2},
+		{Schema: "test", Table: "t2", ID: 3, Version: 3},
+		{Schema: "test", Table: "t3", ID: 4, Version: 4},
+	})
+
+	c.Assert(schema.handlePreviousDDLJobIfNeed(6), IsNil)
+	c.Assert(schema.CurrentVersion(), Equals, int64(6))
+	c.Assert(schema.TrackedTables(), DeepEquals, []TrackedTable{
+		{Schema: "test", Table: "t1", ID: 2, Version: 5},
+		{Schema: "test", Table: "t2", ID: 3, Version: 3},
+	})
+}
+
+func (t *schemaSuite) TestPositionalAddColumn(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+
+	dbInfo := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	job := &model.Job{
+		ID:         1,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		Type:       model.ActionCreateSchema,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 1, DBInfo: dbInfo},
+		Query:      "create database test",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "")
+
+	newColumn := func(id int64, name string, offset int) *model.ColumnInfo {
+		return &model.ColumnInfo{ID: id, Name: model.NewCIStr(name), Offset: offset, FieldType: *types.NewFieldType(mysql.TypeLong), State: model.StatePublic}
+	}
+	tbl := &model.TableInfo{ID: 2, Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{newColumn(1, "id", 0), newColumn(2, "b", 1)}}
+	job = &model.Job{
+		ID:         2,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionCreateTable,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2, TableInfo: tbl},
+		Query:      "create table t(id int, b int)",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+
+	// the column a added after id is at the end of the columns of the job, with the offset of its position
+	added := &model.TableInfo{ID: 2, Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{
+		newColumn(1, "id", 0), newColumn(2, "b", 2), newColumn(3, "a", 1),
+	}}
+	job = &model.Job{
+		ID:         3,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionAddColumn,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 3, TableInfo: added},
+		Query:      "alter table t add column a int after id",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+
+	added = &model.TableInfo{ID: 2, Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{
+		newColumn(4, "c", 0), newColumn(1, "id", 1), newColumn(3, "a", 2), newColumn(2, "b", 3),
+	}}
+	job = &model.Job{
+		ID:         4,
+		State:      model.JobStateDone,
+		SchemaID:   1,
+		TableID:    2,
+		Type:       model.ActionAddColumn,
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 4, TableInfo: added},
+		Query:      "alter table t add column c int first",
+	}
+	testDoDDLAndCheck(c, schema, job, false, job.Query, "test", "t")
+
+	info, ok := schema.TableByID(2)
+	c.Assert(ok, IsTrue)
+	var names []string
+	for i, col := range info.Columns {
+		c.Assert(col.Offset, Equals, i)
+		names = append(names, col.Name.O)
+	}
+	c.Assert(names, DeepEquals, []string{"c", "id", "a", "b"})
+
+	// the DML after the DDL is encoded in the column order of the table
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(1))
+	c.Assert(err, IsNil)
+	row, err := tablecodec.EncodeRow(sc, types.MakeDatums(int64(1), int64(2), int64(3), int64(4)), []int64{1, 2, 3, 4}, nil, nil)
+	c.Assert(err, IsNil)
+	pv := &pb.PrewriteValue{
+		SchemaVersion: 4,
+		Mutations: []pb.TableMutation{{
+			TableId:      2,
+			InsertedRows: [][]byte{append(handle, row...)},
+			Sequence:     []pb.MutationType{pb.MutationType_Insert},
+		}},
+	}
+	slaveBinlog, err := translator.TiBinlogToSlaveBinlog(schema, "", "", &pb.Binlog{StartTs: 4, CommitTs: 5}, pv)
+	c.Assert(err, IsNil)
+	table := slaveBinlog.DmlData.Tables[0]
+	names = names[:0]
+	for _, info := range table.ColumnInfo {
+		names = append(names, info.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"c", "id", "a", "b"})
+	var values []int64
+	for _, col := range table.Mutations[0].Row.Columns {
+		values = append(values, col.GetInt64Value())
+	}
+	c.Assert(values, DeepEquals, []int64{4, 1, 3, 2})
+}
@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -27,6 +28,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
 	"github.com/pingcap/tidb-binlog/pkg/node"
@@ -34,7 +36,6 @@ import (
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store"
 	"github.com/pingcap/tidb/store/tikv"
-	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/pingcap/tipb/go-binlog"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -49,6 +50,15 @@ var (
 	nodePrefix        = "drainers"
 	heartbeatInterval = 1 * time.Second
 	getPdClient       = util.GetPdClient
+
+	// the max time to wait for the checkpoint to be flushed by request
+	flushCheckpointTimeout = 10 * time.Second
+
+	// the backoff before the first retry of loading the history DDL jobs, it doubles every retry
+	schemaBootstrapBackoff = time.Second
+
+	registerTiKVOnce sync.Once
+	registerTiKVErr  error
 )
 
 type drainerKeyType string
@@ -106,6 +116,7 @@ func NewServer(cfg *Config) (*Server, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	ctx = context.WithValue(ctx, drainerKeyType("compressor"), cfg.Compressor)
+	ctx = context.WithValue(ctx, drainerKeyType("pump-tcp-keepalive"), time.Duration(cfg.PumpKeepAlive)*time.Second)
 
 	clusterID := pdCli.GetClusterID(ctx)
 	log.Info("get cluster id from pd", zap.Uint64("id", clusterID))
@@ -116,7 +127,7 @@ func NewServer(cfg *Config) (*Server, error) {
 	}
 	latestTime := time.Now()
 
-	if cfg.InitialCommitTS == -1 {
+	if cfg.InitialCommitTS == -1 || cfg.StartFromNow {
 		log.Info("set InitialCommitTS", zap.Int64("ts", latestTS))
 		cfg.InitialCommitTS = latestTS
 	}
@@ -134,7 +145,14 @@ func NewServer(cfg *Config) (*Server, error) {
 		return nil, errors.Trace(err)
 	}
 
-	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(cp.TS()))))
+	if cfg.StartFromNow {
+		if err := startFromNow(cp, latestTS); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	physical, _ := util.ExtractPhysicalLogical(cp.TS())
+	checkpointTSOGauge.Set(float64(physical))
 
 	syncer, err := createSyncer(cfg.EtcdURLs, cp, cfg.SyncerCfg)
 	if err != nil {
@@ -181,24 +199,63 @@ func NewServer(cfg *Config) (*Server, error) {
 	}, nil
 }
 
+// startFromNow saves ts, the current TSO, to the checkpoint, so the binlogs before it are skipped even if there's a
+// checkpoint saved before. The history DDL jobs are loaded after ts is got to bootstrap the schema, so the schema
+// still includes all the DDLs before it.
+func startFromNow(cp checkpoint.CheckPoint, ts int64) error {
+	if prev := cp.TS(); prev < ts {
+		log.Warn("start from now, the binlogs before it are skipped", zap.Int64("checkpoint", prev), zap.Int64("ts", ts))
+	}
+	return errors.Annotate(cp.Save(ts, 0), "save checkpoint to start from now failed")
+}
+
 func createSyncer(etcdURLs string, cp checkpoint.CheckPoint, cfg *SyncerConfig) (syncer *Syncer, err error) {
-	tiStore, err := createTiStore(etcdURLs)
+	jobs, err := bootstrapSchema(etcdURLs, cfg.SchemaBootstrapMaxAttempts)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	defer tiStore.Close()
 
-	jobs, err := loadHistoryDDLJobs(tiStore)
+	syncer, err = NewSyncer(cp, cfg, jobs)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	syncer, err = NewSyncer(cp, cfg, jobs)
+	return
+}
+
+// loadHistoryDDLJobsFromTiKV connects to TiKV by the PD urls and loads all history DDL jobs
+var loadHistoryDDLJobsFromTiKV = func(etcdURLs string) ([]*model.Job, error) {
+	tiStore, err := createTiStore(etcdURLs)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	defer tiStore.Close()
 
-	return
+	jobs, err := loadHistoryDDLJobs(tiStore)
+	return jobs, errors.Trace(err)
+}
+
+// bootstrapSchema loads the history DDL jobs to build the schema, it retries with backoff on the failures
+// like PD being unavailable temporarily, for at most maxAttempts times.
+func bootstrapSchema(etcdURLs string, maxAttempts int) (jobs []*model.Job, err error) {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	attempt := 0
+	err = util.RetryContext(context.Background(), maxAttempts, schemaBootstrapBackoff, 2, func(context.Context) error {
+		attempt++
+		var loadErr error
+		jobs, loadErr = loadHistoryDDLJobsFromTiKV(etcdURLs)
+		if loadErr != nil {
+			log.Warn("load history ddl jobs failed", zap.Int("attempt", attempt), zap.Int("max attempts", maxAttempts), zap.Error(loadErr))
+		}
+		return loadErr
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "bootstrap schema failed after %d attempts", attempt)
+	}
+	return jobs, nil
 }
 
 // DumpBinlog implements the gRPC interface of drainer server
@@ -388,6 +445,122 @@ func (s *Server) GetLatestTS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// FlushCheckpoint saves the checkpoint immediately, and returns the saved ts.
+func (s *Server) FlushCheckpoint(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+
+	ctx, cancel := context.WithTimeout(r.Context(), flushCheckpointTimeout)
+	defer cancel()
+	ts, err := s.syncer.FlushCheckpoint(ctx)
+	if err != nil {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("flush checkpoint failed: %v", err))
+	} else {
+		log.Info("flush checkpoint by request", zap.Int64("ts", ts))
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse("flush drainer's checkpoint success!", map[string]int64{"ts": ts}))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// SkipTxn adds the txn of the commit ts to skip, the txn isn't synced to downstream and
+// the checkpoint advances past it when it's reached.
+func (s *Server) SkipTxn(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+
+	vars := mux.Vars(r)
+	commitTS, err := strconv.ParseInt(vars["commitTS"], 10, 64)
+	if err != nil || commitTS <= 0 {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("invalid commit ts %s", vars["commitTS"]))
+	} else if cpTS := s.syncer.GetLatestCommitTS(); commitTS <= cpTS {
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("txn %d is already synced, checkpoint ts is %d", commitTS, cpTS))
+	} else {
+		log.Warn("skip txn by request", zap.Int64("commit ts", commitTS))
+		skipTxns := s.syncer.SkipTxn(commitTS)
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse(fmt.Sprintf("skip txn %d success!", commitTS), map[string][]int64{"commit-ts": skipTxns}))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetSkipTxns returns the commit ts of the txns to skip.
+func (s *Server) GetSkipTxns(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	skipTxns := s.syncer.GetSkipTxns()
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get drainer's skipped txns success!", map[string][]int64{"commit-ts": skipTxns}))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// DDLHold turns the DDL hold on or off by action, which is hold or release.
+func (s *Server) DDLHold(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+
+	action := mux.Vars(r)["action"]
+	var err error
+	switch action {
+	case "hold":
+		log.Warn("hold ddl by request")
+		s.syncer.HoldDDL()
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse("hold drainer's ddl success!", nil))
+	case "release":
+		var count int
+		count, err = s.syncer.ReleaseDDL()
+		if err != nil {
+			err = rd.JSON(w, http.StatusOK, util.ErrResponsef("release ddl failed: %v", err))
+			break
+		}
+		log.Info("release ddl by request", zap.Int("held items", count))
+		err = rd.JSON(w, http.StatusOK, util.SuccessResponse("release drainer's ddl success!", map[string]int{"released": count}))
+	default:
+		err = rd.JSON(w, http.StatusOK, util.ErrResponsef("invalid action %s", action))
+	}
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetDDLHold returns whether the DDL hold is on and the commit ts of the held txns.
+func (s *Server) GetDDLHold(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	holding, held := s.syncer.DDLHoldStatus()
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get drainer's ddl hold success!", map[string]interface{}{
+		"holding":   holding,
+		"commit-ts": held,
+	}))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// GetTrackedTables returns the tables tracked in the schema of drainer at the current position,
+// with the schema version of the last DDL changing every table.
+func (s *Server) GetTrackedTables(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	version, tables := s.syncer.TrackedTables()
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get drainer's tracked tables success!", map[string]interface{}{
+		"schema-version": version,
+		"tables":         tables,
+	}))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
 // commitStatus commit the node's last status to pd when close the server.
 func (s *Server) commitStatus() {
 	// update this node
@@ -429,6 +602,12 @@ func (s *Server) initAPIRouter() *mux.Router {
 	router.HandleFunc("/status", s.collector.Status).Methods("GET")
 	router.HandleFunc("/commit_ts", s.GetLatestTS).Methods("GET")
 	router.HandleFunc("/state/{nodeID}/{action}", s.ApplyAction).Methods("PUT")
+	router.HandleFunc("/checkpoint/flush", s.FlushCheckpoint).Methods("POST")
+	router.HandleFunc("/skip_txn", s.GetSkipTxns).Methods("GET")
+	router.HandleFunc("/skip_txn/{commitTS}", s.SkipTxn).Methods("PUT")
+	router.HandleFunc("/ddl_hold", s.GetDDLHold).Methods("GET")
+	router.HandleFunc("/ddl_hold/{action}", s.DDLHold).Methods("PUT")
+	router.HandleFunc("/schema/tables", s.GetTrackedTables).Methods("GET")
 	prometheus.DefaultGatherer = registry
 	router.Handle("/metrics", promhttp.Handler())
 	return router
@@ -469,8 +648,12 @@ func createTiStore(urls string) (kv.Storage, error) {
 		return nil, errors.Trace(err)
 	}
 
-	if err := store.Register("tikv", tikv.Driver{}); err != nil {
-		return nil, errors.Trace(err)
+	// the driver can only be registered once, and the store may be created again on retry
+	registerTiKVOnce.Do(func() {
+		registerTiKVErr = store.Register("tikv", tikv.Driver{})
+	})
+	if registerTiKVErr != nil {
+		return nil, errors.Trace(registerTiKVErr)
 	}
 	tiPath := fmt.Sprintf("tikv://%s?disableGC=true", urlv.HostString())
 	tiStore, err := store.New(tiPath)
@@ -26,7 +26,9 @@ import (
 
 	"github.com/gorilla/mux"
 	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
 	pd "github.com/pingcap/pd/client"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/security"
@@ -68,6 +70,159 @@ func (t *testServerSuite) TestGetLatestTS(c *C) {
 	c.Assert(int64(ts), Equals, int64(1984))
 }
 
+func (t *testServerSuite) TestFlushCheckpoint(c *C) {
+	cpFile := path.Join(c.MkDir(), "checkpoint")
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: cpFile})
+	c.Assert(err, IsNil)
+	syncer := &Syncer{
+		cfg:     &SyncerConfig{},
+		cp:      cp,
+		dsyncer: newHoldSyncer(),
+		window:  newTxnWindow(0),
+		flushes: make(chan *flushRequest),
+		closed:  make(chan struct{}),
+	}
+	// the binlogs before 1984 are synced to downstream, but the checkpoint isn't saved yet
+	lastTS := int64(1984)
+	quit := make(chan struct{})
+	go syncer.handleSuccess(nil, &lastTS, quit)
+	defer close(quit)
+
+	server := Server{syncer: syncer}
+	router := server.initAPIRouter()
+	req := httptest.NewRequest("POST", "/checkpoint/flush", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	body, _ := ioutil.ReadAll(resp.Body)
+	var decoded util.Response
+	err = json.Unmarshal(body, &decoded)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Code, Equals, 200)
+	data, ok := decoded.Data.(map[string]interface{})
+	c.Assert(ok, IsTrue)
+	c.Assert(data["ts"], Equals, float64(1984))
+	c.Assert(cp.TS(), Equals, int64(1984))
+
+	// the checkpoint is persisted
+	c.Assert(cp.Close(), IsNil)
+	cp, err = checkpoint.NewFile(&checkpoint.Config{CheckPointFile: cpFile})
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(1984))
+}
+
+func (t *testServerSuite) TestSkipTxn(c *C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: path.Join(c.MkDir(), "checkpoint")})
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(1984, 0), IsNil)
+	server := Server{syncer: &Syncer{cp: cp, skipTxnCommitTS: []int64{2000}}}
+	router := server.initAPIRouter()
+
+	request := func(method, url string) util.Response {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		resp := w.Result()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+		body, _ := ioutil.ReadAll(resp.Body)
+		var decoded util.Response
+		c.Assert(json.Unmarshal(body, &decoded), IsNil)
+		return decoded
+	}
+
+	resp := request("PUT", "/skip_txn/2019")
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(resp.Data, DeepEquals, map[string]interface{}{"commit-ts": []interface{}{float64(2000), float64(2019)}})
+	c.Assert(server.syncer.isSkipTxn(2019), IsTrue)
+
+	resp = request("GET", "/skip_txn")
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(resp.Data, DeepEquals, map[string]interface{}{"commit-ts": []interface{}{float64(2000), float64(2019)}})
+
+	// the synced txn can't be skipped
+	resp = request("PUT", "/skip_txn/1984")
+	c.Assert(resp.Code, Not(Equals), 200)
+	c.Assert(resp.Message, Matches, ".*already synced.*")
+
+	resp = request("PUT", "/skip_txn/abc")
+	c.Assert(resp.Code, Not(Equals), 200)
+	c.Assert(server.syncer.GetSkipTxns(), DeepEquals, []int64{2000, 2019})
+}
+
+func (t *testServerSuite) TestDDLHold(c *C) {
+	server := Server{syncer: &Syncer{ddlHold: newDDLHold(false)}}
+	router := server.initAPIRouter()
+
+	request := func(method, url string) util.Response {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		resp := w.Result()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+		body, _ := ioutil.ReadAll(resp.Body)
+		var decoded util.Response
+		c.Assert(json.Unmarshal(body, &decoded), IsNil)
+		return decoded
+	}
+
+	resp := request("PUT", "/ddl_hold/release")
+	c.Assert(resp.Code, Not(Equals), 200)
+	c.Assert(resp.Message, Matches, ".*DDL is not on hold.*")
+
+	resp = request("PUT", "/ddl_hold/hold")
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(server.syncer.ddlHold.holdDDL(heldItem(3, "test", "a")), IsTrue)
+	resp = request("GET", "/ddl_hold")
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(resp.Data, DeepEquals, map[string]interface{}{"holding": true, "commit-ts": []interface{}{float64(3)}})
+
+	resp = request("PUT", "/ddl_hold/release")
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(resp.Data, DeepEquals, map[string]interface{}{"released": float64(1)})
+	holding, _ := server.syncer.DDLHoldStatus()
+	c.Assert(holding, IsFalse)
+
+	resp = request("PUT", "/ddl_hold/pause")
+	c.Assert(resp.Code, Not(Equals), 200)
+}
+
+func (t *testServerSuite) TestGetTrackedTables(c *C) {
+	schema, err := NewSchema(trackedTablesJobs(), false)
+	c.Assert(err, IsNil)
+	server := Server{syncer: &Syncer{schema: schema}}
+	router := server.initAPIRouter()
+
+	request := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/schema/tables", nil))
+		resp := w.Result()
+		c.Assert(resp.StatusCode, Equals, http.StatusOK)
+		body, _ := ioutil.ReadAll(resp.Body)
+		var decoded util.Response
+		c.Assert(json.Unmarshal(body, &decoded), IsNil)
+		c.Assert(decoded.Code, Equals, 200)
+		return decoded.Data.(map[string]interface{})
+	}
+	table := func(name string, id, version float64) map[string]interface{} {
+		return map[string]interface{}{"schema": "test", "table": name, "id": id, "version": version}
+	}
+
+	// replay the DDLs like the run loop of syncer
+	c.Assert(schema.handlePreviousDDLJobIfNeed(4), IsNil)
+	server.syncer.refreshTrackedTables()
+	c.Assert(request(), DeepEquals, map[string]interface{}{
+		"schema-version": float64(4),
+		"tables":         []interface{}{table("t1", 2, 2), table("t2", 3, 3), table("t3", 4, 4)},
+	})
+
+	c.Assert(schema.handlePreviousDDLJobIfNeed(6), IsNil)
+	server.syncer.refreshTrackedTables()
+	c.Assert(request(), DeepEquals, map[string]interface{}{
+		"schema-version": float64(6),
+		"tables":         []interface{}{table("t1", 2, 5), table("t2", 3, 3)},
+	})
+}
+
 func (t *testServerSuite) TestNotify(c *C) {
 	server := Server{
 		collector: &Collector{
@@ -352,3 +507,116 @@ func (s *newServerSuite) TestInvalidDestDBType(c *C) {
 	c.Assert(err, ErrorMatches, ".*unknown DestDBType.*")
 	c.Assert(cfg.SyncerCfg.To.ClusterID, Equals, uint64(8012))
 }
+
+func (s *newServerSuite) TestStartFromNow(c *C) {
+	getPdClient = func(etcdURLs string, securityConfig security.Config) (pd.Client, error) {
+		return &mockPdCli{}, nil
+	}
+	origLoad := loadHistoryDDLJobsFromTiKV
+	defer func() {
+		loadHistoryDDLJobsFromTiKV = origLoad
+	}()
+
+	cfg := NewConfig()
+	cfg.DataDir = path.Join(c.MkDir(), "drainer")
+	cfg.ListenAddr = "http://" + cfg.ListenAddr
+	cfg.SyncerCfg.DestDBType = "file"
+	cfg.StartFromNow = true
+	c.Assert(cfg.adjustConfig(), IsNil)
+	cfg.SyncerCfg.SchemaBootstrapMaxAttempts = 1
+
+	// there's a checkpoint saved before
+	c.Assert(os.MkdirAll(cfg.DataDir, 0700), IsNil)
+	cpCfg := &checkpoint.Config{CheckpointType: "file", CheckPointFile: path.Join(cfg.DataDir, "savepoint")}
+	cp, err := checkpoint.NewCheckPoint(cpCfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(100, 0), IsNil)
+	c.Assert(cp.Close(), IsNil)
+
+	// the schema is still bootstrapped from the history DDL jobs, after the checkpoint is saved
+	now := int64(112233)<<18 + 12
+	var savedTS int64
+	loadHistoryDDLJobsFromTiKV = func(etcdURLs string) ([]*model.Job, error) {
+		cp, err := checkpoint.NewCheckPoint(cpCfg)
+		c.Assert(err, IsNil)
+		savedTS = cp.TS()
+		c.Assert(cp.Close(), IsNil)
+		return nil, errors.New("stop here")
+	}
+	_, err = NewServer(cfg)
+	c.Assert(err, ErrorMatches, ".*stop here.*")
+	c.Assert(cfg.InitialCommitTS, Equals, now)
+	c.Assert(savedTS, Equals, now)
+}
+
+func (s *newServerSuite) TestStartFromNowWithoutCheckpoint(c *C) {
+	cpCfg := &checkpoint.Config{CheckpointType: "file", CheckPointFile: path.Join(c.MkDir(), "savepoint"), InitialCommitTS: 2000}
+	cp, err := checkpoint.NewCheckPoint(cpCfg)
+	c.Assert(err, IsNil)
+	c.Assert(startFromNow(cp, 2000), IsNil)
+	c.Assert(cp.Close(), IsNil)
+
+	// the ts is recorded in the checkpoint, so it's not lost if drainer restarts without any binlog synced
+	cpCfg.InitialCommitTS = 0
+	cp, err = checkpoint.NewCheckPoint(cpCfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(2000))
+	c.Assert(cp.Close(), IsNil)
+}
+
+type bootstrapSchemaSuite struct {
+	origLoad    func(string) ([]*model.Job, error)
+	origBackoff time.Duration
+}
+
+var _ = Suite(&bootstrapSchemaSuite{})
+
+func (s *bootstrapSchemaSuite) SetUpTest(c *C) {
+	s.origLoad = loadHistoryDDLJobsFromTiKV
+	s.origBackoff = schemaBootstrapBackoff
+	schemaBootstrapBackoff = time.Millisecond
+}
+
+func (s *bootstrapSchemaSuite) TearDownTest(c *C) {
+	loadHistoryDDLJobsFromTiKV = s.origLoad
+	schemaBootstrapBackoff = s.origBackoff
+}
+
+// failTimes makes loading the history DDL jobs fail n times before it succeeds
+func (s *bootstrapSchemaSuite) failTimes(n int, jobs []*model.Job) *int {
+	var attempts int
+	loadHistoryDDLJobsFromTiKV = func(etcdURLs string) ([]*model.Job, error) {
+		attempts++
+		if attempts <= n {
+			return nil, errors.New("PD is unavailable")
+		}
+		return jobs, nil
+	}
+	return &attempts
+}
+
+func (s *bootstrapSchemaSuite) TestRetryTransientErrors(c *C) {
+	jobs := []*model.Job{{ID: 1}, {ID: 2}}
+	attempts := s.failTimes(2, jobs)
+
+	got, err := bootstrapSchema("http://127.0.0.1:2379", 3)
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, jobs)
+	c.Assert(*attempts, Equals, 3)
+}
+
+func (s *bootstrapSchemaSuite) TestExceedMaxAttempts(c *C) {
+	attempts := s.failTimes(3, nil)
+
+	_, err := bootstrapSchema("http://127.0.0.1:2379", 3)
+	c.Assert(err, ErrorMatches, ".*bootstrap schema failed after 3 attempts.*PD is unavailable.*")
+	c.Assert(*attempts, Equals, 3)
+}
+
+func (s *bootstrapSchemaSuite) TestAttemptAtLeastOnce(c *C) {
+	attempts := s.failTimes(0, nil)
+
+	_, err := bootstrapSchema("http://127.0.0.1:2379", 0)
+	c.Assert(err, IsNil)
+	c.Assert(*attempts, Equals, 1)
+}
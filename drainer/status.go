@@ -27,6 +27,8 @@ type HTTPStatus struct {
 	Synced  bool             `json:"Synced"`
 	LastTS  int64            `json:"LastTS"`
 	TsMap   string           `json:"TsMap"`
+	// state of downstream's circuit breaker, omitted if it's disabled
+	DownstreamBreaker string `json:"DownstreamBreaker,omitempty"`
 }
 
 // Status implements http.ServeHTTP interface
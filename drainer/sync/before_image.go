@@ -0,0 +1,145 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"regexp"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+// TableBeforeImage controls whether the before-image of the rows of the matched tables is written to kafka,
+// the names are matched like replicate-do-table, the name starting with "~" is a regular expression,
+// and the first matched one is used. The before-image of all tables is written by default.
+// Without the before-image, the update events don't carry the old row, and the delete events only carry
+// the primary key columns of the deleted row, or all columns if the table has no primary key.
+type TableBeforeImage struct {
+	Schema  string `toml:"db-name" json:"db-name"`
+	Table   string `toml:"tbl-name" json:"tbl-name"`
+	Include bool   `toml:"include" json:"include"`
+}
+
+type beforeImageRule struct {
+	schema  *regexp.Regexp
+	table   *regexp.Regexp
+	include bool
+}
+
+// beforeImages strips the before-image of the tables excluding it,
+// a nil *beforeImages is valid and keeps the before-image of all tables.
+type beforeImages struct {
+	rules []beforeImageRule
+}
+
+func newBeforeImages(confs []TableBeforeImage) (*beforeImages, error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+
+	b := new(beforeImages)
+	for _, conf := range confs {
+		if len(conf.Schema) == 0 || len(conf.Table) == 0 {
+			return nil, errors.New("empty schema or table name in before-image")
+		}
+		schema, err := filter.CompilePattern(conf.Schema)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid schema pattern %s in before-image", conf.Schema)
+		}
+		table, err := filter.CompilePattern(conf.Table)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %s in before-image", conf.Table)
+		}
+		b.rules = append(b.rules, beforeImageRule{schema: schema, table: table, include: conf.Include})
+	}
+	return b, nil
+}
+
+// include returns whether the before-image of the table is written
+func (b *beforeImages) include(schema string, table string) bool {
+	if b == nil {
+		return true
+	}
+
+	for _, rule := range b.rules {
+		if rule.schema.MatchString(schema) && rule.table.MatchString(table) {
+			return rule.include
+		}
+	}
+	return true
+}
+
+// strip removes the before-image of the rows of the tables excluding it from binlog
+func (b *beforeImages) strip(binlog *obinlog.Binlog) {
+	if b == nil || binlog.DmlData == nil {
+		return
+	}
+
+	for _, table := range binlog.DmlData.Tables {
+		if b.include(table.GetSchemaName(), table.GetTableName()) {
+			continue
+		}
+
+		// the column infos are shared by the mutations of the table, so the columns of the deleted rows
+		// are only stripped if all mutations are deletes, every table carries only one mutation in fact
+		allDeletes := len(table.Mutations) > 0
+		for _, mut := range table.Mutations {
+			switch mut.GetType() {
+			case obinlog.MutationType_Update:
+				mut.ChangeRow = nil
+				allDeletes = false
+			case obinlog.MutationType_Delete:
+			default:
+				allDeletes = false
+			}
+		}
+		if allDeletes {
+			stripDeleteRows(table)
+		}
+	}
+}
+
+// stripDeleteRows only keeps the primary key columns of the deleted rows of the table,
+// the columns of the rows are in the same order as the column infos of the table.
+func stripDeleteRows(table *obinlog.Table) {
+	var keys []int
+	for i, info := range table.ColumnInfo {
+		if info.IsPrimaryKey {
+			keys = append(keys, i)
+		}
+	}
+	if len(keys) == 0 || len(keys) == len(table.ColumnInfo) {
+		return
+	}
+
+	infos := make([]*obinlog.ColumnInfo, 0, len(keys))
+	for _, i := range keys {
+		infos = append(infos, table.ColumnInfo[i])
+	}
+	table.ColumnInfo = infos
+
+	for _, mut := range table.Mutations {
+		if mut.Row == nil {
+			continue
+		}
+		columns := make([]*obinlog.Column, 0, len(keys))
+		for _, i := range keys {
+			if i < len(mut.Row.Columns) {
+				columns = append(columns, mut.Row.Columns[i])
+			}
+		}
+		mut.Row.Columns = columns
+	}
+}
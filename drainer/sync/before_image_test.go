@@ -0,0 +1,112 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"github.com/pingcap/check"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+var _ = check.Suite(&beforeImageSuite{})
+
+type beforeImageSuite struct{}
+
+func newImageRow(values ...int64) *obinlog.Row {
+	row := new(obinlog.Row)
+	for i := range values {
+		row.Columns = append(row.Columns, &obinlog.Column{Int64Value: &values[i]})
+	}
+	return row
+}
+
+func newImageTable(schema string, table string, tp obinlog.MutationType, row *obinlog.Row, changeRow *obinlog.Row) *obinlog.Table {
+	return &obinlog.Table{
+		SchemaName: &schema,
+		TableName:  &table,
+		ColumnInfo: []*obinlog.ColumnInfo{
+			{Name: "a", MysqlType: "int"},
+			{Name: "id", MysqlType: "int", IsPrimaryKey: true},
+			{Name: "b", MysqlType: "int"},
+		},
+		Mutations: []*obinlog.TableMutation{{Type: &tp, Row: row, ChangeRow: changeRow}},
+	}
+}
+
+func (s *beforeImageSuite) TestStripBeforeImage(c *check.C) {
+	images, err := newBeforeImages([]TableBeforeImage{
+		{Schema: "test", Table: "keep", Include: true},
+		{Schema: "test", Table: "~.*"},
+	})
+	c.Assert(err, check.IsNil)
+
+	binlog := &obinlog.Binlog{
+		Type: obinlog.BinlogType_DML,
+		DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{
+			newImageTable("test", "keep", obinlog.MutationType_Update, newImageRow(1, 2, 3), newImageRow(1, 2, 4)),
+			newImageTable("test", "strip", obinlog.MutationType_Update, newImageRow(1, 2, 3), newImageRow(1, 2, 4)),
+			newImageTable("test", "keep", obinlog.MutationType_Delete, newImageRow(1, 2, 3), nil),
+			newImageTable("test", "strip", obinlog.MutationType_Delete, newImageRow(1, 2, 3), nil),
+			newImageTable("other", "t", obinlog.MutationType_Delete, newImageRow(1, 2, 3), nil),
+		}},
+	}
+	images.strip(binlog)
+	tables := binlog.DmlData.Tables
+
+	c.Assert(tables[0].Mutations[0].ChangeRow, check.DeepEquals, newImageRow(1, 2, 4))
+	c.Assert(tables[0].Mutations[0].Row, check.DeepEquals, newImageRow(1, 2, 3))
+	c.Assert(tables[1].Mutations[0].ChangeRow, check.IsNil)
+	c.Assert(tables[1].Mutations[0].Row, check.DeepEquals, newImageRow(1, 2, 3))
+	c.Assert(tables[1].ColumnInfo, check.HasLen, 3)
+
+	c.Assert(tables[2].ColumnInfo, check.HasLen, 3)
+	c.Assert(tables[2].Mutations[0].Row, check.DeepEquals, newImageRow(1, 2, 3))
+	// only the primary key of the deleted row is kept
+	c.Assert(tables[3].ColumnInfo, check.HasLen, 1)
+	c.Assert(tables[3].ColumnInfo[0].Name, check.Equals, "id")
+	c.Assert(tables[3].Mutations[0].Row, check.DeepEquals, newImageRow(2))
+	// the tables not matched keep the before-image
+	c.Assert(tables[4].ColumnInfo, check.HasLen, 3)
+	c.Assert(tables[4].Mutations[0].Row, check.DeepEquals, newImageRow(1, 2, 3))
+
+	// DDL binlogs are not touched
+	images.strip(&obinlog.Binlog{Type: obinlog.BinlogType_DDL})
+}
+
+func (s *beforeImageSuite) TestStripDeleteWithoutPrimaryKey(c *check.C) {
+	images, err := newBeforeImages([]TableBeforeImage{{Schema: "test", Table: "t"}})
+	c.Assert(err, check.IsNil)
+
+	table := newImageTable("test", "t", obinlog.MutationType_Delete, newImageRow(1, 2, 3), nil)
+	table.ColumnInfo[1].IsPrimaryKey = false
+	images.strip(&obinlog.Binlog{DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{table}}})
+	// all columns are needed to identify the deleted row
+	c.Assert(table.ColumnInfo, check.HasLen, 3)
+	c.Assert(table.Mutations[0].Row, check.DeepEquals, newImageRow(1, 2, 3))
+}
+
+func (s *beforeImageSuite) TestDefaultBeforeImage(c *check.C) {
+	images, err := newBeforeImages(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(images, check.IsNil)
+	c.Assert(images.include("test", "t"), check.IsTrue)
+
+	table := newImageTable("test", "t", obinlog.MutationType_Update, newImageRow(1, 2, 3), newImageRow(1, 2, 4))
+	images.strip(&obinlog.Binlog{DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{table}}})
+	c.Assert(table.Mutations[0].ChangeRow, check.DeepEquals, newImageRow(1, 2, 4))
+
+	_, err = newBeforeImages([]TableBeforeImage{{Schema: "test"}})
+	c.Assert(err, check.ErrorMatches, "empty schema or table name in before-image")
+	_, err = newBeforeImages([]TableBeforeImage{{Schema: "test", Table: "~("}})
+	c.Assert(err, check.ErrorMatches, "invalid table pattern.*")
+}
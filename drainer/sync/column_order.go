@@ -0,0 +1,149 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+// TableColumnOrder declares the order of the columns of the matched tables in the JSON-Lines files,
+// the names are matched like replicate-do-table, the name starting with "~" is a regular expression,
+// and the first matched one is used. The declared columns are written first in the order of Columns,
+// and the others follow in the schema-definition order, which is the order of all columns by default.
+// The column names are matched case-insensitively, and the ones not in the table are ignored.
+type TableColumnOrder struct {
+	Schema  string   `toml:"db-name" json:"db-name"`
+	Table   string   `toml:"tbl-name" json:"tbl-name"`
+	Columns []string `toml:"columns" json:"columns"`
+}
+
+type columnOrderRule struct {
+	schema *regexp.Regexp
+	table  *regexp.Regexp
+	// the lower case names of the declared columns
+	columns []string
+}
+
+// columnOrders reorders the columns of the tables with the declared order,
+// a nil *columnOrders is valid and keeps the schema-definition order of all tables.
+type columnOrders struct {
+	rules []columnOrderRule
+}
+
+func newColumnOrders(confs []TableColumnOrder) (*columnOrders, error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+
+	o := new(columnOrders)
+	for _, conf := range confs {
+		if len(conf.Schema) == 0 || len(conf.Table) == 0 {
+			return nil, errors.New("empty schema or table name in column-order")
+		}
+		schema, err := filter.CompilePattern(conf.Schema)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid schema pattern %s in column-order", conf.Schema)
+		}
+		table, err := filter.CompilePattern(conf.Table)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %s in column-order", conf.Table)
+		}
+		rule := columnOrderRule{schema: schema, table: table}
+		for _, col := range conf.Columns {
+			rule.columns = append(rule.columns, strings.ToLower(col))
+		}
+		o.rules = append(o.rules, rule)
+	}
+	return o, nil
+}
+
+// columnsOf returns the declared columns of the table, nil if the table isn't matched
+func (o *columnOrders) columnsOf(schema string, table string) []string {
+	for _, rule := range o.rules {
+		if rule.schema.MatchString(schema) && rule.table.MatchString(table) {
+			return rule.columns
+		}
+	}
+	return nil
+}
+
+// reorder reorders the column infos and the columns of the rows of the tables in binlog with the declared order
+func (o *columnOrders) reorder(binlog *obinlog.Binlog) {
+	if o == nil || binlog.DmlData == nil {
+		return
+	}
+
+	for _, table := range binlog.DmlData.Tables {
+		columns := o.columnsOf(table.GetSchemaName(), table.GetTableName())
+		if len(columns) == 0 {
+			continue
+		}
+		reorderColumns(table, columns)
+	}
+}
+
+// reorderColumns moves the declared columns of the table to the front in the declared order,
+// the columns of the rows are in the same order as the column infos of the table.
+func reorderColumns(table *obinlog.Table, columns []string) {
+	positions := make(map[string]int, len(table.ColumnInfo))
+	for i, info := range table.ColumnInfo {
+		positions[strings.ToLower(info.Name)] = i
+	}
+
+	order := make([]int, 0, len(table.ColumnInfo))
+	declared := make(map[int]struct{}, len(columns))
+	for _, col := range columns {
+		i, ok := positions[col]
+		if !ok {
+			continue
+		}
+		if _, ok := declared[i]; ok {
+			continue
+		}
+		declared[i] = struct{}{}
+		order = append(order, i)
+	}
+	for i := range table.ColumnInfo {
+		if _, ok := declared[i]; !ok {
+			order = append(order, i)
+		}
+	}
+
+	infos := make([]*obinlog.ColumnInfo, 0, len(order))
+	for _, i := range order {
+		infos = append(infos, table.ColumnInfo[i])
+	}
+	table.ColumnInfo = infos
+
+	for _, mut := range table.Mutations {
+		reorderRow(mut.Row, order)
+		reorderRow(mut.ChangeRow, order)
+	}
+}
+
+func reorderRow(row *obinlog.Row, order []int) {
+	if row == nil || len(row.Columns) != len(order) {
+		return
+	}
+	columns := make([]*obinlog.Column, 0, len(order))
+	for _, i := range order {
+		columns = append(columns, row.Columns[i])
+	}
+	row.Columns = columns
+}
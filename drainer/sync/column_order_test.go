@@ -0,0 +1,118 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+var _ = check.Suite(&columnOrderSuite{})
+
+type columnOrderSuite struct{}
+
+func columnNames(table *obinlog.Table) []string {
+	var names []string
+	for _, info := range table.ColumnInfo {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func (s *columnOrderSuite) TestReorderColumns(c *check.C) {
+	orders, err := newColumnOrders([]TableColumnOrder{
+		{Schema: "test", Table: "keep", Columns: []string{}},
+		{Schema: "test", Table: "~.*", Columns: []string{"B", "id", "missing", "b"}},
+	})
+	c.Assert(err, check.IsNil)
+
+	binlog := &obinlog.Binlog{
+		Type: obinlog.BinlogType_DML,
+		DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{
+			newImageTable("test", "t", obinlog.MutationType_Update, newImageRow(1, 2, 3), newImageRow(1, 2, 4)),
+			newImageTable("test", "keep", obinlog.MutationType_Insert, newImageRow(1, 2, 3), nil),
+			newImageTable("other", "t", obinlog.MutationType_Insert, newImageRow(1, 2, 3), nil),
+		}},
+	}
+	orders.reorder(binlog)
+	tables := binlog.DmlData.Tables
+
+	// the declared columns come first, and the others follow in the schema-definition order
+	c.Assert(columnNames(tables[0]), check.DeepEquals, []string{"b", "id", "a"})
+	c.Assert(tables[0].Mutations[0].Row, check.DeepEquals, newImageRow(3, 2, 1))
+	c.Assert(tables[0].Mutations[0].ChangeRow, check.DeepEquals, newImageRow(4, 2, 1))
+	// the table without declared columns and the table not matched are kept
+	c.Assert(columnNames(tables[1]), check.DeepEquals, []string{"a", "id", "b"})
+	c.Assert(tables[1].Mutations[0].Row, check.DeepEquals, newImageRow(1, 2, 3))
+	c.Assert(columnNames(tables[2]), check.DeepEquals, []string{"a", "id", "b"})
+
+	var nilOrders *columnOrders
+	nilOrders.reorder(binlog)
+	c.Assert(columnNames(tables[0]), check.DeepEquals, []string{"b", "id", "a"})
+
+	_, err = newColumnOrders([]TableColumnOrder{{Schema: "test"}})
+	c.Assert(err, check.ErrorMatches, "empty schema or table name in column-order")
+	_, err = newColumnOrders([]TableColumnOrder{{Schema: "test", Table: "~("}})
+	c.Assert(err, check.ErrorMatches, "invalid table pattern ~\\( in column-order.*")
+}
+
+// readJSONLBytes returns the decompressed content of the JSON-Lines file
+func readJSONLBytes(c *check.C, name string) []byte {
+	f, err := os.Open(name)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(gz)
+	c.Assert(err, check.IsNil)
+	return data
+}
+
+func (s *columnOrderSuite) TestWriteJSONLInDeclaredOrder(c *check.C) {
+	gen := &translator.BinlogGenrator{}
+	gen.SetInsert(c)
+	gen.TiBinlog.CommitTs = 100
+	orders := []TableColumnOrder{{Schema: "test", Table: "~.*", Columns: []string{"sex", "id"}}}
+
+	// the same txn is written in the same order by every run
+	var outputs [][]byte
+	for run := 0; run < 3; run++ {
+		dir := c.MkDir()
+		syncer, err := NewJSONLSyncer(dir, gen, false, orders, false)
+		c.Assert(err, check.IsNil)
+		item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+		c.Assert(syncer.Sync(item), check.IsNil)
+		<-syncer.Successes()
+		c.Assert(syncer.Close(), check.IsNil)
+
+		name := filepath.Join(dir, "binlog-0000000000000000.jsonl.gz")
+		binlogs := readJSONL(c, name)
+		c.Assert(binlogs, check.HasLen, 1)
+		table := binlogs[0].DmlData.Tables[0]
+		c.Assert(columnNames(table), check.DeepEquals, []string{"SEX", "ID", "NAME"})
+		c.Assert(table.Mutations[0].Row.Columns, check.HasLen, 3)
+		outputs = append(outputs, readJSONLBytes(c, name))
+	}
+	c.Assert(outputs[1], check.DeepEquals, outputs[0])
+	c.Assert(outputs[2], check.DeepEquals, outputs[0])
+
+	_, err := NewJSONLSyncer(c.MkDir(), gen, false, []TableColumnOrder{{Table: "t"}}, false)
+	c.Assert(err, check.ErrorMatches, "empty schema or table name in column-order")
+}
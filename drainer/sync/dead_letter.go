@@ -0,0 +1,300 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	tipb "github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DeadLetterFile writes the dead letters to a local file, one JSON record per line
+	DeadLetterFile = "file"
+	// DeadLetterTable writes the dead letters to a table in downstream
+	DeadLetterTable = "table"
+
+	// DeadLetterTableName is the table of dead letters in downstream,
+	// it's in the same schema as the mark table of loopback sync.
+	DeadLetterTableName = "_drainer_dead_letter"
+)
+
+// DeadLetterConfig is the configuration of the dead letter sink
+type DeadLetterConfig struct {
+	// the events failing permanently to apply to downstream are written to the sink and skipped
+	// instead of halting drainer, it breaks the consistency of downstream, so it's disabled by default
+	Enable bool `toml:"enable" json:"enable"`
+	// "file" or "table"
+	Type string `toml:"type" json:"type"`
+	// the file to append the dead letters to, only used when type is "file"
+	Path string `toml:"path" json:"path"`
+}
+
+// deadLetterRecord is the event failing permanently with the error
+type deadLetterRecord struct {
+	StartTS  int64           `json:"start-ts"`
+	CommitTS int64           `json:"commit-ts"`
+	Error    string          `json:"error"`
+	DDL      string          `json:"ddl,omitempty"`
+	DMLs     []deadLetterDML `json:"dmls,omitempty"`
+	// the row quarantined because it fails to be decoded
+	UndecodableRow *deadLetterRow `json:"undecodable-row,omitempty"`
+}
+
+type deadLetterRow struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Type     string `json:"type"`
+	// the raw bytes of the row, it's encoded in base64
+	Data []byte `json:"data"`
+}
+
+type deadLetterDML struct {
+	Database  string                 `json:"database"`
+	Table     string                 `json:"table"`
+	Type      string                 `json:"type"`
+	Values    map[string]interface{} `json:"values"`
+	OldValues map[string]interface{} `json:"old-values,omitempty"`
+}
+
+type deadLetterSink interface {
+	write(record *deadLetterRecord) error
+	close() error
+}
+
+// DeadLetter records the events failing permanently to apply to downstream
+type DeadLetter struct {
+	mu      sync.Mutex
+	sink    deadLetterSink
+	counter prometheus.Counter
+}
+
+// NewDeadLetter creates the dead letter configured in cfg, it returns nil if the dead letter is disabled.
+// counter is increased by every dead letter written if it's not nil.
+func NewDeadLetter(cfg *DBConfig, counter prometheus.Counter) (*DeadLetter, error) {
+	if !cfg.DeadLetter.Enable {
+		return nil, nil
+	}
+
+	var sink deadLetterSink
+	var err error
+	switch cfg.DeadLetter.Type {
+	case DeadLetterFile:
+		sink, err = newFileDeadLetter(cfg.DeadLetter.Path)
+	case DeadLetterTable:
+		sink, err = newTableDeadLetter(cfg)
+	default:
+		return nil, errors.Errorf("unknown dead letter type: %s", cfg.DeadLetter.Type)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "create dead letter failed")
+	}
+
+	return &DeadLetter{sink: sink, counter: counter}, nil
+}
+
+// Write implements loader.DeadLetterFunc
+func (d *DeadLetter) Write(txn *loader.Txn, cause error) error {
+	record := newDeadLetterRecord(txn, cause)
+
+	return errors.Trace(d.write(record))
+}
+
+// WriteUndecodableRow writes the row of item failing to be decoded
+func (d *DeadLetter) WriteUndecodableRow(item *Item, row *translator.UndecodableRow) error {
+	record := &deadLetterRecord{
+		StartTS:  item.Binlog.GetStartTs(),
+		CommitTS: item.Binlog.GetCommitTs(),
+		Error:    row.Err.Error(),
+		UndecodableRow: &deadLetterRow{
+			Database: row.Schema,
+			Table:    row.Table,
+			Type:     mutationTypeName(row.Type),
+			Data:     row.Row,
+		},
+	}
+	return errors.Trace(d.write(record))
+}
+
+func (d *DeadLetter) write(record *deadLetterRecord) error {
+	d.mu.Lock()
+	err := d.sink.write(record)
+	d.mu.Unlock()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if d.counter != nil {
+		d.counter.Inc()
+	}
+	return nil
+}
+
+// Close closes the sink of dead letter
+func (d *DeadLetter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return errors.Trace(d.sink.close())
+}
+
+func newDeadLetterRecord(txn *loader.Txn, cause error) *deadLetterRecord {
+	record := &deadLetterRecord{Error: cause.Error()}
+	if item, ok := txn.Metadata.(*Item); ok {
+		record.StartTS = item.Binlog.GetStartTs()
+		record.CommitTS = item.Binlog.GetCommitTs()
+	}
+
+	if txn.DDL != nil {
+		record.DDL = txn.DDL.SQL
+		return record
+	}
+
+	for _, dml := range txn.DMLs {
+		record.DMLs = append(record.DMLs, deadLetterDML{
+			Database:  dml.Database,
+			Table:     dml.Table,
+			Type:      dmlTypeName(dml.Tp),
+			Values:    dml.Values,
+			OldValues: dml.OldValues,
+		})
+	}
+	return record
+}
+
+func dmlTypeName(tp loader.DMLType) string {
+	switch tp {
+	case loader.InsertDMLType:
+		return "insert"
+	case loader.UpdateDMLType:
+		return "update"
+	case loader.DeleteDMLType:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+func mutationTypeName(tp tipb.MutationType) string {
+	switch tp {
+	case tipb.MutationType_Insert:
+		return "insert"
+	case tipb.MutationType_Update:
+		return "update"
+	case tipb.MutationType_DeleteRow:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+type fileDeadLetter struct {
+	f *os.File
+}
+
+func newFileDeadLetter(path string) (*fileDeadLetter, error) {
+	if len(path) == 0 {
+		return nil, errors.New("path of dead letter file is empty")
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &fileDeadLetter{f: f}, nil
+}
+
+func (s *fileDeadLetter) write(record *deadLetterRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err = s.f.Write(append(data, '\n')); err != nil {
+		return errors.Trace(err)
+	}
+	// the event is skipped once it's written, so make sure it's persisted
+	return errors.Trace(s.f.Sync())
+}
+
+func (s *fileDeadLetter) close() error {
+	return errors.Trace(s.f.Close())
+}
+
+type tableDeadLetter struct {
+	db    *sql.DB
+	quote pkgsql.IdentifierQuote
+}
+
+func newTableDeadLetter(cfg *DBConfig) (*tableDeadLetter, error) {
+	quote, err := pkgsql.ParseIdentifierQuote(cfg.IdentifierQuote)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, nil, cfg.InitSQL, time.Duration(cfg.TCPKeepAlive)*time.Second)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	sqls := []string{loopbacksync.CreateMarkSchemaSQL(quote), createDeadLetterTableSQL(quote, cfg.TableOptions())}
+	for _, sql := range sqls {
+		if _, err = db.Exec(sql); err != nil {
+			db.Close()
+			return nil, errors.Annotatef(err, "exec failed, sql: %s", sql)
+		}
+	}
+	return &tableDeadLetter{db: db, quote: quote}, nil
+}
+
+func createDeadLetterTableSQL(quote pkgsql.IdentifierQuote, options pkgsql.TableOptions) string {
+	q := quote.Name
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"%s BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, "+
+		"%s BIGINT NOT NULL, "+
+		"%s BIGINT NOT NULL, "+
+		"%s TEXT, "+
+		"%s LONGTEXT, "+
+		"%s TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, "+
+		"KEY %s (%s))%s",
+		quote.Schema(loopbacksync.MarkTableSchema, DeadLetterTableName),
+		q("id"), q("start_ts"), q("commit_ts"), q("error"), q("event"), q("create_time"), q("idx_commit_ts"), q("commit_ts"), options.SQL())
+}
+
+func (s *tableDeadLetter) write(record *deadLetterRecord) error {
+	event, err := json.Marshal(record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	q := s.quote.Name
+	sql := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) VALUES (?, ?, ?, ?)",
+		s.quote.Schema(loopbacksync.MarkTableSchema, DeadLetterTableName), q("start_ts"), q("commit_ts"), q("error"), q("event"))
+	_, err = s.db.Exec(sql, record.StartTS, record.CommitTS, record.Error, string(event))
+	return errors.Trace(err)
+}
+
+func (s *tableDeadLetter) close() error {
+	return errors.Trace(s.db.Close())
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var _ = check.Suite(&deadLetterSuite{})
+
+type deadLetterSuite struct{}
+
+func counterValue(c *check.C, counter prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Assert(counter.Write(&m), check.IsNil)
+	return m.GetCounter().GetValue()
+}
+
+func (s *deadLetterSuite) TestDisabled(c *check.C) {
+	d, err := NewDeadLetter(&DBConfig{}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(d, check.IsNil)
+
+	_, err = NewDeadLetter(&DBConfig{DeadLetter: DeadLetterConfig{Enable: true, Type: "kafka"}}, nil)
+	c.Assert(err, check.ErrorMatches, ".*unknown dead letter type: kafka.*")
+
+	_, err = NewDeadLetter(&DBConfig{DeadLetter: DeadLetterConfig{Enable: true, Type: DeadLetterFile}}, nil)
+	c.Assert(err, check.ErrorMatches, ".*path of dead letter file is empty.*")
+}
+
+func (s *deadLetterSuite) TestFileDeadLetter(c *check.C) {
+	name := path.Join(c.MkDir(), "dead_letter.log")
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_dead_letter_count"})
+	cfg := &DBConfig{DeadLetter: DeadLetterConfig{Enable: true, Type: DeadLetterFile, Path: name}}
+	d, err := NewDeadLetter(cfg, counter)
+	c.Assert(err, check.IsNil)
+
+	ddl := loader.NewDDLTxn("test", "t1", "alter table t1 add column a int")
+	ddl.Metadata = &Item{Binlog: &pb.Binlog{StartTs: 100, CommitTs: 101}}
+	c.Assert(d.Write(ddl, errors.New("duplicate column")), check.IsNil)
+
+	dml := &loader.Txn{
+		DMLs: []*loader.DML{{
+			Database:  "test",
+			Table:     "t1",
+			Tp:        loader.UpdateDMLType,
+			Values:    map[string]interface{}{"id": 1, "name": "long name"},
+			OldValues: map[string]interface{}{"id": 1, "name": "a"},
+		}},
+		Metadata: &Item{Binlog: &pb.Binlog{StartTs: 102, CommitTs: 103}},
+	}
+	c.Assert(d.Write(dml, errors.New("data too long")), check.IsNil)
+	c.Assert(d.Close(), check.IsNil)
+	c.Assert(counterValue(c, counter), check.Equals, float64(2))
+
+	data, err := ioutil.ReadFile(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals,
+		`{"start-ts":100,"commit-ts":101,"error":"duplicate column","ddl":"alter table t1 add column a int"}`+"\n"+
+			`{"start-ts":102,"commit-ts":103,"error":"data too long","dmls":[{"database":"test","table":"t1","type":"update","values":{"id":1,"name":"long name"},"old-values":{"id":1,"name":"a"}}]}`+"\n")
+
+	// the records are appended to the existing file
+	d, err = NewDeadLetter(cfg, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Write(ddl, errors.New("duplicate column")), check.IsNil)
+	c.Assert(d.Close(), check.IsNil)
+	data, err = ioutil.ReadFile(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Count(string(data), "\n"), check.Equals, 3)
+}
+
+func (s *deadLetterSuite) TestTableDeadLetter(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, _ map[string]string, _ []string, _ time.Duration) (*sql.DB, error) {
+		return db, nil
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `tidb_binlog`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `tidb_binlog`.`_drainer_dead_letter`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `tidb_binlog`.`_drainer_dead_letter`")).
+		WithArgs(100, 101, "syntax error", `{"start-ts":100,"commit-ts":101,"error":"syntax error","ddl":"create tabel t1"}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectClose()
+
+	d, err := NewDeadLetter(&DBConfig{DeadLetter: DeadLetterConfig{Enable: true, Type: DeadLetterTable}}, nil)
+	c.Assert(err, check.IsNil)
+
+	txn := loader.NewDDLTxn("test", "t1", "create tabel t1")
+	txn.Metadata = &Item{Binlog: &pb.Binlog{StartTs: 100, CommitTs: 101}}
+	c.Assert(d.Write(txn, errors.New("syntax error")), check.IsNil)
+	c.Assert(d.Close(), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *deadLetterSuite) TestTableOptions(c *check.C) {
+	sql := createDeadLetterTableSQL(pkgsql.BacktickQuote, pkgsql.TableOptions{Charset: "utf8mb4", Collation: "utf8mb4_general_ci"})
+	c.Assert(strings.HasPrefix(sql, "CREATE TABLE IF NOT EXISTS `tidb_binlog`.`_drainer_dead_letter`"), check.IsTrue)
+	c.Assert(strings.HasSuffix(sql, "KEY `idx_commit_ts` (`commit_ts`)) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci"), check.IsTrue, check.Commentf(sql))
+
+	sql = createDeadLetterTableSQL(pkgsql.BacktickQuote, pkgsql.TableOptions{})
+	c.Assert(strings.HasSuffix(sql, "KEY `idx_commit_ts` (`commit_ts`))"), check.IsTrue, check.Commentf(sql))
+}
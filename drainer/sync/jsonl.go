@@ -0,0 +1,302 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+const (
+	// FileFormatPB writes the binlogs to the protobuf files read by reparo
+	FileFormatPB = "pb"
+	// FileFormatJSONLGzip writes the binlogs of the kafka format to the gzip-compressed JSON-Lines files
+	FileFormatJSONLGzip = "jsonl.gz"
+
+	jsonlFilePattern = "binlog-%016d.jsonl.gz"
+)
+
+// the file is rotated before writing the next txn once the compressed size of it reaches this size
+var jsonlFileMaxSize int64 = 512 * 1024 * 1024
+
+var _ Syncer = &jsonlSyncer{}
+
+// jsonlSyncer writes the binlogs as JSON-Lines to the gzip files in dir, the binlogs of every txn are compressed
+// into a separate gzip member, which is synced with the file, so the file is valid gzip after every txn.
+// The member torn by a crash is truncated when the syncer is reopened, and a new file is always started then.
+type jsonlSyncer struct {
+	dir   string
+	f     *os.File
+	w     *bufio.Writer
+	gz    *gzip.Writer
+	index int64
+	// the size written to f
+	size int64
+	// write the markers before and after the binlog of every txn
+	txnMarkers bool
+	// the declared order of the columns of the tables
+	columnOrders *columnOrders
+	// write the sequence numbers of the row changes with every binlog
+	rowSequences bool
+
+	*baseSyncer
+}
+
+// NewJSONLSyncer sync binlog to the gzip-compressed JSON-Lines files in dir,
+// the binlog of every txn is bracketed by the txn markers if txnMarkers is true,
+// the columns of the tables are written in the order declared by orders,
+// and the sequence numbers of the row changes are written with the binlog if rowSequences is true.
+func NewJSONLSyncer(dir string, tableInfoGetter translator.TableInfoGetter, txnMarkers bool, orders []TableColumnOrder, rowSequences bool) (*jsonlSyncer, error) {
+	colOrders, err := newColumnOrders(orders)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	files, err := jsonlFiles(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var index int64
+	if len(files) > 0 {
+		last := files[len(files)-1]
+		if err = repairGzipFile(filepath.Join(dir, last.name)); err != nil {
+			return nil, errors.Annotatef(err, "repair %s failed", last.name)
+		}
+		index = last.index + 1
+	}
+
+	s := &jsonlSyncer{
+		dir:          dir,
+		txnMarkers:   txnMarkers,
+		columnOrders: colOrders,
+		rowSequences: rowSequences,
+		baseSyncer:   newBaseSyncer(tableInfoGetter),
+	}
+	if err = s.open(index); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s, nil
+}
+
+type jsonlFile struct {
+	name  string
+	index int64
+}
+
+// jsonlFiles returns the JSON-Lines files in dir ordered by the index
+func jsonlFiles(dir string) ([]jsonlFile, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var files []jsonlFile
+	for _, info := range infos {
+		var index int64
+		if _, err := fmt.Sscanf(info.Name(), jsonlFilePattern, &index); err != nil {
+			continue
+		}
+		if info.Name() != fmt.Sprintf(jsonlFilePattern, index) {
+			continue
+		}
+		files = append(files, jsonlFile{name: info.Name(), index: index})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].index < files[j].index })
+	return files, nil
+}
+
+func (p *jsonlSyncer) open(index int64) error {
+	name := filepath.Join(p.dir, fmt.Sprintf(jsonlFilePattern, index))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	p.f = f
+	p.w = bufio.NewWriter(writerFunc(func(data []byte) (int, error) {
+		n, err := f.Write(data)
+		p.size += int64(n)
+		return n, err
+	}))
+	p.gz = gzip.NewWriter(p.w)
+	p.index = index
+	p.size = 0
+	return nil
+}
+
+func (p *jsonlSyncer) Sync(item *Item) error {
+	binlog, err := p.translate(item)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(p.syncBinlog(binlog, item))
+}
+
+func (p *jsonlSyncer) translate(item *Item) (*obinlog.Binlog, error) {
+	return translator.TiBinlogToSlaveBinlog(p.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+}
+
+// syncBinlog writes binlog translated from items, the items are reported as success once it's synced
+func (p *jsonlSyncer) syncBinlog(binlog *obinlog.Binlog, items ...*Item) error {
+	p.columnOrders.reorder(binlog)
+
+	binlogs := []*obinlog.Binlog{binlog}
+	if p.txnMarkers {
+		begin, commit := translator.SlaveTxnMarkers(binlog.CommitTs)
+		binlogs = []*obinlog.Binlog{begin, binlog, commit}
+	}
+
+	if err := p.saveBinlogs(binlogs); err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, item := range items {
+		p.success <- item
+	}
+
+	return nil
+}
+
+func (p *jsonlSyncer) saveBinlogs(binlogs []*obinlog.Binlog) error {
+	if p.size >= jsonlFileMaxSize {
+		if err := p.rotate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	// start a new gzip member for the txn
+	p.gz.Reset(p.w)
+	for _, binlog := range binlogs {
+		var v interface{} = binlog
+		if p.rowSequences {
+			v = sequencedBinlog{Binlog: binlog, RowSequences: rowSequences(binlog)}
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if _, err = p.gz.Write(append(data, '\n')); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := p.gz.Close(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := p.w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(p.f.Sync())
+}
+
+// rotate finalizes the current file and starts the next one
+func (p *jsonlSyncer) rotate() error {
+	if err := p.f.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("rotate binlog file", zap.String("file", p.f.Name()), zap.Int64("size", p.size))
+	return errors.Trace(p.open(p.index + 1))
+}
+
+func (p *jsonlSyncer) Close() error {
+	err := p.f.Close()
+	// an empty file isn't valid gzip
+	if err == nil && p.size == 0 {
+		err = os.Remove(p.f.Name())
+	}
+	p.setErr(err)
+	close(p.success)
+
+	return p.err
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(data []byte) (int, error) {
+	return f(data)
+}
+
+// countingReader counts the bytes read, it's a flate.Reader so gzip reads from it without buffering ahead,
+// and the count is the offset of the end of the gzip member read.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
+
+// repairGzipFile truncates the incomplete gzip member at the end of the file, which is torn by a crash,
+// the file is removed if no member is complete.
+func repairGzipFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+
+	r := &countingReader{r: bufio.NewReader(f)}
+	var valid int64
+	gz, err := gzip.NewReader(r)
+	for err == nil {
+		gz.Multistream(false)
+		if _, err = io.Copy(ioutil.Discard, gz); err != nil {
+			break
+		}
+		valid = r.n
+		err = gz.Reset(r)
+	}
+	f.Close()
+	if valid > 0 && valid == info.Size() {
+		return nil
+	}
+
+	log.Warn("truncate the torn binlog file", zap.String("file", name), zap.Int64("size", info.Size()),
+		zap.Int64("valid size", valid), zap.NamedError("cause", err))
+	if valid == 0 {
+		return errors.Trace(os.Remove(name))
+	}
+	return errors.Trace(os.Truncate(name, valid))
+}
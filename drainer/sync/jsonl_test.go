@@ -0,0 +1,173 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+var _ = check.Suite(&jsonlSuite{})
+
+type jsonlSuite struct{}
+
+func (s *jsonlSuite) TearDownTest(c *check.C) {
+	jsonlFileMaxSize = 512 * 1024 * 1024
+}
+
+// readJSONL decompresses the gzip file and decodes the JSON-Lines in it
+func readJSONL(c *check.C, name string) []*obinlog.Binlog {
+	f, err := os.Open(name)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+
+	var binlogs []*obinlog.Binlog
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		binlog := new(obinlog.Binlog)
+		c.Assert(json.Unmarshal(scanner.Bytes(), binlog), check.IsNil)
+		binlogs = append(binlogs, binlog)
+	}
+	c.Assert(scanner.Err(), check.IsNil)
+	return binlogs
+}
+
+func syncJSONL(c *check.C, syncer *jsonlSyncer, gen *translator.BinlogGenrator, commitTS int64) {
+	gen.SetInsert(c)
+	gen.TiBinlog.CommitTs = commitTS
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.IsNil)
+	c.Assert(<-syncer.Successes(), check.Equals, item)
+}
+
+func (s *jsonlSuite) TestWriteJSONL(c *check.C) {
+	dir := c.MkDir()
+	gen := &translator.BinlogGenrator{}
+	syncer, err := NewJSONLSyncer(dir, gen, true, nil, false)
+	c.Assert(err, check.IsNil)
+
+	syncJSONL(c, syncer, gen, 100)
+	gen.SetDDL()
+	gen.TiBinlog.CommitTs = 101
+	item := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.IsNil)
+	<-syncer.Successes()
+
+	// the file is valid gzip before it's closed
+	name := filepath.Join(dir, "binlog-0000000000000000.jsonl.gz")
+	binlogs := readJSONL(c, name)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(readJSONL(c, name), check.DeepEquals, binlogs)
+
+	var types []obinlog.BinlogType
+	for _, binlog := range binlogs {
+		types = append(types, binlog.Type)
+	}
+	c.Assert(types, check.DeepEquals, []obinlog.BinlogType{
+		translator.SlaveBinlogBegin, obinlog.BinlogType_DML, translator.SlaveBinlogCommit,
+		translator.SlaveBinlogBegin, obinlog.BinlogType_DDL, translator.SlaveBinlogCommit,
+	})
+
+	dml := binlogs[1]
+	c.Assert(dml.CommitTs, check.Equals, int64(100))
+	c.Assert(dml.DmlData.Tables, check.HasLen, 1)
+	c.Assert(dml.DmlData.Tables[0].GetSchemaName(), check.Equals, gen.Schema)
+	c.Assert(dml.DmlData.Tables[0].Mutations[0].GetType(), check.Equals, obinlog.MutationType_Insert)
+	ddl := binlogs[4]
+	c.Assert(ddl.CommitTs, check.Equals, int64(101))
+	c.Assert(string(ddl.DdlData.DdlQuery), check.Equals, string(gen.TiBinlog.GetDdlQuery()))
+}
+
+func (s *jsonlSuite) TestRotate(c *check.C) {
+	jsonlFileMaxSize = 1
+	dir := c.MkDir()
+	gen := &translator.BinlogGenrator{}
+	syncer, err := NewJSONLSyncer(dir, gen, false, nil, false)
+	c.Assert(err, check.IsNil)
+
+	for commitTS := int64(1); commitTS <= 3; commitTS++ {
+		syncJSONL(c, syncer, gen, commitTS)
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+
+	files, err := jsonlFiles(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 3)
+	for i, file := range files {
+		c.Assert(file.index, check.Equals, int64(i))
+		binlogs := readJSONL(c, filepath.Join(dir, file.name))
+		c.Assert(binlogs, check.HasLen, 1)
+		c.Assert(binlogs[0].CommitTs, check.Equals, int64(i+1))
+	}
+}
+
+func (s *jsonlSuite) TestRepairTornFile(c *check.C) {
+	dir := c.MkDir()
+	gen := &translator.BinlogGenrator{}
+	syncer, err := NewJSONLSyncer(dir, gen, false, nil, false)
+	c.Assert(err, check.IsNil)
+	syncJSONL(c, syncer, gen, 1)
+	syncJSONL(c, syncer, gen, 2)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	// a txn is torn by a crash
+	name := filepath.Join(dir, "binlog-0000000000000000.jsonl.gz")
+	info, err := os.Stat(name)
+	c.Assert(err, check.IsNil)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	c.Assert(err, check.IsNil)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte(`{"commit_ts":3}` + "\n"))
+	c.Assert(err, check.IsNil)
+	c.Assert(gz.Flush(), check.IsNil)
+	c.Assert(f.Close(), check.IsNil)
+
+	// the torn txn is truncated, and the txns after restarting are written to a new file
+	syncer, err = NewJSONLSyncer(dir, gen, false, nil, false)
+	c.Assert(err, check.IsNil)
+	syncJSONL(c, syncer, gen, 3)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	repaired, err := os.Stat(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(repaired.Size(), check.Equals, info.Size())
+	binlogs := readJSONL(c, name)
+	c.Assert(binlogs, check.HasLen, 2)
+	c.Assert(binlogs[1].CommitTs, check.Equals, int64(2))
+	binlogs = readJSONL(c, filepath.Join(dir, "binlog-0000000000000001.jsonl.gz"))
+	c.Assert(binlogs, check.HasLen, 1)
+	c.Assert(binlogs[0].CommitTs, check.Equals, int64(3))
+
+	// the file without any complete txn is removed
+	name = filepath.Join(dir, "binlog-0000000000000001.jsonl.gz")
+	c.Assert(os.Truncate(name, 10), check.IsNil)
+	syncer, err = NewJSONLSyncer(dir, gen, false, nil, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+	_, err = os.Stat(name)
+	c.Assert(os.IsNotExist(err), check.IsTrue)
+	// so is the empty file
+	files, err := jsonlFiles(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 1)
+}
@@ -14,9 +14,11 @@
 package sync
 
 import (
+	"encoding/json"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -25,25 +27,55 @@ import (
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"go.uber.org/zap"
 )
 
+const (
+	// KafkaTimestampCommitTS sets the timestamp of the messages to the physical time of the commit ts,
+	// it's the event time of the txn for the stream processing consumers
+	KafkaTimestampCommitTS = "commit-ts"
+	// KafkaTimestampProduceTime leaves the timestamp of the messages to the producer, it's the time of sending them
+	KafkaTimestampProduceTime = "produce-time"
+)
+
 var maxWaitTimeToSendMSG = time.Second * 30
 var stallWriteSize = 90 * 1024 * 1024
 
 var _ Syncer = &KafkaSyncer{}
+var _ Resolver = &KafkaSyncer{}
 
 // KafkaSyncer sync data to kafka
 type KafkaSyncer struct {
 	addr     []string
 	producer sarama.AsyncProducer
 	topic    string
+	// the topic of DDL binlogs, it's the same as topic if it's not configured
+	ddlTopic string
+	// key the DDL messages by `schema.table` instead of the schema name if the table is known
+	keyNamespace bool
+	// write the markers before and after the binlog of every txn
+	txnMarkers bool
+	// strip the before-image of the rows of the tables excluding it
+	beforeImages *beforeImages
+	// set the timestamp of the messages to the event time derived from the commit ts
+	eventTime bool
+	// carry the sequence numbers of the row changes of the binlog in the header of every message
+	rowSequences bool
+	// write the resolved ts to every partition at the interval, 0 means disabled
+	resolvedTSInterval time.Duration
+	// the ts up to which all the changes have been written to the partitions, the items are synced in commit order,
+	// and the ts is also advanced by Resolve when there're no changes
+	resolvedTS int64
 
 	toBeAckCommitTSMu      sync.Mutex
 	toBeAckCommitTS        map[int64]int
 	toBeAckTotalSize       int
 	resumeProduce          chan struct{}
 	resumeProduceCloseOnce sync.Once
+	// the items merged into the binlog of the commit ts except the last one, which is the metadata
+	// of the last message, they're guarded by toBeAckCommitTSMu
+	mergedItems map[int64][]*Item
 
 	lastSuccessTime time.Time
 
@@ -64,10 +96,27 @@ func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*Kafka
 		topic = cfg.TopicName
 	}
 
+	ddlTopic := topic
+	if len(cfg.DDLTopicName) > 0 {
+		ddlTopic = cfg.DDLTopicName
+	}
+
+	images, err := newBeforeImages(cfg.BeforeImages)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	executor := &KafkaSyncer{
 		addr:            strings.Split(cfg.KafkaAddrs, ","),
 		topic:           topic,
+		ddlTopic:        ddlTopic,
+		keyNamespace:    cfg.KafkaKeyNamespace,
+		txnMarkers:      cfg.TxnMarkers,
+		beforeImages:    images,
+		eventTime:       cfg.KafkaTimestamp == KafkaTimestampCommitTS,
+		rowSequences:    cfg.RowSequences,
 		toBeAckCommitTS: make(map[int64]int),
+		mergedItems:     make(map[int64][]*Item),
 		shutdown:        make(chan struct{}),
 		baseSyncer:      newBaseSyncer(tableInfoGetter),
 	}
@@ -79,6 +128,15 @@ func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*Kafka
 
 	config.Producer.Flush.MaxMessages = cfg.KafkaMaxMessages
 
+	if executor.rowSequences && !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, errors.Errorf("row-sequences requires the message headers supported since kafka 0.11.0.0, but kafka-version is %s", cfg.KafkaVersion)
+	}
+
+	if executor.eventTime && !config.Version.IsAtLeast(sarama.V0_10_0_0) {
+		log.Warn("the timestamp of kafka messages is dropped before kafka 0.10.0.0",
+			zap.String("kafka-version", cfg.KafkaVersion), zap.String("kafka-timestamp", KafkaTimestampCommitTS))
+	}
+
 	// maintain minimal set that has been necessary so far
 	// this also avoid take too much time in NewAsyncProducer if kafka is down
 	// because it will fetch metadata right away if setting Full = true, and we set
@@ -100,6 +158,11 @@ func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*Kafka
 	config.Producer.Retry.Max = 10000
 	config.Producer.Retry.Backoff = 500 * time.Millisecond
 
+	if cfg.KafkaResolvedTSInterval < 0 {
+		return nil, errors.Errorf("invalid kafka-resolved-ts-interval %d, must not be negative", cfg.KafkaResolvedTSInterval)
+	}
+	executor.resolvedTSInterval = time.Duration(cfg.KafkaResolvedTSInterval) * time.Millisecond
+
 	executor.producer, err = newAsyncProducer(executor.addr, config)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -112,17 +175,35 @@ func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*Kafka
 
 // Sync implements Syncer interface
 func (p *KafkaSyncer) Sync(item *Item) error {
-	slaveBinlog, err := translator.TiBinlogToSlaveBinlog(p.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	slaveBinlog, err := p.translate(item)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	return errors.Trace(p.syncBinlog(slaveBinlog, item))
+}
 
-	err = p.saveBinlog(slaveBinlog, item)
-	if err != nil {
-		return errors.Trace(err)
+func (p *KafkaSyncer) translate(item *Item) (*obinlog.Binlog, error) {
+	return translator.TiBinlogToSlaveBinlog(p.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+}
+
+// syncBinlog sends slaveBinlog translated from items, the items are reported as success once it's acked
+func (p *KafkaSyncer) syncBinlog(slaveBinlog *obinlog.Binlog, items ...*Item) error {
+	p.beforeImages.strip(slaveBinlog)
+
+	binlogs := []*obinlog.Binlog{slaveBinlog}
+	if p.txnMarkers {
+		begin, commit := translator.SlaveTxnMarkers(slaveBinlog.CommitTs)
+		binlogs = []*obinlog.Binlog{begin, slaveBinlog, commit}
 	}
 
-	return nil
+	item := items[len(items)-1]
+	if len(items) > 1 {
+		p.toBeAckCommitTSMu.Lock()
+		p.mergedItems[item.Binlog.GetCommitTs()] = items[:len(items)-1]
+		p.toBeAckCommitTSMu.Unlock()
+	}
+
+	return errors.Trace(p.saveBinlogs(binlogs, item))
 }
 
 // Close implements Syncer interface
@@ -134,15 +215,33 @@ func (p *KafkaSyncer) Close() error {
 	return err
 }
 
-func (p *KafkaSyncer) saveBinlog(binlog *obinlog.Binlog, item *Item) error {
-	// log.Debug("save binlog: ", binlog.String())
-	data, err := binlog.Marshal()
-	if err != nil {
-		return errors.Trace(err)
+// saveBinlogs sends the binlogs of item in order, item is reported as success once the last one is acked
+func (p *KafkaSyncer) saveBinlogs(binlogs []*obinlog.Binlog, item *Item) error {
+	topic, key := p.topicOf(item)
+	var timestamp time.Time
+	if p.eventTime {
+		timestamp = eventTimeOf(item.Binlog.GetCommitTs())
 	}
-
-	msg := &sarama.ProducerMessage{Topic: p.topic, Key: nil, Value: sarama.ByteEncoder(data), Partition: 0}
-	msg.Metadata = item
+	msgs := make([]*sarama.ProducerMessage, 0, len(binlogs))
+	size := 0
+	for _, binlog := range binlogs {
+		// log.Debug("save binlog: ", binlog.String())
+		data, err := binlog.Marshal()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		size += len(data)
+		msg := &sarama.ProducerMessage{Topic: topic, Key: key, Value: sarama.ByteEncoder(data), Partition: 0, Timestamp: timestamp}
+		if seqs := p.rowSequencesOf(binlog); len(seqs) > 0 {
+			header, err := json.Marshal(seqs)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			msg.Headers = []sarama.RecordHeader{{Key: []byte(RowSequencesKey), Value: header}}
+		}
+		msgs = append(msgs, msg)
+	}
+	msgs[len(msgs)-1].Metadata = item
 
 	waitResume := false
 
@@ -150,8 +249,8 @@ func (p *KafkaSyncer) saveBinlog(binlog *obinlog.Binlog, item *Item) error {
 	if len(p.toBeAckCommitTS) == 0 {
 		p.lastSuccessTime = time.Now()
 	}
-	p.toBeAckCommitTS[binlog.CommitTs] = len(data)
-	p.toBeAckTotalSize += len(data)
+	p.toBeAckCommitTS[item.Binlog.GetCommitTs()] = size
+	p.toBeAckTotalSize += size
 	if p.toBeAckTotalSize >= stallWriteSize && len(p.toBeAckCommitTS) > 1 {
 		p.resumeProduce = make(chan struct{})
 		p.resumeProduceCloseOnce = sync.Once{}
@@ -167,12 +266,85 @@ func (p *KafkaSyncer) saveBinlog(binlog *obinlog.Binlog, item *Item) error {
 		}
 	}
 
-	select {
-	case p.producer.Input() <- msg:
+	for _, msg := range msgs {
+		select {
+		case p.producer.Input() <- msg:
+		case <-p.errCh:
+			return errors.Trace(p.err)
+		}
+	}
+	// all the messages of the earlier items have been sent in order before
+	p.Resolve(item.Binlog.GetCommitTs())
+	return nil
+}
+
+// Resolve implements Resolver interface, it's called with the ts of the fake binlogs when there're no changes
+func (p *KafkaSyncer) Resolve(ts int64) {
+	for {
+		resolved := atomic.LoadInt64(&p.resolvedTS)
+		if ts <= resolved || atomic.CompareAndSwapInt64(&p.resolvedTS, resolved, ts) {
+			return
+		}
+	}
+}
+
+// writeResolvedTS writes the resolved ts to partition 0 of every topic, which is the only partition written.
+// It's written even if it doesn't advance,
+// so the consumers can tell the idle partitions from the stalled ones
+func (p *KafkaSyncer) writeResolvedTS() error {
+	ts := atomic.LoadInt64(&p.resolvedTS)
+	if ts == 0 {
 		return nil
-	case <-p.errCh:
-		return errors.Trace(p.err)
 	}
+	data, err := translator.SlaveResolvedTS(ts).Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	topics := []string{p.topic}
+	if p.ddlTopic != p.topic {
+		topics = append(topics, p.ddlTopic)
+	}
+	var timestamp time.Time
+	if p.eventTime {
+		timestamp = eventTimeOf(ts)
+	}
+	for _, topic := range topics {
+		msg := &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(data), Partition: 0, Timestamp: timestamp}
+		select {
+		case p.producer.Input() <- msg:
+		case <-p.shutdown:
+			return nil
+		}
+	}
+	return nil
+}
+
+// rowSequencesOf returns the sequence numbers of the row changes of binlog carried in the message header,
+// it returns nil if they aren't carried
+func (p *KafkaSyncer) rowSequencesOf(binlog *obinlog.Binlog) []string {
+	if !p.rowSequences {
+		return nil
+	}
+	return rowSequences(binlog)
+}
+
+// eventTimeOf returns the wall-clock time of the physical part of the commit ts, in milliseconds like kafka timestamps
+func eventTimeOf(commitTS int64) time.Time {
+	return oracle.GetTimeFromTS(uint64(commitTS))
+}
+
+// topicOf returns the topic and the key of the messages of item,
+// the DDL binlogs go to the DDL topic keyed by the schema name if it's configured,
+// or by `schema.table` with keyNamespace if the table is known.
+func (p *KafkaSyncer) topicOf(item *Item) (string, sarama.Encoder) {
+	if p.ddlTopic == p.topic || item.Binlog.GetDdlJobId() == 0 {
+		return p.topic, nil
+	}
+	if p.keyNamespace && len(item.Table) > 0 {
+		return p.ddlTopic, sarama.StringEncoder(item.Schema + "." + item.Table)
+	}
+	return p.ddlTopic, sarama.StringEncoder(item.Schema)
 }
 
 func (p *KafkaSyncer) run() {
@@ -184,7 +356,11 @@ func (p *KafkaSyncer) run() {
 		defer wg.Done()
 
 		for msg := range p.producer.Successes() {
-			item := msg.Metadata.(*Item)
+			item, ok := msg.Metadata.(*Item)
+			if !ok {
+				// the markers before the last message of the txn
+				continue
+			}
 			commitTs := item.Binlog.GetCommitTs()
 			log.Debug("get success msg from producer", zap.Int64("ts", commitTs))
 
@@ -198,8 +374,13 @@ func (p *KafkaSyncer) run() {
 				})
 			}
 			delete(p.toBeAckCommitTS, commitTs)
+			merged := p.mergedItems[commitTs]
+			delete(p.mergedItems, commitTs)
 			p.toBeAckCommitTSMu.Unlock()
 
+			for _, item := range merged {
+				p.success <- item
+			}
 			p.success <- item
 		}
 		close(p.success)
@@ -218,8 +399,19 @@ func (p *KafkaSyncer) run() {
 	checkTick := time.NewTicker(time.Second)
 	defer checkTick.Stop()
 
+	var resolvedTick <-chan time.Time
+	if p.resolvedTSInterval > 0 {
+		ticker := time.NewTicker(p.resolvedTSInterval)
+		defer ticker.Stop()
+		resolvedTick = ticker.C
+	}
+
 	for {
 		select {
+		case <-resolvedTick:
+			if err := p.writeResolvedTS(); err != nil {
+				log.Error("write resolved ts to kafka failed", zap.Error(err))
+			}
 		case <-checkTick.C:
 			p.toBeAckCommitTSMu.Lock()
 			if len(p.toBeAckCommitTS) > 0 && time.Since(p.lastSuccessTime) > maxWaitTimeToSendMSG {
@@ -0,0 +1,415 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+var _ = check.Suite(&kafkaSuite{})
+
+type kafkaSuite struct{}
+
+func (s *kafkaSuite) TestTxnMarkers(c *check.C) {
+	var producer *mocks.AsyncProducer
+	oldNewAsyncProducer := newAsyncProducer
+	defer func() {
+		newAsyncProducer = oldNewAsyncProducer
+	}()
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		producer = mocks.NewAsyncProducer(c, config)
+		return producer, nil
+	}
+
+	gen := &translator.BinlogGenrator{}
+	syncer, err := NewKafka(&DBConfig{KafkaVersion: "0.8.2.0", TxnMarkers: true}, gen)
+	c.Assert(err, check.IsNil)
+
+	var types []obinlog.BinlogType
+	expectType := func(tp obinlog.BinlogType) {
+		producer.ExpectInputWithCheckerFunctionAndSucceed(func(val []byte) error {
+			binlog := new(obinlog.Binlog)
+			if err := binlog.Unmarshal(val); err != nil {
+				return err
+			}
+			if binlog.CommitTs != 100 {
+				return errors.Errorf("unexpected commit ts %d", binlog.CommitTs)
+			}
+			if tp == obinlog.BinlogType_DML && len(binlog.DmlData.Tables) != 1 {
+				return errors.Errorf("unexpected dml data %v", binlog.DmlData)
+			}
+			types = append(types, binlog.Type)
+			return nil
+		})
+	}
+	expectType(translator.SlaveBinlogBegin)
+	expectType(obinlog.BinlogType_DML)
+	expectType(translator.SlaveBinlogCommit)
+
+	gen.SetInsert(c)
+	gen.TiBinlog.CommitTs = 100
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.IsNil)
+
+	// only the txn is reported once all the messages of it are acked
+	select {
+	case success := <-syncer.Successes():
+		c.Assert(success, check.Equals, item)
+	case <-time.After(time.Second):
+		c.Fatal("the txn is not reported as success")
+	}
+	select {
+	case success := <-syncer.Successes():
+		c.Fatalf("unexpected success %v", success)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(types, check.DeepEquals, []obinlog.BinlogType{translator.SlaveBinlogBegin, obinlog.BinlogType_DML, translator.SlaveBinlogCommit})
+}
+
+// topicRecorder records the topics and keys of the messages sent to the producer
+type topicRecorder struct {
+	sarama.AsyncProducer
+	input chan *sarama.ProducerMessage
+	done  chan struct{}
+
+	mu   sync.Mutex
+	msgs []*sarama.ProducerMessage
+}
+
+func newTopicRecorder(producer sarama.AsyncProducer) *topicRecorder {
+	r := &topicRecorder{
+		AsyncProducer: producer,
+		input:         make(chan *sarama.ProducerMessage),
+		done:          make(chan struct{}),
+	}
+	go func() {
+		defer close(r.done)
+		for msg := range r.input {
+			r.mu.Lock()
+			r.msgs = append(r.msgs, msg)
+			r.mu.Unlock()
+			producer.Input() <- msg
+		}
+	}()
+	return r
+}
+
+func (r *topicRecorder) Input() chan<- *sarama.ProducerMessage {
+	return r.input
+}
+
+func (r *topicRecorder) Close() error {
+	close(r.input)
+	<-r.done
+	return r.AsyncProducer.Close()
+}
+
+func (s *kafkaSuite) TestDDLTopic(c *check.C) {
+	var recorder *topicRecorder
+	oldNewAsyncProducer := newAsyncProducer
+	defer func() {
+		newAsyncProducer = oldNewAsyncProducer
+	}()
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		producer := mocks.NewAsyncProducer(c, config)
+		producer.ExpectInputAndSucceed()
+		producer.ExpectInputAndSucceed()
+		recorder = newTopicRecorder(producer)
+		return recorder, nil
+	}
+
+	gen := &translator.BinlogGenrator{}
+	syncer, err := NewKafka(&DBConfig{KafkaVersion: "0.8.2.0", TopicName: "data", DDLTopicName: "schema"}, gen)
+	c.Assert(err, check.IsNil)
+
+	gen.SetInsert(c)
+	dml := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(dml), check.IsNil)
+	gen.SetDDL()
+	gen.TiBinlog.CommitTs = 300
+	ddl := &Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(ddl), check.IsNil)
+
+	for _, item := range []*Item{dml, ddl} {
+		select {
+		case success := <-syncer.Successes():
+			c.Assert(success, check.Equals, item)
+		case <-time.After(time.Second):
+			c.Fatal("the txn is not reported as success")
+		}
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+
+	c.Assert(recorder.msgs, check.HasLen, 2)
+	c.Assert(recorder.msgs[0].Topic, check.Equals, "data")
+	c.Assert(recorder.msgs[0].Key, check.IsNil)
+	c.Assert(recorder.msgs[1].Topic, check.Equals, "schema")
+	c.Assert(recorder.msgs[1].Key, check.Equals, sarama.StringEncoder("test"))
+}
+
+func (s *kafkaSuite) TestDDLKeyNamespace(c *check.C) {
+	gen := &translator.BinlogGenrator{}
+	gen.SetDDL()
+	t1 := &Item{Binlog: gen.TiBinlog, Schema: "test", Table: "t1"}
+	t2 := &Item{Binlog: gen.TiBinlog, Schema: "test", Table: "t2"}
+	// the DDL of the schema itself is keyed by the schema name
+	db := &Item{Binlog: gen.TiBinlog, Schema: "test"}
+
+	// the DDLs of the tables in a schema share the key by default
+	p := &KafkaSyncer{topic: "data", ddlTopic: "schema"}
+	for _, item := range []*Item{t1, t2, db} {
+		topic, key := p.topicOf(item)
+		c.Assert(topic, check.Equals, "schema")
+		c.Assert(key, check.Equals, sarama.StringEncoder("test"))
+	}
+
+	p.keyNamespace = true
+	topic, key1 := p.topicOf(t1)
+	c.Assert(topic, check.Equals, "schema")
+	c.Assert(key1, check.Equals, sarama.StringEncoder("test.t1"))
+	_, key2 := p.topicOf(t2)
+	c.Assert(key2, check.Equals, sarama.StringEncoder("test.t2"))
+	_, key := p.topicOf(db)
+	c.Assert(key, check.Equals, sarama.StringEncoder("test"))
+
+	// the DML messages aren't keyed anyway
+	gen.SetInsert(c)
+	topic, key = p.topicOf(&Item{Binlog: gen.TiBinlog, Schema: "test", Table: "t1"})
+	c.Assert(topic, check.Equals, "data")
+	c.Assert(key, check.IsNil)
+}
+
+func (s *kafkaSuite) TestTopicOfWithoutDDLTopic(c *check.C) {
+	p := &KafkaSyncer{topic: "data", ddlTopic: "data"}
+	gen := &translator.BinlogGenrator{}
+	gen.SetDDL()
+	topic, key := p.topicOf(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(topic, check.Equals, "data")
+	c.Assert(key, check.IsNil)
+}
+
+func (s *kafkaSuite) TestMessageTimestamp(c *check.C) {
+	var recorder *topicRecorder
+	var msgs int
+	oldNewAsyncProducer := newAsyncProducer
+	defer func() {
+		newAsyncProducer = oldNewAsyncProducer
+	}()
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		producer := mocks.NewAsyncProducer(c, config)
+		for i := 0; i < msgs; i++ {
+			producer.ExpectInputAndSucceed()
+		}
+		recorder = newTopicRecorder(producer)
+		return recorder, nil
+	}
+
+	// 2019-11-20 10:30:00.123 +0000 UTC
+	physical := int64(1574245800123)
+	commitTS := physical<<18 + 5
+	gen := &translator.BinlogGenrator{}
+	sync := func(cfg *DBConfig) {
+		msgs = 1
+		if cfg.TxnMarkers {
+			msgs = 3
+		}
+		syncer, err := NewKafka(cfg, gen)
+		c.Assert(err, check.IsNil)
+		gen.SetInsert(c)
+		gen.TiBinlog.CommitTs = commitTS
+		item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+		c.Assert(syncer.Sync(item), check.IsNil)
+		select {
+		case success := <-syncer.Successes():
+			c.Assert(success, check.Equals, item)
+		case <-time.After(time.Second):
+			c.Fatal("the txn is not reported as success")
+		}
+		c.Assert(syncer.Close(), check.IsNil)
+	}
+
+	// the markers carry the event time of the txn too
+	sync(&DBConfig{KafkaVersion: "0.10.0.0", KafkaTimestamp: KafkaTimestampCommitTS, TxnMarkers: true})
+	c.Assert(recorder.msgs, check.HasLen, 3)
+	for _, msg := range recorder.msgs {
+		c.Assert(msg.Timestamp.UnixNano()/int64(time.Millisecond), check.Equals, physical)
+	}
+	c.Assert(eventTimeOf(commitTS).UTC().Format("2006-01-02 15:04:05.000"), check.Equals, "2019-11-20 10:30:00.123")
+
+	sync(&DBConfig{KafkaVersion: "0.10.0.0", KafkaTimestamp: KafkaTimestampProduceTime})
+	c.Assert(recorder.msgs, check.HasLen, 1)
+	c.Assert(recorder.msgs[0].Timestamp.IsZero(), check.IsTrue)
+
+	// the time of sending them is kept by default
+	sync(&DBConfig{KafkaVersion: "0.10.0.0"})
+	c.Assert(recorder.msgs, check.HasLen, 1)
+	c.Assert(recorder.msgs[0].Timestamp.IsZero(), check.IsTrue)
+}
+
+// ackProducer acks every message sent to it and records them
+type ackProducer struct {
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	done      chan struct{}
+
+	mu   sync.Mutex
+	msgs []*sarama.ProducerMessage
+}
+
+func newAckProducer() *ackProducer {
+	p := &ackProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage, 64),
+		errors:    make(chan *sarama.ProducerError),
+		done:      make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		for msg := range p.input {
+			p.mu.Lock()
+			p.msgs = append(p.msgs, msg)
+			p.mu.Unlock()
+			p.successes <- msg
+		}
+		close(p.successes)
+		close(p.errors)
+	}()
+	return p
+}
+
+func (p *ackProducer) AsyncClose() {
+	close(p.input)
+}
+
+func (p *ackProducer) Close() error {
+	p.AsyncClose()
+	<-p.done
+	return nil
+}
+
+func (p *ackProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *ackProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+func (p *ackProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+// binlogsOf returns the binlogs sent to topic in order
+func (p *ackProducer) binlogsOf(c *check.C, topic string) []*obinlog.Binlog {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var binlogs []*obinlog.Binlog
+	for _, msg := range p.msgs {
+		if msg.Topic != topic {
+			continue
+		}
+		data, err := msg.Value.Encode()
+		c.Assert(err, check.IsNil)
+		binlog := new(obinlog.Binlog)
+		c.Assert(binlog.Unmarshal(data), check.IsNil)
+		binlogs = append(binlogs, binlog)
+	}
+	return binlogs
+}
+
+func (s *kafkaSuite) TestResolvedTS(c *check.C) {
+	producer := newAckProducer()
+	oldNewAsyncProducer := newAsyncProducer
+	defer func() {
+		newAsyncProducer = oldNewAsyncProducer
+	}()
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		return producer, nil
+	}
+
+	_, err := NewKafka(&DBConfig{KafkaVersion: "0.8.2.0", KafkaResolvedTSInterval: -1}, nil)
+	c.Assert(err, check.ErrorMatches, "invalid kafka-resolved-ts-interval -1, must not be negative")
+
+	gen := &translator.BinlogGenrator{}
+	syncer, err := NewKafka(&DBConfig{KafkaVersion: "0.8.2.0", TopicName: "data", DDLTopicName: "schema", KafkaResolvedTSInterval: 10}, gen)
+	c.Assert(err, check.IsNil)
+
+	// waitResolved waits until the resolved ts is written to both topics n times
+	waitResolved := func(ts int64, n int) {
+		for i := 0; i < 500; i++ {
+			done := true
+			for _, topic := range []string{"data", "schema"} {
+				count := 0
+				for _, binlog := range producer.binlogsOf(c, topic) {
+					if binlog.Type == translator.SlaveBinlogResolved && binlog.CommitTs == ts {
+						count++
+					}
+				}
+				done = done && count >= n
+			}
+			if done {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Fatalf("the resolved ts %d is not written %d times", ts, n)
+	}
+
+	// nothing is resolved before the first change
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(producer.binlogsOf(c, "data"), check.HasLen, 0)
+
+	gen.SetInsert(c)
+	gen.TiBinlog.CommitTs = 100
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	<-syncer.Successes()
+	waitResolved(100, 1)
+
+	// the resolved ts advances without changes, and it's written periodically while idle
+	syncer.Resolve(200)
+	syncer.Resolve(150)
+	waitResolved(200, 2)
+
+	gen.SetDDL()
+	gen.TiBinlog.CommitTs = 300
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	<-syncer.Successes()
+	waitResolved(300, 1)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	for _, topic := range []string{"data", "schema"} {
+		// the resolved ts is monotonic, and no change up to it is written after it
+		var resolved int64
+		for _, binlog := range producer.binlogsOf(c, topic) {
+			if binlog.Type == translator.SlaveBinlogResolved {
+				c.Assert(binlog.CommitTs >= resolved, check.IsTrue)
+				resolved = binlog.CommitTs
+				continue
+			}
+			c.Assert(binlog.CommitTs > resolved, check.IsTrue)
+		}
+		c.Assert(resolved, check.Equals, int64(300))
+	}
+}
@@ -15,53 +15,249 @@ package sync
 
 import (
 	"database/sql"
+	"encoding/hex"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
 )
 
 var _ Syncer = &MysqlSyncer{}
 
+const (
+	// MetadataClusterID is the metadata field of the upstream cluster ID
+	MetadataClusterID = "cluster-id"
+	// MetadataCommitTS is the metadata field of the commit ts of the txn
+	MetadataCommitTS = "commit-ts"
+
+	// TiDBRowIDExclude doesn't replicate the _tidb_rowid
+	TiDBRowIDExclude = "exclude"
+	// TiDBRowIDInclude replicates the _tidb_rowid to the column of the same name in downstream
+	TiDBRowIDInclude = "include"
+
+	// TTLModeKeep replicates the TTL attributes of the DDLs as they're, in TiDB's executable comments,
+	// the TiDB supporting TTL runs the TTL jobs of the tables, MySQL and the others create normal tables
+	TTLModeKeep = "keep"
+	// TTLModeDisableJob replicates the TTL attributes with TTL_ENABLE set to 'OFF', the expired rows are
+	// only deleted by the TTL jobs of upstream, whose deletes are replicated
+	TTLModeDisableJob = "disable-job"
+
+	// MultiValuedIndexKeep replicates the multi-valued indexes on JSON arrays as they're, the downstream must
+	// support them, like TiDB 6.6+ and MySQL 8.0.17+
+	MultiValuedIndexKeep = "keep"
+	// MultiValuedIndexSkip removes the multi-valued indexes from the DDLs, the tables are created without them
+	// in downstream, and the DDLs only adding them change nothing
+	MultiValuedIndexSkip = "skip"
+
+	// ColumnPositionKeep replicates the positions `FIRST` and `AFTER col` of the column DDLs as they're
+	ColumnPositionKeep = "keep"
+	// ColumnPositionIgnore removes the positions from the column DDLs for the downstream whose columns differ,
+	// the column added is appended to the table and the column modified keeps its position in downstream
+	ColumnPositionIgnore = "ignore"
+
+	// IsolationLevelReadCommitted applies the txns in downstream with the isolation level READ COMMITTED
+	IsolationLevelReadCommitted = "read-committed"
+	// IsolationLevelRepeatableRead applies the txns in downstream with the isolation level REPEATABLE READ
+	IsolationLevelRepeatableRead = "repeatable-read"
+
+	// ZeroAutoIncrementKeep writes the 0 of the AUTO_INCREMENT columns carried in the binlog as it's, by adding
+	// NO_AUTO_VALUE_ON_ZERO to the sql_mode of the downstream sessions, instead of generating a new value
+	ZeroAutoIncrementKeep = "keep"
+	// ZeroAutoIncrementGenerate leaves the sql_mode as it's, so downstream generates a new value for the 0
+	// of the AUTO_INCREMENT columns unless its sql_mode has NO_AUTO_VALUE_ON_ZERO
+	ZeroAutoIncrementGenerate = "generate"
+
+	// SecondaryTSDownstreamTSO saves the TSO of TiDB downstream after applying the txns as the secondary ts
+	SecondaryTSDownstreamTSO = "downstream-tso"
+	// SecondaryTSNone doesn't save the secondary ts
+	SecondaryTSNone = "none"
+)
+
 // MysqlSyncer sync binlog to Mysql
 type MysqlSyncer struct {
 	db     *sql.DB
 	loader loader.Loader
+	// the session time zone of downstream
+	loc *time.Location
+	// the session time zones of the tables overriding it, nil if no table overrides it
+	tableLoc translator.LocationFunc
+	// nil if the dead letter is disabled
+	deadLetter *DeadLetter
+	// skip the rows failing to be decoded, they're written to the dead letter if it's enabled
+	quarantineRows bool
+	// increased by every quarantined row if it's not nil
+	quarantineCounter prometheus.Counter
+	// metadata field -> downstream column
+	metadataColumns map[string]string
+	clusterID       uint64
+	// set TTL_ENABLE of the TTL tables to 'OFF' in downstream
+	disableTTLJob bool
+	// remove the multi-valued indexes from the DDLs
+	skipMultiValuedIndex bool
+	// lower case schema.table -> the names of the multi-valued indexes removed
+	skippedIndexes map[string]map[string]struct{}
+	// remove the positions from the column DDLs
+	ignoreColumnPosition bool
+	// nil if the stats table is disabled
+	stats         *statsTable
+	statsInterval time.Duration
 
 	*baseSyncer
 }
 
 // should only be used for unit test to create mock db
-var createDB = loader.CreateDBWithSQLMode
+var createDB = loader.CreateDBWithKeepAlive
+
+// noAutoValueOnZeroSQL adds NO_AUTO_VALUE_ON_ZERO to the sql_mode of the session, which may be set by `sql-mode`
+const noAutoValueOnZeroSQL = "SET SESSION sql_mode = CONCAT_WS(',', NULLIF(@@SESSION.sql_mode, ''), 'NO_AUTO_VALUE_ON_ZERO')"
+
+// sessionInitSQL returns the statements executed on every new connection to downstream,
+// the ones setting up the session by the config are executed before init-sql, so they can still be overridden there.
+func sessionInitSQL(cfg *DBConfig) ([]string, error) {
+	var stmts []string
+	switch cfg.ZeroAutoIncrement {
+	case "", ZeroAutoIncrementKeep:
+		// the binlog carries the values of the AUTO_INCREMENT columns allocated by upstream,
+		// so the 0 in it is a literal one, e.g. inserted with NO_AUTO_VALUE_ON_ZERO in upstream
+		stmts = append(stmts, noAutoValueOnZeroSQL)
+	case ZeroAutoIncrementGenerate:
+	default:
+		return nil, errors.Errorf("invalid zero-auto-increment %s, must be %s or %s", cfg.ZeroAutoIncrement, ZeroAutoIncrementKeep, ZeroAutoIncrementGenerate)
+	}
+	if len(cfg.IsolationLevel) > 0 {
+		stmt, err := isolationLevelSQL(cfg.IsolationLevel)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		stmts = append(stmts, stmt)
+	}
+	return append(stmts, cfg.InitSQL...), nil
+}
+
+// isolationLevelSQL returns the statement setting the isolation level of the txns of the session,
+// it's executed on every new connection, so all txns applied by loader use the level.
+func isolationLevelSQL(level string) (string, error) {
+	switch level {
+	case IsolationLevelReadCommitted:
+		return "SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED", nil
+	case IsolationLevelRepeatableRead:
+		return "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ", nil
+	default:
+		return "", errors.Errorf("invalid isolation-level %s, must be %s or %s", level, IsolationLevelReadCommitted, IsolationLevelRepeatableRead)
+	}
+}
 
 // NewMysqlSyncer returns a instance of MysqlSyncer
-func NewMysqlSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, worker int, batchSize int, queryHistogramVec *prometheus.HistogramVec, sqlMode *string, destDBType string) (*MysqlSyncer, error) {
-	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, sqlMode)
+func NewMysqlSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, worker int, batchSize int, metrics *loader.MetricsGroup, sqlMode *string, destDBType string, info *loopbacksync.LoopBackSync, projections []loader.ColumnProjection, breaker *loader.CircuitBreaker, deadLetter *DeadLetter, quarantineCounter prometheus.Counter) (*MysqlSyncer, error) {
+	loc := time.Local
+	if len(cfg.TimeZone) > 0 {
+		var err error
+		loc, err = time.LoadLocation(cfg.TimeZone)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid time-zone %s", cfg.TimeZone)
+		}
+	}
+
+	tableLoc, err := newTableLocation(cfg.TableSessions)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
+	quote, err := pkgsql.ParseIdentifierQuote(cfg.IdentifierQuote)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for field, column := range cfg.MetadataColumns {
+		if field != MetadataClusterID && field != MetadataCommitTS {
+			return nil, errors.Errorf("unknown metadata field %s, valid fields are %s and %s", field, MetadataClusterID, MetadataCommitTS)
+		}
+		if len(column) == 0 {
+			return nil, errors.Errorf("empty column name of metadata field %s", field)
+		}
+	}
+
+	vars := make(map[string]string)
+	if sqlMode != nil {
+		vars["sql_mode"] = *sqlMode
+	}
+	if len(cfg.TimeZone) > 0 {
+		vars["time_zone"] = cfg.TimeZone
+	}
+	if cfg.DisableForeignKeyChecks {
+		// the rows referencing each other may be applied in any order by the concurrent workers
+		vars["foreign_key_checks"] = "OFF"
+	}
+
+	initSQL, err := sessionInitSQL(cfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, vars, initSQL, time.Duration(cfg.TCPKeepAlive)*time.Second)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	stats, err := newStatsTable(db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, errors.Annotate(err, "create stats table failed")
+	}
+	statsInterval := cfg.StatsTableInterval
+	if statsInterval <= 0 {
+		statsInterval = defaultStatsTableInterval
+	}
+
 	var opts []loader.Option
-	opts = append(opts, loader.WorkerCount(worker), loader.BatchSize(batchSize), loader.SaveAppliedTS(destDBType == "tidb"))
-	if queryHistogramVec != nil {
-		opts = append(opts, loader.Metrics(&loader.MetricsGroup{
-			QueryHistogramVec: queryHistogramVec,
-			EventCounterVec:   nil,
-		}))
+	opts = append(opts, loader.WorkerCount(worker), loader.BatchSize(batchSize), loader.SaveAppliedTS(cfg.SaveSecondaryTS(destDBType)), loader.LoopBackSyncInfo(info), loader.ColumnProjections(projections), loader.IgnoreErrorCodes(cfg.IgnoreErrorCodes), loader.Breaker(breaker), loader.StmtCacheSize(cfg.StmtCacheSize), loader.RelaxedOrder(cfg.RelaxedOrder), loader.IdentifierQuote(quote), loader.TableOptions(cfg.TableOptions()), loader.Warmup(cfg.Warmup), loader.CoalesceTxn(cfg.CoalesceTxn), loader.IncludeRowID(cfg.TiDBRowID == TiDBRowIDInclude), loader.ValidateSQL(cfg.ValidateSQL), loader.TableConcurrencies(cfg.LoaderTableConcurrencies()), loader.TableSessions(cfg.LoaderTableSessions()), loader.LockedTablePolicy(cfg.LockedTablePolicy), loader.NumericOverflow(cfg.NumericOverflow), loader.LogSampleInterval(time.Duration(cfg.LogSampleInterval)*time.Second), loader.Retry(cfg.LoaderRetryPolicy()), loader.Throttle(cfg.LoaderThrottlePolicy()), loader.BulkInsert(cfg.LoaderBulkInsertPolicy()), loader.CommitGroup(cfg.LoaderCommitGroupPolicy()), loader.CaseInsensitive(!cfg.CaseSensitive))
+	if destDBType == "tidb" {
+		opts = append(opts, loader.PreSplitTables(cfg.LoaderPreSplits()))
+	}
+	if metrics != nil {
+		opts = append(opts, loader.Metrics(metrics))
+	}
+	if deadLetter != nil {
+		opts = append(opts, loader.DeadLetter(deadLetter.Write))
 	}
 
 	loader, err := loader.NewLoader(db, opts...)
 	if err != nil {
+		db.Close()
 		return nil, errors.Trace(err)
 	}
 
 	s := &MysqlSyncer{
 		db:         db,
 		loader:     loader,
+		loc:        loc,
+		tableLoc:   tableLoc,
+		deadLetter: deadLetter,
 		baseSyncer: newBaseSyncer(tableInfoGetter),
+
+		quarantineRows:    cfg.QuarantineUndecodableRows,
+		quarantineCounter: quarantineCounter,
+
+		metadataColumns: cfg.MetadataColumns,
+		clusterID:       cfg.ClusterID,
+		disableTTLJob:   cfg.TTLMode == TTLModeDisableJob,
+
+		skipMultiValuedIndex: cfg.MultiValuedIndex == MultiValuedIndexSkip,
+		ignoreColumnPosition: cfg.ColumnPosition == ColumnPositionIgnore,
+
+		stats:         stats,
+		statsInterval: time.Duration(statsInterval) * time.Second,
 	}
 
 	go s.run()
@@ -69,6 +265,53 @@ func NewMysqlSyncer(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, w
 	return s, nil
 }
 
+// newTableLocation returns the session time zones of the tables overriding time-zone by `table-session`, nil if none
+// overrides it. The tables are matched like loader does, so the values are converted to the time zone applying them.
+func newTableLocation(sessions []TableSession) (translator.LocationFunc, error) {
+	type locationRule struct {
+		schema *regexp.Regexp
+		table  *regexp.Regexp
+		// nil if the table keeps the time zone of the session
+		loc *time.Location
+	}
+
+	var (
+		rules      []locationRule
+		overridden bool
+	)
+	for _, ts := range sessions {
+		var (
+			rule locationRule
+			err  error
+		)
+		if rule.schema, err = filter.CompilePattern(ts.Schema); err != nil {
+			return nil, errors.Annotatef(err, "invalid schema pattern %s in table session", ts.Schema)
+		}
+		if rule.table, err = filter.CompilePattern(ts.Table); err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %s in table session", ts.Table)
+		}
+		if len(ts.TimeZone) > 0 {
+			if rule.loc, err = time.LoadLocation(ts.TimeZone); err != nil {
+				return nil, errors.Annotatef(err, "invalid time-zone %s of table %s.%s", ts.TimeZone, ts.Schema, ts.Table)
+			}
+			overridden = true
+		}
+		rules = append(rules, rule)
+	}
+	if !overridden {
+		return nil, nil
+	}
+
+	return func(schema string, table string) *time.Location {
+		for _, rule := range rules {
+			if rule.schema.MatchString(schema) && rule.table.MatchString(table) {
+				return rule.loc
+			}
+		}
+		return nil
+	}, nil
+}
+
 // SetSafeMode make the MysqlSyncer to use safe mode or not
 func (m *MysqlSyncer) SetSafeMode(mode bool) {
 	m.loader.SetSafeMode(mode)
@@ -76,12 +319,22 @@ func (m *MysqlSyncer) SetSafeMode(mode bool) {
 
 // Sync implements Syncer interface
 func (m *MysqlSyncer) Sync(item *Item) error {
-	txn, err := translator.TiBinlogToTxn(m.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	txn, err := translator.TiBinlogToTxnWithQuarantine(m.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue, m.loc, m.tableLoc, m.quarantineFunc(item))
 	if err != nil {
 		return errors.Trace(err)
 	}
 
 	txn.Metadata = item
+	m.setMetadataValues(txn, item)
+	if m.disableTTLJob && txn.DDL != nil {
+		txn.DDL.SQL = util.DisableTTLJob(txn.DDL.SQL)
+	}
+	if m.skipMultiValuedIndex && txn.DDL != nil {
+		txn.DDL.SQL = m.skipMultiValuedIndexes(txn.DDL)
+	}
+	if m.ignoreColumnPosition && txn.DDL != nil {
+		txn.DDL.SQL = util.IgnoreColumnPositions(txn.DDL.SQL)
+	}
 
 	select {
 	case <-m.errCh:
@@ -91,6 +344,80 @@ func (m *MysqlSyncer) Sync(item *Item) error {
 	}
 }
 
+// skipMultiValuedIndexes removes the multi-valued indexes from the DDL, and the DROP INDEX of the ones removed before,
+// which don't exist in downstream. The removed ones are remembered in memory, so they're forgotten after restarting.
+func (m *MysqlSyncer) skipMultiValuedIndexes(ddl *loader.DDL) string {
+	if m.skippedIndexes == nil {
+		m.skippedIndexes = make(map[string]map[string]struct{})
+	}
+	table := strings.ToLower(ddl.Database + "." + ddl.Table)
+	skipped := m.skippedIndexes[table]
+
+	sql := util.SkipDropIndexes(ddl.SQL, func(name string) bool {
+		if _, ok := skipped[name]; !ok {
+			return false
+		}
+		delete(skipped, name)
+		return true
+	})
+	for _, name := range util.MultiValuedIndexNames(sql) {
+		if skipped == nil {
+			skipped = make(map[string]struct{})
+			m.skippedIndexes[table] = skipped
+		}
+		skipped[name] = struct{}{}
+	}
+	return util.SkipMultiValuedIndexes(sql)
+}
+
+// quarantineFunc returns the function skipping the undecodable rows of item, nil if it's disabled
+func (m *MysqlSyncer) quarantineFunc(item *Item) translator.QuarantineFunc {
+	if !m.quarantineRows {
+		return nil
+	}
+
+	return func(row *translator.UndecodableRow) error {
+		log.Error("quarantine undecodable row, it's lost in downstream",
+			zap.Int64("start ts", item.Binlog.GetStartTs()),
+			zap.Int64("commit ts", item.Binlog.GetCommitTs()),
+			zap.String("schema", row.Schema),
+			zap.String("table", row.Table),
+			zap.Stringer("type", row.Type),
+			zap.String("row", hex.EncodeToString(row.Row)),
+			zap.Error(row.Err))
+		if m.quarantineCounter != nil {
+			m.quarantineCounter.Inc()
+		}
+		if m.deadLetter == nil {
+			return nil
+		}
+		return errors.Trace(m.deadLetter.WriteUndecodableRow(item, row))
+	}
+}
+
+// setMetadataValues stamps the inserted and updated rows with the metadata of the txn,
+// the deleted rows are left alone as the values of them are used to match the rows.
+func (m *MysqlSyncer) setMetadataValues(txn *loader.Txn, item *Item) {
+	if len(m.metadataColumns) == 0 {
+		return
+	}
+
+	for _, dml := range txn.DMLs {
+		if dml.Tp == loader.DeleteDMLType {
+			continue
+		}
+		dml.OptionalValues = make(map[string]interface{}, len(m.metadataColumns))
+		for field, column := range m.metadataColumns {
+			switch field {
+			case MetadataClusterID:
+				dml.OptionalValues[column] = m.clusterID
+			case MetadataCommitTS:
+				dml.OptionalValues[column] = item.Binlog.GetCommitTs()
+			}
+		}
+	}
+}
+
 // Close implements Syncer interface
 func (m *MysqlSyncer) Close() error {
 	m.loader.Close()
@@ -103,6 +430,17 @@ func (m *MysqlSyncer) Close() error {
 func (m *MysqlSyncer) run() {
 	var wg sync.WaitGroup
 
+	// upsert the stats table
+	var statsQuit chan struct{}
+	if m.stats != nil {
+		statsQuit = make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.stats.run(m.statsInterval, statsQuit)
+		}()
+	}
+
 	// handle success
 	wg.Add(1)
 	go func() {
@@ -111,10 +449,16 @@ func (m *MysqlSyncer) run() {
 		for txn := range m.loader.Successes() {
 			item := txn.Metadata.(*Item)
 			item.AppliedTS = txn.AppliedTS
+			if m.stats != nil {
+				m.stats.observe(txn, item.Binlog.GetCommitTs(), time.Now())
+			}
 			m.success <- item
 		}
 		close(m.success)
 		log.Info("Successes chan quit")
+		if statsQuit != nil {
+			close(statsQuit)
+		}
 	}()
 
 	// run loader
@@ -122,5 +466,10 @@ func (m *MysqlSyncer) run() {
 
 	wg.Wait()
 	m.db.Close()
+	if m.deadLetter != nil {
+		if cerr := m.deadLetter.Close(); cerr != nil {
+			log.Error("close dead letter failed", zap.Error(cerr))
+		}
+	}
 	m.setErr(err)
 }
@@ -13,6 +13,11 @@
 package sync
 
 import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"regexp"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -20,6 +25,9 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var _ = check.Suite(&mysqlSuite{})
@@ -87,3 +95,401 @@ func (s *mysqlSuite) TestMySQLSyncerAvoidBlock(c *check.C) {
 		c.Fatal("mysql syncer hasn't synced item in 1s after some error occurs in loader")
 	}
 }
+
+func (s *mysqlSuite) TestNewMysqlSyncerWithTimeZone(c *check.C) {
+	var timeZone string
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, vars map[string]string, _ []string, _ time.Duration) (db *sql.DB, err error) {
+		timeZone = vars["time_zone"]
+		db, _, err = sqlmock.New()
+		return
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	cfg := &DBConfig{TimeZone: "Mars/Olympus_Mons"}
+	_, err := NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, ".*invalid time-zone Mars/Olympus_Mons.*")
+
+	cfg.TimeZone = "Asia/Shanghai"
+	syncer, err := NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(timeZone, check.Equals, "Asia/Shanghai")
+	c.Assert(syncer.loc.String(), check.Equals, "Asia/Shanghai")
+	syncer.Close()
+
+	cfg.TimeZone = ""
+	syncer, err = NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(timeZone, check.Equals, "")
+	c.Assert(syncer.loc, check.Equals, time.Local)
+	syncer.Close()
+}
+
+func (s *mysqlSuite) TestNewMysqlSyncerWithTableTimeZone(c *check.C) {
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, _ map[string]string, _ []string, _ time.Duration) (db *sql.DB, err error) {
+		db, _, err = sqlmock.New()
+		return
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	mode := "ALLOW_INVALID_DATES"
+	cfg := &DBConfig{TableSessions: []TableSession{{Schema: "legacy", Table: "~^log_", TimeZone: "Mars/Olympus_Mons"}}}
+	_, err := NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, ".*invalid time-zone Mars/Olympus_Mons of table legacy.~\\^log_.*")
+
+	// the tables only overriding sql_mode keep the time zone of the session
+	cfg.TableSessions = []TableSession{{Schema: "legacy", Table: "~^log_", SQLMode: &mode}}
+	syncer, err := NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(syncer.tableLoc, check.IsNil)
+	syncer.Close()
+
+	cfg.TableSessions = []TableSession{
+		{Schema: "legacy", Table: "log_0", SQLMode: &mode},
+		{Schema: "legacy", Table: "~^log_", TimeZone: "Asia/Shanghai"},
+	}
+	syncer, err = NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(syncer.tableLoc("legacy", "log_1").String(), check.Equals, "Asia/Shanghai")
+	// the first matched one is used
+	c.Assert(syncer.tableLoc("legacy", "log_0"), check.IsNil)
+	c.Assert(syncer.tableLoc("test", "log_1"), check.IsNil)
+	syncer.Close()
+}
+
+func (s *mysqlSuite) TestNewMysqlSyncerDisableForeignKeyChecks(c *check.C) {
+	var sessionVars map[string]string
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, vars map[string]string, _ []string, _ time.Duration) (db *sql.DB, err error) {
+		sessionVars = vars
+		db, _, err = sqlmock.New()
+		return
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	sqlMode := "STRICT_TRANS_TABLES"
+	cfg := &DBConfig{DisableForeignKeyChecks: true}
+	syncer, err := NewMysqlSyncer(cfg, nil, 1, 1, nil, &sqlMode, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sessionVars, check.DeepEquals, map[string]string{"sql_mode": sqlMode, "foreign_key_checks": "OFF"})
+	syncer.Close()
+
+	cfg.DisableForeignKeyChecks = false
+	syncer, err = NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sessionVars, check.HasLen, 0)
+	syncer.Close()
+}
+
+func (s *mysqlSuite) TestNewMysqlSyncerTCPKeepAlive(c *check.C) {
+	var keepAlive time.Duration
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, _ map[string]string, _ []string, period time.Duration) (db *sql.DB, err error) {
+		keepAlive = period
+		db, _, err = sqlmock.New()
+		return
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	syncer, err := NewMysqlSyncer(&DBConfig{TCPKeepAlive: 30}, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(keepAlive, check.Equals, 30*time.Second)
+	syncer.Close()
+
+	syncer, err = NewMysqlSyncer(&DBConfig{}, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(keepAlive, check.Equals, time.Duration(0))
+	syncer.Close()
+}
+
+func (s *mysqlSuite) TestNewMysqlSyncerIsolationLevel(c *check.C) {
+	mockDB, mock, err := sqlmock.NewWithDSN("isolation_level_test")
+	c.Assert(err, check.IsNil)
+	defer mockDB.Close()
+
+	var initSQL []string
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, _ map[string]string, stmts []string, _ time.Duration) (*sql.DB, error) {
+		initSQL = stmts
+		return pkgsql.OpenDSNWithInitSQL("sqlmock", "isolation_level_test", stmts)
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	cfg := &DBConfig{IsolationLevel: "serializable"}
+	_, err = NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, "invalid isolation-level serializable, must be read-committed or repeatable-read")
+
+	// the isolation level is set on the session before init-sql and the txns
+	cfg = &DBConfig{IsolationLevel: IsolationLevelReadCommitted, InitSQL: []string{"SET SESSION wait_timeout = 3600"}}
+	syncer, err := NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "tidb", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(initSQL, check.DeepEquals, []string{noAutoValueOnZeroSQL, "SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED", "SET SESSION wait_timeout = 3600"})
+	mock.ExpectExec(regexp.QuoteMeta(noAutoValueOnZeroSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION wait_timeout = 3600").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	tx, err := syncer.db.Begin()
+	c.Assert(err, check.IsNil)
+	c.Assert(tx.Commit(), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	syncer.Close()
+
+	level, err := isolationLevelSQL(IsolationLevelRepeatableRead)
+	c.Assert(err, check.IsNil)
+	c.Assert(level, check.Equals, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+
+	// the default level of downstream is used
+	cfg = &DBConfig{InitSQL: []string{"SET SESSION wait_timeout = 3600"}, ZeroAutoIncrement: ZeroAutoIncrementGenerate}
+	syncer, err = NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(initSQL, check.DeepEquals, cfg.InitSQL)
+	syncer.Close()
+}
+
+func (s *mysqlSuite) TestZeroAutoIncrement(c *check.C) {
+	var sessionVars map[string]string
+	var initSQL []string
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, vars map[string]string, stmts []string, _ time.Duration) (db *sql.DB, err error) {
+		sessionVars, initSQL = vars, stmts
+		db, _, err = sqlmock.New()
+		return
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	// NO_AUTO_VALUE_ON_ZERO is added to the sql_mode set by `sql-mode` on connecting
+	sqlMode := "STRICT_TRANS_TABLES"
+	syncer, err := NewMysqlSyncer(&DBConfig{}, nil, 1, 1, nil, &sqlMode, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sessionVars["sql_mode"], check.Equals, sqlMode)
+	c.Assert(initSQL, check.DeepEquals, []string{noAutoValueOnZeroSQL})
+	syncer.Close()
+
+	syncer, err = NewMysqlSyncer(&DBConfig{ZeroAutoIncrement: ZeroAutoIncrementKeep, InitSQL: []string{"SET SESSION wait_timeout = 3600"}}, nil, 1, 1, nil, nil, "tidb", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(initSQL, check.DeepEquals, []string{noAutoValueOnZeroSQL, "SET SESSION wait_timeout = 3600"})
+	syncer.Close()
+
+	syncer, err = NewMysqlSyncer(&DBConfig{ZeroAutoIncrement: ZeroAutoIncrementGenerate}, nil, 1, 1, nil, nil, "tidb", nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(initSQL, check.HasLen, 0)
+	syncer.Close()
+
+	_, err = NewMysqlSyncer(&DBConfig{ZeroAutoIncrement: "null"}, nil, 1, 1, nil, nil, "tidb", nil, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, "invalid zero-auto-increment null, must be keep or generate")
+}
+
+func (s *mysqlSuite) TestMetadataColumns(c *check.C) {
+	fakeMySQLLoaderImpl := &fakeMySQLLoader{
+		successes: make(chan *loader.Txn),
+		input:     make(chan *loader.Txn, 1),
+	}
+	gen := &translator.BinlogGenrator{}
+	syncer := &MysqlSyncer{
+		loader:          fakeMySQLLoaderImpl,
+		loc:             time.Local,
+		baseSyncer:      newBaseSyncer(gen),
+		metadataColumns: map[string]string{MetadataClusterID: "_cluster_id", MetadataCommitTS: "_commit_ts"},
+		clusterID:       8012,
+	}
+
+	sync := func() *loader.Txn {
+		c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+		return <-fakeMySQLLoaderImpl.input
+	}
+
+	gen.SetInsert(c)
+	txn := sync()
+	c.Assert(txn.DMLs, check.HasLen, 1)
+	c.Assert(txn.DMLs[0].OptionalValues, check.DeepEquals, map[string]interface{}{
+		"_cluster_id": uint64(8012),
+		"_commit_ts":  gen.TiBinlog.GetCommitTs(),
+	})
+
+	// the values of deleted rows are used to match the rows, they're not stamped
+	gen.SetDelete(c)
+	txn = sync()
+	c.Assert(txn.DMLs, check.HasLen, 1)
+	c.Assert(txn.DMLs[0].OptionalValues, check.IsNil)
+}
+
+func (s *mysqlSuite) TestDisableTTLJob(c *check.C) {
+	fakeMySQLLoaderImpl := &fakeMySQLLoader{
+		successes: make(chan *loader.Txn),
+		input:     make(chan *loader.Txn, 1),
+	}
+	gen := &translator.BinlogGenrator{}
+	syncer := &MysqlSyncer{
+		loader:        fakeMySQLLoaderImpl,
+		loc:           time.Local,
+		baseSyncer:    newBaseSyncer(gen),
+		disableTTLJob: true,
+	}
+
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("create table t(c datetime) TTL = `c` + INTERVAL 1 DAY TTL_ENABLE = 'ON'")
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn := <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "create table t(c datetime) /*T![ttl] TTL = `c` + INTERVAL 1 DAY */ /*T![ttl] TTL_ENABLE='OFF' */")
+
+	// the TTL jobs of downstream are kept disabled after TTL is changed
+	gen.TiBinlog.DdlQuery = []byte("alter table t TTL = `c` + INTERVAL 7 DAY")
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "alter table t /*T![ttl] TTL = `c` + INTERVAL 7 DAY */ /*T![ttl] TTL_ENABLE='OFF' */")
+}
+
+func (s *mysqlSuite) TestSkipMultiValuedIndex(c *check.C) {
+	fakeMySQLLoaderImpl := &fakeMySQLLoader{
+		successes: make(chan *loader.Txn),
+		input:     make(chan *loader.Txn, 1),
+	}
+	gen := &translator.BinlogGenrator{}
+	syncer := &MysqlSyncer{
+		loader:               fakeMySQLLoaderImpl,
+		loc:                  time.Local,
+		baseSyncer:           newBaseSyncer(gen),
+		skipMultiValuedIndex: true,
+	}
+
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("CREATE TABLE t (id int primary key, j json, INDEX zips((CAST(j->'$.zip' AS UNSIGNED ARRAY))))")
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn := <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "CREATE TABLE t (id int primary key, j json)")
+
+	// the DDL only adding a multi-valued index changes nothing
+	gen.TiBinlog.DdlQuery = []byte("CREATE INDEX zips ON t ((CAST(j->'$.zip' AS UNSIGNED ARRAY)))")
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "ALTER TABLE t")
+
+	// the indexes removed don't exist in downstream, so dropping them changes nothing either
+	for _, sql := range []string{"ALTER TABLE t DROP INDEX zips", "DROP INDEX ZIPS ON t"} {
+		gen.TiBinlog.DdlQuery = []byte("CREATE INDEX zips ON t ((CAST(j->'$.zip' AS UNSIGNED ARRAY)))")
+		c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+		<-fakeMySQLLoaderImpl.input
+		gen.TiBinlog.DdlQuery = []byte(sql)
+		c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+		txn = <-fakeMySQLLoaderImpl.input
+		c.Assert(txn.DDL.SQL, check.Equals, "ALTER TABLE t")
+	}
+	// the index of the same name created later is dropped
+	gen.TiBinlog.DdlQuery = []byte("ALTER TABLE t DROP INDEX zips")
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "ALTER TABLE t DROP INDEX zips")
+
+	// they're kept by default
+	syncer.skipMultiValuedIndex = false
+	gen.TiBinlog.DdlQuery = []byte("ALTER TABLE t ADD INDEX zips((CAST(j->'$.zip' AS UNSIGNED ARRAY)))")
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "ALTER TABLE t ADD INDEX zips((CAST(j->'$.zip' AS UNSIGNED ARRAY)))")
+}
+
+func (s *mysqlSuite) TestIgnoreColumnPosition(c *check.C) {
+	fakeMySQLLoaderImpl := &fakeMySQLLoader{
+		successes: make(chan *loader.Txn),
+		input:     make(chan *loader.Txn, 1),
+	}
+	gen := &translator.BinlogGenrator{}
+	syncer := &MysqlSyncer{
+		loader:               fakeMySQLLoaderImpl,
+		loc:                  time.Local,
+		baseSyncer:           newBaseSyncer(gen),
+		ignoreColumnPosition: true,
+	}
+
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("ALTER TABLE `test`.`t` ADD COLUMN `c` INT AFTER `a`, ADD COLUMN `d` INT FIRST")
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn := <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "ALTER TABLE `test`.`t` ADD COLUMN `c` INT, ADD COLUMN `d` INT")
+
+	// they're kept by default
+	syncer.ignoreColumnPosition = false
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "ALTER TABLE `test`.`t` ADD COLUMN `c` INT AFTER `a`, ADD COLUMN `d` INT FIRST")
+}
+
+func (s *mysqlSuite) TestInvalidMetadataColumns(c *check.C) {
+	cfg := &DBConfig{MetadataColumns: map[string]string{"start-ts": "_start_ts"}}
+	_, err := NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, "unknown metadata field start-ts.*")
+
+	cfg = &DBConfig{MetadataColumns: map[string]string{MetadataCommitTS: ""}}
+	_, err = NewMysqlSyncer(cfg, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, "empty column name of metadata field commit-ts")
+}
+
+func (s *mysqlSuite) TestSaveSecondaryTS(c *check.C) {
+	cfg := &DBConfig{}
+	c.Assert(cfg.SaveSecondaryTS("tidb"), check.IsTrue)
+	c.Assert(cfg.SaveSecondaryTS("mysql"), check.IsFalse)
+
+	cfg.SecondaryTS = SecondaryTSNone
+	c.Assert(cfg.SaveSecondaryTS("tidb"), check.IsFalse)
+	cfg.SecondaryTS = SecondaryTSDownstreamTSO
+	c.Assert(cfg.SaveSecondaryTS("tidb"), check.IsTrue)
+}
+
+func (s *mysqlSuite) TestQuarantineUndecodableRow(c *check.C) {
+	gen := &translator.BinlogGenrator{}
+	gen.SetInsert(c)
+	mut := &gen.PV.Mutations[0]
+	corrupt := []byte("corrupt row")
+	mut.InsertedRows = append(mut.InsertedRows, corrupt, mut.InsertedRows[0])
+	mut.Sequence = append(mut.Sequence, pb.MutationType_Insert, pb.MutationType_Insert)
+
+	name := path.Join(c.MkDir(), "dead_letter.log")
+	deadLetter, err := NewDeadLetter(&DBConfig{DeadLetter: DeadLetterConfig{Enable: true, Type: DeadLetterFile, Path: name}}, nil)
+	c.Assert(err, check.IsNil)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_quarantined_row_count"})
+	fakeLoader := &fakeMySQLLoader{input: make(chan *loader.Txn, 1)}
+	syncer := &MysqlSyncer{
+		loader:            fakeLoader,
+		deadLetter:        deadLetter,
+		quarantineRows:    true,
+		quarantineCounter: counter,
+		baseSyncer:        newBaseSyncer(gen),
+	}
+
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.IsNil)
+	txn := <-fakeLoader.input
+	// the rows before and after the undecodable row are applied
+	c.Assert(txn.DMLs, check.HasLen, 2)
+	c.Assert(txn.DMLs[0].Values, check.DeepEquals, txn.DMLs[1].Values)
+	c.Assert(txn.Metadata, check.Equals, item)
+	c.Assert(counterValue(c, counter), check.Equals, float64(1))
+
+	c.Assert(deadLetter.Close(), check.IsNil)
+	data, err := ioutil.ReadFile(name)
+	c.Assert(err, check.IsNil)
+	record := new(deadLetterRecord)
+	c.Assert(json.Unmarshal(data, record), check.IsNil)
+	c.Assert(record.StartTS, check.Equals, gen.TiBinlog.StartTs)
+	c.Assert(record.CommitTS, check.Equals, gen.TiBinlog.CommitTs)
+	c.Assert(record.Error, check.Not(check.Equals), "")
+	c.Assert(record.UndecodableRow, check.DeepEquals, &deadLetterRow{Database: "test", Table: "account", Type: "insert", Data: corrupt})
+
+	// the txn fails without quarantine
+	syncer.quarantineRows = false
+	c.Assert(syncer.Sync(item), check.ErrorMatches, "gen insert fail.*")
+}
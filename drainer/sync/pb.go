@@ -25,12 +25,14 @@ var _ Syncer = &pbSyncer{}
 
 type pbSyncer struct {
 	binlogger binlogfile.Binlogger
+	// write the markers before and after the binlog of every txn
+	txnMarkers bool
 
 	*baseSyncer
 }
 
-// NewPBSyncer sync binlog to files
-func NewPBSyncer(dir string, tableInfoGetter translator.TableInfoGetter) (*pbSyncer, error) {
+// NewPBSyncer sync binlog to files, the binlog of every txn is bracketed by the txn markers if txnMarkers is true.
+func NewPBSyncer(dir string, tableInfoGetter translator.TableInfoGetter, txnMarkers bool) (*pbSyncer, error) {
 	binlogger, err := binlogfile.OpenBinlogger(dir)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -38,6 +40,7 @@ func NewPBSyncer(dir string, tableInfoGetter translator.TableInfoGetter) (*pbSyn
 
 	s := &pbSyncer{
 		binlogger:  binlogger,
+		txnMarkers: txnMarkers,
 		baseSyncer: newBaseSyncer(tableInfoGetter),
 	}
 
@@ -50,9 +53,16 @@ func (p *pbSyncer) Sync(item *Item) error {
 		return errors.Trace(err)
 	}
 
-	err = p.saveBinlog(pbBinlog)
-	if err != nil {
-		return errors.Trace(err)
+	binlogs := []*pb.Binlog{pbBinlog}
+	if p.txnMarkers {
+		begin, commit := translator.PbTxnMarkers(pbBinlog.CommitTs)
+		binlogs = []*pb.Binlog{begin, pbBinlog, commit}
+	}
+
+	for _, binlog := range binlogs {
+		if err = p.saveBinlog(binlog); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
 	p.success <- item
@@ -0,0 +1,70 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	tb "github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = check.Suite(&pbSuite{})
+
+type pbSuite struct{}
+
+func (s *pbSuite) TestTxnMarkers(c *check.C) {
+	gen := &translator.BinlogGenrator{}
+	dir := c.MkDir()
+	syncer, err := NewPBSyncer(dir, gen, true)
+	c.Assert(err, check.IsNil)
+	go func() {
+		for range syncer.Successes() {
+		}
+	}()
+
+	gen.SetInsert(c)
+	gen.TiBinlog.CommitTs = 100
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	gen.SetDDL()
+	gen.TiBinlog.CommitTs = 200
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	binlogger, err := binlogfile.OpenBinlogger(dir)
+	c.Assert(err, check.IsNil)
+	defer binlogger.Close()
+	entities, err := binlogger.ReadFrom(tb.Pos{}, 10)
+	c.Assert(err, check.IsNil)
+
+	type record struct {
+		tp       pb.BinlogType
+		commitTS int64
+	}
+	var records []record
+	for _, entity := range entities {
+		binlog := new(pb.Binlog)
+		c.Assert(binlog.Unmarshal(entity.Payload), check.IsNil)
+		records = append(records, record{binlog.Tp, binlog.CommitTs})
+		if binlog.Tp == pb.BinlogType_DML {
+			c.Assert(binlog.DmlData.Events, check.HasLen, 1)
+		}
+	}
+	// the markers bracket the binlog of every txn
+	c.Assert(records, check.DeepEquals, []record{
+		{pb.BinlogType_BEGIN, 100}, {pb.BinlogType_DML, 100}, {pb.BinlogType_COMMIT, 100},
+		{pb.BinlogType_BEGIN, 200}, {pb.BinlogType_DDL, 200}, {pb.BinlogType_COMMIT, 200},
+	})
+}
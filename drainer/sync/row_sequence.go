@@ -0,0 +1,58 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"fmt"
+
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+// RowSequencesKey is the JSON field of the JSON-Lines files and the header of the kafka messages
+// carrying the sequence numbers of the row changes of the binlog
+const RowSequencesKey = "row_sequences"
+
+// rowSequence returns the sequence number of the index-th row change of the txn committed at commitTS,
+// it's the decimal commitTS * 10^10 + index, zero-padded to 29 digits. It exceeds 64 bits, so it's a string,
+// and the strings are ordered the same way as the numbers. The txns are emitted in the order of the commit ts,
+// so the sequence numbers are strictly increasing across the stream, even across the topics or the partitions.
+func rowSequence(commitTS int64, index int) string {
+	return fmt.Sprintf("%019d%010d", commitTS, index)
+}
+
+// rowSequences returns the sequence numbers of the row changes of binlog, in the order of the tables and
+// the mutations of them in it. The DDL is a single change, and the txn markers carry no change.
+func rowSequences(binlog *obinlog.Binlog) []string {
+	switch binlog.Type {
+	case obinlog.BinlogType_DDL:
+		return []string{rowSequence(binlog.CommitTs, 0)}
+	case obinlog.BinlogType_DML:
+	default:
+		return nil
+	}
+
+	var seqs []string
+	for _, table := range binlog.GetDmlData().GetTables() {
+		for range table.Mutations {
+			seqs = append(seqs, rowSequence(binlog.CommitTs, len(seqs)))
+		}
+	}
+	return seqs
+}
+
+// sequencedBinlog is the JSON of the binlog with the sequence numbers of the row changes of it
+type sequencedBinlog struct {
+	*obinlog.Binlog
+	RowSequences []string `json:"row_sequences,omitempty"`
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+)
+
+var _ = check.Suite(&rowSequenceSuite{})
+
+type rowSequenceSuite struct{}
+
+// assertStrictlyIncreasing asserts the sequence numbers are strictly increasing both as strings and as numbers
+func assertStrictlyIncreasing(c *check.C, seqs []string) {
+	for i := 1; i < len(seqs); i++ {
+		c.Assert(seqs[i-1] < seqs[i], check.IsTrue, check.Commentf("%s >= %s", seqs[i-1], seqs[i]))
+		prev, ok := new(big.Int).SetString(seqs[i-1], 10)
+		c.Assert(ok, check.IsTrue)
+		cur, ok := new(big.Int).SetString(seqs[i], 10)
+		c.Assert(ok, check.IsTrue)
+		c.Assert(prev.Cmp(cur), check.Equals, -1)
+	}
+}
+
+func (s *rowSequenceSuite) TestRowSequences(c *check.C) {
+	dml := &obinlog.Binlog{Type: obinlog.BinlogType_DML, CommitTs: 100, DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{
+		{Mutations: []*obinlog.TableMutation{{}, {}}},
+		{Mutations: []*obinlog.TableMutation{{}}},
+	}}}
+	c.Assert(rowSequences(dml), check.DeepEquals, []string{
+		"00000000000000001000000000000",
+		"00000000000000001000000000001",
+		"00000000000000001000000000002",
+	})
+	ddl := &obinlog.Binlog{Type: obinlog.BinlogType_DDL, CommitTs: 101}
+	c.Assert(rowSequences(ddl), check.DeepEquals, []string{"00000000000000001010000000000"})
+	begin, commit := translator.SlaveTxnMarkers(102)
+	c.Assert(rowSequences(begin), check.IsNil)
+	c.Assert(rowSequences(commit), check.IsNil)
+
+	// the txns with adjacent commit ts don't overlap
+	next := &obinlog.Binlog{Type: obinlog.BinlogType_DML, CommitTs: 1<<62 + 1, DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{
+		{Mutations: []*obinlog.TableMutation{{}, {}}},
+	}}}
+	last := &obinlog.Binlog{Type: obinlog.BinlogType_DML, CommitTs: 1<<62 + 2, DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{
+		{Mutations: []*obinlog.TableMutation{{}}},
+	}}}
+	var seqs []string
+	for _, binlog := range []*obinlog.Binlog{dml, ddl, next, last} {
+		seqs = append(seqs, rowSequences(binlog)...)
+	}
+	c.Assert(seqs, check.HasLen, 7)
+	assertStrictlyIncreasing(c, seqs)
+}
+
+func (s *rowSequenceSuite) TestJSONLRowSequences(c *check.C) {
+	dir := c.MkDir()
+	gen := &translator.BinlogGenrator{}
+	syncer, err := NewJSONLSyncer(dir, gen, true, nil, true)
+	c.Assert(err, check.IsNil)
+	for _, ts := range []int64{100, 101, 103} {
+		syncJSONL(c, syncer, gen, ts)
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+
+	f, err := os.Open(filepath.Join(dir, "binlog-0000000000000000.jsonl.gz"))
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+
+	var seqs []string
+	var lines int
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var line struct {
+			Type         obinlog.BinlogType `json:"type"`
+			RowSequences []string           `json:"row_sequences"`
+		}
+		c.Assert(json.Unmarshal(scanner.Bytes(), &line), check.IsNil)
+		if line.Type == obinlog.BinlogType_DML {
+			c.Assert(line.RowSequences, check.HasLen, 1)
+		} else {
+			c.Assert(line.RowSequences, check.IsNil)
+		}
+		seqs = append(seqs, line.RowSequences...)
+		lines++
+	}
+	c.Assert(scanner.Err(), check.IsNil)
+	c.Assert(lines, check.Equals, 9)
+	c.Assert(seqs, check.DeepEquals, []string{rowSequence(100, 0), rowSequence(101, 0), rowSequence(103, 0)})
+	assertStrictlyIncreasing(c, seqs)
+}
+
+func (s *rowSequenceSuite) TestKafkaRowSequences(c *check.C) {
+	var recorder *topicRecorder
+	oldNewAsyncProducer := newAsyncProducer
+	defer func() {
+		newAsyncProducer = oldNewAsyncProducer
+	}()
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		producer := mocks.NewAsyncProducer(c, config)
+		for i := 0; i < 6; i++ {
+			producer.ExpectInputAndSucceed()
+		}
+		recorder = newTopicRecorder(producer)
+		return recorder, nil
+	}
+
+	// the headers are dropped before kafka 0.11.0.0
+	gen := &translator.BinlogGenrator{}
+	_, err := NewKafka(&DBConfig{KafkaVersion: "0.10.2.0", RowSequences: true}, gen)
+	c.Assert(err, check.ErrorMatches, "row-sequences requires the message headers supported since kafka 0.11.0.0, but kafka-version is 0.10.2.0")
+
+	syncer, err := NewKafka(&DBConfig{KafkaVersion: "0.11.0.0", RowSequences: true, TxnMarkers: true}, gen)
+	c.Assert(err, check.IsNil)
+	gen.SetInsert(c)
+	gen.TiBinlog.CommitTs = 100
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+	c.Assert(syncer.Sync(item), check.IsNil)
+	gen.SetDDL()
+	gen.TiBinlog.CommitTs = 101
+	c.Assert(syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table}), check.IsNil)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-syncer.Successes():
+		case <-time.After(time.Second):
+			c.Fatal("the txn is not reported as success")
+		}
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+
+	// the markers before and after the txns carry no header
+	c.Assert(recorder.msgs, check.HasLen, 6)
+	var seqs []string
+	for i, msg := range recorder.msgs {
+		if i%3 != 1 {
+			c.Assert(msg.Headers, check.HasLen, 0)
+			continue
+		}
+		c.Assert(msg.Headers, check.HasLen, 1)
+		c.Assert(string(msg.Headers[0].Key), check.Equals, RowSequencesKey)
+		var msgSeqs []string
+		c.Assert(json.Unmarshal(msg.Headers[0].Value, &msgSeqs), check.IsNil)
+		seqs = append(seqs, msgSeqs...)
+	}
+	c.Assert(seqs, check.DeepEquals, []string{rowSequence(100, 0), rowSequence(101, 0)})
+	assertStrictlyIncreasing(c, seqs)
+}
@@ -0,0 +1,341 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+// snapshotSink is implemented by the syncers writing the binlogs of the kafka format,
+// so the binlogs of many txns can be merged before they're written.
+type snapshotSink interface {
+	Syncer
+	// translate translates the binlog of item to the kafka format
+	translate(item *Item) (*obinlog.Binlog, error)
+	// syncBinlog writes the binlog translated from items, they're reported as success once it's written
+	syncBinlog(binlog *obinlog.Binlog, items ...*Item) error
+}
+
+var _ snapshotSink = &KafkaSyncer{}
+var _ snapshotSink = &jsonlSyncer{}
+
+// snapshotSyncer merges the row changes of the DML txns in every window into the net change of every row,
+// keyed by the primary key, and writes them as a single binlog carrying the commit ts of the last txn.
+// It's for the consumers only caring about the latest state of the rows, they must keep the net state themselves,
+// the merged binlog may carry the rows of many tables, so its kafka message isn't keyed by the rows.
+// A window is closed every window, or once maxTxns txns are merged, and before a DDL, which is written alone.
+// The txns of a window are reported as success once the merged binlog is written.
+type snapshotSyncer struct {
+	snapshotSink
+
+	window  time.Duration
+	maxTxns int
+
+	mu     sync.Mutex
+	merger *snapshotMerger
+	// the error of closing the window in background, the syncer fails after it
+	err      error
+	flushErr *baseError
+
+	shutdown chan struct{}
+	done     chan struct{}
+}
+
+// Resolve implements Resolver interface, the resolved ts is passed to the sink writing it
+func (s *snapshotSyncer) Resolve(ts int64) {
+	if r, ok := s.snapshotSink.(Resolver); ok {
+		r.Resolve(ts)
+	}
+}
+
+// NewSnapshotSyncer returns a Syncer merging the row changes of the txns in the windows of window before
+// they're written to s, a window is closed early once maxTxns txns are merged if it's positive.
+// s must write the binlogs of the kafka format, it's the syncer of db-type kafka or file-format jsonl.gz.
+func NewSnapshotSyncer(s Syncer, window time.Duration, maxTxns int) (Syncer, error) {
+	sink, ok := s.(snapshotSink)
+	if !ok {
+		return nil, errors.Errorf("snapshot merge is not supported by %T", s)
+	}
+	if window <= 0 {
+		return nil, errors.Errorf("invalid snapshot merge window %s", window)
+	}
+
+	ss := &snapshotSyncer{
+		snapshotSink: sink,
+		window:       window,
+		maxTxns:      maxTxns,
+		merger:       newSnapshotMerger(),
+		flushErr:     newBaseError(),
+		shutdown:     make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go ss.run()
+	return ss, nil
+}
+
+// Sync implements Syncer interface
+func (s *snapshotSyncer) Sync(item *Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+
+	if item.Binlog.GetDdlJobId() > 0 {
+		if err := s.flush(); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(s.snapshotSink.Sync(item))
+	}
+
+	binlog, err := s.translate(item)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	s.merger.add(binlog, item)
+	if s.maxTxns > 0 && len(s.merger.items) >= s.maxTxns {
+		return errors.Trace(s.flush())
+	}
+	return nil
+}
+
+// Error implements Syncer interface, it also returns the error of closing the window in background
+func (s *snapshotSyncer) Error() <-chan error {
+	sinkErr := s.snapshotSink.Error()
+	flushErr := s.flushErr.error()
+	ret := make(chan error, 1)
+	go func() {
+		select {
+		case err := <-sinkErr:
+			ret <- err
+		case err := <-flushErr:
+			ret <- err
+		}
+	}()
+	return ret
+}
+
+// Close implements Syncer interface, the txns of the last window are written before s is closed
+func (s *snapshotSyncer) Close() error {
+	close(s.shutdown)
+	<-s.done
+
+	s.mu.Lock()
+	var err error
+	if s.err == nil {
+		err = s.flush()
+	}
+	s.mu.Unlock()
+
+	if cerr := s.snapshotSink.Close(); cerr != nil {
+		return errors.Trace(cerr)
+	}
+	return errors.Trace(err)
+}
+
+// run closes the window every window until s is closed
+func (s *snapshotSyncer) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.shutdown:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			err := s.flush()
+			if err != nil {
+				s.err = err
+			}
+			s.mu.Unlock()
+			if err != nil {
+				log.Error("write the merged binlog failed", zap.Error(err))
+				s.flushErr.setErr(err)
+				return
+			}
+		}
+	}
+}
+
+// flush writes the merged binlog of the window and starts a new one, it must be called with s.mu held
+func (s *snapshotSyncer) flush() error {
+	if len(s.merger.items) == 0 {
+		return nil
+	}
+	binlog, items := s.merger.binlog(), s.merger.items
+	s.merger = newSnapshotMerger()
+	return errors.Trace(s.syncBinlog(binlog, items...))
+}
+
+// snapshotMerger merges the row changes of the DML binlogs into the net change of every row,
+// every row is keyed by the table and the values of the primary key.
+// insert + update -> insert
+// insert + delete -> -
+// update + update -> update
+// update + delete -> delete
+// delete + insert -> update
+// insert + insert -> insert  invalid
+// update + insert -> insert  invalid
+// delete + update -> update  invalid
+// delete + delete -> delete  invalid
+// The update changing the primary key is taken as delete + insert. The changes of the tables without
+// primary key are kept as they are. The tables and rows keep the order they're first changed in the window.
+type snapshotMerger struct {
+	tables   []*mergedTable
+	tableIdx map[string]*mergedTable
+	items    []*Item
+	commitTS int64
+}
+
+type mergedTable struct {
+	table *obinlog.Table
+	// the offsets of the primary key columns, it's empty if the table has no primary key
+	pk []int
+	// the indexes of the rows in mutations, the mutation is nil if the changes are collapsed to nothing
+	rows      map[string]int
+	mutations []*obinlog.TableMutation
+}
+
+func newSnapshotMerger() *snapshotMerger {
+	return &snapshotMerger{tableIdx: make(map[string]*mergedTable)}
+}
+
+// add merges the row changes of binlog translated from item
+func (m *snapshotMerger) add(binlog *obinlog.Binlog, item *Item) {
+	m.items = append(m.items, item)
+	m.commitTS = binlog.CommitTs
+
+	for _, table := range binlog.GetDmlData().GetTables() {
+		t := m.tableOf(table)
+		for _, mut := range table.Mutations {
+			for _, mut := range t.splitKeyUpdate(mut) {
+				if len(t.pk) == 0 {
+					t.mutations = append(t.mutations, mut)
+					continue
+				}
+				key := t.keyOf(mut.Row)
+				i, ok := t.rows[key]
+				if !ok {
+					t.rows[key] = len(t.mutations)
+					t.mutations = append(t.mutations, mut)
+					continue
+				}
+				t.mutations[i] = mergeMutation(t.mutations[i], mut)
+			}
+		}
+	}
+}
+
+func (m *snapshotMerger) tableOf(table *obinlog.Table) *mergedTable {
+	name := table.GetSchemaName() + "\x00" + table.GetTableName()
+	if t, ok := m.tableIdx[name]; ok {
+		return t
+	}
+
+	t := &mergedTable{
+		table: &obinlog.Table{SchemaName: table.SchemaName, TableName: table.TableName, ColumnInfo: table.ColumnInfo},
+		rows:  make(map[string]int),
+	}
+	for i, col := range table.ColumnInfo {
+		if col.IsPrimaryKey {
+			t.pk = append(t.pk, i)
+		}
+	}
+	m.tableIdx[name] = t
+	m.tables = append(m.tables, t)
+	return t
+}
+
+// binlog returns the DML binlog of the net changes carrying the commit ts of the last txn added,
+// it carries no table if all the changes are collapsed to nothing.
+func (m *snapshotMerger) binlog() *obinlog.Binlog {
+	binlog := &obinlog.Binlog{Type: obinlog.BinlogType_DML, CommitTs: m.commitTS, DmlData: new(obinlog.DMLData)}
+	for _, t := range m.tables {
+		var muts []*obinlog.TableMutation
+		for _, mut := range t.mutations {
+			if mut != nil {
+				muts = append(muts, mut)
+			}
+		}
+		if len(muts) == 0 {
+			continue
+		}
+		table := *t.table
+		table.Mutations = muts
+		binlog.DmlData.Tables = append(binlog.DmlData.Tables, &table)
+	}
+	return binlog
+}
+
+func (t *mergedTable) keyOf(row *obinlog.Row) string {
+	var b strings.Builder
+	for _, i := range t.pk {
+		if i < len(row.Columns) {
+			b.WriteString(row.Columns[i].String())
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// splitKeyUpdate splits the update changing the primary key into delete + insert
+func (t *mergedTable) splitKeyUpdate(mut *obinlog.TableMutation) []*obinlog.TableMutation {
+	if mut.GetType() != obinlog.MutationType_Update || len(t.pk) == 0 || mut.ChangeRow == nil ||
+		t.keyOf(mut.Row) == t.keyOf(mut.ChangeRow) {
+		return []*obinlog.TableMutation{mut}
+	}
+	return []*obinlog.TableMutation{
+		newMutation(obinlog.MutationType_Delete, mut.ChangeRow, nil),
+		newMutation(obinlog.MutationType_Insert, mut.Row, nil),
+	}
+}
+
+// mergeMutation returns the net change of prev followed by mut changing the same row,
+// prev is nil if the previous changes are collapsed to nothing.
+func mergeMutation(prev *obinlog.TableMutation, mut *obinlog.TableMutation) *obinlog.TableMutation {
+	if prev == nil {
+		return mut
+	}
+
+	prevTp, tp := prev.GetType(), mut.GetType()
+	switch {
+	case prevTp == obinlog.MutationType_Insert && tp == obinlog.MutationType_Update:
+		return newMutation(obinlog.MutationType_Insert, mut.Row, nil)
+	case prevTp == obinlog.MutationType_Insert && tp == obinlog.MutationType_Delete:
+		return nil
+	case prevTp == obinlog.MutationType_Update && tp == obinlog.MutationType_Update:
+		return newMutation(obinlog.MutationType_Update, mut.Row, prev.ChangeRow)
+	case prevTp == obinlog.MutationType_Update && tp == obinlog.MutationType_Delete:
+		return newMutation(obinlog.MutationType_Delete, prev.ChangeRow, nil)
+	case prevTp == obinlog.MutationType_Delete && tp == obinlog.MutationType_Insert:
+		return newMutation(obinlog.MutationType_Update, mut.Row, prev.Row)
+	default:
+		log.Warn("abnormal changes of the same row in the snapshot merge window, just remain the latter",
+			zap.Stringer("before", prev), zap.Stringer("after", mut))
+		return mut
+	}
+}
+
+func newMutation(tp obinlog.MutationType, row *obinlog.Row, changeRow *obinlog.Row) *obinlog.TableMutation {
+	return &obinlog.TableMutation{Type: &tp, Row: row, ChangeRow: changeRow}
+}
@@ -0,0 +1,334 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = check.Suite(&snapshotMergeSuite{})
+
+type snapshotMergeSuite struct{}
+
+func snapshotRow(id int64, name string) *obinlog.Row {
+	return &obinlog.Row{Columns: []*obinlog.Column{{Int64Value: &id}, {StringValue: &name}}}
+}
+
+func snapshotTable(table string, pk bool, muts ...*obinlog.TableMutation) *obinlog.Table {
+	schema := "test"
+	return &obinlog.Table{
+		SchemaName: &schema,
+		TableName:  &table,
+		ColumnInfo: []*obinlog.ColumnInfo{{Name: "id", MysqlType: "int", IsPrimaryKey: pk}, {Name: "name", MysqlType: "varchar"}},
+		Mutations:  muts,
+	}
+}
+
+func snapshotDML(commitTS int64, tables ...*obinlog.Table) *obinlog.Binlog {
+	return &obinlog.Binlog{Type: obinlog.BinlogType_DML, CommitTs: commitTS, DmlData: &obinlog.DMLData{Tables: tables}}
+}
+
+func insertMut(row *obinlog.Row) *obinlog.TableMutation {
+	return newMutation(obinlog.MutationType_Insert, row, nil)
+}
+
+func updateMut(row *obinlog.Row, old *obinlog.Row) *obinlog.TableMutation {
+	return newMutation(obinlog.MutationType_Update, row, old)
+}
+
+func deleteMut(row *obinlog.Row) *obinlog.TableMutation {
+	return newMutation(obinlog.MutationType_Delete, row, nil)
+}
+
+func (s *snapshotMergeSuite) TestMergeRows(c *check.C) {
+	m := newSnapshotMerger()
+	m.add(snapshotDML(1,
+		snapshotTable("t", true,
+			insertMut(snapshotRow(1, "a")),
+			insertMut(snapshotRow(2, "b")),
+			updateMut(snapshotRow(3, "c"), snapshotRow(3, "x")),
+			deleteMut(snapshotRow(4, "d")),
+			insertMut(snapshotRow(5, "e"))),
+		snapshotTable("log", false, insertMut(snapshotRow(1, "a")))), &Item{})
+	m.add(snapshotDML(2,
+		snapshotTable("log", false, insertMut(snapshotRow(1, "a"))),
+		snapshotTable("t", true,
+			updateMut(snapshotRow(1, "a2"), snapshotRow(1, "a")),
+			deleteMut(snapshotRow(2, "b")),
+			updateMut(snapshotRow(3, "c2"), snapshotRow(3, "c")),
+			insertMut(snapshotRow(4, "d2")),
+			// the primary key is changed
+			updateMut(snapshotRow(6, "e"), snapshotRow(5, "e")))), &Item{})
+	m.add(snapshotDML(3, snapshotTable("t", true, deleteMut(snapshotRow(3, "c2")))), &Item{})
+	c.Assert(m.items, check.HasLen, 3)
+
+	c.Assert(m.binlog(), check.DeepEquals, snapshotDML(3,
+		snapshotTable("t", true,
+			// insert + update -> insert, insert + delete -> -
+			insertMut(snapshotRow(1, "a2")),
+			// update + update + delete -> delete of the row before the window
+			deleteMut(snapshotRow(3, "x")),
+			// delete + insert -> update
+			updateMut(snapshotRow(4, "d2"), snapshotRow(4, "d")),
+			// insert + the delete of the old key -> -, the insert of the new key
+			insertMut(snapshotRow(6, "e"))),
+		// the rows of the table without primary key are kept as they are
+		snapshotTable("log", false, insertMut(snapshotRow(1, "a")), insertMut(snapshotRow(1, "a")))))
+
+	// all the changes are collapsed
+	m = newSnapshotMerger()
+	m.add(snapshotDML(4, snapshotTable("t", true, insertMut(snapshotRow(7, "g")))), &Item{})
+	m.add(snapshotDML(5, snapshotTable("t", true, deleteMut(snapshotRow(7, "g")))), &Item{})
+	c.Assert(m.binlog(), check.DeepEquals, snapshotDML(5))
+}
+
+// fakeSnapshotSink records the binlogs written and the items of them
+type fakeSnapshotSink struct {
+	*baseSyncer
+	translated map[int64]*obinlog.Binlog
+
+	mu      sync.Mutex
+	written []*obinlog.Binlog
+	items   [][]*Item
+	fail    error
+}
+
+func newFakeSnapshotSink() *fakeSnapshotSink {
+	s := &fakeSnapshotSink{baseSyncer: newBaseSyncer(nil), translated: make(map[int64]*obinlog.Binlog)}
+	s.success = make(chan *Item, 64)
+	return s
+}
+
+func (s *fakeSnapshotSink) translate(item *Item) (*obinlog.Binlog, error) {
+	if binlog, ok := s.translated[item.Binlog.CommitTs]; ok {
+		return binlog, nil
+	}
+	return &obinlog.Binlog{Type: obinlog.BinlogType_DDL, CommitTs: item.Binlog.CommitTs}, nil
+}
+
+func (s *fakeSnapshotSink) syncBinlog(binlog *obinlog.Binlog, items ...*Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.written = append(s.written, binlog)
+	s.items = append(s.items, items)
+	for _, item := range items {
+		s.success <- item
+	}
+	return nil
+}
+
+func (s *fakeSnapshotSink) Sync(item *Item) error {
+	binlog, err := s.translate(item)
+	if err != nil {
+		return err
+	}
+	return s.syncBinlog(binlog, item)
+}
+
+func (s *fakeSnapshotSink) Close() error {
+	close(s.success)
+	s.setErr(nil)
+	return nil
+}
+
+func (s *fakeSnapshotSink) writtenTS() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ts []int64
+	for _, binlog := range s.written {
+		ts = append(ts, binlog.CommitTs)
+	}
+	return ts
+}
+
+func snapshotItem(sink *fakeSnapshotSink, commitTS int64, binlog *obinlog.Binlog) *Item {
+	item := &Item{Binlog: &pb.Binlog{CommitTs: commitTS}}
+	if binlog != nil {
+		sink.translated[commitTS] = binlog
+	} else {
+		item.Binlog.DdlJobId = commitTS
+	}
+	return item
+}
+
+func (s *snapshotMergeSuite) TestMaxTxnsAndDDL(c *check.C) {
+	sink := newFakeSnapshotSink()
+	syncer, err := NewSnapshotSyncer(sink, time.Hour, 2)
+	c.Assert(err, check.IsNil)
+
+	var items []*Item
+	for ts := int64(1); ts <= 3; ts++ {
+		items = append(items, snapshotItem(sink, ts, snapshotDML(ts, snapshotTable("t", true, updateMut(snapshotRow(1, "a"), snapshotRow(1, "a"))))))
+	}
+	items = append(items, snapshotItem(sink, 4, nil))
+	items = append(items, snapshotItem(sink, 5, snapshotDML(5, snapshotTable("t", true, deleteMut(snapshotRow(1, "a"))))))
+
+	c.Assert(syncer.Sync(items[0]), check.IsNil)
+	c.Assert(sink.writtenTS(), check.HasLen, 0)
+	// the window is closed once 2 txns are merged
+	c.Assert(syncer.Sync(items[1]), check.IsNil)
+	c.Assert(sink.writtenTS(), check.DeepEquals, []int64{2})
+	c.Assert(sink.items[0], check.DeepEquals, items[:2])
+	c.Assert(sink.written[0].DmlData.Tables[0].Mutations, check.HasLen, 1)
+
+	// the DDL closes the window and is written alone
+	c.Assert(syncer.Sync(items[2]), check.IsNil)
+	c.Assert(syncer.Sync(items[3]), check.IsNil)
+	c.Assert(sink.writtenTS(), check.DeepEquals, []int64{2, 3, 4})
+	c.Assert(sink.written[2].Type, check.Equals, obinlog.BinlogType_DDL)
+
+	// the last window is written on close
+	c.Assert(syncer.Sync(items[4]), check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(sink.writtenTS(), check.DeepEquals, []int64{2, 3, 4, 5})
+
+	var acked []*Item
+	for item := range syncer.Successes() {
+		acked = append(acked, item)
+	}
+	c.Assert(acked, check.DeepEquals, items)
+	c.Assert(<-syncer.Error(), check.IsNil)
+}
+
+func (s *snapshotMergeSuite) TestWindow(c *check.C) {
+	sink := newFakeSnapshotSink()
+	syncer, err := NewSnapshotSyncer(sink, 20*time.Millisecond, 0)
+	c.Assert(err, check.IsNil)
+
+	for ts := int64(1); ts <= 3; ts++ {
+		binlog := snapshotDML(ts, snapshotTable("t", true, insertMut(snapshotRow(ts, "a"))))
+		c.Assert(syncer.Sync(snapshotItem(sink, ts, binlog)), check.IsNil)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-syncer.Successes():
+		case <-time.After(time.Second):
+			c.Fatal("the window is not closed in time")
+		}
+	}
+	c.Assert(sink.writtenTS(), check.DeepEquals, []int64{3})
+	c.Assert(sink.written[0].DmlData.Tables[0].Mutations, check.HasLen, 3)
+
+	// the failure of closing the window in background fails the syncer
+	sink.mu.Lock()
+	sink.fail = errors.New("disk full")
+	sink.mu.Unlock()
+	c.Assert(syncer.Sync(snapshotItem(sink, 4, snapshotDML(4))), check.IsNil)
+	select {
+	case err := <-syncer.Error():
+		c.Assert(err, check.ErrorMatches, "disk full")
+	case <-time.After(time.Second):
+		c.Fatal("the syncer doesn't fail")
+	}
+	c.Assert(syncer.Sync(snapshotItem(sink, 5, snapshotDML(5))), check.ErrorMatches, "disk full")
+	c.Assert(syncer.Close(), check.IsNil)
+}
+
+func (s *snapshotMergeSuite) TestUnsupportedSyncer(c *check.C) {
+	_, err := NewSnapshotSyncer(&pbSyncer{}, time.Second, 0)
+	c.Assert(err, check.ErrorMatches, `snapshot merge is not supported by \*sync.pbSyncer`)
+	_, err = NewSnapshotSyncer(newFakeSnapshotSink(), 0, 0)
+	c.Assert(err, check.ErrorMatches, "invalid snapshot merge window 0s")
+}
+
+func (s *snapshotMergeSuite) TestJSONL(c *check.C) {
+	dir := c.MkDir()
+	gen := &translator.BinlogGenrator{}
+	jsonl, err := NewJSONLSyncer(dir, gen, false, nil, false)
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSnapshotSyncer(jsonl, time.Hour, 2)
+	c.Assert(err, check.IsNil)
+
+	// the generator changes the same row every time
+	for i, set := range []func(*check.C){gen.SetInsert, gen.SetUpdate, gen.SetInsert, gen.SetDelete} {
+		set(c)
+		gen.TiBinlog.CommitTs = int64(i + 1)
+		item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+		c.Assert(syncer.Sync(item), check.IsNil)
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+
+	var acked []int64
+	for item := range syncer.Successes() {
+		acked = append(acked, item.Binlog.CommitTs)
+	}
+	c.Assert(acked, check.DeepEquals, []int64{1, 2, 3, 4})
+
+	binlogs := readJSONL(c, filepath.Join(dir, "binlog-0000000000000000.jsonl.gz"))
+	c.Assert(binlogs, check.HasLen, 2)
+	// insert + update -> insert
+	c.Assert(binlogs[0].CommitTs, check.Equals, int64(2))
+	c.Assert(binlogs[0].DmlData.Tables, check.HasLen, 1)
+	c.Assert(binlogs[0].DmlData.Tables[0].Mutations, check.HasLen, 1)
+	c.Assert(binlogs[0].DmlData.Tables[0].Mutations[0].GetType(), check.Equals, obinlog.MutationType_Insert)
+	// insert + delete -> -
+	c.Assert(binlogs[1].CommitTs, check.Equals, int64(4))
+	c.Assert(binlogs[1].DmlData.Tables, check.HasLen, 0)
+}
+
+func (s *snapshotMergeSuite) TestKafka(c *check.C) {
+	var recorder *topicRecorder
+	oldNewAsyncProducer := newAsyncProducer
+	defer func() {
+		newAsyncProducer = oldNewAsyncProducer
+	}()
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		producer := mocks.NewAsyncProducer(c, config)
+		producer.ExpectInputAndSucceed()
+		recorder = newTopicRecorder(producer)
+		return recorder, nil
+	}
+
+	gen := &translator.BinlogGenrator{}
+	kafka, err := NewKafka(&DBConfig{KafkaVersion: "0.8.2.0", TopicName: "data"}, gen)
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSnapshotSyncer(kafka, time.Hour, 2)
+	c.Assert(err, check.IsNil)
+
+	for i, set := range []func(*check.C){gen.SetInsert, gen.SetUpdate} {
+		set(c)
+		gen.TiBinlog.CommitTs = int64(i + 1)
+		item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+		c.Assert(syncer.Sync(item), check.IsNil)
+	}
+	var acked []int64
+	for len(acked) < 2 {
+		select {
+		case item := <-syncer.Successes():
+			acked = append(acked, item.Binlog.CommitTs)
+		case <-time.After(time.Second):
+			c.Fatal("the window is not reported as success")
+		}
+	}
+	c.Assert(acked, check.DeepEquals, []int64{1, 2})
+	c.Assert(syncer.Close(), check.IsNil)
+
+	// the window is written as a single message without the key, it's not for the compacted topics
+	c.Assert(recorder.msgs, check.HasLen, 1)
+	c.Assert(recorder.msgs[0].Topic, check.Equals, "data")
+	c.Assert(recorder.msgs[0].Key, check.IsNil)
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+// defaultStatsTableInterval is the seconds between the upserts of the stats table by default
+const defaultStatsTableInterval = 10
+
+// statsTable upserts the replication stats of the cluster to a table of the mark schema in downstream,
+// so they can be queried by SQL besides the metrics. rows_applied and txns_applied are accumulated across
+// the restarts of drainer, lag_seconds is the lag of the latest txn applied when it's applied.
+type statsTable struct {
+	db        *sql.DB
+	quote     pkgsql.IdentifierQuote
+	name      string
+	clusterID uint64
+
+	mu struct {
+		sync.Mutex
+		commitTS int64
+		lag      float64
+		// applied since the last upsert
+		rows int64
+		txns int64
+	}
+}
+
+// newStatsTable creates the stats table in downstream, it returns nil if `stats-table` is empty.
+func newStatsTable(db *sql.DB, cfg *DBConfig) (*statsTable, error) {
+	if len(cfg.StatsTable) == 0 {
+		return nil, nil
+	}
+
+	quote, err := pkgsql.ParseIdentifierQuote(cfg.IdentifierQuote)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	s := &statsTable{db: db, quote: quote, name: cfg.StatsTable, clusterID: cfg.ClusterID}
+	sqls := []string{loopbacksync.CreateMarkSchemaSQL(quote), s.createTableSQL(cfg.TableOptions())}
+	for _, sql := range sqls {
+		if _, err = db.Exec(sql); err != nil {
+			return nil, errors.Annotatef(err, "exec failed, sql: %s", sql)
+		}
+	}
+	return s, nil
+}
+
+func (s *statsTable) createTableSQL(options pkgsql.TableOptions) string {
+	q := s.quote.Name
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"%s BIGINT UNSIGNED NOT NULL PRIMARY KEY, "+
+		"%s BIGINT NOT NULL, "+
+		"%s DOUBLE NOT NULL, "+
+		"%s BIGINT NOT NULL, "+
+		"%s BIGINT NOT NULL, "+
+		"%s TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP)%s",
+		s.quote.Schema(loopbacksync.MarkTableSchema, s.name),
+		q("cluster_id"), q("commit_ts"), q("lag_seconds"), q("rows_applied"), q("txns_applied"), q("update_time"), options.SQL())
+}
+
+func (s *statsTable) upsertSQL() string {
+	q := s.quote.Name
+	return fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s, %s) VALUES (?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE %s = VALUES(%s), %s = VALUES(%s), %s = %s + VALUES(%s), %s = %s + VALUES(%s)",
+		s.quote.Schema(loopbacksync.MarkTableSchema, s.name),
+		q("cluster_id"), q("commit_ts"), q("lag_seconds"), q("rows_applied"), q("txns_applied"),
+		q("commit_ts"), q("commit_ts"), q("lag_seconds"), q("lag_seconds"),
+		q("rows_applied"), q("rows_applied"), q("rows_applied"), q("txns_applied"), q("txns_applied"), q("txns_applied"))
+}
+
+// observe records the txn applied to downstream at now
+func (s *statsTable) observe(txn *loader.Txn, commitTS int64, now time.Time) {
+	lag := now.Sub(oracle.GetTimeFromTS(uint64(commitTS))).Seconds()
+	if lag < 0 {
+		lag = 0
+	}
+
+	s.mu.Lock()
+	s.mu.commitTS = commitTS
+	s.mu.lag = lag
+	s.mu.rows += int64(len(txn.DMLs))
+	s.mu.txns++
+	s.mu.Unlock()
+}
+
+// upsert writes the stats observed since the last upsert, nothing is written if no txn is applied since then.
+func (s *statsTable) upsert() error {
+	s.mu.Lock()
+	if s.mu.txns == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	commitTS, lag, rows, txns := s.mu.commitTS, s.mu.lag, s.mu.rows, s.mu.txns
+	s.mu.rows, s.mu.txns = 0, 0
+	s.mu.Unlock()
+
+	if _, err := s.db.Exec(s.upsertSQL(), s.clusterID, commitTS, lag, rows, txns); err != nil {
+		// keep the counts to be accumulated by the next upsert
+		s.mu.Lock()
+		s.mu.rows += rows
+		s.mu.txns += txns
+		s.mu.Unlock()
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// run upserts the stats every interval until quit is closed, the stats are upserted once more before it returns.
+// the stats are auxiliary, so the failures are only logged.
+func (s *statsTable) run(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			if err := s.upsert(); err != nil {
+				log.Warn("upsert stats table failed", zap.String("table", s.name), zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := s.upsert(); err != nil {
+				log.Warn("upsert stats table failed", zap.String("table", s.name), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+var _ = check.Suite(&statsTableSuite{})
+
+type statsTableSuite struct{}
+
+func (s *statsTableSuite) newStatsTable(c *check.C) (*statsTable, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `tidb_binlog`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `tidb_binlog`.`_drainer_stats`")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	stats, err := newStatsTable(db, &DBConfig{StatsTable: "_drainer_stats", ClusterID: 42})
+	c.Assert(err, check.IsNil)
+	c.Assert(stats, check.NotNil)
+	return stats, mock
+}
+
+func (s *statsTableSuite) commitTS(t time.Time) int64 {
+	return int64(oracle.ComposeTS(oracle.GetPhysical(t), 0))
+}
+
+func (s *statsTableSuite) newTxn(rows int) *loader.Txn {
+	txn := new(loader.Txn)
+	for i := 0; i < rows; i++ {
+		txn.AppendDML(&loader.DML{Database: "test", Table: "t1", Tp: loader.InsertDMLType})
+	}
+	return txn
+}
+
+func (s *statsTableSuite) TestDisabled(c *check.C) {
+	stats, err := newStatsTable(nil, &DBConfig{})
+	c.Assert(err, check.IsNil)
+	c.Assert(stats, check.IsNil)
+}
+
+func (s *statsTableSuite) TestCreateTableSQL(c *check.C) {
+	stats := &statsTable{quote: pkgsql.BacktickQuote, name: "_drainer_stats"}
+	sql := stats.createTableSQL(pkgsql.TableOptions{Charset: "utf8mb4"})
+	c.Assert(strings.HasPrefix(sql, "CREATE TABLE IF NOT EXISTS `tidb_binlog`.`_drainer_stats` (`cluster_id` BIGINT UNSIGNED NOT NULL PRIMARY KEY"), check.IsTrue, check.Commentf(sql))
+	c.Assert(strings.HasSuffix(sql, " DEFAULT CHARSET=utf8mb4"), check.IsTrue, check.Commentf(sql))
+}
+
+func (s *statsTableSuite) TestCreateFailed(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	oldCreateDB := createDB
+	createDB = func(_ string, _ string, _ string, _ int, _ map[string]string, _ []string, _ time.Duration) (*sql.DB, error) {
+		return db, nil
+	}
+	defer func() {
+		createDB = oldCreateDB
+	}()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `tidb_binlog`")).WillReturnError(errors.New("access denied"))
+	mock.ExpectClose()
+	_, err = NewMysqlSyncer(&DBConfig{StatsTable: "_drainer_stats"}, nil, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, "create stats table failed.*access denied")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *statsTableSuite) TestUpsert(c *check.C) {
+	stats, mock := s.newStatsTable(c)
+	upsert := regexp.QuoteMeta(stats.upsertSQL())
+	c.Assert(stats.upsertSQL(), check.Matches, ".*ON DUPLICATE KEY UPDATE .*`rows_applied` = `rows_applied` \\+ VALUES\\(`rows_applied`\\).*")
+
+	// nothing is written without any txn applied
+	c.Assert(stats.upsert(), check.IsNil)
+
+	now := time.Now()
+	ts1, ts2 := s.commitTS(now.Add(-5*time.Second)), s.commitTS(now.Add(-3*time.Second))
+	stats.observe(s.newTxn(2), ts1, oracle.GetTimeFromTS(uint64(ts1)).Add(5*time.Second))
+	stats.observe(s.newTxn(3), ts2, oracle.GetTimeFromTS(uint64(ts2)).Add(3*time.Second))
+	mock.ExpectExec(upsert).WithArgs(42, ts2, 3.0, 5, 2).WillReturnError(errors.New("lost connection"))
+	c.Assert(stats.upsert(), check.ErrorMatches, "lost connection")
+
+	// the counts failing to be written are accumulated by the next upsert
+	stats.observe(s.newTxn(1), ts2+1, oracle.GetTimeFromTS(uint64(ts2)))
+	mock.ExpectExec(upsert).WithArgs(42, ts2+1, 0.0, 6, 3).WillReturnResult(sqlmock.NewResult(1, 1))
+	c.Assert(stats.upsert(), check.IsNil)
+	c.Assert(stats.upsert(), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *statsTableSuite) TestRun(c *check.C) {
+	stats, mock := s.newStatsTable(c)
+	upsert := regexp.QuoteMeta(stats.upsertSQL())
+
+	waitUpserted := func() {
+		for i := 0; i < 100; i++ {
+			if mock.ExpectationsWereMet() == nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Fatal("the stats row isn't updated in 1s")
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		stats.run(20*time.Millisecond, quit)
+		close(done)
+	}()
+
+	ts1 := s.commitTS(time.Now())
+	mock.ExpectExec(upsert).WithArgs(42, ts1, sqlmock.AnyArg(), 2, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	stats.observe(s.newTxn(2), ts1, time.Now())
+	waitUpserted()
+
+	ts2 := ts1 + 1
+	mock.ExpectExec(upsert).WithArgs(42, ts2, sqlmock.AnyArg(), 1, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	stats.observe(s.newTxn(1), ts2, time.Now())
+	waitUpserted()
+
+	// the stats observed before quitting are upserted on quitting
+	ts3 := ts2 + 1
+	mock.ExpectExec(upsert).WithArgs(42, ts3, sqlmock.AnyArg(), 4, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	stats.observe(s.newTxn(4), ts3, time.Now())
+	close(quit)
+	<-done
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -41,6 +41,12 @@ type Syncer interface {
 	Close() error
 }
 
+// Resolver is implemented by the Syncers writing the resolved ts to downstream
+type Resolver interface {
+	// Resolve advances the resolved ts to ts, all the items committed up to ts must have been synced
+	Resolve(ts int64)
+}
+
 type baseSyncer struct {
 	*baseError
 	success         chan *Item
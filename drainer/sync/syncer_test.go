@@ -50,14 +50,14 @@ func (s *syncerSuite) SetUpTest(c *check.C) {
 	}
 
 	// create pb syncer
-	pb, err := NewPBSyncer(c.MkDir(), infoGetter)
+	pb, err := NewPBSyncer(c.MkDir(), infoGetter, false)
 	c.Assert(err, check.IsNil)
 
 	s.syncers = append(s.syncers, pb)
 
 	// create mysql syncer
 	oldCreateDB := createDB
-	createDB = func(string, string, string, int, *string) (db *sql.DB, err error) {
+	createDB = func(string, string, string, int, map[string]string, []string, time.Duration) (db *sql.DB, err error) {
 		db, s.mysqlMock, err = sqlmock.New()
 		return
 	}
@@ -65,7 +65,7 @@ func (s *syncerSuite) SetUpTest(c *check.C) {
 		createDB = oldCreateDB
 	}()
 
-	mysql, err := NewMysqlSyncer(cfg, infoGetter, 1, 1, nil, nil, "mysql")
+	mysql, err := NewMysqlSyncer(cfg, infoGetter, 1, 1, nil, nil, "mysql", nil, nil, nil, nil, nil)
 	c.Assert(err, check.IsNil)
 	s.syncers = append(s.syncers, mysql)
 
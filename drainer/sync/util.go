@@ -14,8 +14,13 @@
 package sync
 
 import (
+	"strings"
+	"time"
+
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 )
 
 // DBConfig is the DB configuration.
@@ -26,14 +31,153 @@ type DBConfig struct {
 	Port          int              `toml:"port" json:"port"`
 	Checkpoint    CheckpointConfig `toml:"checkpoint" json:"checkpoint"`
 	BinlogFileDir string           `toml:"dir" json:"dir"`
+	// the format of the binlog files, FileFormatPB by default
+	FileFormat string `toml:"file-format" json:"file-format"`
+	// the declared order of the columns of the tables in the JSON-Lines files, only for file-format jsonl.gz
+	ColumnOrders []TableColumnOrder `toml:"column-order" json:"column-order"`
+	// read the password from the file or the environment variable instead, the file takes precedence
+	PasswordFile string `toml:"password-file" json:"password-file"`
+	PasswordEnv  string `toml:"password-env" json:"password-env"`
+	// the mysql error codes to be ignored when executing sql in downstream
+	IgnoreErrorCodes []int `toml:"ignore-error-codes" json:"ignore-error-codes"`
+	// the session time zone of downstream, TIMESTAMP values are converted to it before written to downstream
+	TimeZone string `toml:"time-zone" json:"time-zone"`
+	// the statements executed in order on every new connection to downstream, e.g. to set up the session
+	InitSQL []string `toml:"init-sql" json:"init-sql"`
+	// seconds between the TCP keepalive probes on the connections to downstream, the default of Go is used if it's 0
+	TCPKeepAlive int `toml:"tcp-keepalive" json:"tcp-keepalive"`
+	// how the TTL attributes of the DDLs are replicated, TTLModeKeep or TTLModeDisableJob, TTLModeKeep by default
+	TTLMode string `toml:"ttl-mode" json:"ttl-mode"`
+	// how the multi-valued indexes of the DDLs are replicated, MultiValuedIndexKeep or MultiValuedIndexSkip,
+	// MultiValuedIndexKeep by default
+	MultiValuedIndex string `toml:"multi-valued-index" json:"multi-valued-index"`
+	// how the positions `FIRST` and `AFTER col` of the column DDLs are replicated, ColumnPositionKeep or
+	// ColumnPositionIgnore, ColumnPositionKeep by default
+	ColumnPosition string `toml:"column-position" json:"column-position"`
+	// the isolation level of the txns applied to downstream, IsolationLevelReadCommitted or
+	// IsolationLevelRepeatableRead, the default level of downstream is used if it's empty
+	IsolationLevel string `toml:"isolation-level" json:"isolation-level"`
+	// how the 0 of the AUTO_INCREMENT columns in the binlog is written, ZeroAutoIncrementKeep or
+	// ZeroAutoIncrementGenerate, ZeroAutoIncrementKeep by default
+	ZeroAutoIncrement string `toml:"zero-auto-increment" json:"zero-auto-increment"`
+	// disable the foreign key checks of the downstream sessions, the DMLs are applied concurrently
+	// and out of the order of the foreign keys, so they fail if downstream enforces the foreign keys
+	DisableForeignKeyChecks bool `toml:"disable-foreign-key-checks" json:"disable-foreign-key-checks"`
+	// the circuit breaker opens after so many consecutive failures of downstream, 0 means disabled
+	CircuitBreakerThreshold int `toml:"circuit-breaker-threshold" json:"circuit-breaker-threshold"`
+	// seconds to pause executing against downstream when the circuit breaker is open
+	CircuitBreakerCoolDown int `toml:"circuit-breaker-cool-down" json:"circuit-breaker-cool-down"`
+	// the max count of prepared statements cached in downstream, 0 means no cache
+	StmtCacheSize int `toml:"stmt-cache-size" json:"stmt-cache-size"`
+	// apply the txns not conflicting with each other out of commit order
+	RelaxedOrder bool `toml:"relaxed-order" json:"relaxed-order"`
+	// quote the identifiers in the generated SQLs by "backtick" or "double-quote", backtick by default,
+	// double-quote is for the downstream with sql_mode ANSI_QUOTES
+	IdentifierQuote string `toml:"identifier-quote" json:"identifier-quote"`
+	// the default charset and collation of the tables created by drainer in downstream,
+	// like the checkpoint, mark and dead letter table, the default of the database is used if they're empty
+	TableCharset   string `toml:"table-charset" json:"table-charset"`
+	TableCollation string `toml:"table-collation" json:"table-collation"`
+	// open and ping the connections of all workers on startup, fail fast if downstream is unreachable
+	Warmup bool `toml:"warmup" json:"warmup"`
+	// collapse the DMLs of one txn writing the same row into the net effect
+	CoalesceTxn bool `toml:"coalesce-txn" json:"coalesce-txn"`
+	// TiDBRowIDInclude to replicate the _tidb_rowid of the tables without integer primary key
+	// and use it as the key, TiDBRowIDExclude by default
+	TiDBRowID string `toml:"tidb-rowid" json:"tidb-rowid"`
+	// parse every generated SQL by the TiDB parser before executing it in downstream to catch the bugs early
+	ValidateSQL bool `toml:"validate-sql" json:"validate-sql"`
+	// the concurrency limits of applying the DMLs of the tables, overriding the worker count
+	TableConcurrencies []TableConcurrency `toml:"table-concurrency" json:"table-concurrency"`
+	// the session time zone and sql_mode of downstream overridden while applying the DMLs of the tables,
+	// only for db-type mysql and tidb
+	TableSessions []TableSession `toml:"table-session" json:"table-session"`
+	// whether the before-image of the rows of the tables is written, only for db-type kafka
+	BeforeImages []TableBeforeImage `toml:"before-image" json:"before-image"`
+	// pre-split the regions of the tables right after they're created in downstream, only for db-type tidb
+	PreSplits []TablePreSplit `toml:"pre-split" json:"pre-split"`
+	// how to handle the writes rejected by the locked or read-only tables of downstream,
+	// loader.LockedTableRetry by default
+	LockedTablePolicy string `toml:"locked-table-policy" json:"locked-table-policy"`
+	// how to handle the values out of the range of the integer and DECIMAL columns in downstream,
+	// loader.NumericOverflowError, loader.NumericOverflowClamp or loader.NumericOverflowNull,
+	// the values are written as they are if it's empty
+	NumericOverflow string `toml:"numeric-overflow" json:"numeric-overflow"`
+	// seconds to print the identical errors of applying to downstream at most once, with the count of
+	// the suppressed ones, 0 means every error is printed
+	LogSampleInterval int `toml:"log-sample-interval" json:"log-sample-interval"`
+	// seconds to cap the backoff doubled between the retries of applying to downstream,
+	// 0 means the backoff is fixed
+	RetryMaxBackoff int `toml:"retry-max-backoff" json:"retry-max-backoff"`
+	// seconds to stop retrying a failed event of applying to downstream even if attempts remain,
+	// 0 means no limit
+	RetryTimeBudget int `toml:"retry-time-budget" json:"retry-time-budget"`
+	// throttle the writes to downstream while any status variable returned by ThrottleProbe exceeds its threshold
+	// in ThrottleThresholds, only for db-type mysql and tidb. it's disabled if ThrottleThresholds is empty,
+	// ThrottleProbe is loader.DefaultThrottleProbe by default
+	ThrottleProbe      string             `toml:"throttle-probe" json:"throttle-probe"`
+	ThrottleThresholds map[string]float64 `toml:"throttle-thresholds" json:"throttle-thresholds"`
+	// seconds between the probes, 1 by default
+	ThrottleProbeInterval int `toml:"throttle-probe-interval" json:"throttle-probe-interval"`
+	// milliseconds to delay every write at most while downstream is overloaded, 1000 by default
+	ThrottleMaxDelay int `toml:"throttle-max-delay" json:"throttle-max-delay"`
+	// the DMLs applied together are taken as a burst of inserts like the ones derived from LOAD DATA if
+	// they're all inserts and there're at least BulkInsertRows of them, and they're applied in the statements
+	// of BulkInsertBatchSize rows instead of txn-batch, only for db-type mysql and tidb. 0 means disabled.
+	BulkInsertRows      int `toml:"bulk-insert-rows" json:"bulk-insert-rows"`
+	BulkInsertBatchSize int `toml:"bulk-insert-batch-size" json:"bulk-insert-batch-size"`
+	// apply up to CommitGroupTxns txns, or the txns within CommitGroupWindow milliseconds since the first one,
+	// in one downstream transaction to amortize the commit cost, the checkpoint advances after the group commits.
+	// only for db-type mysql and tidb, and not with relaxed-order. it's disabled if both of them are 0.
+	CommitGroupTxns   int `toml:"commit-group-txns" json:"commit-group-txns"`
+	CommitGroupWindow int `toml:"commit-group-window" json:"commit-group-window"`
+	// how the secondary ts saved in the ts-map of the checkpoint is derived, SecondaryTSDownstreamTSO or
+	// SecondaryTSNone, it's SecondaryTSDownstreamTSO for db-type tidb and SecondaryTSNone for others by default
+	SecondaryTS string `toml:"secondary-ts" json:"secondary-ts"`
+	// the metadata written to the downstream columns of every inserted or updated row, keyed by
+	// MetadataClusterID or MetadataCommitTS, it's not written to the table without the column.
+	MetadataColumns map[string]string `toml:"metadata-columns" json:"metadata-columns"`
+	// write the events failing permanently to the dead letter and skip them
+	DeadLetter DeadLetterConfig `toml:"dead-letter" json:"dead-letter"`
+	// skip the rows failing to be decoded and apply the rest of the txn, the rows are written to the dead letter
+	// if it's enabled, only for db-type mysql and tidb. the rows are lost in downstream, so it's disabled by default
+	QuarantineUndecodableRows bool `toml:"quarantine-undecodable-rows" json:"quarantine-undecodable-rows"`
+	// write a BEGIN and a COMMIT marker carrying the commit ts before and after the records of every txn,
+	// only for db-type file and kafka
+	TxnMarkers bool `toml:"txn-markers" json:"txn-markers"`
+	// write the sequence numbers of the row changes, derived from the commit ts and the index of the changes
+	// in the txn, with every binlog, only for db-type kafka and file with file-format jsonl.gz
+	RowSequences bool `toml:"row-sequences" json:"row-sequences"`
+	// merge the row changes of the DML txns in every window of so many seconds into the net change of every row,
+	// keyed by the primary key, and write them as a single binlog, only for db-type kafka and file with file-format
+	// jsonl.gz. the window is closed early once SnapshotMergeMaxTxns txns are merged if it's positive. 0 means disabled
+	SnapshotMergeWindow  int `toml:"snapshot-merge-window" json:"snapshot-merge-window"`
+	SnapshotMergeMaxTxns int `toml:"snapshot-merge-max-txns" json:"snapshot-merge-max-txns"`
+	// upsert the replication stats, the lag, the rows and txns applied and the commit ts of the latest txn applied,
+	// to the row of the cluster in this table of the mark schema every StatsTableInterval seconds, only for db-type
+	// mysql and tidb. it's disabled if it's empty, StatsTableInterval is 10 by default
+	StatsTable         string `toml:"stats-table" json:"stats-table"`
+	StatsTableInterval int    `toml:"stats-table-interval" json:"stats-table-interval"`
 
 	ZKAddrs          string `toml:"zookeeper-addrs" json:"zookeeper-addrs"`
 	KafkaAddrs       string `toml:"kafka-addrs" json:"kafka-addrs"`
 	KafkaVersion     string `toml:"kafka-version" json:"kafka-version"`
 	KafkaMaxMessages int    `toml:"kafka-max-messages" json:"kafka-max-messages"`
 	TopicName        string `toml:"topic-name" json:"topic-name"`
+	// send the DDL binlogs to this topic instead of the topic of the DML binlogs if it's not empty
+	DDLTopicName string `toml:"ddl-topic-name" json:"ddl-topic-name"`
+	// key the messages of the DDL topic by `schema.table` instead of the schema name if the table is known,
+	// so the DDLs of different tables in a schema don't share the key
+	KafkaKeyNamespace bool `toml:"kafka-key-namespace" json:"kafka-key-namespace"`
+	// the timestamp of the messages, KafkaTimestampProduceTime by default or KafkaTimestampCommitTS
+	KafkaTimestamp string `toml:"kafka-timestamp" json:"kafka-timestamp"`
+	// write a resolved ts record to every partition every so many milliseconds, even when there're no changes,
+	// all the changes committed up to the ts have been written to the partition before it. 0 means disabled
+	KafkaResolvedTSInterval int `toml:"kafka-resolved-ts-interval" json:"kafka-resolved-ts-interval"`
 	// get it from pd
 	ClusterID uint64 `toml:"-" json:"-"`
+	// match the names of the column projections case-sensitively, it's the case-sensitive of syncer
+	CaseSensitive bool `toml:"-" json:"-"`
 }
 
 // CheckpointConfig is the Checkpoint configuration.
@@ -44,6 +188,179 @@ type CheckpointConfig struct {
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
 	Port     int    `toml:"port" json:"port"`
+	// read the password from the file or the environment variable instead, the file takes precedence
+	PasswordFile string `toml:"password-file" json:"password-file"`
+	PasswordEnv  string `toml:"password-env" json:"password-env"`
+	// the statements executed in order on every new connection to the checkpoint database,
+	// only for mysql or tidb checkpoint, init-sql of downstream is used by default if it's saved in downstream
+	InitSQL []string `toml:"init-sql" json:"init-sql"`
+	// read the checkpoint back after saving it to make sure it's persisted, only for mysql or tidb checkpoint
+	VerifySave bool `toml:"verify-save" json:"verify-save"`
+	// the table in the checkpoint schema whose single row of the cluster is updated to the commit ts of the
+	// checkpoint in the same transaction saving it, only for mysql or tidb checkpoint, empty means disabled
+	MarkerTable string `toml:"marker-table" json:"marker-table"`
+	// recreate the checkpoint schema and tables if they're dropped while drainer is running instead of failing
+	// to save the checkpoint, it requires the privileges to create them, only for mysql or tidb checkpoint
+	RecreateMissingTable bool `toml:"recreate-missing-table" json:"recreate-missing-table"`
+	// the comment put before the query reading the checkpoint, e.g. to route it to the primary by the proxy
+	// in front of the checkpoint database with read replicas, only for mysql or tidb checkpoint
+	ReadHint string `toml:"read-hint" json:"read-hint"`
+	// read the checkpoint by a locking read in a transaction, which is executed by the primary behind the
+	// read/write splitting proxies, only for mysql or tidb checkpoint
+	ReadPrimary bool `toml:"read-primary" json:"read-primary"`
+	// check the checkpoint loaded on startup isn't lower than the highest commit ts saved before, which is recorded
+	// in `data-dir`, the rewind is logged by "warn" or fails drainer by "refuse", empty means not checked
+	RewindAction string `toml:"rewind-action" json:"rewind-action"`
+	// save the checkpoint only after the replicas of the checkpoint database execute the GTIDs executed by it,
+	// only for mysql checkpoint with GTID enabled
+	WaitReplicas []CheckpointReplica `toml:"wait-replica" json:"wait-replica"`
+	// seconds to wait for every replica before failing to save the checkpoint, 10 by default
+	WaitReplicaTimeout int `toml:"wait-replica-timeout" json:"wait-replica-timeout"`
+	// reopen the connection of the checkpoint database if it's idle for the seconds before using it,
+	// only for mysql or tidb checkpoint, 0 means never
+	IdleTimeout int `toml:"idle-timeout" json:"idle-timeout"`
+	// connect to the checkpoint database with TLS, independent of the TLS config of upstream,
+	// only for mysql or tidb checkpoint
+	SSLCA   string `toml:"ssl-ca" json:"ssl-ca"`
+	SSLCert string `toml:"ssl-cert" json:"ssl-cert"`
+	SSLKey  string `toml:"ssl-key" json:"ssl-key"`
+	// the SQLite file of sqlite checkpoint, `data-dir`/checkpoint.db by default
+	Path string `toml:"path" json:"path"`
+}
+
+// TableConcurrency limits the count of concurrent executions applying the DMLs of the matched tables,
+// the names are matched like replicate-do-table, the name starting with "~" is a regular expression.
+type TableConcurrency struct {
+	Schema      string `toml:"db-name" json:"db-name"`
+	Table       string `toml:"tbl-name" json:"tbl-name"`
+	Concurrency int    `toml:"concurrency" json:"concurrency"`
+}
+
+// TableSession overrides the session time zone and sql_mode of downstream while applying the DMLs of the matched tables,
+// the names are matched like table-concurrency. The time zone and sql_mode of the session are kept if they're not set.
+type TableSession struct {
+	Schema   string  `toml:"db-name" json:"db-name"`
+	Table    string  `toml:"tbl-name" json:"tbl-name"`
+	TimeZone string  `toml:"time-zone" json:"time-zone"`
+	SQLMode  *string `toml:"sql-mode" json:"sql-mode"`
+}
+
+// TablePreSplit pre-splits the regions of the matched tables in TiDB downstream by `SPLIT TABLE`,
+// the row handles are split at Points if they're specified, otherwise [Lower, Upper) is split into Regions regions.
+type TablePreSplit struct {
+	Schema  string  `toml:"db-name" json:"db-name"`
+	Table   string  `toml:"tbl-name" json:"tbl-name"`
+	Lower   int64   `toml:"lower" json:"lower"`
+	Upper   int64   `toml:"upper" json:"upper"`
+	Regions int     `toml:"regions" json:"regions"`
+	Points  []int64 `toml:"points" json:"points"`
+}
+
+// CheckpointReplica is a replica of the checkpoint database to wait for
+type CheckpointReplica struct {
+	Host     string `toml:"host" json:"host"`
+	User     string `toml:"user" json:"user"`
+	Password string `toml:"password" json:"password"`
+	Port     int    `toml:"port" json:"port"`
+	// read the password from the file or the environment variable instead, the file takes precedence
+	PasswordFile string `toml:"password-file" json:"password-file"`
+	PasswordEnv  string `toml:"password-env" json:"password-env"`
+}
+
+// LoaderTableConcurrencies returns the concurrency limits of the tables for loader
+func (cfg *DBConfig) LoaderTableConcurrencies() []loader.TableConcurrency {
+	confs := make([]loader.TableConcurrency, 0, len(cfg.TableConcurrencies))
+	for _, tc := range cfg.TableConcurrencies {
+		confs = append(confs, loader.TableConcurrency{Database: tc.Schema, Table: tc.Table, Concurrency: tc.Concurrency})
+	}
+	return confs
+}
+
+// LoaderTableSessions returns the session overrides of the tables for loader,
+// NO_AUTO_VALUE_ON_ZERO is added to the sql_mode of the tables like the session one if zero-auto-increment is keep.
+func (cfg *DBConfig) LoaderTableSessions() []loader.TableSession {
+	confs := make([]loader.TableSession, 0, len(cfg.TableSessions))
+	for _, ts := range cfg.TableSessions {
+		sqlMode := ts.SQLMode
+		if sqlMode != nil && (cfg.ZeroAutoIncrement == "" || cfg.ZeroAutoIncrement == ZeroAutoIncrementKeep) {
+			mode := withNoAutoValueOnZero(*sqlMode)
+			sqlMode = &mode
+		}
+		confs = append(confs, loader.TableSession{Database: ts.Schema, Table: ts.Table, TimeZone: ts.TimeZone, SQLMode: sqlMode})
+	}
+	return confs
+}
+
+func withNoAutoValueOnZero(sqlMode string) string {
+	for _, mode := range strings.Split(sqlMode, ",") {
+		if strings.EqualFold(strings.TrimSpace(mode), "NO_AUTO_VALUE_ON_ZERO") {
+			return sqlMode
+		}
+	}
+	if len(strings.TrimSpace(sqlMode)) == 0 {
+		return "NO_AUTO_VALUE_ON_ZERO"
+	}
+	return sqlMode + ",NO_AUTO_VALUE_ON_ZERO"
+}
+
+// LoaderRetryPolicy returns the retry policy of loader
+func (c *DBConfig) LoaderRetryPolicy() loader.RetryPolicy {
+	return loader.RetryPolicy{
+		MaxBackoff: time.Duration(c.RetryMaxBackoff) * time.Second,
+		Budget:     time.Duration(c.RetryTimeBudget) * time.Second,
+	}
+}
+
+// LoaderThrottlePolicy returns the throttle policy of loader
+func (c *DBConfig) LoaderThrottlePolicy() loader.ThrottlePolicy {
+	return loader.ThrottlePolicy{
+		Probe:      c.ThrottleProbe,
+		Thresholds: c.ThrottleThresholds,
+		Interval:   time.Duration(c.ThrottleProbeInterval) * time.Second,
+		MaxDelay:   time.Duration(c.ThrottleMaxDelay) * time.Millisecond,
+	}
+}
+
+// LoaderBulkInsertPolicy returns the bulk insert policy of loader
+func (c *DBConfig) LoaderBulkInsertPolicy() loader.BulkInsertPolicy {
+	return loader.BulkInsertPolicy{
+		MinRows:   c.BulkInsertRows,
+		BatchSize: c.BulkInsertBatchSize,
+	}
+}
+
+// LoaderCommitGroupPolicy returns the commit group policy of loader
+func (c *DBConfig) LoaderCommitGroupPolicy() loader.CommitGroupPolicy {
+	return loader.CommitGroupPolicy{
+		MaxTxns: c.CommitGroupTxns,
+		Window:  time.Duration(c.CommitGroupWindow) * time.Millisecond,
+	}
+}
+
+// SaveSecondaryTS returns whether the secondary ts is saved for the downstream of destDBType
+func (c *DBConfig) SaveSecondaryTS(destDBType string) bool {
+	switch c.SecondaryTS {
+	case SecondaryTSDownstreamTSO:
+		return true
+	case SecondaryTSNone:
+		return false
+	default:
+		return destDBType == "tidb"
+	}
+}
+
+// LoaderPreSplits returns the pre-split strategies of the tables for loader
+func (cfg *DBConfig) LoaderPreSplits() []loader.TablePreSplit {
+	confs := make([]loader.TablePreSplit, 0, len(cfg.PreSplits))
+	for _, ps := range cfg.PreSplits {
+		confs = append(confs, loader.TablePreSplit{Database: ps.Schema, Table: ps.Table, Lower: ps.Lower, Upper: ps.Upper, Regions: ps.Regions, Points: ps.Points})
+	}
+	return confs
+}
+
+// TableOptions returns the options of the tables created by drainer in downstream
+func (cfg *DBConfig) TableOptions() pkgsql.TableOptions {
+	return pkgsql.TableOptions{Charset: cfg.TableCharset, Collation: cfg.TableCollation}
 }
 
 type baseError struct {
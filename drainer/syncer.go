@@ -14,7 +14,9 @@
 package drainer
 
 import (
+	"context"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -27,6 +29,10 @@ import (
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	pb "github.com/pingcap/tipb/go-binlog"
 )
@@ -35,6 +41,42 @@ import (
 // normally, we take record if it takes longer than this value.
 var runWaitThreshold = 10 * time.Second
 
+// shutdownDrainDeadline is the max time to wait for the downstream to drain
+// the pending items on shutdown, the checkpoint of the applied items will be saved
+// without waiting the left ones if it's exceeded.
+var shutdownDrainDeadline = 30 * time.Second
+
+// fakeBinlogCheckInterval is the interval to check whether the pending fake binlogs
+// are safe to be pushed when there's no input.
+var fakeBinlogCheckInterval = time.Second
+
+const (
+	// OversizeBinlogLog logs the oversize binlog and syncs it as usual
+	OversizeBinlogLog = "log"
+	// OversizeBinlogSkip logs the oversize binlog and skips it, the checkpoint advances past it
+	OversizeBinlogSkip = "skip"
+)
+
+const (
+	// RenameAcrossFilterSkip logs and skips renaming the table between the replicated one and the one not replicated
+	RenameAcrossFilterSkip = "skip"
+	// RenameAcrossFilterError halts the syncer on renaming the table between the replicated one and the one not replicated
+	RenameAcrossFilterError = "error"
+)
+
+const (
+	// GlobalTemporaryTableReplicate syncs the DDLs of the global temporary tables, the definitions are shared by the sessions
+	GlobalTemporaryTableReplicate = "replicate"
+	// GlobalTemporaryTableSkip skips the DDLs of the global temporary tables, for the downstream not supporting them like MySQL
+	GlobalTemporaryTableSkip = "skip"
+)
+
+// the sides the syncer waits on, the labels of waitDurationCounter
+const (
+	waitUpstream   = "upstream"
+	waitDownstream = "downstream"
+)
+
 // Syncer converts tidb binlog to the specified DB sqls, and sync it to target DB
 type Syncer struct {
 	schema *Schema
@@ -46,10 +88,43 @@ type Syncer struct {
 
 	filter *filter.Filter
 
+	loopbackSync *loopbacksync.LoopBackSync
+
 	// last time we successfully sync binlog item to downstream
 	lastSyncTime time.Time
 
 	dsyncer dsync.Syncer
+	// guard the executions against downstream, it's nil if disabled
+	breaker *loader.CircuitBreaker
+	// the count of items sent to dsyncer but not applied yet
+	pendingItems int64
+	// track the transactions sent to dsyncer to advance the checkpoint in commit order
+	window *txnWindow
+	// the requests to save the checkpoint immediately, handled by handleSuccess
+	flushes chan *flushRequest
+	// check the lag of the applied txns, it's nil if max-lag is not set
+	lagMonitor *lagMonitor
+	// the error to halt the syncer by lagMonitor
+	halt chan error
+	// dsyncer.Sync is still blocked after the syncer is halted, so dsyncer can't be closed
+	syncBlocked bool
+
+	// the commit ts of the txns to skip, it's initialized by IgnoreTxnCommitTS and can be added at runtime
+	skipMu          sync.RWMutex
+	skipTxnCommitTS []int64
+
+	// hold the DDLs and the DMLs depending on them until released, it's initialized by HoldDDL
+	// and can be turned on and off at runtime
+	ddlHold *ddlHold
+
+	// the lower-case names of the variables of which the `SET` statements in the DDL stream are replicated
+	setVariables map[string]struct{}
+
+	// the snapshot of the tables tracked in schema at the schema version, it's refreshed
+	// by the run loop after the schema changes, so it can be read by other goroutines
+	tablesMu      sync.RWMutex
+	tablesVersion int64
+	trackedTables []TrackedTable
 
 	shutdown chan struct{}
 	closed   chan struct{}
@@ -64,21 +139,38 @@ func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (
 	syncer.lastSyncTime = time.Now()
 	syncer.shutdown = make(chan struct{})
 	syncer.closed = make(chan struct{})
+	syncer.window = newTxnWindow(cfg.MaxInflightTxns)
+	syncer.flushes = make(chan *flushRequest)
+	syncer.lagMonitor = newLagMonitor(cfg)
+	syncer.halt = make(chan error, 1)
+	syncer.skipTxnCommitTS = append([]int64(nil), cfg.IgnoreTxnCommitTS...)
+	syncer.ddlHold = newDDLHold(cfg.HoldDDL)
+	syncer.setVariables = make(map[string]struct{}, len(cfg.ReplicateSetVariables))
+	for _, name := range cfg.ReplicateSetVariables {
+		syncer.setVariables[strings.ToLower(name)] = struct{}{}
+	}
 
 	var ignoreDBs []string
 	if len(cfg.IgnoreSchemas) > 0 {
 		ignoreDBs = strings.Split(cfg.IgnoreSchemas, ",")
 	}
-	syncer.filter = filter.NewFilter(ignoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
+	if cfg.CaseSensitive {
+		syncer.filter = filter.NewCaseSensitiveFilter(ignoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
+	} else {
+		syncer.filter = filter.NewFilter(ignoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
+	}
+	syncer.loopbackSync = loopbacksync.NewLoopBackSyncInfo(cfg.ChannelID, cfg.LoopbackControl)
 
 	var err error
 	// create schema
-	syncer.schema, err = NewSchema(jobs, false)
+	syncer.schema, err = NewSchema(jobs, cfg.To != nil && cfg.To.TiDBRowID == dsync.TiDBRowIDInclude)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	syncer.schema.replayWorkers = cfg.SchemaReplayWorkers
 
-	syncer.dsyncer, err = createDSyncer(cfg, syncer.schema)
+	syncer.breaker = newDownstreamBreaker(cfg)
+	syncer.dsyncer, err = createDSyncer(cfg, syncer.schema, syncer.loopbackSync, syncer.breaker)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -86,7 +178,22 @@ func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (
 	return syncer, nil
 }
 
-func createDSyncer(cfg *SyncerConfig, schema *Schema) (dsyncer dsync.Syncer, err error) {
+// newDownstreamBreaker returns nil if the circuit breaker is disabled or not supported by the downstream
+func newDownstreamBreaker(cfg *SyncerConfig) *loader.CircuitBreaker {
+	if cfg.To == nil || cfg.To.CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+	if cfg.DestDBType != "mysql" && cfg.DestDBType != "tidb" {
+		return nil
+	}
+
+	coolDown := time.Duration(cfg.To.CircuitBreakerCoolDown) * time.Second
+	return loader.NewCircuitBreaker(cfg.To.CircuitBreakerThreshold, coolDown, func(state loader.BreakerState) {
+		downstreamBreakerStateGauge.Set(float64(state))
+	})
+}
+
+func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBackSync, breaker *loader.CircuitBreaker) (dsyncer dsync.Syncer, err error) {
 	switch cfg.DestDBType {
 	case "kafka":
 		dsyncer, err = dsync.NewKafka(cfg.To, schema)
@@ -94,13 +201,31 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema) (dsyncer dsync.Syncer, err
 			return nil, errors.Annotate(err, "fail to create kafka dsyncer")
 		}
 	case "file":
-		dsyncer, err = dsync.NewPBSyncer(cfg.To.BinlogFileDir, schema)
+		if cfg.To.FileFormat == dsync.FileFormatJSONLGzip {
+			dsyncer, err = dsync.NewJSONLSyncer(cfg.To.BinlogFileDir, schema, cfg.To.TxnMarkers, cfg.To.ColumnOrders, cfg.To.RowSequences)
+			if err != nil {
+				return nil, errors.Annotate(err, "fail to create jsonl dsyncer")
+			}
+			break
+		}
+		dsyncer, err = dsync.NewPBSyncer(cfg.To.BinlogFileDir, schema, cfg.To.TxnMarkers)
 		if err != nil {
 			return nil, errors.Annotate(err, "fail to create pb dsyncer")
 		}
 	case "mysql", "tidb":
-		dsyncer, err = dsync.NewMysqlSyncer(cfg.To, schema, cfg.WorkerCount, cfg.TxnBatch, queryHistogramVec, cfg.StrSQLMode, cfg.DestDBType)
+		var deadLetter *dsync.DeadLetter
+		deadLetter, err = dsync.NewDeadLetter(cfg.To, deadLetterCounter)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		dsyncer, err = dsync.NewMysqlSyncer(cfg.To, schema, cfg.WorkerCount, cfg.TxnBatch, &loader.MetricsGroup{
+			QueryHistogramVec: queryHistogramVec,
+			PreparedStmtGauge: preparedStmtGauge,
+		}, cfg.StrSQLMode, cfg.DestDBType, info, cfg.loaderColumnProjections(), breaker, deadLetter, quarantinedRowCounter)
 		if err != nil {
+			if deadLetter != nil {
+				deadLetter.Close()
+			}
 			return nil, errors.Annotate(err, "fail to create mysql dsyncer")
 		}
 		// only use for test
@@ -110,6 +235,14 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema) (dsyncer dsync.Syncer, err
 		return nil, errors.Errorf("unknown DestDBType: %s", cfg.DestDBType)
 	}
 
+	if cfg.To != nil && cfg.To.SnapshotMergeWindow > 0 {
+		window := time.Duration(cfg.To.SnapshotMergeWindow) * time.Second
+		dsyncer, err = dsync.NewSnapshotSyncer(dsyncer, window, cfg.To.SnapshotMergeMaxTxns)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to create snapshot merge dsyncer")
+		}
+	}
+
 	return
 }
 
@@ -170,11 +303,16 @@ func (s *Syncer) enableSafeModeInitializationPhase() {
 // Note we do not send the fake binlog to downstream, we get fake binlog from
 // another chan and it's guaranteed that all the received binlogs before have been synced to downstream
 // when we get the fake binlog from this chan.
-func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
+// If quit is closed, it stops waiting for the left items and saves the checkpoint of the applied ones.
+func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64, quit <-chan struct{}) {
 	successes := s.dsyncer.Successes()
 	var lastSaveTS int64
-	lastSaveTime := time.Now()
+	policy := newSavePolicy(s.cfg.CheckpointSaveTxns, time.Duration(s.cfg.CheckpointSaveInterval)*time.Second)
+	// check the policy periodically, or the save waits for the next item when drainer is idle
+	saveTicker := time.NewTicker(policy.interval)
+	defer saveTicker.Stop()
 
+LOOP:
 	for {
 		if successes == nil && fakeBinlog == nil {
 			break
@@ -192,8 +330,11 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 				break
 			}
 
+			atomic.AddInt64(&s.pendingItems, -1)
 			s.lastSyncTime = time.Now()
-			ts := item.Binlog.CommitTs
+			policy.apply()
+			// the items may be applied out of order, only the ts before which all items are applied is safe to save
+			ts := s.window.done(item.Binlog.CommitTs)
 			if ts > atomic.LoadInt64(lastTS) {
 				atomic.StoreInt64(lastTS, ts)
 			}
@@ -213,18 +354,47 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 			if ts > atomic.LoadInt64(lastTS) {
 				atomic.StoreInt64(lastTS, ts)
 			}
+			// all the items before have been synced, so there's no change committed up to ts left
+			if resolver, ok := s.dsyncer.(dsync.Resolver); ok {
+				resolver.Resolve(ts)
+			}
+
+		case req := <-s.flushes:
+			req.ts = atomic.LoadInt64(lastTS)
+			if util.ComparePositions(req.ts, s.cp.TS()) < 0 {
+				req.ts = s.cp.TS()
+			}
+			log.Info("flush save point", zap.Int64("ts", req.ts))
+			req.err = s.cp.Save(req.ts, 0)
+			if req.err == nil {
+				policy.saved(time.Now())
+				lastSaveTS = req.ts
+				eventCounter.WithLabelValues("savepoint").Add(1)
+				physical, _ := util.ExtractPhysicalLogical(req.ts)
+				checkpointTSOGauge.Set(float64(physical))
+			}
+			close(req.done)
+
+		case <-saveTicker.C:
+
+		case <-quit:
+			log.Warn("stop waiting for the items syncing to downstream",
+				zap.Int64("left items", atomic.LoadInt64(&s.pendingItems)),
+				zap.Int64("applied ts", atomic.LoadInt64(lastTS)))
+			break LOOP
 		}
 
 		ts := atomic.LoadInt64(lastTS)
 		if ts > lastSaveTS {
-			if saveNow || time.Since(lastSaveTime) > 3*time.Second {
+			if saveNow || policy.due(time.Now()) {
 				s.savePoint(ts, appliedTS)
-				lastSaveTime = time.Now()
+				policy.saved(time.Now())
 				lastSaveTS = ts
 				appliedTS = 0
 				eventCounter.WithLabelValues("savepoint").Add(1)
 			}
-			delay := oracle.GetPhysical(time.Now()) - oracle.ExtractPhysical(uint64(ts))
+			physical, _ := util.ExtractPhysicalLogical(ts)
+			delay := oracle.GetPhysical(time.Now()) - physical
 			checkpointDelayHistogram.Observe(float64(delay) / 1e3)
 		}
 	}
@@ -238,8 +408,34 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 	log.Info("handleSuccess quit")
 }
 
+type flushRequest struct {
+	ts   int64
+	err  error
+	done chan struct{}
+}
+
+// FlushCheckpoint saves the checkpoint of the binlogs synced to downstream immediately
+// instead of waiting for the periodic save, and returns the saved ts.
+func (s *Syncer) FlushCheckpoint(ctx context.Context) (int64, error) {
+	req := &flushRequest{done: make(chan struct{})}
+	select {
+	case s.flushes <- req:
+	case <-s.closed:
+		return 0, errors.New("syncer is closed")
+	case <-ctx.Done():
+		return 0, errors.Trace(ctx.Err())
+	}
+
+	// the request is handled without blocking once it's received
+	<-req.done
+	if req.err != nil {
+		return 0, errors.Annotate(req.err, "save checkpoint failed")
+	}
+	return req.ts, nil
+}
+
 func (s *Syncer) savePoint(ts, slaveTS int64) {
-	if ts < s.cp.TS() {
+	if util.ComparePositions(ts, s.cp.TS()) < 0 {
 		log.Error("save ts is less than checkpoint ts %d", zap.Int64("save ts", ts), zap.Int64("checkpoint ts", s.cp.TS()))
 	}
 
@@ -249,13 +445,15 @@ func (s *Syncer) savePoint(ts, slaveTS int64) {
 		log.Fatal("save checkpoint failed", zap.Int64("ts", ts), zap.Error(err))
 	}
 
-	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(ts))))
+	physical, _ := util.ExtractPhysicalLogical(ts)
+	checkpointTSOGauge.Set(float64(physical))
 }
 
 func (s *Syncer) run() error {
 	defer close(s.closed)
 
 	wait := make(chan struct{})
+	drainQuit := make(chan struct{})
 
 	fakeBinlogCh := make(chan *pb.Binlog, 1024)
 	var lastSuccessTS int64
@@ -264,12 +462,17 @@ func (s *Syncer) run() error {
 
 	go func() {
 		defer close(wait)
-		s.handleSuccess(fakeBinlogCh, &lastSuccessTS)
+		s.handleSuccess(fakeBinlogCh, &lastSuccessTS, drainQuit)
 	}()
 
+	if s.lagMonitor != nil {
+		go s.monitorLag(&lastSuccessTS)
+	}
+
 	var err error
 
 	s.enableSafeModeInitializationPhase()
+	s.refreshTrackedTables()
 
 	var lastDDLSchemaVersion int64
 	var b *binlogItem
@@ -277,6 +480,10 @@ func (s *Syncer) run() error {
 	var fakeBinlog *pb.Binlog
 	var pushFakeBinlog chan<- *pb.Binlog
 
+	// recheck the pending fake binlogs periodically, or they wait for the next input when drainer is idle
+	fakeBinlogTicker := time.NewTicker(fakeBinlogCheckInterval)
+	defer fakeBinlogTicker.Stop()
+
 	var lastAddComitTS int64
 	dsyncError := s.dsyncer.Error()
 ForLoop:
@@ -291,16 +498,35 @@ ForLoop:
 				fakeBinlogPreAddTS = fakeBinlogPreAddTS[1:]
 			}
 		}
+		var checkFakeBinlog <-chan time.Time
+		if pushFakeBinlog == nil && len(fakeBinlogs) > 0 {
+			checkFakeBinlog = fakeBinlogTicker.C
+		}
 
+		// the time not spent on handling binlogs is spent on waiting for new ones
+		waitStart := time.Now()
 		select {
 		case err = <-dsyncError:
 			break ForLoop
+		case err = <-s.halt:
+			break ForLoop
 		case <-s.shutdown:
 			break ForLoop
 		case pushFakeBinlog <- fakeBinlog:
 			pushFakeBinlog = nil
+			waitDurationCounter.WithLabelValues(waitUpstream).Add(time.Since(waitStart).Seconds())
+			continue
+		case <-checkFakeBinlog:
+			waitDurationCounter.WithLabelValues(waitUpstream).Add(time.Since(waitStart).Seconds())
+			continue
+		case <-s.ddlHold.released:
+			waitDurationCounter.WithLabelValues(waitUpstream).Add(time.Since(waitStart).Seconds())
+			if err = s.releaseHeldItems(); err != nil {
+				break ForLoop
+			}
 			continue
 		case b = <-s.input:
+			waitDurationCounter.WithLabelValues(waitUpstream).Add(time.Since(waitStart).Seconds())
 			queueSizeGauge.WithLabelValues("syncer_input").Set(float64(len(s.input)))
 			log.Debug("consume binlog item", zap.Stringer("item", b))
 		}
@@ -310,8 +536,18 @@ ForLoop:
 		commitTS := binlog.GetCommitTs()
 		jobID := binlog.GetDdlJobId()
 
-		if isIgnoreTxnCommitTS(s.cfg.IgnoreTxnCommitTS, commitTS) {
+		if s.isSkipTxn(commitTS) {
 			log.Warn("skip txn", zap.Stringer("binlog", b.binlog))
+			// handle it like the fake binlog, so the checkpoint advances past it once the txns before it are applied
+			fakeBinlogs = append(fakeBinlogs, binlog)
+			fakeBinlogPreAddTS = append(fakeBinlogPreAddTS, lastAddComitTS)
+			continue
+		}
+
+		if s.isOversize(binlog) && s.cfg.OversizeBinlogAction == OversizeBinlogSkip {
+			// skip it like the txn to ignore
+			fakeBinlogs = append(fakeBinlogs, binlog)
+			fakeBinlogPreAddTS = append(fakeBinlogPreAddTS, lastAddComitTS)
 			continue
 		}
 
@@ -319,6 +555,13 @@ ForLoop:
 			fakeBinlogs = append(fakeBinlogs, binlog)
 			fakeBinlogPreAddTS = append(fakeBinlogPreAddTS, lastAddComitTS)
 		} else if jobID == 0 {
+			if s.cfg.SchemaOnly {
+				// skip it like the fake binlog, so the checkpoint still advances
+				fakeBinlogs = append(fakeBinlogs, binlog)
+				fakeBinlogPreAddTS = append(fakeBinlogPreAddTS, lastAddComitTS)
+				continue
+			}
+
 			preWriteValue := binlog.GetPrewriteValue()
 			preWrite := &pb.PrewriteValue{}
 			err = preWrite.Unmarshal(preWriteValue)
@@ -343,6 +586,20 @@ ForLoop:
 				err = errors.Annotate(err, "handlePreviousDDLJobIfNeed failed")
 				break ForLoop
 			}
+			s.refreshTrackedTables()
+
+			if s.loopbackSync.Enabled() {
+				var isLoopback bool
+				isLoopback, err = isLoopbackTxn(binlog, preWrite, s.schema, s.loopbackSync)
+				if err != nil {
+					err = errors.Annotate(err, "check loopback txn failed")
+					break ForLoop
+				}
+				if isLoopback {
+					log.Debug("skip txn written by drainer of the same channel", zap.Int64("commit ts", commitTS))
+					continue
+				}
+			}
 
 			var ignore bool
 			ignore, err = filterTable(preWrite, s.filter, s.schema)
@@ -353,9 +610,21 @@ ForLoop:
 
 			if !ignore {
 				s.addDMLEventMetrics(preWrite.GetMutations())
+				item := &dsync.Item{Binlog: binlog, PrewriteValue: preWrite}
+				if s.ddlHold.holdDML(item, s.writtenTables(preWrite)) {
+					log.Debug("hold dml of the tables changed by the held ddl", zap.Int64("commit ts", commitTS))
+					s.window.reserve(commitTS)
+					lastAddComitTS = commitTS
+					continue
+				}
+
 				beginTime := time.Now()
+				var quit bool
+				quit, err = s.sync(item, dsyncError)
+				if quit {
+					break ForLoop
+				}
 				lastAddComitTS = binlog.GetCommitTs()
-				err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: preWrite})
 				if err != nil {
 					err = errors.Annotatef(err, "add to dsyncer, commit ts %d", binlog.CommitTs)
 					break ForLoop
@@ -365,6 +634,10 @@ ForLoop:
 		} else if jobID > 0 {
 			log.Debug("get ddl binlog job", zap.Stringer("job", b.job))
 
+			if err = s.checkExchangePartition(b.job, commitTS); err != nil {
+				break ForLoop
+			}
+
 			// Notice: the version of DDL Binlog we receive are Monotonically increasing
 			// DDL (with version 10, commit ts 100) -> DDL (with version 9, commit ts 101) would never happen
 			s.schema.addJob(b.job)
@@ -377,6 +650,7 @@ ForLoop:
 				err = errors.Trace(err)
 				break ForLoop
 			}
+			s.refreshTrackedTables()
 
 			if b.job.SchemaState == model.StateDeleteOnly && b.job.Type == model.ActionDropColumn {
 				log.Info("Syncer skips DeleteOnly DDL", zap.Stringer("job", b.job), zap.Int64("ts", b.GetCommitTs()))
@@ -391,18 +665,51 @@ ForLoop:
 				break ForLoop
 			}
 
-			if s.filter.SkipSchemaAndTable(schema, table) {
+			if renames, ok := s.schema.getRenamesAndDelete(b.job.BinlogInfo.SchemaVersion); ok {
+				var to *TableName
+				sql, to, err = s.renameTablesQuery(renames, commitTS)
+				if err != nil {
+					break ForLoop
+				}
+				if to != nil {
+					schema, table = to.Schema, to.Table
+					binlog.DdlQuery = []byte(sql)
+				}
+			}
+
+			tempKind, isTemp := s.schema.getTemporaryTableAndDelete(b.job.BinlogInfo.SchemaVersion)
+
+			if sql == "" || s.filter.SkipSchemaAndTable(schema, table) {
 				log.Info("skip ddl", zap.String("schema", schema), zap.String("table", table),
-					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+					zap.String("sql", b.job.Query), zap.Int64("commit ts", commitTS))
+			} else if isTemp && s.skipTemporaryTable(tempKind) {
+				log.Info("skip ddl of temporary table", zap.String("kind", tempKind), zap.String("schema", schema),
+					zap.String("table", table), zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+				skippedTemporaryTableCounter.WithLabelValues(tempKind, "ddl").Inc()
+			} else if names, ok := s.skipSetVariables(sql); ok {
+				log.Info("skip set statement, add the variables to `replicate-set-variables` to replicate it",
+					zap.Strings("variables", names), zap.String("sql", sql), zap.Int64("commit ts", commitTS))
 			} else if sql != "" {
 				s.addDDLCount()
 				beginTime := time.Now()
 				lastAddComitTS = binlog.GetCommitTs()
 
+				item := &dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table}
+				if s.ddlHold.holdDDL(item) {
+					log.Warn("hold ddl until it's released by `PUT /ddl_hold/release`",
+						zap.String("sql", sql), zap.Int64("commit ts", binlog.CommitTs))
+					s.window.reserve(commitTS)
+					continue
+				}
+
 				log.Info("add ddl item to syncer, you can add this commit ts to `ignore-txn-commit-ts` to skip this ddl if needed",
 					zap.String("sql", sql), zap.Int64("commit ts", binlog.CommitTs))
 
-				err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table})
+				var quit bool
+				quit, err = s.sync(item, dsyncError)
+				if quit {
+					break ForLoop
+				}
 				if err != nil {
 					err = errors.Annotatef(err, "add to dsyncer, commit ts %d", binlog.CommitTs)
 					break ForLoop
@@ -413,9 +720,31 @@ ForLoop:
 	}
 
 	close(fakeBinlogCh)
-	cerr := s.dsyncer.Close()
-	if cerr != nil {
+
+	var cerr error
+	if s.syncBlocked {
+		// closing dsyncer while Sync is blocked isn't safe, it's left to drainer quitting after being halted,
+		// and the applied items are still safe to be saved in checkpoint
+		close(drainQuit)
+		cerr = errors.New("downstream is blocked, quit without closing it")
 		log.Error("Failed to close syncer", zap.Error(cerr))
+	} else {
+		closeErr := make(chan error, 1)
+		go func() {
+			closeErr <- s.dsyncer.Close()
+		}()
+
+		select {
+		case cerr = <-closeErr:
+			if cerr != nil {
+				log.Error("Failed to close syncer", zap.Error(cerr))
+			}
+		case <-time.After(shutdownDrainDeadline):
+			// the applied items are still safe to be saved in checkpoint
+			close(drainQuit)
+			cerr = errors.Errorf("downstream can't drain all items in %s", shutdownDrainDeadline)
+			log.Error("Failed to close syncer", zap.Error(cerr))
+		}
 	}
 
 	select {
@@ -431,6 +760,44 @@ ForLoop:
 	return cerr
 }
 
+// monitorLag checks the lag of the txns applied until lastTS or the checkpoint periodically until the syncer
+// is closed, the syncer is halted by the error of lagMonitor.
+func (s *Syncer) monitorLag(lastTS *int64) {
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case now := <-ticker.C:
+			ts := atomic.LoadInt64(lastTS)
+			if cpTS := s.cp.TS(); cpTS > ts {
+				ts = cpTS
+			}
+			if err := s.lagMonitor.check(now, ts); err != nil {
+				s.halt <- err
+				return
+			}
+		}
+	}
+}
+
+// skipSetVariables checks whether sql is a `SET` statement setting any variable not in `replicate-set-variables`,
+// the variables are returned if it's skipped.
+func (s *Syncer) skipSetVariables(sql string) ([]string, bool) {
+	names, ok := setVariables(sql)
+	if !ok {
+		return nil, false
+	}
+	for _, name := range names {
+		if _, replicate := s.setVariables[name]; !replicate {
+			return names, true
+		}
+	}
+	return nil, false
+}
+
 // filterTable may drop some table mutation in `PrewriteValue`
 // Return true if all table mutations are dropped.
 func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema) (ignore bool, err error) {
@@ -446,6 +813,13 @@ func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema) (i
 			continue
 		}
 
+		// the data of the temporary tables is only visible to the session or the txn writing it
+		if kind, ok := schema.TemporaryTableKind(mutation.GetTableId()); ok {
+			log.Debug("skip dml of temporary table", zap.String("schema", schemaName), zap.String("table", tableName))
+			skippedTemporaryTableCounter.WithLabelValues(kind, "dml").Inc()
+			continue
+		}
+
 		muts = append(muts, mutation)
 	}
 
@@ -458,6 +832,53 @@ func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema) (i
 	return
 }
 
+// skipTemporaryTable returns true if the DDLs of the temporary tables of the kind are not synced,
+// a local temporary table is only visible to the session creating it, so it's never synced.
+func (s *Syncer) skipTemporaryTable(kind string) bool {
+	if kind == localTemporaryTable {
+		return true
+	}
+	switch s.cfg.GlobalTemporaryTable {
+	case GlobalTemporaryTableReplicate:
+		return false
+	case GlobalTemporaryTableSkip:
+		return true
+	}
+	return s.cfg.DestDBType == "mysql"
+}
+
+// isLoopbackTxn returns true if the txn updates the mark table with the same channel id,
+// which means the txn is written by drainer of the same channel and should not be synced back.
+func isLoopbackTxn(binlog *pb.Binlog, pv *pb.PrewriteValue, schema *Schema, info *loopbacksync.LoopBackSync) (bool, error) {
+	markPV := &pb.PrewriteValue{SchemaVersion: pv.SchemaVersion}
+	for _, mutation := range pv.GetMutations() {
+		schemaName, tableName, ok := schema.SchemaAndTableName(mutation.GetTableId())
+		if !ok {
+			return false, errors.Errorf("not found table id: %d", mutation.GetTableId())
+		}
+		if loopbacksync.IsMarkTable(schemaName, tableName) {
+			markPV.Mutations = append(markPV.Mutations, mutation)
+		}
+	}
+
+	if len(markPV.Mutations) == 0 {
+		return false, nil
+	}
+
+	txn, err := translator.TiBinlogToTxn(schema, "", "", binlog, markPV, time.Local)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	for _, dml := range txn.DMLs {
+		if id, ok := dml.Values[loopbacksync.ChannelID].(int64); ok && id == info.ChannelID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func isIgnoreTxnCommitTS(ignoreTxnCommitTS []int64, ts int64) bool {
 	for _, ignoreTS := range ignoreTxnCommitTS {
 		if ignoreTS == ts {
@@ -467,6 +888,186 @@ func isIgnoreTxnCommitTS(ignoreTxnCommitTS []int64, ts int64) bool {
 	return false
 }
 
+// SkipTxn adds the txn of commitTS to skip, it's not synced to downstream when it's reached.
+// It returns the commit ts of all the txns to skip.
+func (s *Syncer) SkipTxn(commitTS int64) []int64 {
+	s.skipMu.Lock()
+	defer s.skipMu.Unlock()
+
+	if !isIgnoreTxnCommitTS(s.skipTxnCommitTS, commitTS) {
+		s.skipTxnCommitTS = append(s.skipTxnCommitTS, commitTS)
+	}
+	return append([]int64(nil), s.skipTxnCommitTS...)
+}
+
+// isOversize checks whether the prewrite value of binlog is larger than MaxBinlogSize,
+// the oversize binlog is logged and counted by the action to handle it.
+func (s *Syncer) isOversize(binlog *pb.Binlog) bool {
+	size := int64(len(binlog.GetPrewriteValue()))
+	if s.cfg.MaxBinlogSize <= 0 || size <= s.cfg.MaxBinlogSize {
+		return false
+	}
+
+	action := s.cfg.OversizeBinlogAction
+	if len(action) == 0 {
+		action = OversizeBinlogLog
+	}
+	log.Warn("binlog is larger than max-binlog-size",
+		zap.Int64("start ts", binlog.GetStartTs()),
+		zap.Int64("commit ts", binlog.GetCommitTs()),
+		zap.Int64("size", size),
+		zap.Int64("max-binlog-size", s.cfg.MaxBinlogSize),
+		zap.String("action", action))
+	oversizeBinlogCounter.WithLabelValues(action).Inc()
+	return true
+}
+
+// checkExchangePartition refuses to replicate `EXCHANGE PARTITION` if either of the tables is replicated,
+// the binlog doesn't carry the rows moved between the partition and the table, and the exchanged table IDs
+// can't be tracked by the schema, so the data of both tables would be lost or misplaced silently in downstream.
+func (s *Syncer) checkExchangePartition(job *model.Job, commitTS int64) error {
+	defaultSchema := job.SchemaName
+	if db, ok := s.schema.SchemaByID(job.SchemaID); ok {
+		defaultSchema = db.Name.O
+	}
+	partitioned, exchanged, ok := exchangePartitionTables(job.Query, defaultSchema)
+	if !ok {
+		return nil
+	}
+
+	if s.filter.SkipSchemaAndTable(partitioned.Schema, partitioned.Table) && s.filter.SkipSchemaAndTable(exchanged.Schema, exchanged.Table) {
+		log.Info("skip exchange partition ddl of the tables not replicated", zap.String("sql", job.Query), zap.Int64("commit ts", commitTS))
+		return nil
+	}
+
+	return errors.Errorf("EXCHANGE PARTITION can't be replicated safely, the rows exchanged between %s.%s and %s.%s aren't in binlog, "+
+		"please exchange the partition in downstream manually and make sure the data of both tables is consistent with upstream "+
+		"(e.g. by a full backup), or exclude both tables from replication, then add commit ts %d to `ignore-txn-commit-ts` to skip it, ddl: %s",
+		partitioned.Schema, partitioned.Table, exchanged.Schema, exchanged.Table, commitTS, job.Query)
+}
+
+// renameTablesQuery returns the `RENAME TABLE` query of the renames replicated and the first table renamed to,
+// the query is empty if none of them is replicated.
+// The renames with both sides replicated are kept and qualified by the schemas, as the schema of the query may be
+// neither of them in downstream, and the ones with neither side replicated are left out. Renaming between a table
+// replicated and one not replicated is handled by rename-across-filter, the downstream table is either missing or
+// left stale, so it's skipped by default.
+func (s *Syncer) renameTablesQuery(renames []tableRename, commitTS int64) (string, *TableName, error) {
+	var kept []tableRename
+	for _, rename := range renames {
+		skipFrom := s.filter.SkipSchemaAndTable(rename.From.Schema, rename.From.Table)
+		skipTo := s.filter.SkipSchemaAndTable(rename.To.Schema, rename.To.Table)
+		if skipFrom && skipTo {
+			continue
+		}
+		if skipFrom != skipTo {
+			if s.cfg.RenameAcrossFilter == RenameAcrossFilterError {
+				return "", nil, errors.Errorf("rename table %s.%s to %s.%s across the filter at commit ts %d, "+
+					"please rename it in downstream manually, then add the commit ts to `ignore-txn-commit-ts` to skip it",
+					rename.From.Schema, rename.From.Table, rename.To.Schema, rename.To.Table, commitTS)
+			}
+			log.Warn("skip renaming table across the filter",
+				zap.String("from", pkgsql.QuoteSchema(rename.From.Schema, rename.From.Table)),
+				zap.String("to", pkgsql.QuoteSchema(rename.To.Schema, rename.To.Table)),
+				zap.Int64("commit ts", commitTS))
+			continue
+		}
+		kept = append(kept, rename)
+	}
+	if len(kept) == 0 {
+		return "", nil, nil
+	}
+
+	pairs := make([]string, 0, len(kept))
+	for _, rename := range kept {
+		pairs = append(pairs, pkgsql.QuoteSchema(rename.From.Schema, rename.From.Table)+" TO "+pkgsql.QuoteSchema(rename.To.Schema, rename.To.Table))
+	}
+	return "RENAME TABLE " + strings.Join(pairs, ", "), &kept[0].To, nil
+}
+
+// refreshTrackedTables refreshes the snapshot of the tracked tables if the schema has changed since it's taken
+func (s *Syncer) refreshTrackedTables() {
+	version := s.schema.CurrentVersion()
+	s.tablesMu.RLock()
+	changed := s.trackedTables == nil || s.tablesVersion != version
+	s.tablesMu.RUnlock()
+	if !changed {
+		return
+	}
+
+	tables := s.schema.TrackedTables()
+	s.tablesMu.Lock()
+	s.tablesVersion = version
+	s.trackedTables = tables
+	s.tablesMu.Unlock()
+}
+
+// TrackedTables returns the schema version and the tables tracked in schema at the version
+func (s *Syncer) TrackedTables() (int64, []TrackedTable) {
+	s.tablesMu.RLock()
+	defer s.tablesMu.RUnlock()
+	return s.tablesVersion, append([]TrackedTable{}, s.trackedTables...)
+}
+
+// HoldDDL turns on the DDL hold, the DDLs reached later and the DMLs depending on them are held until ReleaseDDL.
+func (s *Syncer) HoldDDL() {
+	s.ddlHold.hold()
+}
+
+// ReleaseDDL turns off the DDL hold, and returns the count of the held items, which are synced in commit order.
+func (s *Syncer) ReleaseDDL() (int, error) {
+	return s.ddlHold.release()
+}
+
+// DDLHoldStatus returns whether the DDL hold is on and the commit ts of the held items
+func (s *Syncer) DDLHoldStatus() (bool, []int64) {
+	return s.ddlHold.status()
+}
+
+// releaseHeldItems sends the items held by ddlHold to dsyncer in commit order, they take no slots
+// of window as their positions are reserved when they're held.
+func (s *Syncer) releaseHeldItems() error {
+	items := s.ddlHold.take()
+	if len(items) > 0 {
+		log.Info("release the held ddls and dmls", zap.Int("count", len(items)))
+	}
+	for _, item := range items {
+		atomic.AddInt64(&s.pendingItems, 1)
+		quit, err := s.syncItem(item)
+		if quit {
+			return errors.Trace(err)
+		}
+		if err != nil {
+			return errors.Annotatef(err, "add to dsyncer, commit ts %d", item.Binlog.CommitTs)
+		}
+	}
+	return nil
+}
+
+// writtenTables returns the tables of the mutations of pv known by schema
+func (s *Syncer) writtenTables(pv *pb.PrewriteValue) []TableName {
+	tables := make([]TableName, 0, len(pv.GetMutations()))
+	for _, mut := range pv.GetMutations() {
+		if schema, table, ok := s.schema.SchemaAndTableName(mut.GetTableId()); ok {
+			tables = append(tables, TableName{Schema: schema, Table: table})
+		}
+	}
+	return tables
+}
+
+// GetSkipTxns returns the commit ts of the txns to skip
+func (s *Syncer) GetSkipTxns() []int64 {
+	s.skipMu.RLock()
+	defer s.skipMu.RUnlock()
+	return append([]int64(nil), s.skipTxnCommitTS...)
+}
+
+func (s *Syncer) isSkipTxn(commitTS int64) bool {
+	s.skipMu.RLock()
+	defer s.skipMu.RUnlock()
+	return isIgnoreTxnCommitTS(s.skipTxnCommitTS, commitTS)
+}
+
 // Add adds binlogItem to the syncer's input channel
 func (s *Syncer) Add(b *binlogItem) {
 	select {
@@ -485,11 +1086,64 @@ func (s *Syncer) Close() error {
 	return nil
 }
 
+// sync sends the item to dsyncer after the count of in-flight items is under the limit,
+// quit is true if the syncer is shut down or dsyncer fails while waiting, err is the error of dsyncer if any.
+func (s *Syncer) sync(item *dsync.Item, dsyncError <-chan error) (quit bool, err error) {
+	start := time.Now()
+	defer func() {
+		waitDurationCounter.WithLabelValues(waitDownstream).Add(time.Since(start).Seconds())
+	}()
+
+	if s.window.slots != nil {
+		select {
+		case s.window.slots <- struct{}{}:
+		case err = <-dsyncError:
+			return true, err
+		case err = <-s.halt:
+			return true, err
+		case <-s.shutdown:
+			return true, nil
+		}
+	}
+
+	s.window.add(item.Binlog.CommitTs)
+	atomic.AddInt64(&s.pendingItems, 1)
+	return s.syncItem(item)
+}
+
+// syncItem sends the item to dsyncer, quit is true if the syncer is halted while dsyncer.Sync is blocked
+func (s *Syncer) syncItem(item *dsync.Item) (quit bool, err error) {
+	if s.lagMonitor == nil || !s.lagMonitor.halt {
+		return false, s.dsyncer.Sync(item)
+	}
+
+	// dsyncer.Sync blocks if downstream is stuck, which is when the lag monitor halts the syncer
+	synced := make(chan error, 1)
+	go func() {
+		synced <- s.dsyncer.Sync(item)
+	}()
+	select {
+	case err = <-synced:
+		return false, err
+	case err = <-s.halt:
+		s.syncBlocked = true
+		return true, err
+	}
+}
+
 // GetLastSyncTime returns lastSyncTime
 func (s *Syncer) GetLastSyncTime() time.Time {
 	return s.lastSyncTime
 }
 
+// GetBreakerState returns the state of downstream's circuit breaker, it's empty if disabled.
+func (s *Syncer) GetBreakerState() string {
+	if s.breaker == nil {
+		return ""
+	}
+	return s.breaker.State().String()
+}
+
 // GetLatestCommitTS returns the latest commit ts.
 func (s *Syncer) GetLatestCommitTS() int64 {
 	return s.cp.TS()
@@ -14,14 +14,26 @@
 package drainer
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
 	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type syncerSuite struct{}
@@ -173,6 +185,1140 @@ func (s *syncerSuite) TestNewSyncer(c *check.C) {
 	c.Assert(syncer.GetLatestCommitTS(), check.Greater, lastNoneFakeTS)
 }
 
+// stuckSyncer only applies the first applyCount items, and can't be closed until released
+type stuckSyncer struct {
+	applyCount int
+	applied    int
+
+	successes chan *dsync.Item
+	release   chan struct{}
+}
+
+var _ dsync.Syncer = &stuckSyncer{}
+
+func (s *stuckSyncer) Sync(item *dsync.Item) error {
+	if s.applied < s.applyCount {
+		s.applied++
+		s.successes <- item
+	}
+	return nil
+}
+
+func (s *stuckSyncer) Successes() <-chan *dsync.Item {
+	return s.successes
+}
+
+func (s *stuckSyncer) Close() error {
+	<-s.release
+	close(s.successes)
+	return nil
+}
+
+func (s *stuckSyncer) Error() <-chan error {
+	return make(chan error)
+}
+
+func (s *syncerSuite) TestSaveAppliedCheckpointOnDrainTimeout(c *check.C) {
+	origDeadline := shutdownDrainDeadline
+	shutdownDrainDeadline = 100 * time.Millisecond
+	defer func() {
+		shutdownDrainDeadline = origDeadline
+	}()
+
+	cfg := &SyncerConfig{DestDBType: "_intercept"}
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+
+	syncer, err := NewSyncer(cp, cfg, nil)
+	c.Assert(err, check.IsNil)
+
+	var testTableID int64 = 2
+	syncer.schema.tableIDToName[testTableID] = TableName{Schema: "test", Table: "test"}
+	stuck := &stuckSyncer{
+		applyCount: 2,
+		successes:  make(chan *dsync.Item, 8),
+		release:    make(chan struct{}),
+	}
+	defer close(stuck.release)
+	syncer.dsyncer = stuck
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	for commitTS := int64(1); commitTS <= 3; commitTS++ {
+		syncer.Add(&binlogItem{
+			binlog: &pb.Binlog{
+				Tp:            pb.BinlogType_Commit,
+				CommitTs:      commitTS,
+				PrewriteValue: getEmptyPrewriteValue(0, testTableID),
+			},
+		})
+	}
+
+	// wait until the first two items are applied, and the last one is stuck
+	for i := 0; i < 100 && atomic.LoadInt64(&syncer.pendingItems) != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadInt64(&syncer.pendingItems), check.Equals, int64(1))
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.ErrorMatches, ".*can't drain.*")
+
+	// only the applied items are saved
+	c.Assert(cp.TS(), check.Equals, int64(2))
+}
+
+// blockedSyncer applies applyCount items, and then blocks in Sync until it's released, like the downstream is stuck
+type blockedSyncer struct {
+	stuckSyncer
+	syncing chan struct{}
+}
+
+func (s *blockedSyncer) Sync(item *dsync.Item) error {
+	if s.applied < s.applyCount {
+		return s.stuckSyncer.Sync(item)
+	}
+	s.syncing <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func (s *syncerSuite) TestMaxLagHaltBlockedSync(c *check.C) {
+	origInterval := lagCheckInterval
+	lagCheckInterval = 10 * time.Millisecond
+	defer func() {
+		lagCheckInterval = origInterval
+	}()
+
+	cfg := &SyncerConfig{DestDBType: "_intercept", MaxLag: 1, MaxLagAction: MaxLagHalt}
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, cfg, nil)
+	c.Assert(err, check.IsNil)
+	syncer.schema.tableIDToName[2] = TableName{Schema: "test", Table: "test"}
+	blocked := &blockedSyncer{
+		stuckSyncer: stuckSyncer{applyCount: 1, successes: make(chan *dsync.Item, 8), release: make(chan struct{})},
+		syncing:     make(chan struct{}, 1),
+	}
+	defer close(blocked.release)
+	syncer.dsyncer = blocked
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+	for commitTS := int64(1); commitTS <= 2; commitTS++ {
+		syncer.Add(&binlogItem{
+			binlog: &pb.Binlog{
+				Tp:            pb.BinlogType_Commit,
+				CommitTs:      commitTS,
+				PrewriteValue: getEmptyPrewriteValue(0, 2),
+			},
+		})
+	}
+
+	// the syncer is halted while it's blocked in dsyncer.Sync
+	<-blocked.syncing
+	select {
+	case err := <-errCh:
+		c.Assert(err, check.ErrorMatches, "the lag .* exceeds max-lag 1s for 0s, the applied ts is 1, halt the syncer")
+	case <-time.After(5 * time.Second):
+		c.Fatal("the syncer is not halted")
+	}
+	// only the applied txn is saved
+	c.Assert(cp.TS(), check.Equals, int64(1))
+}
+
+// holdSyncer holds the items until they are acked by the test
+type holdSyncer struct {
+	mu        sync.Mutex
+	held      []*dsync.Item
+	maxHeld   int
+	received  chan struct{}
+	successes chan *dsync.Item
+	// the latest ts resolved by the syncer
+	resolved int64
+}
+
+var _ dsync.Syncer = &holdSyncer{}
+var _ dsync.Resolver = &holdSyncer{}
+
+func newHoldSyncer() *holdSyncer {
+	return &holdSyncer{
+		received:  make(chan struct{}, 64),
+		successes: make(chan *dsync.Item, 64),
+	}
+}
+
+func (s *holdSyncer) Sync(item *dsync.Item) error {
+	s.mu.Lock()
+	s.held = append(s.held, item)
+	if len(s.held) > s.maxHeld {
+		s.maxHeld = len(s.held)
+	}
+	s.mu.Unlock()
+	s.received <- struct{}{}
+	return nil
+}
+
+// ack applies the held items except the first skip ones in reverse order
+func (s *holdSyncer) ack(skip int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.held) - 1; i >= skip; i-- {
+		s.successes <- s.held[i]
+	}
+	s.held = s.held[:skip]
+}
+
+func (s *holdSyncer) Resolve(ts int64) {
+	atomic.StoreInt64(&s.resolved, ts)
+}
+
+func (s *holdSyncer) Successes() <-chan *dsync.Item {
+	return s.successes
+}
+
+func (s *holdSyncer) Close() error {
+	close(s.successes)
+	return nil
+}
+
+func (s *holdSyncer) Error() <-chan error {
+	return make(chan error)
+}
+
+func (s *syncerSuite) startHoldSyncer(c *check.C, limit int) (*Syncer, *holdSyncer, checkpoint.CheckPoint, <-chan error) {
+	return s.startHoldSyncerWithConfig(c, &SyncerConfig{DestDBType: "_intercept", MaxInflightTxns: limit})
+}
+
+// startHoldSyncerWithConfig starts a syncer with cfg, the txns of commit ts 1 to 6 are added to it
+func (s *syncerSuite) startHoldSyncerWithConfig(c *check.C, cfg *SyncerConfig) (*Syncer, *holdSyncer, checkpoint.CheckPoint, <-chan error) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+
+	syncer, err := NewSyncer(cp, cfg, nil)
+	c.Assert(err, check.IsNil)
+	syncer.schema.tableIDToName[2] = TableName{Schema: "test", Table: "test"}
+	hold := newHoldSyncer()
+	syncer.dsyncer = hold
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	go func() {
+		for commitTS := int64(1); commitTS <= 6; commitTS++ {
+			syncer.Add(&binlogItem{
+				binlog: &pb.Binlog{
+					Tp:            pb.BinlogType_Commit,
+					CommitTs:      commitTS,
+					PrewriteValue: getEmptyPrewriteValue(0, 2),
+				},
+			})
+		}
+	}()
+
+	return syncer, hold, cp, errCh
+}
+
+func waitReceived(c *check.C, hold *holdSyncer, count int) {
+	for i := 0; i < count; i++ {
+		select {
+		case <-hold.received:
+		case <-time.After(time.Second):
+			c.Fatalf("only %d items are received, expect %d", i, count)
+		}
+	}
+
+	// no more items should be sent while the limit is reached
+	select {
+	case <-hold.received:
+		c.Fatal("the count of in-flight txns exceeds the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (s *syncerSuite) TestMaxInflightTxns(c *check.C) {
+	for _, limit := range []int{1, 3} {
+		syncer, hold, cp, errCh := s.startHoldSyncer(c, limit)
+
+		for sent := 0; sent < 6; sent += limit {
+			waitReceived(c, hold, limit)
+			c.Assert(syncer.window.inflight(), check.Equals, limit)
+			hold.ack(0)
+		}
+
+		c.Assert(syncer.Close(), check.IsNil)
+		c.Assert(<-errCh, check.IsNil)
+		c.Assert(hold.maxHeld, check.Equals, limit)
+		c.Assert(cp.TS(), check.Equals, int64(6))
+	}
+}
+
+func (s *syncerSuite) TestCheckpointInCommitOrder(c *check.C) {
+	syncer, hold, cp, errCh := s.startHoldSyncer(c, 3)
+
+	// the txns after the first one are applied, the slots of them are released
+	waitReceived(c, hold, 3)
+	hold.ack(1)
+	waitReceived(c, hold, 2)
+	hold.ack(1)
+	waitReceived(c, hold, 1)
+	c.Assert(syncer.window.inflight(), check.Equals, 2)
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	// the earliest txn isn't applied, so the checkpoint can't advance
+	c.Assert(cp.TS(), check.Equals, int64(0))
+}
+
+func (s *syncerSuite) TestFlushCheckpoint(c *check.C) {
+	syncer, hold, cp, errCh := s.startHoldSyncer(c, 0)
+	waitReceived(c, hold, 6)
+	hold.ack(0)
+	for i := 0; i < 100 && atomic.LoadInt64(&syncer.pendingItems) != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadInt64(&syncer.pendingItems), check.Equals, int64(0))
+	// the periodic save isn't due yet
+	c.Assert(cp.TS(), check.Equals, int64(0))
+
+	// the flushes are safe to run concurrently with each other and the periodic save
+	var wg sync.WaitGroup
+	flushed := make([]int64, 4)
+	for i := range flushed {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ts, err := syncer.FlushCheckpoint(context.Background())
+			c.Assert(err, check.IsNil)
+			flushed[i] = ts
+		}(i)
+	}
+	wg.Wait()
+	c.Assert(flushed, check.DeepEquals, []int64{6, 6, 6, 6})
+	c.Assert(cp.TS(), check.Equals, int64(6))
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	_, err := syncer.FlushCheckpoint(context.Background())
+	c.Assert(err, check.ErrorMatches, ".*syncer is closed.*")
+}
+
+func (s *syncerSuite) TestCheckpointSaveCadence(c *check.C) {
+	waitSaved := func(cp checkpoint.CheckPoint, ts int64) {
+		for i := 0; i < 100 && cp.TS() != ts; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Assert(cp.TS(), check.Equals, ts)
+	}
+
+	// saved after every 3 txns are applied
+	cfg := &SyncerConfig{DestDBType: "_intercept", CheckpointSaveTxns: 3, CheckpointSaveInterval: 3600}
+	syncer, hold, cp, errCh := s.startHoldSyncerWithConfig(c, cfg)
+	waitReceived(c, hold, 6)
+	hold.ack(5)
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(cp.TS(), check.Equals, int64(0))
+	hold.ack(4)
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(cp.TS(), check.Equals, int64(0))
+	// the txns before are applied, but the earliest one isn't, so the checkpoint can't advance
+	hold.ack(3)
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(cp.TS(), check.Equals, int64(0))
+	hold.ack(0)
+	waitSaved(cp, 6)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+
+	// only saved on shutdown before the interval passes
+	cfg = &SyncerConfig{DestDBType: "_intercept", CheckpointSaveInterval: 3600}
+	syncer, hold, cp, errCh = s.startHoldSyncerWithConfig(c, cfg)
+	waitReceived(c, hold, 6)
+	hold.ack(0)
+	for i := 0; i < 100 && atomic.LoadInt64(&syncer.pendingItems) != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadInt64(&syncer.pendingItems), check.Equals, int64(0))
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(cp.TS(), check.Equals, int64(0))
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	c.Assert(cp.TS(), check.Equals, int64(6))
+
+	// saved every interval even if there's no more item
+	cfg = &SyncerConfig{DestDBType: "_intercept", CheckpointSaveInterval: 1}
+	syncer, hold, cp, errCh = s.startHoldSyncerWithConfig(c, cfg)
+	waitReceived(c, hold, 6)
+	hold.ack(0)
+	for i := 0; i < 300 && cp.TS() != 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(cp.TS(), check.Equals, int64(6))
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+}
+
+func (s *syncerSuite) TestSkipTxn(c *check.C) {
+	cfg := &SyncerConfig{DestDBType: "_intercept", IgnoreTxnCommitTS: []int64{3, 6}}
+	syncer, hold, cp, errCh := s.startHoldSyncerWithConfig(c, cfg)
+	waitReceived(c, hold, 4)
+
+	var received []int64
+	hold.mu.Lock()
+	for _, item := range hold.held {
+		received = append(received, item.Binlog.CommitTs)
+	}
+	hold.mu.Unlock()
+	c.Assert(received, check.DeepEquals, []int64{1, 2, 4, 5})
+
+	hold.ack(0)
+	// the checkpoint advances past the skipped txns even if there's no more input
+	var ts int64
+	for i := 0; i < 300 && ts != 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		ts, err = syncer.FlushCheckpoint(context.Background())
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(ts, check.Equals, int64(6))
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	c.Assert(cp.TS(), check.Equals, int64(6))
+}
+
+func (s *syncerSuite) TestOversizeBinlog(c *check.C) {
+	size := int64(len(getEmptyPrewriteValue(0, 2)))
+
+	// the binlogs not larger than the limit are synced as usual
+	skipped := counterValue(c, oversizeBinlogCounter.WithLabelValues(OversizeBinlogSkip))
+	cfg := &SyncerConfig{DestDBType: "_intercept", MaxBinlogSize: size, OversizeBinlogAction: OversizeBinlogSkip}
+	syncer, hold, _, errCh := s.startHoldSyncerWithConfig(c, cfg)
+	waitReceived(c, hold, 6)
+	hold.ack(0)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	c.Assert(counterValue(c, oversizeBinlogCounter.WithLabelValues(OversizeBinlogSkip)), check.Equals, skipped)
+
+	// the oversize binlogs are synced after they're logged
+	logged := counterValue(c, oversizeBinlogCounter.WithLabelValues(OversizeBinlogLog))
+	cfg = &SyncerConfig{DestDBType: "_intercept", MaxBinlogSize: size - 1}
+	syncer, hold, cp, errCh := s.startHoldSyncerWithConfig(c, cfg)
+	waitReceived(c, hold, 6)
+	hold.ack(0)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	c.Assert(cp.TS(), check.Equals, int64(6))
+	c.Assert(counterValue(c, oversizeBinlogCounter.WithLabelValues(OversizeBinlogLog)), check.Equals, logged+6)
+
+	// the oversize binlogs are skipped, the checkpoint advances past them
+	cfg = &SyncerConfig{DestDBType: "_intercept", MaxBinlogSize: size - 1, OversizeBinlogAction: OversizeBinlogSkip}
+	syncer, hold, cp, errCh = s.startHoldSyncerWithConfig(c, cfg)
+	waitReceived(c, hold, 0)
+	var ts int64
+	for i := 0; i < 300 && ts != 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		ts, err = syncer.FlushCheckpoint(context.Background())
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(ts, check.Equals, int64(6))
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	c.Assert(cp.TS(), check.Equals, int64(6))
+	c.Assert(counterValue(c, oversizeBinlogCounter.WithLabelValues(OversizeBinlogSkip)), check.Equals, skipped+6)
+}
+
+func (s *syncerSuite) TestSchemaOnly(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept", SchemaOnly: true}, nil)
+	c.Assert(err, check.IsNil)
+	hold := newHoldSyncer()
+	syncer.dsyncer = hold
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	dml := func(commitTS int64) *binlogItem {
+		return &binlogItem{binlog: &pb.Binlog{
+			Tp:            pb.BinlogType_Commit,
+			CommitTs:      commitTS,
+			PrewriteValue: getEmptyPrewriteValue(0, 2),
+		}}
+	}
+	syncer.Add(&binlogItem{
+		binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: 1, DdlJobId: 1, DdlQuery: []byte("create database test")},
+		job: &model.Job{
+			ID:    1,
+			Type:  model.ActionCreateSchema,
+			State: model.JobStateSynced,
+			Query: "create database test",
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: 1,
+				DBInfo:        &model.DBInfo{ID: 1, Name: model.NewCIStr("test")},
+			},
+		},
+	})
+	syncer.Add(dml(2))
+	syncer.Add(&binlogItem{
+		binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: 3, DdlJobId: 2, DdlQuery: []byte("create table test.test(id int)")},
+		job: &model.Job{
+			ID:       2,
+			SchemaID: 1,
+			Type:     model.ActionCreateTable,
+			State:    model.JobStateSynced,
+			Query:    "create table test.test(id int)",
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: 2,
+				TableInfo:     &model.TableInfo{ID: 2, Name: model.NewCIStr("test")},
+			},
+		},
+	})
+	syncer.Add(dml(4))
+	syncer.Add(dml(5))
+
+	// only the DDLs are synced
+	waitReceived(c, hold, 2)
+	var received []int64
+	hold.mu.Lock()
+	for _, item := range hold.held {
+		c.Assert(item.PrewriteValue, check.IsNil)
+		received = append(received, item.Binlog.CommitTs)
+	}
+	hold.mu.Unlock()
+	c.Assert(received, check.DeepEquals, []int64{1, 3})
+
+	hold.ack(0)
+	// the checkpoint advances past the skipped DMLs
+	var ts int64
+	for i := 0; i < 300 && ts != 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		ts, err = syncer.FlushCheckpoint(context.Background())
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(ts, check.Equals, int64(5))
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+	c.Assert(cp.TS(), check.Equals, int64(5))
+}
+
+func (s *syncerSuite) TestResolveFakeBinlog(c *check.C) {
+	syncer, hold, _, errCh := s.startHoldSyncer(c, 0)
+	waitReceived(c, hold, 6)
+	syncer.Add(&binlogItem{binlog: &pb.Binlog{StartTs: 7, CommitTs: 7}})
+
+	// the fake binlog is resolved only after all the items before it are synced
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(atomic.LoadInt64(&hold.resolved), check.Equals, int64(0))
+	hold.ack(0)
+	for i := 0; i < 300 && atomic.LoadInt64(&hold.resolved) != 7; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(atomic.LoadInt64(&hold.resolved), check.Equals, int64(7))
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+}
+
+func (s *syncerSuite) TestHoldDDL(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept"}, nil)
+	c.Assert(err, check.IsNil)
+	hold := newHoldSyncer()
+	syncer.dsyncer = hold
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	dml := func(commitTS int64, tableID int64) *binlogItem {
+		return &binlogItem{binlog: &pb.Binlog{
+			Tp:            pb.BinlogType_Commit,
+			CommitTs:      commitTS,
+			PrewriteValue: getEmptyPrewriteValue(0, tableID),
+		}}
+	}
+	ddl := func(commitTS int64, tp model.ActionType, query string, tableID int64, name string) *binlogItem {
+		return &binlogItem{
+			binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: commitTS, DdlJobId: commitTS, DdlQuery: []byte(query)},
+			job: &model.Job{
+				ID:       commitTS,
+				SchemaID: 1,
+				TableID:  tableID,
+				Type:     tp,
+				State:    model.JobStateSynced,
+				Query:    query,
+				BinlogInfo: &model.HistoryInfo{
+					SchemaVersion: commitTS,
+					TableInfo:     &model.TableInfo{ID: tableID, Name: model.NewCIStr(name)},
+				},
+			},
+		}
+	}
+	received := func() []int64 {
+		hold.mu.Lock()
+		defer hold.mu.Unlock()
+		var received []int64
+		for _, item := range hold.held {
+			received = append(received, item.Binlog.CommitTs)
+		}
+		return received
+	}
+	flush := func(expected int64) {
+		var ts int64
+		for i := 0; i < 300 && ts != expected; i++ {
+			time.Sleep(10 * time.Millisecond)
+			ts, err = syncer.FlushCheckpoint(context.Background())
+			c.Assert(err, check.IsNil)
+		}
+		c.Assert(ts, check.Equals, expected)
+	}
+
+	syncer.Add(&binlogItem{
+		binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: 1, DdlJobId: 1, DdlQuery: []byte("create database test")},
+		job: &model.Job{
+			ID:    1,
+			Type:  model.ActionCreateSchema,
+			State: model.JobStateSynced,
+			Query: "create database test",
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: 1,
+				DBInfo:        &model.DBInfo{ID: 1, Name: model.NewCIStr("test")},
+			},
+		},
+	})
+	syncer.Add(ddl(2, model.ActionCreateTable, "create table test.a(id int)", 2, "a"))
+	syncer.Add(ddl(3, model.ActionCreateTable, "create table test.b(id int)", 3, "b"))
+	waitReceived(c, hold, 3)
+	hold.ack(0)
+	flush(3)
+
+	syncer.HoldDDL()
+	syncer.Add(ddl(4, model.ActionAddColumn, "alter table test.a add column c int", 2, "a"))
+	syncer.Add(dml(5, 3))
+	// the DMLs of test.a depend on the held DDL
+	syncer.Add(dml(6, 2))
+	syncer.Add(dml(7, 3))
+
+	// only the DMLs of test.b are synced
+	waitReceived(c, hold, 2)
+	c.Assert(received(), check.DeepEquals, []int64{5, 7})
+	holding, held := syncer.DDLHoldStatus()
+	c.Assert(holding, check.IsTrue)
+	c.Assert(held, check.DeepEquals, []int64{4, 6})
+	// the checkpoint doesn't advance past the held DDL
+	hold.ack(0)
+	flush(3)
+
+	count, err := syncer.ReleaseDDL()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 2)
+	// the held ones are synced in commit order
+	waitReceived(c, hold, 2)
+	c.Assert(received(), check.DeepEquals, []int64{4, 6})
+	holding, held = syncer.DDLHoldStatus()
+	c.Assert(holding, check.IsFalse)
+	c.Assert(held, check.HasLen, 0)
+	hold.ack(0)
+	flush(7)
+
+	_, err = syncer.ReleaseDDL()
+	c.Assert(err, check.ErrorMatches, "DDL is not on hold")
+
+	// the DDLs are synced as usual after released
+	syncer.Add(ddl(8, model.ActionAddColumn, "alter table test.b add column c int", 3, "b"))
+	waitReceived(c, hold, 1)
+	c.Assert(received(), check.DeepEquals, []int64{8})
+	hold.ack(0)
+	flush(8)
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+}
+
+func (s *syncerSuite) TestRefuseExchangePartition(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept"}, nil)
+	c.Assert(err, check.IsNil)
+	hold := newHoldSyncer()
+	syncer.dsyncer = hold
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	syncer.Add(&binlogItem{
+		binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: 1, DdlJobId: 1, DdlQuery: []byte("create database test")},
+		job: &model.Job{
+			ID:    1,
+			Type:  model.ActionCreateSchema,
+			State: model.JobStateSynced,
+			Query: "create database test",
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: 1,
+				DBInfo:        &model.DBInfo{ID: 1, Name: model.NewCIStr("test")},
+			},
+		},
+	})
+	query := "ALTER TABLE p EXCHANGE PARTITION p0 WITH TABLE other.t"
+	syncer.Add(&binlogItem{
+		binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: 2, DdlJobId: 2, DdlQuery: []byte(query)},
+		job: &model.Job{
+			ID:       2,
+			SchemaID: 1,
+			TableID:  2,
+			// the action of EXCHANGE PARTITION in the later versions of TiDB, it's unknown to this version
+			Type:  model.ActionType(42),
+			State: model.JobStateSynced,
+			Query: query,
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: 2,
+				TableInfo:     &model.TableInfo{ID: 2, Name: model.NewCIStr("p")},
+			},
+		},
+	})
+
+	select {
+	case err = <-errCh:
+	case <-time.After(5 * time.Second):
+		c.Fatal("syncer should quit on EXCHANGE PARTITION")
+	}
+	c.Assert(err, check.ErrorMatches, "EXCHANGE PARTITION can't be replicated safely, the rows exchanged between test.p and other.t aren't in binlog.*add commit ts 2 to `ignore-txn-commit-ts`.*")
+	// only the DDL before it is synced
+	hold.mu.Lock()
+	c.Assert(hold.held, check.HasLen, 1)
+	hold.mu.Unlock()
+}
+
+func (s *syncerSuite) TestExchangePartitionOfIgnoredTables(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept", IgnoreSchemas: "test,other"}, nil)
+	c.Assert(err, check.IsNil)
+
+	job := &model.Job{SchemaName: "test", Query: "ALTER TABLE p EXCHANGE PARTITION p0 WITH TABLE other.t"}
+	c.Assert(syncer.checkExchangePartition(job, 1), check.IsNil)
+
+	// it's refused if either table is replicated
+	job.Query = "ALTER TABLE p EXCHANGE PARTITION p0 WITH TABLE keep.t"
+	c.Assert(syncer.checkExchangePartition(job, 1), check.ErrorMatches, "EXCHANGE PARTITION can't be replicated safely.*")
+
+	job.Query = "ALTER TABLE p ADD COLUMN c INT"
+	c.Assert(syncer.checkExchangePartition(job, 1), check.IsNil)
+}
+
+func (s *syncerSuite) TestRenameTablesAcrossSchemas(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept", IgnoreSchemas: "ignored"}, nil)
+	c.Assert(err, check.IsNil)
+	hold := newHoldSyncer()
+	syncer.dsyncer = hold
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	job := func(commitTS int64, schemaID int64, tableID int64, tp model.ActionType, query string) *binlogItem {
+		return &binlogItem{
+			binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: commitTS, DdlJobId: commitTS, DdlQuery: []byte(query)},
+			job: &model.Job{
+				ID:         commitTS,
+				SchemaID:   schemaID,
+				TableID:    tableID,
+				Type:       tp,
+				State:      model.JobStateSynced,
+				Query:      query,
+				BinlogInfo: &model.HistoryInfo{SchemaVersion: commitTS},
+			},
+		}
+	}
+	for i, name := range []string{"a", "b", "ignored"} {
+		item := job(int64(i+1), int64(i+1), 0, model.ActionCreateSchema, "create database "+name)
+		item.job.BinlogInfo.DBInfo = &model.DBInfo{ID: int64(i + 1), Name: model.NewCIStr(name)}
+		syncer.Add(item)
+	}
+	for i, name := range []TableName{{Schema: "a", Table: "t1"}, {Schema: "a", Table: "t2"}, {Schema: "ignored", Table: "t3"}} {
+		schemaID, tableID := int64(1), int64(i+10)
+		if name.Schema == "ignored" {
+			schemaID = 3
+		}
+		item := job(int64(i+4), schemaID, tableID, model.ActionCreateTable, "create table "+name.Schema+"."+name.Table+"(id int)")
+		item.job.BinlogInfo.TableInfo = &model.TableInfo{ID: tableID, Name: model.NewCIStr(name.Table)}
+		syncer.Add(item)
+	}
+
+	// the unqualified table is renamed to another schema
+	item := job(7, 2, 10, model.ActionRenameTable, "rename table t1 to b.t1")
+	item.job.SchemaName = "a"
+	item.job.BinlogInfo.TableInfo = &model.TableInfo{ID: 10, Name: model.NewCIStr("t1")}
+	syncer.Add(item)
+	// the renames across the filter and the ones of ignored tables are left out
+	item = job(8, 1, 10, actionRenameTables, "rename table b.t1 to a.r1, a.t2 to ignored.t2, ignored.t3 to ignored.t4")
+	item.job.RawArgs = []byte(`[[2,1,3],[1,3,3],[{"O":"r1","L":"r1"},{"O":"t2","L":"t2"},{"O":"t4","L":"t4"}],[10,11,12],[]]`)
+	syncer.Add(item)
+	item = job(9, 1, 12, actionRenameTables, "rename table ignored.t4 to a.t4")
+	item.job.RawArgs = []byte(`[[3],[1],[{"O":"t4","L":"t4"}],[12],[]]`)
+	syncer.Add(item)
+	item = job(10, 1, 12, model.ActionAddColumn, "alter table a.t4 add column c int")
+	item.job.BinlogInfo.TableInfo = &model.TableInfo{ID: 12, Name: model.NewCIStr("t4")}
+	syncer.Add(item)
+
+	waitReceived(c, hold, 7)
+	hold.mu.Lock()
+	var queries []string
+	for _, item := range hold.held[4:] {
+		queries = append(queries, string(item.Binlog.DdlQuery))
+	}
+	c.Assert(hold.held[4].Schema, check.Equals, "b")
+	c.Assert(hold.held[4].Table, check.Equals, "t1")
+	c.Assert(hold.held[5].Schema, check.Equals, "a")
+	c.Assert(hold.held[5].Table, check.Equals, "r1")
+	hold.mu.Unlock()
+	c.Assert(queries, check.DeepEquals, []string{
+		"RENAME TABLE `a`.`t1` TO `b`.`t1`",
+		"RENAME TABLE `b`.`t1` TO `a`.`r1`",
+		"alter table a.t4 add column c int",
+	})
+
+	// the tables are tracked with the new names, including the ones not replicated
+	c.Assert(syncer.schema.tableIDToName[10], check.Equals, TableName{Schema: "a", Table: "r1"})
+	c.Assert(syncer.schema.tableIDToName[11], check.Equals, TableName{Schema: "ignored", Table: "t2"})
+	c.Assert(syncer.schema.tableIDToName[12], check.Equals, TableName{Schema: "a", Table: "t4"})
+
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+}
+
+func (s *syncerSuite) TestRenameAcrossFilterError(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept", IgnoreSchemas: "ignored", RenameAcrossFilter: RenameAcrossFilterError}, nil)
+	c.Assert(err, check.IsNil)
+
+	renames := []tableRename{
+		{From: TableName{Schema: "a", Table: "t1"}, To: TableName{Schema: "b", Table: "t1"}},
+		{From: TableName{Schema: "ignored", Table: "t2"}, To: TableName{Schema: "ignored", Table: "t3"}},
+	}
+	sql, to, err := syncer.renameTablesQuery(renames, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(sql, check.Equals, "RENAME TABLE `a`.`t1` TO `b`.`t1`")
+	c.Assert(*to, check.Equals, TableName{Schema: "b", Table: "t1"})
+
+	renames = append(renames, tableRename{From: TableName{Schema: "a", Table: "t2"}, To: TableName{Schema: "ignored", Table: "t2"}})
+	_, _, err = syncer.renameTablesQuery(renames, 2)
+	c.Assert(err, check.ErrorMatches, "rename table a.t2 to ignored.t2 across the filter at commit ts 2.*`ignore-txn-commit-ts`.*")
+}
+
+func (s *syncerSuite) TestSkipSetVariables(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept"}, nil)
+	c.Assert(err, check.IsNil)
+
+	// skipped by default
+	for _, sql := range []string{"SET time_zone = '+08:00'", "SET GLOBAL tidb_gc_life_time = '1h'", "SET @a = 1", "SET NAMES utf8mb4"} {
+		_, skip := syncer.skipSetVariables(sql)
+		c.Assert(skip, check.IsTrue, check.Commentf("sql: %s", sql))
+	}
+	_, skip := syncer.skipSetVariables("CREATE TABLE t (id INT)")
+	c.Assert(skip, check.IsFalse)
+
+	syncer, err = NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept", ReplicateSetVariables: []string{"TIME_ZONE", "@a"}}, nil)
+	c.Assert(err, check.IsNil)
+	_, skip = syncer.skipSetVariables("SET time_zone = '+08:00', @a = 1")
+	c.Assert(skip, check.IsFalse)
+	// skipped if any variable isn't allowed
+	names, skip := syncer.skipSetVariables("SET @@SESSION.time_zone = '+08:00', sql_mode = ''")
+	c.Assert(skip, check.IsTrue)
+	c.Assert(names, check.DeepEquals, []string{"time_zone", "sql_mode"})
+}
+
+func (s *syncerSuite) TestReplicateSetVariables(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept", ReplicateSetVariables: []string{"time_zone"}}, nil)
+	c.Assert(err, check.IsNil)
+	hold := newHoldSyncer()
+	syncer.dsyncer = hold
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	tableInfo := &model.TableInfo{ID: 2, Name: model.NewCIStr("t")}
+	addDDL := func(version int64, tp model.ActionType, query string) {
+		job := &model.Job{
+			ID:       version,
+			SchemaID: 1,
+			TableID:  2,
+			Type:     tp,
+			State:    model.JobStateSynced,
+			Query:    query,
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: version,
+				TableInfo:     tableInfo,
+			},
+		}
+		if tp == model.ActionCreateSchema {
+			job.BinlogInfo.DBInfo = &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}
+		}
+		syncer.Add(&binlogItem{
+			binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: version, DdlJobId: version, DdlQuery: []byte(query)},
+			job:    job,
+		})
+	}
+	addDDL(1, model.ActionCreateSchema, "CREATE DATABASE test")
+	addDDL(2, model.ActionCreateTable, "CREATE TABLE t (id INT)")
+	addDDL(3, model.ActionModifyTableComment, "SET sql_mode = ''")
+	addDDL(4, model.ActionModifyTableComment, "SET time_zone = '+08:00'")
+	addDDL(5, model.ActionModifyTableComment, "SET @tmp = 1")
+	addDDL(6, model.ActionModifyTableComment, "ALTER TABLE t COMMENT 'set'")
+
+	waitReceived(c, hold, 4)
+	var queries []string
+	hold.mu.Lock()
+	for _, item := range hold.held {
+		queries = append(queries, string(item.Binlog.DdlQuery))
+	}
+	hold.mu.Unlock()
+	c.Assert(queries, check.DeepEquals, []string{"CREATE DATABASE test", "CREATE TABLE t (id INT)", "SET time_zone = '+08:00'", "ALTER TABLE t COMMENT 'set'"})
+
+	hold.ack(0)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+}
+
+func (s *syncerSuite) TestTemporaryTables(c *check.C) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept"}, nil)
+	c.Assert(err, check.IsNil)
+	hold := newHoldSyncer()
+	syncer.dsyncer = hold
+
+	localDDL := skippedTemporaryTableCounter.WithLabelValues(localTemporaryTable, "ddl")
+	globalDML := skippedTemporaryTableCounter.WithLabelValues(globalTemporaryTable, "dml")
+	localDDLStart, globalDMLStart := counterValue(c, localDDL), counterValue(c, globalDML)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+
+	addDDL := func(version int64, tp model.ActionType, tableID int64, name string, query string) {
+		job := &model.Job{
+			ID:       version,
+			SchemaID: 1,
+			TableID:  tableID,
+			Type:     tp,
+			State:    model.JobStateSynced,
+			Query:    query,
+			BinlogInfo: &model.HistoryInfo{
+				SchemaVersion: version,
+				TableInfo:     &model.TableInfo{ID: tableID, Name: model.NewCIStr(name)},
+			},
+		}
+		if tp == model.ActionCreateSchema {
+			job.BinlogInfo.DBInfo = &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}
+		}
+		syncer.Add(&binlogItem{
+			binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: version, DdlJobId: version, DdlQuery: []byte(query)},
+			job:    job,
+		})
+	}
+	addDML := func(commitTS int64, tableID int64) {
+		syncer.Add(&binlogItem{
+			binlog: &pb.Binlog{Tp: pb.BinlogType_Commit, CommitTs: commitTS, PrewriteValue: getEmptyPrewriteValue(0, tableID)},
+		})
+	}
+	addDDL(1, model.ActionCreateSchema, 0, "", "CREATE DATABASE test")
+	addDDL(2, model.ActionCreateTable, 2, "t", "CREATE TABLE t (id INT)")
+	addDDL(3, model.ActionCreateTable, 3, "tmp", "CREATE TEMPORARY TABLE tmp (id INT)")
+	addDDL(4, model.ActionCreateTable, 4, "gtmp", "CREATE GLOBAL TEMPORARY TABLE gtmp (id INT) ON COMMIT DELETE ROWS")
+	addDML(5, 4)
+	addDML(6, 2)
+	addDDL(7, model.ActionDropTable, 4, "gtmp", "DROP TABLE gtmp")
+
+	waitReceived(c, hold, 5)
+	var synced []string
+	hold.mu.Lock()
+	for _, item := range hold.held {
+		if item.PrewriteValue != nil {
+			c.Assert(item.PrewriteValue.Mutations[0].TableId, check.Equals, int64(2))
+			synced = append(synced, "dml")
+		} else {
+			synced = append(synced, string(item.Binlog.DdlQuery))
+		}
+	}
+	hold.mu.Unlock()
+	c.Assert(synced, check.DeepEquals, []string{
+		"CREATE DATABASE test",
+		"CREATE TABLE t (id INT)",
+		"CREATE GLOBAL TEMPORARY TABLE gtmp (id INT) ON COMMIT DELETE ROWS",
+		"dml",
+		"DROP TABLE gtmp",
+	})
+	c.Assert(counterValue(c, localDDL)-localDDLStart, check.Equals, 1.0)
+	c.Assert(counterValue(c, globalDML)-globalDMLStart, check.Equals, 1.0)
+	_, ok := syncer.schema.TemporaryTableKind(4)
+	c.Assert(ok, check.IsFalse)
+
+	hold.ack(0)
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+}
+
+func (s *syncerSuite) TestSkipTemporaryTable(c *check.C) {
+	cases := []struct {
+		cfg    SyncerConfig
+		kind   string
+		expect bool
+	}{
+		{SyncerConfig{DestDBType: "tidb"}, localTemporaryTable, true},
+		{SyncerConfig{DestDBType: "tidb", GlobalTemporaryTable: GlobalTemporaryTableReplicate}, localTemporaryTable, true},
+		{SyncerConfig{DestDBType: "tidb"}, globalTemporaryTable, false},
+		{SyncerConfig{DestDBType: "kafka"}, globalTemporaryTable, false},
+		{SyncerConfig{DestDBType: "tidb", GlobalTemporaryTable: GlobalTemporaryTableSkip}, globalTemporaryTable, true},
+		// mysql doesn't support the global temporary tables
+		{SyncerConfig{DestDBType: "mysql"}, globalTemporaryTable, true},
+		{SyncerConfig{DestDBType: "mysql", GlobalTemporaryTable: GlobalTemporaryTableReplicate}, globalTemporaryTable, false},
+	}
+	for _, cs := range cases {
+		cfg := cs.cfg
+		syncer := &Syncer{cfg: &cfg}
+		c.Assert(syncer.skipTemporaryTable(cs.kind), check.Equals, cs.expect, check.Commentf("config: %+v, kind: %s", cs.cfg, cs.kind))
+	}
+}
+
+func counterValue(c *check.C, counter prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Assert(counter.Write(&m), check.IsNil)
+	return m.GetCounter().GetValue()
+}
+
+// delaySyncer takes delay to add every item
+type delaySyncer struct {
+	delay     time.Duration
+	successes chan *dsync.Item
+}
+
+var _ dsync.Syncer = &delaySyncer{}
+
+func (s *delaySyncer) Sync(item *dsync.Item) error {
+	time.Sleep(s.delay)
+	s.successes <- item
+	return nil
+}
+
+func (s *delaySyncer) Successes() <-chan *dsync.Item {
+	return s.successes
+}
+
+func (s *delaySyncer) Close() error {
+	close(s.successes)
+	return nil
+}
+
+func (s *delaySyncer) Error() <-chan error {
+	return make(chan error)
+}
+
+// runWithDelays syncs 3 txns, upstreamDelay before adding every one of them and downstreamDelay to sync it,
+// returns the seconds spent on waiting the upstream and downstream.
+func (s *syncerSuite) runWithDelays(c *check.C, upstreamDelay time.Duration, downstreamDelay time.Duration) (float64, float64) {
+	cp, err := checkpoint.NewFile(&checkpoint.Config{CheckPointFile: c.MkDir() + "/checkpoint"})
+	c.Assert(err, check.IsNil)
+	syncer, err := NewSyncer(cp, &SyncerConfig{DestDBType: "_intercept"}, nil)
+	c.Assert(err, check.IsNil)
+	syncer.schema.tableIDToName[2] = TableName{Schema: "test", Table: "test"}
+	syncer.dsyncer = &delaySyncer{delay: downstreamDelay, successes: make(chan *dsync.Item, 8)}
+
+	upstream := waitDurationCounter.WithLabelValues(waitUpstream)
+	downstream := waitDurationCounter.WithLabelValues(waitDownstream)
+	upstreamStart, downstreamStart := counterValue(c, upstream), counterValue(c, downstream)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- syncer.Start()
+	}()
+	for commitTS := int64(1); commitTS <= 3; commitTS++ {
+		time.Sleep(upstreamDelay)
+		syncer.Add(&binlogItem{
+			binlog: &pb.Binlog{
+				Tp:            pb.BinlogType_Commit,
+				CommitTs:      commitTS,
+				PrewriteValue: getEmptyPrewriteValue(0, 2),
+			},
+		})
+	}
+	for i := 0; i < 100 && cp.TS() != 3; i++ {
+		_, err = syncer.FlushCheckpoint(context.Background())
+		c.Assert(err, check.IsNil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(cp.TS(), check.Equals, int64(3))
+	c.Assert(syncer.Close(), check.IsNil)
+	c.Assert(<-errCh, check.IsNil)
+
+	return counterValue(c, upstream) - upstreamStart, counterValue(c, downstream) - downstreamStart
+}
+
+func (s *syncerSuite) TestWaitDurationMetrics(c *check.C) {
+	delay := 100 * time.Millisecond
+
+	// slow upstream
+	upstream, downstream := s.runWithDelays(c, delay, 0)
+	c.Assert(upstream, check.GreaterEqual, (3*delay).Seconds()*0.9)
+	c.Assert(downstream, check.Less, delay.Seconds())
+
+	// slow downstream, the txns are queued to be added
+	upstream, downstream = s.runWithDelays(c, 0, delay)
+	c.Assert(downstream, check.GreaterEqual, (3*delay).Seconds()*0.9)
+	c.Assert(upstream, check.Less, delay.Seconds())
+}
+
+func (s *syncerSuite) TestSkipTxnAtRuntime(c *check.C) {
+	syncer := &Syncer{skipTxnCommitTS: []int64{3}}
+	c.Assert(syncer.isSkipTxn(5), check.IsFalse)
+	c.Assert(syncer.SkipTxn(5), check.DeepEquals, []int64{3, 5})
+	c.Assert(syncer.SkipTxn(3), check.DeepEquals, []int64{3, 5})
+	c.Assert(syncer.isSkipTxn(5), check.IsTrue)
+	c.Assert(syncer.GetSkipTxns(), check.DeepEquals, []int64{3, 5})
+}
+
+func (s *syncerSuite) TestNewDownstreamBreaker(c *check.C) {
+	cfg := &SyncerConfig{DestDBType: "mysql", To: &dsync.DBConfig{}}
+	c.Assert(newDownstreamBreaker(cfg), check.IsNil)
+
+	cfg.To.CircuitBreakerThreshold = 3
+	cfg.To.CircuitBreakerCoolDown = 10
+	breaker := newDownstreamBreaker(cfg)
+	c.Assert(breaker, check.NotNil)
+	c.Assert((&Syncer{breaker: breaker}).GetBreakerState(), check.Equals, "closed")
+
+	// only the mysql and tidb downstream support the circuit breaker
+	cfg.DestDBType = "file"
+	c.Assert(newDownstreamBreaker(cfg), check.IsNil)
+	c.Assert((&Syncer{}).GetBreakerState(), check.Equals, "")
+}
+
 func (s *syncerSuite) TestIsIgnoreTxnCommitTS(c *check.C) {
 	c.Assert(isIgnoreTxnCommitTS(nil, 1), check.IsFalse)
 	c.Assert(isIgnoreTxnCommitTS([]int64{1, 3}, 1), check.IsTrue)
@@ -180,6 +1326,68 @@ func (s *syncerSuite) TestIsIgnoreTxnCommitTS(c *check.C) {
 	c.Assert(isIgnoreTxnCommitTS([]int64{1, 3}, 3), check.IsTrue)
 }
 
+func (s *syncerSuite) TestIsLoopbackTxn(c *check.C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, check.IsNil)
+
+	longType := types.NewFieldType(mysql.TypeLonglong)
+	longType.Flag = mysql.NotNullFlag
+	var markTableID int64 = 1
+	markTable := &model.TableInfo{
+		ID:   markTableID,
+		Name: model.NewCIStr(loopbacksync.MarkTableName),
+		Columns: []*model.ColumnInfo{
+			{ID: 1, Name: model.NewCIStr(loopbacksync.ChannelID), FieldType: *longType, State: model.StatePublic},
+			{ID: 2, Name: model.NewCIStr(loopbacksync.ID), FieldType: *longType, State: model.StatePublic},
+			{ID: 3, Name: model.NewCIStr(loopbacksync.Val), FieldType: *longType, State: model.StatePublic},
+		},
+	}
+	schema.tables[markTableID] = markTable
+	schema.tableIDToName[markTableID] = TableName{Schema: loopbacksync.MarkTableSchema, Table: loopbacksync.MarkTableName}
+
+	var userTableID int64 = 2
+	schema.tableIDToName[userTableID] = TableName{Schema: "test", Table: "test"}
+
+	genMarkRow := func(channelID int64) []byte {
+		sc := &stmtctx.StatementContext{TimeZone: time.Local}
+		handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(1))
+		c.Assert(err, check.IsNil)
+		row, err := tablecodec.EncodeRow(sc, types.MakeDatums(channelID, int64(0), int64(1)), []int64{1, 2, 3}, nil, nil)
+		c.Assert(err, check.IsNil)
+		return append(handle, row...)
+	}
+
+	info := loopbacksync.NewLoopBackSyncInfo(7, true)
+	binlog := &pb.Binlog{StartTs: 1, CommitTs: 2}
+
+	// txn doesn't touch the mark table, it's written by user
+	pv := &pb.PrewriteValue{Mutations: []pb.TableMutation{{TableId: userTableID}}}
+	isLoopback, err := isLoopbackTxn(binlog, pv, schema, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(isLoopback, check.IsFalse)
+
+	// txn is written by the drainer of the same channel, it should be filtered
+	pv.Mutations = append(pv.Mutations, pb.TableMutation{
+		TableId:      markTableID,
+		InsertedRows: [][]byte{genMarkRow(7)},
+		Sequence:     []pb.MutationType{pb.MutationType_Insert},
+	})
+	isLoopback, err = isLoopbackTxn(binlog, pv, schema, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(isLoopback, check.IsTrue)
+
+	// txn is written by the drainer of another channel
+	pv.Mutations[1].InsertedRows = [][]byte{genMarkRow(8)}
+	isLoopback, err = isLoopbackTxn(binlog, pv, schema, info)
+	c.Assert(err, check.IsNil)
+	c.Assert(isLoopback, check.IsFalse)
+
+	// unknown table
+	pv.Mutations = append(pv.Mutations, pb.TableMutation{TableId: 3})
+	_, err = isLoopbackTxn(binlog, pv, schema, info)
+	c.Assert(err, check.NotNil)
+}
+
 func getEmptyPrewriteValue(schemaVersion int64, tableID int64) (data []byte) {
 	pv := &pb.PrewriteValue{
 		SchemaVersion: schemaVersion,
@@ -199,3 +1407,47 @@ func getEmptyPrewriteValue(schemaVersion int64, tableID int64) (data []byte) {
 	}
 	return
 }
+
+func (s *syncerSuite) TestMaxLag(c *check.C) {
+	origInterval := lagCheckInterval
+	lagCheckInterval = 10 * time.Millisecond
+	defer func() {
+		lagCheckInterval = origInterval
+	}()
+
+	for _, action := range []string{MaxLagAlert, MaxLagHalt} {
+		maxLagExceededGauge.Set(0)
+		// the commit ts of the txns are far behind now, and the downstream is stuck after the first one is applied
+		cfg := &SyncerConfig{DestDBType: "_intercept", MaxInflightTxns: 1, MaxLag: 1, MaxLagAction: action}
+		syncer, hold, _, errCh := s.startHoldSyncerWithConfig(c, cfg)
+		waitReceived(c, hold, 1)
+		hold.ack(0)
+		waitReceived(c, hold, 1)
+
+		if action == MaxLagHalt {
+			select {
+			case err := <-errCh:
+				c.Assert(err, check.ErrorMatches, "the lag .* exceeds max-lag 1s for 0s, the applied ts is 1, halt the syncer")
+			case <-time.After(5 * time.Second):
+				c.Fatal("the syncer is not halted")
+			}
+			c.Assert(maxLagExceeded(c), check.Equals, 1.0)
+			continue
+		}
+
+		for i := 0; i < 100 && maxLagExceeded(c) == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.Assert(maxLagExceeded(c), check.Equals, 1.0)
+		// the syncer keeps running
+		select {
+		case err := <-errCh:
+			c.Fatalf("the syncer quits with %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		hold.ack(0)
+		waitReceived(c, hold, 1)
+		c.Assert(syncer.Close(), check.IsNil)
+		c.Assert(<-errCh, check.IsNil)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/pkg/util"
+	pbbinlog "github.com/pingcap/tidb-binlog/proto/binlog"
 	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
 	"github.com/pingcap/tidb/tablecodec"
 	"github.com/pingcap/tidb/types"
@@ -32,6 +33,30 @@ import (
 	"go.uber.org/zap"
 )
 
+// The types of the markers written before and after the records of a txn to kafka,
+// they're not defined by the slave binlog proto, only the consumers expecting the markers should enable them.
+// The values are the same as the types of the markers in the file binlog.
+const (
+	SlaveBinlogBegin  = obinlog.BinlogType(pbbinlog.BinlogType_BEGIN)
+	SlaveBinlogCommit = obinlog.BinlogType(pbbinlog.BinlogType_COMMIT)
+)
+
+// SlaveBinlogResolved is the type of the resolved ts record, which is not defined by the slave binlog proto either,
+// all the changes committed up to the CommitTs of it have been written to the partition before it.
+const SlaveBinlogResolved obinlog.BinlogType = 4
+
+// SlaveTxnMarkers returns the markers written before and after the records of the txn committed at commitTS
+func SlaveTxnMarkers(commitTS int64) (begin *obinlog.Binlog, commit *obinlog.Binlog) {
+	begin = &obinlog.Binlog{Type: SlaveBinlogBegin, CommitTs: commitTS}
+	commit = &obinlog.Binlog{Type: SlaveBinlogCommit, CommitTs: commitTS}
+	return
+}
+
+// SlaveResolvedTS returns the resolved ts record of ts
+func SlaveResolvedTS(ts int64) *obinlog.Binlog {
+	return &obinlog.Binlog{Type: SlaveBinlogResolved, CommitTs: ts}
+}
+
 // TiBinlogToSlaveBinlog translates the format to slave binlog
 func TiBinlogToSlaveBinlog(
 	infoGetter TableInfoGetter,
@@ -59,7 +84,7 @@ func TiBinlogToSlaveBinlog(
 	}
 
 	for _, mut := range pv.GetMutations() {
-		info, ok := infoGetter.TableByID(mut.GetTableId())
+		info, ok := infoGetter.TableByIDAndVersion(mut.GetTableId(), pv.GetSchemaVersion())
 		if !ok {
 			return nil, errors.Errorf("TableByID empty table id: %d", mut.GetTableId())
 		}
@@ -104,7 +129,7 @@ func genTable(schema string, tableInfo *model.TableInfo) (table *obinlog.Table)
 }
 
 func insertRowToRow(tableInfo *model.TableInfo, raw []byte) (row *obinlog.Row, err error) {
-	_, columnValues, err := insertRowToDatums(tableInfo, raw)
+	_, columnValues, err := insertRowToDatums(tableInfo, raw, time.Local)
 	columns := tableInfo.Columns
 
 	row = new(obinlog.Row)
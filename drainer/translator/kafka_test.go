@@ -45,6 +45,16 @@ func (t *testKafkaSuite) TestDDL(c *check.C) {
 	})
 }
 
+func (t *testKafkaSuite) TestIndexDDL(c *check.C) {
+	t.SetDDL()
+	for _, sql := range indexDDLs {
+		t.TiBinlog.DdlQuery = []byte(sql)
+		slaveBinog, err := TiBinlogToSlaveBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+		c.Assert(err, check.IsNil)
+		c.Assert(string(slaveBinog.DdlData.DdlQuery), check.Equals, sql)
+	}
+}
+
 func (t *testKafkaSuite) testDML(c *check.C, tp obinlog.MutationType) {
 	slaveBinog, err := TiBinlogToSlaveBinlog(t, t.Schema, t.Table, t.TiBinlog, t.PV)
 	c.Assert(err, check.IsNil)
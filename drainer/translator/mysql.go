@@ -30,10 +30,10 @@ import (
 
 const implicitColID = -1
 
-func genMysqlInsert(schema string, table *model.TableInfo, row []byte) (names []string, args []interface{}, err error) {
+func genMysqlInsert(schema string, table *model.TableInfo, row []byte, loc *time.Location) (names []string, args []interface{}, err error) {
 	columns := writableColumns(table)
 
-	_, columnValues, err := insertRowToDatums(table, row)
+	_, columnValues, err := insertRowToDatums(table, row, loc)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
@@ -41,10 +41,14 @@ func genMysqlInsert(schema string, table *model.TableInfo, row []byte) (names []
 	for _, col := range columns {
 		val, ok := columnValues[col.ID]
 		if !ok {
+			// the downstream would generate a different value if we don't specify it
+			if mysql.HasAutoIncrementFlag(col.Flag) {
+				return nil, nil, errors.Errorf("value of auto increment column %s is missing", col.Name)
+			}
 			val = getDefaultOrZeroValue(col)
 		}
 
-		value, err := formatData(val, col.FieldType)
+		value, err := formatMysqlData(val, col.FieldType)
 		if err != nil {
 			return nil, nil, errors.Trace(err)
 		}
@@ -56,13 +60,13 @@ func genMysqlInsert(schema string, table *model.TableInfo, row []byte) (names []
 	return names, args, nil
 }
 
-func genMysqlUpdate(schema string, table *model.TableInfo, row []byte, isTblDroppingCol bool) (names []string, values []interface{}, oldValues []interface{}, err error) {
+func genMysqlUpdate(schema string, table *model.TableInfo, row []byte, isTblDroppingCol bool, loc *time.Location) (names []string, values []interface{}, oldValues []interface{}, err error) {
 	columns := writableColumns(table)
 	updtDecoder := newUpdateDecoder(table, isTblDroppingCol)
 
 	var updateColumns []*model.ColumnInfo
 
-	oldColumnValues, newColumnValues, err := updtDecoder.decode(row, time.Local)
+	oldColumnValues, newColumnValues, err := updtDecoder.decode(row, loc)
 	if err != nil {
 		return nil, nil, nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
@@ -82,11 +86,11 @@ func genMysqlUpdate(schema string, table *model.TableInfo, row []byte, isTblDrop
 	return
 }
 
-func genMysqlDelete(schema string, table *model.TableInfo, row []byte) (names []string, values []interface{}, err error) {
+func genMysqlDelete(schema string, table *model.TableInfo, row []byte, loc *time.Location) (names []string, values []interface{}, err error) {
 	columns := table.Columns
 	colsTypeMap := util.ToColumnTypeMap(columns)
 
-	columnValues, err := tablecodec.DecodeRow(row, colsTypeMap, time.Local)
+	columnValues, err := tablecodec.DecodeRow(row, colsTypeMap, loc)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
@@ -101,21 +105,54 @@ func genMysqlDelete(schema string, table *model.TableInfo, row []byte) (names []
 	return
 }
 
-// TiBinlogToTxn translate the format to loader.Txn
-func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBinlog *tipb.Binlog, pv *tipb.PrewriteValue) (txn *loader.Txn, err error) {
+// UndecodableRow is the row of a mutation failing to be decoded, e.g. it's corrupt
+type UndecodableRow struct {
+	Schema string
+	Table  string
+	Type   tipb.MutationType
+	Row    []byte
+	Err    error
+}
+
+// QuarantineFunc is called with the row failing to be decoded, the row is skipped and the rest of the txn
+// is translated if it returns nil, otherwise the translation fails with the error returned.
+type QuarantineFunc func(row *UndecodableRow) error
+
+// quarantineRow skips the undecodable row by quarantine, it returns the error of decoding if quarantine is nil
+func quarantineRow(quarantine QuarantineFunc, row *UndecodableRow) error {
+	if quarantine == nil {
+		return row.Err
+	}
+	return errors.Annotate(quarantine(row), "quarantine undecodable row failed")
+}
+
+// TiBinlogToTxn translate the format to loader.Txn,
+// the values of TIMESTAMP columns are converted from UTC to loc, which should be the session time zone of downstream.
+func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBinlog *tipb.Binlog, pv *tipb.PrewriteValue, loc *time.Location) (txn *loader.Txn, err error) {
+	return TiBinlogToTxnWithQuarantine(infoGetter, schema, table, tiBinlog, pv, loc, nil, nil)
+}
+
+// LocationFunc returns the time zone the values of TIMESTAMP columns of the table are converted to,
+// which should be the session time zone of downstream applying the DMLs of the table, nil means the default one.
+type LocationFunc func(schema string, table string) *time.Location
+
+// TiBinlogToTxnWithQuarantine is TiBinlogToTxn skipping the rows failing to be decoded by quarantine,
+// it fails on them like TiBinlogToTxn if quarantine is nil. The values of TIMESTAMP columns of the tables are converted to
+// the time zones returned by tableLoc instead of loc if it's not nil.
+func TiBinlogToTxnWithQuarantine(infoGetter TableInfoGetter, schema string, table string, tiBinlog *tipb.Binlog, pv *tipb.PrewriteValue, loc *time.Location, tableLoc LocationFunc, quarantine QuarantineFunc) (txn *loader.Txn, err error) {
 	txn = new(loader.Txn)
 
 	if tiBinlog.DdlJobId > 0 {
 		txn.DDL = &loader.DDL{
 			Database: schema,
 			Table:    table,
-			SQL:      string(tiBinlog.GetDdlQuery()),
+			SQL:      util.CommentTTL(util.CommentAutoRandom(string(tiBinlog.GetDdlQuery()))),
 		}
 	} else {
 		for _, mut := range pv.GetMutations() {
 			var info *model.TableInfo
 			var ok bool
-			info, ok = infoGetter.TableByID(mut.GetTableId())
+			info, ok = infoGetter.TableByIDAndVersion(mut.GetTableId(), pv.GetSchemaVersion())
 			if !ok {
 				return nil, errors.Errorf("TableByID empty table id: %d", mut.GetTableId())
 			}
@@ -127,6 +164,13 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 				return nil, errors.Errorf("SchemaAndTableName empty table id: %d", mut.GetTableId())
 			}
 
+			mutLoc := loc
+			if tableLoc != nil {
+				if l := tableLoc(schema, table); l != nil {
+					mutLoc = l
+				}
+			}
+
 			iter := newSequenceIterator(&mut)
 			for {
 				mutType, row, err := iter.next()
@@ -139,9 +183,13 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 
 				switch mutType {
 				case tipb.MutationType_Insert:
-					names, args, err := genMysqlInsert(schema, info, row)
+					names, args, err := genMysqlInsert(schema, info, row, mutLoc)
 					if err != nil {
-						return nil, errors.Annotate(err, "gen insert fail")
+						err = quarantineRow(quarantine, &UndecodableRow{Schema: schema, Table: table, Type: mutType, Row: row, Err: err})
+						if err != nil {
+							return nil, errors.Annotate(err, "gen insert fail")
+						}
+						continue
 					}
 
 					dml := &loader.DML{
@@ -155,9 +203,13 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 						dml.Values[name] = args[i]
 					}
 				case tipb.MutationType_Update:
-					names, args, oldArgs, err := genMysqlUpdate(schema, info, row, isTblDroppingCol)
+					names, args, oldArgs, err := genMysqlUpdate(schema, info, row, isTblDroppingCol, mutLoc)
 					if err != nil {
-						return nil, errors.Annotate(err, "gen update fail")
+						err = quarantineRow(quarantine, &UndecodableRow{Schema: schema, Table: table, Type: mutType, Row: row, Err: err})
+						if err != nil {
+							return nil, errors.Annotate(err, "gen update fail")
+						}
+						continue
 					}
 
 					dml := &loader.DML{
@@ -174,9 +226,13 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 					}
 
 				case tipb.MutationType_DeleteRow:
-					names, args, err := genMysqlDelete(schema, info, row)
+					names, args, err := genMysqlDelete(schema, info, row, mutLoc)
 					if err != nil {
-						return nil, errors.Annotate(err, "gen delete fail")
+						err = quarantineRow(quarantine, &UndecodableRow{Schema: schema, Table: table, Type: mutType, Row: row, Err: err})
+						if err != nil {
+							return nil, errors.Annotate(err, "gen delete fail")
+						}
+						continue
 					}
 
 					dml := &loader.DML{
@@ -233,7 +289,7 @@ func generateColumnAndValue(columns []*model.ColumnInfo, columnValues map[int64]
 		val, ok := columnValues[col.ID]
 		if ok {
 			newColumn = append(newColumn, col)
-			value, err := formatData(val, col.FieldType)
+			value, err := formatMysqlData(val, col.FieldType)
 			if err != nil {
 				return nil, nil, errors.Trace(err)
 			}
@@ -245,6 +301,24 @@ func generateColumnAndValue(columns []*model.ColumnInfo, columnValues map[int64]
 	return newColumn, newColumnsValues, nil
 }
 
+// formatMysqlData formats the data to write to mysql, the values of ENUM and SET are
+// written by names instead of indexes, so they're right even if the members are
+// defined in different order in downstream.
+func formatMysqlData(data types.Datum, ft types.FieldType) (types.Datum, error) {
+	switch data.Kind() {
+	case types.KindMysqlEnum:
+		return types.NewStringDatum(data.GetMysqlEnum().Name), nil
+	case types.KindMysqlSet:
+		return types.NewStringDatum(data.GetMysqlSet().Name), nil
+	}
+
+	if ft.Tp == mysql.TypeEnum || ft.Tp == mysql.TypeSet {
+		// the default value is the name already
+		return data, nil
+	}
+	return formatData(data, ft)
+}
+
 func formatData(data types.Datum, ft types.FieldType) (types.Datum, error) {
 	if data.GetValue() == nil {
 		return data, nil
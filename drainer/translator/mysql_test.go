@@ -15,12 +15,18 @@ package translator
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
 	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	tipb "github.com/pingcap/tipb/go-binlog"
 )
 
 type testMysqlSuite struct {
@@ -37,7 +43,7 @@ func (t *testMysqlSuite) TestGenColumnList(c *check.C) {
 func (t *testMysqlSuite) TestDDL(c *check.C) {
 	t.SetDDL()
 
-	txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, nil)
+	txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, nil, time.Local)
 	c.Assert(err, check.IsNil)
 
 	c.Assert(txn, check.DeepEquals, &loader.Txn{
@@ -49,8 +55,122 @@ func (t *testMysqlSuite) TestDDL(c *check.C) {
 	})
 }
 
+func (t *testMysqlSuite) TestAutoRandomDDL(c *check.C) {
+	t.SetDDL()
+	t.TiBinlog.DdlQuery = []byte("create table test(id bigint primary key auto_random(5), a int)")
+
+	txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, nil, time.Local)
+	c.Assert(err, check.IsNil)
+	c.Assert(txn.DDL.SQL, check.Equals, "create table test(id bigint primary key /*T![auto_rand] auto_random(5) */, a int)")
+}
+
+func (t *testMysqlSuite) TestTTLDDL(c *check.C) {
+	t.SetDDL()
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"create table test(id int primary key, created_at datetime) TTL = `created_at` + INTERVAL 3 MONTH TTL_JOB_INTERVAL = '24h'",
+			"create table test(id int primary key, created_at datetime) /*T![ttl] TTL = `created_at` + INTERVAL 3 MONTH */ /*T![ttl] TTL_JOB_INTERVAL = '24h' */"},
+		{"alter table test ttl_enable = 'ON'", "alter table test /*T![ttl] ttl_enable = 'ON' */"},
+		{"alter table test remove ttl", "alter table test /*T![ttl] remove ttl */"},
+	}
+	for _, cs := range cases {
+		t.TiBinlog.DdlQuery = []byte(cs.sql)
+		txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, nil, time.Local)
+		c.Assert(err, check.IsNil)
+		c.Assert(txn.DDL.SQL, check.Equals, cs.expected)
+	}
+}
+
+func (t *testMysqlSuite) TestCommentDDL(c *check.C) {
+	t.SetDDL()
+	sqls := []string{
+		"create table test(id bigint primary key comment 'the id; not auto_random(5)', a int comment \"a's \\\" comment\") comment = 'table comment'",
+		"alter table test modify column a bigint comment 'new /* comment */ of a'",
+		"alter table test change column a b int comment 'renamed'",
+		"alter table test comment = 'new table comment'",
+	}
+	for _, sql := range sqls {
+		t.TiBinlog.DdlQuery = []byte(sql)
+		txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, nil, time.Local)
+		c.Assert(err, check.IsNil)
+		c.Assert(txn.DDL.SQL, check.Equals, sql)
+	}
+}
+
+// the index DDLs are replicated as they are, so the indexes and the visibility of them in downstream match upstream
+var indexDDLs = []string{
+	"create table test(id int primary key, a int, b int, index idx_a(a) invisible, unique key uk_b(b) visible)",
+	"alter table test add index idx_b(b) invisible",
+	"alter table test add unique index uk_a(a) comment 'unique a' invisible",
+	"create index idx_ab on test(a, b) invisible",
+	"alter table test alter index idx_a visible",
+	"alter table test alter index idx_b invisible",
+	"alter table test rename index idx_b to idx_b2",
+	"alter table test drop index idx_b2",
+	"drop index idx_ab on test",
+}
+
+func (t *testMysqlSuite) TestIndexDDL(c *check.C) {
+	t.SetDDL()
+	for _, sql := range indexDDLs {
+		t.TiBinlog.DdlQuery = []byte(sql)
+		txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, nil, time.Local)
+		c.Assert(err, check.IsNil)
+		c.Assert(txn.DDL.SQL, check.Equals, sql)
+	}
+}
+
+func (t *testMysqlSuite) TestQuarantineUndecodableRow(c *check.C) {
+	t.SetInsert(c)
+	mut := &t.PV.Mutations[0]
+	corrupt := []byte("corrupt row")
+	mut.InsertedRows = append([][]byte{corrupt}, mut.InsertedRows...)
+	mut.Sequence = append([]tipb.MutationType{tipb.MutationType_Insert}, mut.Sequence...)
+
+	// the txn fails without quarantine
+	_, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, t.PV, time.Local)
+	c.Assert(err, check.ErrorMatches, "gen insert fail.*")
+
+	var quarantined []*UndecodableRow
+	txn, err := TiBinlogToTxnWithQuarantine(t, t.Schema, t.Table, t.TiBinlog, t.PV, time.Local, nil, func(row *UndecodableRow) error {
+		quarantined = append(quarantined, row)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	// the rest of the txn is kept
+	c.Assert(txn.DMLs, check.HasLen, 1)
+	c.Assert(txn.DMLs[0].Tp, check.Equals, loader.InsertDMLType)
+	c.Assert(quarantined, check.HasLen, 1)
+	c.Assert(quarantined[0].Schema, check.Equals, "test")
+	c.Assert(quarantined[0].Table, check.Equals, "account")
+	c.Assert(quarantined[0].Type, check.Equals, tipb.MutationType_Insert)
+	c.Assert(quarantined[0].Row, check.DeepEquals, corrupt)
+	c.Assert(quarantined[0].Err, check.NotNil)
+
+	// the txn fails if the row can't be quarantined
+	_, err = TiBinlogToTxnWithQuarantine(t, t.Schema, t.Table, t.TiBinlog, t.PV, time.Local, nil, func(row *UndecodableRow) error {
+		return errors.New("dead letter is full")
+	})
+	c.Assert(err, check.ErrorMatches, "gen insert fail: quarantine undecodable row failed: dead letter is full")
+}
+
+func (t *testMysqlSuite) TestTableLocation(c *check.C) {
+	t.SetInsert(c)
+
+	var tables []string
+	_, err := TiBinlogToTxnWithQuarantine(t, t.Schema, t.Table, t.TiBinlog, t.PV, time.Local, func(schema string, table string) *time.Location {
+		tables = append(tables, schema+"."+table)
+		return time.UTC
+	}, nil)
+	c.Assert(err, check.IsNil)
+	// the time zone is looked up once for every mutation of the tables
+	c.Assert(tables, check.DeepEquals, []string{"test.account"})
+}
+
 func (t *testMysqlSuite) testDML(c *check.C, tp loader.DMLType) {
-	txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, t.PV)
+	txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, t.PV, time.Local)
 	c.Assert(err, check.IsNil)
 
 	c.Assert(txn.DMLs, check.HasLen, 1)
@@ -78,6 +198,20 @@ func (t *testMysqlSuite) TestInsert(c *check.C) {
 	t.testDML(c, loader.InsertDMLType)
 }
 
+func (t *testMysqlSuite) TestInsertWithSequenceDefault(c *check.C) {
+	t.SetInsert(c)
+
+	// the binlog carries the value resolved from the sequence,
+	// it should be replicated as literal value instead of the default expression
+	info, _ := t.TableByID(t.PV.Mutations[0].TableId)
+	for _, col := range info.Columns {
+		if col.Tp == mysql.TypeLong {
+			c.Assert(col.SetDefaultValue("nextval(`test`.`seq`)"), check.IsNil)
+		}
+	}
+	t.testDML(c, loader.InsertDMLType)
+}
+
 func (t *testMysqlSuite) TestUpdate(c *check.C) {
 	t.SetUpdate(c)
 	t.testDML(c, loader.UpdateDMLType)
@@ -104,10 +238,6 @@ func checkMysqlColumn(c *check.C, col *model.ColumnInfo, myValue interface{}, da
 	tiStr, err := datum.ToString()
 	c.Assert(err, check.IsNil)
 
-	if col.Tp == mysql.TypeEnum {
-		tiStr = fmt.Sprintf("%d", datum.GetInt64())
-	}
-
 	// tidb encode string type datums as bytes
 	// so we get bytes type datums for txn
 	if slice, ok := myValue.([]byte); ok {
@@ -117,3 +247,186 @@ func checkMysqlColumn(c *check.C, col *model.ColumnInfo, myValue interface{}, da
 	myStr := fmt.Sprintf("%v", myValue)
 	c.Assert(myStr, check.Equals, tiStr)
 }
+
+func (t *testMysqlSuite) TestEnumAndSetByName(c *check.C) {
+	table := testGenTable("normal")
+	tagsCol := &model.ColumnInfo{
+		ID:        4,
+		Name:      model.NewCIStr("TAGS"),
+		Offset:    3,
+		FieldType: types.FieldType{Tp: mysql.TypeSet, Elems: []string{"a", "b", "c"}},
+		State:     model.StatePublic,
+	}
+	levelCol := &model.ColumnInfo{
+		ID:        5,
+		Name:      model.NewCIStr("LEVEL"),
+		Offset:    4,
+		FieldType: types.FieldType{Tp: mysql.TypeEnum, Flag: mysql.NotNullFlag, Elems: []string{"low", "high"}},
+		State:     model.StatePublic,
+	}
+	table.Columns = append(table.Columns, tagsCol, levelCol)
+
+	sex, err := types.ParseEnumName(table.Columns[2].Elems, "female")
+	c.Assert(err, check.IsNil)
+	tags, err := types.ParseSetName(tagsCol.Elems, "a,c")
+	c.Assert(err, check.IsNil)
+	datums := []types.Datum{types.NewIntDatum(1), types.NewStringDatum("a"), types.NewDatum(sex), types.NewDatum(tags)}
+	// the value of LEVEL is missing, the default one is used
+	sc := &stmtctx.StatementContext{TimeZone: time.UTC}
+	row, err := tablecodec.EncodeRow(sc, datums, []int64{1, 2, 3, 4}, nil, nil)
+	c.Assert(err, check.IsNil)
+	handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(1))
+	c.Assert(err, check.IsNil)
+
+	names, args, err := genMysqlInsert("test", table, append(handle, row...), time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"ID", "NAME", "SEX", "TAGS", "LEVEL"})
+	// the names are written instead of the indexes
+	c.Assert(args[2:], check.DeepEquals, []interface{}{"female", "a,c", "low"})
+
+	names, args, err = genMysqlDelete("test", table, row, time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"ID", "NAME", "SEX", "TAGS"})
+	c.Assert(args[2:], check.DeepEquals, []interface{}{"female", "a,c"})
+}
+
+func (t *testMysqlSuite) TestImplicitRowID(c *check.C) {
+	// the implicit row id column added by drainer for the table without integer primary key
+	table := testGenTable("normal")
+	rowIDCol := &model.ColumnInfo{
+		ID:        implicitColID,
+		Name:      model.NewCIStr("_tidb_rowid"),
+		Offset:    3,
+		FieldType: *types.NewFieldType(mysql.TypeInt24),
+		State:     model.StatePublic,
+	}
+	table.Columns = append(table.Columns, rowIDCol)
+
+	sc := &stmtctx.StatementContext{TimeZone: time.UTC}
+	datums := []types.Datum{types.NewIntDatum(1), types.NewStringDatum("a"), types.NewIntDatum(1)}
+	row, err := tablecodec.EncodeRow(sc, datums, []int64{1, 2, 3}, nil, nil)
+	c.Assert(err, check.IsNil)
+	handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(42))
+	c.Assert(err, check.IsNil)
+
+	// the row id of insert is the handle
+	names, args, err := genMysqlInsert("test", table, append(handle, row...), time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(names[3], check.Equals, "_tidb_rowid")
+	c.Assert(args[3], check.Equals, int64(42))
+
+	// the row id of update and delete is encoded in the row by TiDB
+	rowIDDatums := append(datums, types.NewIntDatum(42))
+	colIDs := []int64{1, 2, 3, implicitColID}
+	oldRow, err := tablecodec.EncodeRow(sc, rowIDDatums, colIDs, nil, nil)
+	c.Assert(err, check.IsNil)
+	newDatums := []types.Datum{types.NewIntDatum(1), types.NewStringDatum("b"), types.NewIntDatum(1), types.NewIntDatum(42)}
+	newRow, err := tablecodec.EncodeRow(sc, newDatums, colIDs, nil, nil)
+	c.Assert(err, check.IsNil)
+	names, values, oldValues, err := genMysqlUpdate("test", table, append(oldRow, newRow...), false, time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(names[3], check.Equals, "_tidb_rowid")
+	c.Assert(values[3], check.Equals, int64(42))
+	c.Assert(oldValues[3], check.Equals, int64(42))
+
+	names, args, err = genMysqlDelete("test", table, oldRow, time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(names[3], check.Equals, "_tidb_rowid")
+	c.Assert(args[3], check.Equals, int64(42))
+}
+
+func (t *testMysqlSuite) TestTimestampInTimeZone(c *check.C) {
+	table := testGenTable("normal")
+	tsCol := &model.ColumnInfo{
+		ID:        4,
+		Name:      model.NewCIStr("CREATED"),
+		Offset:    3,
+		FieldType: *types.NewFieldType(mysql.TypeTimestamp),
+		State:     model.StatePublic,
+	}
+	dtCol := &model.ColumnInfo{
+		ID:        5,
+		Name:      model.NewCIStr("UPDATED"),
+		Offset:    4,
+		FieldType: *types.NewFieldType(mysql.TypeDatetime),
+		State:     model.StatePublic,
+	}
+	table.Columns = append(table.Columns, tsCol, dtCol)
+
+	// TiDB encodes TIMESTAMP values in UTC
+	sc := &stmtctx.StatementContext{TimeZone: time.UTC}
+	ts, err := types.ParseTime(sc, "2019-01-01 00:00:00", mysql.TypeTimestamp, 0)
+	c.Assert(err, check.IsNil)
+	dt, err := types.ParseTime(sc, "2019-01-01 00:00:00", mysql.TypeDatetime, 0)
+	c.Assert(err, check.IsNil)
+	datums := []types.Datum{types.NewIntDatum(1), types.NewStringDatum("a"), types.NewIntDatum(1), types.NewTimeDatum(ts), types.NewTimeDatum(dt)}
+	row, err := tablecodec.EncodeRow(sc, datums, []int64{1, 2, 3, 4, 5}, nil, nil)
+	c.Assert(err, check.IsNil)
+
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	names, args, err := genMysqlDelete("test", table, row, loc)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"ID", "NAME", "SEX", "CREATED", "UPDATED"})
+	c.Assert(args[3], check.Equals, "2019-01-01 08:00:00")
+	// DATETIME doesn't depend on the time zone
+	c.Assert(args[4], check.Equals, "2019-01-01 00:00:00")
+
+	_, args, err = genMysqlDelete("test", table, row, time.UTC)
+	c.Assert(err, check.IsNil)
+	c.Assert(args[3], check.Equals, "2019-01-01 00:00:00")
+
+	handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(1))
+	c.Assert(err, check.IsNil)
+	_, args, err = genMysqlInsert("test", table, append(handle, row...), loc)
+	c.Assert(err, check.IsNil)
+	c.Assert(args[3], check.Equals, "2019-01-01 08:00:00")
+	c.Assert(args[4], check.Equals, "2019-01-01 00:00:00")
+
+	_, args, oldArgs, err := genMysqlUpdate("test", table, append(row, row...), false, loc)
+	c.Assert(err, check.IsNil)
+	c.Assert(args[3], check.Equals, "2019-01-01 08:00:00")
+	c.Assert(oldArgs[3], check.Equals, "2019-01-01 08:00:00")
+}
+
+func (t *testMysqlSuite) TestInsertAutoIDLiterally(c *check.C) {
+	table := testGenTable("hasID")
+	// the values of AUTO_RANDOM (shard bits in the high bits) and AUTO_INCREMENT columns
+	// are allocated by upstream, they must be written as they are
+	table.Columns[0].Flag |= mysql.AutoIncrementFlag
+	autoID := int64(5)<<58 | 12345
+	datums := []types.Datum{types.NewIntDatum(autoID), types.NewStringDatum("a"), types.NewIntDatum(1)}
+	row := testGenInsertBinlog(c, table, datums)
+
+	names, args, err := genMysqlInsert("test", table, row, time.Local)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"ID", "NAME", "SEX"})
+	c.Assert(args[0], check.Equals, autoID)
+
+	// an AUTO_INCREMENT column which isn't the handle
+	table = testGenTable("normal")
+	table.Columns[0].Flag |= mysql.AutoIncrementFlag | mysql.NotNullFlag
+	datums = []types.Datum{types.NewIntDatum(67890), types.NewStringDatum("a"), types.NewIntDatum(1)}
+	row = testGenInsertBinlog(c, table, datums)
+	_, args, err = genMysqlInsert("test", table, row, time.Local)
+	c.Assert(err, check.IsNil)
+	c.Assert(args[0], check.Equals, int64(67890))
+
+	// the literal 0 is kept, it's written as it's with NO_AUTO_VALUE_ON_ZERO of downstream
+	datums = []types.Datum{types.NewIntDatum(0), types.NewStringDatum("a"), types.NewIntDatum(1)}
+	_, args, err = genMysqlInsert("test", table, testGenInsertBinlog(c, table, datums), time.Local)
+	c.Assert(err, check.IsNil)
+	c.Assert(args[0], check.Equals, int64(0))
+
+	// never fall back to the zero value, which makes downstream generate a new one
+	row = testGenInsertBinlog(c, table, datums)
+	table.Columns = append(table.Columns, &model.ColumnInfo{
+		ID:        4,
+		Name:      model.NewCIStr("SEQ"),
+		Offset:    3,
+		FieldType: *types.NewFieldType(mysql.TypeLonglong),
+		State:     model.StatePublic,
+	})
+	table.Columns[3].Flag = mysql.AutoIncrementFlag | mysql.NotNullFlag
+	_, _, err = genMysqlInsert("test", table, row, time.Local)
+	c.Assert(err, check.ErrorMatches, ".*value of auto increment column SEQ is missing.*")
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 	"github.com/pingcap/tidb/sessionctx/stmtctx"
@@ -31,6 +32,13 @@ import (
 	tipb "github.com/pingcap/tipb/go-binlog"
 )
 
+// PbTxnMarkers returns the markers written before and after the records of the txn committed at commitTS
+func PbTxnMarkers(commitTS int64) (begin *pb.Binlog, commit *pb.Binlog) {
+	begin = &pb.Binlog{Tp: pb.BinlogType_BEGIN, CommitTs: commitTS}
+	commit = &pb.Binlog{Tp: pb.BinlogType_COMMIT, CommitTs: commitTS}
+	return
+}
+
 // TiBinlogToPbBinlog translate the binlog format
 func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string, tiBinlog *tipb.Binlog, pv *tipb.PrewriteValue) (pbBinlog *pb.Binlog, err error) {
 	pbBinlog = new(pb.Binlog)
@@ -38,13 +46,18 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 	pbBinlog.CommitTs = tiBinlog.CommitTs
 
 	if tiBinlog.DdlJobId > 0 { // DDL
-		sql := string(tiBinlog.GetDdlQuery())
-		stmt, err := getParser().ParseOneStmt(sql, "", "")
-		if err != nil {
-			return nil, errors.Trace(err)
+		sql := util.CommentTTL(util.CommentAutoRandom(string(tiBinlog.GetDdlQuery())))
+		isCreateDatabase := false
+		// the parser can't parse sequence DDL, multi-valued index DDL and global temporary table DDL yet,
+		// and they're never a CREATE DATABASE
+		if !util.IsSequenceDDL(sql) && !util.IsMultiValuedIndexDDL(sql) && !util.IsGlobalTemporaryTableDDL(sql) {
+			stmt, err := getParser().ParseOneStmt(sql, "", "")
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			_, isCreateDatabase = stmt.(*ast.CreateDatabaseStmt)
 		}
 
-		_, isCreateDatabase := stmt.(*ast.CreateDatabaseStmt)
 		if isCreateDatabase {
 			sql += ";"
 		} else {
@@ -59,7 +72,7 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 		for _, mut := range pv.GetMutations() {
 			var info *model.TableInfo
 			var ok bool
-			info, ok = infoGetter.TableByID(mut.GetTableId())
+			info, ok = infoGetter.TableByIDAndVersion(mut.GetTableId(), pv.GetSchemaVersion())
 			if !ok {
 				return nil, errors.Errorf("TableByID empty table id: %d", mut.GetTableId())
 			}
@@ -115,7 +128,7 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 func genInsert(schema string, table *model.TableInfo, row []byte) (event *pb.Event, err error) {
 	columns := table.Columns
 
-	_, columnValues, err := insertRowToDatums(table, row)
+	_, columnValues, err := insertRowToDatums(table, row, time.Local)
 	if err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
@@ -133,6 +146,9 @@ func genInsert(schema string, table *model.TableInfo, row []byte) (event *pb.Eve
 		mysqlTypes = append(mysqlTypes, types.TypeToStr(col.Tp, col.Charset))
 		val, ok := columnValues[col.ID]
 		if !ok {
+			if mysql.HasAutoIncrementFlag(col.Flag) {
+				return nil, errors.Errorf("value of auto increment column %s is missing", col.Name)
+			}
 			val = getDefaultOrZeroValue(col)
 		}
 
@@ -43,6 +43,36 @@ func (t *testPbSuite) TestDDL(c *check.C) {
 		DdlQuery: []byte(expected),
 	})
 
+	// sequence DDL can't be parsed by the parser yet
+	t.TiBinlog.DdlQuery = []byte("create sequence seq start with 3")
+	pbBinog, err = TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(pbBinog.GetDdlQuery()), check.Equals, "use test; create sequence seq start with 3;")
+
+	// AUTO_RANDOM can't be parsed by the parser yet, it's kept in TiDB's executable comment
+	t.TiBinlog.DdlQuery = []byte("create table t(id bigint primary key auto_random(5))")
+	pbBinog, err = TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(pbBinog.GetDdlQuery()), check.Equals, "use test; create table t(id bigint primary key /*T![auto_rand] auto_random(5) */);")
+
+	// so are the TTL attributes
+	t.TiBinlog.DdlQuery = []byte("create table t(c datetime) TTL = `c` + INTERVAL 1 DAY TTL_ENABLE = 'OFF'")
+	pbBinog, err = TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(pbBinog.GetDdlQuery()), check.Equals, "use test; create table t(c datetime) /*T![ttl] TTL = `c` + INTERVAL 1 DAY */ /*T![ttl] TTL_ENABLE = 'OFF' */;")
+
+	// nor the multi-valued indexes, they're passed through
+	t.TiBinlog.DdlQuery = []byte("create table t(id int, j json, index zips((cast(j->'$.zip' as unsigned array))))")
+	pbBinog, err = TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(pbBinog.GetDdlQuery()), check.Equals, "use test; create table t(id int, j json, index zips((cast(j->'$.zip' as unsigned array))));")
+
+	// the comments are kept
+	t.TiBinlog.DdlQuery = []byte("create table t(id bigint primary key comment 'id; auto_random(5)') comment 'table'")
+	pbBinog, err = TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(pbBinog.GetDdlQuery()), check.Equals, "use test; create table t(id bigint primary key comment 'id; auto_random(5)') comment 'table';")
+
 	// test create database should not contains `use db`
 	t.TiBinlog.DdlQuery = []byte("create database test")
 	pbBinog, err = TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
@@ -57,6 +87,16 @@ func (t *testPbSuite) TestDDL(c *check.C) {
 	})
 }
 
+func (t *testPbSuite) TestIndexDDL(c *check.C) {
+	t.SetDDL()
+	for _, sql := range indexDDLs {
+		t.TiBinlog.DdlQuery = []byte(sql)
+		pbBinog, err := TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+		c.Assert(err, check.IsNil)
+		c.Assert(string(pbBinog.GetDdlQuery()), check.Equals, "use test; "+sql+";")
+	}
+}
+
 func (t *testPbSuite) testDML(c *check.C, tp pb.EventType) {
 	pbBinlog, err := TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, t.PV)
 	c.Assert(err, check.IsNil)
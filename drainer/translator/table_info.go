@@ -18,6 +18,9 @@ import "github.com/pingcap/parser/model"
 // TableInfoGetter is used to get table info by table id of TiDB
 type TableInfoGetter interface {
 	TableByID(id int64) (info *model.TableInfo, ok bool)
+	// TableByIDAndVersion returns the table info at the schema version,
+	// the rows written by a txn must be decoded with the table info at the schema version of the txn.
+	TableByIDAndVersion(id int64, version int64) (info *model.TableInfo, ok bool)
 	SchemaAndTableName(id int64) (string, string, bool)
 	IsDroppingColumn(id int64) bool
 }
@@ -82,6 +82,11 @@ func (g *BinlogGenrator) TableByID(id int64) (info *model.TableInfo, ok bool) {
 	return
 }
 
+// TableByIDAndVersion implements TableInfoGetter interface
+func (g *BinlogGenrator) TableByIDAndVersion(id int64, version int64) (info *model.TableInfo, ok bool) {
+	return g.TableByID(id)
+}
+
 // SchemaAndTableName implements TableInfoGetter interface
 func (g *BinlogGenrator) SchemaAndTableName(id int64) (schema string, table string, ok bool) {
 	names, ok := g.id2name[id]
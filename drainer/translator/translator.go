@@ -43,7 +43,7 @@ func getParser() (p *parser.Parser) {
 	return
 }
 
-func insertRowToDatums(table *model.TableInfo, row []byte) (pk types.Datum, datums map[int64]types.Datum, err error) {
+func insertRowToDatums(table *model.TableInfo, row []byte, loc *time.Location) (pk types.Datum, datums map[int64]types.Datum, err error) {
 	colsTypeMap := util.ToColumnTypeMap(table.Columns)
 
 	// decode the pk value
@@ -53,7 +53,7 @@ func insertRowToDatums(table *model.TableInfo, row []byte) (pk types.Datum, datu
 		return types.Datum{}, nil, errors.Trace(err)
 	}
 
-	datums, err = tablecodec.DecodeRow(remain, colsTypeMap, time.Local)
+	datums, err = tablecodec.DecodeRow(remain, colsTypeMap, loc)
 	if err != nil {
 		return types.Datum{}, nil, errors.Trace(err)
 	}
@@ -88,7 +88,9 @@ func getDefaultOrZeroValue(col *model.ColumnInfo) types.Datum {
 		return types.NewDatum(nil)
 	}
 
-	if col.GetDefaultValue() != nil {
+	// the default value taking the next value of a sequence is an expression,
+	// it can't be used as a literal value.
+	if col.GetDefaultValue() != nil && !util.IsSequenceDefault(col.GetDefaultValue()) {
 		return types.NewDatum(col.GetDefaultValue())
 	}
 
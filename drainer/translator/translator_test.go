@@ -17,6 +17,9 @@ import (
 	"testing"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
 )
 
 func TestClient(t *testing.T) {
@@ -26,3 +29,16 @@ func TestClient(t *testing.T) {
 var _ = Suite(&testTranslatorSuite{})
 
 type testTranslatorSuite struct{}
+
+func (t *testTranslatorSuite) TestGetDefaultOrZeroValue(c *C) {
+	col := &model.ColumnInfo{FieldType: *types.NewFieldType(mysql.TypeLonglong)}
+	col.Flag = mysql.NotNullFlag
+	c.Assert(col.SetDefaultValue("5"), IsNil)
+	val := getDefaultOrZeroValue(col)
+	c.Assert(val.GetValue(), Equals, "5")
+
+	// the default expression of sequence can't be used as value
+	c.Assert(col.SetDefaultValue("nextval(`test`.`seq`)"), IsNil)
+	val = getDefaultOrZeroValue(col)
+	c.Assert(val.GetInt64(), Equals, int64(0))
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"sync"
+)
+
+// txnWindow tracks the transactions sent to downstream but not applied yet.
+// It limits the count of them if limit > 0, and gives the commit ts
+// before which all the transactions are applied, so the checkpoint advances
+// in commit order even if downstream applies them out of order.
+type txnWindow struct {
+	// a slot is taken by sending to it before a transaction is sent to downstream,
+	// it's nil if there's no limit.
+	slots chan struct{}
+
+	mu sync.Mutex
+	// commit ts of the transactions in the order they're sent
+	sent    []int64
+	applied map[int64]struct{}
+	// the transactions reserved without taking slots
+	reserved map[int64]struct{}
+}
+
+func newTxnWindow(limit int) *txnWindow {
+	w := &txnWindow{
+		applied:  make(map[int64]struct{}),
+		reserved: make(map[int64]struct{}),
+	}
+	if limit > 0 {
+		w.slots = make(chan struct{}, limit)
+	}
+	return w
+}
+
+// add records a transaction whose slot is taken, it must be called in commit ts order.
+func (w *txnWindow) add(commitTS int64) {
+	w.mu.Lock()
+	w.sent = append(w.sent, commitTS)
+	w.mu.Unlock()
+}
+
+// reserve records a transaction held before it's sent to downstream without taking a slot, so the
+// transactions after it are not taken as applied before it, it must be called in commit ts order like add.
+func (w *txnWindow) reserve(commitTS int64) {
+	w.mu.Lock()
+	w.sent = append(w.sent, commitTS)
+	w.reserved[commitTS] = struct{}{}
+	w.mu.Unlock()
+}
+
+// done releases the slot of the applied transaction, and returns the commit ts before which
+// all the transactions are applied, it's 0 if the earliest transaction isn't applied yet.
+func (w *txnWindow) done(commitTS int64) (appliedTS int64) {
+	w.mu.Lock()
+	w.applied[commitTS] = struct{}{}
+	_, reserved := w.reserved[commitTS]
+	delete(w.reserved, commitTS)
+	for len(w.sent) > 0 {
+		ts := w.sent[0]
+		if _, ok := w.applied[ts]; !ok {
+			break
+		}
+		delete(w.applied, ts)
+		w.sent = w.sent[1:]
+		appliedTS = ts
+	}
+	w.mu.Unlock()
+
+	if w.slots != nil && !reserved {
+		<-w.slots
+	}
+	return appliedTS
+}
+
+// inflight returns the count of transactions sent but not applied yet.
+func (w *txnWindow) inflight() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.sent) - len(w.applied)
+}
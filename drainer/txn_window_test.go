@@ -0,0 +1,76 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/check"
+)
+
+type txnWindowSuite struct{}
+
+var _ = check.Suite(&txnWindowSuite{})
+
+func (s *txnWindowSuite) TestUnlimited(c *check.C) {
+	w := newTxnWindow(0)
+	c.Assert(w.slots, check.IsNil)
+
+	for ts := int64(1); ts <= 3; ts++ {
+		w.add(ts)
+	}
+	c.Assert(w.inflight(), check.Equals, 3)
+	c.Assert(w.done(1), check.Equals, int64(1))
+	c.Assert(w.done(2), check.Equals, int64(2))
+	c.Assert(w.done(3), check.Equals, int64(3))
+	c.Assert(w.inflight(), check.Equals, 0)
+}
+
+func (s *txnWindowSuite) TestDoneOutOfOrder(c *check.C) {
+	w := newTxnWindow(4)
+	for ts := int64(1); ts <= 4; ts++ {
+		w.slots <- struct{}{}
+		w.add(ts)
+	}
+	c.Assert(w.inflight(), check.Equals, 4)
+
+	// the checkpoint can't advance until the earliest one is applied
+	c.Assert(w.done(3), check.Equals, int64(0))
+	c.Assert(w.done(2), check.Equals, int64(0))
+	c.Assert(w.inflight(), check.Equals, 2)
+	c.Assert(len(w.slots), check.Equals, 2)
+
+	c.Assert(w.done(1), check.Equals, int64(3))
+	c.Assert(w.done(4), check.Equals, int64(4))
+	c.Assert(w.inflight(), check.Equals, 0)
+	c.Assert(len(w.slots), check.Equals, 0)
+}
+
+func (s *txnWindowSuite) TestReserve(c *check.C) {
+	w := newTxnWindow(2)
+	w.slots <- struct{}{}
+	w.add(1)
+	// the held transaction takes no slot
+	w.reserve(2)
+	w.slots <- struct{}{}
+	w.add(3)
+	c.Assert(len(w.slots), check.Equals, 2)
+
+	c.Assert(w.done(1), check.Equals, int64(1))
+	c.Assert(w.done(3), check.Equals, int64(0))
+	c.Assert(len(w.slots), check.Equals, 0)
+
+	// it's applied after released
+	c.Assert(w.done(2), check.Equals, int64(3))
+	c.Assert(len(w.slots), check.Equals, 0)
+	c.Assert(w.inflight(), check.Equals, 0)
+}
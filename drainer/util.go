@@ -20,13 +20,21 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/meta"
 	"go.uber.org/zap"
@@ -85,6 +93,14 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 
 	toCheckpoint := cfg.SyncerCfg.To.Checkpoint
 
+	quote, err := pkgsql.ParseIdentifierQuote(cfg.SyncerCfg.To.IdentifierQuote)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	checkpointCfg.IdentifierQuote = quote
+	checkpointCfg.TableOptions = cfg.SyncerCfg.To.TableOptions()
+	checkpointCfg.VerifySave = toCheckpoint.VerifySave
+
 	if toCheckpoint.Schema != "" {
 		checkpointCfg.Schema = toCheckpoint.Schema
 	}
@@ -97,6 +113,15 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 			User:     toCheckpoint.User,
 			Password: toCheckpoint.Password,
 			Port:     toCheckpoint.Port,
+
+			PasswordFile: toCheckpoint.PasswordFile,
+			PasswordEnv:  toCheckpoint.PasswordEnv,
+		}
+	case "sqlite":
+		checkpointCfg.CheckpointType = toCheckpoint.Type
+		checkpointCfg.SQLiteFile = toCheckpoint.Path
+		if len(checkpointCfg.SQLiteFile) == 0 {
+			checkpointCfg.SQLiteFile = path.Join(cfg.DataDir, "checkpoint.db")
 		}
 	case "":
 		switch cfg.SyncerCfg.DestDBType {
@@ -107,6 +132,7 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 				User:     cfg.SyncerCfg.To.User,
 				Password: cfg.SyncerCfg.To.Password,
 				Port:     cfg.SyncerCfg.To.Port,
+				InitSQL:  cfg.SyncerCfg.To.InitSQL,
 			}
 		case "pb", "file":
 			checkpointCfg.CheckpointType = "file"
@@ -121,9 +147,119 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 		return nil, errors.Errorf("unknown checkpoint type: %s", toCheckpoint.Type)
 	}
 
+	if len(toCheckpoint.WaitReplicas) > 0 {
+		if checkpointCfg.CheckpointType != "mysql" {
+			return nil, errors.Errorf("wait-replica is only supported by mysql checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		for _, r := range toCheckpoint.WaitReplicas {
+			checkpointCfg.WaitReplicas = append(checkpointCfg.WaitReplicas, &checkpoint.DBConfig{
+				Host:         r.Host,
+				User:         r.User,
+				Password:     r.Password,
+				Port:         r.Port,
+				PasswordFile: r.PasswordFile,
+				PasswordEnv:  r.PasswordEnv,
+			})
+		}
+		checkpointCfg.WaitReplicaTimeout = time.Duration(toCheckpoint.WaitReplicaTimeout) * time.Second
+	}
+
+	if toCheckpoint.IdleTimeout > 0 {
+		if checkpointCfg.Db == nil {
+			return nil, errors.Errorf("idle-timeout is only supported by mysql or tidb checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		checkpointCfg.IdleTimeout = time.Duration(toCheckpoint.IdleTimeout) * time.Second
+	}
+
+	if len(toCheckpoint.InitSQL) > 0 {
+		if checkpointCfg.Db == nil {
+			return nil, errors.Errorf("init-sql is only supported by mysql or tidb checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		checkpointCfg.Db.InitSQL = toCheckpoint.InitSQL
+	}
+
+	if len(toCheckpoint.MarkerTable) > 0 {
+		if checkpointCfg.Db == nil {
+			return nil, errors.Errorf("marker-table is only supported by mysql or tidb checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		if err := checkMarkerTable(cfg, checkpointCfg.Schema, toCheckpoint.MarkerTable); err != nil {
+			return nil, errors.Trace(err)
+		}
+		checkpointCfg.MarkerTable = toCheckpoint.MarkerTable
+	}
+
+	if toCheckpoint.RecreateMissingTable {
+		if checkpointCfg.Db == nil {
+			return nil, errors.Errorf("recreate-missing-table is only supported by mysql or tidb checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		checkpointCfg.RecreateMissingTable = true
+	}
+
+	if len(toCheckpoint.ReadHint) > 0 {
+		if checkpointCfg.Db == nil {
+			return nil, errors.Errorf("read-hint is only supported by mysql or tidb checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		hint := toCheckpoint.ReadHint
+		if len(hint) < 4 || !strings.HasPrefix(hint, "/*") || !strings.HasSuffix(hint, "*/") || strings.Contains(hint[2:len(hint)-2], "*/") {
+			return nil, errors.Errorf("invalid read-hint %s, must be a comment like /* ... */", hint)
+		}
+		checkpointCfg.ReadHint = hint
+	}
+
+	if toCheckpoint.ReadPrimary {
+		if checkpointCfg.Db == nil {
+			return nil, errors.Errorf("read-primary is only supported by mysql or tidb checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		checkpointCfg.ReadPrimary = true
+	}
+
+	if len(toCheckpoint.RewindAction) > 0 {
+		switch toCheckpoint.RewindAction {
+		case checkpoint.RewindActionWarn, checkpoint.RewindActionRefuse:
+		default:
+			return nil, errors.Errorf("invalid rewind-action %s, must be %s or %s", toCheckpoint.RewindAction, checkpoint.RewindActionWarn, checkpoint.RewindActionRefuse)
+		}
+		checkpointCfg.RewindAction = toCheckpoint.RewindAction
+		checkpointCfg.HighWaterMarkFile = path.Join(cfg.DataDir, "checkpoint_high_water_mark")
+	}
+
+	if len(toCheckpoint.SSLCA) == 0 && (len(toCheckpoint.SSLCert) > 0 || len(toCheckpoint.SSLKey) > 0) {
+		return nil, errors.New("ssl-cert and ssl-key of checkpoint require ssl-ca")
+	}
+
+	if len(toCheckpoint.SSLCA) > 0 {
+		if checkpointCfg.Db == nil {
+			return nil, errors.Errorf("ssl-ca is only supported by mysql or tidb checkpoint, but got %s", checkpointCfg.CheckpointType)
+		}
+		checkpointCfg.SSLCA = toCheckpoint.SSLCA
+		checkpointCfg.SSLCert = toCheckpoint.SSLCert
+		checkpointCfg.SSLKey = toCheckpoint.SSLKey
+	}
+
 	return checkpointCfg, nil
 }
 
+// checkMarkerTable checks the marker table doesn't collide with the checkpoint table, or the ones of drainer
+// in the mark schema if the checkpoint is saved there, otherwise saving the checkpoint always fails
+func checkMarkerTable(cfg *Config, schema string, markerTable string) error {
+	if schema == "" {
+		schema = checkpoint.DefaultSchema
+	}
+	tables := []string{checkpoint.DefaultTable}
+	if strings.EqualFold(schema, loopbacksync.MarkTableSchema) {
+		tables = append(tables, loopbacksync.MarkTableName, dsync.DeadLetterTableName)
+		if len(cfg.SyncerCfg.To.StatsTable) > 0 {
+			tables = append(tables, cfg.SyncerCfg.To.StatsTable)
+		}
+	}
+	for _, table := range tables {
+		if strings.EqualFold(markerTable, table) {
+			return errors.Errorf("marker-table %s collides with the table %s in the checkpoint schema %s", markerTable, table, schema)
+		}
+	}
+	return nil
+}
+
 func initializeSaramaGlobalConfig() {
 	sarama.MaxResponseSize = int32(maxMsgSize)
 	// add 1 to avoid confused log: Producer.MaxMessageBytes must be smaller than MaxRequestSize; it will be ignored
@@ -191,3 +327,55 @@ func genDrainerID(listenAddr string) (string, error) {
 
 	return fmt.Sprintf("%s:%s", hostname, port), nil
 }
+
+// exchangePartitionTables returns the partitioned table and the table exchanged with its partition if query is
+// `ALTER TABLE ... EXCHANGE PARTITION ... WITH TABLE ...`, defaultSchema is used for the tables not qualified by schema.
+func exchangePartitionTables(query string, defaultSchema string) (partitioned filter.TableName, exchanged filter.TableName, ok bool) {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return
+	}
+	alter, isAlter := stmt.(*ast.AlterTableStmt)
+	if !isAlter {
+		return
+	}
+
+	tableName := func(name *ast.TableName) filter.TableName {
+		schema := name.Schema.O
+		if len(schema) == 0 {
+			schema = defaultSchema
+		}
+		return filter.TableName{Schema: schema, Table: name.Name.O}
+	}
+	for _, spec := range alter.Specs {
+		if spec.Tp == ast.AlterTableExchangePartition {
+			return tableName(alter.Table), tableName(spec.NewTable), true
+		}
+	}
+	return
+}
+
+// setVariables returns the lower-case names of the variables set by query if it's a `SET` statement,
+// the user-defined variables are prefixed with "@", and `SET NAMES` sets the variable "names".
+func setVariables(query string) (names []string, ok bool) {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return nil, false
+	}
+	set, isSet := stmt.(*ast.SetStmt)
+	if !isSet {
+		return nil, false
+	}
+
+	for _, v := range set.Variables {
+		name := strings.ToLower(v.Name)
+		switch {
+		case v.Name == ast.SetNames:
+			name = "names"
+		case !v.IsSystem:
+			name = "@" + name
+		}
+		names = append(names, name)
+	}
+	return names, true
+}
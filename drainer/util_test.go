@@ -14,7 +14,13 @@
 package drainer
 
 import (
+	"time"
+
 	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
 )
 
 type taskGroupSuite struct{}
@@ -40,3 +46,244 @@ func (s *taskGroupSuite) TestShouldRecoverFromPanic(c *C) {
 	c.Assert(logHook.Entrys[1].Message, Matches, ".*Exit.*")
 }
 */
+
+type checkpointCfgSuite struct{}
+
+var _ = Suite(&checkpointCfgSuite{})
+
+func (s *checkpointCfgSuite) TestWaitReplicas(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{
+		Host: "primary",
+		Port: 3306,
+		Checkpoint: dsync.CheckpointConfig{
+			WaitReplicas:       []dsync.CheckpointReplica{{Host: "replica", Port: 3307, PasswordEnv: "REPLICA_PASSWORD"}},
+			WaitReplicaTimeout: 3,
+		},
+	}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.WaitReplicas, HasLen, 1)
+	c.Assert(cpCfg.WaitReplicas[0].Host, Equals, "replica")
+	c.Assert(cpCfg.WaitReplicas[0].Port, Equals, 3307)
+	c.Assert(cpCfg.WaitReplicas[0].PasswordEnv, Equals, "REPLICA_PASSWORD")
+	c.Assert(cpCfg.WaitReplicaTimeout, Equals, 3*time.Second)
+
+	// tidb has no GTID to wait for
+	cfg.SyncerCfg.DestDBType = "tidb"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*wait-replica is only supported by mysql checkpoint.*")
+}
+
+func (s *checkpointCfgSuite) TestTLS(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{
+		Checkpoint: dsync.CheckpointConfig{
+			Type:    "mysql",
+			Host:    "checkpoint",
+			SSLCA:   "ca.pem",
+			SSLCert: "cert.pem",
+			SSLKey:  "key.pem",
+		},
+	}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.SSLCA, Equals, "ca.pem")
+	c.Assert(cpCfg.SSLCert, Equals, "cert.pem")
+	c.Assert(cpCfg.SSLKey, Equals, "key.pem")
+
+	// the client certificate isn't used without ssl-ca, so it's rejected rather than ignored silently
+	cfg.SyncerCfg.To.Checkpoint.SSLCA = ""
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "ssl-cert and ssl-key of checkpoint require ssl-ca")
+	cfg.SyncerCfg.To.Checkpoint.SSLCert = ""
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "ssl-cert and ssl-key of checkpoint require ssl-ca")
+	cfg.SyncerCfg.To.Checkpoint.SSLCA = "ca.pem"
+
+	cfg.SyncerCfg.DestDBType = "file"
+	cfg.SyncerCfg.To.Checkpoint.Type = ""
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*ssl-ca is only supported by mysql or tidb checkpoint.*")
+}
+
+func (s *checkpointCfgSuite) TestIdleTimeout(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{
+		Checkpoint: dsync.CheckpointConfig{Type: "mysql", Host: "checkpoint", IdleTimeout: 300},
+	}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.IdleTimeout, Equals, 5*time.Minute)
+
+	cfg.SyncerCfg.DestDBType = "file"
+	cfg.SyncerCfg.To.Checkpoint.Type = ""
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*idle-timeout is only supported by mysql or tidb checkpoint.*")
+}
+
+func (s *checkpointCfgSuite) TestMarkerTable(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{Checkpoint: dsync.CheckpointConfig{MarkerTable: "marker"}}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.MarkerTable, Equals, "marker")
+
+	// saving the checkpoint always fails if the marker table is the checkpoint table or another table of drainer
+	cfg.SyncerCfg.To.Checkpoint.MarkerTable = "Checkpoint"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "marker-table Checkpoint collides with the table checkpoint in the checkpoint schema tidb_binlog")
+	cfg.SyncerCfg.To.Checkpoint.MarkerTable = loopbacksync.MarkTableName
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "marker-table _drainer_repl_mark collides with .*")
+	cfg.SyncerCfg.To.StatsTable = "stats"
+	cfg.SyncerCfg.To.Checkpoint.MarkerTable = "stats"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "marker-table stats collides with .*")
+	// the tables of the mark schema don't collide with the marker table in another schema
+	cfg.SyncerCfg.To.Checkpoint.Schema = "cp"
+	cpCfg, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.MarkerTable, Equals, "stats")
+	cfg.SyncerCfg.To.Checkpoint.MarkerTable = "checkpoint"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "marker-table checkpoint collides with the table checkpoint in the checkpoint schema cp")
+	cfg.SyncerCfg.To.Checkpoint.MarkerTable = "marker"
+
+	cfg.SyncerCfg.DestDBType = "file"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*marker-table is only supported by mysql or tidb checkpoint.*")
+}
+
+func (s *checkpointCfgSuite) TestRecreateMissingTable(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{Checkpoint: dsync.CheckpointConfig{RecreateMissingTable: true}}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.RecreateMissingTable, IsTrue)
+
+	cfg.SyncerCfg.DestDBType = "kafka"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*recreate-missing-table is only supported by mysql or tidb checkpoint.*")
+}
+
+func (s *checkpointCfgSuite) TestReadPrimary(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.To = &dsync.DBConfig{Checkpoint: dsync.CheckpointConfig{ReadHint: "/* maxscale route to master */", ReadPrimary: true}}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.ReadHint, Equals, "/* maxscale route to master */")
+	c.Assert(cpCfg.ReadPrimary, IsTrue)
+
+	cfg.SyncerCfg.To.Checkpoint.ReadHint = "/* route */ select 1; /* */"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "invalid read-hint .*, must be a comment like /\\* ... \\*/")
+	cfg.SyncerCfg.To.Checkpoint.ReadHint = "FORCE_MASTER"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "invalid read-hint FORCE_MASTER.*")
+	// the prefix and the suffix overlap
+	cfg.SyncerCfg.To.Checkpoint.ReadHint = "/*/"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "invalid read-hint /\\*/.*")
+
+	cfg.SyncerCfg.DestDBType = "kafka"
+	cfg.SyncerCfg.To.Checkpoint.ReadHint = ""
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*read-primary is only supported by mysql or tidb checkpoint.*")
+	cfg.SyncerCfg.To.Checkpoint = dsync.CheckpointConfig{ReadHint: "/* route */"}
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*read-hint is only supported by mysql or tidb checkpoint.*")
+}
+
+func (s *checkpointCfgSuite) TestRewindAction(c *C) {
+	cfg := NewConfig()
+	cfg.DataDir = "/tmp/drainer"
+	cfg.SyncerCfg.DestDBType = "kafka"
+	cfg.SyncerCfg.To = &dsync.DBConfig{}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.RewindAction, Equals, "")
+
+	// it's checked for all types of checkpoint
+	cfg.SyncerCfg.To.Checkpoint.RewindAction = checkpoint.RewindActionRefuse
+	cpCfg, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.RewindAction, Equals, checkpoint.RewindActionRefuse)
+	c.Assert(cpCfg.HighWaterMarkFile, Equals, "/tmp/drainer/checkpoint_high_water_mark")
+
+	cfg.SyncerCfg.To.Checkpoint.RewindAction = "ignore"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, "invalid rewind-action ignore, must be warn or refuse")
+}
+
+func (s *checkpointCfgSuite) TestInitSQL(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "tidb"
+	cfg.SyncerCfg.To = &dsync.DBConfig{InitSQL: []string{"SET SESSION tidb_txn_mode = 'optimistic'"}}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.Db.InitSQL, DeepEquals, []string{"SET SESSION tidb_txn_mode = 'optimistic'"})
+
+	// the init sql of checkpoint takes precedence
+	cfg.SyncerCfg.To.Checkpoint.InitSQL = []string{"SET SESSION wait_timeout = 3600"}
+	cpCfg, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.Db.InitSQL, DeepEquals, []string{"SET SESSION wait_timeout = 3600"})
+
+	cfg.SyncerCfg.DestDBType = "file"
+	_, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, ErrorMatches, ".*init-sql is only supported by mysql or tidb checkpoint.*")
+}
+
+func (s *checkpointCfgSuite) TestSQLite(c *C) {
+	cfg := NewConfig()
+	cfg.DataDir = "/data"
+	cfg.SyncerCfg.DestDBType = "file"
+	cfg.SyncerCfg.To = &dsync.DBConfig{Checkpoint: dsync.CheckpointConfig{Type: "sqlite"}}
+	cpCfg, err := GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.CheckpointType, Equals, "sqlite")
+	c.Assert(cpCfg.SQLiteFile, Equals, "/data/checkpoint.db")
+
+	cfg.SyncerCfg.To.Checkpoint.Path = "/var/lib/drainer/cp.db"
+	cpCfg, err = GenCheckPointCfg(cfg, 1)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.SQLiteFile, Equals, "/var/lib/drainer/cp.db")
+}
+
+type exchangePartitionSuite struct{}
+
+var _ = Suite(&exchangePartitionSuite{})
+
+func (s *exchangePartitionSuite) TestExchangePartitionTables(c *C) {
+	partitioned, exchanged, ok := exchangePartitionTables("ALTER TABLE test.p EXCHANGE PARTITION p0 WITH TABLE t WITHOUT VALIDATION", "db")
+	c.Assert(ok, IsTrue)
+	c.Assert(partitioned, DeepEquals, filter.TableName{Schema: "test", Table: "p"})
+	c.Assert(exchanged, DeepEquals, filter.TableName{Schema: "db", Table: "t"})
+
+	for _, query := range []string{"ALTER TABLE p TRUNCATE PARTITION p0", "CREATE TABLE t (id INT)", "invalid"} {
+		_, _, ok = exchangePartitionTables(query, "db")
+		c.Assert(ok, IsFalse)
+	}
+}
+
+type setVariablesSuite struct{}
+
+var _ = Suite(&setVariablesSuite{})
+
+func (s *setVariablesSuite) TestSetVariables(c *C) {
+	names, ok := setVariables("SET GLOBAL Time_Zone = '+08:00', @@session.sql_mode = '', @Tmp = 1, NAMES utf8mb4")
+	c.Assert(ok, IsTrue)
+	c.Assert(names, DeepEquals, []string{"time_zone", "sql_mode", "@tmp", "names"})
+
+	for _, query := range []string{"CREATE TABLE t (id INT)", "SET PASSWORD = 'x'", "invalid"} {
+		_, ok = setVariables(query)
+		c.Assert(ok, IsFalse)
+	}
+}
@@ -81,8 +81,17 @@ func readInt32(r io.Reader) (uint32, error) {
 	return n, err
 }
 
-// Decode return payload and bytes read from io.Reader
+// Decode return payload and bytes read from io.Reader, the crc32 of the payload is verified
 func Decode(r io.Reader) (payload []byte, length int64, err error) {
+	return decode(r, true)
+}
+
+// DecodeWithoutChecksum is like Decode but doesn't verify the crc32 of the payload
+func DecodeWithoutChecksum(r io.Reader) (payload []byte, length int64, err error) {
+	return decode(r, false)
+}
+
+func decode(r io.Reader, verifyChecksum bool) (payload []byte, length int64, err error) {
 	// read and chekc magic number
 	magicNum, err := readInt32(r)
 	if err != nil {
@@ -114,10 +123,12 @@ func Decode(r io.Reader) (payload []byte, length int64, err error) {
 	payload = data[:size]
 
 	// crc32 check
-	entryCrc := binary.LittleEndian.Uint32(data[size:])
-	crc := crc32.Checksum(payload, crcTable)
-	if crc != entryCrc {
-		return nil, 0, errors.Errorf("expected crc32 %v but got %v", entryCrc, crc)
+	if verifyChecksum {
+		entryCrc := binary.LittleEndian.Uint32(data[size:])
+		crc := crc32.Checksum(payload, crcTable)
+		if crc != entryCrc {
+			return nil, 0, errors.Errorf("expected crc32 %v but got %v", entryCrc, crc)
+		}
 	}
 
 	// len(magic) + len(size) + len(payload) + len(crc)
@@ -28,16 +28,29 @@ type Filter struct {
 
 	ignoreDBs    []string
 	ignoreTables []TableName
+
+	caseSensitive bool
 }
 
-// NewFilter creates a instance of Filter
+// NewFilter creates a instance of Filter, the names are matched case-insensitively
 func NewFilter(ignoreDBs []string, ignoreTables []TableName, doDBs []string, doTables []TableName) *Filter {
+	return newFilter(ignoreDBs, ignoreTables, doDBs, doTables, false)
+}
+
+// NewCaseSensitiveFilter creates a instance of Filter matching the names case-sensitively,
+// e.g. the pattern `db1` doesn't match the schema `DB1`.
+func NewCaseSensitiveFilter(ignoreDBs []string, ignoreTables []TableName, doDBs []string, doTables []TableName) *Filter {
+	return newFilter(ignoreDBs, ignoreTables, doDBs, doTables, true)
+}
+
+func newFilter(ignoreDBs []string, ignoreTables []TableName, doDBs []string, doTables []TableName, caseSensitive bool) *Filter {
 	filter := &Filter{
-		ignoreDBs:    ignoreDBs,
-		ignoreTables: ignoreTables,
-		doDBs:        doDBs,
-		doTables:     doTables,
-		reMap:        make(map[string]*regexp.Regexp),
+		ignoreDBs:     ignoreDBs,
+		ignoreTables:  ignoreTables,
+		doDBs:         doDBs,
+		doTables:      doTables,
+		reMap:         make(map[string]*regexp.Regexp),
+		caseSensitive: caseSensitive,
 	}
 
 	filter.genRegexMap()
@@ -45,13 +58,29 @@ func NewFilter(ignoreDBs []string, ignoreTables []TableName, doDBs []string, doT
 	return filter
 }
 
+// CompilePattern compiles the pattern of schema or table name, the pattern starting with "~"
+// is a regular expression, otherwise it must match the name completely, both are case-insensitive.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	return compilePattern(pattern, false)
+}
+
+func compilePattern(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	flags := "(?i)"
+	if caseSensitive {
+		flags = ""
+	}
+	if len(pattern) > 0 && pattern[0] == '~' {
+		return regexp.Compile(flags + pattern[1:])
+	}
+	// must match completely
+	return regexp.Compile(fmt.Sprintf("%s^%s$", flags, pattern))
+}
+
 func (s *Filter) addOneRegex(originStr string) {
 	if _, ok := s.reMap[originStr]; !ok {
-		var re *regexp.Regexp
-		if len(originStr) > 0 && originStr[0] == '~' {
-			re = regexp.MustCompile(fmt.Sprintf("(?i)%s", originStr[1:]))
-		} else { // must match completely
-			re = regexp.MustCompile(fmt.Sprintf("(?i)^%s$", originStr))
+		re, err := compilePattern(originStr, s.caseSensitive)
+		if err != nil {
+			panic(err)
 		}
 		s.reMap[originStr] = re
 	}
@@ -117,7 +146,10 @@ func (s *Filter) blackFilter(stbs []TableName) []TableName {
 
 // SkipSchemaAndTable skips data based on schema and table rules.
 func (s *Filter) SkipSchemaAndTable(schema string, table string) bool {
-	tbs := []TableName{{Schema: strings.ToLower(schema), Table: strings.ToLower(table)}}
+	tbs := []TableName{{Schema: schema, Table: table}}
+	if !s.caseSensitive {
+		tbs[0] = TableName{Schema: strings.ToLower(schema), Table: strings.ToLower(table)}
+	}
 
 	tbs = s.whiteFilter(tbs)
 	tbs = s.blackFilter(tbs)
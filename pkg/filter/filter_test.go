@@ -55,3 +55,41 @@ func (t *testFilterSuite) TestFilter(c *C) {
 	c.Assert(filter.SkipSchemaAndTable("", "any"), IsFalse)
 	c.Assert(filter.SkipSchemaAndTable("any", ""), IsTrue)
 }
+
+func (t *testFilterSuite) TestCompilePattern(c *C) {
+	re, err := CompilePattern("Table")
+	c.Assert(err, IsNil)
+	c.Assert(re.MatchString("table"), IsTrue)
+	c.Assert(re.MatchString("table_1"), IsFalse)
+
+	re, err = CompilePattern("~^table_\\d+$")
+	c.Assert(err, IsNil)
+	c.Assert(re.MatchString("TABLE_1"), IsTrue)
+	c.Assert(re.MatchString("table_a"), IsFalse)
+
+	_, err = CompilePattern("~table_(")
+	c.Assert(err, NotNil)
+}
+
+func (t *testFilterSuite) TestCaseSensitivity(c *C) {
+	doDBs := []string{"DB1", "~^Log_"}
+	doTables := []TableName{{"db2", "T"}}
+	ignoreTables := []TableName{{"DB1", "~^tmp"}}
+
+	// the names are matched across case by default
+	filter := NewFilter(nil, ignoreTables, doDBs, doTables)
+	c.Assert(filter.SkipSchemaAndTable("db1", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("LOG_2019", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("DB2", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("db1", "TMP_1"), IsTrue)
+
+	filter = NewCaseSensitiveFilter(nil, ignoreTables, doDBs, doTables)
+	c.Assert(filter.SkipSchemaAndTable("db1", "t"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("DB1", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("LOG_2019", "t"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("Log_2019", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("DB2", "T"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("db2", "T"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("DB1", "TMP_1"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("DB1", "tmp_1"), IsTrue)
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// BreakerState is the state of CircuitBreaker
+type BreakerState int32
+
+// BreakerState values
+const (
+	// BreakerClosed means the downstream is executed normally
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means the executions are paused until the cool-down passes
+	BreakerOpen
+	// BreakerHalfOpen means only one execution is allowed to probe the downstream
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops executing against the downstream after `threshold` consecutive failures,
+// and pauses all executions for `coolDown`, then lets one execution probe the downstream,
+// it's closed again if the probe succeeds, or keeps open for another cool-down otherwise.
+// A nil *CircuitBreaker is valid and never opens.
+type CircuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+	onChange  func(BreakerState)
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openUntil time.Time
+	probing   bool
+	// closed and renewed every time the state changes
+	changed chan struct{}
+}
+
+// NewCircuitBreaker creates a CircuitBreaker, onChange is called with the new state
+// every time the state changes if it's not nil.
+func NewCircuitBreaker(threshold int, coolDown time.Duration, onChange func(BreakerState)) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		onChange:  onChange,
+		changed:   make(chan struct{}),
+	}
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// wait blocks until the execution is allowed, every successful wait must be followed by a record.
+func (b *CircuitBreaker) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		var timeout <-chan time.Time
+		switch b.state {
+		case BreakerClosed:
+			b.mu.Unlock()
+			return nil
+		case BreakerOpen:
+			remain := time.Until(b.openUntil)
+			if remain <= 0 {
+				b.setState(BreakerHalfOpen)
+				b.probing = true
+				b.mu.Unlock()
+				return nil
+			}
+			timeout = time.After(remain)
+		case BreakerHalfOpen:
+			if !b.probing {
+				b.probing = true
+				b.mu.Unlock()
+				return nil
+			}
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-timeout:
+		}
+	}
+}
+
+// record updates the breaker with the result of an execution.
+func (b *CircuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		b.probing = false
+		if b.state != BreakerClosed {
+			log.Info("downstream recovered, close the circuit breaker")
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		b.open(err)
+	case BreakerClosed:
+		if b.failures >= b.threshold {
+			b.open(err)
+		}
+	}
+}
+
+func (b *CircuitBreaker) open(err error) {
+	log.Warn("too many failures of downstream, open the circuit breaker",
+		zap.Int("failures", b.failures), zap.Duration("cool-down", b.coolDown), zap.Error(err))
+	b.openUntil = time.Now().Add(b.coolDown)
+	b.setState(BreakerOpen)
+}
+
+// setState must be called with b.mu held
+func (b *CircuitBreaker) setState(state BreakerState) {
+	b.state = state
+	close(b.changed)
+	b.changed = make(chan struct{})
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type breakerSuite struct{}
+
+var _ = check.Suite(&breakerSuite{})
+
+func (s *breakerSuite) TestNilBreaker(c *check.C) {
+	var b *CircuitBreaker
+	c.Assert(b.wait(context.Background()), check.IsNil)
+	b.record(errors.New("fail"))
+	c.Assert(b.State(), check.Equals, BreakerClosed)
+}
+
+func (s *breakerSuite) TestTripAndRecover(c *check.C) {
+	var states []BreakerState
+	coolDown := 100 * time.Millisecond
+	b := NewCircuitBreaker(3, coolDown, func(state BreakerState) {
+		states = append(states, state)
+	})
+	ctx := context.Background()
+	fail := errors.New("downstream is down")
+
+	// a success resets the consecutive failures
+	for i := 0; i < 2; i++ {
+		c.Assert(b.wait(ctx), check.IsNil)
+		b.record(fail)
+	}
+	b.record(nil)
+	c.Assert(b.State(), check.Equals, BreakerClosed)
+
+	for i := 0; i < 3; i++ {
+		c.Assert(b.wait(ctx), check.IsNil)
+		b.record(fail)
+	}
+	c.Assert(b.State(), check.Equals, BreakerOpen)
+
+	// no execution is allowed until the cool-down passes
+	timeoutCtx, cancel := context.WithTimeout(ctx, coolDown/4)
+	c.Assert(b.wait(timeoutCtx), check.Equals, context.DeadlineExceeded)
+	cancel()
+
+	start := time.Now()
+	c.Assert(b.wait(ctx), check.IsNil)
+	c.Assert(time.Since(start), check.Greater, coolDown/2)
+	c.Assert(b.State(), check.Equals, BreakerHalfOpen)
+
+	// the failed probe opens the breaker again
+	b.record(fail)
+	c.Assert(b.State(), check.Equals, BreakerOpen)
+
+	c.Assert(b.wait(ctx), check.IsNil)
+	c.Assert(b.State(), check.Equals, BreakerHalfOpen)
+	b.record(nil)
+	c.Assert(b.State(), check.Equals, BreakerClosed)
+
+	c.Assert(states, check.DeepEquals, []BreakerState{
+		BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed,
+	})
+}
+
+func (s *breakerSuite) TestOnlyOneProbe(c *check.C) {
+	b := NewCircuitBreaker(1, 10*time.Millisecond, nil)
+	ctx := context.Background()
+	b.record(errors.New("fail"))
+	c.Assert(b.State(), check.Equals, BreakerOpen)
+
+	c.Assert(b.wait(ctx), check.IsNil)
+	c.Assert(b.State(), check.Equals, BreakerHalfOpen)
+
+	allowed := make(chan struct{})
+	go func() {
+		if b.wait(ctx) == nil {
+			close(allowed)
+		}
+	}()
+
+	select {
+	case <-allowed:
+		c.Fatal("only one probe should be allowed when the breaker is half-open")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.record(nil)
+	select {
+	case <-allowed:
+	case <-time.After(time.Second):
+		c.Fatal("the execution should be allowed after the breaker is closed")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+)
+
+// BulkInsertPolicy applies the bursts of inserts, like the ones derived from LOAD DATA, with a larger batch size.
+// The binlog doesn't tell the inserts of LOAD DATA from others, so the DMLs applied together are taken as a burst
+// if they're all inserts and there're at least MinRows of them. They're applied in the statements of BatchSize rows
+// instead of the batch size of loader. It's disabled if MinRows is 0.
+type BulkInsertPolicy struct {
+	MinRows   int
+	BatchSize int
+}
+
+func checkBulkInsertPolicy(policy BulkInsertPolicy) error {
+	if policy.MinRows < 0 {
+		return errors.Errorf("invalid min rows %d of bulk insert policy, must not be negative", policy.MinRows)
+	}
+	if policy.MinRows > 0 && policy.BatchSize <= 0 {
+		return errors.Errorf("invalid batch size %d of bulk insert policy, must be positive", policy.BatchSize)
+	}
+	return nil
+}
+
+// MaxBulkInsertRows returns the max MinRows of the bulk insert policy which may take effect, the DMLs applied
+// together are flushed once there're batchSize * workerCount * execLimitMultiple of them.
+func MaxBulkInsertRows(batchSize, workerCount int) int {
+	return batchSize * workerCount * execLimitMultiple
+}
+
+// isBurst returns whether dmls are a burst of inserts
+func (p BulkInsertPolicy) isBurst(dmls []*DML) bool {
+	if p.MinRows == 0 || len(dmls) < p.MinRows {
+		return false
+	}
+	for _, dml := range dmls {
+		if dml.Tp != InsertDMLType {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+)
+
+type bulkInsertSuite struct{}
+
+var _ = check.Suite(&bulkInsertSuite{})
+
+func newBulkInsertDMLs(tp DMLType, n int) []*DML {
+	dmls := make([]*DML, 0, n)
+	for i := 0; i < n; i++ {
+		dmls = append(dmls, &DML{Database: "test", Table: "t", Tp: tp, Values: map[string]interface{}{"id": i}})
+	}
+	return dmls
+}
+
+func (s *bulkInsertSuite) TestIsBurst(c *check.C) {
+	policy := BulkInsertPolicy{MinRows: 3, BatchSize: 100}
+	c.Assert(policy.isBurst(newBulkInsertDMLs(InsertDMLType, 3)), check.IsTrue)
+	c.Assert(policy.isBurst(newBulkInsertDMLs(InsertDMLType, 2)), check.IsFalse)
+	c.Assert(policy.isBurst(newBulkInsertDMLs(UpdateDMLType, 3)), check.IsFalse)
+
+	mixed := append(newBulkInsertDMLs(InsertDMLType, 3), newBulkInsertDMLs(DeleteDMLType, 1)...)
+	c.Assert(policy.isBurst(mixed), check.IsFalse)
+
+	// disabled by default
+	c.Assert(BulkInsertPolicy{}.isBurst(newBulkInsertDMLs(InsertDMLType, 100)), check.IsFalse)
+}
+
+func (s *bulkInsertSuite) TestBulkInsertPolicyOfLoader(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	_, err = NewLoader(db, BulkInsert(BulkInsertPolicy{MinRows: -1}))
+	c.Assert(err, check.ErrorMatches, "invalid min rows -1 of bulk insert policy, must not be negative")
+	_, err = NewLoader(db, BulkInsert(BulkInsertPolicy{MinRows: 100}))
+	c.Assert(err, check.ErrorMatches, "invalid batch size 0 of bulk insert policy, must be positive")
+
+	l, err := NewLoader(db, BulkInsert(BulkInsertPolicy{BatchSize: -1}))
+	c.Assert(err, check.IsNil)
+	c.Assert(l.(*loaderImpl).bulkInsert.isBurst(newBulkInsertDMLs(InsertDMLType, 1)), check.IsFalse)
+}
+
+func (s *bulkInsertSuite) TestApplyBurstOfInserts(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	l, err := NewLoader(db, BatchSize(1), BulkInsert(BulkInsertPolicy{MinRows: 3, BatchSize: 3}))
+	c.Assert(err, check.IsNil)
+	loader := l.(*loaderImpl)
+	loader.tableInfos.Store(quoteSchema("test", "t"), &tableInfo{
+		columns:    []string{"id"},
+		primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+	})
+
+	// simulating a bulk-insert burst, the inserts are applied in one statement though the batch size is 1,
+	// the rows merged by primary key are in no particular order
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`t`(`id`) VALUES (?),(?),(?)")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	c.Assert(loader.execDMLs(newBulkInsertDMLs(InsertDMLType, 3)), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the inserts fewer than the min rows are applied in the batch size of loader
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`t`(`id`) VALUES (?)")).
+		WithArgs(0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(loader.execDMLs(newBulkInsertDMLs(InsertDMLType, 1)), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
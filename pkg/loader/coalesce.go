@@ -0,0 +1,113 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// coalesceDMLs collapses the DMLs of one txn writing the same row into the net effect,
+// the DMLs must be prepared.
+// insert + update -> insert
+// insert + delete -> -
+// update + update -> update
+// update + delete -> delete
+// delete + insert -> update
+// insert + insert -> insert  invalid
+// update + insert -> insert  invalid
+// delete + update -> update  invalid
+// delete + delete -> delete  invalid
+// The update changing the primary key is taken as delete + insert.
+// Only the DMLs of the tables whose only unique key is the primary key are coalesced, the rows
+// of such tables are independent, so the collapsed DML can be applied at the position of the first one.
+// The DMLs of other tables are kept as they are, reordering them may violate the other unique keys.
+func coalesceDMLs(dmls []*DML) []*DML {
+	// the collapsed DML is nil if it's collapsed to nothing
+	var res []*DML
+	rows := make(map[string]int)
+	for _, dml := range dmls {
+		if !canCoalesce(dml) {
+			res = append(res, dml)
+			continue
+		}
+
+		for _, dml := range splitKeyUpdate(dml) {
+			key := dml.TableName() + dml.formatKey()
+			i, ok := rows[key]
+			if !ok {
+				rows[key] = len(res)
+				res = append(res, dml)
+				continue
+			}
+			res[i] = coalesceDML(res[i], dml)
+		}
+	}
+
+	coalesced := res[:0]
+	for _, dml := range res {
+		if dml != nil {
+			coalesced = append(coalesced, dml)
+		}
+	}
+	return coalesced
+}
+
+func canCoalesce(dml *DML) bool {
+	return dml.info.primaryKey != nil && len(dml.info.uniqueKeys) == 1
+}
+
+// splitKeyUpdate splits the update changing the primary key into delete + insert
+func splitKeyUpdate(dml *DML) []*DML {
+	if dml.Tp != UpdateDMLType || formatKey(dml.primaryKeyValues()) == formatKey(dml.oldPrimaryKeyValues()) {
+		return []*DML{dml}
+	}
+
+	deleteDML := *dml
+	deleteDML.Tp = DeleteDMLType
+	deleteDML.Values = dml.OldValues
+	deleteDML.OldValues = nil
+
+	insertDML := *dml
+	insertDML.Tp = InsertDMLType
+	insertDML.OldValues = nil
+	return []*DML{&deleteDML, &insertDML}
+}
+
+// coalesceDML returns the net effect of prev followed by dml writing the same row,
+// prev is nil if the previous DMLs are collapsed to nothing.
+func coalesceDML(prev *DML, dml *DML) *DML {
+	if prev == nil {
+		return dml
+	}
+
+	res := *dml
+	switch {
+	case prev.Tp == InsertDMLType && dml.Tp == UpdateDMLType:
+		res.Tp = InsertDMLType
+		res.OldValues = nil
+	case prev.Tp == InsertDMLType && dml.Tp == DeleteDMLType:
+		return nil
+	case prev.Tp == UpdateDMLType && dml.Tp == UpdateDMLType:
+		res.OldValues = prev.OldValues
+	case prev.Tp == UpdateDMLType && dml.Tp == DeleteDMLType:
+		res.Values = prev.OldValues
+	case prev.Tp == DeleteDMLType && dml.Tp == InsertDMLType:
+		res.Tp = UpdateDMLType
+		res.OldValues = prev.Values
+	default:
+		log.Warn("abnormal DMLs writing the same row in txn, just remain the latter", zap.Stringer("before", prev), zap.Stringer("after", dml))
+	}
+	return &res
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	check "github.com/pingcap/check"
+)
+
+type coalesceSuite struct{}
+
+var _ = check.Suite(&coalesceSuite{})
+
+var coalesceTableInfo = &tableInfo{
+	columns:    []string{"id", "v"},
+	primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+	uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}},
+}
+
+func coalesceRow(id, v int) map[string]interface{} {
+	return map[string]interface{}{"id": id, "v": v}
+}
+
+func coalesceInsert(id, v int) *DML {
+	return &DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: coalesceRow(id, v), info: coalesceTableInfo}
+}
+
+func coalesceUpdate(oldID, oldV, id, v int) *DML {
+	return &DML{Database: "test", Table: "t", Tp: UpdateDMLType, Values: coalesceRow(id, v), OldValues: coalesceRow(oldID, oldV), info: coalesceTableInfo}
+}
+
+func coalesceDelete(id, v int) *DML {
+	return &DML{Database: "test", Table: "t", Tp: DeleteDMLType, Values: coalesceRow(id, v), info: coalesceTableInfo}
+}
+
+func (s *coalesceSuite) TestCollapse(c *check.C) {
+	testCases := []struct {
+		dmls     []*DML
+		expected []*DML
+	}{
+		// insert + update -> insert
+		{
+			[]*DML{coalesceInsert(1, 1), coalesceUpdate(1, 1, 1, 2)},
+			[]*DML{coalesceInsert(1, 2)},
+		},
+		// insert + delete -> nothing
+		{
+			[]*DML{coalesceInsert(1, 1), coalesceDelete(1, 1)},
+			[]*DML{},
+		},
+		// update + update -> update
+		{
+			[]*DML{coalesceUpdate(1, 1, 1, 2), coalesceUpdate(1, 2, 1, 3)},
+			[]*DML{coalesceUpdate(1, 1, 1, 3)},
+		},
+		// update + delete -> delete
+		{
+			[]*DML{coalesceUpdate(1, 1, 1, 2), coalesceDelete(1, 2)},
+			[]*DML{coalesceDelete(1, 1)},
+		},
+		// delete + insert -> update
+		{
+			[]*DML{coalesceDelete(1, 1), coalesceInsert(1, 2)},
+			[]*DML{coalesceUpdate(1, 1, 1, 2)},
+		},
+		// insert + update + delete -> nothing, then insert again
+		{
+			[]*DML{coalesceInsert(1, 1), coalesceUpdate(1, 1, 1, 2), coalesceDelete(1, 2), coalesceInsert(1, 3)},
+			[]*DML{coalesceInsert(1, 3)},
+		},
+		// the update changing the primary key is taken as delete + insert
+		{
+			[]*DML{coalesceInsert(1, 1), coalesceUpdate(1, 1, 2, 1), coalesceUpdate(2, 1, 3, 1)},
+			[]*DML{coalesceInsert(3, 1)},
+		},
+		{
+			[]*DML{coalesceUpdate(1, 1, 2, 1), coalesceUpdate(2, 1, 2, 2)},
+			[]*DML{coalesceDelete(1, 1), coalesceInsert(2, 2)},
+		},
+		// the DMLs of different rows are kept in order
+		{
+			[]*DML{coalesceInsert(1, 1), coalesceInsert(2, 1), coalesceUpdate(1, 1, 1, 2), coalesceDelete(3, 1)},
+			[]*DML{coalesceInsert(1, 2), coalesceInsert(2, 1), coalesceDelete(3, 1)},
+		},
+	}
+
+	for i, tc := range testCases {
+		c.Assert(coalesceDMLs(tc.dmls), check.DeepEquals, tc.expected, check.Commentf("case %d", i))
+	}
+}
+
+func (s *coalesceSuite) TestKeepTablesWithUniqueKeys(c *check.C) {
+	info := &tableInfo{
+		columns:    []string{"id", "v"},
+		primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}, {"uk", []string{"v"}}},
+	}
+	dmls := []*DML{coalesceInsert(1, 1), coalesceUpdate(1, 1, 1, 2)}
+	for _, dml := range dmls {
+		dml.info = info
+	}
+	c.Assert(coalesceDMLs(dmls), check.DeepEquals, dmls)
+
+	noKey := &tableInfo{columns: []string{"id", "v"}}
+	dmls = []*DML{coalesceInsert(1, 1), coalesceDelete(1, 1)}
+	for _, dml := range dmls {
+		dml.info = noKey
+	}
+	c.Assert(coalesceDMLs(dmls), check.DeepEquals, dmls)
+}
+
+func (s *coalesceSuite) TestCoalesceTxn(c *check.C) {
+	txn := &Txn{DMLs: []*DML{coalesceInsert(1, 1), coalesceUpdate(1, 1, 1, 2)}}
+	// the table info is got by coalescing
+	for _, dml := range txn.DMLs {
+		dml.info = nil
+	}
+
+	ld := &loaderImpl{}
+	ld.tableInfos.Store(quoteSchema("test", "t"), coalesceTableInfo)
+	c.Assert(ld.coalesceTxn(txn), check.IsNil)
+	c.Assert(txn.DMLs, check.HasLen, 2)
+
+	ld.coalesce = true
+	c.Assert(ld.coalesceTxn(txn), check.IsNil)
+	c.Assert(txn.DMLs, check.HasLen, 1)
+	c.Assert(txn.DMLs[0].Tp, check.Equals, InsertDMLType)
+	c.Assert(txn.DMLs[0].Values, check.DeepEquals, coalesceRow(1, 2))
+}
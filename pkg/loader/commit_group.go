@@ -0,0 +1,116 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+)
+
+// CommitGroupPolicy groups the independent small txns into one downstream transaction to amortize the commit cost.
+// The txns are accumulated until there're MaxTxns of them or Window has passed since the first one of the group,
+// whichever comes first, and the group is committed once the input is drained if Window is 0. All the DMLs of the
+// group are applied in one downstream transaction, which is retried as a whole, and the txns are reported successful
+// only after it commits. The upstream txns lose their own atomicity boundaries in downstream, the group is applied
+// or rolled back as a whole. A DDL commits the group pending before it. It's disabled if both of them are 0.
+type CommitGroupPolicy struct {
+	MaxTxns int
+	Window  time.Duration
+}
+
+func checkCommitGroupPolicy(policy CommitGroupPolicy) error {
+	if policy.MaxTxns < 0 {
+		return errors.Errorf("invalid max txns %d of commit group policy, must not be negative", policy.MaxTxns)
+	}
+	if policy.Window < 0 {
+		return errors.Errorf("invalid window %s of commit group policy, must not be negative", policy.Window)
+	}
+	return nil
+}
+
+func (p CommitGroupPolicy) enabled() bool {
+	return p.MaxTxns > 0 || p.Window > 0
+}
+
+// runGrouped applies the txns in the groups of commitGroup until input is closed or meeting any error
+func (s *loaderImpl) runGrouped(txnManager *txnManager, input chan *Txn) error {
+	batch := fNewBatchManager(s)
+
+	var (
+		timer *time.Timer
+		// fired after the window since the first txn of the group, nil if there's no window running
+		window <-chan time.Time
+	)
+	stopWindow := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, window = nil, nil
+		}
+	}
+	defer stopWindow()
+
+	for {
+		// the group may be committed by the DDL or the DML limit of batch
+		if len(batch.txns) == 0 {
+			stopWindow()
+		} else if timer == nil && s.commitGroup.Window > 0 {
+			timer = time.NewTimer(s.commitGroup.Window)
+			window = timer.C
+		}
+
+		var (
+			txn *Txn
+			ok  bool
+		)
+		if len(batch.txns) > 0 && s.commitGroup.Window == 0 {
+			select {
+			case txn, ok = <-input:
+			default:
+				if err := batch.execAccumulatedDMLs(); err != nil {
+					return errors.Trace(err)
+				}
+				continue
+			}
+		} else {
+			select {
+			case txn, ok = <-input:
+			case <-window:
+				if err := batch.execAccumulatedDMLs(); err != nil {
+					return errors.Trace(err)
+				}
+				continue
+			}
+		}
+		if !ok {
+			log.Info("Loader closed, quit running")
+			return errors.Trace(batch.execAccumulatedDMLs())
+		}
+
+		s.metricsInputTxn(txn)
+		txnManager.pop(txn)
+		if err := s.coalesceTxn(txn); err != nil {
+			return errors.Trace(err)
+		}
+		if err := batch.put(txn); err != nil {
+			return errors.Trace(err)
+		}
+		if s.commitGroup.MaxTxns > 0 && len(batch.txns) >= s.commitGroup.MaxTxns {
+			if err := batch.execAccumulatedDMLs(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+}
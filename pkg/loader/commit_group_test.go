@@ -0,0 +1,159 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+)
+
+type commitGroupSuite struct{}
+
+var _ = check.Suite(&commitGroupSuite{})
+
+func (s *commitGroupSuite) TestCommitGroupPolicyOfLoader(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	_, err = NewLoader(db, CommitGroup(CommitGroupPolicy{MaxTxns: -1}))
+	c.Assert(err, check.ErrorMatches, "invalid max txns -1 of commit group policy, must not be negative")
+	_, err = NewLoader(db, CommitGroup(CommitGroupPolicy{Window: -time.Second}))
+	c.Assert(err, check.ErrorMatches, "invalid window -1s of commit group policy, must not be negative")
+	_, err = NewLoader(db, CommitGroup(CommitGroupPolicy{MaxTxns: 10}), RelaxedOrder(true))
+	c.Assert(err, check.ErrorMatches, "commit group can't be used with relaxed order.*")
+
+	l, err := NewLoader(db)
+	c.Assert(err, check.IsNil)
+	c.Assert(l.(*loaderImpl).commitGroup.enabled(), check.IsFalse)
+}
+
+// newCommitGroupLoader returns a loader applying the txns to the mocked downstream in groups of policy,
+// and the channel of the commit ts of the txns reported successful
+func newCommitGroupLoader(c *check.C, policy CommitGroupPolicy) (*loaderImpl, sqlmock.Sqlmock, <-chan int64, <-chan error) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	l, err := NewLoader(db, CommitGroup(policy))
+	c.Assert(err, check.IsNil)
+	loader := l.(*loaderImpl)
+	loader.tableInfos.Store(quoteSchema("test", "t"), &tableInfo{
+		columns:    []string{"id"},
+		primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- loader.Run()
+	}()
+	successes := make(chan int64, 64)
+	go func() {
+		for txn := range loader.Successes() {
+			successes <- txn.Metadata.(int64)
+		}
+		close(successes)
+	}()
+	return loader, mock, successes, errCh
+}
+
+func commitGroupTxn(commitTS int64) *Txn {
+	return &Txn{
+		DMLs:     []*DML{{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": commitTS}}},
+		Metadata: commitTS,
+	}
+}
+
+func expectCommitGroup(mock sqlmock.Sqlmock, commitTS ...int64) {
+	mock.ExpectBegin()
+	for _, ts := range commitTS {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`t`(`id`) VALUES(?)")).WithArgs(ts).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func (s *commitGroupSuite) TestGroupByCount(c *check.C) {
+	// the window is long enough to group the txns only by the count
+	loader, mock, successes, errCh := newCommitGroupLoader(c, CommitGroupPolicy{MaxTxns: 3, Window: time.Hour})
+
+	// 7 txns are committed in 3 downstream transactions, the last group is committed on close
+	expectCommitGroup(mock, 1, 2, 3)
+	expectCommitGroup(mock, 4, 5, 6)
+	expectCommitGroup(mock, 7)
+	for ts := int64(1); ts <= 7; ts++ {
+		loader.Input() <- commitGroupTxn(ts)
+	}
+	close(loader.input)
+	c.Assert(<-errCh, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	var reported []int64
+	for ts := range successes {
+		reported = append(reported, ts)
+	}
+	c.Assert(reported, check.DeepEquals, []int64{1, 2, 3, 4, 5, 6, 7})
+}
+
+func (s *commitGroupSuite) TestGroupByWindow(c *check.C) {
+	loader, mock, successes, errCh := newCommitGroupLoader(c, CommitGroupPolicy{Window: 100 * time.Millisecond})
+
+	expectCommitGroup(mock, 1, 2, 3)
+	start := time.Now()
+	for ts := int64(1); ts <= 3; ts++ {
+		loader.Input() <- commitGroupTxn(ts)
+	}
+
+	// the txns are reported only after the group commits at the end of the window,
+	// so the checkpoint advances to the max commit ts of the group at once
+	var reported []int64
+	for len(reported) < 3 {
+		select {
+		case ts := <-successes:
+			reported = append(reported, ts)
+		case <-time.After(5 * time.Second):
+			c.Fatal("the group isn't committed after the window")
+		}
+	}
+	c.Assert(time.Since(start) >= 100*time.Millisecond, check.IsTrue)
+	c.Assert(reported, check.DeepEquals, []int64{1, 2, 3})
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	close(loader.input)
+	c.Assert(<-errCh, check.IsNil)
+}
+
+func (s *commitGroupSuite) TestDDLCommitsGroup(c *check.C) {
+	loader, mock, successes, errCh := newCommitGroupLoader(c, CommitGroupPolicy{MaxTxns: 10, Window: time.Hour})
+
+	expectCommitGroup(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^" + regexp.QuoteMeta("alter table t comment 'x'") + "$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	loader.Input() <- commitGroupTxn(1)
+	loader.Input() <- commitGroupTxn(2)
+	loader.Input() <- &Txn{DDL: &DDL{Database: "test", Table: "t", SQL: "alter table t comment 'x'"}, Metadata: int64(3)}
+
+	for _, expected := range []int64{1, 2, 3} {
+		select {
+		case ts := <-successes:
+			c.Assert(ts, check.Equals, expected)
+		case <-time.After(5 * time.Second):
+			c.Fatal("the group isn't committed before the DDL")
+		}
+	}
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	close(loader.input)
+	c.Assert(<-errCh, check.IsNil)
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/log"
+	tmysql "github.com/pingcap/parser/mysql"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// the count of consecutive successes to grow the concurrency by one after it's reduced
+var concurrencyGrowSuccesses = 64
+
+// concurrencyLimiter limits the count of concurrent executions against downstream.
+// The limit is halved every time downstream rejects the connection by too many connections,
+// and grows back by one after every concurrencyGrowSuccesses consecutive successes until it reaches max.
+// A nil *concurrencyLimiter is valid and never limits.
+type concurrencyLimiter struct {
+	max      int
+	onChange func(limit int)
+
+	mu        sync.Mutex
+	limit     int
+	running   int
+	successes int
+	// closed and renewed every time an execution finishes
+	released chan struct{}
+}
+
+// newConcurrencyLimiter creates a concurrencyLimiter allowing max concurrent executions at most,
+// onChange is called with the new limit every time the limit changes if it's not nil.
+func newConcurrencyLimiter(max int, onChange func(limit int)) *concurrencyLimiter {
+	if max <= 0 {
+		max = 1
+	}
+	return &concurrencyLimiter{
+		max:      max,
+		limit:    max,
+		onChange: onChange,
+		released: make(chan struct{}),
+	}
+}
+
+// getLimit returns the current limit of concurrent executions
+func (l *concurrencyLimiter) getLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// acquire blocks until the execution is allowed, every successful acquire must be followed by a release.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		if l.running < l.limit {
+			l.running++
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// release updates the limit with the result of an execution.
+func (l *concurrencyLimiter) release(err error) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.running--
+	close(l.released)
+	l.released = make(chan struct{})
+
+	switch {
+	case isTooManyConnections(err):
+		l.successes = 0
+		if l.limit > 1 {
+			l.setLimit(l.limit / 2)
+			log.Warn("too many connections of downstream, reduce the concurrency",
+				zap.Int("concurrency", l.limit), zap.Error(err))
+		}
+	case err == nil:
+		if l.limit >= l.max {
+			return
+		}
+		l.successes++
+		if l.successes >= concurrencyGrowSuccesses {
+			l.successes = 0
+			l.setLimit(l.limit + 1)
+			log.Info("grow the concurrency of downstream", zap.Int("concurrency", l.limit))
+		}
+	}
+}
+
+// setLimit must be called with l.mu held
+func (l *concurrencyLimiter) setLimit(limit int) {
+	l.limit = limit
+	if l.onChange != nil {
+		l.onChange(limit)
+	}
+}
+
+func isTooManyConnections(err error) bool {
+	if err == nil {
+		return false
+	}
+	code, ok := pkgsql.GetSQLErrCode(err)
+	return ok && code == tmysql.ErrConCount
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type concurrencySuite struct{}
+
+var _ = check.Suite(&concurrencySuite{})
+
+var errTooManyConnections = &mysql.MySQLError{Number: 1040, Message: "Too many connections"}
+
+func (s *concurrencySuite) TestNilLimiter(c *check.C) {
+	var l *concurrencyLimiter
+	c.Assert(l.acquire(context.Background()), check.IsNil)
+	l.release(errTooManyConnections)
+}
+
+func (s *concurrencySuite) TestShrinkAndGrow(c *check.C) {
+	origGrow := concurrencyGrowSuccesses
+	concurrencyGrowSuccesses = 3
+	defer func() { concurrencyGrowSuccesses = origGrow }()
+
+	var limits []int
+	l := newConcurrencyLimiter(4, func(limit int) { limits = append(limits, limit) })
+	ctx := context.Background()
+	exec := func(err error) {
+		c.Assert(l.acquire(ctx), check.IsNil)
+		l.release(err)
+	}
+
+	// the other errors don't change the limit
+	exec(errors.New("other error"))
+	c.Assert(l.getLimit(), check.Equals, 4)
+
+	for i := 0; i < 3; i++ {
+		exec(errTooManyConnections)
+	}
+	c.Assert(l.getLimit(), check.Equals, 1)
+
+	// a failure resets the consecutive successes
+	exec(nil)
+	exec(nil)
+	exec(errTooManyConnections)
+	c.Assert(l.getLimit(), check.Equals, 1)
+
+	for i := 0; i < 9; i++ {
+		exec(nil)
+	}
+	c.Assert(l.getLimit(), check.Equals, 4)
+	// it never grows beyond the max
+	for i := 0; i < 3; i++ {
+		exec(nil)
+	}
+	c.Assert(l.getLimit(), check.Equals, 4)
+	c.Assert(limits, check.DeepEquals, []int{2, 1, 2, 3, 4})
+}
+
+func (s *concurrencySuite) TestAcquireBlocksAtLimit(c *check.C) {
+	l := newConcurrencyLimiter(2, nil)
+	ctx := context.Background()
+	c.Assert(l.acquire(ctx), check.IsNil)
+	c.Assert(l.acquire(ctx), check.IsNil)
+	// the limit is reduced to 1 while 2 executions are running
+	l.release(errTooManyConnections)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	c.Assert(l.acquire(timeoutCtx), check.Equals, context.DeadlineExceeded)
+	cancel()
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.acquire(ctx)
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("acquire should block until the running execution finishes")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.release(nil)
+	select {
+	case err := <-acquired:
+		c.Assert(err, check.IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("acquire should return after the running execution finishes")
+	}
+}
+
+func (s *concurrencySuite) TestExecutorReducesConcurrency(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	l := newConcurrencyLimiter(8, nil)
+	e := newExecutor(db).withLimiter(l)
+
+	// the execution rejected by too many connections is retried with less concurrency
+	mock.ExpectBegin().WillReturnError(errTooManyConnections)
+	mock.ExpectBegin().WillReturnError(errTooManyConnections)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `test`.`t`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       DeleteDMLType,
+		Values:   map[string]interface{}{"id": 1},
+		info:     schedTableInfo,
+	}
+	err = e.singleExecRetry(context.Background(), []*DML{dml}, false, 3, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(l.getLimit(), check.Equals, 2)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/terror"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+)
+
+// the retry count of executing a single txn to find out the failed one after a batch fails permanently
+const deadLetterRetryCount = 3
+
+// DeadLetterFunc receives the txn failing permanently to apply to downstream with the error,
+// the txn is skipped and reported as success if it returns nil, or the loader quits with the error otherwise.
+type DeadLetterFunc func(txn *Txn, err error) error
+
+// permanentErrorCodes mean the statement itself is rejected by downstream because of the data or the schema,
+// the others, like the TiKV server busy or the write conflict errors of TiDB, may succeed after retrying.
+var permanentErrorCodes = map[terror.ErrCode]struct{}{
+	tmysql.ErrParse:               {},
+	tmysql.ErrBadNull:             {},
+	tmysql.ErrBadField:            {},
+	tmysql.ErrDupEntry:            {},
+	tmysql.ErrNoSuchTable:         {},
+	tmysql.ErrWarnDataOutOfRange:  {},
+	tmysql.ErrTruncatedWrongValue: {},
+	tmysql.ErrDataTooLong:         {},
+	tmysql.ErrNoReferencedRow2:    {},
+}
+
+// isPermanentError returns true if err means the statement is rejected by downstream,
+// so executing it again will fail too, as opposed to the errors that downstream is unavailable.
+func isPermanentError(err error) bool {
+	code, ok := pkgsql.GetSQLErrCode(err)
+	if !ok {
+		return false
+	}
+	_, ok = permanentErrorCodes[code]
+	return ok
+}
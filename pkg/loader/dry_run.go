@@ -0,0 +1,70 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sort"
+)
+
+// Statement is a statement generated to apply a Txn to downstream
+type Statement struct {
+	Database string
+	Table    string
+	SQL      string
+	Args     []interface{}
+}
+
+// DryRun returns the statements generated to apply txn without executing them,
+// in safe mode they're the statements executed in safe mode.
+// The downstream isn't accessed, so there's no unique key known and all the columns
+// of the DML are used to identify the row.
+func DryRun(txn *Txn, safeMode bool) []Statement {
+	if txn.isDDL() {
+		return []Statement{{Database: txn.DDL.Database, Table: txn.DDL.Table, SQL: txn.DDL.SQL}}
+	}
+
+	var stmts []Statement
+	for _, dml := range txn.DMLs {
+		dml := *dml
+		if dml.info == nil {
+			dml.info = dryRunTableInfo(&dml)
+		}
+		for _, stmt := range genExecStmts(&dml, safeMode) {
+			stmts = append(stmts, Statement{
+				Database: dml.Database,
+				Table:    dml.Table,
+				SQL:      stmt.query,
+				Args:     stmt.args,
+			})
+		}
+	}
+	return stmts
+}
+
+// dryRunTableInfo returns the table info of the columns in dml in name order
+func dryRunTableInfo(dml *DML) *tableInfo {
+	seen := make(map[string]struct{})
+	var columns []string
+	for _, values := range []map[string]interface{}{dml.Values, dml.OldValues} {
+		for name := range values {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			columns = append(columns, name)
+		}
+	}
+	sort.Strings(columns)
+	return &tableInfo{columns: columns}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	check "github.com/pingcap/check"
+)
+
+type dryRunSuite struct{}
+
+var _ = check.Suite(&dryRunSuite{})
+
+func (s *dryRunSuite) TestDryRun(c *check.C) {
+	txn := &Txn{DMLs: []*DML{
+		{
+			Database: "test",
+			Table:    "t",
+			Tp:       InsertDMLType,
+			Values:   map[string]interface{}{"id": 1, "name": "a"},
+		},
+		{
+			Database:  "test",
+			Table:     "t",
+			Tp:        UpdateDMLType,
+			Values:    map[string]interface{}{"id": 1, "name": "b"},
+			OldValues: map[string]interface{}{"id": 1, "name": "a"},
+		},
+	}}
+
+	stmts := DryRun(txn, false)
+	c.Assert(stmts, check.DeepEquals, []Statement{
+		{Database: "test", Table: "t", SQL: "INSERT INTO `test`.`t`(`id`,`name`) VALUES(?,?)", Args: []interface{}{1, "a"}},
+		{Database: "test", Table: "t", SQL: "UPDATE `test`.`t` SET `id` = ?,`name` = ? WHERE `id` = ? AND `name` = ? LIMIT 1", Args: []interface{}{1, "b", 1, "a"}},
+	})
+	// the DMLs of txn aren't changed
+	c.Assert(txn.DMLs[0].info, check.IsNil)
+
+	stmts = DryRun(txn, true)
+	c.Assert(stmts, check.HasLen, 3)
+	c.Assert(stmts[0].SQL, check.Equals, "REPLACE INTO `test`.`t`(`id`,`name`) VALUES(?,?)")
+	c.Assert(stmts[1].SQL, check.Equals, "DELETE FROM `test`.`t` WHERE `id` = ? AND `name` = ? LIMIT 1")
+	c.Assert(stmts[1].Args, check.DeepEquals, []interface{}{1, "a"})
+	c.Assert(stmts[2].SQL, check.Equals, "REPLACE INTO `test`.`t`(`id`,`name`) VALUES(?,?)")
+	c.Assert(stmts[2].Args, check.DeepEquals, []interface{}{1, "b"})
+
+	ddl := NewDDLTxn("test", "t", "alter table t add column c int")
+	c.Assert(DryRun(ddl, false), check.DeepEquals, []Statement{
+		{Database: "test", Table: "t", SQL: "alter table t add column c int"},
+	})
+}
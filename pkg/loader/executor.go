@@ -18,10 +18,13 @@ import (
 	gosql "database/sql"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
@@ -34,6 +37,26 @@ type executor struct {
 	db                *gosql.DB
 	batchSize         int
 	queryHistogramVec *prometheus.HistogramVec
+
+	loopBackSyncInfo *loopbacksync.LoopBackSync
+	// the number of rows used in the mark table, we use different rows
+	// to avoid write conflict between concurrent transactions
+	markRowCount int
+	markCounter  uint32
+
+	ignoreErrorCodes ignoreErrorCodes
+	breaker          *CircuitBreaker
+	limiter          *concurrencyLimiter
+	stmtCache        *stmtCache
+	quote            pkgsql.IdentifierQuote
+	// the concurrency limits of the tables executed in bulk
+	tableConcurrencies *tableConcurrencies
+	lockedTablePolicy  string
+	retryPolicy        RetryPolicy
+	throttler          *throttler
+	logSampler         *util.LogSampler
+	// the session settings overridden while applying the DMLs of the tables
+	tableSessions *tableSessions
 }
 
 func newExecutor(db *gosql.DB) *executor {
@@ -55,9 +78,94 @@ func (e *executor) withQueryHistogramVec(queryHistogramVec *prometheus.Histogram
 	return e
 }
 
+func (e *executor) withLoopBackSyncInfo(info *loopbacksync.LoopBackSync, rowCount int) *executor {
+	e.loopBackSyncInfo = info
+	if rowCount <= 0 {
+		rowCount = 1
+	}
+	e.markRowCount = rowCount
+	return e
+}
+
+func (e *executor) withIgnoreErrorCodes(codes ignoreErrorCodes) *executor {
+	e.ignoreErrorCodes = codes
+	return e
+}
+
+func (e *executor) withBreaker(breaker *CircuitBreaker) *executor {
+	e.breaker = breaker
+	return e
+}
+
+func (e *executor) withLimiter(limiter *concurrencyLimiter) *executor {
+	e.limiter = limiter
+	return e
+}
+
+func (e *executor) withStmtCache(cache *stmtCache) *executor {
+	e.stmtCache = cache
+	return e
+}
+
+func (e *executor) withIdentifierQuote(quote pkgsql.IdentifierQuote) *executor {
+	e.quote = quote
+	return e
+}
+
+func (e *executor) withTableConcurrencies(concurrencies *tableConcurrencies) *executor {
+	e.tableConcurrencies = concurrencies
+	return e
+}
+
+func (e *executor) withTableSessions(sessions *tableSessions) *executor {
+	e.tableSessions = sessions
+	return e
+}
+
+func (e *executor) withLockedTablePolicy(policy string) *executor {
+	e.lockedTablePolicy = policy
+	return e
+}
+
+func (e *executor) withRetryPolicy(policy RetryPolicy) *executor {
+	e.retryPolicy = policy
+	return e
+}
+
+func (e *executor) withThrottler(throttler *throttler) *executor {
+	e.throttler = throttler
+	return e
+}
+
+func (e *executor) withLogSampler(sampler *util.LogSampler) *executor {
+	e.logSampler = sampler
+	return e
+}
+
+// guard executes fn only when the breaker and the concurrency limiter allow, and records the result to them.
+// fn is delayed by the throttler while downstream is overloaded.
+func (e *executor) guard(ctx context.Context, fn func() error) error {
+	if err := e.breaker.wait(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	if err := e.throttler.wait(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	if err := e.limiter.acquire(ctx); err != nil {
+		e.breaker.record(err)
+		return errors.Trace(err)
+	}
+	err := fn()
+	e.limiter.release(err)
+	e.breaker.record(err)
+	return err
+}
+
 func (e *executor) execTableBatchRetry(ctx context.Context, dmls []*DML, retryNum int, backoff time.Duration) error {
-	err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
-		return e.execTableBatch(ctx, dmls)
+	err := retryLockedTable(ctx, e.lockedTablePolicy, e.retryPolicy, e.logSampler, retryNum, backoff, func(context.Context) error {
+		return e.guard(ctx, func() error {
+			return e.execTableBatch(ctx, dmls)
+		})
 	})
 	return errors.Trace(err)
 }
@@ -66,6 +174,13 @@ func (e *executor) execTableBatchRetry(ctx context.Context, dmls []*DML, retryNu
 type tx struct {
 	*gosql.Tx
 	queryHistogramVec *prometheus.HistogramVec
+	logSampler        *util.LogSampler
+
+	sessions *tableSessions
+	// the session settings of the table applied currently, nil if they're the ones of the connection
+	session *TableSession
+	// whether the settings of the connection are saved to be restored
+	saved bool
 }
 
 // wrap of sql.Tx.Exec()
@@ -79,11 +194,23 @@ func (tx *tx) exec(query string, args ...interface{}) (gosql.Result, error) {
 	return res, err
 }
 
+// execStmt executes the prepared statement in tx
+func (tx *tx) execStmt(stmt *gosql.Stmt, args ...interface{}) (gosql.Result, error) {
+	start := time.Now()
+	// the statement is prepared on the connection of tx only once, and closed when tx finishes
+	res, err := tx.Tx.Stmt(stmt).Exec(args...)
+	if tx.queryHistogramVec != nil {
+		tx.queryHistogramVec.WithLabelValues("exec").Observe(time.Since(start).Seconds())
+	}
+
+	return res, err
+}
+
 func (tx *tx) autoRollbackExec(query string, args ...interface{}) (res gosql.Result, err error) {
 	res, err = tx.exec(query, args...)
 	if err != nil {
-		log.Error("Exec fail, will rollback", zap.String("query", query), zap.Reflect("args", args), zap.Error(err))
-		if rbErr := tx.Rollback(); rbErr != nil {
+		tx.logSampler.Error("Exec fail, will rollback", err, zap.String("query", query), zap.Reflect("args", args))
+		if rbErr := tx.rollback(); rbErr != nil {
 			log.Error("Auto rollback", zap.Error(rbErr))
 		}
 		err = errors.Trace(err)
@@ -91,8 +218,55 @@ func (tx *tx) autoRollbackExec(query string, args ...interface{}) (res gosql.Res
 	return
 }
 
-// wrap of sql.Tx.Commit()
+// useTableSession switches the session settings to the ones of the table before applying its DMLs,
+// tx is rolled back if it fails.
+func (tx *tx) useTableSession(schema string, table string) error {
+	session := tx.sessions.get(schema, table)
+	if session == tx.session {
+		return nil
+	}
+
+	sql, args := switchSessionSQL(session, !tx.saved)
+	if _, err := tx.autoRollbackExec(sql, args...); err != nil {
+		return errors.Annotatef(err, "switch the session settings of table %s", quoteSchema(schema, table))
+	}
+	tx.session = session
+	tx.saved = true
+	return nil
+}
+
+// restoreSession restores the session settings overridden by the table sessions,
+// so the connection is returned to the pool as it's.
+func (tx *tx) restoreSession() error {
+	if tx.session == nil {
+		return nil
+	}
+
+	sql, args := switchSessionSQL(nil, false)
+	if _, err := tx.exec(sql, args...); err != nil {
+		return errors.Annotate(err, "restore the session settings")
+	}
+	tx.session = nil
+	return nil
+}
+
+// rollback restores the session settings and rolls back tx
+func (tx *tx) rollback() error {
+	if err := tx.restoreSession(); err != nil {
+		log.Warn("failed to restore the session settings before rollback", zap.Error(err))
+	}
+	return tx.Tx.Rollback()
+}
+
+// wrap of sql.Tx.Commit(), the session settings are restored before committing
 func (tx *tx) commit() error {
+	if err := tx.restoreSession(); err != nil {
+		if rbErr := tx.Tx.Rollback(); rbErr != nil {
+			log.Error("Auto rollback", zap.Error(rbErr))
+		}
+		return errors.Trace(err)
+	}
+
 	start := time.Now()
 	err := tx.Tx.Commit()
 	if tx.queryHistogramVec != nil {
@@ -109,10 +283,22 @@ func (e *executor) begin() (*tx, error) {
 		return nil, errors.Trace(err)
 	}
 
-	return &tx{
+	tx := &tx{
 		Tx:                sqlTx,
 		queryHistogramVec: e.queryHistogramVec,
-	}, nil
+		logSampler:        e.logSampler,
+		sessions:          e.tableSessions,
+	}
+
+	if e.loopBackSyncInfo.Enabled() {
+		id := atomic.AddUint32(&e.markCounter, 1) % uint32(e.markRowCount)
+		_, err = tx.autoRollbackExec(loopbacksync.UpdateMarkSQL(e.quote), e.loopBackSyncInfo.ChannelID, id)
+		if err != nil {
+			return nil, errors.Annotate(err, "update mark table failed")
+		}
+	}
+
+	return tx, nil
 }
 
 func (e *executor) bulkDelete(deletes []*DML) error {
@@ -133,9 +319,17 @@ func (e *executor) bulkDelete(deletes []*DML) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if err := tx.useTableSession(deletes[0].Database, deletes[0].Table); err != nil {
+		return errors.Trace(err)
+	}
 	sql := sqls.String()
 	_, err = tx.autoRollbackExec(sql, argss...)
 	if err != nil {
+		if e.ignoreErrorCodes.match(err) {
+			// only skip the failed statements instead of the whole batch
+			e.logSampler.Warn("exec batch failed with ignored error, fall back to exec one by one", err)
+			return errors.Trace(e.singleExec(deletes, false))
+		}
 		return errors.Trace(err)
 	}
 
@@ -152,7 +346,7 @@ func (e *executor) bulkReplace(inserts []*DML) error {
 
 	var builder strings.Builder
 
-	cols := "(" + buildColumnList(info.columns) + ")"
+	cols := "(" + buildColumnList(inserts[0].quote, info.columns) + ")"
 	builder.WriteString("REPLACE INTO " + inserts[0].TableName() + cols + " VALUES ")
 
 	holder := fmt.Sprintf("(%s)", holderString(len(info.columns)))
@@ -174,8 +368,17 @@ func (e *executor) bulkReplace(inserts []*DML) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if err := tx.useTableSession(inserts[0].Database, inserts[0].Table); err != nil {
+		return errors.Trace(err)
+	}
 	_, err = tx.autoRollbackExec(builder.String(), args...)
 	if err != nil {
+		if e.ignoreErrorCodes.match(err) {
+			// only skip the failed statements instead of the whole batch,
+			// use safe mode to be the same as REPLACE
+			e.logSampler.Warn("exec batch failed with ignored error, fall back to exec one by one", err)
+			return errors.Trace(e.singleExec(inserts, true))
+		}
 		return errors.Trace(err)
 	}
 	err = tx.commit()
@@ -200,20 +403,23 @@ func (e *executor) execTableBatch(ctx context.Context, dmls []*DML) error {
 
 	log.Debug("merge dmls", zap.Reflect("dmls", dmls), zap.Reflect("merged", types))
 
+	// the dmls are of the same table
+	concurrency := e.tableConcurrencies.get(dmls[0].Database, dmls[0].Table)
+
 	if allDeletes, ok := types[DeleteDMLType]; ok {
-		if err := e.splitExecDML(ctx, allDeletes, e.bulkDelete); err != nil {
+		if err := e.splitExecDML(ctx, allDeletes, concurrency, e.bulkDelete); err != nil {
 			return errors.Trace(err)
 		}
 	}
 
 	if allInserts, ok := types[InsertDMLType]; ok {
-		if err := e.splitExecDML(ctx, allInserts, e.bulkReplace); err != nil {
+		if err := e.splitExecDML(ctx, allInserts, concurrency, e.bulkReplace); err != nil {
 			return errors.Trace(err)
 		}
 	}
 
 	if allUpdates, ok := types[UpdateDMLType]; ok {
-		if err := e.splitExecDML(ctx, allUpdates, e.bulkReplace); err != nil {
+		if err := e.splitExecDML(ctx, allUpdates, concurrency, e.bulkReplace); err != nil {
 			return errors.Trace(err)
 		}
 	}
@@ -221,13 +427,23 @@ func (e *executor) execTableBatch(ctx context.Context, dmls []*DML) error {
 	return nil
 }
 
-// splitExecDML split dmls to size of e.batchSize and call exec concurrently
-func (e *executor) splitExecDML(ctx context.Context, dmls []*DML, exec func(dmls []*DML) error) error {
+// splitExecDML split dmls to size of e.batchSize and call exec concurrently,
+// at most concurrency splits are executed at the same time if it's positive.
+func (e *executor) splitExecDML(ctx context.Context, dmls []*DML, concurrency int, exec func(dmls []*DML) error) error {
 	errg, _ := errgroup.WithContext(ctx)
 
+	var tokens chan struct{}
+	if concurrency > 0 {
+		tokens = make(chan struct{}, concurrency)
+	}
+
 	for _, split := range splitDMLs(dmls, e.batchSize) {
 		split := split
 		errg.Go(func() error {
+			if tokens != nil {
+				tokens <- struct{}{}
+				defer func() { <-tokens }()
+			}
 			err := exec(split)
 			if err != nil {
 				return errors.Trace(err)
@@ -241,10 +457,7 @@ func (e *executor) splitExecDML(ctx context.Context, dmls []*DML, exec func(dmls
 
 func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode bool, retryNum int, backoff time.Duration) error {
 	for _, dmls := range splitDMLs(allDMLs, e.batchSize) {
-		err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
-			return e.singleExec(dmls, safeMode)
-		})
-		if err != nil {
+		if err := e.atomicExecRetry(ctx, dmls, safeMode, retryNum, backoff); err != nil {
 			return errors.Trace(err)
 		}
 	}
@@ -252,40 +465,100 @@ func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode
 	return nil
 }
 
-func (e *executor) singleExec(dmls []*DML, safeMode bool) error {
-	tx, err := e.begin()
-	if err != nil {
-		return errors.Trace(err)
+// atomicExecRetry executes all the dmls in one transaction, which is retried as a whole
+func (e *executor) atomicExecRetry(ctx context.Context, dmls []*DML, safeMode bool, retryNum int, backoff time.Duration) error {
+	err := retryLockedTable(ctx, e.lockedTablePolicy, e.retryPolicy, e.logSampler, retryNum, backoff, func(context.Context) error {
+		return e.guard(ctx, func() error {
+			return e.singleExec(dmls, safeMode)
+		})
+	})
+	return errors.Trace(err)
+}
+
+type execStmt struct {
+	dml   *DML
+	query string
+	args  []interface{}
+	// prepared statement of query, nil if the statement cache is disabled
+	stmt *gosql.Stmt
+}
+
+// genExecStmts returns the statements to apply dml, in safe mode the update is
+// applied by delete + replace and the insert is applied by replace.
+func genExecStmts(dml *DML, safeMode bool) []execStmt {
+	var stmts []execStmt
+	if safeMode && dml.Tp == UpdateDMLType {
+		sql, args := dml.deleteSQL()
+		stmts = append(stmts, execStmt{dml: dml, query: sql, args: args})
+		sql, args = dml.replaceSQL()
+		stmts = append(stmts, execStmt{dml: dml, query: sql, args: args})
+	} else if safeMode && dml.Tp == InsertDMLType {
+		sql, args := dml.replaceSQL()
+		stmts = append(stmts, execStmt{dml: dml, query: sql, args: args})
+	} else {
+		sql, args := dml.sql()
+		stmts = append(stmts, execStmt{dml: dml, query: sql, args: args})
 	}
+	return stmts
+}
 
+func (e *executor) singleExec(dmls []*DML, safeMode bool) error {
+	var stmts []execStmt
 	for _, dml := range dmls {
-		if safeMode && dml.Tp == UpdateDMLType {
-			sql, args := dml.deleteSQL()
-			_, err := tx.autoRollbackExec(sql, args...)
-			if err != nil {
-				return errors.Trace(err)
-			}
+		stmts = append(stmts, genExecStmts(dml, safeMode)...)
+	}
 
-			sql, args = dml.replaceSQL()
-			_, err = tx.autoRollbackExec(sql, args...)
-			if err != nil {
-				return errors.Trace(err)
-			}
-		} else if safeMode && dml.Tp == InsertDMLType {
-			sql, args := dml.replaceSQL()
-			_, err := tx.autoRollbackExec(sql, args...)
-			if err != nil {
-				return errors.Trace(err)
-			}
-		} else {
-			sql, args := dml.sql()
-			_, err := tx.autoRollbackExec(sql, args...)
+	// prepare before beginning the tx, preparing needs another connection
+	// which may never be available if all connections are held by the running txs.
+	if e.stmtCache != nil {
+		for i := range stmts {
+			stmt, err := e.stmtCache.get(stmts[i].dml.Database, stmts[i].dml.Table, stmts[i].query)
 			if err != nil {
 				return errors.Trace(err)
 			}
+			stmts[i].stmt = stmt
+		}
+	}
+
+	tx, err := e.begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, stmt := range stmts {
+		if err := tx.useTableSession(stmt.dml.Database, stmt.dml.Table); err != nil {
+			return errors.Trace(err)
+		}
+		if err := e.execIgnoreError(tx, stmt); err != nil {
+			return errors.Trace(err)
 		}
 	}
 
 	err = tx.commit()
 	return errors.Trace(err)
 }
+
+// execIgnoreError executes stmt in tx, the statement is skipped if it fails with
+// an ignored error code, otherwise the tx is rolled back and the error is returned.
+func (e *executor) execIgnoreError(tx *tx, stmt execStmt) error {
+	var err error
+	if stmt.stmt != nil {
+		_, err = tx.execStmt(stmt.stmt, stmt.args...)
+	} else {
+		_, err = tx.exec(stmt.query, stmt.args...)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if e.ignoreErrorCodes.match(err) {
+		e.logSampler.Warn("ignore exec error", err, zap.String("query", stmt.query), zap.Reflect("args", stmt.args))
+		return nil
+	}
+
+	e.logSampler.Error("Exec fail, will rollback", err, zap.String("query", stmt.query), zap.Reflect("args", stmt.args))
+	if rbErr := tx.rollback(); rbErr != nil {
+		log.Error("Auto rollback", zap.Error(rbErr))
+	}
+	return errors.Trace(err)
+}
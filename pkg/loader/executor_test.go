@@ -19,10 +19,13 @@ import (
 	"fmt"
 	"regexp"
 	"sync/atomic"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -64,7 +67,7 @@ func (s *executorSuite) TestSplitExecDML(c *C) {
 
 	var counter int32
 
-	err = e.splitExecDML(context.Background(), dmls, func(group []*DML) error {
+	err = e.splitExecDML(context.Background(), dmls, 0, func(group []*DML) error {
 		atomic.AddInt32(&counter, 1)
 		if len(group) < 2 {
 			return errors.New("fake")
@@ -101,6 +104,159 @@ func (s *singleExecSuite) TestFailedToBeginTx(c *C) {
 	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *singleExecSuite) TestIgnoreErrorCodes(c *C) {
+	var dmls []*DML
+	for i := 0; i < 2; i++ {
+		dmls = append(dmls, &DML{
+			Database: "unicorn",
+			Table:    "users",
+			Tp:       InsertDMLType,
+			Values: map[string]interface{}{
+				"name": fmt.Sprintf("tester%d", i),
+			},
+			info: &tableInfo{
+				columns: []string{"name"},
+			},
+		})
+	}
+	insertSQL := "INSERT INTO `unicorn`.`users`(`name`) VALUES(?)"
+	codes, err := newIgnoreErrorCodes([]int{1062})
+	c.Assert(err, IsNil)
+
+	// the duplicate entry error is ignored, and the next statement is still executed
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(insertSQL)).
+		WithArgs("tester0").WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	s.dbMock.ExpectExec(regexp.QuoteMeta(insertSQL)).
+		WithArgs("tester1").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e := newExecutor(s.db).withIgnoreErrorCodes(codes)
+	err = e.singleExec(dmls, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	// other errors still fail
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(insertSQL)).
+		WithArgs("tester0").WillReturnError(&mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"})
+	s.dbMock.ExpectRollback()
+
+	err = e.singleExec(dmls, false)
+	c.Assert(err, ErrorMatches, ".*Table doesn't exist.*")
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *singleExecSuite) TestStmtCache(c *C) {
+	insertSQL := "INSERT INTO `unicorn`.`users`(`name`) VALUES(?)"
+	cache := newStmtCache(s.db, 8, nil)
+	defer cache.close()
+	e := newExecutor(s.db).withStmtCache(cache)
+
+	// the statement is prepared only once and reused by the following txs
+	s.dbMock.ExpectPrepare(regexp.QuoteMeta(insertSQL))
+	for i := 0; i < 2; i++ {
+		s.dbMock.ExpectBegin()
+		s.dbMock.ExpectExec(regexp.QuoteMeta(insertSQL)).
+			WithArgs(fmt.Sprintf("tester%d", i)).WillReturnResult(sqlmock.NewResult(1, 1))
+		s.dbMock.ExpectCommit()
+	}
+
+	for i := 0; i < 2; i++ {
+		dml := &DML{
+			Database: "unicorn",
+			Table:    "users",
+			Tp:       InsertDMLType,
+			Values:   map[string]interface{}{"name": fmt.Sprintf("tester%d", i)},
+			info:     &tableInfo{columns: []string{"name"}},
+		}
+		err := e.singleExec([]*DML{dml}, false)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(cache.len(), Equals, 1)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *singleExecSuite) TestRetryWithBreaker(c *C) {
+	dml := &DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"name": "tester"},
+		info:     &tableInfo{columns: []string{"name"}},
+	}
+	coolDown := 100 * time.Millisecond
+	breaker := NewCircuitBreaker(2, coolDown, nil)
+
+	// the breaker opens after two failures, and the third attempt is the probe after the cool-down
+	s.dbMock.ExpectBegin().WillReturnError(errors.New("begin"))
+	s.dbMock.ExpectBegin().WillReturnError(errors.New("begin"))
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `unicorn`.`users`(`name`) VALUES(?)")).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e := newExecutor(s.db).withBreaker(breaker)
+	start := time.Now()
+	err := e.singleExecRetry(context.Background(), []*DML{dml}, false, 10, time.Millisecond)
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start) >= coolDown, IsTrue)
+	c.Assert(breaker.State(), Equals, BreakerClosed)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *singleExecSuite) TestUpdateMarkTable(c *C) {
+	dml := DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values: map[string]interface{}{
+			"name": "tester",
+		},
+		info: &tableInfo{
+			columns: []string{"name"},
+		},
+	}
+	info := loopbacksync.NewLoopBackSyncInfo(42, true)
+	markSQL := "INSERT INTO `tidb_binlog`.`_drainer_repl_mark`(`channel_id`, `id`, `val`) VALUES(?, ?, 1) ON DUPLICATE KEY UPDATE `val` = `val` + 1"
+	insertSQL := "INSERT INTO `unicorn`.`users`(`name`) VALUES(?)"
+
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(markSQL)).
+		WithArgs(42, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectExec(regexp.QuoteMeta(insertSQL)).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e := newExecutor(s.db).withLoopBackSyncInfo(info, 2)
+	err := e.singleExec([]*DML{&dml}, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	// the next txn uses another row of the mark table
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(markSQL)).
+		WithArgs(42, 0).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectExec(regexp.QuoteMeta(insertSQL)).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	err = e.singleExec([]*DML{&dml}, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	// no mark if loop back control is disabled
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(insertSQL)).
+		WithArgs("tester").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e = newExecutor(s.db).withLoopBackSyncInfo(loopbacksync.NewLoopBackSyncInfo(42, false), 2)
+	err = e.singleExec([]*DML{&dml}, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+}
+
 func (s *singleExecSuite) TestInsert(c *C) {
 	dml := DML{
 		Database: "unicorn",
@@ -296,3 +452,43 @@ func (s *bulkReplaceSuite) TestReplaceInBulk(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
+
+func (s *bulkReplaceSuite) TestFallBackOnIgnoredError(c *C) {
+	var dmls []*DML
+	for i := 0; i < 2; i++ {
+		dml := DML{
+			Database: "d",
+			Table:    "t",
+			Tp:       InsertDMLType,
+			Values: map[string]interface{}{
+				"a": fmt.Sprintf("a_%d", i),
+			},
+			info: &tableInfo{
+				columns: []string{"a"},
+			},
+		}
+		dmls = append(dmls, &dml)
+	}
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	dupErr := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `d`.`t`(`a`) VALUES (?),(?)")).
+		WithArgs("a_0", "a_1").WillReturnError(dupErr)
+	mock.ExpectRollback()
+	// only skip the failed one
+	mock.ExpectBegin()
+	sql := "REPLACE INTO `d`.`t`(`a`) VALUES(?)"
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs("a_0").WillReturnError(dupErr)
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs("a_1").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	codes, err := newIgnoreErrorCodes([]int{1062})
+	c.Assert(err, IsNil)
+	e := newExecutor(db).withIgnoreErrorCodes(codes)
+	err = e.bulkReplace(dmls)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/terror"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+)
+
+// fatalErrorCodes are not allowed to be ignored, these errors mean the downstream
+// is unavailable or the data is not written at all, ignoring them will lose data silently.
+var fatalErrorCodes = map[terror.ErrCode]struct{}{
+	tmysql.ErrConCount:                {},
+	tmysql.ErrDBaccessDenied:          {},
+	tmysql.ErrAccessDenied:            {},
+	tmysql.ErrServerShutdown:          {},
+	tmysql.ErrUnknown:                 {},
+	tmysql.ErrTableaccessDenied:       {},
+	tmysql.ErrColumnaccessDenied:      {},
+	tmysql.ErrLockWaitTimeout:         {},
+	tmysql.ErrLockDeadlock:            {},
+	tmysql.ErrSpecificAccessDenied:    {},
+	tmysql.ErrOptionPreventsStatement: {},
+	tmysql.ErrQueryInterrupted:        {},
+}
+
+type ignoreErrorCodes map[terror.ErrCode]struct{}
+
+func newIgnoreErrorCodes(codes []int) (ignoreErrorCodes, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	ignores := make(ignoreErrorCodes, len(codes))
+	for _, code := range codes {
+		if _, ok := fatalErrorCodes[terror.ErrCode(code)]; ok {
+			return nil, errors.Errorf("error code %d is not allowed to be ignored", code)
+		}
+		ignores[terror.ErrCode(code)] = struct{}{}
+	}
+	return ignores, nil
+}
+
+// match returns true if err is a mysql error with an ignored code
+func (c ignoreErrorCodes) match(err error) bool {
+	if len(c) == 0 || err == nil {
+		return false
+	}
+
+	code, ok := pkgsql.GetSQLErrCode(err)
+	if !ok {
+		return false
+	}
+	_, ok = c[code]
+	return ok
+}
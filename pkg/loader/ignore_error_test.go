@@ -0,0 +1,50 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type ignoreErrorSuite struct{}
+
+var _ = check.Suite(&ignoreErrorSuite{})
+
+func (s *ignoreErrorSuite) TestNewIgnoreErrorCodes(c *check.C) {
+	codes, err := newIgnoreErrorCodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(codes.match(&mysql.MySQLError{Number: 1062}), check.IsFalse)
+
+	_, err = newIgnoreErrorCodes([]int{1062, 1045})
+	c.Assert(err, check.ErrorMatches, ".*1045 is not allowed to be ignored.*")
+
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	_, err = NewLoader(db, IgnoreErrorCodes([]int{1213}))
+	c.Assert(err, check.NotNil)
+}
+
+func (s *ignoreErrorSuite) TestMatch(c *check.C) {
+	codes, err := newIgnoreErrorCodes([]int{1062})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(codes.match(nil), check.IsFalse)
+	c.Assert(codes.match(&mysql.MySQLError{Number: 1062}), check.IsTrue)
+	c.Assert(codes.match(errors.Trace(&mysql.MySQLError{Number: 1062})), check.IsTrue)
+	c.Assert(codes.match(&mysql.MySQLError{Number: 1146}), check.IsFalse)
+	c.Assert(codes.match(errors.New("1062")), check.IsFalse)
+}
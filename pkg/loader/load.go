@@ -17,12 +17,14 @@ import (
 	"context"
 	gosql "database/sql"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
@@ -44,8 +46,10 @@ const (
 var (
 	execDDLRetryWait            = time.Second
 	fNewBatchManager            = newBatchManager
+	fNewTxnScheduler            = newTxnScheduler
 	fGetAppliedTS               = getAppliedTS
 	updateLastAppliedTSInterval = time.Minute
+	warmupTimeout               = 10 * time.Second
 )
 
 // Loader is used to load data to mysql
@@ -87,6 +91,59 @@ type loaderImpl struct {
 	saveAppliedTS           bool
 	lastUpdateAppliedTSTime time.Time
 
+	loopBackSyncInfo *loopbacksync.LoopBackSync
+
+	projector *projector
+
+	ignoreErrorCodes ignoreErrorCodes
+
+	breaker *CircuitBreaker
+	// reduce the concurrency against downstream on too many connections,
+	// the idle connections beyond the limit are closed to release the connections of downstream
+	limiter *concurrencyLimiter
+
+	deadLetter DeadLetterFunc
+
+	stmtCache *stmtCache
+
+	relaxedOrder bool
+
+	coalesce bool
+
+	includeRowID bool
+
+	// parse the generated statements before executing them
+	validateSQL bool
+
+	tableConcurrencies *tableConcurrencies
+
+	// override the session settings while applying the DMLs of the tables
+	tableSessions *tableSessions
+
+	// split the regions of the tables created in TiDB downstream
+	preSplits *preSplits
+
+	// how to handle the writes rejected by the locked or read-only tables of downstream
+	lockedTablePolicy string
+	retryPolicy       RetryPolicy
+	// how to apply the txn carrying both DMLs and a DDL
+	mixedTxnPolicy string
+	bulkInsert     BulkInsertPolicy
+	// apply the txns in groups of one downstream transaction, see CommitGroupPolicy
+	commitGroup CommitGroupPolicy
+	// delay the executions while downstream reports high load, nil if it's disabled
+	throttler *throttler
+
+	// how to handle the values out of the range of the numeric columns in downstream, disabled if it's empty
+	numericOverflow string
+
+	// collapse the repetitive error logs, nil if every log is printed
+	logSampler *util.LogSampler
+
+	quote pkgsql.IdentifierQuote
+
+	tableOptions pkgsql.TableOptions
+
 	// TODO: remove this ctx, context shouldn't stored in struct
 	// https://github.com/pingcap/tidb-binlog/pull/691#issuecomment-515387824
 	ctx    context.Context
@@ -97,20 +154,71 @@ type loaderImpl struct {
 type MetricsGroup struct {
 	EventCounterVec   *prometheus.CounterVec
 	QueryHistogramVec *prometheus.HistogramVec
+	// the count of the cached prepared statements, which is also the max count of every downstream connection
+	PreparedStmtGauge prometheus.Gauge
 }
 
 type options struct {
-	workerCount   int
-	batchSize     int
-	metrics       *MetricsGroup
-	saveAppliedTS bool
+	workerCount       int
+	batchSize         int
+	metrics           *MetricsGroup
+	saveAppliedTS     bool
+	loopBackSyncInfo  *loopbacksync.LoopBackSync
+	projections       []ColumnProjection
+	caseInsensitive   bool
+	ignoreErrorCodes  []int
+	breaker           *CircuitBreaker
+	deadLetter        DeadLetterFunc
+	stmtCacheSize     int
+	relaxedOrder      bool
+	identifierQuote   pkgsql.IdentifierQuote
+	tableOptions      pkgsql.TableOptions
+	warmup            bool
+	coalesce          bool
+	includeRowID      bool
+	validateSQL       bool
+	tableConcurrency  []TableConcurrency
+	tableSession      []TableSession
+	preSplit          []TablePreSplit
+	lockedTable       string
+	mixedTxn          string
+	bulkInsert        BulkInsertPolicy
+	commitGroup       CommitGroupPolicy
+	retryPolicy       RetryPolicy
+	throttlePolicy    ThrottlePolicy
+	numericOverflow   string
+	logSampleInterval time.Duration
 }
 
 var defaultLoaderOptions = options{
-	workerCount:   16,
-	batchSize:     20,
-	metrics:       nil,
-	saveAppliedTS: false,
+	workerCount:      16,
+	batchSize:        20,
+	metrics:          nil,
+	saveAppliedTS:    false,
+	loopBackSyncInfo: nil,
+	projections:      nil,
+	ignoreErrorCodes: nil,
+	breaker:          nil,
+	deadLetter:       nil,
+	stmtCacheSize:    0,
+	relaxedOrder:     false,
+	identifierQuote:  pkgsql.BacktickQuote,
+	tableOptions:     pkgsql.TableOptions{},
+	warmup:           false,
+	coalesce:         false,
+	includeRowID:     false,
+	validateSQL:      false,
+	tableConcurrency: nil,
+	lockedTable:      LockedTableRetry,
+	mixedTxn:         MixedTxnSplit,
+	numericOverflow:  "",
+}
+
+func (o *options) preparedStmtGauge() prometheus.Gauge {
+	if o.metrics == nil {
+		return nil
+	}
+	return o.metrics.PreparedStmtGauge
 }
 
 // A Option sets options such batch size, worker count etc.
@@ -144,6 +252,211 @@ func Metrics(m *MetricsGroup) Option {
 	}
 }
 
+// LoopBackSyncInfo set the loop back sync info of loader,
+// every transaction will update the mark table if loop back control is enabled
+func LoopBackSyncInfo(info *loopbacksync.LoopBackSync) Option {
+	return func(o *options) {
+		o.loopBackSyncInfo = info
+	}
+}
+
+// ColumnProjections set the column projections of tables,
+// only the projected columns of these tables will be written to downstream
+func ColumnProjections(projs []ColumnProjection) Option {
+	return func(o *options) {
+		o.projections = projs
+	}
+}
+
+// IgnoreErrorCodes set the mysql error codes to be ignored when executing sql in downstream,
+// the failed statement is logged and skipped instead of failing the whole batch.
+func IgnoreErrorCodes(codes []int) Option {
+	return func(o *options) {
+		o.ignoreErrorCodes = codes
+	}
+}
+
+// Breaker set the circuit breaker guarding the executions against downstream,
+// the executions are paused when it's open instead of retrying against a failing downstream.
+func Breaker(b *CircuitBreaker) Option {
+	return func(o *options) {
+		o.breaker = b
+	}
+}
+
+// DeadLetter set the func to receive the txns failing permanently to apply to downstream,
+// these txns are skipped instead of failing the loader, which breaks the consistency of downstream.
+func DeadLetter(fn DeadLetterFunc) Option {
+	return func(o *options) {
+		o.deadLetter = fn
+	}
+}
+
+// StmtCacheSize set the max count of prepared statements cached in downstream,
+// the statements of the same SQL template reuse one prepared statement, 0 means no cache.
+// It caps the count of prepared statements of every downstream connection,
+// the least recently used one is closed when the cap is exceeded.
+func StmtCacheSize(n int) Option {
+	return func(o *options) {
+		o.stmtCacheSize = n
+	}
+}
+
+// RelaxedOrder set whether the txns not conflicting with each other can be applied out of commit order,
+// the txns writing the same keys are still applied in commit order, and the successes are still
+// reported in commit order. Every txn is applied in its own transactions instead of merged into batches.
+func RelaxedOrder(relaxed bool) Option {
+	return func(o *options) {
+		o.relaxedOrder = relaxed
+	}
+}
+
+// IdentifierQuote set the quote of the identifiers in the generated SQLs, the DDLs are executed as they are.
+func IdentifierQuote(quote pkgsql.IdentifierQuote) Option {
+	return func(o *options) {
+		o.identifierQuote = quote
+	}
+}
+
+// TableOptions set the default charset and collation of the mark table created by the loader
+func TableOptions(tableOptions pkgsql.TableOptions) Option {
+	return func(o *options) {
+		o.tableOptions = tableOptions
+	}
+}
+
+// Warmup set whether to open and ping the connections of all workers in NewLoader,
+// so the first txns don't pay for establishing them, and it fails fast if downstream is unreachable.
+func Warmup(warmup bool) Option {
+	return func(o *options) {
+		o.warmup = warmup
+	}
+}
+
+// CoalesceTxn set whether to collapse the DMLs of one txn writing the same row into the net effect,
+// e.g. insert + update -> insert, insert + delete -> nothing, update + update -> update.
+func CoalesceTxn(coalesce bool) Option {
+	return func(o *options) {
+		o.coalesce = coalesce
+	}
+}
+
+// IncludeRowID set whether to write the values of ImplicitRowIDColumn to downstream, it's dropped if
+// the table in downstream has no such column. The row id is used as the key to identify the row
+// if the table in downstream has no primary key or unique key.
+func IncludeRowID(include bool) Option {
+	return func(o *options) {
+		o.includeRowID = include
+	}
+}
+
+// ValidateSQL set whether to parse every generated statement by the TiDB parser before executing it,
+// the loader fails with the statement if it doesn't parse. It costs CPU, so it's disabled by default.
+func ValidateSQL(validate bool) Option {
+	return func(o *options) {
+		o.validateSQL = validate
+	}
+}
+
+// TableConcurrencies set the concurrency limits of the tables overriding the worker count,
+// the limits larger than the worker count don't take effect.
+func TableConcurrencies(confs []TableConcurrency) Option {
+	return func(o *options) {
+		o.tableConcurrency = confs
+	}
+}
+
+// TableSessions set the session time_zone and sql_mode of downstream overridden while applying the DMLs of the tables,
+// the values of TIMESTAMP columns should be converted to the time zone of the table.
+func TableSessions(confs []TableSession) Option {
+	return func(o *options) {
+		o.tableSession = confs
+	}
+}
+
+// PreSplitTables set how to pre-split the regions of the tables right after they're created in downstream,
+// only for TiDB downstream supporting `SPLIT TABLE`.
+func PreSplitTables(confs []TablePreSplit) Option {
+	return func(o *options) {
+		o.preSplit = confs
+	}
+}
+
+// LockedTablePolicy set how to handle the writes rejected by the locked or read-only tables of downstream,
+// LockedTableRetry retries them like other errors, LockedTableWait keeps retrying until the table is writable
+// and LockedTableFail fails immediately.
+func LockedTablePolicy(policy string) Option {
+	return func(o *options) {
+		o.lockedTable = policy
+	}
+}
+
+// MixedTxnPolicy set how to apply the txn carrying both DMLs and a DDL, MixedTxnSplit by default.
+// The txns produced from TiDB binlog never carry both, because a DDL is a separate txn in TiDB.
+func MixedTxnPolicy(policy string) Option {
+	return func(o *options) {
+		o.mixedTxn = policy
+	}
+}
+
+// BulkInsert set the policy to apply the bursts of inserts like the ones derived from LOAD DATA,
+// see BulkInsertPolicy.
+func BulkInsert(policy BulkInsertPolicy) Option {
+	return func(o *options) {
+		o.bulkInsert = policy
+	}
+}
+
+// CommitGroup set the policy to apply several txns in one downstream transaction to amortize the commit cost,
+// see CommitGroupPolicy.
+func CommitGroup(policy CommitGroupPolicy) Option {
+	return func(o *options) {
+		o.commitGroup = policy
+	}
+}
+
+// Retry set the backoff cap and the total time budget of retrying the DMLs and DDLs failing in downstream,
+// see RetryPolicy.
+func Retry(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = policy
+	}
+}
+
+// Throttle set the policy to reduce the write rate against downstream when downstream reports high load,
+// see ThrottlePolicy.
+func Throttle(policy ThrottlePolicy) Option {
+	return func(o *options) {
+		o.throttlePolicy = policy
+	}
+}
+
+// LogSampleInterval set the interval to print the identical error logs of downstream at most once,
+// the suppressed ones are counted in the next printed log. Every log is printed if it's not positive.
+func LogSampleInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.logSampleInterval = interval
+	}
+}
+
+// CaseInsensitive set whether the schema and table names of the column projections are matched case-insensitively,
+// e.g. the projection of `DB1`.`T` is applied to `db1`.`t` if it's true. They're matched exactly by default.
+func CaseInsensitive(insensitive bool) Option {
+	return func(o *options) {
+		o.caseInsensitive = insensitive
+	}
+}
+
+// NumericOverflow set how to handle the values out of the range of the integer and DECIMAL columns in downstream,
+// e.g. the downstream column is narrower than upstream. NumericOverflowError fails with the value,
+// NumericOverflowClamp writes the nearest value in the range and NumericOverflowNull writes NULL.
+// The values are written as they are by default.
+func NumericOverflow(policy string) Option {
+	return func(o *options) {
+		o.numericOverflow = policy
+	}
+}
+
 // NewLoader return a Loader
 // db must support multi statement and interpolateParams
 func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
@@ -152,6 +465,62 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 		o(&opts)
 	}
 
+	proj, err := newProjector(opts.projections, opts.caseInsensitive)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	ignores, err := newIgnoreErrorCodes(opts.ignoreErrorCodes)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tableConcurrencies, err := newTableConcurrencies(opts.tableConcurrency)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tableSessions, err := newTableSessions(opts.tableSession)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	splits, err := newPreSplits(opts.preSplit)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err = checkLockedTablePolicy(opts.lockedTable); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err = checkMixedTxnPolicy(opts.mixedTxn); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err = checkBulkInsertPolicy(opts.bulkInsert); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err = checkCommitGroupPolicy(opts.commitGroup); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if opts.commitGroup.enabled() && opts.relaxedOrder {
+		return nil, errors.New("commit group can't be used with relaxed order, every txn is applied in its own transactions")
+	}
+
+	if err = checkNumericOverflowPolicy(opts.numericOverflow); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err = checkRetryPolicy(opts.retryPolicy); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err = checkThrottlePolicy(opts.throttlePolicy); err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	s := &loaderImpl{
@@ -164,6 +533,31 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 		merge:         true,
 		saveAppliedTS: opts.saveAppliedTS,
 
+		loopBackSyncInfo:   opts.loopBackSyncInfo,
+		projector:          proj,
+		ignoreErrorCodes:   ignores,
+		breaker:            opts.breaker,
+		limiter:            newConcurrencyLimiter(opts.workerCount, db.SetMaxIdleConns),
+		deadLetter:         opts.deadLetter,
+		stmtCache:          newStmtCache(db, opts.stmtCacheSize, opts.preparedStmtGauge()),
+		relaxedOrder:       opts.relaxedOrder,
+		coalesce:           opts.coalesce,
+		includeRowID:       opts.includeRowID,
+		validateSQL:        opts.validateSQL,
+		tableConcurrencies: tableConcurrencies,
+		tableSessions:      tableSessions,
+		preSplits:          splits,
+		lockedTablePolicy:  opts.lockedTable,
+		mixedTxnPolicy:     opts.mixedTxn,
+		bulkInsert:         opts.bulkInsert,
+		commitGroup:        opts.commitGroup,
+		retryPolicy:        opts.retryPolicy,
+		throttler:          newThrottler(db, opts.throttlePolicy),
+		numericOverflow:    opts.numericOverflow,
+		logSampler:         util.NewLogSampler(opts.logSampleInterval),
+		quote:              opts.identifierQuote,
+		tableOptions:       opts.tableOptions,
+
 		ctx:    ctx,
 		cancel: cancel,
 	}
@@ -171,6 +565,16 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 	db.SetMaxOpenConns(opts.workerCount)
 	db.SetMaxIdleConns(opts.workerCount)
 
+	if opts.warmup {
+		warmupCtx, warmupCancel := context.WithTimeout(ctx, warmupTimeout)
+		err = warmupDB(warmupCtx, db, opts.workerCount)
+		warmupCancel()
+		if err != nil {
+			cancel()
+			return nil, errors.Annotate(err, "warm up connections of downstream failed")
+		}
+	}
+
 	return s, nil
 }
 
@@ -183,7 +587,8 @@ func (s *loaderImpl) metricsInputTxn(txn *Txn) {
 
 	if txn.isDDL() {
 		s.metrics.EventCounterVec.WithLabelValues("DDL").Add(1)
-	} else {
+	}
+	if len(txn.DMLs) > 0 {
 		nInsert, nDelete, nUpdate := countEvents(txn.DMLs)
 		s.metrics.EventCounterVec.WithLabelValues("Insert").Add(nInsert)
 		s.metrics.EventCounterVec.WithLabelValues("Delete").Add(nDelete)
@@ -253,7 +658,15 @@ func (s *loaderImpl) refreshTableInfo(schema string, table string) (info *tableI
 		return info, errors.Trace(err)
 	}
 
-	if len(info.uniqueKeys) == 0 {
+	if err = s.projector.adjustTableInfo(schema, table, info); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if s.includeRowID {
+		info.setRowIDInfo()
+	}
+
+	if len(info.uniqueKeys) == 0 && info.rowIDInfo == nil {
 		log.Warn("table has no any primary key and unique index, it may be slow when syncing data to downstream, we highly recommend add primary key or unique key for table", zap.String("table", quoteSchema(schema, table)))
 	}
 
@@ -273,6 +686,18 @@ func (s *loaderImpl) getTableInfo(schema string, table string) (info *tableInfo,
 }
 
 func needRefreshTableInfo(sql string) bool {
+	// a sequence has no columns to be written by DML
+	if util.IsSequenceDDL(sql) {
+		return false
+	}
+	// the multi-valued indexes are a part of the table info
+	if util.IsMultiValuedIndexDDL(sql) {
+		return true
+	}
+	if util.IsGlobalTemporaryTableDDL(sql) {
+		return true
+	}
+
 	stmt, err := parser.New().ParseOneStmt(sql, "", "")
 	if err != nil {
 		log.Error("parse sql failed", zap.String("sql", sql), zap.Error(err))
@@ -294,6 +719,10 @@ func needRefreshTableInfo(sql string) bool {
 }
 
 func isCreateDatabaseDDL(sql string) bool {
+	if util.IsSequenceDDL(sql) || util.IsMultiValuedIndexDDL(sql) || util.IsGlobalTemporaryTableDDL(sql) {
+		return false
+	}
+
 	stmt, err := parser.New().ParseOneStmt(sql, "", "")
 	if err != nil {
 		log.Error("parse sql failed", zap.String("sql", sql), zap.Error(err))
@@ -304,44 +733,110 @@ func isCreateDatabaseDDL(sql string) bool {
 	return isCreateDatabase
 }
 
+// isColumnTypeChangeDDL checks whether sql is an `ALTER TABLE` changing the definition of
+// existing columns by `MODIFY COLUMN` or `CHANGE COLUMN`
+func isColumnTypeChangeDDL(sql string) bool {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return false
+	}
+
+	alter, ok := stmt.(*ast.AlterTableStmt)
+	if !ok {
+		return false
+	}
+	for _, spec := range alter.Specs {
+		if spec.Tp == ast.AlterTableModifyColumn || spec.Tp == ast.AlterTableChangeColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// isNarrowingError checks whether err means the existing data can't be converted to the new column type,
+// or downstream doesn't support the lossy change of column type.
+func isNarrowingError(err error) bool {
+	code, ok := pkgsql.GetSQLErrCode(err)
+	if !ok {
+		return false
+	}
+
+	switch code {
+	case tmysql.ErrWarnDataOutOfRange, tmysql.WarnDataTruncated, tmysql.ErrTruncatedWrongValueForField,
+		tmysql.ErrDataTooLong, tmysql.ErrUnsupportedDDLOperation:
+		return true
+	}
+	return false
+}
+
 func (s *loaderImpl) execDDL(ddl *DDL) error {
 	log.Debug("exec ddl", zap.Reflect("ddl", ddl))
 
-	err := util.RetryContext(s.ctx, maxDDLRetryCount, execDDLRetryWait, 1, func(context.Context) error {
-		tx, err := s.db.Begin()
-		if err != nil {
+	if err := s.validateDDL(ddl); err != nil {
+		return errors.Trace(err)
+	}
+
+	// the column type change fails again on the same data, so don't retry it
+	var narrowingErr error
+	err := retryLockedTable(s.ctx, s.lockedTablePolicy, s.retryPolicy, s.logSampler, maxDDLRetryCount, execDDLRetryWait, func(ctx context.Context) error {
+		if err := s.breaker.wait(ctx); err != nil {
 			return err
 		}
-
-		if len(ddl.Database) > 0 && !isCreateDatabaseDDL(ddl.SQL) {
-			_, err = tx.Exec(fmt.Sprintf("use %s;", quoteName(ddl.Database)))
-			if err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil {
-					log.Error("Rollback failed", zap.Error(rbErr))
-				}
-				return err
-			}
+		err := s.execDDLOnce(ddl)
+		s.breaker.record(err)
+		if err != nil && isNarrowingError(err) && isColumnTypeChangeDDL(ddl.SQL) {
+			narrowingErr = err
+			return nil
 		}
+		return err
+	})
+	if err == nil && narrowingErr != nil {
+		return errors.Annotatef(narrowingErr, "change column type failed, the existing data in downstream may not fit in the new type, "+
+			"please fix the data or the column in downstream manually, or skip the ddl by ignore-txn-commit-ts, ddl: %s", ddl.SQL)
+	}
+	if err == nil {
+		s.preSplitTable(ddl)
+	}
+
+	return errors.Trace(err)
+}
 
-		if _, err = tx.Exec(ddl.SQL); err != nil {
+func (s *loaderImpl) execDDLOnce(ddl *DDL) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if len(ddl.Database) > 0 && !isCreateDatabaseDDL(ddl.SQL) {
+		_, err = tx.Exec(fmt.Sprintf("use %s;", s.quote.Name(ddl.Database)))
+		if err != nil {
 			if rbErr := tx.Rollback(); rbErr != nil {
-				log.Error("Rollback failed", zap.String("sql", ddl.SQL), zap.Error(rbErr))
+				log.Error("Rollback failed", zap.Error(rbErr))
 			}
 			return err
 		}
+	}
 
-		if err = tx.Commit(); err != nil {
-			return err
+	if _, err = tx.Exec(ddl.SQL); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Error("Rollback failed", zap.String("sql", ddl.SQL), zap.Error(rbErr))
 		}
+		if s.ignoreErrorCodes.match(err) {
+			s.logSampler.Warn("ignore exec ddl error", err, zap.String("sql", ddl.SQL))
+			return nil
+		}
+		return err
+	}
 
-		log.Info("exec ddl success", zap.String("sql", ddl.SQL))
-		return nil
-	})
+	if err = tx.Commit(); err != nil {
+		return err
+	}
 
-	return errors.Trace(err)
+	log.Info("exec ddl success", zap.String("sql", ddl.SQL))
+	return nil
 }
 
-func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
+func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML, safeMode bool, retryCount int) error {
 	errg, _ := errgroup.WithContext(s.ctx)
 
 	for _, dmls := range byHash {
@@ -352,7 +847,7 @@ func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
 		dmls := dmls
 
 		errg.Go(func() error {
-			err := executor.singleExecRetry(s.ctx, dmls, s.GetSafeMode(), maxDMLRetryCount, time.Second)
+			err := executor.singleExecRetry(s.ctx, dmls, safeMode, retryCount, time.Second)
 			return err
 		})
 	}
@@ -362,7 +857,7 @@ func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
 	return errors.Trace(err)
 }
 
-func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
+func (s *loaderImpl) singleExec(executor *executor, dmls []*DML, safeMode bool, retryCount int) error {
 	causality := NewCausality()
 
 	var byHash = make([][]*DML, s.workerCount)
@@ -375,7 +870,7 @@ func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
 			log.Info("meet causality.DetectConflict exec now",
 				zap.String("table name", dml.TableName()),
 				zap.Strings("keys", keys))
-			if err := s.execByHash(executor, byHash); err != nil {
+			if err := s.execByHash(executor, byHash, safeMode, retryCount); err != nil {
 				return errors.Trace(err)
 			}
 
@@ -389,12 +884,12 @@ func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
 			log.Error("Add keys to causality failed", zap.Error(err), zap.Strings("keys", keys))
 		}
 		key := causality.Get(keys[0])
-		idx := int(genHashKey(key)) % len(byHash)
+		idx := s.tableConcurrencies.bucket(dml, key, len(byHash))
 		byHash[idx] = append(byHash[idx], dml)
 
 	}
 
-	err := s.execByHash(executor, byHash)
+	err := s.execByHash(executor, byHash, safeMode, retryCount)
 	return errors.Trace(err)
 }
 
@@ -403,29 +898,96 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 		return nil
 	}
 
+	if err := s.prepareDMLs(dmls); err != nil {
+		return errors.Trace(err)
+	}
+
+	return s.applyDMLs(dmls, s.GetSafeMode(), maxDMLRetryCount)
+}
+
+// execTxnSafely executes the DMLs of txn in safe mode.
+// It's used to find out the txns failing permanently after a batch fails,
+// some of the txns may be applied already, so safe mode is needed to execute them again.
+func (s *loaderImpl) execTxnSafely(txn *Txn) error {
+	if err := s.prepareDMLs(txn.DMLs); err != nil {
+		return errors.Trace(err)
+	}
+
+	return s.applyDMLs(txn.DMLs, true, deadLetterRetryCount)
+}
+
+// execTxnAtomically executes all the DMLs of txn in one downstream transaction
+func (s *loaderImpl) execTxnAtomically(txn *Txn) error {
+	return errors.Trace(s.execDMLsAtomically(txn.DMLs))
+}
+
+// execDMLsAtomically executes all the dmls in one downstream transaction
+func (s *loaderImpl) execDMLsAtomically(dmls []*DML) error {
+	if len(dmls) == 0 {
+		return nil
+	}
+
+	if err := s.prepareDMLs(dmls); err != nil {
+		return errors.Trace(err)
+	}
+
+	safeMode := s.GetSafeMode()
+	if err := s.validateDMLs(dmls, safeMode); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.getExecutor().atomicExecRetry(s.ctx, dmls, safeMode, maxDMLRetryCount, time.Second))
+}
+
+// prepareDMLs sets the table info of DMLs and projects the values,
+// the DMLs prepared already are skipped, because projection can't be applied twice.
+func (s *loaderImpl) prepareDMLs(dmls []*DML) error {
 	for _, dml := range dmls {
+		if dml.info != nil {
+			continue
+		}
 		if err := s.setDMLInfo(dml); err != nil {
 			return errors.Trace(err)
 		}
+		dml.quote = s.quote
+		useRowID(dml, s.includeRowID)
+		s.projector.project(dml)
 		filterGeneratedCols(dml)
+		mergeOptionalValues(dml)
+		if err := dml.checkElems(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := dml.fitNumerics(s.numericOverflow); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (s *loaderImpl) applyDMLs(dmls []*DML, safeMode bool, retryCount int) error {
+	if len(dmls) == 0 {
+		return nil
+	}
+
+	if err := s.validateDMLs(dmls, safeMode); err != nil {
+		return errors.Trace(err)
 	}
 
 	batchTables, singleDMLs := s.groupDMLs(dmls)
 
-	executor := s.getExecutor()
+	executor := s.getExecutorOf(dmls)
 	errg, _ := errgroup.WithContext(s.ctx)
 
 	for _, dmls := range batchTables {
 		// https://golang.org/doc/faq#closures_and_goroutines
 		dmls := dmls
 		errg.Go(func() error {
-			err := executor.execTableBatchRetry(s.ctx, dmls, maxDMLRetryCount, time.Second)
+			err := executor.execTableBatchRetry(s.ctx, dmls, retryCount, time.Second)
 			return err
 		})
 	}
 
 	errg.Go(func() error {
-		err := s.singleExec(executor, singleDMLs)
+		err := s.singleExec(executor, singleDMLs, safeMode, retryCount)
 		return errors.Trace(err)
 	})
 
@@ -434,6 +996,20 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 	return errors.Trace(err)
 }
 
+func (s *loaderImpl) initMarkTable() error {
+	if !s.loopBackSyncInfo.Enabled() {
+		return nil
+	}
+
+	sqls := []string{loopbacksync.CreateMarkSchemaSQL(s.quote), loopbacksync.CreateMarkTableSQL(s.quote, s.tableOptions)}
+	for _, sql := range sqls {
+		if _, err := s.db.Exec(sql); err != nil {
+			return errors.Annotatef(err, "exec failed, sql: %s", sql)
+		}
+	}
+	return nil
+}
+
 // Run will quit when meet any error, or all the txn are drained
 func (s *loaderImpl) Run() error {
 	txnManager := newTxnManager(1024, s.input)
@@ -441,10 +1017,28 @@ func (s *loaderImpl) Run() error {
 		log.Info("Run()... in Loader quit")
 		close(s.successTxn)
 		txnManager.Close()
+		s.stmtCache.close()
 	}()
 
-	batch := fNewBatchManager(s)
+	if err := s.initMarkTable(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if s.throttler != nil {
+		throttleCtx, cancelThrottle := context.WithCancel(s.ctx)
+		defer cancelThrottle()
+		go s.throttler.run(throttleCtx)
+	}
+
 	input := txnManager.run()
+	if s.relaxedOrder {
+		return errors.Trace(s.runRelaxed(txnManager, input))
+	}
+	if s.commitGroup.enabled() {
+		return errors.Trace(s.runGrouped(txnManager, input))
+	}
+
+	batch := fNewBatchManager(s)
 
 	for {
 		select {
@@ -459,13 +1053,16 @@ func (s *loaderImpl) Run() error {
 
 			s.metricsInputTxn(txn)
 			txnManager.pop(txn)
+			if err := s.coalesceTxn(txn); err != nil {
+				return errors.Trace(err)
+			}
 			if err := batch.put(txn); err != nil {
 				return errors.Trace(err)
 			}
 
 		default:
 			// execute DMLs ASAP if the `input` channel is empty
-			if len(batch.dmls) > 0 {
+			if len(batch.txns) > 0 {
 				if err := batch.execAccumulatedDMLs(); err != nil {
 					return errors.Trace(err)
 				}
@@ -481,6 +1078,9 @@ func (s *loaderImpl) Run() error {
 
 			s.metricsInputTxn(txn)
 			txnManager.pop(txn)
+			if err := s.coalesceTxn(txn); err != nil {
+				return errors.Trace(err)
+			}
 			if err := batch.put(txn); err != nil {
 				return errors.Trace(err)
 			}
@@ -488,6 +1088,58 @@ func (s *loaderImpl) Run() error {
 	}
 }
 
+// runRelaxed applies the txns by txnScheduler until input is closed or meeting any error
+func (s *loaderImpl) runRelaxed(txnManager *txnManager, input chan *Txn) error {
+	sched := fNewTxnScheduler(s)
+	defer sched.close()
+
+	for {
+		select {
+		case txn, ok := <-input:
+			if !ok {
+				log.Info("Loader closed, quit running")
+				return errors.Trace(sched.drain())
+			}
+
+			s.metricsInputTxn(txn)
+			txnManager.pop(txn)
+			if err := s.coalesceTxn(txn); err != nil {
+				return errors.Trace(err)
+			}
+			if err := sched.put(txn); err != nil {
+				return errors.Trace(err)
+			}
+		case st := <-sched.results:
+			if err := sched.handleResult(st); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+}
+
+// coalesceTxn collapses the DMLs of txn writing the same row if coalescing is enabled
+func (s *loaderImpl) coalesceTxn(txn *Txn) error {
+	if !s.coalesce || len(txn.DMLs) < 2 {
+		return nil
+	}
+
+	if err := s.prepareDMLs(txn.DMLs); err != nil {
+		return errors.Trace(err)
+	}
+	txn.DMLs = coalesceDMLs(txn.DMLs)
+	return nil
+}
+
+// execTxn executes the DMLs of txn, which is a txn scheduled by txnScheduler
+func (s *loaderImpl) execTxn(txn *Txn) error {
+	if err := s.validateDMLs(txn.DMLs, s.GetSafeMode()); err != nil {
+		return errors.Trace(err)
+	}
+
+	err := s.getExecutorOf(txn.DMLs).singleExecRetry(s.ctx, txn.DMLs, s.GetSafeMode(), maxDMLRetryCount, time.Second)
+	return errors.Trace(err)
+}
+
 // groupDMLs group DMLs by table in batchByTbls and
 // collects DMLs that can't be executed in bulk in singleDMLs.
 // NOTE: DML.info are assumed to be already set.
@@ -531,6 +1183,28 @@ func (s *loaderImpl) setDMLInfo(dml *DML) (err error) {
 	return
 }
 
+// useRowID drops the row id of dml if it's not included or the table in downstream doesn't have the column,
+// the row id is used as the key if the table has no primary key or unique key.
+func useRowID(dml *DML, include bool) {
+	if _, ok := dml.Values[ImplicitRowIDColumn]; !ok {
+		return
+	}
+
+	if include {
+		if dml.info.rowIDInfo != nil {
+			dml.info = dml.info.rowIDInfo
+			return
+		}
+		for _, col := range dml.info.columns {
+			if col == ImplicitRowIDColumn {
+				return
+			}
+		}
+	}
+	delete(dml.Values, ImplicitRowIDColumn)
+	delete(dml.OldValues, ImplicitRowIDColumn)
+}
+
 func filterGeneratedCols(dml *DML) {
 	if len(dml.Values) > len(dml.info.columns) {
 		// Remove values of generated columns
@@ -542,22 +1216,56 @@ func filterGeneratedCols(dml *DML) {
 	}
 }
 
+// mergeOptionalValues adds the optional values of the columns existing in downstream to the values
+func mergeOptionalValues(dml *DML) {
+	for name, value := range dml.OptionalValues {
+		for _, col := range dml.info.columns {
+			if strings.EqualFold(col, name) {
+				dml.Values[col] = value
+				break
+			}
+		}
+	}
+}
+
 func (s *loaderImpl) getExecutor() *executor {
-	e := newExecutor(s.db).withBatchSize(s.batchSize)
+	e := newExecutor(s.db).withBatchSize(s.batchSize).withLoopBackSyncInfo(s.loopBackSyncInfo, s.workerCount).withIgnoreErrorCodes(s.ignoreErrorCodes).withBreaker(s.breaker).withLimiter(s.limiter).withStmtCache(s.stmtCache).withIdentifierQuote(s.quote).withTableConcurrencies(s.tableConcurrencies).withTableSessions(s.tableSessions).withLockedTablePolicy(s.lockedTablePolicy).withRetryPolicy(s.retryPolicy).withThrottler(s.throttler).withLogSampler(s.logSampler)
 	if s.metrics != nil && s.metrics.QueryHistogramVec != nil {
 		e = e.withQueryHistogramVec(s.metrics.QueryHistogramVec)
 	}
 	return e
 }
 
+// getExecutorOf returns the executor to apply dmls, the bursts of inserts are applied with the batch size
+// of the bulk insert policy.
+func (s *loaderImpl) getExecutorOf(dmls []*DML) *executor {
+	e := s.getExecutor()
+	if s.bulkInsert.isBurst(dmls) {
+		log.Debug("apply the burst of inserts in bulk", zap.Int("rows", len(dmls)), zap.Int("batch size", s.bulkInsert.BatchSize))
+		e = e.withBatchSize(s.bulkInsert.BatchSize)
+	}
+	return e
+}
+
 func newBatchManager(s *loaderImpl) *batchManager {
+	execDMLs := s.execDMLs
+	if s.commitGroup.enabled() {
+		// the DMLs of the txns grouped are applied in one downstream transaction
+		execDMLs = s.execDMLsAtomically
+	}
 	return &batchManager{
 		limit:                s.batchSize * s.workerCount * execLimitMultiple,
-		fExecDMLs:            s.execDMLs,
+		fExecDMLs:            execDMLs,
 		fDMLsSuccessCallback: s.markSuccess,
 		fExecDDL:             s.execDDL,
+		fExecTxn:             s.execTxnSafely,
+		fDeadLetter:          s.deadLetter,
+		fExecTxnAtomically:   s.execTxnAtomically,
+		mixedTxnPolicy:       s.mixedTxnPolicy,
 		fDDLSuccessCallback: func(txn *Txn) {
 			s.markSuccess(txn)
+			// the prepared statements may not match the new schema
+			s.stmtCache.invalidate(txn.DDL.Database, txn.DDL.Table)
 			if needRefreshTableInfo(txn.DDL.SQL) {
 				if _, err := s.refreshTableInfo(txn.DDL.Database, txn.DDL.Table); err != nil {
 					log.Error("refresh table info failed", zap.String("database", txn.DDL.Database), zap.String("table", txn.DDL.Table), zap.Error(err))
@@ -575,15 +1283,30 @@ type batchManager struct {
 	fDMLsSuccessCallback func(...*Txn)
 	fExecDDL             func(*DDL) error
 	fDDLSuccessCallback  func(*Txn)
+	// only used when fDeadLetter isn't nil
+	fExecTxn    func(*Txn) error
+	fDeadLetter DeadLetterFunc
+	// apply the DMLs of the txn carrying a DDL, see MixedTxnPolicy
+	fExecTxnAtomically func(*Txn) error
+	mixedTxnPolicy     string
 }
 
 func (b *batchManager) execAccumulatedDMLs() (err error) {
-	if len(b.dmls) == 0 {
+	if len(b.txns) == 0 {
 		return nil
 	}
 
-	if err := b.fExecDMLs(b.dmls); err != nil {
-		return errors.Trace(err)
+	// the txns may have no DMLs left after coalescing, they're reported directly
+	if len(b.dmls) > 0 {
+		if err := b.fExecDMLs(b.dmls); err != nil {
+			if b.fDeadLetter == nil || !isPermanentError(err) {
+				return errors.Trace(err)
+			}
+			log.Warn("exec dmls failed permanently, exec the txns one by one to find out the failed ones", zap.Error(err))
+			if err := b.execTxnsOneByOne(); err != nil {
+				return errors.Trace(err)
+			}
+		}
 	}
 
 	if b.fDMLsSuccessCallback != nil {
@@ -594,13 +1317,56 @@ func (b *batchManager) execAccumulatedDMLs() (err error) {
 	return nil
 }
 
+// execTxnsOneByOne executes the accumulated txns one by one,
+// and sends the ones failing permanently to the dead letter.
+func (b *batchManager) execTxnsOneByOne() error {
+	for _, txn := range b.txns {
+		err := b.fExecTxn(txn)
+		if err == nil {
+			continue
+		}
+		if !isPermanentError(err) {
+			return errors.Trace(err)
+		}
+		if err := b.sendDeadLetter(txn, err); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (b *batchManager) sendDeadLetter(txn *Txn, cause error) error {
+	log.Warn("skip txn failing permanently, send it to dead letter", zap.Stringer("txn", txn), zap.Error(cause))
+	if err := b.fDeadLetter(txn, cause); err != nil {
+		return errors.Annotatef(err, "send txn to dead letter failed, origin error: %v", cause)
+	}
+	return nil
+}
+
 func (b *batchManager) execDDL(txn *Txn) error {
+	if len(txn.DMLs) > 0 {
+		skipped, err := b.execMixedDMLs(txn)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if skipped {
+			b.fDDLSuccessCallback(txn)
+			return nil
+		}
+	}
+
 	if err := b.fExecDDL(txn.DDL); err != nil {
-		if !pkgsql.IgnoreDDLError(err) {
+		switch {
+		case pkgsql.IgnoreDDLError(err):
+			log.Warn("ignore ddl", zap.Error(err), zap.String("ddl", txn.DDL.SQL))
+		case b.fDeadLetter != nil && isPermanentError(err):
+			if err := b.sendDeadLetter(txn, err); err != nil {
+				return errors.Trace(err)
+			}
+		default:
 			log.Error("exec failed", zap.String("sql", txn.DDL.SQL), zap.Error(err))
 			return errors.Trace(err)
 		}
-		log.Warn("ignore ddl", zap.Error(err), zap.String("ddl", txn.DDL.SQL))
 	}
 
 	b.fDDLSuccessCallback(txn)
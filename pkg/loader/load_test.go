@@ -17,12 +17,15 @@ import (
 	"context"
 	"database/sql"
 	"reflect"
+	"regexp"
 	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
 	check "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loopbacksync"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -126,6 +129,38 @@ func (cs *LoadSuite) TestNewClose(c *check.C) {
 	loader.Close()
 }
 
+func (cs *LoadSuite) TestWarmup(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	loader, err := NewLoader(db, WorkerCount(4), Warmup(true))
+	c.Assert(err, check.IsNil)
+	defer loader.Close()
+
+	// the pool is primed with the connections of all workers
+	stats := db.Stats()
+	c.Assert(stats.OpenConnections, check.Equals, 4)
+	c.Assert(stats.Idle, check.Equals, 4)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (cs *LoadSuite) TestWarmupUnreachable(c *check.C) {
+	origTimeout := warmupTimeout
+	warmupTimeout = 5 * time.Second
+	defer func() {
+		warmupTimeout = origTimeout
+	}()
+
+	// nothing listens on the port
+	db, err := CreateDB("root", "", "127.0.0.1", 1)
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	_, err = NewLoader(db, WorkerCount(2), Warmup(true))
+	c.Assert(err, check.ErrorMatches, "warm up connections of downstream failed.*")
+}
+
 func (cs *LoadSuite) TestSetDMLInfo(c *check.C) {
 	info := tableInfo{columns: []string{"id", "name"}}
 	origGet := utilGetTableInfo
@@ -162,6 +197,83 @@ func (cs *LoadSuite) TestFilterGeneratedCols(c *check.C) {
 	})
 }
 
+func (cs *LoadSuite) TestMergeOptionalValues(c *check.C) {
+	dml := DML{
+		Values:         map[string]interface{}{"id": 1},
+		OptionalValues: map[string]interface{}{"_commit_ts": 42, "_cluster_id": 1},
+		info:           &tableInfo{columns: []string{"id", "_COMMIT_TS"}},
+	}
+	mergeOptionalValues(&dml)
+	// the value of the absent column is dropped
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"id": 1, "_COMMIT_TS": 42})
+
+	dml = DML{
+		Values: map[string]interface{}{"id": 1},
+		info:   &tableInfo{columns: []string{"id"}},
+	}
+	mergeOptionalValues(&dml)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"id": 1})
+}
+
+func (cs *LoadSuite) TestRowIDAsKey(c *check.C) {
+	origGet := utilGetTableInfo
+	defer func() { utilGetTableInfo = origGet }()
+	utilGetTableInfo = func(db *sql.DB, schema string, table string) (info *tableInfo, err error) {
+		if table == "has_uk" {
+			return &tableInfo{
+				columns:    []string{"id", "v", ImplicitRowIDColumn},
+				uniqueKeys: []indexInfo{{"uk", []string{"id"}}},
+			}, nil
+		}
+		if table == "no_rowid" {
+			return &tableInfo{columns: []string{"id", "v"}}, nil
+		}
+		return &tableInfo{columns: []string{"id", "v", ImplicitRowIDColumn}}, nil
+	}
+
+	newUpdate := func(table string) *DML {
+		return &DML{
+			Database:  "test",
+			Table:     table,
+			Tp:        UpdateDMLType,
+			Values:    map[string]interface{}{"id": 1, "v": 2, ImplicitRowIDColumn: 7},
+			OldValues: map[string]interface{}{"id": 1, "v": 1, ImplicitRowIDColumn: 7},
+		}
+	}
+
+	ld := &loaderImpl{includeRowID: true}
+	// the row of the table without primary key or unique key is identified by the row id
+	dml := newUpdate("no_pk")
+	c.Assert(ld.prepareDMLs([]*DML{dml}), check.IsNil)
+	sql, args := dml.updateSQL()
+	c.Assert(sql, check.Equals, "UPDATE `test`.`no_pk` SET `id` = ?,`v` = ?,`_tidb_rowid` = ? WHERE `_tidb_rowid` = ? LIMIT 1")
+	c.Assert(args, check.DeepEquals, []interface{}{1, 2, 7, 7})
+	sql, args = dml.deleteSQL()
+	c.Assert(sql, check.Equals, "DELETE FROM `test`.`no_pk` WHERE `_tidb_rowid` = ? LIMIT 1")
+	c.Assert(args, check.DeepEquals, []interface{}{7})
+	c.Assert(getKeys(dml), check.DeepEquals, []string{"(_tidb_rowid: 7)`test`.`no_pk`", "(_tidb_rowid: 7)`test`.`no_pk`"})
+
+	// the unique key is used if there's any
+	dml = newUpdate("has_uk")
+	c.Assert(ld.prepareDMLs([]*DML{dml}), check.IsNil)
+	sql, _ = dml.updateSQL()
+	c.Assert(sql, check.Equals, "UPDATE `test`.`has_uk` SET `id` = ?,`v` = ?,`_tidb_rowid` = ? WHERE `id` = ? LIMIT 1")
+
+	// the row id is dropped if downstream has no such column
+	dml = newUpdate("no_rowid")
+	c.Assert(ld.prepareDMLs([]*DML{dml}), check.IsNil)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"id": 1, "v": 2})
+	sql, _ = dml.updateSQL()
+	c.Assert(sql, check.Equals, "UPDATE `test`.`no_rowid` SET `id` = ?,`v` = ? WHERE `id` = ? AND `v` = ? LIMIT 1")
+
+	// or it's excluded
+	ld = &loaderImpl{}
+	dml = newUpdate("no_pk")
+	c.Assert(ld.prepareDMLs([]*DML{dml}), check.IsNil)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"id": 1, "v": 2})
+	c.Assert(dml.OldValues, check.DeepEquals, map[string]interface{}{"id": 1, "v": 1})
+}
+
 type groupDMLsSuite struct{}
 
 var _ = check.Suite(&groupDMLsSuite{})
@@ -240,6 +352,18 @@ func (s *isCreateDBDDLSuite) TestCreateDBSQL(c *check.C) {
 	c.Assert(isCreateDatabaseDDL("create database `db2`;"), check.IsTrue)
 }
 
+func (s *isCreateDBDDLSuite) TestSequenceSQL(c *check.C) {
+	c.Assert(isCreateDatabaseDDL("CREATE SEQUENCE seq;"), check.IsFalse)
+}
+
+func (s *isCreateDBDDLSuite) TestMultiValuedIndexSQL(c *check.C) {
+	c.Assert(isCreateDatabaseDDL("CREATE INDEX idx ON t ((CAST(j AS UNSIGNED ARRAY)))"), check.IsFalse)
+}
+
+func (s *isCreateDBDDLSuite) TestGlobalTemporaryTableSQL(c *check.C) {
+	c.Assert(isCreateDatabaseDDL("CREATE GLOBAL TEMPORARY TABLE t(id int) ON COMMIT DELETE ROWS"), check.IsFalse)
+}
+
 type needRefreshTableInfoSuite struct{}
 
 var _ = check.Suite(&needRefreshTableInfoSuite{})
@@ -251,6 +375,17 @@ func (s *needRefreshTableInfoSuite) TestNeedRefreshTableInfo(c *check.C) {
 		"TRUNCATE TABLE a":       false,
 		"CREATE DATABASE a":      false,
 		"CREATE TABLE a(id int)": true,
+		"CREATE SEQUENCE seq":    false,
+		"ALTER SEQUENCE seq":     false,
+		"DROP SEQUENCE seq":      false,
+		// the unique indexes may be used as the keys of the DMLs of the table
+		"ALTER TABLE a ADD UNIQUE INDEX uk(id) INVISIBLE": true,
+		"ALTER TABLE a ALTER INDEX uk VISIBLE":            true,
+		"DROP INDEX uk ON a":                              true,
+		// the multi-valued indexes can't be parsed, but they change the table info too
+		"ALTER TABLE a ADD INDEX idx((CAST(j AS UNSIGNED ARRAY)))": true,
+		// so do the global temporary tables
+		"CREATE GLOBAL TEMPORARY TABLE a(id int) ON COMMIT DELETE ROWS": true,
 	}
 
 	for sql, res := range cases {
@@ -277,6 +412,68 @@ func (s *execDDLSuite) TestShouldExecInTransaction(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *execDDLSuite) TestExecIndexDDL(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	loader := &loaderImpl{db: db, ctx: context.Background(), quote: pkgsql.BacktickQuote, validateSQL: true}
+	// the index DDLs including the visibility of the index are applied to downstream as they are
+	sqls := []string{
+		"ALTER TABLE t ADD INDEX idx(a) INVISIBLE",
+		"CREATE UNIQUE INDEX uk ON t(b) INVISIBLE",
+		"ALTER TABLE t ALTER INDEX idx VISIBLE",
+		"ALTER TABLE t ALTER INDEX uk INVISIBLE",
+		"ALTER TABLE t DROP INDEX idx",
+	}
+	for _, sql := range sqls {
+		mock.ExpectBegin()
+		mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("^" + regexp.QuoteMeta(sql) + "$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		c.Assert(loader.execDDL(&DDL{Database: "test", Table: "t", SQL: sql}), check.IsNil)
+	}
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *execDDLSuite) TestIgnoreErrorCodes(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE").WillReturnError(&mysql.MySQLError{Number: 1050, Message: "Table already exists"})
+	mock.ExpectRollback()
+
+	codes, err := newIgnoreErrorCodes([]int{1050})
+	c.Assert(err, check.IsNil)
+	loader := &loaderImpl{db: db, ctx: context.Background(), ignoreErrorCodes: codes}
+
+	ddl := DDL{SQL: "CREATE TABLE"}
+	err = loader.execDDL(&ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *execDDLSuite) TestNarrowColumnType(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	// the error is returned without retrying
+	sql := "ALTER TABLE t MODIFY COLUMN a VARCHAR(2)"
+	mock.ExpectBegin()
+	mock.ExpectExec("ALTER TABLE").WillReturnError(&mysql.MySQLError{Number: 1265, Message: "Data truncated for column 'a' at row 1"})
+	mock.ExpectRollback()
+
+	loader := &loaderImpl{db: db, ctx: context.Background()}
+	err = loader.execDDL(&DDL{SQL: sql})
+	c.Assert(err, check.ErrorMatches, ".*change column type failed.*ddl: ALTER TABLE t MODIFY COLUMN a VARCHAR\\(2\\).*Data truncated.*")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	c.Assert(isColumnTypeChangeDDL(sql), check.IsTrue)
+	c.Assert(isColumnTypeChangeDDL("ALTER TABLE t CHANGE COLUMN a b BIGINT"), check.IsTrue)
+	c.Assert(isColumnTypeChangeDDL("ALTER TABLE t ADD COLUMN b BIGINT"), check.IsFalse)
+	c.Assert(isColumnTypeChangeDDL("CREATE TABLE t(a INT)"), check.IsFalse)
+}
+
 func (s *execDDLSuite) TestShouldUseDatabase(c *check.C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, check.IsNil)
@@ -378,6 +575,145 @@ func (s *batchManagerSuite) TestShouldExecAccumulatedDMLs(c *check.C) {
 	c.Assert(bm.txns, check.HasLen, 1)
 }
 
+func (s *batchManagerSuite) TestReportTxnsWithoutDMLs(c *check.C) {
+	var calledback []*Txn
+	bm := batchManager{
+		limit: 3,
+		fExecDMLs: func(dmls []*DML) error {
+			c.Fatal("no DMLs should be executed")
+			return nil
+		},
+		fDMLsSuccessCallback: func(txns ...*Txn) {
+			calledback = append(calledback, txns...)
+		},
+	}
+	// the DMLs of txn may be collapsed to nothing by coalescing
+	txn := &Txn{}
+	c.Assert(bm.put(txn), check.IsNil)
+	c.Assert(calledback, check.HasLen, 0)
+	c.Assert(bm.execAccumulatedDMLs(), check.IsNil)
+	c.Assert(calledback, check.DeepEquals, []*Txn{txn})
+	c.Assert(bm.txns, check.HasLen, 0)
+}
+
+func (s *batchManagerSuite) TestSendDMLsToDeadLetter(c *check.C) {
+	poison := &mysql.MySQLError{Number: 1406, Message: "Data too long"}
+	var calledback, deadLetters []*Txn
+	var executed []*Txn
+	bm := batchManager{
+		limit: 1024,
+		fExecDMLs: func(dmls []*DML) error {
+			return poison
+		},
+		fExecTxn: func(txn *Txn) error {
+			executed = append(executed, txn)
+			if txn.Metadata == 2 {
+				return poison
+			}
+			return nil
+		},
+		fDMLsSuccessCallback: func(txns ...*Txn) {
+			calledback = append(calledback, txns...)
+		},
+	}
+
+	var txns []*Txn
+	for i := 1; i <= 3; i++ {
+		txn := &Txn{DMLs: []*DML{{}}, Metadata: i}
+		txns = append(txns, txn)
+		c.Assert(bm.put(txn), check.IsNil)
+	}
+
+	// the loader quits if dead letter is disabled
+	c.Assert(bm.execAccumulatedDMLs(), check.ErrorMatches, ".*Data too long.*")
+	c.Assert(calledback, check.HasLen, 0)
+
+	bm.fDeadLetter = func(txn *Txn, err error) error {
+		c.Assert(err, check.Equals, poison)
+		deadLetters = append(deadLetters, txn)
+		return nil
+	}
+	c.Assert(bm.execAccumulatedDMLs(), check.IsNil)
+	c.Assert(executed, check.DeepEquals, txns)
+	c.Assert(deadLetters, check.DeepEquals, txns[1:2])
+	c.Assert(calledback, check.DeepEquals, txns)
+	c.Assert(bm.txns, check.HasLen, 0)
+	c.Assert(bm.dmls, check.HasLen, 0)
+}
+
+func (s *batchManagerSuite) TestNotSendTransientErrorToDeadLetter(c *check.C) {
+	var deadLetters []*Txn
+	bm := batchManager{
+		limit: 1024,
+		fExecDMLs: func(dmls []*DML) error {
+			return &mysql.MySQLError{Number: 1406}
+		},
+		fExecTxn: func(txn *Txn) error {
+			return errors.New("invalid connection")
+		},
+		fDeadLetter: func(txn *Txn, err error) error {
+			deadLetters = append(deadLetters, txn)
+			return nil
+		},
+	}
+	c.Assert(bm.put(&Txn{DMLs: []*DML{{}}}), check.IsNil)
+	c.Assert(bm.execAccumulatedDMLs(), check.ErrorMatches, "invalid connection")
+	c.Assert(deadLetters, check.HasLen, 0)
+
+	// the downstream is unavailable, don't send all the txns to dead letter
+	bm.fExecDMLs = func(dmls []*DML) error {
+		return &mysql.MySQLError{Number: 1040, Message: "Too many connections"}
+	}
+	c.Assert(bm.execAccumulatedDMLs(), check.ErrorMatches, ".*Too many connections.*")
+	c.Assert(deadLetters, check.HasLen, 0)
+
+	// the write conflict is returned to be retried
+	bm.fExecDMLs = func(dmls []*DML) error {
+		return &mysql.MySQLError{Number: 9007, Message: "Write conflict"}
+	}
+	c.Assert(bm.execAccumulatedDMLs(), check.ErrorMatches, ".*Write conflict.*")
+	c.Assert(deadLetters, check.HasLen, 0)
+	c.Assert(bm.txns, check.HasLen, 1)
+
+	for _, code := range []uint16{8027, 8028, 9001, 9002, 9005, 9007} {
+		c.Assert(isPermanentError(&mysql.MySQLError{Number: code}), check.IsFalse)
+	}
+	for _, code := range []uint16{1048, 1054, 1062, 1146, 1264, 1406, 1452} {
+		c.Assert(isPermanentError(&mysql.MySQLError{Number: code}), check.IsTrue)
+	}
+}
+
+func (s *batchManagerSuite) TestSendDDLToDeadLetter(c *check.C) {
+	var nCalled int
+	var deadLetters []*Txn
+	bm := batchManager{
+		limit: 1024,
+		fExecDDL: func(ddl *DDL) error {
+			return &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}
+		},
+		fDDLSuccessCallback: func(t *Txn) {
+			nCalled++
+		},
+		fDeadLetter: func(txn *Txn, err error) error {
+			deadLetters = append(deadLetters, txn)
+			return nil
+		},
+	}
+	txn := &Txn{
+		DDL: &DDL{Database: "test", Table: "Hey", SQL: "CREATE"},
+	}
+	c.Assert(bm.put(txn), check.IsNil)
+	c.Assert(deadLetters, check.DeepEquals, []*Txn{txn})
+	c.Assert(nCalled, check.Equals, 1)
+
+	// the loader quits if it fails to write the dead letter
+	bm.fDeadLetter = func(txn *Txn, err error) error {
+		return errors.New("disk is full")
+	}
+	c.Assert(bm.put(txn), check.ErrorMatches, ".*disk is full.*")
+	c.Assert(nCalled, check.Equals, 1)
+}
+
 type txnManagerSuite struct{}
 
 var _ = check.Suite(&txnManagerSuite{})
@@ -613,6 +949,42 @@ func (s *runSuite) TestShouldFlushWhenInputIsEmpty(c *check.C) {
 	assertExecuted(7)
 }
 
+func (s *runSuite) TestRelaxedOrder(c *check.C) {
+	loader := &loaderImpl{
+		input:        make(chan *Txn, 10),
+		successTxn:   make(chan *Txn, 10),
+		relaxedOrder: true,
+	}
+	origF := fNewTxnScheduler
+	fNewTxnScheduler = func(*loaderImpl) *txnScheduler {
+		sched := &txnScheduler{
+			limit:       1024,
+			fPrepareTxn: func(*Txn) error { return nil },
+			fExecTxn: func(txn *Txn) error {
+				// the earlier txns are applied later
+				time.Sleep(time.Duration(10-txn.Metadata.(int64)) * 5 * time.Millisecond)
+				return nil
+			},
+			fSuccessTxns: loader.markSuccess,
+		}
+		sched.start(4)
+		return sched
+	}
+	defer func() { fNewTxnScheduler = origF }()
+
+	for i := 1; i <= 6; i++ {
+		loader.input <- schedTxn(int64(i), i)
+	}
+	close(loader.input)
+
+	c.Assert(loader.Run(), check.IsNil)
+	var reported []int64
+	for txn := range loader.successTxn {
+		reported = append(reported, txn.Metadata.(int64))
+	}
+	c.Assert(reported, check.DeepEquals, []int64{1, 2, 3, 4, 5, 6})
+}
+
 type markSuccessesSuite struct{}
 
 var _ = check.Suite(&markSuccessesSuite{})
@@ -654,3 +1026,24 @@ func (ms *markSuccessesSuite) TestShouldSetAppliedTS(c *check.C) {
 	loader.markSuccess(txns...)
 	c.Assert(txns[len(txns)-1].AppliedTS, check.Equals, int64(88881234))
 }
+
+type initMarkTableSuite struct{}
+
+var _ = check.Suite(&initMarkTableSuite{})
+
+func (s *initMarkTableSuite) TestTableOptions(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `tidb_binlog`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `tidb_binlog`.`_drainer_repl_mark` (`channel_id` BIGINT NOT NULL, `id` BIGINT NOT NULL, `val` BIGINT NOT NULL DEFAULT 0, PRIMARY KEY (`channel_id`, `id`)) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	loader := &loaderImpl{
+		db:               db,
+		loopBackSyncInfo: loopbacksync.NewLoopBackSyncInfo(1, true),
+		tableOptions:     pkgsql.TableOptions{Charset: "utf8mb4", Collation: "utf8mb4_bin"},
+	}
+	c.Assert(loader.initMarkTable(), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/terror"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+const (
+	// LockedTableRetry retries the writes rejected by the locked or read-only table like other errors
+	LockedTableRetry = "retry"
+	// LockedTableWait waits until the table is writable, the waiting doesn't count into the retry count
+	LockedTableWait = "wait"
+	// LockedTableFail fails immediately without retrying
+	LockedTableFail = "fail"
+)
+
+// the interval to retry the writes when waiting for the locked or read-only table
+var lockedTableWaitInterval = time.Second
+
+// lockedTableErrorCodes mean the table is locked by LOCK TABLES or a DDL, or downstream is read-only
+var lockedTableErrorCodes = map[terror.ErrCode]struct{}{
+	tmysql.ErrOpenAsReadonly:                   {},
+	tmysql.ErrTableNotLockedForWrite:           {},
+	tmysql.ErrTableNotLocked:                   {},
+	tmysql.ErrOptionPreventsStatement:          {},
+	tmysql.ErrCantExecuteInReadOnlyTransaction: {},
+	tmysql.ErrTableLocked:                      {},
+}
+
+func isLockedTableError(err error) bool {
+	code, ok := pkgsql.GetSQLErrCode(err)
+	if !ok {
+		return false
+	}
+	_, ok = lockedTableErrorCodes[code]
+	return ok
+}
+
+func checkLockedTablePolicy(policy string) error {
+	switch policy {
+	case "", LockedTableRetry, LockedTableWait, LockedTableFail:
+		return nil
+	default:
+		return errors.Errorf("unknown locked table policy %s, must be %s, %s or %s", policy, LockedTableRetry, LockedTableWait, LockedTableFail)
+	}
+}
+
+// retryLockedTable calls fn until it succeeds for at most retryCount times by retryPolicy,
+// the errors of the locked or read-only table are handled by policy, and logged through sampler.
+// The time waiting for the locked table counts into the budget of retryPolicy.
+func retryLockedTable(ctx context.Context, policy string, retryPolicy RetryPolicy, sampler *util.LogSampler, retryCount int, backoff time.Duration, fn func(context.Context) error) error {
+	var lockedErr error
+	err := retryPolicy.retry(ctx, retryCount, backoff, func(ctx context.Context) error {
+		var waitStart time.Time
+		for {
+			err := fn(ctx)
+			if err == nil || !isLockedTableError(err) {
+				if !waitStart.IsZero() && err == nil {
+					log.Info("downstream table is writable again", zap.Duration("waited", time.Since(waitStart)))
+				}
+				return err
+			}
+
+			switch policy {
+			case LockedTableFail:
+				lockedErr = err
+				return nil
+			case LockedTableWait:
+				if waitStart.IsZero() {
+					waitStart = time.Now()
+				}
+				sampler.Warn("downstream table is locked or read-only, wait until it's writable", err,
+					zap.Duration("waited", time.Since(waitStart)))
+				select {
+				case <-ctx.Done():
+					return errors.Trace(ctx.Err())
+				case <-time.After(lockedTableWaitInterval):
+				}
+			default:
+				sampler.Warn("downstream table is locked or read-only, retry", err)
+				return err
+			}
+		}
+	})
+	if lockedErr != nil {
+		return errors.Annotate(lockedErr, "downstream table is locked or read-only")
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+)
+
+type lockedTableSuite struct{}
+
+var _ = check.Suite(&lockedTableSuite{})
+
+var errTableNotLockedForWrite = &mysql.MySQLError{Number: 1099, Message: "Table 't' was locked with a READ lock and can't be updated"}
+
+func (s *lockedTableSuite) SetUpTest(c *check.C) {
+	lockedTableWaitInterval = time.Millisecond
+}
+
+func (s *lockedTableSuite) TearDownTest(c *check.C) {
+	lockedTableWaitInterval = time.Second
+}
+
+func (s *lockedTableSuite) TestIsLockedTableError(c *check.C) {
+	c.Assert(isLockedTableError(errTableNotLockedForWrite), check.IsTrue)
+	c.Assert(isLockedTableError(errors.Trace(&mysql.MySQLError{Number: 1290, Message: "The MySQL server is running with the --super-read-only option"})), check.IsTrue)
+	c.Assert(isLockedTableError(errTooManyConnections), check.IsFalse)
+	// the lock wait timeout is the contention of rows, it's retried like other errors
+	c.Assert(isLockedTableError(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}), check.IsFalse)
+	c.Assert(isLockedTableError(errors.New("other error")), check.IsFalse)
+	c.Assert(isLockedTableError(nil), check.IsFalse)
+}
+
+func (s *lockedTableSuite) TestCheckPolicy(c *check.C) {
+	for _, policy := range []string{"", LockedTableRetry, LockedTableWait, LockedTableFail} {
+		c.Assert(checkLockedTablePolicy(policy), check.IsNil)
+	}
+	c.Assert(checkLockedTablePolicy("skip"), check.ErrorMatches, "unknown locked table policy skip.*")
+}
+
+func (s *lockedTableSuite) TestRetryPolicy(c *check.C) {
+	var calls int
+	err := retryLockedTable(context.Background(), LockedTableRetry, RetryPolicy{}, nil, 3, 0, func(context.Context) error {
+		calls++
+		return errTableNotLockedForWrite
+	})
+	c.Assert(errors.Cause(err), check.Equals, errTableNotLockedForWrite)
+	c.Assert(calls, check.Equals, 3)
+}
+
+func (s *lockedTableSuite) TestFailPolicy(c *check.C) {
+	var calls int
+	err := retryLockedTable(context.Background(), LockedTableFail, RetryPolicy{}, nil, 3, 0, func(context.Context) error {
+		calls++
+		return errTableNotLockedForWrite
+	})
+	c.Assert(err, check.ErrorMatches, "downstream table is locked or read-only.*")
+	c.Assert(errors.Cause(err), check.Equals, errTableNotLockedForWrite)
+	c.Assert(calls, check.Equals, 1)
+
+	// the other errors are still retried
+	calls = 0
+	err = retryLockedTable(context.Background(), LockedTableFail, RetryPolicy{}, nil, 3, 0, func(context.Context) error {
+		calls++
+		return errors.New("other error")
+	})
+	c.Assert(err, check.ErrorMatches, "other error")
+	c.Assert(calls, check.Equals, 3)
+}
+
+func (s *lockedTableSuite) TestWaitPolicy(c *check.C) {
+	// waiting doesn't consume the retry count
+	var calls int
+	err := retryLockedTable(context.Background(), LockedTableWait, RetryPolicy{}, nil, 1, 0, func(context.Context) error {
+		calls++
+		if calls < 5 {
+			return errTableNotLockedForWrite
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(calls, check.Equals, 5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = retryLockedTable(ctx, LockedTableWait, RetryPolicy{}, nil, 1, 0, func(context.Context) error {
+		return errTableNotLockedForWrite
+	})
+	c.Assert(errors.Cause(err), check.Equals, context.DeadlineExceeded)
+}
+
+func (s *lockedTableSuite) TestExecutorWaitsForLockedTable(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	e := newExecutor(db).withLockedTablePolicy(LockedTableWait)
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`.`t`").WillReturnError(errTableNotLockedForWrite)
+		mock.ExpectRollback()
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `test`.`t`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       DeleteDMLType,
+		Values:   map[string]interface{}{"id": 1},
+		info:     schedTableInfo,
+	}
+	err = e.singleExecRetry(context.Background(), []*DML{dml}, false, 1, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *lockedTableSuite) TestLoaderFailsFastOnLockedTable(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	l, err := NewLoader(db, LockedTablePolicy(LockedTableFail))
+	c.Assert(err, check.IsNil)
+	loader := l.(*loaderImpl)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE t ADD COLUMN c INT").WillReturnError(errTableNotLockedForWrite)
+	mock.ExpectRollback()
+
+	err = loader.execDDL(&DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN c INT"})
+	c.Assert(err, check.ErrorMatches, "downstream table is locked or read-only.*")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	_, err = NewLoader(db, LockedTablePolicy("skip"))
+	c.Assert(err, check.ErrorMatches, "unknown locked table policy skip.*")
+}
+
+func (s *lockedTableSuite) TestSampleRepetitiveErrorLogs(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	e := newExecutor(db).withLockedTablePolicy(LockedTableWait).withLogSampler(util.NewLogSampler(time.Minute))
+
+	for i := 0; i < 10; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`.`t`").WillReturnError(errTableNotLockedForWrite)
+		mock.ExpectRollback()
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `test`.`t`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var hook util.LogHook
+	hook.SetUp()
+	defer hook.TearDown()
+
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       DeleteDMLType,
+		Values:   map[string]interface{}{"id": 1},
+		info:     schedTableInfo,
+	}
+	err = e.singleExecRetry(context.Background(), []*DML{dml}, false, 1, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the identical errors are only logged once in the interval
+	counts := make(map[string]int)
+	for _, entry := range hook.Entrys {
+		counts[entry.Message]++
+	}
+	c.Assert(counts["Exec fail, will rollback"], check.Equals, 1)
+	c.Assert(counts["downstream table is locked or read-only, wait until it's writable"], check.Equals, 1)
+}
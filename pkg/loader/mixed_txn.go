@@ -0,0 +1,58 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+)
+
+const (
+	// MixedTxnSplit splits the txn carrying both DMLs and a DDL at the DDL boundary, the DMLs are applied
+	// in one downstream transaction first, and then the DDL is executed. The DDL commits implicitly in MySQL
+	// and TiDB, so the txn is applied as two atomic pieces. A failure between them leaves the DMLs applied,
+	// and the whole txn is applied again after restarting, so the DMLs should be idempotent (e.g. in safe mode).
+	MixedTxnSplit = "split"
+	// MixedTxnFail fails the txn carrying both DMLs and a DDL without applying any of them
+	MixedTxnFail = "fail"
+)
+
+func checkMixedTxnPolicy(policy string) error {
+	switch policy {
+	case "", MixedTxnSplit, MixedTxnFail:
+		return nil
+	default:
+		return errors.Errorf("unknown mixed txn policy %s, must be %s or %s", policy, MixedTxnSplit, MixedTxnFail)
+	}
+}
+
+// execMixedDMLs applies the DMLs of the txn carrying a DDL by the mixed txn policy, before the DDL is executed.
+// skipped is true if the DMLs fail permanently and the whole txn is sent to the dead letter.
+func (b *batchManager) execMixedDMLs(txn *Txn) (skipped bool, err error) {
+	if b.mixedTxnPolicy == MixedTxnFail {
+		return false, errors.Errorf("txn with both %d DMLs and a DDL is rejected by mixed txn policy %s, ddl: %s",
+			len(txn.DMLs), MixedTxnFail, txn.DDL.SQL)
+	}
+
+	err = b.fExecTxnAtomically(txn)
+	if err == nil {
+		return false, nil
+	}
+	if b.fDeadLetter == nil || !isPermanentError(err) {
+		return false, errors.Annotatef(err, "exec the DMLs before ddl %s failed", txn.DDL.SQL)
+	}
+	if err := b.sendDeadLetter(txn, err); err != nil {
+		return false, errors.Trace(err)
+	}
+	return true, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	check "github.com/pingcap/check"
+)
+
+type mixedTxnSuite struct{}
+
+var _ = check.Suite(&mixedTxnSuite{})
+
+// newMixedTxnBatchManager records the order of the executions to steps
+func newMixedTxnBatchManager(steps *[]string) *batchManager {
+	return &batchManager{
+		limit: 1024,
+		fExecDMLs: func(dmls []*DML) error {
+			*steps = append(*steps, fmt.Sprintf("dmls %d", len(dmls)))
+			return nil
+		},
+		fExecTxnAtomically: func(txn *Txn) error {
+			*steps = append(*steps, fmt.Sprintf("txn dmls %d", len(txn.DMLs)))
+			return nil
+		},
+		fExecDDL: func(ddl *DDL) error {
+			*steps = append(*steps, "ddl "+ddl.SQL)
+			return nil
+		},
+		fDMLsSuccessCallback: func(txns ...*Txn) {
+			*steps = append(*steps, fmt.Sprintf("success %d txns", len(txns)))
+		},
+		fDDLSuccessCallback: func(txn *Txn) {
+			*steps = append(*steps, fmt.Sprintf("success %v", txn.Metadata))
+		},
+	}
+}
+
+func (s *mixedTxnSuite) TestSplitAtDDL(c *check.C) {
+	var steps []string
+	bm := newMixedTxnBatchManager(&steps)
+
+	c.Assert(bm.put(&Txn{DMLs: []*DML{{}, {}}}), check.IsNil)
+	mixed := &Txn{
+		DMLs:     []*DML{{}, {}, {}},
+		DDL:      &DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN c INT"},
+		Metadata: "mixed",
+	}
+	c.Assert(bm.put(mixed), check.IsNil)
+	c.Assert(bm.put(&Txn{DMLs: []*DML{{}}}), check.IsNil)
+	c.Assert(bm.execAccumulatedDMLs(), check.IsNil)
+
+	// the txns before are applied first, then the DMLs of the mixed txn in one transaction and the DDL,
+	// and the mixed txn is reported once after both
+	c.Assert(steps, check.DeepEquals, []string{
+		"dmls 2",
+		"success 1 txns",
+		"txn dmls 3",
+		"ddl ALTER TABLE t ADD COLUMN c INT",
+		"success mixed",
+		"dmls 1",
+		"success 1 txns",
+	})
+}
+
+func (s *mixedTxnSuite) TestFailMixedTxn(c *check.C) {
+	var steps []string
+	bm := newMixedTxnBatchManager(&steps)
+	bm.mixedTxnPolicy = MixedTxnFail
+
+	mixed := &Txn{DMLs: []*DML{{}}, DDL: &DDL{Database: "test", Table: "t", SQL: "DROP TABLE t"}}
+	c.Assert(bm.put(mixed), check.ErrorMatches, "txn with both 1 DMLs and a DDL is rejected by mixed txn policy fail, ddl: DROP TABLE t")
+	c.Assert(steps, check.HasLen, 0)
+
+	// the DDL txns without DMLs are not affected
+	c.Assert(bm.put(&Txn{DDL: mixed.DDL, Metadata: "ddl"}), check.IsNil)
+	c.Assert(steps, check.DeepEquals, []string{"ddl DROP TABLE t", "success ddl"})
+}
+
+func (s *mixedTxnSuite) TestMixedTxnDMLsFail(c *check.C) {
+	var steps []string
+	bm := newMixedTxnBatchManager(&steps)
+	poison := &mysql.MySQLError{Number: 1406, Message: "Data too long"}
+	bm.fExecTxnAtomically = func(txn *Txn) error {
+		return poison
+	}
+
+	mixed := &Txn{DMLs: []*DML{{}}, DDL: &DDL{Database: "test", Table: "t", SQL: "DROP TABLE t"}, Metadata: "mixed"}
+	c.Assert(bm.put(mixed), check.ErrorMatches, "exec the DMLs before ddl DROP TABLE t failed: .*Data too long")
+	c.Assert(steps, check.HasLen, 0)
+
+	// the whole txn is sent to the dead letter, and the DDL is not executed
+	var deadLetters []*Txn
+	bm.fDeadLetter = func(txn *Txn, err error) error {
+		deadLetters = append(deadLetters, txn)
+		return nil
+	}
+	c.Assert(bm.put(mixed), check.IsNil)
+	c.Assert(deadLetters, check.DeepEquals, []*Txn{mixed})
+	c.Assert(steps, check.DeepEquals, []string{"success mixed"})
+}
+
+func (s *mixedTxnSuite) TestApplyMixedTxn(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	_, err = NewLoader(db, MixedTxnPolicy("merge"))
+	c.Assert(err, check.ErrorMatches, "unknown mixed txn policy merge, must be split or fail")
+
+	l, err := NewLoader(db, BatchSize(1))
+	c.Assert(err, check.IsNil)
+	loader := l.(*loaderImpl)
+	loader.tableInfos.Store(quoteSchema("test", "t"), &tableInfo{
+		columns:    []string{"id"},
+		primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}},
+	})
+	bm := newBatchManager(loader)
+	var reported []*Txn
+	bm.fDDLSuccessCallback = func(txn *Txn) {
+		reported = append(reported, txn)
+	}
+
+	newInsert := func(id int) *DML {
+		return &DML{Database: "test", Table: "t", Tp: InsertDMLType, Values: map[string]interface{}{"id": id}}
+	}
+	mixed := &Txn{
+		DMLs: []*DML{newInsert(1), newInsert(2)},
+		DDL:  &DDL{Database: "test", Table: "t", SQL: "ALTER TABLE t ADD COLUMN c INT"},
+	}
+
+	// the DMLs are applied in one transaction though the batch size is 1, and then the DDL
+	insertSQL := regexp.QuoteMeta("INSERT INTO `test`.`t`(`id`) VALUES(?)")
+	mock.ExpectBegin()
+	mock.ExpectExec(insertSQL).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertSQL).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(mixed.DDL.SQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	c.Assert(bm.put(mixed), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	c.Assert(reported, check.DeepEquals, []*Txn{mixed})
+}
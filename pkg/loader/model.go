@@ -18,10 +18,16 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"go.uber.org/zap"
 )
 
+// ImplicitRowIDColumn is the column of the row id of TiDB tables without integer primary key,
+// it's set in the values of DML if the row id is replicated.
+const ImplicitRowIDColumn = "_tidb_rowid"
+
 // DMLType represents the dml type
 type DMLType int
 
@@ -42,8 +48,12 @@ type DML struct {
 	// only set when Tp = UpdateDMLType
 	OldValues map[string]interface{}
 	Values    map[string]interface{}
+	// the values of the columns which may not exist in downstream, e.g. the metadata of the row,
+	// they're written only if the columns exist in downstream.
+	OptionalValues map[string]interface{}
 
-	info *tableInfo
+	info  *tableInfo
+	quote pkgsql.IdentifierQuote
 }
 
 // DDL holds the ddl info
@@ -53,7 +63,8 @@ type DDL struct {
 	SQL      string
 }
 
-// Txn holds transaction info, an DDL or DML sequences
+// Txn holds transaction info, an DDL or DML sequences.
+// The txn carrying both DMLs and a DDL is applied by the MixedTxnPolicy, the DMLs are applied before the DDL.
 type Txn struct {
 	DMLs []*DML
 	DDL  *DDL
@@ -156,9 +167,38 @@ func (dml *DML) oldPrimaryKeyValues() []interface{} {
 	return values
 }
 
+// checkElems checks the values of ENUM and SET columns are members defined in downstream,
+// they're written by names, so a value missing in downstream means the definitions differ.
+func (dml *DML) checkElems() error {
+	for col, elems := range dml.info.elems {
+		for _, values := range []map[string]interface{}{dml.Values, dml.OldValues} {
+			var value string
+			switch v := values[col].(type) {
+			case string:
+				value = v
+			case []byte:
+				value = string(v)
+			default:
+				// NULL, or the value is written by index
+				continue
+			}
+
+			if !elems.has(value) {
+				tp := "ENUM"
+				if elems.isSet {
+					tp = "SET"
+				}
+				return errors.Errorf("value %q of %s column %s isn't a member of %q in downstream table %s, the definitions of upstream and downstream may differ",
+					value, tp, col, elems.names, dml.TableName())
+			}
+		}
+	}
+	return nil
+}
+
 // TableName returns the fully qualified name of the DML's table
 func (dml *DML) TableName() string {
-	return quoteSchema(dml.Database, dml.Table)
+	return dml.quote.Schema(dml.Database, dml.Table)
 }
 
 func (dml *DML) updateSQL() (sql string, args []interface{}) {
@@ -166,11 +206,16 @@ func (dml *DML) updateSQL() (sql string, args []interface{}) {
 
 	fmt.Fprintf(builder, "UPDATE %s SET ", dml.TableName())
 
-	for name, arg := range dml.Values {
+	// in the order of columns, so the DMLs of the same columns generate the same SQL
+	for _, name := range dml.info.columns {
+		arg, ok := dml.Values[name]
+		if !ok {
+			continue
+		}
 		if len(args) > 0 {
 			builder.WriteByte(',')
 		}
-		fmt.Fprintf(builder, "%s = ?", quoteName(name))
+		fmt.Fprintf(builder, "%s = ?", dml.quote.Name(name))
 		args = append(args, arg)
 	}
 
@@ -191,9 +236,9 @@ func (dml *DML) buildWhere(builder *strings.Builder) (args []interface{}) {
 			builder.WriteString(" AND ")
 		}
 		if wargs[i] == nil {
-			builder.WriteString(quoteName(wnames[i]) + " IS NULL")
+			builder.WriteString(dml.quote.Name(wnames[i]) + " IS NULL")
 		} else {
-			builder.WriteString(quoteName(wnames[i]) + " = ?")
+			builder.WriteString(dml.quote.Name(wnames[i]) + " = ?")
 			args = append(args, wargs[i])
 		}
 	}
@@ -246,7 +291,7 @@ func (dml *DML) deleteSQL() (sql string, args []interface{}) {
 
 func (dml *DML) replaceSQL() (sql string, args []interface{}) {
 	info := dml.info
-	sql = fmt.Sprintf("REPLACE INTO %s(%s) VALUES(%s)", dml.TableName(), buildColumnList(info.columns), holderString(len(info.columns)))
+	sql = fmt.Sprintf("REPLACE INTO %s(%s) VALUES(%s)", dml.TableName(), buildColumnList(dml.quote, info.columns), holderString(len(info.columns)))
 	for _, name := range info.columns {
 		v := dml.Values[name]
 		args = append(args, v)
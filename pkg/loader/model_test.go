@@ -17,6 +17,7 @@ import (
 	"strings"
 
 	check "github.com/pingcap/check"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 )
 
 type dmlSuite struct {
@@ -228,3 +229,91 @@ func (s *SQLSuite) TestUpdateSQL(c *check.C) {
 	c.Assert(args[0], check.Equals, "pc")
 	c.Assert(args[1], check.Equals, "pingcap")
 }
+
+func (s *SQLSuite) TestCompositePrimaryKeySQL(c *check.C) {
+	// the clustered primary key (c, a) and the unique key (b)
+	info := &tableInfo{
+		columns:    []string{"a", "b", "c", "d"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"c", "a"}}, {"uk", []string{"b"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+
+	dml := DML{
+		Tp:        UpdateDMLType,
+		Database:  "db",
+		Table:     "tbl",
+		Values:    map[string]interface{}{"a": 1, "b": "x", "c": "k", "d": 20},
+		OldValues: map[string]interface{}{"a": 1, "b": "x", "c": "k", "d": 10},
+		info:      info,
+	}
+	sql, args := dml.sql()
+	c.Assert(sql, check.Equals,
+		"UPDATE `db`.`tbl` SET `a` = ?,`b` = ?,`c` = ?,`d` = ? WHERE `c` = ? AND `a` = ? LIMIT 1")
+	c.Assert(args, check.DeepEquals, []interface{}{1, "x", "k", 20, "k", 1})
+
+	dml.Tp = DeleteDMLType
+	dml.OldValues = nil
+	sql, args = dml.sql()
+	c.Assert(sql, check.Equals, "DELETE FROM `db`.`tbl` WHERE `c` = ? AND `a` = ? LIMIT 1")
+	c.Assert(args, check.DeepEquals, []interface{}{"k", 1})
+}
+
+func (s *SQLSuite) TestDoubleQuote(c *check.C) {
+	info := &tableInfo{columns: []string{"id", "na\"me"}}
+	dml := DML{
+		Tp:       UpdateDMLType,
+		Database: "db",
+		Table:    "tbl",
+		Values: map[string]interface{}{
+			"id":     1,
+			"na\"me": "pc",
+		},
+		OldValues: map[string]interface{}{
+			"id":     1,
+			"na\"me": "pingcap",
+		},
+		info:  info,
+		quote: pkgsql.DoubleQuote,
+	}
+	sql, _ := dml.deleteSQL()
+	c.Assert(sql, check.Equals, `DELETE FROM "db"."tbl" WHERE "id" = ? AND "na""me" = ? LIMIT 1`)
+	sql, _ = dml.replaceSQL()
+	c.Assert(sql, check.Equals, `REPLACE INTO "db"."tbl"("id","na""me") VALUES(?,?)`)
+
+	dml.Values = map[string]interface{}{"id": 1}
+	dml.OldValues = map[string]interface{}{"id": 1}
+	sql, _ = dml.updateSQL()
+	c.Assert(sql, check.Equals, `UPDATE "db"."tbl" SET "id" = ? WHERE "id" = ? AND "na""me" IS NULL LIMIT 1`)
+
+	// backtick is used by default
+	dml.quote = 0
+	sql, _ = dml.updateSQL()
+	c.Assert(sql, check.Equals, "UPDATE `db`.`tbl` SET `id` = ? WHERE `id` = ? AND `na\"me` IS NULL LIMIT 1")
+}
+
+func (s *SQLSuite) TestCheckElems(c *check.C) {
+	info := &tableInfo{
+		columns: []string{"id", "sex", "tags"},
+		elems: map[string]*columnElems{
+			"sex":  {names: []string{"female", "male"}},
+			"tags": {isSet: true, names: []string{"a", "b"}},
+		},
+	}
+	dml := DML{
+		Tp:        UpdateDMLType,
+		Database:  "db",
+		Table:     "tbl",
+		Values:    map[string]interface{}{"id": 1, "sex": "male", "tags": []byte("b,a")},
+		OldValues: map[string]interface{}{"id": 1, "sex": nil, "tags": ""},
+		info:      info,
+	}
+	// the members are written by names, so the order of members doesn't matter
+	c.Assert(dml.checkElems(), check.IsNil)
+
+	dml.OldValues["sex"] = "unknown"
+	c.Assert(dml.checkElems(), check.ErrorMatches, "value \"unknown\" of ENUM column sex isn't a member of .*\"female\" \"male\".* in downstream table `db`.`tbl`.*")
+
+	dml.OldValues["sex"] = "female"
+	dml.Values["tags"] = "a,c"
+	c.Assert(dml.checkElems(), check.ErrorMatches, "value \"a,c\" of SET column tags isn't a member .*")
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// NumericOverflowError fails with the value out of the range of the downstream column
+	NumericOverflowError = "error"
+	// NumericOverflowClamp writes the nearest value in the range of the downstream column instead
+	NumericOverflowClamp = "clamp"
+	// NumericOverflowNull writes NULL instead
+	NumericOverflowNull = "null"
+)
+
+// the bits of the integer types
+var integerTypeBits = map[string]uint{
+	"tinyint":   8,
+	"smallint":  16,
+	"mediumint": 24,
+	"int":       32,
+	"integer":   32,
+	"bigint":    64,
+}
+
+// numericRange is the range of values an integer or DECIMAL column can hold
+type numericRange struct {
+	min *big.Rat
+	max *big.Rat
+	// the digits after the decimal point, only for DECIMAL
+	scale   int
+	integer bool
+}
+
+// parseNumericRange parses the range of the column type like int(11) unsigned or decimal(10,2),
+// ok is false if it's not an integer or DECIMAL column type.
+func parseNumericRange(columnType string) (r *numericRange, ok bool) {
+	fields := strings.Fields(strings.ToLower(columnType))
+	if len(fields) == 0 {
+		return nil, false
+	}
+	unsigned := false
+	for _, f := range fields[1:] {
+		if f == "unsigned" {
+			unsigned = true
+		}
+	}
+
+	name, args := fields[0], ""
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name, args = name[:i], strings.TrimSuffix(name[i+1:], ")")
+	}
+
+	if bits, ok := integerTypeBits[name]; ok {
+		max := new(big.Int).Lsh(big.NewInt(1), bits)
+		min := new(big.Int)
+		if unsigned {
+			max.Sub(max, big.NewInt(1))
+		} else {
+			max.Rsh(max, 1)
+			min.Neg(max)
+			max.Sub(max, big.NewInt(1))
+		}
+		return &numericRange{min: new(big.Rat).SetInt(min), max: new(big.Rat).SetInt(max), integer: true}, true
+	}
+
+	if name != "decimal" && name != "numeric" {
+		return nil, false
+	}
+	// DECIMAL is DECIMAL(10, 0) by default
+	precision, scale := 10, 0
+	if len(args) > 0 {
+		parts := strings.Split(args, ",")
+		var err error
+		if precision, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+			return nil, false
+		}
+		if len(parts) > 1 {
+			if scale, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+				return nil, false
+			}
+		}
+	}
+	// max is 10^(precision-scale) - 10^(-scale)
+	unit := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	max := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision-scale)), nil))
+	max.Sub(max, unit)
+	min := new(big.Rat)
+	if !unsigned {
+		min.Neg(max)
+	}
+	return &numericRange{min: min, max: max, scale: scale}, true
+}
+
+// clamp returns the nearest value in the range, ok is false if value is in the range already.
+func (r *numericRange) clamp(value *big.Rat) (clamped interface{}, ok bool) {
+	var bound *big.Rat
+	switch {
+	case value.Cmp(r.min) < 0:
+		bound = r.min
+	case value.Cmp(r.max) > 0:
+		bound = r.max
+	default:
+		return nil, false
+	}
+	return r.value(bound), true
+}
+
+// value converts v to the value written to the column
+func (r *numericRange) value(v *big.Rat) interface{} {
+	if !r.integer {
+		return v.FloatString(r.scale)
+	}
+	if v.Num().IsInt64() {
+		return v.Num().Int64()
+	}
+	return v.Num().Uint64()
+}
+
+func checkNumericOverflowPolicy(policy string) error {
+	switch policy {
+	case "", NumericOverflowError, NumericOverflowClamp, NumericOverflowNull:
+		return nil
+	default:
+		return errors.Errorf("unknown numeric overflow policy %s, must be %s, %s or %s", policy, NumericOverflowError, NumericOverflowClamp, NumericOverflowNull)
+	}
+}
+
+func numericValue(value interface{}) (*big.Rat, bool) {
+	var s string
+	switch v := value.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v)), true
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case float64:
+		// nil for NaN and Inf
+		r := new(big.Rat).SetFloat64(v)
+		return r, r != nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		// NULL or the other types
+		return nil, false
+	}
+	return new(big.Rat).SetString(strings.TrimSpace(s))
+}
+
+// fitNumerics handles the values out of the range of the integer and DECIMAL columns in downstream by policy,
+// the values are left to downstream if policy is empty. The old values of UPDATE are handled the same way,
+// otherwise the WHERE clause and the causality keys don't match the rows written with the new values.
+func (dml *DML) fitNumerics(policy string) error {
+	if len(policy) == 0 {
+		return nil
+	}
+
+	if err := dml.fitNumericValues(dml.Values, policy); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dml.fitNumericValues(dml.OldValues, policy))
+}
+
+func (dml *DML) fitNumericValues(values map[string]interface{}, policy string) error {
+	for col, r := range dml.info.numerics {
+		value, ok := numericValue(values[col])
+		if !ok {
+			continue
+		}
+		clamped, overflow := r.clamp(value)
+		if !overflow {
+			continue
+		}
+
+		switch policy {
+		case NumericOverflowClamp:
+			log.Warn("clamp the value out of range of the column in downstream", zap.String("table", dml.TableName()),
+				zap.String("column", col), zap.Reflect("value", values[col]), zap.Reflect("clamped", clamped))
+			values[col] = clamped
+		case NumericOverflowNull:
+			log.Warn("write NULL for the value out of range of the column in downstream", zap.String("table", dml.TableName()),
+				zap.String("column", col), zap.Reflect("value", values[col]))
+			values[col] = nil
+		default:
+			return errors.Errorf("value %v of column %s is out of range [%v, %v] in downstream table %s, the definitions of upstream and downstream may differ",
+				values[col], col, r.value(r.min), r.value(r.max), dml.TableName())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	check "github.com/pingcap/check"
+)
+
+type numericSuite struct{}
+
+var _ = check.Suite(&numericSuite{})
+
+func (s *numericSuite) TestParseNumericRange(c *check.C) {
+	for _, tp := range []string{"varchar(45)", "float", "double unsigned", "enum('a')", ""} {
+		_, ok := parseNumericRange(tp)
+		c.Assert(ok, check.IsFalse, check.Commentf("type %s", tp))
+	}
+
+	tests := []struct {
+		tp       string
+		min, max interface{}
+	}{
+		{"tinyint(4)", int64(-128), int64(127)},
+		{"TINYINT(3) UNSIGNED", int64(0), int64(255)},
+		{"smallint(6)", int64(-32768), int64(32767)},
+		{"mediumint(8) unsigned zerofill", int64(0), int64(16777215)},
+		{"int(11)", int64(-2147483648), int64(2147483647)},
+		{"bigint(20)", int64(-9223372036854775808), int64(9223372036854775807)},
+		{"bigint(20) unsigned", int64(0), uint64(18446744073709551615)},
+		{"decimal(5,2)", "-999.99", "999.99"},
+		{"decimal(4,0) unsigned", "0", "9999"},
+		{"decimal", "-9999999999", "9999999999"},
+	}
+	for _, t := range tests {
+		r, ok := parseNumericRange(t.tp)
+		c.Assert(ok, check.IsTrue, check.Commentf("type %s", t.tp))
+		c.Assert(r.value(r.min), check.Equals, t.min, check.Commentf("type %s", t.tp))
+		c.Assert(r.value(r.max), check.Equals, t.max, check.Commentf("type %s", t.tp))
+	}
+}
+
+func (s *numericSuite) TestCheckPolicy(c *check.C) {
+	for _, policy := range []string{"", NumericOverflowError, NumericOverflowClamp, NumericOverflowNull} {
+		c.Assert(checkNumericOverflowPolicy(policy), check.IsNil)
+	}
+	c.Assert(checkNumericOverflowPolicy("round"), check.ErrorMatches, "unknown numeric overflow policy round.*")
+}
+
+func newOverflowDML() *DML {
+	tinyint, _ := parseNumericRange("tinyint(4)")
+	unsigned, _ := parseNumericRange("int(10) unsigned")
+	decimal, _ := parseNumericRange("decimal(5,2)")
+	return &DML{
+		Tp:       InsertDMLType,
+		Database: "db",
+		Table:    "tbl",
+		Values: map[string]interface{}{
+			"id":    int64(1),
+			"small": int64(300),
+			"count": int64(-1),
+			"price": "12345.678",
+			"name":  "a",
+		},
+		info: &tableInfo{
+			columns:  []string{"id", "small", "count", "price", "name"},
+			numerics: map[string]*numericRange{"small": tinyint, "count": unsigned, "price": decimal},
+		},
+	}
+}
+
+func (s *numericSuite) TestFitNumerics(c *check.C) {
+	// the values are written as they are without the policy
+	dml := newOverflowDML()
+	c.Assert(dml.fitNumerics(""), check.IsNil)
+	c.Assert(dml.Values, check.DeepEquals, newOverflowDML().Values)
+
+	dml = newOverflowDML()
+	delete(dml.Values, "count")
+	delete(dml.Values, "price")
+	c.Assert(dml.fitNumerics(NumericOverflowError), check.ErrorMatches,
+		"value 300 of column small is out of range \\[-128, 127\\] in downstream table `db`.`tbl`.*")
+
+	dml = newOverflowDML()
+	c.Assert(dml.fitNumerics(NumericOverflowClamp), check.IsNil)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{
+		"id":    int64(1),
+		"small": int64(127),
+		"count": int64(0),
+		"price": "999.99",
+		"name":  "a",
+	})
+
+	dml = newOverflowDML()
+	c.Assert(dml.fitNumerics(NumericOverflowNull), check.IsNil)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{
+		"id":    int64(1),
+		"small": nil,
+		"count": nil,
+		"price": nil,
+		"name":  "a",
+	})
+
+	// the values in range and NULL are kept
+	dml = newOverflowDML()
+	dml.Values = map[string]interface{}{"small": []byte("-128"), "count": uint64(4294967295), "price": "-999.99"}
+	c.Assert(dml.fitNumerics(NumericOverflowError), check.IsNil)
+	dml.Values = map[string]interface{}{"small": nil, "price": "not a number"}
+	c.Assert(dml.fitNumerics(NumericOverflowError), check.IsNil)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"small": nil, "price": "not a number"})
+}
+
+func (s *numericSuite) TestFitOldNumerics(c *check.C) {
+	// the old values of UPDATE are clamped as the values written before, so are the WHERE clause and the keys
+	dml := newOverflowDML()
+	dml.Tp = UpdateDMLType
+	dml.info.uniqueKeys = []indexInfo{{name: "small", columns: []string{"small"}}}
+	dml.OldValues = map[string]interface{}{"id": int64(1), "small": int64(200), "count": int64(1), "price": "1.00", "name": "a"}
+	c.Assert(dml.fitNumerics(NumericOverflowClamp), check.IsNil)
+	c.Assert(dml.OldValues["small"], check.Equals, int64(127))
+	names, args := dml.whereSlice()
+	c.Assert(names, check.DeepEquals, []string{"small"})
+	c.Assert(args, check.DeepEquals, []interface{}{int64(127)})
+	c.Assert(getKeys(dml), check.DeepEquals, []string{"(small: 127)`db`.`tbl`", "(small: 127)`db`.`tbl`"})
+
+	dml = newOverflowDML()
+	dml.Tp = UpdateDMLType
+	dml.OldValues = map[string]interface{}{"small": int64(-200)}
+	dml.Values = map[string]interface{}{"small": int64(1)}
+	c.Assert(dml.fitNumerics(NumericOverflowError), check.ErrorMatches, "value -200 of column small is out of range.*")
+
+	// the values of DELETE are used in the WHERE clause
+	dml = newOverflowDML()
+	dml.Tp = DeleteDMLType
+	dml.info.uniqueKeys = []indexInfo{{name: "small", columns: []string{"small"}}}
+	c.Assert(dml.fitNumerics(NumericOverflowClamp), check.IsNil)
+	_, args = dml.whereSlice()
+	c.Assert(args, check.DeepEquals, []interface{}{int64(127)})
+	c.Assert(getKeys(dml), check.DeepEquals, []string{"(small: 127)`db`.`tbl`"})
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// TablePreSplit pre-splits the regions of the matched tables in TiDB downstream by `SPLIT TABLE`
+// right after they're created, so the initial bulk load of them is spread over the TiKV stores.
+// The names are patterns like the ones of TableConcurrency, the first matched one is used.
+// The row handles are split at Points if they're specified, otherwise [Lower, Upper) is split into Regions regions.
+type TablePreSplit struct {
+	Database string
+	Table    string
+
+	Lower   int64
+	Upper   int64
+	Regions int
+
+	Points []int64
+}
+
+type preSplitRule struct {
+	database *regexp.Regexp
+	table    *regexp.Regexp
+	conf     TablePreSplit
+}
+
+// preSplits generates the `SPLIT TABLE` statements of the tables,
+// a nil *preSplits is valid and splits no table.
+type preSplits struct {
+	rules []preSplitRule
+}
+
+func newPreSplits(confs []TablePreSplit) (*preSplits, error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+
+	p := new(preSplits)
+	for _, conf := range confs {
+		if err := checkTablePreSplit(conf); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		database, err := filter.CompilePattern(conf.Database)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid schema pattern %s in table pre-split", conf.Database)
+		}
+		table, err := filter.CompilePattern(conf.Table)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %s in table pre-split", conf.Table)
+		}
+		p.rules = append(p.rules, preSplitRule{database: database, table: table, conf: conf})
+	}
+	return p, nil
+}
+
+func checkTablePreSplit(conf TablePreSplit) error {
+	if len(conf.Database) == 0 || len(conf.Table) == 0 {
+		return errors.New("empty schema or table name in table pre-split")
+	}
+	if len(conf.Points) > 0 {
+		return nil
+	}
+	if conf.Regions <= 1 {
+		return errors.Errorf("invalid regions %d of table %s.%s in table pre-split, must be larger than 1", conf.Regions, conf.Database, conf.Table)
+	}
+	if conf.Lower >= conf.Upper {
+		return errors.Errorf("invalid range [%d, %d) of table %s.%s in table pre-split, lower must be less than upper", conf.Lower, conf.Upper, conf.Database, conf.Table)
+	}
+	return nil
+}
+
+// splitSQL returns the `SPLIT TABLE` statement of the table, false if the table isn't matched
+func (p *preSplits) splitSQL(quote pkgsql.IdentifierQuote, schema string, table string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+
+	for _, rule := range p.rules {
+		if !rule.database.MatchString(schema) || !rule.table.MatchString(table) {
+			continue
+		}
+
+		var builder strings.Builder
+		builder.WriteString("SPLIT TABLE " + quote.Schema(schema, table))
+		if len(rule.conf.Points) > 0 {
+			builder.WriteString(" BY ")
+			for i, point := range rule.conf.Points {
+				if i > 0 {
+					builder.WriteByte(',')
+				}
+				builder.WriteString("(" + strconv.FormatInt(point, 10) + ")")
+			}
+		} else {
+			builder.WriteString(" BETWEEN (" + strconv.FormatInt(rule.conf.Lower, 10) + ") AND (" +
+				strconv.FormatInt(rule.conf.Upper, 10) + ") REGIONS " + strconv.Itoa(rule.conf.Regions))
+		}
+		return builder.String(), true
+	}
+	return "", false
+}
+
+// isCreateTableDDL checks whether sql is a `CREATE TABLE`
+func isCreateTableDDL(sql string) bool {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return false
+	}
+
+	_, ok := stmt.(*ast.CreateTableStmt)
+	return ok
+}
+
+// preSplitTable splits the regions of the table created by ddl if it's matched, it's only an optimization
+// of the initial load, so the table is loaded without splitting if it fails.
+func (s *loaderImpl) preSplitTable(ddl *DDL) {
+	if s.preSplits == nil || !isCreateTableDDL(ddl.SQL) {
+		return
+	}
+
+	sql, ok := s.preSplits.splitSQL(s.quote, ddl.Database, ddl.Table)
+	if !ok {
+		return
+	}
+	if _, err := s.db.ExecContext(s.ctx, sql); err != nil {
+		log.Warn("pre-split table failed", zap.String("sql", sql), zap.Error(err))
+		return
+	}
+	log.Info("pre-split table success", zap.String("sql", sql))
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+)
+
+type preSplitSuite struct{}
+
+var _ = check.Suite(&preSplitSuite{})
+
+func (s *preSplitSuite) TestSplitSQL(c *check.C) {
+	p, err := newPreSplits([]TablePreSplit{
+		{Database: "test", Table: "hot", Points: []int64{100, 200, 300}},
+		{Database: "test", Table: "~^log_", Lower: 0, Upper: 1000000, Regions: 16},
+		{Database: "test", Table: "~.*", Lower: -10, Upper: 10, Regions: 2},
+	})
+	c.Assert(err, check.IsNil)
+
+	sql, ok := p.splitSQL(pkgsql.BacktickQuote, "test", "hot")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(sql, check.Equals, "SPLIT TABLE `test`.`hot` BY (100),(200),(300)")
+
+	sql, ok = p.splitSQL(pkgsql.BacktickQuote, "test", "log_2019")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(sql, check.Equals, "SPLIT TABLE `test`.`log_2019` BETWEEN (0) AND (1000000) REGIONS 16")
+
+	sql, ok = p.splitSQL(pkgsql.DoubleQuote, "test", "other")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(sql, check.Equals, `SPLIT TABLE "test"."other" BETWEEN (-10) AND (10) REGIONS 2`)
+
+	_, ok = p.splitSQL(pkgsql.BacktickQuote, "other", "hot")
+	c.Assert(ok, check.IsFalse)
+
+	var nilSplits *preSplits
+	_, ok = nilSplits.splitSQL(pkgsql.BacktickQuote, "test", "hot")
+	c.Assert(ok, check.IsFalse)
+}
+
+func (s *preSplitSuite) TestInvalidPreSplit(c *check.C) {
+	p, err := newPreSplits(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.IsNil)
+
+	_, err = newPreSplits([]TablePreSplit{{Database: "test", Regions: 4, Upper: 10}})
+	c.Assert(err, check.ErrorMatches, "empty schema or table name in table pre-split")
+	_, err = newPreSplits([]TablePreSplit{{Database: "test", Table: "t", Upper: 10, Regions: 1}})
+	c.Assert(err, check.ErrorMatches, "invalid regions 1 of table test.t in table pre-split.*")
+	_, err = newPreSplits([]TablePreSplit{{Database: "test", Table: "t", Lower: 10, Upper: 10, Regions: 4}})
+	c.Assert(err, check.ErrorMatches, `invalid range \[10, 10\) of table test.t in table pre-split.*`)
+	_, err = newPreSplits([]TablePreSplit{{Database: "test", Table: "~(", Points: []int64{1}}})
+	c.Assert(err, check.ErrorMatches, "invalid table pattern.*")
+}
+
+func (s *preSplitSuite) TestPreSplitCreatedTable(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	l, err := NewLoader(db, PreSplitTables([]TablePreSplit{{Database: "test", Table: "t", Lower: 0, Upper: 100, Regions: 4}}))
+	c.Assert(err, check.IsNil)
+	loader := l.(*loaderImpl)
+
+	createSQL := "CREATE TABLE t (id INT PRIMARY KEY)"
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(createSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta("SPLIT TABLE `test`.`t` BETWEEN (0) AND (100) REGIONS 4")).WillReturnResult(sqlmock.NewResult(0, 0))
+	c.Assert(loader.execDDL(&DDL{Database: "test", Table: "t", SQL: createSQL}), check.IsNil)
+
+	// the other DDLs don't split the table
+	alterSQL := "ALTER TABLE t ADD COLUMN c INT"
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(alterSQL).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	c.Assert(loader.execDDL(&DDL{Database: "test", Table: "t", SQL: alterSQL}), check.IsNil)
+
+	// the table is loaded without splitting if it fails
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(createSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec("SPLIT TABLE").WillReturnError(errors.New("split failed"))
+	c.Assert(loader.execDDL(&DDL{Database: "test", Table: "t", SQL: createSQL}), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	_, err = NewLoader(db, PreSplitTables([]TablePreSplit{{Database: "test", Table: "t"}}))
+	c.Assert(err, check.ErrorMatches, "invalid regions 0 of table test.t.*")
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ColumnMapping maps an upstream column to a downstream column
+type ColumnMapping struct {
+	Upstream   string
+	Downstream string
+}
+
+// ColumnProjection specifies the columns of a table written to downstream,
+// columns not listed are dropped, and the downstream columns are written in the listed order.
+type ColumnProjection struct {
+	Database string
+	Table    string
+	Columns  []ColumnMapping
+}
+
+type projector struct {
+	// quoted table name -> projection
+	projections map[string]*ColumnProjection
+	// the table names are lower-cased in the keys of projections
+	caseInsensitive bool
+}
+
+func newProjector(projs []ColumnProjection, caseInsensitive bool) (*projector, error) {
+	if len(projs) == 0 {
+		return nil, nil
+	}
+
+	p := &projector{projections: make(map[string]*ColumnProjection, len(projs)), caseInsensitive: caseInsensitive}
+	for i := range projs {
+		proj := &projs[i]
+		if len(proj.Database) == 0 || len(proj.Table) == 0 {
+			return nil, errors.New("empty schema or table name in column projection")
+		}
+		if len(proj.Columns) == 0 {
+			return nil, errors.Errorf("no column in projection of table %s", quoteSchema(proj.Database, proj.Table))
+		}
+
+		ups := make(map[string]struct{}, len(proj.Columns))
+		downs := make(map[string]struct{}, len(proj.Columns))
+		for _, col := range proj.Columns {
+			if len(col.Upstream) == 0 || len(col.Downstream) == 0 {
+				return nil, errors.Errorf("empty column name in projection of table %s", quoteSchema(proj.Database, proj.Table))
+			}
+			if _, ok := ups[col.Upstream]; ok {
+				return nil, errors.Errorf("duplicate upstream column %s in projection of table %s", col.Upstream, quoteSchema(proj.Database, proj.Table))
+			}
+			if _, ok := downs[col.Downstream]; ok {
+				return nil, errors.Errorf("duplicate downstream column %s in projection of table %s", col.Downstream, quoteSchema(proj.Database, proj.Table))
+			}
+			ups[col.Upstream] = struct{}{}
+			downs[col.Downstream] = struct{}{}
+		}
+
+		name := p.key(proj.Database, proj.Table)
+		if _, ok := p.projections[name]; ok {
+			return nil, errors.Errorf("duplicate column projection of table %s", quoteSchema(proj.Database, proj.Table))
+		}
+		p.projections[name] = proj
+	}
+
+	return p, nil
+}
+
+func (p *projector) key(schema string, table string) string {
+	if p.caseInsensitive {
+		return quoteSchema(strings.ToLower(schema), strings.ToLower(table))
+	}
+	return quoteSchema(schema, table)
+}
+
+func (p *projector) get(schema string, table string) *ColumnProjection {
+	if p == nil {
+		return nil
+	}
+	return p.projections[p.key(schema, table)]
+}
+
+// project renames the values of dml to the downstream columns and drops the unselected ones.
+func (p *projector) project(dml *DML) {
+	proj := p.get(dml.Database, dml.Table)
+	if proj == nil {
+		return
+	}
+
+	dml.Values = projectValues(proj, dml.Values)
+	if dml.OldValues != nil {
+		dml.OldValues = projectValues(proj, dml.OldValues)
+	}
+}
+
+func projectValues(proj *ColumnProjection, values map[string]interface{}) map[string]interface{} {
+	projected := make(map[string]interface{}, len(proj.Columns))
+	for _, col := range proj.Columns {
+		if v, ok := values[col.Upstream]; ok {
+			projected[col.Downstream] = v
+		}
+	}
+	return projected
+}
+
+// adjustTableInfo limits the columns of info to the projected ones,
+// it returns an error if the projection drops any column of the unique keys,
+// which are used to build the WHERE clause and to detect conflicts.
+func (p *projector) adjustTableInfo(schema string, table string, info *tableInfo) error {
+	proj := p.get(schema, table)
+	if proj == nil || info == nil {
+		return nil
+	}
+
+	exists := make(map[string]struct{}, len(info.columns))
+	for _, col := range info.columns {
+		exists[strings.ToLower(col)] = struct{}{}
+	}
+
+	columns := make([]string, 0, len(proj.Columns))
+	projected := make(map[string]struct{}, len(proj.Columns))
+	for _, col := range proj.Columns {
+		if _, ok := exists[strings.ToLower(col.Downstream)]; !ok {
+			return errors.Errorf("column %s of projection not found in downstream table %s", col.Downstream, quoteSchema(schema, table))
+		}
+		columns = append(columns, col.Downstream)
+		projected[strings.ToLower(col.Downstream)] = struct{}{}
+	}
+
+	for _, index := range info.uniqueKeys {
+		for _, col := range index.columns {
+			if _, ok := projected[strings.ToLower(col)]; !ok {
+				return errors.Errorf("column projection of table %s drops column %s of key %s", quoteSchema(schema, table), col, index.name)
+			}
+		}
+	}
+
+	info.columns = columns
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	check "github.com/pingcap/check"
+)
+
+type projectionSuite struct{}
+
+var _ = check.Suite(&projectionSuite{})
+
+func (s *projectionSuite) TestNewProjector(c *check.C) {
+	p, err := newProjector(nil, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.IsNil)
+	c.Assert(p.get("test", "t"), check.IsNil)
+
+	invalids := [][]ColumnProjection{
+		{{Database: "", Table: "t", Columns: []ColumnMapping{{"id", "id"}}}},
+		{{Database: "test", Table: "t"}},
+		{{Database: "test", Table: "t", Columns: []ColumnMapping{{"id", ""}}}},
+		{{Database: "test", Table: "t", Columns: []ColumnMapping{{"id", "id"}, {"id", "id2"}}}},
+		{{Database: "test", Table: "t", Columns: []ColumnMapping{{"id", "id"}, {"id2", "id"}}}},
+		{
+			{Database: "test", Table: "t", Columns: []ColumnMapping{{"id", "id"}}},
+			{Database: "test", Table: "t", Columns: []ColumnMapping{{"id", "id"}}},
+		},
+	}
+	for _, projs := range invalids {
+		_, err = newProjector(projs, false)
+		c.Assert(err, check.NotNil)
+	}
+}
+
+func (s *projectionSuite) TestProjectSubset(c *check.C) {
+	p, err := newProjector([]ColumnProjection{{
+		Database: "test",
+		Table:    "t",
+		Columns:  []ColumnMapping{{"name", "full_name"}, {"id", "id"}},
+	}}, false)
+	c.Assert(err, check.IsNil)
+
+	info := &tableInfo{
+		columns:    []string{"id", "full_name", "age"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	c.Assert(p.adjustTableInfo("test", "t", info), check.IsNil)
+	c.Assert(info.columns, check.DeepEquals, []string{"full_name", "id"})
+
+	dml := &DML{
+		Database:  "test",
+		Table:     "t",
+		Tp:        UpdateDMLType,
+		Values:    map[string]interface{}{"id": 1, "name": "a", "age": 10},
+		OldValues: map[string]interface{}{"id": 1, "name": "b", "age": 11},
+		info:      info,
+	}
+	p.project(dml)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"id": 1, "full_name": "a"})
+	c.Assert(dml.OldValues, check.DeepEquals, map[string]interface{}{"id": 1, "full_name": "b"})
+
+	sql, args := dml.updateSQL()
+	c.Assert(sql, check.Matches, "UPDATE `test`.`t` SET `(id|full_name)` = \\?,`(id|full_name)` = \\? WHERE `id` = \\? LIMIT 1")
+	c.Assert(args, check.HasLen, 3)
+
+	dml.Tp = InsertDMLType
+	sql, args = dml.insertSQL()
+	c.Assert(sql, check.Equals, "INSERT INTO `test`.`t`(`full_name`,`id`) VALUES(?,?)")
+	c.Assert(args, check.DeepEquals, []interface{}{"a", 1})
+
+	dml.Tp = DeleteDMLType
+	sql, args = dml.deleteSQL()
+	c.Assert(sql, check.Equals, "DELETE FROM `test`.`t` WHERE `id` = ? LIMIT 1")
+	c.Assert(args, check.DeepEquals, []interface{}{1})
+
+	// table without projection is left untouched
+	other := &DML{Database: "test", Table: "other", Values: map[string]interface{}{"name": "a"}}
+	p.project(other)
+	c.Assert(other.Values, check.DeepEquals, map[string]interface{}{"name": "a"})
+}
+
+func (s *projectionSuite) TestRejectDroppingKeyColumn(c *check.C) {
+	p, err := newProjector([]ColumnProjection{{
+		Database: "test",
+		Table:    "t",
+		Columns:  []ColumnMapping{{"name", "name"}},
+	}}, false)
+	c.Assert(err, check.IsNil)
+
+	info := &tableInfo{
+		columns:    []string{"id", "name"},
+		uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}},
+	}
+	err = p.adjustTableInfo("test", "t", info)
+	c.Assert(err, check.ErrorMatches, ".*drops column id of key PRIMARY.*")
+
+	// the projected column must exist in downstream
+	info = &tableInfo{columns: []string{"id"}}
+	err = p.adjustTableInfo("test", "t", info)
+	c.Assert(err, check.ErrorMatches, ".*column name of projection not found.*")
+}
+
+func (s *projectionSuite) TestProjectionCaseSensitivity(c *check.C) {
+	projs := []ColumnProjection{{Database: "DB1", Table: "T", Columns: []ColumnMapping{{"id", "id"}}}}
+	p, err := newProjector(projs, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.get("db1", "t"), check.IsNil)
+	c.Assert(p.get("DB1", "T"), check.NotNil)
+
+	p, err = newProjector(projs, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.get("db1", "t"), check.Equals, &projs[0])
+	c.Assert(p.get("Db1", "t"), check.Equals, &projs[0])
+	dml := &DML{Database: "db1", Table: "t", Values: map[string]interface{}{"id": 1, "name": "a"}}
+	p.project(dml)
+	c.Assert(dml.Values, check.DeepEquals, map[string]interface{}{"id": 1})
+
+	// the projections of the same table across case are duplicated
+	projs = append(projs, ColumnProjection{Database: "db1", Table: "t", Columns: []ColumnMapping{{"id", "id"}}})
+	_, err = newProjector(projs, true)
+	c.Assert(err, check.ErrorMatches, "duplicate column projection of table `db1`.`t`")
+	_, err = newProjector(projs, false)
+	c.Assert(err, check.IsNil)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy controls the retries of the DMLs and DDLs failing in downstream, in addition to the max attempts of them.
+// The backoff between the attempts is doubled after every attempt up to MaxBackoff, it's fixed if MaxBackoff
+// is not larger than the initial backoff. The retries stop once they take longer than Budget even if attempts
+// remain, and the last error is returned, so the event fails or is sent to the dead letter.
+// The zero value retries with the fixed backoff until the attempts run out.
+type RetryPolicy struct {
+	MaxBackoff time.Duration
+	Budget     time.Duration
+}
+
+func checkRetryPolicy(policy RetryPolicy) error {
+	if policy.MaxBackoff < 0 {
+		return errors.Errorf("invalid max backoff %s of retry policy, must not be negative", policy.MaxBackoff)
+	}
+	if policy.Budget < 0 {
+		return errors.Errorf("invalid budget %s of retry policy, must not be negative", policy.Budget)
+	}
+	return nil
+}
+
+// nextBackoff returns the backoff after backoff
+func (p RetryPolicy) nextBackoff(backoff time.Duration) time.Duration {
+	if p.MaxBackoff <= backoff {
+		return backoff
+	}
+	backoff *= 2
+	if backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// retry calls fn until it succeeds for at most retryCount times like util.RetryContext,
+// and waits backoff before the first retry. It stops early if the next attempt would exceed the budget.
+func (p RetryPolicy) retry(ctx context.Context, retryCount int, backoff time.Duration, fn func(context.Context) error) error {
+	start := time.Now()
+	var err error
+	for i := 0; i < retryCount; i++ {
+		err = fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if i == retryCount-1 {
+			break
+		}
+
+		if p.Budget > 0 && time.Since(start)+backoff > p.Budget {
+			log.Warn("retry budget is exhausted, stop retrying", zap.Duration("budget", p.Budget),
+				zap.Int("attempts", i+1), zap.Error(err))
+			return errors.Annotatef(err, "retry budget %s is exhausted after %d attempts", p.Budget, i+1)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff = p.nextBackoff(backoff)
+	}
+	return err
+}
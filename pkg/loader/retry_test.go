@@ -0,0 +1,102 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type retrySuite struct{}
+
+var _ = check.Suite(&retrySuite{})
+
+func (s *retrySuite) TestNextBackoff(c *check.C) {
+	policy := RetryPolicy{MaxBackoff: 5 * time.Second}
+	c.Assert(policy.nextBackoff(time.Second), check.Equals, 2*time.Second)
+	c.Assert(policy.nextBackoff(2*time.Second), check.Equals, 4*time.Second)
+	c.Assert(policy.nextBackoff(4*time.Second), check.Equals, 5*time.Second)
+	c.Assert(policy.nextBackoff(5*time.Second), check.Equals, 5*time.Second)
+
+	// the backoff is fixed without the cap
+	c.Assert(RetryPolicy{}.nextBackoff(time.Second), check.Equals, time.Second)
+}
+
+func (s *retrySuite) TestStopRetryingAfterBudget(c *check.C) {
+	errFail := errors.New("fail")
+	policy := RetryPolicy{Budget: 50 * time.Millisecond}
+
+	var calls int
+	start := time.Now()
+	err := policy.retry(context.Background(), 100, 20*time.Millisecond, func(context.Context) error {
+		calls++
+		return errFail
+	})
+	c.Assert(err, check.ErrorMatches, "retry budget 50ms is exhausted after [0-9]+ attempts.*")
+	c.Assert(errors.Cause(err), check.Equals, errFail)
+	// the attempts remain, but the budget runs out after at most 3 attempts
+	c.Assert(calls, check.LessEqual, 3)
+	c.Assert(calls, check.GreaterEqual, 1)
+	c.Assert(time.Since(start), check.Less, time.Second)
+
+	// the attempts run out before the budget
+	calls = 0
+	policy.Budget = time.Minute
+	err = policy.retry(context.Background(), 3, time.Millisecond, func(context.Context) error {
+		calls++
+		return errFail
+	})
+	c.Assert(err, check.Equals, errFail)
+	c.Assert(calls, check.Equals, 3)
+
+	calls = 0
+	err = policy.retry(context.Background(), 3, time.Millisecond, func(context.Context) error {
+		calls++
+		if calls < 2 {
+			return errFail
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(calls, check.Equals, 2)
+}
+
+func (s *retrySuite) TestRetryPolicyOfLoader(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	_, err = NewLoader(db, Retry(RetryPolicy{Budget: -time.Second}))
+	c.Assert(err, check.ErrorMatches, "invalid budget -1s of retry policy.*")
+	_, err = NewLoader(db, Retry(RetryPolicy{MaxBackoff: -time.Second}))
+	c.Assert(err, check.ErrorMatches, "invalid max backoff -1s of retry policy.*")
+
+	l, err := NewLoader(db, Retry(RetryPolicy{Budget: time.Millisecond}))
+	c.Assert(err, check.IsNil)
+	loader := l.(*loaderImpl)
+
+	// the DDL is executed only once though 5 attempts are allowed, because the backoff exceeds the budget
+	sql := "CREATE TABLE t (id INT PRIMARY KEY)"
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WillReturnError(errors.New("ddl failed"))
+	mock.ExpectRollback()
+	err = loader.execDDL(&DDL{Database: "test", Table: "t", SQL: sql})
+	c.Assert(err, check.ErrorMatches, "retry budget 1ms is exhausted after 1 attempts.*ddl failed")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,259 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// txnScheduler applies the txns by multiple workers when the ordering is relaxed.
+// A txn conflicting with the running txns by keys is sent to the worker applying them,
+// so the txns writing the same key are applied in commit order, it waits if the conflicting
+// txns are applied by more than one worker. The successes are reported in commit order,
+// a txn is reported only after all the txns before it are applied.
+type txnScheduler struct {
+	// the max count of DMLs of the txns sent to workers but not reported yet,
+	// a txn without DMLs is counted as one.
+	limit int
+
+	workers []chan *scheduledTxn
+	// the applied txns sent by workers
+	results chan *scheduledTxn
+	wg      sync.WaitGroup
+
+	// the running txns holding the key
+	keys map[string]*keyHolder
+	// the count of running txns of every worker
+	loads []int
+	// the txns not reported yet in commit order
+	pending     []*scheduledTxn
+	pendingDMLs int
+
+	// the slots of the limited tables are taken as keys
+	tableConcurrencies *tableConcurrencies
+
+	fPrepareTxn  func(*Txn) error
+	fExecTxn     func(*Txn) error
+	fExecDDL     func(*Txn) error
+	fSuccessTxns func(...*Txn)
+	fDeadLetter  DeadLetterFunc
+}
+
+type scheduledTxn struct {
+	txn    *Txn
+	keys   []string
+	worker int
+	done   bool
+	err    error
+}
+
+type keyHolder struct {
+	worker int
+	count  int
+}
+
+func newTxnScheduler(s *loaderImpl) *txnScheduler {
+	batch := newBatchManager(s)
+	sched := &txnScheduler{
+		limit:              s.batchSize * s.workerCount * execLimitMultiple,
+		tableConcurrencies: s.tableConcurrencies,
+		fPrepareTxn:        func(txn *Txn) error { return s.prepareDMLs(txn.DMLs) },
+		fExecTxn:           s.execTxn,
+		fExecDDL:           batch.execDDL,
+		fSuccessTxns:       s.markSuccess,
+		fDeadLetter:        s.deadLetter,
+	}
+	sched.start(s.workerCount)
+	return sched
+}
+
+func (t *txnScheduler) start(workerCount int) {
+	t.keys = make(map[string]*keyHolder)
+	t.loads = make([]int, workerCount)
+	// there are at most limit txns not reported, so sending to the channels never blocks
+	t.results = make(chan *scheduledTxn, t.limit)
+	for i := 0; i < workerCount; i++ {
+		worker := make(chan *scheduledTxn, t.limit)
+		t.workers = append(t.workers, worker)
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			for st := range worker {
+				st.err = t.fExecTxn(st.txn)
+				t.results <- st
+			}
+		}()
+	}
+}
+
+// close stops the workers after they finish the txns sent to them
+func (t *txnScheduler) close() {
+	for _, worker := range t.workers {
+		close(worker)
+	}
+	t.wg.Wait()
+}
+
+// put sends txn to a worker, it blocks until the conflicting txns are applied if needed.
+// The DDL is executed after all the txns before it are applied.
+func (t *txnScheduler) put(txn *Txn) error {
+	if txn.isDDL() {
+		if len(txn.DDL.Database) == 0 {
+			return errors.Errorf("get DDL Txn with empty database, ddl: %s", txn.DDL.SQL)
+		}
+
+		if err := t.drain(); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(t.fExecDDL(txn))
+	}
+
+	if err := t.fPrepareTxn(txn); err != nil {
+		return errors.Trace(err)
+	}
+	st := &scheduledTxn{txn: txn, keys: txnKeys(txn, t.tableConcurrencies)}
+
+	for {
+		worker, ok := t.pickWorker(st.keys)
+		if ok && (len(t.pending) == 0 || t.pendingDMLs+txnSize(txn) <= t.limit) {
+			st.worker = worker
+			break
+		}
+		if err := t.handleResult(<-t.results); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	for _, key := range st.keys {
+		holder, ok := t.keys[key]
+		if !ok {
+			holder = &keyHolder{worker: st.worker}
+			t.keys[key] = holder
+		}
+		holder.count++
+	}
+	t.loads[st.worker]++
+	t.pending = append(t.pending, st)
+	t.pendingDMLs += txnSize(txn)
+	t.workers[st.worker] <- st
+	return nil
+}
+
+// pickWorker returns the worker applying the running txns conflicting with keys,
+// or the one with the least running txns if there's no conflict.
+// It returns false if the conflicting txns are applied by more than one worker.
+func (t *txnScheduler) pickWorker(keys []string) (worker int, ok bool) {
+	worker = -1
+	for _, key := range keys {
+		holder, held := t.keys[key]
+		if !held {
+			continue
+		}
+		if worker >= 0 && worker != holder.worker {
+			return 0, false
+		}
+		worker = holder.worker
+	}
+	if worker >= 0 {
+		return worker, true
+	}
+
+	worker = 0
+	for i, load := range t.loads {
+		if load < t.loads[worker] {
+			worker = i
+		}
+	}
+	return worker, true
+}
+
+// handleResult releases the keys of the applied txn, and reports the txns
+// before which all the txns are applied.
+func (t *txnScheduler) handleResult(st *scheduledTxn) error {
+	for _, key := range st.keys {
+		holder := t.keys[key]
+		holder.count--
+		if holder.count == 0 {
+			delete(t.keys, key)
+		}
+	}
+	t.loads[st.worker]--
+
+	if st.err != nil {
+		if t.fDeadLetter == nil || !isPermanentError(st.err) {
+			return errors.Trace(st.err)
+		}
+		log.Warn("skip txn failing permanently, send it to dead letter", zap.Stringer("txn", st.txn), zap.Error(st.err))
+		if err := t.fDeadLetter(st.txn, st.err); err != nil {
+			return errors.Annotatef(err, "send txn to dead letter failed, origin error: %v", st.err)
+		}
+	}
+	st.done = true
+
+	var applied []*Txn
+	for len(t.pending) > 0 && t.pending[0].done {
+		applied = append(applied, t.pending[0].txn)
+		t.pendingDMLs -= txnSize(t.pending[0].txn)
+		t.pending = t.pending[1:]
+	}
+	if len(applied) > 0 {
+		t.fSuccessTxns(applied...)
+	}
+	return nil
+}
+
+// drain waits until all the txns sent to workers are applied and reported
+func (t *txnScheduler) drain() error {
+	for len(t.pending) > 0 {
+		if err := t.handleResult(<-t.results); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// txnKeys returns the keys written by the DMLs of txn and the slots of the limited tables taken by them,
+// the DMLs must be prepared
+func txnKeys(txn *Txn, concurrencies *tableConcurrencies) []string {
+	seen := make(map[string]struct{})
+	var keys []string
+	add := func(key string) {
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	for _, dml := range txn.DMLs {
+		dmlKeys := getKeys(dml)
+		for _, key := range dmlKeys {
+			add(key)
+		}
+		if slot, ok := concurrencies.slotKey(dml, dmlKeys[0]); ok {
+			add(slot)
+		}
+	}
+	return keys
+}
+
+func txnSize(txn *Txn) int {
+	if len(txn.DMLs) == 0 {
+		return 1
+	}
+	return len(txn.DMLs)
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	check "github.com/pingcap/check"
+)
+
+type schedulerSuite struct{}
+
+var _ = check.Suite(&schedulerSuite{})
+
+var schedTableInfo = &tableInfo{
+	columns:    []string{"id", "v"},
+	primaryKey: &indexInfo{"PRIMARY", []string{"id"}},
+	uniqueKeys: []indexInfo{{"PRIMARY", []string{"id"}}},
+}
+
+// schedTxn returns a txn with commit ts as Metadata, which updates the rows of ids
+func schedTxn(commitTS int64, ids ...int) *Txn {
+	txn := &Txn{Metadata: commitTS}
+	for _, id := range ids {
+		txn.DMLs = append(txn.DMLs, &DML{
+			Database:  "test",
+			Table:     "t",
+			Tp:        UpdateDMLType,
+			Values:    map[string]interface{}{"id": id, "v": commitTS},
+			OldValues: map[string]interface{}{"id": id, "v": 0},
+			info:      schedTableInfo,
+		})
+	}
+	return txn
+}
+
+// testApplier applies a txn only after it's released
+type testApplier struct {
+	started  chan int64
+	gates    map[int64]chan error
+	reported []int64
+}
+
+func newTestScheduler(workerCount int, commitTSs ...int64) (*txnScheduler, *testApplier) {
+	applier := &testApplier{
+		started: make(chan int64, len(commitTSs)),
+		gates:   make(map[int64]chan error),
+	}
+	for _, ts := range commitTSs {
+		applier.gates[ts] = make(chan error, 1)
+	}
+
+	sched := &txnScheduler{
+		limit:       1024,
+		fPrepareTxn: func(*Txn) error { return nil },
+		fExecTxn: func(txn *Txn) error {
+			ts := txn.Metadata.(int64)
+			applier.started <- ts
+			return <-applier.gates[ts]
+		},
+		fSuccessTxns: func(txns ...*Txn) {
+			for _, txn := range txns {
+				applier.reported = append(applier.reported, txn.Metadata.(int64))
+			}
+		},
+	}
+	sched.start(workerCount)
+	return sched, applier
+}
+
+func (a *testApplier) release(ts int64) {
+	a.gates[ts] <- nil
+}
+
+// assertStarted checks the txns of commitTSs are started in any order
+func (a *testApplier) assertStarted(c *check.C, commitTSs ...int64) {
+	var started []int64
+	for range commitTSs {
+		select {
+		case ts := <-a.started:
+			started = append(started, ts)
+		case <-time.After(time.Second):
+			c.Fatalf("txns %v aren't started, started: %v", commitTSs, started)
+		}
+	}
+	sort.Slice(started, func(i, j int) bool { return started[i] < started[j] })
+	c.Assert(started, check.DeepEquals, commitTSs)
+}
+
+func (a *testApplier) assertNotStarted(c *check.C) {
+	select {
+	case started := <-a.started:
+		c.Fatalf("txn %d shouldn't be started", started)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (s *schedulerSuite) TestIndependentTxns(c *check.C) {
+	sched, applier := newTestScheduler(2, 1, 2)
+	defer sched.close()
+
+	c.Assert(sched.put(schedTxn(1, 1)), check.IsNil)
+	c.Assert(sched.put(schedTxn(2, 2)), check.IsNil)
+	applier.assertStarted(c, 1, 2)
+
+	// txn 2 is applied before txn 1, but it can't be reported until txn 1 is applied
+	applier.release(2)
+	c.Assert(sched.handleResult(<-sched.results), check.IsNil)
+	c.Assert(applier.reported, check.HasLen, 0)
+
+	applier.release(1)
+	c.Assert(sched.handleResult(<-sched.results), check.IsNil)
+	c.Assert(applier.reported, check.DeepEquals, []int64{1, 2})
+	c.Assert(sched.pending, check.HasLen, 0)
+	c.Assert(sched.keys, check.HasLen, 0)
+}
+
+func (s *schedulerSuite) TestConflictingTxns(c *check.C) {
+	sched, applier := newTestScheduler(2, 1, 2, 3)
+	defer sched.close()
+
+	c.Assert(sched.put(schedTxn(1, 1)), check.IsNil)
+	c.Assert(sched.put(schedTxn(2, 2, 1)), check.IsNil)
+	c.Assert(sched.put(schedTxn(3, 3)), check.IsNil)
+	// txn 3 is independent, it's applied by another worker
+	applier.assertStarted(c, 1, 3)
+	// txn 2 writes the same row as txn 1, it waits until txn 1 is applied
+	applier.assertNotStarted(c)
+
+	applier.release(3)
+	c.Assert(sched.handleResult(<-sched.results), check.IsNil)
+	c.Assert(applier.reported, check.HasLen, 0)
+
+	applier.release(1)
+	c.Assert(sched.handleResult(<-sched.results), check.IsNil)
+	c.Assert(applier.reported, check.DeepEquals, []int64{1})
+	applier.assertStarted(c, 2)
+
+	applier.release(2)
+	c.Assert(sched.drain(), check.IsNil)
+	c.Assert(applier.reported, check.DeepEquals, []int64{1, 2, 3})
+}
+
+func (s *schedulerSuite) TestConflictWithMultipleWorkers(c *check.C) {
+	sched, applier := newTestScheduler(2, 1, 2, 3)
+	defer sched.close()
+
+	c.Assert(sched.put(schedTxn(1, 1)), check.IsNil)
+	c.Assert(sched.put(schedTxn(2, 2)), check.IsNil)
+	applier.assertStarted(c, 1, 2)
+
+	// txn 3 conflicts with the txns applied by both workers, put blocks until one of them is applied
+	putDone := make(chan error)
+	go func() {
+		putDone <- sched.put(schedTxn(3, 1, 2))
+	}()
+	select {
+	case <-putDone:
+		c.Fatal("put should block when conflicting with more than one worker")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	applier.release(1)
+	select {
+	case err := <-putDone:
+		c.Assert(err, check.IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("put should return after the conflicting txn is applied")
+	}
+	// txn 3 still waits for txn 2
+	applier.assertNotStarted(c)
+
+	applier.release(2)
+	applier.assertStarted(c, 3)
+	applier.release(3)
+	c.Assert(sched.drain(), check.IsNil)
+	c.Assert(applier.reported, check.DeepEquals, []int64{1, 2, 3})
+}
+
+func (s *schedulerSuite) TestDDLWaitsForRunningTxns(c *check.C) {
+	sched, applier := newTestScheduler(2, 1)
+	defer sched.close()
+	var ddlReported []int64
+	sched.fExecDDL = func(txn *Txn) error {
+		ddlReported = append([]int64(nil), applier.reported...)
+		return nil
+	}
+
+	c.Assert(sched.put(schedTxn(1, 1)), check.IsNil)
+	applier.assertStarted(c, 1)
+	go applier.release(1)
+
+	ddl := &Txn{DDL: &DDL{Database: "test", Table: "t", SQL: "alter table t add column c int"}}
+	c.Assert(sched.put(ddl), check.IsNil)
+	c.Assert(ddlReported, check.DeepEquals, []int64{1})
+}
+
+func (s *schedulerSuite) TestFailedTxn(c *check.C) {
+	sched, applier := newTestScheduler(2, 1, 2)
+	defer sched.close()
+
+	c.Assert(sched.put(schedTxn(1, 1)), check.IsNil)
+	applier.assertStarted(c, 1)
+	applier.gates[1] <- &mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"}
+	c.Assert(sched.handleResult(<-sched.results), check.ErrorMatches, ".*Table doesn't exist.*")
+	c.Assert(applier.reported, check.HasLen, 0)
+
+	// the txn failing permanently is reported as success after it's sent to the dead letter
+	sched, applier = newTestScheduler(2, 2)
+	defer sched.close()
+	var deadLetters []int64
+	sched.fDeadLetter = func(txn *Txn, err error) error {
+		deadLetters = append(deadLetters, txn.Metadata.(int64))
+		return nil
+	}
+	c.Assert(sched.put(schedTxn(2, 2)), check.IsNil)
+	applier.assertStarted(c, 2)
+	applier.gates[2] <- &mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"}
+	c.Assert(sched.handleResult(<-sched.results), check.IsNil)
+	c.Assert(deadLetters, check.DeepEquals, []int64{2})
+	c.Assert(applier.reported, check.DeepEquals, []int64{2})
+}
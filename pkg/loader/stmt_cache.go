@@ -0,0 +1,152 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"container/list"
+	gosql "database/sql"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// stmtCache caches the prepared statements in downstream keyed by the SQL template,
+// the least recently used one is closed when the count of statements exceeds the capacity.
+// Every cached statement is prepared lazily on the connections executing it, at most once per connection,
+// so the capacity caps the count of prepared statements of every downstream connection.
+// A nil *stmtCache is valid and caches nothing.
+type stmtCache struct {
+	db       *gosql.DB
+	capacity int
+	// set to the count of cached statements if it's not nil
+	gauge prometheus.Gauge
+
+	mu    sync.Mutex
+	lru   *list.List
+	stmts map[string]*list.Element
+}
+
+type cachedStmt struct {
+	schema string
+	table  string
+	query  string
+	stmt   *gosql.Stmt
+}
+
+// newStmtCache returns nil if capacity <= 0, gauge is set to the count of cached statements if it's not nil.
+func newStmtCache(db *gosql.DB, capacity int, gauge prometheus.Gauge) *stmtCache {
+	if capacity <= 0 {
+		return nil
+	}
+
+	return &stmtCache{
+		db:       db,
+		capacity: capacity,
+		gauge:    gauge,
+		lru:      list.New(),
+		stmts:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the prepared statement of query, which writes the table schema.table,
+// the statement is prepared and cached if it's not in the cache.
+func (c *stmtCache) get(schema string, table string, query string) (*gosql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.stmts[query]; ok {
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*cachedStmt).stmt, nil
+	}
+
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	c.stmts[query] = c.lru.PushFront(&cachedStmt{
+		schema: schema,
+		table:  table,
+		query:  query,
+		stmt:   stmt,
+	})
+	for c.lru.Len() > c.capacity {
+		c.removeLocked(c.lru.Back())
+	}
+	c.updateGaugeLocked()
+
+	return stmt, nil
+}
+
+// invalidate closes the statements of the table whose schema is changed,
+// all the statements of the schema are closed if table is empty.
+func (c *stmtCache) invalidate(schema string, table string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		cached := elem.Value.(*cachedStmt)
+		if cached.schema == schema && (len(table) == 0 || cached.table == table) {
+			c.removeLocked(elem)
+		}
+		elem = next
+	}
+	c.updateGaugeLocked()
+}
+
+// close closes all the cached statements
+func (c *stmtCache) close() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+	c.updateGaugeLocked()
+}
+
+func (c *stmtCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// updateGaugeLocked must be called with c.mu held
+func (c *stmtCache) updateGaugeLocked() {
+	if c.gauge != nil {
+		c.gauge.Set(float64(c.lru.Len()))
+	}
+}
+
+// removeLocked must be called with c.mu held. The statement used by the running
+// transactions is closed after these transactions finish by database/sql.
+func (c *stmtCache) removeLocked(elem *list.Element) {
+	cached := c.lru.Remove(elem).(*cachedStmt)
+	delete(c.stmts, cached.query)
+	if err := cached.stmt.Close(); err != nil {
+		log.Warn("close prepared statement failed", zap.String("query", cached.query), zap.Error(err))
+	}
+}
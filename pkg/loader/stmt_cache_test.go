@@ -0,0 +1,160 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type stmtCacheSuite struct{}
+
+var _ = Suite(&stmtCacheSuite{})
+
+func (s *stmtCacheSuite) TestDisabled(c *C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	cache := newStmtCache(db, 0, nil)
+	c.Assert(cache, IsNil)
+	// safe to call on the nil cache
+	cache.invalidate("test", "t1")
+	cache.close()
+}
+
+func (s *stmtCacheSuite) TestReuse(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	query := "INSERT INTO `test`.`t1`(`id`) VALUES(?)"
+	mock.ExpectPrepare(regexp.QuoteMeta(query))
+
+	cache := newStmtCache(db, 2, nil)
+	stmt1, err := cache.get("test", "t1", query)
+	c.Assert(err, IsNil)
+	stmt2, err := cache.get("test", "t1", query)
+	c.Assert(err, IsNil)
+	c.Assert(stmt1, Equals, stmt2)
+	c.Assert(cache.len(), Equals, 1)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *stmtCacheSuite) TestBounded(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	queries := make([]string, 3)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("DELETE FROM `test`.`t%d` WHERE `id` = ? LIMIT 1", i)
+	}
+	for _, query := range queries {
+		mock.ExpectPrepare(regexp.QuoteMeta(query)).WillBeClosed()
+	}
+	// the first one is prepared again after it's evicted
+	mock.ExpectPrepare(regexp.QuoteMeta(queries[0]))
+
+	cache := newStmtCache(db, 2, nil)
+	for i, query := range queries {
+		_, err = cache.get("test", fmt.Sprintf("t%d", i), query)
+		c.Assert(err, IsNil)
+		c.Assert(cache.len() <= 2, IsTrue)
+	}
+	_, err = cache.get("test", "t0", queries[0])
+	c.Assert(err, IsNil)
+	c.Assert(cache.len(), Equals, 2)
+
+	cache.close()
+	c.Assert(cache.len(), Equals, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func gaugeValue(c *C, gauge prometheus.Gauge) float64 {
+	var m dto.Metric
+	c.Assert(gauge.Write(&m), IsNil)
+	return m.GetGauge().GetValue()
+}
+
+func (s *stmtCacheSuite) TestEvictUnderPressure(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	mock.MatchExpectationsInOrder(false)
+
+	const capacity, workers, tables = 4, 8, 16
+	queries := make([]string, tables)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("INSERT INTO `test`.`t%d`(`id`) VALUES(?)", i)
+	}
+	// every get prepares the query at most once, the evicted statements are closed
+	for i := 0; i < workers; i++ {
+		for _, query := range queries {
+			mock.ExpectPrepare(regexp.QuoteMeta(query)).WillBeClosed()
+		}
+	}
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_prepared_stmt_count"})
+	cache := newStmtCache(db, capacity, gauge)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := range queries {
+				// the workers write the tables in different orders
+				t := (worker + j) % tables
+				_, err := cache.get("test", fmt.Sprintf("t%d", t), queries[t])
+				c.Check(err, IsNil)
+				c.Check(cache.len() <= capacity, IsTrue)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	c.Assert(cache.len(), Equals, capacity)
+	c.Assert(gaugeValue(c, gauge), Equals, float64(capacity))
+
+	cache.invalidate("test", "")
+	c.Assert(cache.len(), Equals, 0)
+	c.Assert(gaugeValue(c, gauge), Equals, float64(0))
+}
+
+func (s *stmtCacheSuite) TestInvalidate(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	tables := [][2]string{{"db1", "t1"}, {"db1", "t2"}, {"db2", "t1"}}
+	for _, t := range tables {
+		mock.ExpectPrepare(regexp.QuoteMeta(fmt.Sprintf("INSERT INTO `%s`.`%s`", t[0], t[1])))
+	}
+
+	cache := newStmtCache(db, 10, nil)
+	for _, t := range tables {
+		_, err = cache.get(t[0], t[1], fmt.Sprintf("INSERT INTO `%s`.`%s`(`id`) VALUES(?)", t[0], t[1]))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(cache.len(), Equals, 3)
+
+	cache.invalidate("db1", "t1")
+	c.Assert(cache.len(), Equals, 2)
+	cache.invalidate("db3", "")
+	c.Assert(cache.len(), Equals, 2)
+	cache.invalidate("db1", "")
+	c.Assert(cache.len(), Equals, 1)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+// TableConcurrency limits the count of concurrent executions applying the DMLs of the matched tables,
+// e.g. 1 to apply the DMLs of a hot table serially. The names are patterns like the ones of filter,
+// the pattern starting with "~" is a regular expression. The first matched one is used.
+type TableConcurrency struct {
+	Database    string
+	Table       string
+	Concurrency int
+}
+
+type tableConcurrencyRule struct {
+	database    *regexp.Regexp
+	table       *regexp.Regexp
+	concurrency int
+}
+
+// tableConcurrencies looks up the concurrency limit of tables,
+// a nil *tableConcurrencies is valid and limits no table.
+type tableConcurrencies struct {
+	rules []tableConcurrencyRule
+
+	mu sync.Mutex
+	// quoted table name -> concurrency, 0 if the table isn't limited
+	cache map[string]int
+}
+
+func newTableConcurrencies(confs []TableConcurrency) (*tableConcurrencies, error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+
+	t := &tableConcurrencies{cache: make(map[string]int)}
+	for _, conf := range confs {
+		if len(conf.Database) == 0 || len(conf.Table) == 0 {
+			return nil, errors.New("empty schema or table name in table concurrency")
+		}
+		if conf.Concurrency <= 0 {
+			return nil, errors.Errorf("invalid concurrency %d of table %s.%s, must be positive", conf.Concurrency, conf.Database, conf.Table)
+		}
+
+		database, err := filter.CompilePattern(conf.Database)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid schema pattern %s in table concurrency", conf.Database)
+		}
+		table, err := filter.CompilePattern(conf.Table)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %s in table concurrency", conf.Table)
+		}
+		t.rules = append(t.rules, tableConcurrencyRule{database: database, table: table, concurrency: conf.Concurrency})
+	}
+	return t, nil
+}
+
+// get returns the concurrency limit of the table, 0 if it isn't limited
+func (t *tableConcurrencies) get(schema string, table string) int {
+	if t == nil {
+		return 0
+	}
+
+	name := quoteSchema(schema, table)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if concurrency, ok := t.cache[name]; ok {
+		return concurrency
+	}
+
+	var concurrency int
+	for _, rule := range t.rules {
+		if rule.database.MatchString(schema) && rule.table.MatchString(table) {
+			concurrency = rule.concurrency
+			break
+		}
+	}
+	t.cache[name] = concurrency
+	return concurrency
+}
+
+// bucket returns which of the workers applies the DML with the conflict key, the DMLs of a limited table
+// are applied by at most as many workers as the limit, which start at an offset by the table name.
+func (t *tableConcurrencies) bucket(dml *DML, key string, workers int) int {
+	concurrency := t.get(dml.Database, dml.Table)
+	if concurrency == 0 || concurrency >= workers {
+		return int(genHashKey(key)) % workers
+	}
+
+	offset := int(genHashKey(dml.TableName()))
+	return (offset + int(genHashKey(key))%concurrency) % workers
+}
+
+// slotKey returns the key of the slot taken by applying the DML if the table is limited, the txns
+// taking the same slot conflict, so there are at most as many txns applying the table as the limit.
+func (t *tableConcurrencies) slotKey(dml *DML, key string) (string, bool) {
+	concurrency := t.get(dml.Database, dml.Table)
+	if concurrency == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("slot %d of %s", int(genHashKey(key))%concurrency, dml.TableName()), true
+}
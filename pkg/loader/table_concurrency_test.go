@@ -0,0 +1,142 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	check "github.com/pingcap/check"
+)
+
+type tableConcurrencySuite struct{}
+
+var _ = check.Suite(&tableConcurrencySuite{})
+
+func (s *tableConcurrencySuite) TestNew(c *check.C) {
+	t, err := newTableConcurrencies(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.get("test", "t"), check.Equals, 0)
+
+	_, err = newTableConcurrencies([]TableConcurrency{{Database: "test", Concurrency: 1}})
+	c.Assert(err, check.ErrorMatches, "empty schema or table name.*")
+	_, err = newTableConcurrencies([]TableConcurrency{{Database: "test", Table: "t"}})
+	c.Assert(err, check.ErrorMatches, "invalid concurrency 0 of table test.t.*")
+	_, err = newTableConcurrencies([]TableConcurrency{{Database: "test", Table: "~t(", Concurrency: 1}})
+	c.Assert(err, check.ErrorMatches, "invalid table pattern ~t\\( in table concurrency.*")
+}
+
+func (s *tableConcurrencySuite) TestGet(c *check.C) {
+	t, err := newTableConcurrencies([]TableConcurrency{
+		{Database: "test", Table: "hot", Concurrency: 1},
+		{Database: "test", Table: "~^log_", Concurrency: 2},
+		{Database: "test", Table: "~.*", Concurrency: 4},
+	})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(t.get("Test", "HOT"), check.Equals, 1)
+	c.Assert(t.get("test", "log_2019"), check.Equals, 2)
+	// the first matched one is used
+	c.Assert(t.get("test", "hot_1"), check.Equals, 4)
+	c.Assert(t.get("other", "hot"), check.Equals, 0)
+}
+
+func concurrencyDMLs(table string, n int) []*DML {
+	var dmls []*DML
+	for i := 0; i < n; i++ {
+		dmls = append(dmls, &DML{
+			Database: "test",
+			Table:    table,
+			Tp:       InsertDMLType,
+			Values:   map[string]interface{}{"id": i, "v": i},
+			info:     schedTableInfo,
+		})
+	}
+	return dmls
+}
+
+func (s *tableConcurrencySuite) TestBucket(c *check.C) {
+	t, err := newTableConcurrencies([]TableConcurrency{{Database: "test", Table: "hot", Concurrency: 1}})
+	c.Assert(err, check.IsNil)
+
+	buckets := func(table string) map[int]struct{} {
+		used := make(map[int]struct{})
+		for _, dml := range concurrencyDMLs(table, 100) {
+			used[t.bucket(dml, getKeys(dml)[0], 4)] = struct{}{}
+		}
+		return used
+	}
+	c.Assert(buckets("hot"), check.HasLen, 1)
+	c.Assert(len(buckets("cold")) > 1, check.IsTrue)
+}
+
+// maxRunning returns the max count of the splits executed at the same time
+func maxRunning(c *check.C, concurrency int) int {
+	e := newExecutor(nil).withBatchSize(1)
+	var mu sync.Mutex
+	var running, max int
+	err := e.splitExecDML(context.Background(), concurrencyDMLs("t", 8), concurrency, func([]*DML) error {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	return max
+}
+
+func (s *tableConcurrencySuite) TestSplitExecSerially(c *check.C) {
+	c.Assert(maxRunning(c, 1), check.Equals, 1)
+	c.Assert(maxRunning(c, 2), check.Equals, 2)
+	c.Assert(maxRunning(c, 0) > 2, check.IsTrue)
+}
+
+func (s *tableConcurrencySuite) TestScheduleSerially(c *check.C) {
+	sched, applier := newTestScheduler(4, 1, 2, 3, 4)
+	defer sched.close()
+	var err error
+	sched.tableConcurrencies, err = newTableConcurrencies([]TableConcurrency{{Database: "test", Table: "t", Concurrency: 1}})
+	c.Assert(err, check.IsNil)
+
+	other := func(commitTS int64, id int) *Txn {
+		txn := schedTxn(commitTS, id)
+		txn.DMLs[0].Table = "other"
+		return txn
+	}
+
+	// the txns of test.t are applied one by one though they write different rows
+	c.Assert(sched.put(schedTxn(1, 1)), check.IsNil)
+	c.Assert(sched.put(schedTxn(2, 2)), check.IsNil)
+	// while the txns of other tables are applied in parallel
+	c.Assert(sched.put(other(3, 1)), check.IsNil)
+	c.Assert(sched.put(other(4, 2)), check.IsNil)
+	applier.assertStarted(c, 1, 3, 4)
+	applier.assertNotStarted(c)
+
+	applier.release(1)
+	applier.assertStarted(c, 2)
+	for _, ts := range []int64{2, 3, 4} {
+		applier.release(ts)
+	}
+	c.Assert(sched.drain(), check.IsNil)
+	c.Assert(applier.reported, check.DeepEquals, []int64{1, 2, 3, 4})
+}
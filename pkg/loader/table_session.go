@@ -0,0 +1,134 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+// TableSession overrides the session time_zone and sql_mode of downstream while applying the DMLs of the matched tables,
+// e.g. the tables written under different settings in upstream. The names are patterns like the ones of TableConcurrency,
+// the first matched one is used. The empty TimeZone or nil SQLMode keeps the one of the session.
+type TableSession struct {
+	Database string
+	Table    string
+	TimeZone string
+	SQLMode  *string
+}
+
+type tableSessionRule struct {
+	database *regexp.Regexp
+	table    *regexp.Regexp
+	session  *TableSession
+}
+
+// tableSessions looks up the session overrides of tables,
+// a nil *tableSessions is valid and overrides no table.
+type tableSessions struct {
+	rules []tableSessionRule
+
+	mu sync.Mutex
+	// quoted table name -> session, nil if the table isn't overridden
+	cache map[string]*TableSession
+}
+
+func newTableSessions(confs []TableSession) (*tableSessions, error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+
+	t := &tableSessions{cache: make(map[string]*TableSession)}
+	for i := range confs {
+		conf := confs[i]
+		if len(conf.Database) == 0 || len(conf.Table) == 0 {
+			return nil, errors.New("empty schema or table name in table session")
+		}
+		if len(conf.TimeZone) == 0 && conf.SQLMode == nil {
+			return nil, errors.Errorf("neither time zone nor sql mode of table %s.%s in table session", conf.Database, conf.Table)
+		}
+
+		database, err := filter.CompilePattern(conf.Database)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid schema pattern %s in table session", conf.Database)
+		}
+		table, err := filter.CompilePattern(conf.Table)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %s in table session", conf.Table)
+		}
+		t.rules = append(t.rules, tableSessionRule{database: database, table: table, session: &conf})
+	}
+	return t, nil
+}
+
+// get returns the session overrides of the table, nil if it isn't overridden
+func (t *tableSessions) get(schema string, table string) *TableSession {
+	if t == nil {
+		return nil
+	}
+
+	name := quoteSchema(schema, table)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if session, ok := t.cache[name]; ok {
+		return session
+	}
+
+	var session *TableSession
+	for _, rule := range t.rules {
+		if rule.database.MatchString(schema) && rule.table.MatchString(table) {
+			session = rule.session
+			break
+		}
+	}
+	t.cache[name] = session
+	return session
+}
+
+// the user variables saving the session settings of the connection before they're overridden
+const (
+	savedTimeZoneVar = "@tidb_binlog_time_zone"
+	savedSQLModeVar  = "@tidb_binlog_sql_mode"
+)
+
+// switchSessionSQL returns the statement switching the session settings to the ones of to, the settings not overridden
+// by to, or all of them if to is nil, are restored to the ones of the connection, which are saved first if save is true.
+func switchSessionSQL(to *TableSession, save bool) (string, []interface{}) {
+	var (
+		assigns []string
+		args    []interface{}
+	)
+	if save {
+		assigns = append(assigns, savedTimeZoneVar+" = @@SESSION.time_zone", savedSQLModeVar+" = @@SESSION.sql_mode")
+	}
+
+	if to != nil && len(to.TimeZone) > 0 {
+		assigns = append(assigns, "SESSION time_zone = ?")
+		args = append(args, to.TimeZone)
+	} else {
+		assigns = append(assigns, "SESSION time_zone = "+savedTimeZoneVar)
+	}
+	if to != nil && to.SQLMode != nil {
+		assigns = append(assigns, "SESSION sql_mode = ?")
+		args = append(args, *to.SQLMode)
+	} else {
+		assigns = append(assigns, "SESSION sql_mode = "+savedSQLModeVar)
+	}
+
+	return "SET " + strings.Join(assigns, ", "), args
+}
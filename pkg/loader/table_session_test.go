@@ -0,0 +1,158 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+)
+
+type tableSessionSuite struct{}
+
+var _ = check.Suite(&tableSessionSuite{})
+
+func (s *tableSessionSuite) TestNew(c *check.C) {
+	t, err := newTableSessions(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.get("test", "t"), check.IsNil)
+
+	_, err = newTableSessions([]TableSession{{Database: "test", TimeZone: "UTC"}})
+	c.Assert(err, check.ErrorMatches, "empty schema or table name.*")
+	_, err = newTableSessions([]TableSession{{Database: "test", Table: "t"}})
+	c.Assert(err, check.ErrorMatches, "neither time zone nor sql mode of table test.t.*")
+	_, err = newTableSessions([]TableSession{{Database: "test", Table: "~t(", TimeZone: "UTC"}})
+	c.Assert(err, check.ErrorMatches, "invalid table pattern ~t\\( in table session.*")
+}
+
+func (s *tableSessionSuite) TestGet(c *check.C) {
+	empty := ""
+	t, err := newTableSessions([]TableSession{
+		{Database: "test", Table: "utc", TimeZone: "UTC"},
+		{Database: "test", Table: "~^legacy_", TimeZone: "+08:00", SQLMode: &empty},
+		{Database: "test", Table: "~.*", SQLMode: &empty},
+	})
+	c.Assert(err, check.IsNil)
+
+	c.Assert(t.get("Test", "UTC").TimeZone, check.Equals, "UTC")
+	c.Assert(t.get("test", "legacy_1").TimeZone, check.Equals, "+08:00")
+	// the first matched one is used
+	session := t.get("test", "utc_1")
+	c.Assert(session.TimeZone, check.Equals, "")
+	c.Assert(*session.SQLMode, check.Equals, "")
+	c.Assert(t.get("test", "utc_1"), check.Equals, session)
+	c.Assert(t.get("other", "utc"), check.IsNil)
+}
+
+func (s *tableSessionSuite) TestSwitchSessionSQL(c *check.C) {
+	mode := "ANSI_QUOTES"
+	sql, args := switchSessionSQL(&TableSession{TimeZone: "UTC", SQLMode: &mode}, true)
+	c.Assert(sql, check.Equals, "SET @tidb_binlog_time_zone = @@SESSION.time_zone, @tidb_binlog_sql_mode = @@SESSION.sql_mode, "+
+		"SESSION time_zone = ?, SESSION sql_mode = ?")
+	c.Assert(args, check.DeepEquals, []interface{}{"UTC", "ANSI_QUOTES"})
+
+	sql, args = switchSessionSQL(&TableSession{SQLMode: &mode}, false)
+	c.Assert(sql, check.Equals, "SET SESSION time_zone = @tidb_binlog_time_zone, SESSION sql_mode = ?")
+	c.Assert(args, check.DeepEquals, []interface{}{"ANSI_QUOTES"})
+
+	sql, args = switchSessionSQL(nil, false)
+	c.Assert(sql, check.Equals, "SET SESSION time_zone = @tidb_binlog_time_zone, SESSION sql_mode = @tidb_binlog_sql_mode")
+	c.Assert(args, check.HasLen, 0)
+}
+
+func sessionDML(table string, name string) *DML {
+	return &DML{
+		Database: "test",
+		Table:    table,
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"name": name},
+		info:     &tableInfo{columns: []string{"name"}},
+	}
+}
+
+func newSessionExecutor(c *check.C) (*executor, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	mode := "ANSI_QUOTES"
+	sessions, err := newTableSessions([]TableSession{
+		{Database: "test", Table: "a", TimeZone: "UTC", SQLMode: &mode},
+		{Database: "test", Table: "c", SQLMode: &mode},
+	})
+	c.Assert(err, check.IsNil)
+	return newExecutor(db).withTableSessions(sessions), mock
+}
+
+const (
+	saveAndSwitchSQL = "SET @tidb_binlog_time_zone = @@SESSION.time_zone, @tidb_binlog_sql_mode = @@SESSION.sql_mode, SESSION time_zone = ?, SESSION sql_mode = ?"
+	restoreSQL       = "SET SESSION time_zone = @tidb_binlog_time_zone, SESSION sql_mode = @tidb_binlog_sql_mode"
+)
+
+func (s *tableSessionSuite) TestSingleExec(c *check.C) {
+	e, mock := newSessionExecutor(c)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(saveAndSwitchSQL)).WithArgs("UTC", "ANSI_QUOTES").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`a`")).WithArgs("a1").WillReturnResult(sqlmock.NewResult(1, 1))
+	// the following DML of the same table runs in the same settings
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`a`")).WithArgs("a2").WillReturnResult(sqlmock.NewResult(1, 1))
+	// the table not overridden runs in the settings of the connection
+	mock.ExpectExec(regexp.QuoteMeta(restoreSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`b`")).WithArgs("b1").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET SESSION time_zone = @tidb_binlog_time_zone, SESSION sql_mode = ?")).
+		WithArgs("ANSI_QUOTES").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`c`")).WithArgs("c1").WillReturnResult(sqlmock.NewResult(1, 1))
+	// the connection is restored before it's returned to the pool
+	mock.ExpectExec(regexp.QuoteMeta(restoreSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	dmls := []*DML{sessionDML("a", "a1"), sessionDML("a", "a2"), sessionDML("b", "b1"), sessionDML("c", "c1")}
+	c.Assert(e.singleExec(dmls, false), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// nothing is switched for the tables not overridden
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`b`")).WithArgs("b2").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	c.Assert(e.singleExec([]*DML{sessionDML("b", "b2")}, false), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *tableSessionSuite) TestRestoreOnRollback(c *check.C) {
+	e, mock := newSessionExecutor(c)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(saveAndSwitchSQL)).WithArgs("UTC", "ANSI_QUOTES").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test`.`a`")).WithArgs("a1").WillReturnError(errors.New("insert"))
+	mock.ExpectExec(regexp.QuoteMeta(restoreSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	c.Assert(e.singleExec([]*DML{sessionDML("a", "a1")}, false), check.ErrorMatches, "insert")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *tableSessionSuite) TestBulkReplace(c *check.C) {
+	e, mock := newSessionExecutor(c)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(saveAndSwitchSQL)).WithArgs("UTC", "ANSI_QUOTES").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `test`.`a`(`name`) VALUES (?),(?)")).
+		WithArgs("a1", "a2").WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec(regexp.QuoteMeta(restoreSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	c.Assert(e.bulkReplace([]*DML{sessionDML("a", "a1"), sessionDML("a", "a2")}), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
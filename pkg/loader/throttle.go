@@ -0,0 +1,218 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultThrottleProbe is the query to probe the load of downstream by default
+	DefaultThrottleProbe = "SHOW GLOBAL STATUS"
+
+	defaultThrottleInterval = time.Second
+	defaultThrottleMaxDelay = time.Second
+	// the delay starts from it once downstream is overloaded, and is dropped once it's halved below it
+	minThrottleDelay = 10 * time.Millisecond
+)
+
+// ThrottlePolicy reduces the write rate against downstream when downstream reports high load.
+// Probe is executed every Interval, it returns the status variables as the rows of the name and the value
+// like SHOW STATUS, downstream is overloaded once any variable in Thresholds exceeds its threshold.
+// Every execution is delayed while downstream is overloaded, the delay is doubled on every overloaded probe
+// up to MaxDelay, and halved on every probe after downstream recovers.
+// It's disabled if Thresholds is empty.
+type ThrottlePolicy struct {
+	Probe      string
+	Thresholds map[string]float64
+	Interval   time.Duration
+	MaxDelay   time.Duration
+}
+
+func checkThrottlePolicy(policy ThrottlePolicy) error {
+	if policy.Interval < 0 {
+		return errors.Errorf("invalid interval %s of throttle policy, must not be negative", policy.Interval)
+	}
+	if policy.MaxDelay < 0 {
+		return errors.Errorf("invalid max delay %s of throttle policy, must not be negative", policy.MaxDelay)
+	}
+	for name := range policy.Thresholds {
+		if len(name) == 0 {
+			return errors.New("empty status variable name in throttle thresholds")
+		}
+	}
+	return nil
+}
+
+// throttler delays the executions against downstream by the load probed from downstream in the background by run.
+// A nil *throttler is valid and never delays.
+type throttler struct {
+	interval time.Duration
+	maxDelay time.Duration
+	// keyed by the lower case names of the status variables
+	thresholds map[string]float64
+	probe      func(ctx context.Context) (map[string]float64, error)
+
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+// newThrottler returns nil if policy is disabled
+func newThrottler(db *gosql.DB, policy ThrottlePolicy) *throttler {
+	if len(policy.Thresholds) == 0 {
+		return nil
+	}
+
+	t := &throttler{
+		interval:   policy.Interval,
+		maxDelay:   policy.MaxDelay,
+		thresholds: make(map[string]float64, len(policy.Thresholds)),
+	}
+	if t.interval == 0 {
+		t.interval = defaultThrottleInterval
+	}
+	if t.maxDelay == 0 {
+		t.maxDelay = defaultThrottleMaxDelay
+	}
+	for name, threshold := range policy.Thresholds {
+		t.thresholds[strings.ToLower(name)] = threshold
+	}
+
+	probe := policy.Probe
+	if len(probe) == 0 {
+		probe = DefaultThrottleProbe
+	}
+	t.probe = func(ctx context.Context) (map[string]float64, error) {
+		return queryStatus(ctx, db, probe)
+	}
+	return t
+}
+
+// queryStatus returns the numeric status variables returned by query, keyed by the lower case names
+func queryStatus(ctx context.Context, db *gosql.DB, query string) (map[string]float64, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	status := make(map[string]float64)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, errors.Annotatef(err, "scan the status returned by %s", query)
+		}
+		// the status variables not numeric can't exceed any threshold
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			status[strings.ToLower(name)] = v
+		}
+	}
+	return status, errors.Trace(rows.Err())
+}
+
+// run probes downstream every interval to adjust the delay until ctx is done
+func (t *throttler) run(ctx context.Context) {
+	if t == nil {
+		return
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		t.adjust(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// wait sleeps the current delay, it doesn't probe downstream, so the executions aren't serialized by the probe.
+func (t *throttler) wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	delay := t.getDelay()
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// adjust probes downstream and updates the delay.
+// The delay is kept if the probe fails, so the writes aren't blocked by a broken probe.
+func (t *throttler) adjust(ctx context.Context) {
+	status, err := t.probe(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Warn("probe the load of downstream failed", zap.Error(err))
+		}
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, threshold := range t.thresholds {
+		value, ok := status[name]
+		if !ok || value <= threshold {
+			continue
+		}
+		delay := t.delay * 2
+		if delay < minThrottleDelay {
+			delay = minThrottleDelay
+		}
+		if delay > t.maxDelay {
+			delay = t.maxDelay
+		}
+		if delay != t.delay {
+			log.Warn("downstream is overloaded, throttle the writes", zap.String("status", name),
+				zap.Float64("value", value), zap.Float64("threshold", threshold), zap.Duration("delay", delay))
+		}
+		t.delay = delay
+		return
+	}
+
+	if t.delay == 0 {
+		return
+	}
+	t.delay /= 2
+	if t.delay < minThrottleDelay {
+		t.delay = 0
+		log.Info("downstream recovers from the high load, stop throttling the writes")
+	}
+}
+
+// getDelay returns the current delay before every execution
+func (t *throttler) getDelay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.delay
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type throttleSuite struct{}
+
+var _ = check.Suite(&throttleSuite{})
+
+func (s *throttleSuite) TestThrottleByStatus(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	t := newThrottler(db, ThrottlePolicy{
+		Thresholds: map[string]float64{"Threads_running": 32},
+		MaxDelay:   50 * time.Millisecond,
+	})
+
+	var status map[string]float64
+	var probeErr error
+	probes := 0
+	t.probe = func(context.Context) (map[string]float64, error) {
+		probes++
+		return status, probeErr
+	}
+	adjust := func() time.Duration {
+		t.adjust(context.Background())
+		return t.getDelay()
+	}
+
+	status = map[string]float64{"threads_running": 10}
+	c.Assert(adjust(), check.Equals, time.Duration(0))
+
+	// the delay grows on every overloaded probe up to the max delay
+	status = map[string]float64{"threads_running": 100}
+	c.Assert(adjust(), check.Equals, 10*time.Millisecond)
+	c.Assert(adjust(), check.Equals, 20*time.Millisecond)
+	c.Assert(adjust(), check.Equals, 40*time.Millisecond)
+	c.Assert(adjust(), check.Equals, 50*time.Millisecond)
+	c.Assert(adjust(), check.Equals, 50*time.Millisecond)
+
+	// the delay is kept if the probe fails
+	probeErr = errors.New("probe failed")
+	c.Assert(adjust(), check.Equals, 50*time.Millisecond)
+	probeErr = nil
+
+	// and shrinks after downstream recovers
+	status = map[string]float64{"threads_running": 32}
+	c.Assert(adjust(), check.Equals, 25*time.Millisecond)
+	c.Assert(adjust(), check.Equals, 12500*time.Microsecond)
+	c.Assert(adjust(), check.Equals, time.Duration(0))
+
+	// the executions are delayed while downstream is overloaded, without probing downstream
+	status = map[string]float64{"threads_running": 100}
+	c.Assert(adjust(), check.Equals, 10*time.Millisecond)
+	probed := probes
+	start := time.Now()
+	c.Assert(t.wait(context.Background()), check.IsNil)
+	c.Assert(time.Since(start), check.GreaterEqual, 10*time.Millisecond)
+	c.Assert(probes, check.Equals, probed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(t.wait(ctx), check.Equals, context.Canceled)
+
+	// a nil throttler never delays
+	var nilThrottler *throttler
+	c.Assert(nilThrottler.wait(context.Background()), check.IsNil)
+	c.Assert(newThrottler(db, ThrottlePolicy{}), check.IsNil)
+}
+
+func (s *throttleSuite) TestQueryStatus(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	mock.ExpectQuery("SHOW GLOBAL STATUS").WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).
+		AddRow("Threads_running", "65").
+		AddRow("Threads_connected", "120").
+		AddRow("Rsa_public_key", "-----BEGIN PUBLIC KEY-----"))
+	t := newThrottler(db, ThrottlePolicy{Thresholds: map[string]float64{"THREADS_RUNNING": 64}})
+
+	// run probes downstream at once, and then only every interval
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		t.run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 100 && t.getDelay() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(t.getDelay(), check.Equals, minThrottleDelay)
+	cancel()
+	<-done
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	status, err := queryStatus(context.Background(), db, "SHOW GLOBAL STATUS")
+	c.Assert(err, check.ErrorMatches, ".*all expectations were already fulfilled.*")
+	c.Assert(status, check.IsNil)
+}
+
+func (s *throttleSuite) TestThrottlePolicyOfLoader(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	_, err = NewLoader(db, Throttle(ThrottlePolicy{Interval: -time.Second}))
+	c.Assert(err, check.ErrorMatches, "invalid interval -1s of throttle policy.*")
+	_, err = NewLoader(db, Throttle(ThrottlePolicy{MaxDelay: -time.Second}))
+	c.Assert(err, check.ErrorMatches, "invalid max delay -1s of throttle policy.*")
+	_, err = NewLoader(db, Throttle(ThrottlePolicy{Thresholds: map[string]float64{"": 1}}))
+	c.Assert(err, check.ErrorMatches, "empty status variable name in throttle thresholds")
+
+	l, err := NewLoader(db, Throttle(ThrottlePolicy{Probe: "SHOW STATUS", Thresholds: map[string]float64{"Threads_running": 1}}))
+	c.Assert(err, check.IsNil)
+	t := l.(*loaderImpl).throttler
+	c.Assert(t, check.NotNil)
+	c.Assert(t.interval, check.Equals, defaultThrottleInterval)
+	c.Assert(t.maxDelay, check.Equals, defaultThrottleMaxDelay)
+}
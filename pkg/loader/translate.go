@@ -14,12 +14,23 @@
 package loader
 
 import (
+	"github.com/pingcap/errors"
 	pb "github.com/pingcap/tidb-tools/tidb-binlog/slave_binlog_proto/go-binlog"
 	"github.com/pingcap/tidb/types"
 )
 
+// IsSlaveBinlogData returns true if the binlog carries the DMLs or the DDL of a txn. The others, like the txn markers
+// and the resolved ts records drainer writes to kafka optionally, share the CommitTs of the txns, so they should be
+// dropped before deduplicating the binlogs by CommitTs.
+func IsSlaveBinlogData(binlog *pb.Binlog) bool {
+	return binlog.Type == pb.BinlogType_DML || binlog.Type == pb.BinlogType_DDL
+}
+
 // SlaveBinlogToTxn translate the Binlog format into Txn
 func SlaveBinlogToTxn(binlog *pb.Binlog) (*Txn, error) {
+	if !IsSlaveBinlogData(binlog) {
+		return nil, errors.Errorf("binlog of type %d carries no data, it should be dropped by IsSlaveBinlogData", binlog.Type)
+	}
 	txn := new(Txn)
 	var err error
 	switch binlog.Type {
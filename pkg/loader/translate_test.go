@@ -41,6 +41,18 @@ func (s *slaveBinlogToTxnSuite) TestTranslateDDL(c *C) {
 	c.Assert(txn.DDL.SQL, Equals, sql)
 }
 
+func (s *slaveBinlogToTxnSuite) TestRejectNonDataBinlog(c *C) {
+	// the txn markers and the resolved ts records of drainer
+	for _, tp := range []pb.BinlogType{2, 3, 4} {
+		binlog := pb.Binlog{Type: tp, CommitTs: 42}
+		c.Assert(IsSlaveBinlogData(&binlog), IsFalse)
+		_, err := SlaveBinlogToTxn(&binlog)
+		c.Assert(err, ErrorMatches, ".*carries no data.*")
+	}
+	c.Assert(IsSlaveBinlogData(&pb.Binlog{Type: pb.BinlogType_DDL}), IsTrue)
+	c.Assert(IsSlaveBinlogData(&pb.Binlog{Type: pb.BinlogType_DML}), IsTrue)
+}
+
 func (s *slaveBinlogToTxnSuite) TestTranslateDML(c *C) {
 	db, table := "test", "hello"
 	var oldVal, newVal int64 = 41, 42
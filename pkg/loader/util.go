@@ -14,13 +14,22 @@
 package loader
 
 import (
+	"context"
 	gosql "database/sql"
 	"fmt"
 	"hash/crc32"
+	"net"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
@@ -30,7 +39,7 @@ var (
 
 const (
 	colsSQL = `
-SELECT column_name, extra FROM information_schema.columns
+SELECT column_name, extra, column_type FROM information_schema.columns
 WHERE table_schema = ? AND table_name = ?;`
 	uniqKeysSQL = `
 SELECT non_unique, index_name, seq_in_index, column_name 
@@ -44,6 +53,36 @@ type tableInfo struct {
 	primaryKey *indexInfo
 	// include primary key if have
 	uniqueKeys []indexInfo
+	// the members of ENUM and SET columns, keyed by column name
+	elems map[string]*columnElems
+	// the ranges of integer and DECIMAL columns, keyed by column name
+	numerics map[string]*numericRange
+	// the table info using ImplicitRowIDColumn as the primary key,
+	// only set if the row id is included and the table has no primary key or unique key.
+	rowIDInfo *tableInfo
+}
+
+// setRowIDInfo sets rowIDInfo if the table has ImplicitRowIDColumn but no primary key or unique key
+func (info *tableInfo) setRowIDInfo() {
+	if len(info.uniqueKeys) > 0 {
+		return
+	}
+
+	for _, col := range info.columns {
+		if col != ImplicitRowIDColumn {
+			continue
+		}
+		rowIDInfo := *info
+		rowIDInfo.uniqueKeys = []indexInfo{{name: ImplicitRowIDColumn, columns: []string{ImplicitRowIDColumn}}}
+		rowIDInfo.primaryKey = &rowIDInfo.uniqueKeys[0]
+		info.rowIDInfo = &rowIDInfo
+		return
+	}
+}
+
+type columnElems struct {
+	isSet bool
+	names []string
 }
 
 type indexInfo struct {
@@ -56,7 +95,7 @@ type indexInfo struct {
 func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, err error) {
 	info = new(tableInfo)
 
-	if info.columns, err = getColsOfTbl(db, schema, table); err != nil {
+	if info.columns, info.elems, info.numerics, err = getColsOfTbl(db, schema, table); err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table)
 	}
 
@@ -79,19 +118,107 @@ func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, e
 
 // CreateDBWithSQLMode return sql.DB
 func CreateDBWithSQLMode(user string, password string, host string, port int, sqlMode *string) (db *gosql.DB, err error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4,utf8&interpolateParams=true&readTimeout=1m&multiStatements=true", user, password, host, port)
+	return CreateDBWithTimeZone(user, password, host, port, sqlMode, "")
+}
+
+// CreateDBWithTimeZone return sql.DB, the session time_zone is set to timeZone if it's not empty
+func CreateDBWithTimeZone(user string, password string, host string, port int, sqlMode *string, timeZone string) (db *gosql.DB, err error) {
+	vars := make(map[string]string)
 	if sqlMode != nil {
-		// same as "set sql_mode = '<sqlMode>'"
-		dsn += "&sql_mode='" + url.QueryEscape(*sqlMode) + "'"
+		vars["sql_mode"] = *sqlMode
+	}
+	if len(timeZone) > 0 {
+		vars["time_zone"] = timeZone
 	}
+	return CreateDBWithSessionVars(user, password, host, port, vars)
+}
+
+// CreateDBWithSessionVars return sql.DB, the session variables in vars are set on every connection,
+// e.g. {"time_zone": "UTC"} is the same as "set time_zone = 'UTC'".
+func CreateDBWithSessionVars(user string, password string, host string, port int, vars map[string]string) (db *gosql.DB, err error) {
+	return CreateDBWithInitSQL(user, password, host, port, vars, nil)
+}
+
+// CreateDBWithInitSQL return sql.DB, the session variables in vars are set on every connection, and then
+// the statements of initSQL are executed in order, e.g. "SET SESSION tidb_txn_mode = 'optimistic'".
+func CreateDBWithInitSQL(user string, password string, host string, port int, vars map[string]string, initSQL []string) (db *gosql.DB, err error) {
+	return CreateDBWithKeepAlive(user, password, host, port, vars, initSQL, 0)
+}
 
-	db, err = gosql.Open("mysql", dsn)
+// CreateDBWithKeepAlive is the same as CreateDBWithInitSQL, and the TCP keepalive probes are sent every keepAlive
+// on the connections, the default period of Go is used if it's 0.
+func CreateDBWithKeepAlive(user string, password string, host string, port int, vars map[string]string, initSQL []string, keepAlive time.Duration) (db *gosql.DB, err error) {
+	db, err = pkgsql.OpenDSNWithInitSQL("mysql", sessionVarsDSN(keepAliveNetwork(keepAlive), user, password, host, port, vars), initSQL)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	return
 }
 
+// keepAliveNetworks are the networks registered to the mysql driver by keepAliveNetwork
+var keepAliveNetworks sync.Map
+
+// keepAliveNetwork returns the network of the DSN dialing the TCP connections by util.NewKeepAliveDialer(period),
+// it's registered to the mysql driver on the first use. It's "tcp" if period is 0.
+func keepAliveNetwork(period time.Duration) string {
+	if period <= 0 {
+		return "tcp"
+	}
+
+	network := "tcp-keepalive-" + period.String()
+	if _, loaded := keepAliveNetworks.LoadOrStore(network, struct{}{}); !loaded {
+		dialer := util.NewKeepAliveDialer(period)
+		mysql.RegisterDial(network, func(addr string) (net.Conn, error) {
+			return dialer.Dial("tcp", addr)
+		})
+	}
+	return network
+}
+
+func sessionVarsDSN(network string, user string, password string, host string, port int, vars map[string]string) string {
+	dsn := fmt.Sprintf("%s:%s@%s(%s:%d)/?charset=utf8mb4,utf8&interpolateParams=true&readTimeout=1m&multiStatements=true", user, password, network, host, port)
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// same as "set <name> = '<value>'"
+		dsn += "&" + name + "='" + url.QueryEscape(vars[name]) + "'"
+	}
+	return dsn
+}
+
+// warmupDB opens n connections of db concurrently and pings them, the connections
+// are put back to the pool as idle ones, the idle limit of db must be at least n.
+func warmupDB(ctx context.Context, db *gosql.DB, n int) error {
+	var (
+		mu    sync.Mutex
+		conns = make([]*gosql.Conn, 0, n)
+	)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	errg, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < n; i++ {
+		errg.Go(func() error {
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			return errors.Trace(conn.PingContext(ctx))
+		})
+	}
+	return errg.Wait()
+}
+
 // CreateDB return sql.DB
 func CreateDB(user string, password string, host string, port int) (db *gosql.DB, err error) {
 	return CreateDBWithSQLMode(user, password, host, port, nil)
@@ -136,53 +263,139 @@ func splitDMLs(dmls []*DML, size int) (res [][]*DML) {
 	return
 }
 
-func buildColumnList(names []string) string {
+func buildColumnList(quote pkgsql.IdentifierQuote, names []string) string {
 	var b strings.Builder
 	for i, name := range names {
 		if i > 0 {
 			b.WriteString(",")
 		}
-		b.WriteString(quoteName(name))
+		b.WriteString(quote.Name(name))
 
 	}
 
 	return b.String()
 }
 
-// getColsOfTbl returns a slice of the names of all columns,
+// getColsOfTbl returns a slice of the names of all columns, the members of ENUM and SET columns
+// and the ranges of integer and DECIMAL columns,
 // generated columns are excluded.
 // https://dev.mysql.com/doc/mysql-infoschema-excerpt/5.7/en/columns-table.html
-func getColsOfTbl(db *gosql.DB, schema, table string) ([]string, error) {
+func getColsOfTbl(db *gosql.DB, schema, table string) ([]string, map[string]*columnElems, map[string]*numericRange, error) {
 	rows, err := db.Query(colsSQL, schema, table)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, nil, nil, errors.Trace(err)
 	}
 	defer rows.Close()
 
 	cols := make([]string, 0, 1)
+	var elems map[string]*columnElems
+	var numerics map[string]*numericRange
 	for rows.Next() {
-		var name, extra string
-		err = rows.Scan(&name, &extra)
+		var name, extra, columnType string
+		err = rows.Scan(&name, &extra, &columnType)
 		if err != nil {
-			return nil, errors.Trace(err)
+			return nil, nil, nil, errors.Trace(err)
 		}
 		isGenerated := strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED")
 		if isGenerated {
 			continue
 		}
 		cols = append(cols, name)
+
+		if colElems, ok := parseColumnElems(columnType); ok {
+			if elems == nil {
+				elems = make(map[string]*columnElems)
+			}
+			elems[name] = colElems
+		}
+		if r, ok := parseNumericRange(columnType); ok {
+			if numerics == nil {
+				numerics = make(map[string]*numericRange)
+			}
+			numerics[name] = r
+		}
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, errors.Trace(err)
+		return nil, nil, nil, errors.Trace(err)
 	}
 
 	// if no any columns returns, means the table not exist.
 	if len(cols) == 0 {
-		return nil, ErrTableNotExist
+		return nil, nil, nil, ErrTableNotExist
+	}
+
+	return cols, elems, numerics, nil
+}
+
+// parseColumnElems parses the members of the column type like enum('a','b') or set('a','b'),
+// ok is false if it's not an ENUM or SET column type.
+func parseColumnElems(columnType string) (elems *columnElems, ok bool) {
+	lower := strings.ToLower(columnType)
+	switch {
+	case strings.HasPrefix(lower, "enum("):
+		elems = &columnElems{}
+		columnType = columnType[len("enum("):]
+	case strings.HasPrefix(lower, "set("):
+		elems = &columnElems{isSet: true}
+		columnType = columnType[len("set("):]
+	default:
+		return nil, false
 	}
 
-	return cols, nil
+	var name strings.Builder
+	inQuote := false
+	for i := 0; i < len(columnType); i++ {
+		ch := columnType[i]
+		switch {
+		case !inQuote:
+			if ch == '\'' {
+				inQuote = true
+				name.Reset()
+			}
+		case ch == '\\' && i+1 < len(columnType):
+			i++
+			name.WriteByte(columnType[i])
+		case ch == '\'' && i+1 < len(columnType) && columnType[i+1] == '\'':
+			// the quote is escaped by doubling it
+			i++
+			name.WriteByte(ch)
+		case ch == '\'':
+			inQuote = false
+			elems.names = append(elems.names, name.String())
+		default:
+			name.WriteByte(ch)
+		}
+	}
+	return elems, true
+}
+
+// has returns whether value is a member, or consists of members for SET.
+// The members are compared case-insensitively as the default collations do.
+func (e *columnElems) has(value string) bool {
+	// it's the empty SET, or the special error value of ENUM
+	if len(value) == 0 {
+		return true
+	}
+
+	members := []string{value}
+	if e.isSet {
+		members = strings.Split(value, ",")
+	}
+
+	for _, member := range members {
+		found := false
+		for _, name := range e.names {
+			if strings.EqualFold(name, member) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
 // https://dev.mysql.com/doc/mysql-infoschema-excerpt/5.7/en/statistics-table.html
@@ -216,13 +429,15 @@ func getUniqKeys(db *gosql.DB, schema, table string) (uniqueKeys []indexInfo, er
 		// Search for indexInfo with the current keyName
 		for i = 0; i < len(uniqueKeys); i++ {
 			if uniqueKeys[i].name == keyName {
-				uniqueKeys[i].columns = append(uniqueKeys[i].columns, columnName)
 				break
 			}
 		}
 		// If we don't find the indexInfo with the loop above, create a new one
 		if i == len(uniqueKeys) {
-			uniqueKeys = append(uniqueKeys, indexInfo{keyName, []string{columnName}})
+			uniqueKeys = append(uniqueKeys, indexInfo{name: keyName})
+		}
+		if uniqueKeys[i].columns, err = setIndexColumn(uniqueKeys[i].columns, seqInIndex, columnName); err != nil {
+			return nil, errors.Annotatef(err, "index %s of table `%s`.`%s`", keyName, schema, table)
 		}
 	}
 
@@ -230,5 +445,26 @@ func getUniqKeys(db *gosql.DB, schema, table string) (uniqueKeys []indexInfo, er
 		return nil, errors.Trace(err)
 	}
 
+	for _, index := range uniqueKeys {
+		for seq, column := range index.columns {
+			if len(column) == 0 {
+				return nil, errors.Errorf("column %d of index %s of table `%s`.`%s` is missing", seq+1, index.name, schema, table)
+			}
+		}
+	}
+
 	return
 }
+
+// setIndexColumn puts the column at seqInIndex of the index columns, so the columns of a composite key,
+// e.g. the clustered primary key of TiDB, are in the order of the definition however the rows are ordered.
+func setIndexColumn(columns []string, seqInIndex int, columnName string) ([]string, error) {
+	if seqInIndex < 1 {
+		return nil, errors.Errorf("invalid seq_in_index %d of column %s", seqInIndex, columnName)
+	}
+	for len(columns) < seqInIndex {
+		columns = append(columns, "")
+	}
+	columns[seqInIndex-1] = columnName
+	return columns, nil
+}
@@ -14,8 +14,10 @@
 package loader
 
 import (
+	"net"
 	"regexp"
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	check "github.com/pingcap/check"
@@ -31,6 +33,56 @@ var _ = check.Suite(&UtilSuite{})
 func (cs *UtilSuite) SetUpTest(c *check.C) {
 }
 
+func (cs *UtilSuite) TestSessionVarsDSN(c *check.C) {
+	base := "root:secret@tcp(127.0.0.1:3306)/?charset=utf8mb4,utf8&interpolateParams=true&readTimeout=1m&multiStatements=true"
+	c.Assert(sessionVarsDSN("tcp", "root", "secret", "127.0.0.1", 3306, nil), check.Equals, base)
+
+	// the child rows can be written before the parent rows with foreign key checks disabled
+	dsn := sessionVarsDSN("tcp", "root", "secret", "127.0.0.1", 3306, map[string]string{
+		"time_zone":          "Asia/Shanghai",
+		"foreign_key_checks": "OFF",
+		"sql_mode":           "",
+	})
+	c.Assert(dsn, check.Equals, base+"&foreign_key_checks='OFF'&sql_mode=''&time_zone='Asia%2FShanghai'")
+}
+
+func (cs *UtilSuite) TestKeepAliveNetwork(c *check.C) {
+	c.Assert(keepAliveNetwork(0), check.Equals, "tcp")
+	c.Assert(keepAliveNetwork(30*time.Second), check.Equals, "tcp-keepalive-30s")
+	c.Assert(keepAliveNetwork(30*time.Second), check.Equals, "tcp-keepalive-30s")
+	c.Assert(sessionVarsDSN(keepAliveNetwork(time.Minute), "root", "", "127.0.0.1", 3306, nil), check.Matches, `root:@tcp-keepalive-1m0s\(127.0.0.1:3306\)/.*`)
+
+	// the connections are dialed by the network registered
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		// the driver retries the bad connections, close all of them
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			select {
+			case accepted <- struct{}{}:
+			default:
+			}
+			conn.Close()
+		}
+	}()
+	port := l.Addr().(*net.TCPAddr).Port
+	db, err := CreateDBWithKeepAlive("root", "", "127.0.0.1", port, nil, nil, time.Minute)
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	c.Assert(db.Ping(), check.NotNil)
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		c.Fatal("the connection isn't dialed")
+	}
+}
+
 func (cs *UtilSuite) TestGetTableInfoTableNotExist(c *check.C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, check.IsNil)
@@ -38,7 +90,7 @@ func (cs *UtilSuite) TestGetTableInfoTableNotExist(c *check.C) {
 	defer db.Close()
 
 	// return empty rows
-	columnRows := sqlmock.NewRows([]string{"Field", "Extra"})
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Type"})
 	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
 
 	_, err = getTableInfo(db, "test", "test1")
@@ -55,12 +107,12 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 	// (id, a1, a2, a3, a4)
 	// primary key: id
 	// unique key: (a1) (a2,a3)
-	columnRows := sqlmock.NewRows([]string{"Field", "Extra"}).
-		AddRow("id", "").
-		AddRow("a1", "").
-		AddRow("a2", "").
-		AddRow("a3", "VIRTUAL GENERATED").
-		AddRow("a4", "")
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Type"}).
+		AddRow("id", "", "int(11)").
+		AddRow("a1", "", "int(11)").
+		AddRow("a2", "", "int(11)").
+		AddRow("a3", "VIRTUAL GENERATED", "int(11)").
+		AddRow("a4", "", "int(11)")
 	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
 
 	indexRows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}).
@@ -75,6 +127,9 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 	info, err := getTableInfo(db, "test", "test1")
 	c.Assert(err, check.IsNil)
 	c.Assert(info, check.NotNil)
+	// the ranges of the integer columns are checked by TestParseNumericRange
+	c.Assert(info.numerics, check.HasLen, 4)
+	info.numerics = nil
 
 	c.Assert(info, check.DeepEquals, &tableInfo{
 		columns:    []string{"id", "a1", "a2", "a4"}, // generated column a3 is ignored
@@ -84,3 +139,73 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 			{"dex2", []string{"a2", "a3"}},
 		}})
 }
+
+func (cs *UtilSuite) TestGetTableInfoWithCompositePrimaryKey(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	// (a, b, c) with the clustered primary key (c, a)
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Type"}).
+		AddRow("a", "", "varchar(20)").
+		AddRow("b", "", "varchar(20)").
+		AddRow("c", "", "varchar(20)")
+	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
+	// the columns of the key are put in the order of the definition though the rows are not ordered
+	indexRows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}).
+		AddRow(0, "PRIMARY", 2, "a").
+		AddRow(0, "PRIMARY", 1, "c")
+	mock.ExpectQuery(regexp.QuoteMeta(uniqKeysSQL)).WithArgs("test", "test1").WillReturnRows(indexRows)
+
+	info, err := getTableInfo(db, "test", "test1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.primaryKey, check.DeepEquals, &indexInfo{"PRIMARY", []string{"c", "a"}})
+	c.Assert(info.uniqueKeys, check.DeepEquals, []indexInfo{{"PRIMARY", []string{"c", "a"}}})
+
+	// a column of the key is missing
+	mock.ExpectQuery(regexp.QuoteMeta(uniqKeysSQL)).WithArgs("test", "test1").
+		WillReturnRows(sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}).
+			AddRow(0, "PRIMARY", 2, "a"))
+	_, err = getUniqKeys(db, "test", "test1")
+	c.Assert(err, check.ErrorMatches, "column 1 of index PRIMARY of table `test`.`test1` is missing")
+}
+
+func (cs *UtilSuite) TestGetTableInfoWithElems(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	columnRows := sqlmock.NewRows([]string{"Field", "Extra", "Type"}).
+		AddRow("id", "", "int(11)").
+		AddRow("sex", "", "enum('male','female')").
+		AddRow("tags", "", "set('a','b','c')")
+	mock.ExpectQuery(regexp.QuoteMeta(colsSQL)).WithArgs("test", "test1").WillReturnRows(columnRows)
+	mock.ExpectQuery(regexp.QuoteMeta(uniqKeysSQL)).WithArgs("test", "test1").
+		WillReturnRows(sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}))
+
+	info, err := getTableInfo(db, "test", "test1")
+	c.Assert(err, check.IsNil)
+	c.Assert(info.elems, check.DeepEquals, map[string]*columnElems{
+		"sex":  {names: []string{"male", "female"}},
+		"tags": {isSet: true, names: []string{"a", "b", "c"}},
+	})
+	c.Assert(info.numerics, check.HasLen, 1)
+	c.Assert(info.numerics["id"].max.String(), check.Equals, "2147483647/1")
+}
+
+func (cs *UtilSuite) TestParseColumnElems(c *check.C) {
+	_, ok := parseColumnElems("varchar(45)")
+	c.Assert(ok, check.IsFalse)
+
+	elems, ok := parseColumnElems("ENUM('a','it''s','b,c','x\\\\y','')")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(elems, check.DeepEquals, &columnElems{names: []string{"a", "it's", "b,c", "x\\y", ""}})
+
+	elems, ok = parseColumnElems("set('a','b')")
+	c.Assert(ok, check.IsTrue)
+	c.Assert(elems, check.DeepEquals, &columnElems{isSet: true, names: []string{"a", "b"}})
+	c.Assert(elems.has("a,b"), check.IsTrue)
+	c.Assert(elems.has("B"), check.IsTrue)
+	c.Assert(elems.has(""), check.IsTrue)
+	c.Assert(elems.has("a,c"), check.IsFalse)
+}
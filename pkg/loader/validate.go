@@ -0,0 +1,61 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	tmysql "github.com/pingcap/parser/mysql"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	_ "github.com/pingcap/tidb/types/parser_driver" // for parsing the placeholders
+)
+
+// validateSQL parses query by the TiDB parser, it returns the error with the query if it doesn't parse.
+// The identifiers quoted by double quotes are parsed in sql_mode ANSI_QUOTES like downstream does.
+func validateSQL(query string, quote pkgsql.IdentifierQuote) error {
+	p := parser.New()
+	if quote == pkgsql.DoubleQuote {
+		p.SetSQLMode(tmysql.ModeANSIQuotes)
+	}
+	if _, _, err := p.Parse(query, "", ""); err != nil {
+		return errors.Annotatef(err, "invalid SQL generated: %s", query)
+	}
+	return nil
+}
+
+// validateDMLs validates the statements generated to apply dmls if the validation is enabled,
+// it's done before executing them, so the invalid statement fails fast instead of being retried.
+func (s *loaderImpl) validateDMLs(dmls []*DML, safeMode bool) error {
+	if !s.validateSQL {
+		return nil
+	}
+
+	for _, dml := range dmls {
+		// the bulk statements are built from the same quoted names and columns as the single ones
+		for _, stmt := range genExecStmts(dml, safeMode || s.merge) {
+			if err := validateSQL(stmt.query, s.quote); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDDL validates the DDL executed in downstream if the validation is enabled
+func (s *loaderImpl) validateDDL(ddl *DDL) error {
+	if !s.validateSQL {
+		return nil
+	}
+	return errors.Trace(validateSQL(ddl.SQL, s.quote))
+}
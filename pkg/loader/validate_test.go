@@ -0,0 +1,81 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+)
+
+type validateSQLSuite struct{}
+
+var _ = check.Suite(&validateSQLSuite{})
+
+func (s *validateSQLSuite) TestValidateSQL(c *check.C) {
+	c.Assert(validateSQL("REPLACE INTO `test`.`t`(`id`,`v`) VALUES(?,?)", pkgsql.BacktickQuote), check.IsNil)
+	c.Assert(validateSQL(`DELETE FROM "test"."t" WHERE "id" = ? LIMIT 1`, pkgsql.DoubleQuote), check.IsNil)
+
+	err := validateSQL("INSERT INTO `test`.`t`(`id`,`v`) VALUES(?,", pkgsql.BacktickQuote)
+	c.Assert(err, check.ErrorMatches, "invalid SQL generated: INSERT INTO `test`.`t`\\(`id`,`v`\\) VALUES\\(\\?,.*")
+	// the double quotes are string literals without ANSI_QUOTES
+	err = validateSQL(`DELETE FROM "test"."t" WHERE "id" = ? LIMIT 1`, pkgsql.BacktickQuote)
+	c.Assert(err, check.ErrorMatches, "invalid SQL generated: DELETE FROM \"test\".*")
+}
+
+func (s *validateSQLSuite) TestValidateDMLs(c *check.C) {
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"id": 1, "v": "a"},
+		info:     schedTableInfo,
+		quote:    pkgsql.DoubleQuote,
+	}
+
+	loader := &loaderImpl{quote: pkgsql.BacktickQuote, ctx: context.Background()}
+	// not validated by default
+	c.Assert(loader.validateDMLs([]*DML{dml}, false), check.IsNil)
+
+	// the DML is quoted by a different quote from downstream like a bug of translating
+	loader.validateSQL = true
+	c.Assert(loader.validateDMLs([]*DML{dml}, false), check.ErrorMatches, "invalid SQL generated: .*")
+
+	loader.quote = pkgsql.DoubleQuote
+	c.Assert(loader.validateDMLs([]*DML{dml}, false), check.IsNil)
+}
+
+func (s *validateSQLSuite) TestFailFast(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	// nothing is executed in downstream
+	loader := &loaderImpl{db: db, ctx: context.Background(), validateSQL: true, quote: pkgsql.BacktickQuote}
+	err = loader.execDDL(&DDL{Database: "test", Table: "t", SQL: "CREATE TABLE `t` (`id` INT"})
+	c.Assert(err, check.ErrorMatches, "invalid SQL generated: CREATE TABLE `t` \\(`id` INT.*")
+
+	dml := &DML{
+		Database: "test",
+		Table:    "t",
+		Tp:       DeleteDMLType,
+		Values:   map[string]interface{}{"id": 1},
+		info:     schedTableInfo,
+		quote:    pkgsql.DoubleQuote,
+	}
+	err = loader.applyDMLs([]*DML{dml}, false, maxDMLRetryCount)
+	c.Assert(err, check.ErrorMatches, "invalid SQL generated: .*")
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loopbacksync
+
+import (
+	"fmt"
+
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+)
+
+const (
+	// MarkTableSchema is the schema of the mark table
+	MarkTableSchema = "tidb_binlog"
+	// MarkTableName is the name of the mark table, every transaction written by
+	// drainer also updates a row of this table, so that the drainer of the opposite
+	// direction can recognize the transaction and skip it.
+	MarkTableName = "_drainer_repl_mark"
+	// ChannelID is the column name of the channel id
+	ChannelID = "channel_id"
+	// ID is the column name of the row id in one channel
+	ID = "id"
+	// Val is the column name of the value updated by every transaction
+	Val = "val"
+)
+
+// LoopBackSync holds the information used to break the replication loop
+// between two clusters replicating to each other.
+type LoopBackSync struct {
+	ChannelID       int64
+	LoopbackControl bool
+}
+
+// NewLoopBackSyncInfo returns a LoopBackSync
+func NewLoopBackSyncInfo(channelID int64, loopbackControl bool) *LoopBackSync {
+	return &LoopBackSync{
+		ChannelID:       channelID,
+		LoopbackControl: loopbackControl,
+	}
+}
+
+// Enabled returns true if loop back control is enabled
+func (l *LoopBackSync) Enabled() bool {
+	return l != nil && l.LoopbackControl
+}
+
+// CreateMarkSchemaSQL returns the sql to create the schema of mark table
+func CreateMarkSchemaSQL(quote pkgsql.IdentifierQuote) string {
+	return fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quote.Name(MarkTableSchema))
+}
+
+// CreateMarkTableSQL returns the sql to create the mark table with the table options
+func CreateMarkTableSQL(quote pkgsql.IdentifierQuote, options pkgsql.TableOptions) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s BIGINT NOT NULL, %s BIGINT NOT NULL, %s BIGINT NOT NULL DEFAULT 0, PRIMARY KEY (%s, %s))%s",
+		quote.Schema(MarkTableSchema, MarkTableName), quote.Name(ChannelID), quote.Name(ID), quote.Name(Val), quote.Name(ChannelID), quote.Name(ID), options.SQL())
+}
+
+// UpdateMarkSQL returns the sql to mark the transaction as written by drainer,
+// the arguments are channel id and row id.
+func UpdateMarkSQL(quote pkgsql.IdentifierQuote) string {
+	return fmt.Sprintf("INSERT INTO %s(%s, %s, %s) VALUES(?, ?, 1) ON DUPLICATE KEY UPDATE %s = %s + 1",
+		quote.Schema(MarkTableSchema, MarkTableName), quote.Name(ChannelID), quote.Name(ID), quote.Name(Val), quote.Name(Val), quote.Name(Val))
+}
+
+// IsMarkTable returns true if the table is the mark table
+func IsMarkTable(schema, table string) bool {
+	return schema == MarkTableSchema && table == MarkTableName
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// CheckInitSQL checks the statements executed on every new connection, they must not be empty
+func CheckInitSQL(initSQL []string) error {
+	for i, stmt := range initSQL {
+		if len(strings.TrimSpace(stmt)) == 0 {
+			return errors.Errorf("the init sql #%d is empty", i)
+		}
+	}
+	return nil
+}
+
+// OpenDSNWithInitSQL creates an instance of sql.DB by the driver registered as proto, the statements
+// of initSQL are executed in order on every new connection before it's used, e.g. to set up the session
+// by the statements which can't be set in the dsn. It's the same as sql.Open if initSQL is empty.
+func OpenDSNWithInitSQL(proto string, dsn string, initSQL []string) (*sql.DB, error) {
+	if err := CheckInitSQL(initSQL); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	db, err := sql.Open(proto, dsn)
+	if err != nil || len(initSQL) == 0 {
+		return db, errors.Trace(err)
+	}
+	// sql.Open doesn't connect, it's only to look up the driver
+	drv := db.Driver()
+	if err = db.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return sql.OpenDB(&initSQLConnector{drv: drv, dsn: dsn, initSQL: initSQL}), nil
+}
+
+// initSQLConnector opens the connections by drv, and executes initSQL on every one of them
+type initSQLConnector struct {
+	drv     driver.Driver
+	dsn     string
+	initSQL []string
+}
+
+// Connect implements driver.Connector
+func (c *initSQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		// returned as it's, so driver.ErrBadConn is still recognized by database/sql
+		return nil, err
+	}
+	for _, stmt := range c.initSQL {
+		if err = execOnConn(ctx, conn, stmt); err != nil {
+			conn.Close()
+			if errors.Cause(err) == driver.ErrBadConn {
+				// database/sql retries with a new connection only if it's driver.ErrBadConn itself
+				return nil, driver.ErrBadConn
+			}
+			return nil, errors.Annotatef(err, "exec init sql %s failed", stmt)
+		}
+	}
+	return conn, nil
+}
+
+// Driver implements driver.Connector
+func (c *initSQLConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+func execOnConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return errors.Trace(err)
+		}
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer stmt.Close()
+	if stmtExecer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = stmtExecer.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil)
+	}
+	return errors.Trace(err)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -124,12 +125,30 @@ func ExecuteTxnWithHistogram(db *sql.DB, sqls []string, args [][]interface{}, hi
 
 // OpenDBWithSQLMode creates an instance of sql.DB.
 func OpenDBWithSQLMode(proto string, host string, port int, username string, password string, sqlMode *string) (*sql.DB, error) {
+	return openDB(proto, host, port, username, password, sqlMode, "", nil)
+}
+
+// OpenDBWithTLS creates an instance of sql.DB, the connections are encrypted by the TLS config
+// registered as tlsName by mysql.RegisterTLSConfig if tlsName isn't empty.
+func OpenDBWithTLS(proto string, host string, port int, username string, password string, tlsName string) (*sql.DB, error) {
+	return openDB(proto, host, port, username, password, nil, tlsName, nil)
+}
+
+// OpenDBWithInitSQL is the same as OpenDBWithTLS, and the statements of initSQL are executed on every new connection.
+func OpenDBWithInitSQL(proto string, host string, port int, username string, password string, tlsName string, initSQL []string) (*sql.DB, error) {
+	return openDB(proto, host, port, username, password, nil, tlsName, initSQL)
+}
+
+func openDB(proto string, host string, port int, username string, password string, sqlMode *string, tlsName string, initSQL []string) (*sql.DB, error) {
 	dbDSN := fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4,utf8&multiStatements=true", username, password, host, port)
 	if sqlMode != nil {
 		// same as "set sql_mode = '<sqlMode>'"
 		dbDSN += "&sql_mode='" + url.QueryEscape(*sqlMode) + "'"
 	}
-	db, err := sql.Open(proto, dbDSN)
+	if len(tlsName) > 0 {
+		dbDSN += "&tls=" + url.QueryEscape(tlsName)
+	}
+	db, err := OpenDSNWithInitSQL(proto, dbDSN, initSQL)
 	if err != nil {
 		return nil, errors.Annotatef(err, "dsn: %s", dbDSN)
 	}
@@ -291,14 +310,84 @@ func OpenCH(host string, port int, username string, password string, dbName stri
 
 // QuoteSchema quote like `dbname`.`table` name
 func QuoteSchema(schema string, table string) string {
-	return fmt.Sprintf("%s.%s", QuoteName(schema), QuoteName(table))
+	return BacktickQuote.Schema(schema, table)
 }
 
 // QuoteName quote name like `name`
 func QuoteName(name string) string {
-	return "`" + escapeName(name) + "`"
+	return BacktickQuote.Name(name)
+}
+
+// IdentifierQuote is the character quoting the identifiers in the generated SQLs,
+// the zero value quotes like BacktickQuote.
+type IdentifierQuote byte
+
+const (
+	// BacktickQuote quotes identifiers like `name`
+	BacktickQuote IdentifierQuote = '`'
+	// DoubleQuote quotes identifiers like "name", it's for the downstream with sql_mode ANSI_QUOTES
+	DoubleQuote IdentifierQuote = '"'
+)
+
+// ParseIdentifierQuote parses the name of quote, "backtick" or "double-quote",
+// the empty name means backtick.
+func ParseIdentifierQuote(name string) (IdentifierQuote, error) {
+	switch name {
+	case "", "backtick":
+		return BacktickQuote, nil
+	case "double-quote":
+		return DoubleQuote, nil
+	default:
+		return 0, errors.Errorf("unknown identifier quote %s, must be backtick or double-quote", name)
+	}
+}
+
+// Name quote name like `name` or "name"
+func (q IdentifierQuote) Name(name string) string {
+	c := string(q.char())
+	return c + strings.Replace(name, c, c+c, -1) + c
 }
 
-func escapeName(name string) string {
-	return strings.Replace(name, "`", "``", -1)
+// Schema quote like `dbname`.`table` or "dbname"."table"
+func (q IdentifierQuote) Schema(schema string, table string) string {
+	return q.Name(schema) + "." + q.Name(table)
+}
+
+func (q IdentifierQuote) char() byte {
+	if q == 0 {
+		return byte(BacktickQuote)
+	}
+	return byte(q)
+}
+
+// TableOptions is the default charset and collation of the tables created by drainer in downstream,
+// the default of the database is used if they're empty.
+type TableOptions struct {
+	Charset   string
+	Collation string
+}
+
+var charsetNameRegexp = regexp.MustCompile(`^[0-9A-Za-z_]*$`)
+
+// Validate checks the charset and collation are valid names
+func (o TableOptions) Validate() error {
+	if !charsetNameRegexp.MatchString(o.Charset) {
+		return errors.Errorf("invalid charset %s", o.Charset)
+	}
+	if !charsetNameRegexp.MatchString(o.Collation) {
+		return errors.Errorf("invalid collation %s", o.Collation)
+	}
+	return nil
+}
+
+// SQL returns the table options to append to the CREATE TABLE statement, it's empty if neither is set.
+func (o TableOptions) SQL() string {
+	var sql string
+	if len(o.Charset) > 0 {
+		sql += " DEFAULT CHARSET=" + o.Charset
+	}
+	if len(o.Collation) > 0 {
+		sql += " COLLATE=" + o.Collation
+	}
+	return sql
 }
@@ -14,7 +14,9 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"testing"
 	"time"
@@ -37,6 +39,45 @@ func (s *quoteSuite) TestQuoteSchema(c *C) {
 	c.Assert(QuoteSchema("wEi`rd", "Na`me"), Equals, "`wEi``rd`.`Na``me`")
 }
 
+func (s *quoteSuite) TestIdentifierQuote(c *C) {
+	c.Assert(BacktickQuote.Name("wEi`rd\"Na`me"), Equals, "`wEi``rd\"Na``me`")
+	c.Assert(BacktickQuote.Schema("music", "subjects"), Equals, "`music`.`subjects`")
+	c.Assert(DoubleQuote.Name("wEi`rd\"Na`me"), Equals, `"wEi`+"`"+`rd""Na`+"`"+`me"`)
+	c.Assert(DoubleQuote.Schema("wEi\"rd", "subjects"), Equals, `"wEi""rd"."subjects"`)
+	var zero IdentifierQuote
+	c.Assert(zero.Schema("music", "subjects"), Equals, "`music`.`subjects`")
+
+	for name, expect := range map[string]IdentifierQuote{
+		"":             BacktickQuote,
+		"backtick":     BacktickQuote,
+		"double-quote": DoubleQuote,
+	} {
+		quote, err := ParseIdentifierQuote(name)
+		c.Assert(err, IsNil)
+		c.Assert(quote, Equals, expect)
+	}
+	_, err := ParseIdentifierQuote("single-quote")
+	c.Assert(err, ErrorMatches, "unknown identifier quote single-quote.*")
+}
+
+type tableOptionsSuite struct{}
+
+var _ = Suite(&tableOptionsSuite{})
+
+func (s *tableOptionsSuite) TestSQL(c *C) {
+	c.Assert(TableOptions{}.SQL(), Equals, "")
+	c.Assert(TableOptions{Charset: "utf8mb4"}.SQL(), Equals, " DEFAULT CHARSET=utf8mb4")
+	c.Assert(TableOptions{Collation: "utf8mb4_bin"}.SQL(), Equals, " COLLATE=utf8mb4_bin")
+	c.Assert(TableOptions{Charset: "utf8mb4", Collation: "utf8mb4_bin"}.SQL(), Equals, " DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin")
+}
+
+func (s *tableOptionsSuite) TestValidate(c *C) {
+	c.Assert(TableOptions{}.Validate(), IsNil)
+	c.Assert(TableOptions{Charset: "latin1", Collation: "latin1_swedish_ci"}.Validate(), IsNil)
+	c.Assert(TableOptions{Charset: "utf8mb4; DROP TABLE t"}.Validate(), ErrorMatches, "invalid charset.*")
+	c.Assert(TableOptions{Collation: "utf8mb4-bin"}.Validate(), ErrorMatches, "invalid collation.*")
+}
+
 type parseCHAddrSuite struct{}
 
 var _ = Suite(&parseCHAddrSuite{})
@@ -250,3 +291,55 @@ func (s *sqlSuite) TestExecuteSQLsWithRetryAndFailure(c *C) {
 	err := ExecuteSQLs(s.db, []string{query}, [][]interface{}{nil}, true)
 	c.Assert(err, ErrorMatches, "syntax error")
 }
+
+type initSQLSuite struct{}
+
+var _ = Suite(&initSQLSuite{})
+
+func (s *initSQLSuite) TestCheckInitSQL(c *C) {
+	c.Assert(CheckInitSQL(nil), IsNil)
+	c.Assert(CheckInitSQL([]string{"SET SESSION tidb_txn_mode = 'optimistic'"}), IsNil)
+	c.Assert(CheckInitSQL([]string{"SET SESSION tidb_txn_mode = 'optimistic'", " "}), ErrorMatches, "the init sql #1 is empty")
+
+	_, err := OpenDSNWithInitSQL("sqlmock", "init_sql_empty", []string{""})
+	c.Assert(err, ErrorMatches, "the init sql #0 is empty")
+}
+
+func (s *initSQLSuite) TestExecInitSQLOnConnect(c *C) {
+	mockDB, mock, err := sqlmock.NewWithDSN("init_sql_test")
+	c.Assert(err, IsNil)
+	defer mockDB.Close()
+
+	initSQL := []string{"SET SESSION tidb_txn_mode = 'optimistic'", "SET SESSION wait_timeout = 3600"}
+	db, err := OpenDSNWithInitSQL("sqlmock", "init_sql_test", initSQL)
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the init statements are executed in order once the connection is opened, and before the first query
+	mock.ExpectExec("SET SESSION tidb_txn_mode = 'optimistic'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION wait_timeout = 3600").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO t VALUES").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = db.Exec("INSERT INTO t VALUES (1)")
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the connection failing any init statement isn't used
+	db.SetMaxIdleConns(0)
+	mock.ExpectExec("SET SESSION tidb_txn_mode = 'optimistic'").WillReturnError(errors.New("unknown system variable"))
+	_, err = db.Exec("INSERT INTO t VALUES (2)")
+	c.Assert(err, ErrorMatches, "exec init sql SET SESSION tidb_txn_mode = 'optimistic' failed: unknown system variable")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *initSQLSuite) TestBadConnOnConnect(c *C) {
+	mockDB, mock, err := sqlmock.NewWithDSN("init_sql_bad_conn")
+	c.Assert(err, IsNil)
+	defer mockDB.Close()
+
+	// driver.ErrBadConn is returned as it's, so database/sql retries with a new connection
+	connector := &initSQLConnector{drv: mockDB.Driver(), dsn: "init_sql_bad_conn", initSQL: []string{"SET SESSION wait_timeout = 3600"}}
+	mock.ExpectExec("SET SESSION wait_timeout = 3600").WillReturnError(driver.ErrBadConn)
+	_, err = connector.Connect(context.Background())
+	c.Assert(err, Equals, driver.ErrBadConn)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+const autoRandomComment = "/*T![auto_rand] "
+
+// the string literals, quoted identifiers and comments are matched as a whole to be kept as is,
+// so the AUTO_RANDOM in them, like the one in `COMMENT 'id is AUTO_RANDOM'`, isn't changed.
+var autoRandomRegexp = regexp.MustCompile(`(?is)'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|` + "`[^`]*`" +
+	`|/\*.*?\*/|\bAUTO_RANDOM\b(\s*\(\s*\d+\s*\))?`)
+
+// CommentAutoRandom wraps the AUTO_RANDOM attributes of the DDL in TiDB's executable comment,
+// like `/*T![auto_rand] AUTO_RANDOM(5) */`, which is what TiDB shows in `SHOW CREATE TABLE`.
+// MySQL and the parser we depend on treat it as a comment, and the TiDB supporting it still executes it.
+func CommentAutoRandom(sql string) string {
+	return autoRandomRegexp.ReplaceAllStringFunc(sql, func(attr string) string {
+		if !strings.HasPrefix(strings.ToUpper(attr), "AUTO_RANDOM") {
+			return attr
+		}
+		return autoRandomComment + attr + " */"
+	})
+}
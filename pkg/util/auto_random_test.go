@@ -0,0 +1,44 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type autoRandomSuite struct{}
+
+var _ = Suite(&autoRandomSuite{})
+
+func (s *autoRandomSuite) TestCommentAutoRandom(c *C) {
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"create table t(id bigint primary key, a int)", "create table t(id bigint primary key, a int)"},
+		{"create table t(id bigint primary key auto_random(5), a int)", "create table t(id bigint primary key /*T![auto_rand] auto_random(5) */, a int)"},
+		{"CREATE TABLE t(id BIGINT AUTO_RANDOM PRIMARY KEY)", "CREATE TABLE t(id BIGINT /*T![auto_rand] AUTO_RANDOM */ PRIMARY KEY)"},
+		{"alter table t modify column id bigint auto_random ( 3 )", "alter table t modify column id bigint /*T![auto_rand] auto_random ( 3 ) */"},
+		// already commented
+		{"create table t(id bigint primary key /*T![auto_rand] AUTO_RANDOM(5) */)", "create table t(id bigint primary key /*T![auto_rand] AUTO_RANDOM(5) */)"},
+		{"create table t(auto_random_x int)", "create table t(auto_random_x int)"},
+		// the string literals, quoted identifiers and comments are kept as is
+		{"create table t(id bigint primary key auto_random comment 'it''s auto_random(5)') comment = \"auto_random \\\" table\"",
+			"create table t(id bigint primary key /*T![auto_rand] auto_random */ comment 'it''s auto_random(5)') comment = \"auto_random \\\" table\""},
+		{"alter table t change `auto_random` a int /* auto_random */", "alter table t change `auto_random` a int /* auto_random */"},
+	}
+	for _, cs := range cases {
+		c.Assert(CommentAutoRandom(cs.sql), Equals, cs.expected)
+	}
+}
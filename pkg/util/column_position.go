@@ -0,0 +1,79 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	addSpecRegexp        = regexp.MustCompile("(?is)^\\s*add\\s+(`|\\w+)")
+	modifyColumnRegexp   = regexp.MustCompile(`(?is)^\s*(?:modify|change)\b`)
+	columnPositionRegexp = regexp.MustCompile("(?is)\\s+(?:first|after\\s+(?:`[^`]*`|\\w+))\\s*$")
+
+	// the keywords following `ADD` of the alter specs adding something other than columns
+	addNonColumnKeywords = map[string]struct{}{
+		"index": {}, "key": {}, "unique": {}, "primary": {}, "foreign": {}, "constraint": {},
+		"fulltext": {}, "spatial": {}, "partition": {}, "check": {}, "stats_extended": {},
+	}
+)
+
+// IsPositionalColumnDDL returns true if the sql is an ALTER TABLE statement adding, modifying or changing
+// a column at the position of `FIRST` or `AFTER col`.
+func IsPositionalColumnDDL(sql string) bool {
+	prefix := alterTableRegexp.FindString(sql)
+	if len(prefix) == 0 {
+		return false
+	}
+	for _, spec := range splitByCommas(sql[len(prefix):]) {
+		if isColumnSpec(spec) && columnPositionRegexp.MatchString(spec) {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoreColumnPositions removes the positions `FIRST` and `AFTER col` from the column specs of the ALTER TABLE,
+// for the downstream whose columns differ from upstream, e.g. with extra columns or without the column after
+// which a column is added. The column added is appended to the table, and the column modified or changed keeps
+// its position in downstream. The other DDLs are returned as they're.
+func IgnoreColumnPositions(sql string) string {
+	if !IsPositionalColumnDDL(sql) {
+		return sql
+	}
+
+	prefix := alterTableRegexp.FindString(sql)
+	specs := splitByCommas(sql[len(prefix):])
+	for i, spec := range specs {
+		if isColumnSpec(spec) {
+			specs[i] = columnPositionRegexp.ReplaceAllString(spec, "")
+		}
+	}
+	return prefix + strings.Join(specs, ",")
+}
+
+// isColumnSpec returns true if the alter spec adds, modifies or changes columns, no position follows
+// the columns added in parentheses, like `ADD COLUMN (a INT, b INT)`
+func isColumnSpec(spec string) bool {
+	if modifyColumnRegexp.MatchString(spec) {
+		return true
+	}
+	m := addSpecRegexp.FindStringSubmatch(spec)
+	if m == nil {
+		return false
+	}
+	_, ok := addNonColumnKeywords[strings.ToLower(m[1])]
+	return !ok
+}
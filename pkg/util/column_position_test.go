@@ -0,0 +1,67 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type columnPositionSuite struct{}
+
+var _ = Suite(&columnPositionSuite{})
+
+func (s *columnPositionSuite) TestIsPositionalColumnDDL(c *C) {
+	cases := []struct {
+		sql      string
+		expected bool
+	}{
+		{"ALTER TABLE `test`.`t` ADD COLUMN `c` INT AFTER `a`", true},
+		{"alter table t add c int first", true},
+		{"alter table t add column c int default 1 comment 'x' after b", true},
+		{"alter table t modify column c bigint first", true},
+		{"alter table t change c d bigint after `a b`", true},
+		{"alter table t add index idx(a), add column c int after a", true},
+		{"alter table t add column c int", false},
+		{"alter table t add column c varchar(10) comment 'put it first'", false},
+		{"alter table t add column (c int, d int)", false},
+		{"alter table t add index first(a)", false},
+		{"alter table t add column `after` int", false},
+		{"create table t (a int, b int)", false},
+	}
+	for _, cs := range cases {
+		c.Assert(IsPositionalColumnDDL(cs.sql), Equals, cs.expected, Commentf("sql: %s", cs.sql))
+	}
+}
+
+func (s *columnPositionSuite) TestIgnoreColumnPositions(c *C) {
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"ALTER TABLE `test`.`t` ADD COLUMN `c` INT AFTER `a`", "ALTER TABLE `test`.`t` ADD COLUMN `c` INT"},
+		{"alter table t add c int first", "alter table t add c int"},
+		{"alter table t add column c int default 1 comment 'x' AFTER b", "alter table t add column c int default 1 comment 'x'"},
+		{"alter table t modify column c bigint first", "alter table t modify column c bigint"},
+		{"alter table t change c d bigint after `a b`", "alter table t change c d bigint"},
+		{
+			"alter table t add index idx(a), add column c int after a, add column d int first",
+			"alter table t add index idx(a), add column c int, add column d int",
+		},
+		{"alter table t add column c varchar(10) comment 'put it first'", "alter table t add column c varchar(10) comment 'put it first'"},
+		{"create table t (a int, b int)", "create table t (a int, b int)"},
+	}
+	for _, cs := range cases {
+		c.Assert(IgnoreColumnPositions(cs.sql), Equals, cs.expected, Commentf("sql: %s", cs.sql))
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net"
+	"time"
+)
+
+// NewKeepAliveDialer returns the dialer of the TCP connections sending the keepalive probes every period,
+// so the idle connections aren't dropped silently by the NAT or firewalls between the peers.
+// The default period of Go, 15 seconds, is used if period is 0.
+func NewKeepAliveDialer(period time.Duration) *net.Dialer {
+	return &net.Dialer{KeepAlive: period}
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type keepAliveSuite struct{}
+
+var _ = Suite(&keepAliveSuite{})
+
+func (s *keepAliveSuite) TestNewKeepAliveDialer(c *C) {
+	c.Assert(NewKeepAliveDialer(30*time.Second).KeepAlive, Equals, 30*time.Second)
+	c.Assert(NewKeepAliveDialer(0).KeepAlive, Equals, time.Duration(0))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+	conn, err := NewKeepAliveDialer(time.Minute).Dial("tcp", l.Addr().String())
+	c.Assert(err, IsNil)
+	conn.Close()
+}
@@ -57,6 +57,108 @@ func (l *Log) Print(label string, fn func()) {
 	}
 }
 
+// the max count of distinct logs tracked by LogSampler, the expired ones are dropped beyond it
+const maxLogSampleEntries = 1024
+
+// LogSampler collapses the repetitive logs, the logs with the same message and error are printed
+// once every interval, with the count of the identical ones suppressed since the last printed one.
+// A nil *LogSampler prints every log.
+type LogSampler struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*logSampleEntry
+}
+
+type logSampleEntry struct {
+	lastTime   time.Time
+	suppressed int
+}
+
+// NewLogSampler returns a LogSampler printing the identical logs once every interval,
+// it returns nil if interval isn't positive.
+func NewLogSampler(interval time.Duration) *LogSampler {
+	if interval <= 0 {
+		return nil
+	}
+	return &LogSampler{
+		interval: interval,
+		now:      time.Now,
+		entries:  make(map[string]*logSampleEntry),
+	}
+}
+
+// Warn prints the log at warn level if it's not suppressed
+func (s *LogSampler) Warn(msg string, err error, fields ...zap.Field) {
+	s.print(log.Warn, msg, err, fields)
+}
+
+// Error prints the log at error level if it's not suppressed
+func (s *LogSampler) Error(msg string, err error, fields ...zap.Field) {
+	s.print(log.Error, msg, err, fields)
+}
+
+func (s *LogSampler) print(fn func(string, ...zap.Field), msg string, err error, fields []zap.Field) {
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	if s == nil {
+		fn(msg, fields...)
+		return
+	}
+
+	ok, suppressed := s.sample(msg, err)
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		fields = append(fields, zap.Int("suppressed", suppressed))
+	}
+	fn(msg, fields...)
+}
+
+// sample returns whether the log should be printed, and the count of the identical logs suppressed before it
+func (s *LogSampler) sample(msg string, err error) (bool, int) {
+	key := msg
+	if err != nil {
+		key += "\x00" + err.Error()
+	}
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok {
+		if now.Sub(entry.lastTime) < s.interval {
+			entry.suppressed++
+			return false, 0
+		}
+		suppressed := entry.suppressed
+		entry.lastTime = now
+		entry.suppressed = 0
+		return true, suppressed
+	}
+
+	if len(s.entries) >= maxLogSampleEntries {
+		s.dropExpired(now)
+	}
+	s.entries[key] = &logSampleEntry{lastTime: now}
+	return true, 0
+}
+
+// dropExpired must be called with s.mu held, the suppressed count of the dropped entries is lost
+func (s *LogSampler) dropExpired(now time.Time) {
+	for key, entry := range s.entries {
+		if now.Sub(entry.lastTime) >= s.interval {
+			delete(s.entries, key)
+		}
+	}
+	if len(s.entries) >= maxLogSampleEntries {
+		s.entries = make(map[string]*logSampleEntry)
+	}
+}
+
 // _globalP is the global ZapProperties in log
 var _globalP *log.ZapProperties
 
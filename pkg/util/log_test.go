@@ -14,11 +14,14 @@
 package util
 
 import (
+	"errors"
+	"fmt"
 	"path"
 	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/log"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -51,3 +54,54 @@ func (s *logSuite) TestInitLogger(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(log.GetLevel(), Equals, zapcore.ErrorLevel)
 }
+
+func (s *logSuite) TestLogSampler(c *C) {
+	sampler := NewLogSampler(time.Minute)
+	now := time.Now()
+	sampler.now = func() time.Time { return now }
+
+	var hook LogHook
+	hook.SetUp()
+	defer hook.TearDown()
+
+	err := errors.New("Error 1205: Lock wait timeout exceeded")
+	for i := 0; i < 100; i++ {
+		sampler.Error("exec failed", err, zap.Int("i", i))
+	}
+	// a different error isn't suppressed by the other one
+	sampler.Error("exec failed", errors.New("Error 1062: Duplicate entry"))
+	c.Assert(hook.Entrys, HasLen, 2)
+
+	now = now.Add(time.Minute)
+	ok, suppressed := sampler.sample("exec failed", err)
+	c.Assert(ok, IsTrue)
+	c.Assert(suppressed, Equals, 99)
+	ok, _ = sampler.sample("exec failed", err)
+	c.Assert(ok, IsFalse)
+}
+
+func (s *logSuite) TestNilLogSampler(c *C) {
+	c.Assert(NewLogSampler(0), IsNil)
+
+	var hook LogHook
+	hook.SetUp()
+	defer hook.TearDown()
+
+	var sampler *LogSampler
+	for i := 0; i < 3; i++ {
+		sampler.Error("exec failed", errors.New("error"))
+	}
+	c.Assert(hook.Entrys, HasLen, 3)
+}
+
+func (s *logSuite) TestLogSamplerBounded(c *C) {
+	sampler := NewLogSampler(time.Minute)
+	now := time.Now()
+	sampler.now = func() time.Time { return now }
+
+	for i := 0; i < maxLogSampleEntries*2; i++ {
+		ok, _ := sampler.sample("exec failed", fmt.Errorf("error %d", i))
+		c.Assert(ok, IsTrue)
+	}
+	c.Assert(len(sampler.entries), LessEqual, maxLogSampleEntries)
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+const identPattern = "(?:`[^`]*`|\\w+)(?:\\s*\\.\\s*(?:`[^`]*`|\\w+))?"
+
+var (
+	// the string literals, quoted identifiers and comments are matched as a whole to be skipped, like ttlRegexp.
+	// `ARRAY` only follows the type of `CAST(expr AS type ARRAY)`, which is a key part of a multi-valued index.
+	sqlLiteralRegexp = regexp.MustCompile(`(?s)'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|` + "`[^`]*`" + `|/\*.*?\*/`)
+	arrayCastRegexp  = regexp.MustCompile(`(?is)'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|` + "`[^`]*`" + `|/\*.*?\*/|\bARRAY\s*\)`)
+
+	indexDDLRegexp     = regexp.MustCompile(`(?is)^\s*(?:create|alter)\s+(?:table|(?:unique\s+)?index)\s`)
+	createTableRegexp  = regexp.MustCompile(`(?is)^\s*create\s+table\s`)
+	alterTableRegexp   = regexp.MustCompile(`(?is)^\s*alter\s+table\s+` + identPattern)
+	createIndexRegexp  = regexp.MustCompile(`(?is)^\s*create\s+(?:unique\s+)?index\s+(` + identPattern + `)\s+on\s+(` + identPattern + `)`)
+	indexDefRegexp     = regexp.MustCompile(`(?is)^\s*(?:unique\s+)?(?:index|key)\b`)
+	addIndexSpecRegexp = regexp.MustCompile(`(?is)^\s*add\s+(?:unique\s+)?(?:index|key)\b`)
+
+	// the name of the index following indexDefRegexp or addIndexSpecRegexp, the unnamed one is followed by `(` at once
+	indexNameRegexp     = regexp.MustCompile(`(?is)^\s*(?:add\s+)?(?:unique\s+)?(?:index|key)\s+(` + "`[^`]*`" + `|\w+)`)
+	dropIndexSpecRegexp = regexp.MustCompile(`(?is)^\s*drop\s+(?:index|key)\s+(` + "`[^`]*`" + `|\w+)\s*$`)
+	dropIndexRegexp     = regexp.MustCompile(`(?is)^\s*drop\s+index\s+(` + "`[^`]*`" + `|\w+)\s+on\s+(` + identPattern + `)\s*$`)
+)
+
+// IsMultiValuedIndexDDL returns true if the sql is a CREATE TABLE, ALTER TABLE or CREATE INDEX statement
+// with a multi-valued index on a JSON array, like `INDEX zips((CAST(j->'$.zip' AS UNSIGNED ARRAY)))`.
+// The parser we depend on can't parse the expression key parts yet, so we recognize them by the `ARRAY` cast.
+func IsMultiValuedIndexDDL(sql string) bool {
+	return indexDDLRegexp.MatchString(sql) && hasArrayCast(sql)
+}
+
+// SkipMultiValuedIndexes removes the multi-valued indexes from the DDL, for the downstream not supporting them,
+// like MySQL before 8.0.17. The index definitions of CREATE TABLE and the `ADD INDEX` specs of ALTER TABLE are
+// removed, and the ALTER TABLE or CREATE INDEX only adding multi-valued indexes becomes `ALTER TABLE t`, which
+// changes nothing. The other DDLs are returned as they're.
+func SkipMultiValuedIndexes(sql string) string {
+	if !IsMultiValuedIndexDDL(sql) {
+		return sql
+	}
+
+	if m := createIndexRegexp.FindStringSubmatch(sql); m != nil {
+		return "ALTER TABLE " + m[2]
+	}
+
+	if prefix := alterTableRegexp.FindString(sql); len(prefix) > 0 {
+		return prefix + strings.Join(removeMultiValuedIndexes(sql[len(prefix):], addIndexSpecRegexp), ",")
+	}
+
+	if createTableRegexp.MatchString(sql) {
+		open, close := tableElementsRange(sql)
+		if open < 0 || close < 0 {
+			return sql
+		}
+		return sql[:open+1] + strings.Join(removeMultiValuedIndexes(sql[open+1:close], indexDefRegexp), ",") + sql[close:]
+	}
+
+	return sql
+}
+
+// MultiValuedIndexNames returns the names of the multi-valued indexes removed from the DDL by SkipMultiValuedIndexes,
+// which are unquoted and in lower case. The unnamed indexes are not returned.
+func MultiValuedIndexNames(sql string) []string {
+	if !IsMultiValuedIndexDDL(sql) {
+		return nil
+	}
+
+	if m := createIndexRegexp.FindStringSubmatch(sql); m != nil {
+		return []string{indexName(m[1])}
+	}
+
+	var pieces []string
+	if prefix := alterTableRegexp.FindString(sql); len(prefix) > 0 {
+		pieces = splitByCommas(sql[len(prefix):])
+	} else if createTableRegexp.MatchString(sql) {
+		open, close := tableElementsRange(sql)
+		if open < 0 || close < 0 {
+			return nil
+		}
+		pieces = splitByCommas(sql[open+1 : close])
+	}
+
+	var names []string
+	for _, piece := range pieces {
+		if !hasArrayCast(piece) {
+			continue
+		}
+		if m := indexNameRegexp.FindStringSubmatch(piece); m != nil {
+			names = append(names, indexName(m[1]))
+		}
+	}
+	return names
+}
+
+// SkipDropIndexes removes the `DROP INDEX` specs of ALTER TABLE dropping the indexes which skipped returns true for,
+// like the ones removed by SkipMultiValuedIndexes before, and `DROP INDEX idx ON t` becomes `ALTER TABLE t`.
+// The names passed to skipped are unquoted and in lower case like the ones of MultiValuedIndexNames.
+func SkipDropIndexes(sql string, skipped func(name string) bool) string {
+	if m := dropIndexRegexp.FindStringSubmatch(sql); m != nil {
+		if skipped(indexName(m[1])) {
+			return "ALTER TABLE " + m[2]
+		}
+		return sql
+	}
+
+	prefix := alterTableRegexp.FindString(sql)
+	if len(prefix) == 0 {
+		return sql
+	}
+	var (
+		kept    []string
+		removed bool
+	)
+	for _, piece := range splitByCommas(sql[len(prefix):]) {
+		if m := dropIndexSpecRegexp.FindStringSubmatch(piece); m != nil && skipped(indexName(m[1])) {
+			removed = true
+			continue
+		}
+		kept = append(kept, piece)
+	}
+	if !removed {
+		return sql
+	}
+	return prefix + strings.Join(kept, ",")
+}
+
+// indexName returns the index name unquoted and in lower case, the index names are case insensitive
+func indexName(name string) string {
+	return strings.ToLower(strings.Trim(name, "`"))
+}
+
+// removeMultiValuedIndexes splits s into the table elements or alter specs, and returns the ones
+// which are not the multi-valued indexes matched by index
+func removeMultiValuedIndexes(s string, index *regexp.Regexp) []string {
+	var kept []string
+	for _, piece := range splitByCommas(s) {
+		if index.MatchString(piece) && hasArrayCast(piece) {
+			continue
+		}
+		kept = append(kept, piece)
+	}
+	return kept
+}
+
+// tableElementsRange returns the offsets of the parentheses enclosing the table elements of CREATE TABLE,
+// -1 if they're not found, like `CREATE TABLE t LIKE t1`
+func tableElementsRange(sql string) (open int, close int) {
+	open, close = -1, -1
+	depth := 0
+	scanSQL(sql, func(i int) bool {
+		switch sql[i] {
+		case '(':
+			if depth == 0 && open < 0 {
+				open = i
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && open >= 0 {
+				close = i
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+// splitByCommas splits s by the commas out of the parentheses
+func splitByCommas(s string) []string {
+	var (
+		pieces []string
+		depth  int
+		last   int
+	)
+	scanSQL(s, func(i int) bool {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				pieces = append(pieces, s[last:i])
+				last = i + 1
+			}
+		}
+		return true
+	})
+	return append(pieces, s[last:])
+}
+
+// scanSQL calls fn with the offsets of the bytes of sql out of the string literals, quoted identifiers
+// and comments in order, until fn returns false
+func scanSQL(sql string, fn func(i int) bool) {
+	skips := sqlLiteralRegexp.FindAllStringIndex(sql, -1)
+	for i := 0; i < len(sql); i++ {
+		if len(skips) > 0 && i == skips[0][0] {
+			i = skips[0][1] - 1
+			skips = skips[1:]
+			continue
+		}
+		if !fn(i) {
+			return
+		}
+	}
+}
+
+func hasArrayCast(s string) bool {
+	for _, m := range arrayCastRegexp.FindAllString(s, -1) {
+		if !strings.ContainsAny(m[:1], "'\"`/") {
+			return true
+		}
+	}
+	return false
+}
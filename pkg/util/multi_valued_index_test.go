@@ -0,0 +1,104 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type multiValuedIndexSuite struct{}
+
+var _ = Suite(&multiValuedIndexSuite{})
+
+func (s *multiValuedIndexSuite) TestIsMultiValuedIndexDDL(c *C) {
+	cases := []struct {
+		sql      string
+		expected bool
+	}{
+		{"CREATE TABLE t (id int, j json, INDEX zips((CAST(j->'$.zip' AS UNSIGNED ARRAY))))", true},
+		{"alter table t add index idx((cast(j->'$.tags' as char(64) array)))", true},
+		{"CREATE UNIQUE INDEX idx ON db.t ((CAST(j AS DECIMAL(10, 2) ARRAY)))", true},
+		{"create table t (id int primary key, j json)", false},
+		{"alter table t add index idx(a, b)", false},
+		// the string literals, quoted identifiers and comments are not key parts
+		{"create table t (`array)` int, c varchar(10) default 'ARRAY)') comment '/* array) */'", false},
+		{"create table t (id int) /* CAST(j AS UNSIGNED ARRAY) */", false},
+		// not a DDL of the indexes
+		{"select cast(j as unsigned array) from t", false},
+	}
+	for _, cs := range cases {
+		c.Assert(IsMultiValuedIndexDDL(cs.sql), Equals, cs.expected, Commentf("sql: %s", cs.sql))
+	}
+}
+
+func (s *multiValuedIndexSuite) TestSkipMultiValuedIndexes(c *C) {
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE t (id int, j json, INDEX zips((CAST(j->'$.zip' AS UNSIGNED ARRAY))), KEY k(id)) ENGINE=InnoDB",
+			"CREATE TABLE t (id int, j json, KEY k(id)) ENGINE=InnoDB"},
+		{"create table `d`.`t` (unique key idx((cast(j as char(10) array))), id int, j json, c varchar(1) default ',')",
+			"create table `d`.`t` ( id int, j json, c varchar(1) default ',')"},
+		{"alter table t add index idx((cast(j->'$.tags' as char(64) array))), add column c int",
+			"alter table t add column c int"},
+		{"ALTER TABLE `db`.`t` ADD INDEX a((CAST(j AS UNSIGNED ARRAY))), ADD UNIQUE KEY b((CAST(j->'$.b' AS DATE ARRAY)))",
+			"ALTER TABLE `db`.`t`"},
+		{"CREATE INDEX idx ON db.t ((CAST(j AS DECIMAL(10, 2) ARRAY)))", "ALTER TABLE db.t"},
+		// the other DDLs are kept as they're
+		{"create table t (id int, j json, index idx(id))", "create table t (id int, j json, index idx(id))"},
+		{"alter table t add index idx(a), add column c int", "alter table t add index idx(a), add column c int"},
+	}
+	for _, cs := range cases {
+		c.Assert(SkipMultiValuedIndexes(cs.sql), Equals, cs.expected, Commentf("sql: %s", cs.sql))
+	}
+}
+
+func (s *multiValuedIndexSuite) TestMultiValuedIndexNames(c *C) {
+	cases := []struct {
+		sql      string
+		expected []string
+	}{
+		{"CREATE TABLE t (id int, j json, INDEX Zips((CAST(j->'$.zip' AS UNSIGNED ARRAY))), KEY k(id))", []string{"zips"}},
+		{"ALTER TABLE `db`.`t` ADD INDEX `a`((CAST(j AS UNSIGNED ARRAY))), ADD UNIQUE KEY b((CAST(j->'$.b' AS DATE ARRAY))), ADD INDEX c(id)",
+			[]string{"a", "b"}},
+		{"CREATE UNIQUE INDEX idx ON db.t ((CAST(j AS DECIMAL(10, 2) ARRAY)))", []string{"idx"}},
+		// the unnamed ones
+		{"alter table t add index ((cast(j as unsigned array)))", nil},
+		{"alter table t add index idx(a)", nil},
+	}
+	for _, cs := range cases {
+		c.Assert(MultiValuedIndexNames(cs.sql), DeepEquals, cs.expected, Commentf("sql: %s", cs.sql))
+	}
+}
+
+func (s *multiValuedIndexSuite) TestSkipDropIndexes(c *C) {
+	skipped := func(name string) bool { return name == "zips" }
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"ALTER TABLE t DROP INDEX zips", "ALTER TABLE t"},
+		{"alter table `db`.`t` drop key `Zips`, drop index idx, add column c int", "alter table `db`.`t` drop index idx, add column c int"},
+		{"DROP INDEX zips ON db.t", "ALTER TABLE db.t"},
+		{"drop index `ZIPS` on `t`", "ALTER TABLE `t`"},
+		// the other DDLs are kept as they're
+		{"DROP INDEX idx ON t", "DROP INDEX idx ON t"},
+		{"ALTER TABLE t DROP INDEX idx, DROP COLUMN zips", "ALTER TABLE t DROP INDEX idx, DROP COLUMN zips"},
+		{"CREATE TABLE zips (id int)", "CREATE TABLE zips (id int)"},
+	}
+	for _, cs := range cases {
+		c.Assert(SkipDropIndexes(cs.sql, skipped), Equals, cs.expected, Commentf("sql: %s", cs.sql))
+	}
+}
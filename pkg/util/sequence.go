@@ -0,0 +1,39 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+)
+
+var (
+	sequenceDDLRegexp     = regexp.MustCompile(`(?is)^\s*(create|alter|drop)\s+sequence\s`)
+	sequenceDefaultRegexp = regexp.MustCompile(`(?is)^\s*next(val\s*\(|\s+value\s+for\s)`)
+)
+
+// IsSequenceDDL returns true if the sql is a CREATE/ALTER/DROP SEQUENCE statement,
+// the parser we depend on can't parse them yet, so we recognize them by the leading keywords.
+func IsSequenceDDL(sql string) bool {
+	return sequenceDDLRegexp.MatchString(sql)
+}
+
+// IsSequenceDefault returns true if the value is a default expression
+// taking the next value of a sequence, like `nextval(seq)` or `next value for seq`.
+func IsSequenceDefault(v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	return sequenceDefaultRegexp.MatchString(s)
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type sequenceSuite struct{}
+
+var _ = Suite(&sequenceSuite{})
+
+func (s *sequenceSuite) TestIsSequenceDDL(c *C) {
+	sqls := []string{
+		"CREATE SEQUENCE seq",
+		"create sequence if not exists test.seq start with 3 increment by 2",
+		"  ALTER SEQUENCE seq RESTART",
+		"drop sequence if exists seq",
+		"DROP\nSEQUENCE seq1, seq2",
+	}
+	for _, sql := range sqls {
+		c.Assert(IsSequenceDDL(sql), IsTrue, Commentf("sql: %s", sql))
+	}
+
+	sqls = []string{
+		"CREATE TABLE sequence(id int)",
+		"CREATE TABLE t(id int default nextval(seq))",
+		"DROP TABLE sequence",
+		"CREATE SEQUENCES",
+	}
+	for _, sql := range sqls {
+		c.Assert(IsSequenceDDL(sql), IsFalse, Commentf("sql: %s", sql))
+	}
+}
+
+func (s *sequenceSuite) TestIsSequenceDefault(c *C) {
+	c.Assert(IsSequenceDefault("nextval(`test`.`seq`)"), IsTrue)
+	c.Assert(IsSequenceDefault("NEXTVAL (seq)"), IsTrue)
+	c.Assert(IsSequenceDefault("next value for seq"), IsTrue)
+	c.Assert(IsSequenceDefault("nextval"), IsFalse)
+	c.Assert(IsSequenceDefault("0"), IsFalse)
+	c.Assert(IsSequenceDefault(1), IsFalse)
+	c.Assert(IsSequenceDefault(nil), IsFalse)
+}
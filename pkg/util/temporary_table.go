@@ -0,0 +1,36 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+)
+
+var (
+	localTemporaryTableDDLRegexp  = regexp.MustCompile(`(?is)^\s*(create|drop)\s+temporary\s+table\s`)
+	globalTemporaryTableDDLRegexp = regexp.MustCompile(`(?is)^\s*create\s+global\s+temporary\s+table\s`)
+)
+
+// IsLocalTemporaryTableDDL returns true if the sql is a CREATE/DROP TEMPORARY TABLE statement,
+// a local temporary table is only visible to the session creating it.
+func IsLocalTemporaryTableDDL(sql string) bool {
+	return localTemporaryTableDDLRegexp.MatchString(sql)
+}
+
+// IsGlobalTemporaryTableDDL returns true if the sql is a CREATE GLOBAL TEMPORARY TABLE statement,
+// the parser we depend on can't parse it yet, so we recognize it by the leading keywords.
+// The definition of a global temporary table is shared, but the data is only visible to the transaction writing it.
+func IsGlobalTemporaryTableDDL(sql string) bool {
+	return globalTemporaryTableDDLRegexp.MatchString(sql)
+}
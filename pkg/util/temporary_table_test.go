@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type temporaryTableSuite struct{}
+
+var _ = Suite(&temporaryTableSuite{})
+
+func (s *temporaryTableSuite) TestIsLocalTemporaryTableDDL(c *C) {
+	sqls := []string{
+		"CREATE TEMPORARY TABLE t(id int)",
+		"  create temporary table if not exists test.t like t1",
+		"DROP TEMPORARY TABLE t",
+		"drop\ntemporary table if exists t1, t2",
+	}
+	for _, sql := range sqls {
+		c.Assert(IsLocalTemporaryTableDDL(sql), IsTrue, Commentf("sql: %s", sql))
+		c.Assert(IsGlobalTemporaryTableDDL(sql), IsFalse, Commentf("sql: %s", sql))
+	}
+
+	sqls = []string{
+		"CREATE TABLE temporary(id int)",
+		"CREATE GLOBAL TEMPORARY TABLE t(id int) ON COMMIT DELETE ROWS",
+		"DROP TABLE temporary",
+	}
+	for _, sql := range sqls {
+		c.Assert(IsLocalTemporaryTableDDL(sql), IsFalse, Commentf("sql: %s", sql))
+	}
+}
+
+func (s *temporaryTableSuite) TestIsGlobalTemporaryTableDDL(c *C) {
+	sqls := []string{
+		"CREATE GLOBAL TEMPORARY TABLE t(id int) ON COMMIT DELETE ROWS",
+		"create global\ttemporary table if not exists test.t(id int primary key) on commit delete rows",
+	}
+	for _, sql := range sqls {
+		c.Assert(IsGlobalTemporaryTableDDL(sql), IsTrue, Commentf("sql: %s", sql))
+	}
+
+	sqls = []string{
+		"CREATE TABLE global(id int)",
+		"CREATE TEMPORARY TABLE t(id int)",
+		"DROP TABLE t",
+	}
+	for _, sql := range sqls {
+		c.Assert(IsGlobalTemporaryTableDDL(sql), IsFalse, Commentf("sql: %s", sql))
+	}
+}
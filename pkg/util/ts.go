@@ -55,6 +55,38 @@ func GetTSO(pdCli pd.Client) (int64, error) {
 	return ts, nil
 }
 
+// ExtractPhysicalLogical splits ts into the physical part in milliseconds and the logical part
+func ExtractPhysicalLogical(ts int64) (physical, logical int64) {
+	u := uint64(ts)
+	return int64(u >> physicalShiftBits), int64(u & (1<<physicalShiftBits - 1))
+}
+
+// ComparePositions compares the replication positions a and b, like the checkpoints or the TSO of pumps,
+// it returns -1 if a is before b, 0 if they're the same position, or 1 if a is after b.
+func ComparePositions(a, b int64) int {
+	pa, la := ExtractPhysicalLogical(a)
+	pb, lb := ExtractPhysicalLogical(b)
+	switch {
+	case pa < pb:
+		return -1
+	case pa > pb:
+		return 1
+	case la < lb:
+		return -1
+	case la > lb:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// TimeToTSO returns the smallest TSO allocated at or after t,
+// it's the TSO with the physical part of t rounded up to milliseconds and the logical part 0.
+func TimeToTSO(t time.Time) int64 {
+	physical := (t.UnixNano() + int64(time.Millisecond) - 1) / int64(time.Millisecond)
+	return int64(oracle.ComposeTS(physical, 0))
+}
+
 // TSOToRoughTime translates tso to rough time that used to display
 func TSOToRoughTime(ts int64) time.Time {
 	t := time.Unix(ts>>18/1000, 0)
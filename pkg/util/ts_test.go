@@ -59,3 +59,41 @@ func (s *tsSuite) TestTSOToRoughTime(c *C) {
 	expectT := time.Date(2019, 4, 26, 15, 10, 38, 0, time.Local)
 	c.Assert(t, Equals, expectT)
 }
+
+func (s *tsSuite) TestTimeToTSO(c *C) {
+	t := time.Date(2019, 4, 26, 7, 10, 38, 846000000, time.UTC)
+	c.Assert(TimeToTSO(t), Equals, int64(407964913197645824))
+	// the TSO allocated in the same millisecond before t is excluded
+	c.Assert(TimeToTSO(t.Add(time.Microsecond)), Equals, int64(1556262638847<<physicalShiftBits))
+
+	physical, logical := ExtractPhysicalLogical(TimeToTSO(t.In(time.FixedZone("CST", 8*3600))))
+	c.Assert(physical, Equals, int64(1556262638846))
+	c.Assert(logical, Equals, int64(0))
+}
+
+func (s *tsSuite) TestExtractPhysicalLogical(c *C) {
+	physical, logical := ExtractPhysicalLogical(407964913197645824)
+	c.Assert(physical, Equals, int64(1556262638846))
+	c.Assert(logical, Equals, int64(0))
+
+	physical, logical = ExtractPhysicalLogical(1556262638846<<physicalShiftBits + 262143)
+	c.Assert(physical, Equals, int64(1556262638846))
+	c.Assert(logical, Equals, int64(262143))
+
+	physical, logical = ExtractPhysicalLogical(0)
+	c.Assert(physical, Equals, int64(0))
+	c.Assert(logical, Equals, int64(0))
+}
+
+func (s *tsSuite) TestComparePositions(c *C) {
+	ts := int64(1556262638846<<physicalShiftBits + 10)
+	c.Assert(ComparePositions(ts, ts), Equals, 0)
+	// the same physical time
+	c.Assert(ComparePositions(ts, ts+1), Equals, -1)
+	c.Assert(ComparePositions(ts+1, ts), Equals, 1)
+	// the physical time takes precedence over the logical part
+	later := int64(1556262638847 << physicalShiftBits)
+	c.Assert(ComparePositions(ts, later), Equals, -1)
+	c.Assert(ComparePositions(later, ts), Equals, 1)
+	c.Assert(ComparePositions(0, ts), Equals, -1)
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	ttlComment = "/*T![ttl] "
+
+	disabledTTLEnable = "TTL_ENABLE='OFF'"
+)
+
+var (
+	// the string literals, quoted identifiers and comments are matched as a whole to be kept as is, like autoRandomRegexp.
+	// the TTL attributes are `TTL = col + INTERVAL n UNIT`, `TTL_ENABLE = 'ON'`, `TTL_JOB_INTERVAL = '1h'` and `REMOVE TTL`.
+	ttlRegexp = regexp.MustCompile(`(?is)'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|` + "`[^`]*`" + `|/\*.*?\*/|` +
+		`\bTTL\s*=?\s*(?:` + "`[^`]*`" + `|\w+)\s*\+\s*INTERVAL\s+(?:'[^']*'|[\d.]+)\s+\w+` +
+		`|\bTTL_(?:ENABLE|JOB_INTERVAL)\s*=?\s*'[^']*'|\bREMOVE\s+TTL\b`)
+	ttlEnableRegexp = regexp.MustCompile(`(?i)\bTTL_ENABLE\s*=?\s*'[^']*'`)
+	ttlExprRegexp   = regexp.MustCompile(`(?i)^/\*T!\[ttl\]\s*,?\s*TTL\b`)
+)
+
+// CommentTTL wraps the TTL attributes of the DDL in TiDB's executable comment, like
+// "/*T![ttl] TTL=`created_at` + INTERVAL 1 DAY */", which is what TiDB shows in `SHOW CREATE TABLE`.
+// So the TiDB supporting TTL still executes them, while MySQL, the TiDB not supporting TTL and the parser
+// we depend on treat them as comments and create or alter the table as a normal one.
+// The comma separating an attribute from the other table options or alter specs is commented with it,
+// so the rest is still valid without it.
+func CommentTTL(sql string) string {
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, loc := range ttlRegexp.FindAllStringIndex(sql, -1) {
+		start, end := loc[0], loc[1]
+		if !isTTLAttr(sql[start:end]) {
+			continue
+		}
+		sep := ""
+		if i := strings.LastIndexFunc(sql[last:start], isNotSpace); i >= 0 && sql[last+i] == ',' {
+			start = last + i
+			sep = " "
+		} else if rest := strings.TrimLeftFunc(sql[end:], unicode.IsSpace); strings.HasPrefix(rest, ",") {
+			end = len(sql) - len(rest) + 1
+		}
+		b.WriteString(sql[last:start])
+		b.WriteString(sep + ttlComment + sql[start:end] + " */")
+		last = end
+	}
+	b.WriteString(sql[last:])
+	return b.String()
+}
+
+// DisableTTLJob sets TTL_ENABLE of the DDL commented by CommentTTL to 'OFF', and adds it if the DDL sets TTL
+// without it, so the TTL jobs don't run in downstream. The expired rows are deleted by the TTL jobs of upstream,
+// and the deletes are replicated, the TTL jobs of downstream would delete them earlier or later than upstream.
+func DisableTTLJob(sql string) string {
+	var (
+		comments  [][]int
+		hasEnable bool
+		ttlEnd    = -1
+	)
+	for _, loc := range ttlRegexp.FindAllStringIndex(sql, -1) {
+		comment := sql[loc[0]:loc[1]]
+		if !strings.HasPrefix(comment, ttlComment) {
+			continue
+		}
+		comments = append(comments, loc)
+		if ttlEnableRegexp.MatchString(comment) {
+			hasEnable = true
+		} else if ttlExprRegexp.MatchString(comment) {
+			ttlEnd = loc[1]
+		}
+	}
+	if len(comments) == 0 {
+		return sql
+	}
+
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, loc := range comments {
+		b.WriteString(sql[last:loc[0]])
+		b.WriteString(ttlEnableRegexp.ReplaceAllLiteralString(sql[loc[0]:loc[1]], disabledTTLEnable))
+		if !hasEnable && loc[1] == ttlEnd {
+			b.WriteString(" " + ttlComment + disabledTTLEnable + " */")
+		}
+		last = loc[1]
+	}
+	b.WriteString(sql[last:])
+	return b.String()
+}
+
+// isTTLAttr returns false for the string literals, quoted identifiers and comments matched by ttlRegexp
+func isTTLAttr(s string) bool {
+	switch s[0] {
+	case '\'', '"', '`', '/':
+		return false
+	default:
+		return true
+	}
+}
+
+func isNotSpace(r rune) bool {
+	return !unicode.IsSpace(r)
+}
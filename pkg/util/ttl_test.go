@@ -0,0 +1,72 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type ttlSuite struct{}
+
+var _ = Suite(&ttlSuite{})
+
+func (s *ttlSuite) TestCommentTTL(c *C) {
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"create table t(id int primary key, ttl datetime)", "create table t(id int primary key, ttl datetime)"},
+		{"create table t(created_at datetime) TTL = `created_at` + INTERVAL 1 DAY",
+			"create table t(created_at datetime) /*T![ttl] TTL = `created_at` + INTERVAL 1 DAY */"},
+		{"CREATE TABLE t(c datetime) TTL=c + interval '90' minute TTL_ENABLE='OFF' TTL_JOB_INTERVAL='1h'",
+			"CREATE TABLE t(c datetime) /*T![ttl] TTL=c + interval '90' minute */ /*T![ttl] TTL_ENABLE='OFF' */ /*T![ttl] TTL_JOB_INTERVAL='1h' */"},
+		// the commas are commented with the attributes
+		{"create table t(c datetime) engine = InnoDB, TTL = c + INTERVAL 1 DAY, TTL_ENABLE = 'ON'",
+			"create table t(c datetime) engine = InnoDB /*T![ttl] , TTL = c + INTERVAL 1 DAY */ /*T![ttl] , TTL_ENABLE = 'ON' */"},
+		{"create table t(c datetime) TTL = c + INTERVAL 1 DAY, comment = 'ttl table'",
+			"create table t(c datetime) /*T![ttl] TTL = c + INTERVAL 1 DAY, */ comment = 'ttl table'"},
+		{"alter table t add column d int, ttl_enable = 'OFF'", "alter table t add column d int /*T![ttl] , ttl_enable = 'OFF' */"},
+		{"ALTER TABLE t REMOVE TTL", "ALTER TABLE t /*T![ttl] REMOVE TTL */"},
+		// already commented
+		{"create table t(c datetime) /*T![ttl] TTL=`c` + INTERVAL 1 DAY */", "create table t(c datetime) /*T![ttl] TTL=`c` + INTERVAL 1 DAY */"},
+		// the string literals, quoted identifiers and comments are kept as is
+		{"create table t(`ttl_enable` varchar(3) default 'TTL_ENABLE=''ON''') comment \"REMOVE TTL\"",
+			"create table t(`ttl_enable` varchar(3) default 'TTL_ENABLE=''ON''') comment \"REMOVE TTL\""},
+	}
+	for _, cs := range cases {
+		c.Assert(CommentTTL(cs.sql), Equals, cs.expected)
+	}
+}
+
+func (s *ttlSuite) TestDisableTTLJob(c *C) {
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"create table t(c datetime)", "create table t(c datetime)"},
+		{"create table t(c datetime) TTL = c + INTERVAL 1 DAY",
+			"create table t(c datetime) /*T![ttl] TTL = c + INTERVAL 1 DAY */ /*T![ttl] TTL_ENABLE='OFF' */"},
+		{"create table t(c datetime) TTL = c + INTERVAL 1 DAY, TTL_ENABLE = 'ON'",
+			"create table t(c datetime) /*T![ttl] TTL = c + INTERVAL 1 DAY, */ /*T![ttl] TTL_ENABLE='OFF' */"},
+		{"alter table t TTL_ENABLE 'ON'", "alter table t /*T![ttl] TTL_ENABLE='OFF' */"},
+		{"alter table t TTL_JOB_INTERVAL = '1h'", "alter table t /*T![ttl] TTL_JOB_INTERVAL = '1h' */"},
+		{"alter table t remove ttl", "alter table t /*T![ttl] remove ttl */"},
+		// the other comments are kept as is
+		{"create table t(c datetime comment 'TTL_ENABLE=''ON''') /* TTL_ENABLE='ON' */",
+			"create table t(c datetime comment 'TTL_ENABLE=''ON''') /* TTL_ENABLE='ON' */"},
+	}
+	for _, cs := range cases {
+		c.Assert(DisableTTLJob(CommentTTL(cs.sql)), Equals, cs.expected)
+	}
+}
@@ -16,7 +16,9 @@ package util
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
 	"strings"
 	"time"
 
@@ -290,6 +292,33 @@ func AdjustDuration(v *time.Duration, defValue time.Duration) {
 	}
 }
 
+// ResolvePassword returns the password read from file if file is not empty, or the value of the
+// environment variable env if it's set, or password otherwise.
+// The trailing line breaks of the file are trimmed.
+func ResolvePassword(password, file, env string) (string, error) {
+	if len(file) > 0 {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", errors.Annotatef(err, "read password file %s failed", file)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if len(env) > 0 {
+		if value, ok := os.LookupEnv(env); ok {
+			return value, nil
+		}
+	}
+	return password, nil
+}
+
+// RedactPassword returns the mask of the password to log it in the configs, the empty one is kept to show it's not set
+func RedactPassword(password string) string {
+	if len(password) == 0 {
+		return ""
+	}
+	return "******"
+}
+
 // WaitUntilTimeout creates a goroutine to run fn, and then gives up waiting for the goroutine to exit When it timeouts
 func WaitUntilTimeout(name string, fn func(), timeout time.Duration) {
 	fName := zap.String("name", name)
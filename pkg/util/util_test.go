@@ -16,7 +16,10 @@ package util
 import (
 	"context"
 	"errors"
+	"io/ioutil"
 	"net"
+	"os"
+	"path"
 	"testing"
 	"time"
 
@@ -340,3 +343,34 @@ func (s *waitUntilTimeoutSuit) TestGoAndAbortGoroutine(c *C) {
 	}, time.Second)
 	c.Assert(called, IsTrue)
 }
+
+type passwordSuite struct{}
+
+var _ = Suite(&passwordSuite{})
+
+func (s *passwordSuite) TestResolvePassword(c *C) {
+	file := path.Join(c.MkDir(), "password")
+	c.Assert(ioutil.WriteFile(file, []byte("from-file\n"), 0600), IsNil)
+	c.Assert(os.Setenv("TEST_RESOLVE_PASSWORD", "from-env"), IsNil)
+	defer os.Unsetenv("TEST_RESOLVE_PASSWORD")
+
+	// the file takes precedence over the environment variable and the inline password
+	password, err := ResolvePassword("inline", file, "TEST_RESOLVE_PASSWORD")
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "from-file")
+
+	password, err = ResolvePassword("inline", "", "TEST_RESOLVE_PASSWORD")
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "from-env")
+
+	// the inline password is used if the environment variable isn't set
+	password, err = ResolvePassword("inline", "", "TEST_RESOLVE_PASSWORD_NOT_SET")
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "inline")
+	password, err = ResolvePassword("inline", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "inline")
+
+	_, err = ResolvePassword("inline", file+".not-exist", "")
+	c.Assert(err, ErrorMatches, ".*read password file.*")
+}
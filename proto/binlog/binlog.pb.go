@@ -90,17 +90,23 @@ func (EventType) EnumDescriptor() ([]byte, []int) { return fileDescriptorBinlog,
 type BinlogType int32
 
 const (
-	BinlogType_DML BinlogType = 0
-	BinlogType_DDL BinlogType = 1
+	BinlogType_DML    BinlogType = 0
+	BinlogType_DDL    BinlogType = 1
+	BinlogType_BEGIN  BinlogType = 2
+	BinlogType_COMMIT BinlogType = 3
 )
 
 var BinlogType_name = map[int32]string{
 	0: "DML",
 	1: "DDL",
+	2: "BEGIN",
+	3: "COMMIT",
 }
 var BinlogType_value = map[string]int32{
-	"DML": 0,
-	"DDL": 1,
+	"DML":    0,
+	"DDL":    1,
+	"BEGIN":  2,
+	"COMMIT": 3,
 }
 
 func (x BinlogType) Enum() *BinlogType {
@@ -1279,32 +1285,33 @@ var (
 func init() { proto.RegisterFile("binlog.proto", fileDescriptorBinlog) }
 
 var fileDescriptorBinlog = []byte{
-	// 431 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x5c, 0x91, 0xcf, 0x6a, 0x1b, 0x31,
-	0x10, 0xc6, 0xad, 0x5d, 0xff, 0xdb, 0xb1, 0x1b, 0x84, 0x70, 0x61, 0x69, 0xe9, 0xc6, 0x75, 0x2e,
-	0xc6, 0xa5, 0x0e, 0xf8, 0xd6, 0xab, 0xd9, 0x1e, 0x0a, 0x4e, 0xa1, 0x4b, 0xda, 0xeb, 0x22, 0x5b,
-	0xc2, 0x09, 0x48, 0xab, 0x8d, 0x57, 0x4e, 0xd9, 0x07, 0xe8, 0x0b, 0xf4, 0xd4, 0x07, 0xe8, 0xc3,
-	0xe4, 0xd8, 0x27, 0x28, 0xc5, 0x7d, 0x91, 0xa0, 0xd1, 0x92, 0x18, 0xdf, 0x3e, 0x7d, 0xdf, 0xcc,
-	0xf0, 0x9b, 0x11, 0x0c, 0xd7, 0xb7, 0x85, 0x32, 0xdb, 0x79, 0xb9, 0x33, 0xd6, 0xb0, 0xa8, 0x5c,
-	0xe7, 0xde, 0x78, 0x35, 0xda, 0x9a, 0xad, 0x41, 0xf7, 0xd2, 0x29, 0x5f, 0x30, 0xf9, 0x49, 0xa0,
-	0xbb, 0x31, 0x6a, 0xaf, 0x0b, 0x16, 0x43, 0xbb, 0xe0, 0x5a, 0xc6, 0x64, 0x4c, 0xa6, 0xd1, 0xb2,
-	0xfd, 0xf0, 0xf7, 0xbc, 0x95, 0xa1, 0xc3, 0xce, 0x20, 0xb0, 0x65, 0x1c, 0x8c, 0xc9, 0x74, 0x98,
-	0x05, 0xb6, 0x64, 0x17, 0x00, 0xba, 0xae, 0xee, 0x54, 0x6e, 0xeb, 0x52, 0xc6, 0xe1, 0x51, 0x7d,
-	0x84, 0xfe, 0x75, 0x5d, 0x4a, 0x36, 0x82, 0xce, 0x3d, 0x57, 0x7b, 0x19, 0xb7, 0xb1, 0xcf, 0x3f,
-	0xd8, 0x05, 0xbc, 0xd8, 0xdc, 0xf0, 0x62, 0x2b, 0x45, 0xee, 0xd3, 0x0e, 0xa6, 0xc3, 0xc6, 0xfc,
-	0xe6, 0xbc, 0xc9, 0x0f, 0x02, 0x9d, 0x8f, 0xf7, 0xb2, 0xb0, 0xec, 0x1c, 0x06, 0xd5, 0xe6, 0x46,
-	0x6a, 0x9e, 0x3f, 0xa3, 0x65, 0xe0, 0xad, 0xcf, 0x0e, 0xed, 0x0d, 0x80, 0xe5, 0x6b, 0x25, 0x7d,
-	0x1e, 0x60, 0x1e, 0xa1, 0x83, 0xf1, 0x0c, 0xc9, 0x1d, 0xe1, 0xd9, 0x62, 0x34, 0x7f, 0x3a, 0xc6,
-	0x1c, 0xa7, 0x3b, 0xcc, 0x86, 0xdb, 0x6d, 0x45, 0x21, 0xdc, 0x99, 0xef, 0x71, 0x7b, 0x1c, 0x4e,
-	0x87, 0x99, 0x93, 0x93, 0x0f, 0xd0, 0x4b, 0xaf, 0x56, 0x29, 0xb7, 0x9c, 0xcd, 0xa1, 0x2b, 0x5d,
-	0x4f, 0x15, 0x93, 0x71, 0x38, 0x1d, 0x2c, 0xe8, 0xe9, 0xb0, 0x66, 0x50, 0x53, 0x35, 0xf9, 0x4d,
-	0xa0, 0xbb, 0xc4, 0x98, 0xbd, 0x43, 0x06, 0x82, 0x0c, 0x2f, 0x8f, 0xda, 0x7c, 0x7c, 0x02, 0xf1,
-	0x16, 0xa2, 0x8d, 0xd1, 0xfa, 0xd6, 0xe6, 0xb6, 0xc2, 0x75, 0xc2, 0x26, 0xec, 0x7b, 0xfb, 0xba,
-	0x62, 0xef, 0xa1, 0x2f, 0xb4, 0xca, 0x05, 0xb7, 0x1c, 0x37, 0x1b, 0x2c, 0xd8, 0xd1, 0xd4, 0x06,
-	0x38, 0xeb, 0x09, 0xad, 0x90, 0xfc, 0x35, 0x44, 0x42, 0xa8, 0xfc, 0x6e, 0x2f, 0x77, 0x75, 0xf3,
-	0x17, 0x7d, 0x21, 0xd4, 0x17, 0xf7, 0x9e, 0x5d, 0x42, 0xf4, 0x74, 0x0a, 0x06, 0xd0, 0xfd, 0x54,
-	0x54, 0x72, 0x67, 0x69, 0xcb, 0xe9, 0xaf, 0xa5, 0xe0, 0x56, 0x52, 0xe2, 0x74, 0x2a, 0x95, 0xb4,
-	0x92, 0x06, 0xb3, 0x04, 0xe0, 0x99, 0x9b, 0xf5, 0x20, 0x4c, 0xaf, 0x56, 0xb4, 0x85, 0x22, 0x5d,
-	0x51, 0xb2, 0xa4, 0x0f, 0x87, 0x84, 0xfc, 0x39, 0x24, 0xe4, 0xdf, 0x21, 0x21, 0xbf, 0xfe, 0x27,
-	0xad, 0xc7, 0x00, 0x00, 0x00, 0xff, 0xff, 0xdd, 0x35, 0x13, 0x38, 0x91, 0x02, 0x00, 0x00,
+	// 447 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x5c, 0x91, 0xcf, 0x8a, 0x13, 0x41,
+	0x10, 0xc6, 0xd3, 0x33, 0xf9, 0x37, 0x95, 0xb8, 0x34, 0x4d, 0x84, 0x41, 0x31, 0x1b, 0xb3, 0x97,
+	0x10, 0x31, 0x0b, 0x01, 0x0f, 0x5e, 0xe3, 0x2c, 0x12, 0x48, 0x56, 0x1c, 0xa2, 0xd7, 0xa1, 0x93,
+	0x6e, 0xb2, 0x0b, 0x3d, 0xd3, 0xb3, 0x99, 0xce, 0xca, 0x3c, 0x80, 0x2f, 0xe0, 0xc9, 0x07, 0xf0,
+	0x61, 0xf6, 0xe8, 0x13, 0x88, 0xc4, 0x17, 0x91, 0xae, 0x1e, 0x76, 0x43, 0x6e, 0x5f, 0x7f, 0x5f,
+	0x55, 0xf1, 0xab, 0x6a, 0xe8, 0xae, 0x6f, 0x33, 0xa5, 0xb7, 0x93, 0x7c, 0xa7, 0x8d, 0x66, 0x41,
+	0xbe, 0x4e, 0x9c, 0xf1, 0xa2, 0xb7, 0xd5, 0x5b, 0x8d, 0xee, 0xa5, 0x55, 0xae, 0x60, 0xf8, 0x83,
+	0x40, 0x73, 0xa3, 0xd5, 0x3e, 0xcd, 0x58, 0x08, 0xf5, 0x8c, 0xa7, 0x32, 0x24, 0x03, 0x32, 0x0a,
+	0x66, 0xf5, 0x87, 0x3f, 0xe7, 0xb5, 0x18, 0x1d, 0x76, 0x06, 0x9e, 0xc9, 0x43, 0x6f, 0x40, 0x46,
+	0xdd, 0xd8, 0x33, 0x39, 0xbb, 0x00, 0x48, 0xcb, 0xe2, 0x4e, 0x25, 0xa6, 0xcc, 0x65, 0xe8, 0x1f,
+	0xd5, 0x07, 0xe8, 0xaf, 0xca, 0x5c, 0xb2, 0x1e, 0x34, 0xee, 0xb9, 0xda, 0xcb, 0xb0, 0x8e, 0x7d,
+	0xee, 0xc1, 0x2e, 0xe0, 0xd9, 0xe6, 0x86, 0x67, 0x5b, 0x29, 0x12, 0x97, 0x36, 0x30, 0xed, 0x56,
+	0xe6, 0x57, 0xeb, 0x0d, 0xbf, 0x13, 0x68, 0x5c, 0xdd, 0xcb, 0xcc, 0xb0, 0x73, 0xe8, 0x14, 0x9b,
+	0x1b, 0x99, 0xf2, 0xe4, 0x09, 0x2d, 0x06, 0x67, 0x5d, 0x5b, 0xb4, 0x57, 0x00, 0x86, 0xaf, 0x95,
+	0x74, 0xb9, 0x87, 0x79, 0x80, 0x0e, 0xc6, 0x63, 0x24, 0xb7, 0x84, 0x67, 0xd3, 0xde, 0xe4, 0xf1,
+	0x18, 0x13, 0x9c, 0x6e, 0x31, 0x2b, 0x6e, 0xbb, 0x15, 0x05, 0x7f, 0xa7, 0xbf, 0x85, 0xf5, 0x81,
+	0x3f, 0xea, 0xc6, 0x56, 0x0e, 0xdf, 0x43, 0x2b, 0x5a, 0x2e, 0x22, 0x6e, 0x38, 0x9b, 0x40, 0x53,
+	0xda, 0x9e, 0x22, 0x24, 0x03, 0x7f, 0xd4, 0x99, 0xd2, 0xd3, 0x61, 0xd5, 0xa0, 0xaa, 0x6a, 0xf8,
+	0x8b, 0x40, 0x73, 0x86, 0x31, 0x7b, 0x83, 0x0c, 0x04, 0x19, 0x9e, 0x1f, 0xb5, 0xb9, 0xf8, 0x04,
+	0xe2, 0x35, 0x04, 0x1b, 0x9d, 0xa6, 0xb7, 0x26, 0x31, 0x05, 0xae, 0xe3, 0x57, 0x61, 0xdb, 0xd9,
+	0xab, 0x82, 0xbd, 0x85, 0xb6, 0x48, 0x55, 0x22, 0xb8, 0xe1, 0xb8, 0x59, 0x67, 0xca, 0x8e, 0xa6,
+	0x56, 0xc0, 0x71, 0x4b, 0xa4, 0x0a, 0xc9, 0x5f, 0x42, 0x20, 0x84, 0x4a, 0xee, 0xf6, 0x72, 0x57,
+	0x56, 0x7f, 0xd1, 0x16, 0x42, 0x7d, 0xb6, 0xef, 0xf1, 0x25, 0x04, 0x8f, 0xa7, 0x60, 0x00, 0xcd,
+	0x79, 0x56, 0xc8, 0x9d, 0xa1, 0x35, 0xab, 0xbf, 0xe4, 0x82, 0x1b, 0x49, 0x89, 0xd5, 0x91, 0x54,
+	0xd2, 0x48, 0xea, 0x8d, 0xdf, 0x01, 0x3c, 0x71, 0xb3, 0x16, 0xf8, 0xd1, 0x72, 0x41, 0x6b, 0x28,
+	0xa2, 0x05, 0x25, 0x2c, 0x80, 0xc6, 0xec, 0xea, 0xe3, 0xfc, 0x9a, 0x7a, 0xb6, 0xed, 0xc3, 0xa7,
+	0xe5, 0x72, 0xbe, 0xa2, 0xfe, 0x8c, 0x3e, 0x1c, 0xfa, 0xe4, 0xf7, 0xa1, 0x4f, 0xfe, 0x1e, 0xfa,
+	0xe4, 0xe7, 0xbf, 0x7e, 0xed, 0xff, 0x00, 0x18, 0x40, 0xfe, 0xce, 0xa8, 0x02, 0x00, 0x00,
 }
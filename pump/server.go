@@ -158,6 +158,7 @@ func NewServer(cfg *Config) (*Server, error) {
 	options = options.WithKVChanCapacity(cfg.Storage.GetKVChanCapacity())
 	options = options.WithSlowWriteThreshold(cfg.Storage.GetSlowWriteThreshold())
 	options = options.WithStopWriteAtAvailableSpace(cfg.Storage.GetStopWriteAtAvailableSpace())
+	options = options.WithVerifyChecksum(cfg.Storage.GetVerifyChecksum())
 
 	storage, err := storage.NewAppendWithResolver(cfg.DataDir, options, tiStore, lockResolver)
 	if err != nil {
@@ -412,6 +413,7 @@ func (s *Server) Start() error {
 	router.HandleFunc("/drainers", s.AllDrainers).Methods("GET")
 	router.HandleFunc("/debug/binlog/{ts}", s.BinlogByTS).Methods("GET")
 	router.HandleFunc("/debug/gc/trigger", s.TriggerGC).Methods("POST")
+	router.HandleFunc("/backlog/{startTS}/{endTS}", s.Backlog).Methods("GET")
 	http.Handle("/", router)
 	prometheus.DefaultGatherer = registry
 	http.Handle("/metrics", promhttp.Handler())
@@ -691,6 +693,33 @@ func (s *Server) TriggerGC(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Backlog exposes the estimated binlogs committed after startTS up to endTS in JSON,
+// endTS 0 means up to the max commit ts.
+func (s *Server) Backlog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	startTS, err := strconv.ParseInt(vars["startTS"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid parameter startTS: %s", vars["startTS"]), http.StatusBadRequest)
+		return
+	}
+	endTS, err := strconv.ParseInt(vars["endTS"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid parameter endTS: %s", vars["endTS"]), http.StatusBadRequest)
+		return
+	}
+
+	backlog, err := s.storage.EstimateBacklog(startTS, endTS)
+	if err != nil {
+		log.Error("estimate backlog failed", zap.Int64("start ts", startTS), zap.Int64("end ts", endTS), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(backlog); err != nil {
+		log.Error("Failed to encode backlog", zap.Error(err), zap.Any("backlog", backlog))
+	}
+}
+
 // BinlogByTS exposes api get get binlog by ts
 func (s *Server) BinlogByTS(w http.ResponseWriter, r *http.Request) {
 	tsStr := mux.Vars(r)["ts"]
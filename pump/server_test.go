@@ -21,18 +21,21 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"path"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	. "github.com/pingcap/check"
 	pd "github.com/pingcap/pd/client"
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb-binlog/pump/storage"
 	"github.com/pingcap/tidb/config"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv"
@@ -137,6 +140,9 @@ func (s *noOpStorage) GetGCTS() int64                              { return 0 }
 func (s *noOpStorage) GC(ts int64)                                 {}
 func (s *noOpStorage) MaxCommitTS() int64                          { return 0 }
 func (s *noOpStorage) GetBinlog(ts int64) (*binlog.Binlog, error)  { return nil, nil }
+func (s *noOpStorage) EstimateBacklog(startTS, endTS int64) (*storage.Backlog, error) {
+	return new(storage.Backlog), nil
+}
 func (s *noOpStorage) PullCommitBinlog(ctx context.Context, last int64) <-chan []byte {
 	return make(chan []byte)
 }
@@ -686,6 +692,9 @@ func (s *startStorage) MaxCommitTS() int64                          { return 0 }
 func (s *startStorage) GetBinlog(ts int64) (*binlog.Binlog, error) {
 	return nil, errors.New("server_test")
 }
+func (s *startStorage) EstimateBacklog(startTS, endTS int64) (*storage.Backlog, error) {
+	return nil, errors.New("server_test")
+}
 func (s *startStorage) PullCommitBinlog(ctx context.Context, last int64) <-chan []byte {
 	return make(chan []byte)
 }
@@ -851,3 +860,48 @@ func httpRequest(c *C, method, url string) string {
 	bodyStr := string(bodyByte)
 	return bodyStr
 }
+
+type backlogStorage struct {
+	noOpStorage
+	startTS int64
+	endTS   int64
+}
+
+func (s *backlogStorage) EstimateBacklog(startTS, endTS int64) (*storage.Backlog, error) {
+	if startTS > endTS && endTS > 0 {
+		return nil, errors.New("invalid range")
+	}
+	s.startTS, s.endTS = startTS, endTS
+	return &storage.Backlog{Binlogs: 20, Txns: 10, Bytes: 4096}, nil
+}
+
+type backlogSuite struct{}
+
+var _ = Suite(&backlogSuite{})
+
+func (s *backlogSuite) TestBacklog(c *C) {
+	st := new(backlogStorage)
+	server := &Server{storage: st}
+	router := mux.NewRouter()
+	router.HandleFunc("/backlog/{startTS}/{endTS}", server.Backlog).Methods("GET")
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	w := get("/backlog/100/0")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var backlog storage.Backlog
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &backlog), IsNil)
+	c.Assert(backlog, DeepEquals, storage.Backlog{Binlogs: 20, Txns: 10, Bytes: 4096})
+	c.Assert(st.startTS, Equals, int64(100))
+	c.Assert(st.endTS, Equals, int64(0))
+
+	w = get("/backlog/abc/0")
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(w.Body.String(), Matches, "invalid parameter startTS: abc\n")
+	w = get("/backlog/200/100")
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(w.Body.String(), Matches, "invalid range\n")
+}
@@ -276,8 +276,25 @@ func (lf *logFile) recover() error {
 	return errors.Trace(err)
 }
 
-// thread-safe to read record at specify offset
-func (lf *logFile) readRecord(offset int64) (record *Record, err error) {
+// readRecordSize returns the size of the record at offset including the header, the payload isn't read.
+func (lf *logFile) readRecordSize(offset int64) (int64, error) {
+	header := make([]byte, headerLength)
+	if _, err := lf.fd.ReadAt(header, offset); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	record := new(Record)
+	if err := record.readHeader(bytes.NewReader(header)); err != nil {
+		return 0, errors.Trace(err)
+	}
+	if record.magic != recordMagic {
+		return 0, ErrWrongMagic
+	}
+	return headerLength + int64(record.length), nil
+}
+
+// readRecord reads the record at offset thread-safely, the checksum of the payload is verified if verifyChecksum is true.
+func (lf *logFile) readRecord(offset int64, verifyChecksum bool) (record *Record, err error) {
 	header := make([]byte, headerLength)
 	_, err = lf.fd.ReadAt(header, offset)
 	if err != nil {
@@ -308,8 +325,9 @@ func (lf *logFile) readRecord(offset int64) (record *Record, err error) {
 		return
 	}
 
-	if !record.isValid() {
-		err = errors.New("checksum mismatch")
+	if verifyChecksum && !record.isValid() {
+		err = errors.Errorf("checksum mismatch of the record at offset %d in %s, expected crc32 %d but got %d",
+			offset-headerLength, lf.path, record.checksum, crc32.Checksum(record.payload, crcTable))
 		return
 	}
 
@@ -431,3 +449,53 @@ func (lf *logFile) scan(startOffset int64, fn func(vp valuePointer, record *Reco
 
 	return nil
 }
+
+// ReadLogFile reads the binlogs in the log file at path in order, the file is opened as read only,
+// so it's safe to inspect a log file that's still used by pump.
+func ReadLogFile(path string, fn func(binlog *pb.Binlog) error) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return errors.Annotatef(err, "stat file %s failed", path)
+	}
+
+	size := info.Size()
+	if size >= fileFooterLength {
+		magic := make([]byte, 4)
+		_, err = fd.ReadAt(magic, size-4)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if binary.LittleEndian.Uint32(magic) == fileEndMagic {
+			size -= fileFooterLength
+		}
+	}
+
+	var offset int64
+	reader := bufio.NewReader(io.NewSectionReader(fd, 0, size))
+	for offset < size {
+		r, err := readRecord(reader)
+		if err != nil {
+			return errors.Annotatef(err, "read record at offset %d failed", offset)
+		}
+
+		binlog := new(pb.Binlog)
+		err = binlog.Unmarshal(r.payload)
+		if err != nil {
+			return errors.Annotatef(err, "unmarshal binlog at offset %d failed", offset)
+		}
+
+		err = fn(binlog)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		offset += r.recordLength()
+	}
+
+	return nil
+}
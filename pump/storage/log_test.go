@@ -242,7 +242,7 @@ func (lfs *LogFileSuit) TestLogFile(c *check.C) {
 	var offset int64
 	var err error
 	for i := range records {
-		readRecords[i], err = lf.readRecord(offset)
+		readRecords[i], err = lf.readRecord(offset, true)
 		c.Assert(err, check.IsNil)
 
 		recordOffsets[i] = offset
@@ -273,3 +273,39 @@ func (lfs *LogFileSuit) TestLogFile(c *check.C) {
 
 	c.Assert(lf.maxTS, check.Equals, lfs.maxTS)
 }
+
+func (lfs *LogFileSuit) TestReadLogFile(c *check.C) {
+	lf := lfs.lf
+
+	var records []*Record
+	lfs.fuzz.Fuzz(&records)
+	for _, r := range records {
+		_, err := encodeRecord(lf.fd, r.payload)
+		c.Assert(err, check.IsNil)
+	}
+
+	checkRead := func() {
+		idx := 0
+		err := ReadLogFile(lf.path, func(binlog *pb.Binlog) error {
+			payload, err := binlog.Marshal()
+			c.Assert(err, check.IsNil)
+			c.Assert(payload, check.DeepEquals, records[idx].payload)
+			idx++
+			return nil
+		})
+		c.Assert(err, check.IsNil)
+		c.Assert(idx, check.Equals, len(records))
+	}
+
+	checkRead()
+
+	// the footer should be skipped
+	c.Assert(lf.finalize(), check.IsNil)
+	checkRead()
+
+	// corruption is reported instead of skipped
+	_, err := lf.fd.Write(make([]byte, 100))
+	c.Assert(err, check.IsNil)
+	err = ReadLogFile(lf.path, func(*pb.Binlog) error { return nil })
+	c.Assert(err, check.ErrorMatches, ".*read record at offset.*")
+}
@@ -82,6 +82,9 @@ type Storage interface {
 	// GetBinlog return the binlog of ts
 	GetBinlog(ts int64) (binlog *pb.Binlog, err error)
 
+	// EstimateBacklog estimates the binlogs to pull after startTS up to endTS
+	EstimateBacklog(startTS, endTS int64) (*Backlog, error)
+
 	// PullCommitBinlog return the chan to consume the binlog
 	PullCommitBinlog(ctx context.Context, last int64) <-chan []byte
 
@@ -90,6 +93,16 @@ type Storage interface {
 
 var _ Storage = &Append{}
 
+// Backlog is the estimated amount of the binlogs in a range of ts
+type Backlog struct {
+	// the count of the P-binlogs and C-binlogs in the range
+	Binlogs int64 `json:"binlogs"`
+	// every txn writes a P-binlog and a C-binlog, so it's estimated as half of Binlogs
+	Txns int64 `json:"txns"`
+	// the size of the binlogs in the value log
+	Bytes int64 `json:"bytes"`
+}
+
 // Append implement the Storage interface
 type Append struct {
 	dir         string
@@ -789,6 +802,49 @@ func isFakeBinlog(binlog *pb.Binlog) bool {
 	return binlog.StartTs > 0 && binlog.StartTs == binlog.CommitTs
 }
 
+// EstimateBacklog implement Storage.EstimateBacklog, the sizes of the binlogs are read from the headers
+// of the records in the value log, so the payloads aren't read.
+// The range is (startTS, endTS], it's capped by the max commit ts, and the binlogs before gcTS are gone.
+func (a *Append) EstimateBacklog(startTS, endTS int64) (*Backlog, error) {
+	if gcTS := atomic.LoadInt64(&a.gcTS); startTS < gcTS {
+		startTS = gcTS
+	}
+	if maxCommitTS := a.MaxCommitTS(); endTS <= 0 || endTS > maxCommitTS {
+		endTS = maxCommitTS
+	}
+
+	backlog := new(Backlog)
+	if startTS >= endTS {
+		return backlog, nil
+	}
+
+	irange := &util.Range{
+		Start: encodeTSKey(startTS + 1),
+		Limit: encodeTSKey(endTS + 1),
+	}
+	iter := a.metadata.NewIterator(irange, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var vp valuePointer
+		if err := vp.UnmarshalBinary(iter.Value()); err != nil {
+			return nil, errors.Trace(err)
+		}
+		size, err := a.vlog.readRecordSize(vp)
+		if err != nil {
+			return nil, errors.Annotatef(err, "estimate the binlog of ts %d failed", decodeTSKey(iter.Key()))
+		}
+		backlog.Binlogs++
+		backlog.Bytes += size
+	}
+	if err := iter.Error(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	backlog.Txns = (backlog.Binlogs + 1) / 2
+	return backlog, nil
+}
+
 // WriteBinlog implement Storage.WriteBinlog
 func (a *Append) WriteBinlog(binlog *pb.Binlog) error {
 	if !a.writableOfSpace() {
@@ -1272,6 +1328,8 @@ type Config struct {
 	SlowWriteThreshold        float64        `toml:"slow_write_threshold" json:"slow_write_threshold"`
 	KV                        *KVConfig      `toml:"kv" json:"kv"`
 	StopWriteAtAvailableSpace *HumanizeBytes `toml:"stop-write-at-available-space" json:"stop-write-at-available-space"`
+	// verify the checksum of every binlog read from the value log, true by default
+	VerifyChecksum *bool `toml:"verify-checksum" json:"verify-checksum"`
 }
 
 // GetKVChanCapacity return kv_chan_cap config option
@@ -1301,6 +1359,15 @@ func (c *Config) GetStopWriteAtAvailableSpace() uint64 {
 	return c.StopWriteAtAvailableSpace.Uint64()
 }
 
+// GetVerifyChecksum return verify-checksum config option
+func (c *Config) GetVerifyChecksum() bool {
+	if c.VerifyChecksum == nil {
+		return true
+	}
+
+	return *c.VerifyChecksum
+}
+
 // GetSyncLog return sync-log config option
 func (c *Config) GetSyncLog() bool {
 	if c.SyncLog == nil {
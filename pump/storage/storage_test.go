@@ -271,6 +271,57 @@ func (as *AppendSuit) testWriteBinlogAndPullBack(c *check.C, prewriteValueSize i
 	appendStorage.Close()
 }
 
+func (as *AppendSuit) TestEstimateBacklog(c *check.C) {
+	append := newAppend(c)
+	defer cleanAppend(append)
+
+	// the size of the records of the binlogs keyed by ts
+	sizes := make(map[int64]int64)
+	for ts := int64(1); ts < 20; ts += 2 {
+		pbinlog := &pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: ts, PrewriteValue: make([]byte, ts*10)}
+		cbinlog := &pb.Binlog{Tp: pb.BinlogType_Commit, StartTs: ts, CommitTs: ts + 1}
+		for i, binlog := range []*pb.Binlog{pbinlog, cbinlog} {
+			c.Assert(append.WriteBinlog(binlog), check.IsNil)
+			payload, err := binlog.Marshal()
+			c.Assert(err, check.IsNil)
+			sizes[ts+int64(i)] = headerLength + int64(len(payload))
+		}
+	}
+	// the C-binlogs are indexed asynchronously
+	for i := 0; append.MaxCommitTS() < 20; i++ {
+		c.Assert(i, check.Less, 500)
+		time.Sleep(10 * time.Millisecond)
+	}
+	bytesOf := func(start, end int64) int64 {
+		var bytes int64
+		for ts := start + 1; ts <= end; ts++ {
+			bytes += sizes[ts]
+		}
+		return bytes
+	}
+
+	backlog, err := append.EstimateBacklog(0, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(*backlog, check.DeepEquals, Backlog{Binlogs: 20, Txns: 10, Bytes: bytesOf(0, 20)})
+
+	backlog, err = append.EstimateBacklog(10, 14)
+	c.Assert(err, check.IsNil)
+	c.Assert(*backlog, check.DeepEquals, Backlog{Binlogs: 4, Txns: 2, Bytes: bytesOf(10, 14)})
+
+	// the range is capped by the max commit ts and the gc ts
+	backlog, err = append.EstimateBacklog(10, 100)
+	c.Assert(err, check.IsNil)
+	c.Assert(*backlog, check.DeepEquals, Backlog{Binlogs: 10, Txns: 5, Bytes: bytesOf(10, 20)})
+	atomic.StoreInt64(&append.gcTS, 16)
+	backlog, err = append.EstimateBacklog(10, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(*backlog, check.DeepEquals, Backlog{Binlogs: 4, Txns: 2, Bytes: bytesOf(16, 20)})
+
+	backlog, err = append.EstimateBacklog(20, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(*backlog, check.DeepEquals, Backlog{})
+}
+
 func (as *AppendSuit) TestDoGCTS(c *check.C) {
 	var value = make([]byte, 10)
 	append := newAppend(c)
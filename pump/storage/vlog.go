@@ -48,6 +48,8 @@ type Options struct {
 	KVChanCapacity            int
 	SlowWriteThreshold        float64
 	StopWriteAtAvailableSpace uint64
+	// verify the checksum of every binlog read from the value log
+	VerifyChecksum bool
 
 	KVConfig *KVConfig
 }
@@ -59,6 +61,7 @@ func DefaultOptions() *Options {
 		Sync:               true,
 		KVChanCapacity:     chanCapacity,
 		SlowWriteThreshold: slowWriteThreshold,
+		VerifyChecksum:     true,
 	}
 }
 
@@ -74,6 +77,12 @@ func (o *Options) WithStopWriteAtAvailableSpace(bytes uint64) *Options {
 	return o
 }
 
+// WithVerifyChecksum set the VerifyChecksum
+func (o *Options) WithVerifyChecksum(verify bool) *Options {
+	o.VerifyChecksum = verify
+	return o
+}
+
 // WithSlowWriteThreshold set the Config
 func (o *Options) WithSlowWriteThreshold(threshold float64) *Options {
 	o.SlowWriteThreshold = threshold
@@ -327,7 +336,7 @@ func (vlog *valueLog) readValue(vp valuePointer) ([]byte, error) {
 
 	defer logFile.lock.RUnlock()
 
-	record, err := logFile.readRecord(vp.Offset)
+	record, err := logFile.readRecord(vp.Offset, vlog.opt.VerifyChecksum)
 	if err != nil {
 		return nil, errors.Annotatef(err, "read record at %+v failed", vp)
 	}
@@ -335,6 +344,19 @@ func (vlog *valueLog) readValue(vp valuePointer) ([]byte, error) {
 	return record.payload, nil
 }
 
+// readRecordSize returns the size of the record at vp without reading the payload
+func (vlog *valueLog) readRecordSize(vp valuePointer) (int64, error) {
+	logFile, err := vlog.getFileRLocked(vp.Fid)
+	if err != nil {
+		return 0, errors.Annotatef(err, "get file(id: %d) failed", vp.Fid)
+	}
+
+	defer logFile.lock.RUnlock()
+
+	size, err := logFile.readRecordSize(vp.Offset)
+	return size, errors.Annotatef(err, "read the size of record at %+v failed", vp)
+}
+
 // write is thread-unsafe by design and should not be called concurrently.
 func (vlog *valueLog) write(reqs []*request) error {
 	vlog.filesLock.RLock()
@@ -14,6 +14,7 @@
 package storage
 
 import (
+	"fmt"
 	"math/rand"
 	"os"
 	"path"
@@ -90,6 +91,43 @@ func (vs *VlogSuit) TestSingleWriteRead(c *check.C) {
 	c.Assert(req.payload, check.DeepEquals, payload, check.Commentf("data read back not equal"))
 }
 
+func (vs *VlogSuit) TestReadCorruptedRecord(c *check.C) {
+	vlog := newVlog(c)
+	defer os.RemoveAll(vlog.dirPath)
+
+	reqs := []*request{randRequest(), randRequest()}
+	err := vlog.write(reqs)
+	c.Assert(err, check.IsNil)
+
+	// flip a byte of the payload of the second record
+	vp := reqs[1].valuePointer
+	logFile, err := vlog.getFileRLocked(vp.Fid)
+	c.Assert(err, check.IsNil)
+	name := logFile.path
+	logFile.lock.RUnlock()
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	c.Assert(err, check.IsNil)
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, vp.Offset+headerLength)
+	c.Assert(err, check.IsNil)
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, vp.Offset+headerLength)
+	c.Assert(err, check.IsNil)
+	c.Assert(f.Close(), check.IsNil)
+
+	_, err = vlog.readValue(reqs[0].valuePointer)
+	c.Assert(err, check.IsNil)
+	_, err = vlog.readValue(vp)
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf(".*checksum mismatch of the record at offset %d in %s, expected crc32 [0-9]+ but got [0-9]+", vp.Offset, name))
+
+	// the corrupted payload is read out as it is without verifying
+	vlog.opt.VerifyChecksum = false
+	payload, err := vlog.readValue(vp)
+	c.Assert(err, check.IsNil)
+	c.Assert(payload, check.HasLen, len(reqs[1].payload))
+	c.Assert(payload, check.Not(check.DeepEquals), reqs[1].payload)
+}
+
 func (vs *VlogSuit) TestBatchWriteRead(c *check.C) {
 	testBatchWriteRead(c, 1, DefaultOptions())
 
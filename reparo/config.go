@@ -49,17 +49,24 @@ type Config struct {
 
 	DestType string           `toml:"dest-type" json:"dest-type"`
 	DestDB   *syncer.DBConfig `toml:"dest-db" json:"dest-db"`
+	// the file to write the statements generated to when dest type is "report"
+	ReportFile string `toml:"report-file" json:"report-file"`
 
 	DoTables []filter.TableName `toml:"replicate-do-table" json:"replicate-do-table"`
 	DoDBs    []string           `toml:"replicate-do-db" json:"replicate-do-db"`
 
 	IgnoreTables []filter.TableName `toml:"replicate-ignore-table" json:"replicate-ignore-table"`
 	IgnoreDBs    []string           `toml:"replicate-ignore-db" json:"replicate-ignore-db"`
+	// match the schema and table names of the filters case-sensitively like the case-sensitive of drainer,
+	// they're matched case-insensitively by default
+	CaseSensitive bool `toml:"case-sensitive" json:"case-sensitive"`
 
 	LogFile  string `toml:"log-file" json:"log-file"`
 	LogLevel string `toml:"log-level" json:"log-level"`
 
 	SafeMode bool `toml:"safe-mode" json:"safe-mode"`
+	// verify the checksum of every binlog read, reparo fails with the file and the offset of the corrupted binlog
+	VerifyChecksum bool `toml:"verify-checksum" json:"verify-checksum"`
 
 	configFile   string
 	printVersion bool
@@ -82,11 +89,13 @@ func NewConfig() *Config {
 	fs.IntVar(&c.TxnBatch, "txn-batch", 20, "number of binlog events in a transaction batch")
 	fs.IntVar(&c.WorkerCount, "c", 16, "parallel worker count")
 	fs.StringVar(&c.LogFile, "log-file", "", "log file path")
-	fs.StringVar(&c.DestType, "dest-type", "print", "dest type, values can be [print,mysql]")
+	fs.StringVar(&c.DestType, "dest-type", "print", "dest type, values can be [print,mysql,report]")
+	fs.StringVar(&c.ReportFile, "report-file", "", "the file to write the statements generated to, only used when dest type is report")
 	fs.StringVar(&c.LogLevel, "L", "info", "log level: debug, info, warn, error, fatal")
 	fs.StringVar(&c.configFile, "config", "", "[REQUIRED] path to configuration file")
 	fs.BoolVar(&c.printVersion, "V", false, "print reparo version info")
 	fs.BoolVar(&c.SafeMode, "safe-mode", false, "enable safe mode to make syncer reentrant")
+	fs.BoolVar(&c.VerifyChecksum, "verify-checksum", true, "verify the checksum of every binlog read, disable it only to read out the corrupted binlogs")
 	return c
 }
 
@@ -164,6 +173,9 @@ func (c *Config) Parse(args []string) (err error) {
 }
 
 func (c *Config) adjustDoDBAndTable() {
+	if c.CaseSensitive {
+		return
+	}
 	for i := 0; i < len(c.DoTables); i++ {
 		c.DoTables[i].Table = strings.ToLower(c.DoTables[i].Table)
 		c.DoTables[i].Schema = strings.ToLower(c.DoTables[i].Schema)
@@ -190,6 +202,11 @@ func (c *Config) validate() error {
 		return nil
 	case "print":
 		return nil
+	case "report":
+		if c.ReportFile == "" {
+			return errors.New("report-file must not be empty when dest type is report")
+		}
+		return nil
 	case "memory":
 		return nil
 	default:
@@ -73,6 +73,11 @@ func (s *testConfigSuite) TestAdjustDoDBAndTable(c *check.C) {
 	c.Assert(config.DoTables[0].Table, check.Equals, "table1")
 	c.Assert(config.DoDBs[0], check.Equals, "test1")
 	c.Assert(config.DoDBs[1], check.Equals, "test2")
+
+	// the names are kept if they're matched case-sensitively
+	config = &Config{CaseSensitive: true, DoDBs: []string{"TEST1"}}
+	config.adjustDoDBAndTable()
+	c.Assert(config.DoDBs[0], check.Equals, "TEST1")
 }
 
 func (s *testConfigSuite) TestParseConfigFileWithInvalidArgs(c *check.C) {
@@ -122,3 +127,14 @@ func getTemplateConfigFilePath() string {
 
 	return path
 }
+
+func (s *testConfigSuite) TestReportDestType(c *check.C) {
+	config := NewConfig()
+	err := config.Parse([]string{"-data-dir=/tmp/data", "-dest-type=report"})
+	c.Assert(err, check.ErrorMatches, ".*report-file must not be empty.*")
+
+	config = NewConfig()
+	err = config.Parse([]string{"-data-dir=/tmp/data", "-dest-type=report", "-report-file=/tmp/report.sql"})
+	c.Assert(err, check.IsNil)
+	c.Assert(config.ReportFile, check.Equals, "/tmp/report.sql")
+}
@@ -24,7 +24,16 @@ import (
 // Decode decodes binlog from protobuf content.
 // return *pb.Binlog and how many bytes read from reader
 func Decode(r io.Reader) (*pb.Binlog, int64, error) {
-	payload, length, err := binlogfile.Decode(r)
+	return decodeBinlog(r, true)
+}
+
+// decodeBinlog is like Decode, the checksum of the binlog is verified only if verifyChecksum is true
+func decodeBinlog(r io.Reader, verifyChecksum bool) (*pb.Binlog, int64, error) {
+	decode := binlogfile.Decode
+	if !verifyChecksum {
+		decode = binlogfile.DecodeWithoutChecksum
+	}
+	payload, length, err := decode(r)
 	if err != nil {
 		return nil, 0, errors.Trace(err)
 	}
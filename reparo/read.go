@@ -36,16 +36,21 @@ type dirPbReader struct {
 
 	startTS int64
 	endTS   int64
+	// verify the checksum of every binlog
+	verifyChecksum bool
 
 	file   *os.File
 	reader *bufio.Reader
+	// the offset of the next binlog to read in file
+	offset int64
 	idx    int // index of next file to read in files
 }
 
 var _ PbReader = &dirPbReader{}
 
-// newDirPbReader return a Reader to read binlogs with commit ts in [startTS, endTS]
-func newDirPbReader(dir string, startTS int64, endTS int64) (r *dirPbReader, err error) {
+// newDirPbReader return a Reader to read binlogs with commit ts in [startTS, endTS],
+// the checksum of every binlog is verified if verifyChecksum is true.
+func newDirPbReader(dir string, startTS int64, endTS int64, verifyChecksum bool) (r *dirPbReader, err error) {
 	files, err := searchFiles(dir)
 	if err != nil {
 		return nil, errors.Annotate(err, "searchFiles failed")
@@ -57,11 +62,12 @@ func newDirPbReader(dir string, startTS int64, endTS int64) (r *dirPbReader, err
 	}
 
 	r = &dirPbReader{
-		startTS: startTS,
-		endTS:   endTS,
-		dir:     dir,
-		files:   files,
-		idx:     0,
+		startTS:        startTS,
+		endTS:          endTS,
+		verifyChecksum: verifyChecksum,
+		dir:            dir,
+		files:          files,
+		idx:            0,
 	}
 
 	// if empty files in dir, return success and later `Read` will return `io.EOF`
@@ -98,6 +104,7 @@ func (r *dirPbReader) nextFile() (err error) {
 	}
 
 	r.reader = bufio.NewReader(r.file)
+	r.offset = 0
 
 	r.idx++
 
@@ -110,8 +117,10 @@ func (r *dirPbReader) read() (binlog *pb.Binlog, err error) {
 	}
 
 	for {
-		binlog, _, err = Decode(r.reader)
+		var length int64
+		binlog, length, err = decodeBinlog(r.reader, r.verifyChecksum)
 		if err == nil {
+			r.offset += length
 			if !isAcceptableBinlog(binlog, r.startTS, r.endTS) {
 				continue
 			}
@@ -128,6 +137,6 @@ func (r *dirPbReader) read() (binlog *pb.Binlog, err error) {
 			continue
 		}
 
-		return nil, errors.Annotate(err, "decode failed")
+		return nil, errors.Annotatef(err, "decode the binlog at offset %d of file %s failed", r.offset, r.files[r.idx-1])
 	}
 }
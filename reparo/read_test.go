@@ -14,7 +14,9 @@
 package reparo
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 
@@ -86,7 +88,7 @@ func (s *testReadSuite) TestReader(c *check.C) {
 
 	// read back all binlogs in directory
 	var readBackBinlogs []*pb.Binlog
-	reader, err := newDirPbReader(dir, 0, 0)
+	reader, err := newDirPbReader(dir, 0, 0, true)
 	c.Assert(err, check.IsNil)
 
 	readBackBinlogs, err = readAll(reader)
@@ -96,7 +98,7 @@ func (s *testReadSuite) TestReader(c *check.C) {
 	// we write the binlog with commit ts start at one(1,2,3,4...)
 	for start := 1; start <= len(binlogs); start++ {
 		for end := start; end <= len(binlogs); end++ {
-			reader, err := newDirPbReader(dir, int64(start), int64(end))
+			reader, err := newDirPbReader(dir, int64(start), int64(end), true)
 			c.Assert(err, check.IsNil)
 
 			readBackBinlogs, err = readAll(reader)
@@ -106,3 +108,28 @@ func (s *testReadSuite) TestReader(c *check.C) {
 	}
 
 }
+
+func (s *testReadSuite) TestReadCorruptedBinlog(c *check.C) {
+	dir := c.MkDir()
+	binlogs := writeBinlogsInDir(dir, c)
+
+	// corrupt the crc32 of the second binlog in the third file
+	filename := path.Join(dir, binlogfile.BinlogName(2))
+	data, err := ioutil.ReadFile(filename)
+	c.Assert(err, check.IsNil)
+	entrySize := len(data) / 3
+	data[2*entrySize-1] ^= 0xff
+	c.Assert(ioutil.WriteFile(filename, data, 0644), check.IsNil)
+
+	reader, err := newDirPbReader(dir, 0, 0, true)
+	c.Assert(err, check.IsNil)
+	_, err = readAll(reader)
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf("decode the binlog at offset %d of file %s failed: expected crc32 [0-9]+ but got [0-9]+", entrySize, filename))
+
+	// all binlogs are read out without verifying the checksum
+	reader, err = newDirPbReader(dir, 0, 0, false)
+	c.Assert(err, check.IsNil)
+	readBackBinlogs, err := readAll(reader)
+	c.Assert(err, check.IsNil)
+	c.Assert(readBackBinlogs, check.DeepEquals, binlogs)
+}
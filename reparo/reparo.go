@@ -37,23 +37,29 @@ type Reparo struct {
 func New(cfg *Config) (*Reparo, error) {
 	log.Info("New Reparo", zap.Stringer("config", cfg))
 
-	syncer, err := syncer.New(cfg.DestType, cfg.DestDB, cfg.WorkerCount, cfg.TxnBatch, cfg.SafeMode)
+	syncer, err := syncer.New(cfg.DestType, cfg.DestDB, cfg.WorkerCount, cfg.TxnBatch, cfg.SafeMode, cfg.ReportFile)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	filter := filter.NewFilter(cfg.IgnoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
-
 	return &Reparo{
 		cfg:    cfg,
 		syncer: syncer,
-		filter: filter,
+		filter: newFilter(cfg),
 	}, nil
 }
 
+// newFilter returns the filter of the schemas and tables to restore, which works like the filter of drainer
+func newFilter(cfg *Config) *filter.Filter {
+	if cfg.CaseSensitive {
+		return filter.NewCaseSensitiveFilter(cfg.IgnoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
+	}
+	return filter.NewFilter(cfg.IgnoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
+}
+
 // Process runs the main procedure.
 func (r *Reparo) Process() error {
-	pbReader, err := newDirPbReader(r.cfg.Dir, r.cfg.StartTSO, r.cfg.StopTSO)
+	pbReader, err := newDirPbReader(r.cfg.Dir, r.cfg.StartTSO, r.cfg.StopTSO, r.cfg.VerifyChecksum)
 	if err != nil {
 		return errors.Annotatef(err, "new reader failed dir: %s", r.cfg.Dir)
 	}
@@ -125,6 +131,9 @@ func filterBinlog(afilter *filter.Filter, binlog *pb.Binlog) (ignore bool, err e
 			ignore = true
 		}
 		return
+	case pb.BinlogType_BEGIN, pb.BinlogType_COMMIT:
+		// the markers written by drainer with txn-markers, every binlog is applied as a whole txn anyway
+		return true, nil
 	default:
 		return false, errors.Errorf("unknown type: %d", binlog.Tp)
 	}
@@ -15,10 +15,13 @@ package reparo
 
 import (
 	"fmt"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/gogo/protobuf/proto"
 	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 	"github.com/pingcap/tidb-binlog/reparo/syncer"
@@ -111,6 +114,13 @@ func (s *testReparoSuite) TestFilterBinlog(c *C) {
 		c.Assert(getIgnore, Equals, ignore)
 	}
 
+	// the txn markers are always ignored
+	for _, tp := range []pb.BinlogType{pb.BinlogType_BEGIN, pb.BinlogType_COMMIT} {
+		getIgnore, err := filterBinlog(afilter, &pb.Binlog{Tp: tp, CommitTs: 100})
+		c.Assert(err, IsNil)
+		c.Assert(getIgnore, IsTrue)
+	}
+
 	dmlBinlogs := map[*pb.Binlog]bool{
 		{
 			Tp: pb.BinlogType_DML,
@@ -172,3 +182,83 @@ func (s *testReparoSuite) TestProcess(c *C) {
 	memSyncer := repora.syncer.(*syncer.MemSyncer)
 	c.Assert(memSyncer.GetBinlogs(), DeepEquals, binlogs)
 }
+
+func writeMultiTableBinlogs(dir string, c *C) {
+	event := func(schema, table string) pb.Event {
+		return pb.Event{SchemaName: proto.String(schema), TableName: proto.String(table), Tp: pb.EventType_Insert}
+	}
+	binlogs := []*pb.Binlog{
+		{Tp: pb.BinlogType_DDL, CommitTs: 1, DdlQuery: []byte("use test; create table t1(id int)")},
+		{Tp: pb.BinlogType_DDL, CommitTs: 2, DdlQuery: []byte("use test; create table t2(id int)")},
+		{Tp: pb.BinlogType_DDL, CommitTs: 3, DdlQuery: []byte("use other; create table t3(id int)")},
+		{Tp: pb.BinlogType_DML, CommitTs: 4, DmlData: &pb.DMLData{Events: []pb.Event{
+			event("test", "t1"), event("test", "t2"), event("other", "t3"),
+		}}},
+		{Tp: pb.BinlogType_DML, CommitTs: 5, DmlData: &pb.DMLData{Events: []pb.Event{event("test", "T1")}}},
+	}
+
+	file, err := os.Create(path.Join(dir, binlogfile.BinlogName(0)))
+	c.Assert(err, IsNil)
+	defer file.Close()
+	for _, binlog := range binlogs {
+		data, err := binlog.Marshal()
+		c.Assert(err, IsNil)
+		_, err = file.Write(binlogfile.Encode(data))
+		c.Assert(err, IsNil)
+	}
+}
+
+// restoredTables returns the commit ts and the tables of the restored DMLs or the DDL query
+func restoredTables(binlogs []*pb.Binlog) []string {
+	var restored []string
+	for _, binlog := range binlogs {
+		if binlog.Tp == pb.BinlogType_DDL {
+			restored = append(restored, fmt.Sprintf("%d %s", binlog.CommitTs, binlog.DdlQuery))
+			continue
+		}
+		for _, e := range binlog.DmlData.Events {
+			restored = append(restored, fmt.Sprintf("%d %s.%s", binlog.CommitTs, e.GetSchemaName(), e.GetTableName()))
+		}
+	}
+	return restored
+}
+
+func (s *testReparoSuite) TestProcessSelectedTables(c *C) {
+	dir := c.MkDir()
+	writeMultiTableBinlogs(dir, c)
+
+	restore := func(adjust func(cfg *Config)) []string {
+		cfg := NewConfig()
+		cfg.Dir = dir
+		cfg.DestType = "memory"
+		cfg.VerifyChecksum = true
+		adjust(cfg)
+		cfg.adjustDoDBAndTable()
+
+		r, err := New(cfg)
+		c.Assert(err, IsNil)
+		c.Assert(r.Process(), IsNil)
+		return restoredTables(r.syncer.(*syncer.MemSyncer).GetBinlogs())
+	}
+
+	restored := restore(func(cfg *Config) {
+		cfg.DoTables = []filter.TableName{{Schema: "TEST", Table: "t1"}}
+	})
+	c.Assert(restored, DeepEquals, []string{"1 use test; create table t1(id int)", "4 test.t1", "5 test.T1"})
+
+	restored = restore(func(cfg *Config) {
+		cfg.CaseSensitive = true
+		cfg.DoTables = []filter.TableName{{Schema: "test", Table: "t1"}}
+	})
+	c.Assert(restored, DeepEquals, []string{"1 use test; create table t1(id int)", "4 test.t1"})
+
+	restored = restore(func(cfg *Config) {
+		cfg.DoDBs = []string{"other"}
+	})
+	c.Assert(restored, DeepEquals, []string{"3 use other; create table t3(id int)", "4 other.t3"})
+
+	restored = restore(func(cfg *Config) {
+		cfg.IgnoreTables = []filter.TableName{{Schema: "test", Table: "~^t[12]$"}}
+	})
+	c.Assert(restored, DeepEquals, []string{"3 use other; create table t3(id int)", "4 other.t3"})
+}
@@ -39,7 +39,7 @@ func (s *testMysqlSuite) testMysqlSyncer(c *check.C, safemode bool) {
 	mock.ExpectExec("create database test").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit()
 
-	mock.ExpectQuery("SELECT column_name, extra FROM information_schema.columns").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", "").AddRow("b", "").AddRow("c", ""))
+	mock.ExpectQuery("SELECT column_name, extra, column_type FROM information_schema.columns").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra", "column_type"}).AddRow("a", "", "int(11)").AddRow("b", "", "int(11)").AddRow("c", "", "int(11)"))
 
 	rows := sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"})
 	mock.ExpectQuery("SELECT non_unique, index_name, seq_in_index, column_name FROM information_schema.statistics").
@@ -0,0 +1,130 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+// reportSyncer translates the binlogs to the statements as the mysql syncer does without
+// executing them, the statements are written to the report file grouped by table when it's closed.
+type reportSyncer struct {
+	f        *os.File
+	safeMode bool
+
+	// table name -> statements of the table, the name is quoted
+	tables map[string][]string
+	total  int
+}
+
+var _ Syncer = &reportSyncer{}
+
+func newReportSyncer(path string, safemode bool) (*reportSyncer, error) {
+	if len(path) == 0 {
+		return nil, errors.New("path of report file is empty")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &reportSyncer{
+		f:        f,
+		safeMode: safemode,
+		tables:   make(map[string][]string),
+	}, nil
+}
+
+func (r *reportSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	txn, err := pbBinlogToTxn(pbBinlog)
+	if err != nil {
+		return errors.Annotate(err, "pbBinlogToTxn failed")
+	}
+
+	for _, stmt := range loader.DryRun(txn, r.safeMode) {
+		name := pkgsql.QuoteName(stmt.Database)
+		if len(stmt.Table) > 0 {
+			name = pkgsql.QuoteSchema(stmt.Database, stmt.Table)
+		}
+		r.tables[name] = append(r.tables[name], formatStatement(stmt))
+		r.total++
+	}
+
+	cb(pbBinlog)
+	return nil
+}
+
+// Close writes the report and closes the report file
+func (r *reportSyncer) Close() error {
+	err := r.writeReport()
+	if closeErr := r.f.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Trace(err)
+}
+
+func (r *reportSyncer) writeReport() error {
+	names := make([]string, 0, len(r.tables))
+	for name := range r.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := bufio.NewWriter(r.f)
+	fmt.Fprintf(w, "-- total: %d tables, %d statements\n", len(names), r.total)
+	for _, name := range names {
+		stmts := r.tables[name]
+		fmt.Fprintf(w, "\n-- %s: %d statements\n", name, len(stmts))
+		for _, stmt := range stmts {
+			fmt.Fprintln(w, stmt)
+		}
+	}
+	return errors.Trace(w.Flush())
+}
+
+func formatStatement(stmt loader.Statement) string {
+	sql := strings.TrimSuffix(strings.TrimSpace(stmt.SQL), ";") + ";"
+	if len(stmt.Args) == 0 {
+		return sql
+	}
+
+	args := make([]string, 0, len(stmt.Args))
+	for _, arg := range stmt.Args {
+		args = append(args, formatArg(arg))
+	}
+	return fmt.Sprintf("%s -- args: [%s]", sql, strings.Join(args, ", "))
+}
+
+func formatArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []byte:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
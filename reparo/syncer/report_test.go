@@ -0,0 +1,73 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/pingcap/check"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+type testReportSuite struct{}
+
+var _ = check.Suite(&testReportSuite{})
+
+func (s *testReportSuite) TestReport(c *check.C) {
+	reportFile := path.Join(c.MkDir(), "report.sql")
+	syncer, err := New("report", nil, 16, 20, false, reportFile)
+	c.Assert(err, check.IsNil)
+
+	syncTest(c, syncer)
+	ddlBinlog := &pb.Binlog{
+		Tp:       pb.BinlogType_DDL,
+		DdlQuery: []byte("use test; create table t2 (a int);"),
+	}
+	c.Assert(syncer.Sync(ddlBinlog, func(*pb.Binlog) {}), check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	data, err := ioutil.ReadFile(reportFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "-- total: 3 tables, 5 statements\n"+
+		"\n-- `test`: 1 statements\n"+
+		"create database test;\n"+
+		"\n-- `test`.`t1`: 3 statements\n"+
+		"INSERT INTO `test`.`t1`(`a`,`b`) VALUES(?,?); -- args: [1, \"test\"]\n"+
+		"DELETE FROM `test`.`t1` WHERE `a` = ? AND `b` = ? LIMIT 1; -- args: [1, \"test\"]\n"+
+		"UPDATE `test`.`t1` SET `c` = ? WHERE `c` = ? LIMIT 1; -- args: [\"abc\", \"test\"]\n"+
+		"\n-- `test`.`t2`: 1 statements\n"+
+		"create table t2 (a int);\n")
+}
+
+func (s *testReportSuite) TestReportSafeMode(c *check.C) {
+	reportFile := path.Join(c.MkDir(), "report.sql")
+	syncer, err := newReportSyncer(reportFile, true)
+	c.Assert(err, check.IsNil)
+
+	syncTest(c, syncer)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	data, err := ioutil.ReadFile(reportFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Matches, "(?s)-- total: 2 tables, 5 statements\n.*"+
+		"\n-- `test`.`t1`: 4 statements\n"+
+		"REPLACE INTO `test`.`t1`.*\n"+
+		"DELETE FROM `test`.`t1`.*\n"+
+		"DELETE FROM `test`.`t1` WHERE `c` = \\? LIMIT 1; -- args: \\[\"test\"\\]\n"+
+		"REPLACE INTO `test`.`t1`\\(`c`\\) VALUES\\(\\?\\); -- args: \\[\"abc\"\\]\n")
+
+	_, err = newReportSyncer("", false)
+	c.Assert(err, check.ErrorMatches, ".*path of report file is empty.*")
+}
@@ -28,8 +28,8 @@ type Syncer interface {
 	Close() error
 }
 
-// New creates a new executor based on the name.
-func New(name string, cfg *DBConfig, worker int, batchSize int, safemode bool) (Syncer, error) {
+// New creates a new executor based on the name, reportFile is only used by the "report" syncer.
+func New(name string, cfg *DBConfig, worker int, batchSize int, safemode bool, reportFile string) (Syncer, error) {
 	switch name {
 	case "mysql":
 		return newMysqlSyncer(cfg, worker, batchSize, safemode)
@@ -37,6 +37,8 @@ func New(name string, cfg *DBConfig, worker int, batchSize int, safemode bool) (
 		return newPrintSyncer()
 	case "memory":
 		return newMemSyncer()
+	case "report":
+		return newReportSyncer(reportFile, safemode)
 	}
 	panic(fmt.Sprintf("unknown syncer %s", name))
 }
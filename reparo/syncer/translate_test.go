@@ -41,6 +41,16 @@ func (s *testTranslateSuite) TestPBBinlogToTxn(c *check.C) {
 				Table:    "table1",
 			},
 		},
+		{
+			Tp:       pb.BinlogType_DDL,
+			DdlQuery: []byte("use db1;create table table1(id int comment 'id; auto_random') comment 'table;'"),
+		}: {
+			DDL: &loader.DDL{
+				SQL:      "create table table1(id int comment 'id; auto_random') comment 'table;'",
+				Database: "db1",
+				Table:    "table1",
+			},
+		},
 		{
 			Tp:       pb.BinlogType_DDL,
 			DdlQuery: []byte("create table `db1`.`table1`(id int)"),
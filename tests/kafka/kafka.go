@@ -87,6 +87,9 @@ func main() {
 		for msg := range breader.Messages() {
 			str := msg.Binlog.String()
 			log.S().Debugf("recv: %.2000s", str)
+			if !loader.IsSlaveBinlogData(msg.Binlog) {
+				continue
+			}
 			txn, err := loader.SlaveBinlogToTxn(msg.Binlog)
 			if err != nil {
 				log.S().Fatal(err)